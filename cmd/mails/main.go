@@ -2,25 +2,40 @@
 //
 // Usage:
 //
-//	mails serve    Start the HTTP server
-//	mails version  Print version information
+//	mails serve      Start the HTTP server
+//	mails fix-dates  Fix mtime on all .eml files
+//	mails verify     Verify .eml checksums against their filenames
+//	mails compact    Rebuild and re-save every account's parquet index
+//	mails search     Search exported mailbox directories from the shell
+//	mails duplicates Report messages stored more than once across accounts
+//	mails version    Print version information
 package main
 
 import (
-	"bufio"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"flag"
 	"fmt"
 	"log"
 	"net/http"
-	"net/mail"
 	"os"
 	"path/filepath"
+	"strconv"
 	"strings"
 	"time"
 
 	"github.com/eslider/mails/internal/account"
+	"github.com/eslider/mails/internal/annotation"
 	"github.com/eslider/mails/internal/auth"
+	"github.com/eslider/mails/internal/checksum"
+	"github.com/eslider/mails/internal/pdf"
+	"github.com/eslider/mails/internal/search/eml"
+	"github.com/eslider/mails/internal/search/index"
 	"github.com/eslider/mails/internal/storage"
 	"github.com/eslider/mails/internal/sync"
+	sync_imap "github.com/eslider/mails/internal/sync/imap"
 	"github.com/eslider/mails/internal/user"
 	"github.com/eslider/mails/internal/web"
 )
@@ -34,17 +49,60 @@ func envOr(key, fallback string) string {
 	return fallback
 }
 
+// envInt64 parses a non-negative integer env var, warning and falling back on bad input.
+func envInt64(key string, fallback int64) int64 {
+	v := os.Getenv(key)
+	if v == "" {
+		return fallback
+	}
+	n, err := strconv.ParseInt(v, 10, 64)
+	if err != nil || n < 0 {
+		log.Printf("WARN: invalid %s=%q, using %d", key, v, fallback)
+		return fallback
+	}
+	return n
+}
+
+func envDuration(key string, fallback time.Duration) time.Duration {
+	v := os.Getenv(key)
+	if v == "" {
+		return fallback
+	}
+	d, err := time.ParseDuration(v)
+	if err != nil || d < 0 {
+		log.Printf("WARN: invalid %s=%q, using %s", key, v, fallback)
+		return fallback
+	}
+	return d
+}
+
 func main() {
 	if len(os.Args) < 2 {
 		printUsage()
 		os.Exit(1)
 	}
 
+	loadSealKey()
+
 	switch os.Args[1] {
 	case "serve":
 		runServe()
 	case "fix-dates":
 		runFixDates()
+	case "verify":
+		runVerify(os.Args[2:])
+	case "migrate-filenames":
+		runMigrateFilenames(os.Args[2:])
+	case "compact":
+		runCompact(os.Args[2:])
+	case "encrypt":
+		runEncrypt(os.Args[2:])
+	case "search":
+		runSearch(os.Args[2:])
+	case "duplicates":
+		runDuplicates(os.Args[2:])
+	case "admin":
+		runAdmin(os.Args[2:])
 	case "version":
 		fmt.Printf("mails %s\n", version)
 	default:
@@ -59,6 +117,25 @@ func printUsage() {
 Commands:
   serve       Start the HTTP server
   fix-dates   Fix mtime on all .eml files using Date/Received headers
+  verify      Check .eml files against the checksum in their filename
+              (--quarantine moves bad files to DATA_DIR/.quarantine)
+  migrate-filenames
+              Rename .eml files without a checksum prefix (readpst output,
+              other tools) to {checksum}-{n}.eml so they deduplicate; lists
+              the renames only, unless --apply (--user limits to one user ID)
+  compact     Rebuild and re-save parquet indexes, reporting row counts
+              and sizes (--user limits to one user ID)
+  encrypt     Encrypt the plain .eml files already under DATA_DIR with
+              EMAIL_ENCRYPTION_KEY (--user limits to one user ID)
+  search      Search .eml directories listed in EMAILS_DIRS as one merged,
+              deduplicated index (--stats, --rebuild, --limit N); with
+              MULTI=1 each subdirectory is searched as its own account
+  duplicates  Report messages stored more than once across a user's
+              accounts, by Message-ID or checksum, with every copy's path
+              (--user limits to one user ID, --json for a structured report)
+  admin       Grant a user, by email or ID, the admin role: listing and
+              stopping every user's syncs under /api/admin (--revoke takes
+              it away; a running server applies it at once)
   version     Print version information
 
 Environment:
@@ -74,8 +151,75 @@ Environment:
   FACEBOOK_CLIENT_SECRET Facebook OAuth app client secret
 
   QDRANT_URL          Qdrant gRPC address for similarity search
+  QDRANT_API_KEY      API key for hosted Qdrant (default: none)
+  QDRANT_TLS          Connect to Qdrant over TLS (default: false; implied by https://)
   OLLAMA_URL          Ollama API URL for embeddings
   EMBED_MODEL         Ollama embedding model (default: all-minilm)
+  EMBED_RPS           Max embed requests per second (default: unlimited)
+  EMBED_MAX_INFLIGHT  Max concurrent embed requests (default: unlimited)
+  EMBED_CHUNK         Emails per embed/upsert step when indexing; bounds memory (default: 500)
+  EMBED_PROBE_TIMEOUT Startup embed probe timeout (default: 15s)
+  EMBED_AUTO_PULL     Pull a missing embedding model on startup (default: false)
+
+  ATTACHMENT_MAX_BYTES Cut attachment downloads at this size (default: 0, no limit)
+  SEARCH_DEFAULT_LIMIT Search page size when no limit is given (default: 50)
+  MAX_SEARCH_LIMIT    Largest search limit honoured; larger requests are capped
+                      and flagged with an X-Limit-Clamped header (default: 500)
+  PST_WORKERS         Parallel writers during PST/OST import (default: 4)
+  REINDEX_WORKERS     Accounts rebuilt at once by a reindex (default: 2)
+  REINDEX_VECTORS     Set to true to have a reindex update the similarity index of
+                      the accounts it rebuilt, per user and account (default: false)
+  EXTERNAL_MAIL_ROOTS Colon-separated directories accounts may read existing mail
+                      trees from in place, read-only (email_dir_override); each
+                      user reaches only <root>/<user ID>, and never DATA_DIR
+  MAX_BODY_BYTES      Largest API request body; uploads are exempt (default: 1048576)
+  REQUEST_TIMEOUT     Time an API request has to answer; uploads, downloads and
+                      streams are exempt (default: 1m)
+  MAIL_TLS_CA_FILE    Extra CA bundle (PEM) trusted for IMAP/POP3 TLS
+  MAIL_TLS_CLIENT_CERT_FILE, MAIL_TLS_CLIENT_KEY_FILE
+                      Client certificate and key (PEM) for IMAP/POP3 TLS;
+                      accounts can set their own under "TLS options"
+  USER_QUOTA_BYTES    Per-user archive size limit; sync and import are refused
+                      once it is reached (default: 0, no quota)
+  SYNC_MAX_FAILURES   Auto-pause an account after N failed syncs in a row (default: 5, 0 = never)
+  SYNC_WEBHOOK_URL    POST a JSON summary here when a sync downloads new mail
+  LIVE_INDEX_INTERVAL Pause between search index refreshes while a sync runs; a refresh
+                      that took longer waits as long again (default: 5s, 0 = off)
+  IMAP_CONNECT_TIMEOUT IMAP dial and TLS handshake timeout (default: 30s)
+  IMAP_IO_TIMEOUT     IMAP read timeout; raise for slow servers with large
+                      attachments, lower to detect dead connections (default: 120s).
+                      Accounts can override both (connect_timeout, io_timeout)
+  IMAP_FOLDER_PRIORITY Folders synced first when syncing all folders (default: INBOX,Sent)
+  EMAIL_ENCRYPTION_KEY 32-byte master key (64 hex chars or base64) that new .eml
+                      files are encrypted with (AES-256-GCM, one key per user);
+                      needed to read them back (default: none, files stay plain)
+  CHECKSUM_LENGTH     Hex chars of SHA-256 in new filenames, 16-64 (default: 24);
+                      existing files keep their names and still deduplicate
+
+  EMAILS_DIRS         search: colon-separated .eml directories (default: EMAILS_DIR)
+  INDEX_DIR           search: where per-directory indexes are kept (default: ./.mails-index)
+  MULTI               search: set to 1 to treat each EMAILS_DIRS entry as a tree of
+                      account directories, indexed and counted one by one (its own
+                      .eml files, if any, count as one more)
+  INDEX_HEADERS       Comma-separated headers indexed for header:name:value search,
+                      e.g. List-Id,X-Ticket-ID (reindex with force=true after changing)
+  INDEX_BODY          Set to false to leave body text out of the index and embeddings;
+                      search then covers subject, from and to (reindex with force=true)
+  INDEX_HTML          Set to true to keep each email's HTML body (up to 1 MiB) in the
+                      index, so GET /api/email?source=index needs no file (reindex)
+  INDEX_ATTACHMENTS   Set to true to index the text of PDF, docx and plain text attachments
+                      (up to 256 KiB per email) for in:attachment search; slows builds (reindex)
+  DEDUP_SCOPE         global (default): a message held by several accounts is one hit
+                      when they are searched together; account: one hit per account
+  DATE_LAYOUTS        Extra Go time layouts, separated by |, for Date headers no built-in
+                      format parses, e.g. "2006/01/02 15h04" (reindex to apply)
+
+  PDF_FONT            TrueType (.ttf) font embedded in email PDFs for characters outside
+                      Windows-1252, e.g. Cyrillic or Greek (default: DejaVu Sans from
+                      fonts-dejavu-core)
+
+  DUCKDB_MEMORY_LIMIT DuckDB memory cap for the index, e.g. 512MB (default: DuckDB's)
+  DUCKDB_TEMP_DIR     DuckDB spill directory (default: DuckDB's)
 
   S3_ENDPOINT         S3-compatible storage (e.g. MinIO)
   S3_ACCESS_KEY_ID    S3 access key
@@ -107,6 +251,8 @@ func runServe() {
 
 	accountStore := account.NewStore(dataDir, blobStore)
 	syncService := sync.NewService(dataDir, accountStore, blobStore)
+	// Indexes from an older release keep serving while they are rebuilt.
+	go syncService.RebuildOutdatedIndexes()
 
 	// Configure OAuth providers.
 	var ghCfg, glCfg, fbCfg *auth.ProviderConfig
@@ -133,6 +279,10 @@ func runServe() {
 	providers := auth.NewProviders(baseURL, ghCfg, glCfg, fbCfg)
 
 	// Set static assets and templates path.
+	if err := pdf.LoadFont(envOr("PDF_FONT", pdf.DefaultFont)); err != nil {
+		log.Printf("WARN: PDF_FONT: %v; email PDFs print characters outside Windows-1252 as ?", err)
+	}
+
 	staticDir := envOr("STATIC_DIR", "./web/static")
 	templateDir := envOr("TEMPLATE_DIR", "")
 	web.StaticDir = staticDir
@@ -141,18 +291,31 @@ func runServe() {
 		web.ReloadTemplates()
 	}
 
+	// Vectors stay off until the server serves similarity search.
+	reindexVectors, _ := strconv.ParseBool(os.Getenv("REINDEX_VECTORS"))
+
 	// Build router.
 	router := web.NewRouter(web.Config{
-		Users:      userStore,
-		Accounts:   accountStore,
-		Sessions:   sessionStore,
-		Auth:       providers,
-		Sync:       syncService,
-		UsersDir:   dataDir,
-		BlobStore:  blobStore,
-		QdrantURL:  envOr("QDRANT_URL", ""),
-		OllamaURL:  envOr("OLLAMA_URL", ""),
-		EmbedModel: envOr("EMBED_MODEL", "all-minilm"),
+		Users:       userStore,
+		Accounts:    accountStore,
+		Sessions:    sessionStore,
+		Auth:        providers,
+		Sync:        syncService,
+		Annotations: annotation.NewStore(dataDir, blobStore),
+		UsersDir:    dataDir,
+		BlobStore:   blobStore,
+		QdrantURL:   envOr("QDRANT_URL", ""),
+		OllamaURL:   envOr("OLLAMA_URL", ""),
+		EmbedModel:  envOr("EMBED_MODEL", "all-minilm"),
+
+		MaxAttachmentBytes: envInt64("ATTACHMENT_MAX_BYTES", 0),
+		DefaultSearchLimit: int(envInt64("SEARCH_DEFAULT_LIMIT", 50)),
+		MaxSearchLimit:     int(envInt64("MAX_SEARCH_LIMIT", 500)),
+		ReindexWorkers:     int(envInt64("REINDEX_WORKERS", 2)),
+		ReindexVectors:     reindexVectors,
+		ExternalMailRoots:  filepath.SplitList(os.Getenv("EXTERNAL_MAIL_ROOTS")),
+		MaxBodyBytes:       envInt64("MAX_BODY_BYTES", 1<<20),
+		RequestTimeout:     envDuration("REQUEST_TIMEOUT", time.Minute),
 	})
 
 	log.Printf("Starting mail-archive %s on %s", version, listenAddr)
@@ -166,114 +329,486 @@ func runServe() {
 
 func runFixDates() {
 	dataDir := envOr("DATA_DIR", "./users")
-	fixed := 0
-	skipped := 0
-	errors := 0
+	res, err := eml.FixDates(dataDir, func(r eml.FixDatesResult) {
+		log.Printf("Progress: %d fixed, %d skipped, %d errors", r.Fixed, r.Skipped, r.Errors)
+	})
+	if err != nil {
+		log.Fatalf("Walk error: %v", err)
+	}
+	log.Printf("Done: %d fixed, %d skipped, %d errors", res.Fixed, res.Skipped, res.Errors)
+}
+
+// quarantineDir is where `mails verify --quarantine` moves bad files,
+// relative to DATA_DIR. It is skipped when walking.
+const quarantineDir = ".quarantine"
+
+func runVerify(args []string) {
+	fs := flag.NewFlagSet("verify", flag.ExitOnError)
+	quarantine := fs.Bool("quarantine", false, "move corrupted and empty files to DATA_DIR/"+quarantineDir)
+	fs.Parse(args)
+
+	dataDir := envOr("DATA_DIR", "./users")
+	checked := 0
+	unchecked := 0
+	var bad []string
 
 	err := filepath.WalkDir(dataDir, func(path string, d os.DirEntry, err error) error {
-		if err != nil || d.IsDir() {
+		if err != nil {
 			return nil
 		}
-		if !strings.HasSuffix(strings.ToLower(d.Name()), ".eml") {
+		if d.IsDir() {
+			if d.Name() == quarantineDir {
+				return filepath.SkipDir
+			}
 			return nil
 		}
-
-		date := extractEmailDate(path)
-		if date.IsZero() {
-			skipped++
+		if !eml.IsEmailFile(d.Name()) {
 			return nil
 		}
 
-		info, err := d.Info()
+		// Checksums are of the message, so compressed files are checked
+		// after decompressing.
+		data, err := eml.ReadFile(path)
 		if err != nil {
-			errors++
+			log.Printf("WARN: %s: %v", path, err)
+			bad = append(bad, path)
 			return nil
 		}
-
-		// Only update if mtime differs by more than 1 minute.
-		if info.ModTime().Sub(date).Abs() < time.Minute {
-			skipped++
+		if len(data) == 0 {
+			log.Printf("EMPTY: %s", path)
+			bad = append(bad, path)
 			return nil
 		}
 
-		if err := os.Chtimes(path, date, date); err != nil {
-			log.Printf("WARN: %s: %v", path, err)
-			errors++
+		sum := checksum.FromName(d.Name())
+		if sum == "" {
+			// Files from readpst or manual copies carry no checksum.
+			unchecked++
 			return nil
 		}
-		fixed++
-		if fixed%1000 == 0 {
-			log.Printf("Progress: %d fixed, %d skipped, %d errors", fixed, skipped, errors)
+		checked++
+		if !checksum.Verify(sum, data) {
+			log.Printf("MISMATCH: %s (content checksum %s)", path, sync_imap.ContentChecksum(data))
+			bad = append(bad, path)
+		}
+		if checked%1000 == 0 {
+			log.Printf("Progress: %d checked, %d bad", checked, len(bad))
 		}
 		return nil
 	})
+	if err != nil {
+		log.Fatalf("Walk error: %v", err)
+	}
+
+	moved := 0
+	if *quarantine {
+		for _, path := range bad {
+			rel, err := filepath.Rel(dataDir, path)
+			if err != nil {
+				log.Printf("WARN: %s: %v", path, err)
+				continue
+			}
+			dst := filepath.Join(dataDir, quarantineDir, rel)
+			if err := os.MkdirAll(filepath.Dir(dst), 0o755); err != nil {
+				log.Printf("WARN: %s: %v", dst, err)
+				continue
+			}
+			if err := os.Rename(path, dst); err != nil {
+				log.Printf("WARN: quarantine %s: %v", path, err)
+				continue
+			}
+			moved++
+		}
+	}
 
+	log.Printf("Done: %d checked, %d without checksum, %d bad, %d quarantined", checked, unchecked, len(bad), moved)
+	if len(bad) > 0 && !*quarantine {
+		os.Exit(1)
+	}
+}
+
+// loadSealKey sets the key emails are encrypted with from
+// EMAIL_ENCRYPTION_KEY, for every command that reads or writes them.
+func loadSealKey() {
+	v := os.Getenv("EMAIL_ENCRYPTION_KEY")
+	if v == "" {
+		return
+	}
+	key, err := eml.ParseSealKey(v)
+	if err == nil {
+		err = eml.SetSealKey(key)
+	}
+	if err != nil {
+		log.Fatalf("EMAIL_ENCRYPTION_KEY: %v", err)
+	}
+}
+
+func runEncrypt(args []string) {
+	fs := flag.NewFlagSet("encrypt", flag.ExitOnError)
+	onlyUser := fs.String("user", "", "encrypt only this user ID")
+	fs.Parse(args)
+
+	if !eml.Seals() {
+		log.Fatal("EMAIL_ENCRYPTION_KEY is not set")
+	}
+	dataDir := envOr("DATA_DIR", "./users")
+	entries, err := os.ReadDir(dataDir)
+	if err != nil {
+		log.Fatalf("Read %s: %v", dataDir, err)
+	}
+	total, failed := 0, 0
+	for _, ent := range entries {
+		if !ent.IsDir() || ent.Name() == quarantineDir || (*onlyUser != "" && ent.Name() != *onlyUser) {
+			continue
+		}
+		// Keys are per user, so each user's directory is sealed with its own.
+		n, err := eml.SealDir(ent.Name(), filepath.Join(dataDir, ent.Name()))
+		if err != nil {
+			log.Printf("WARN: %s: %v", ent.Name(), err)
+			failed++
+		}
+		log.Printf("%s: %d files encrypted", ent.Name(), n)
+		total += n
+	}
+	log.Printf("Done: %d files encrypted, %d users with errors", total, failed)
+	if failed > 0 {
+		os.Exit(1)
+	}
+}
+
+func runMigrateFilenames(args []string) {
+	fs := flag.NewFlagSet("migrate-filenames", flag.ExitOnError)
+	apply := fs.Bool("apply", false, "rename the files; without it the renames are only listed")
+	onlyUser := fs.String("user", "", "migrate only this user ID")
+	fs.Parse(args)
+
+	root := envOr("DATA_DIR", "./users")
+	if *onlyUser != "" {
+		root = filepath.Join(root, *onlyUser)
+	}
+	verb := "would rename"
+	if *apply {
+		verb = "renamed"
+	}
+	res, err := eml.MigrateFilenames(root, !*apply, func(oldPath, newPath string) {
+		log.Printf("%s %s -> %s", verb, oldPath, filepath.Base(newPath))
+	})
 	if err != nil {
 		log.Fatalf("Walk error: %v", err)
 	}
-	log.Printf("Done: %d fixed, %d skipped, %d errors", fixed, skipped, errors)
+	log.Printf("Done: %d %s, %d already named by checksum, %d errors", res.Renamed, verb, res.Conformed, res.Errors)
+	switch {
+	case !*apply && res.Renamed > 0:
+		log.Printf("Dry run; rerun with --apply to rename")
+	case *apply && res.Renamed > 0:
+		log.Printf("Reindex (POST /api/reindex) so search and duplicates see the new names")
+	}
+	if res.Errors > 0 {
+		os.Exit(1)
+	}
+}
+
+func runAdmin(args []string) {
+	fs := flag.NewFlagSet("admin", flag.ExitOnError)
+	revoke := fs.Bool("revoke", false, "take the admin role away")
+	fs.Parse(args)
+	if fs.NArg() != 1 {
+		log.Fatal("Usage: mails admin [--revoke] <email or user ID>")
+	}
+
+	dataDir := envOr("DATA_DIR", "./users")
+	blobStore, err := storage.NewBlobStore(dataDir)
+	if err != nil {
+		log.Fatalf("Failed to init blob store: %v", err)
+	}
+	users, err := user.NewStore(dataDir, blobStore)
+	if err != nil {
+		log.Fatalf("Failed to init user store: %v", err)
+	}
+	u := users.FindByEmail(fs.Arg(0))
+	if u == nil {
+		u = users.Get(fs.Arg(0))
+	}
+	if u == nil {
+		log.Fatalf("No user with email or ID %q", fs.Arg(0))
+	}
+	if _, err := users.SetAdmin(u.ID, !*revoke); err != nil {
+		log.Fatalf("Update %s: %v", u.Email, err)
+	}
+	if *revoke {
+		log.Printf("%s (%s) is no longer an admin", u.Email, u.ID)
+	} else {
+		log.Printf("%s (%s) is an admin", u.Email, u.ID)
+	}
 }
 
-// extractEmailDate parses the Date header from an .eml file,
-// falling back to the first Received header.
-func extractEmailDate(path string) time.Time {
-	f, err := os.Open(path)
+func runCompact(args []string) {
+	fs := flag.NewFlagSet("compact", flag.ExitOnError)
+	onlyUser := fs.String("user", "", "compact only this user ID")
+	fs.Parse(args)
+
+	dataDir := envOr("DATA_DIR", "./users")
+	blobStore, err := storage.NewBlobStore(dataDir)
 	if err != nil {
-		return time.Time{}
+		log.Fatalf("Failed to init blob store: %v", err)
 	}
-	defer f.Close()
+	accountStore := account.NewStore(dataDir, blobStore)
 
-	msg, err := mail.ReadMessage(bufio.NewReader(f))
+	entries, err := os.ReadDir(dataDir)
 	if err != nil {
-		return time.Time{}
-	}
-
-	date, _ := msg.Header.Date()
-	if !date.IsZero() {
-		return date
-	}
-
-	// Fallback: try fuzzy date parsing for non-standard Date headers.
-	if raw := msg.Header.Get("Date"); raw != "" {
-		for _, layout := range []string{
-			time.RFC1123Z,
-			time.RFC1123,
-			"Mon, 2 Jan 2006 15:04:05 -0700 (MST)",
-			"Mon, 2 Jan 2006 15:04:05 -0700",
-			"Mon, 2 Jan 2006 15:04:05",
-			"2 Jan 2006 15:04:05 -0700",
-			"2 Jan 2006 15:04:05",
-			time.RFC822Z,
-			time.RFC822,
-		} {
-			if t, err := time.Parse(layout, strings.TrimSpace(raw)); err == nil {
-				return t
+		log.Fatalf("Read %s: %v", dataDir, err)
+	}
+	failed := 0
+	for _, ent := range entries {
+		if !ent.IsDir() || (*onlyUser != "" && ent.Name() != *onlyUser) {
+			continue
+		}
+		userID := ent.Name()
+		accts, err := accountStore.List(userID)
+		if err != nil {
+			log.Printf("WARN: %s: %v", userID, err)
+			continue
+		}
+		for _, acct := range accts {
+			emailDir := account.EmailDir(dataDir, userID, acct)
+			indexPath := account.IndexPath(dataDir, userID, acct)
+			idx, err := index.New(emailDir, indexPath, blobStore, dataDir)
+			if err != nil {
+				log.Printf("WARN: %s: %v", acct.Email, err)
+				failed++
+				continue
 			}
+			idx.SetExcludeFolders(acct.ExcludeFolders)
+			res, err := idx.Compact()
+			idx.Close()
+			if err != nil {
+				log.Printf("WARN: %s: %v", acct.Email, err)
+				failed++
+				continue
+			}
+			log.Printf("%s: %d -> %d rows, %d -> %d bytes, %d parse errors",
+				acct.Email, res.RowsBefore, res.RowsAfter, res.BytesBefore, res.BytesAfter, res.ParseErrors)
 		}
 	}
+	if failed > 0 {
+		os.Exit(1)
+	}
+}
+
+// userDuplicates is one user's duplicate report in "mails duplicates --json".
+type userDuplicates struct {
+	UserID string `json:"user_id"`
+	index.DuplicateReport
+}
+
+func runDuplicates(args []string) {
+	fs := flag.NewFlagSet("duplicates", flag.ExitOnError)
+	onlyUser := fs.String("user", "", "report only this user ID")
+	asJSON := fs.Bool("json", false, "print the report as JSON")
+	fs.Parse(args)
+
+	dataDir := envOr("DATA_DIR", "./users")
+	blobStore, err := storage.NewBlobStore(dataDir)
+	if err != nil {
+		log.Fatalf("Failed to init blob store: %v", err)
+	}
+	accountStore := account.NewStore(dataDir, blobStore)
 
-	// Fallback: parse first Received header.
-	received := msg.Header.Get("Received")
-	if received == "" {
-		return time.Time{}
+	entries, err := os.ReadDir(dataDir)
+	if err != nil {
+		log.Fatalf("Read %s: %v", dataDir, err)
+	}
+	reports := []userDuplicates{}
+	for _, ent := range entries {
+		if !ent.IsDir() || (*onlyUser != "" && ent.Name() != *onlyUser) {
+			continue
+		}
+		userID := ent.Name()
+		accts, err := accountStore.List(userID)
+		if err != nil {
+			log.Printf("WARN: %s: %v", userID, err)
+			continue
+		}
+		names := make(map[string]string, len(accts))
+		var accounts []index.AccountIndex
+		for _, acct := range accts {
+			names[acct.ID] = acct.Email
+			accounts = append(accounts, index.AccountIndex{ID: acct.ID, IndexPath: account.IndexPath(dataDir, userID, acct)})
+		}
+		if len(accounts) == 0 {
+			continue
+		}
+		report, err := index.Duplicates(context.Background(), accounts)
+		if err != nil {
+			log.Fatalf("%s: %v", userID, err)
+		}
+		for _, w := range report.Warnings {
+			log.Printf("WARN: %s: %s", userID, w)
+		}
+		if *asJSON {
+			reports = append(reports, userDuplicates{UserID: userID, DuplicateReport: report})
+			continue
+		}
+		fmt.Printf("User %s: %d copies indexed, %d messages stored more than once, %d redundant copies (%d bytes)\n",
+			userID, report.Emails, len(report.Clusters), report.Redundant, report.RedundantBytes)
+		for _, c := range report.Clusters {
+			fmt.Printf("\n%d copies  %s %s  %s\n", len(c.Copies), c.By, c.Key, c.Subject)
+			for _, cp := range c.Copies {
+				fmt.Printf("    %s  %s\n", names[cp.AccountID], cp.Path)
+			}
+		}
 	}
-	idx := strings.LastIndex(received, ";")
-	if idx < 0 {
-		return time.Time{}
+	if *asJSON {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(reports); err != nil {
+			log.Fatal(err)
+		}
+	}
+}
+
+// searchSource is one EMAILS_DIRS entry and its index file.
+type searchSource struct {
+	dir       string
+	indexPath string
+	// exclude is passed to Index.SetExcludeFolders: "*" for the files of a
+	// MULTI directory itself, whose subdirectories are sources of their own.
+	exclude string
+}
+
+// searchSources reads EMAILS_DIRS (falling back to EMAILS_DIR) and assigns
+// each directory an index file in INDEX_DIR named after its path. With
+// MULTI=1 each directory is a tree of account directories, and every
+// subdirectory of it becomes a source of its own.
+func searchSources() []searchSource {
+	dirs := filepath.SplitList(os.Getenv("EMAILS_DIRS"))
+	if len(dirs) == 0 {
+		if d := os.Getenv("EMAILS_DIR"); d != "" {
+			dirs = []string{d}
+		}
+	}
+	indexDir := envOr("INDEX_DIR", "./.mails-index")
+	var found []searchSource
+	if multi, _ := strconv.ParseBool(os.Getenv("MULTI")); multi {
+		found = accountSubdirs(dirs, indexDir)
+	} else {
+		for _, d := range dirs {
+			found = append(found, searchSource{dir: d})
+		}
+	}
+	var sources []searchSource
+	for _, src := range found {
+		if src.dir == "" {
+			continue
+		}
+		abs, err := filepath.Abs(src.dir)
+		if err != nil {
+			abs = src.dir
+		}
+		// A directory's own files get an index apart from the whole tree's.
+		sum := sha256.Sum256([]byte(abs + src.exclude))
+		name := hex.EncodeToString(sum[:4]) + "-" + filepath.Base(abs) + ".parquet"
+		sources = append(sources, searchSource{dir: abs, indexPath: filepath.Join(indexDir, name), exclude: src.exclude})
+	}
+	return sources
+}
+
+// accountSubdirs replaces each of dirs by its subdirectories, skipping
+// hidden ones and indexDir. A directory holding email files of its own
+// stays a source too, for those files only; one without subdirectories is
+// kept whole.
+func accountSubdirs(dirs []string, indexDir string) []searchSource {
+	absIndex, _ := filepath.Abs(indexDir)
+	var out []searchSource
+	for _, d := range dirs {
+		if d == "" {
+			continue
+		}
+		entries, err := os.ReadDir(d)
+		if err != nil {
+			log.Printf("WARN: %s: %v", d, err)
+			continue
+		}
+		var subdirs []searchSource
+		hasEmails := false
+		for _, e := range entries {
+			if !e.IsDir() {
+				hasEmails = hasEmails || eml.IsEmailFile(e.Name())
+				continue
+			}
+			if strings.HasPrefix(e.Name(), ".") {
+				continue
+			}
+			sub := filepath.Join(d, e.Name())
+			if abs, _ := filepath.Abs(sub); abs == absIndex {
+				continue
+			}
+			subdirs = append(subdirs, searchSource{dir: sub})
+		}
+		switch {
+		case len(subdirs) == 0:
+			out = append(out, searchSource{dir: d})
+		case hasEmails:
+			out = append(out, searchSource{dir: d, exclude: "*"})
+		}
+		out = append(out, subdirs...)
+	}
+	return out
+}
+
+func runSearch(args []string) {
+	fs := flag.NewFlagSet("search", flag.ExitOnError)
+	stats := fs.Bool("stats", false, "print per-directory and merged email counts")
+	rebuild := fs.Bool("rebuild", false, "rebuild every index before searching")
+	limit := fs.Int("limit", 20, "maximum hits to print (0 = all)")
+	fs.Parse(args)
+
+	sources := searchSources()
+	if len(sources) == 0 {
+		log.Fatal("Set EMAILS_DIRS (colon-separated) or EMAILS_DIR")
+	}
+
+	// Build missing and unusable indexes; existing ones load from parquet.
+	var accounts []index.AccountIndex
+	for _, src := range sources {
+		_, statErr := os.Stat(src.indexPath)
+		idx, err := index.New(src.dir, src.indexPath, nil, "")
+		if err != nil {
+			log.Printf("WARN: %s: %v", src.dir, err)
+			continue
+		}
+		idx.SetExcludeFolders(src.exclude)
+		if *rebuild || statErr != nil || idx.NeedsRebuild() {
+			n, parseErrs := idx.Build()
+			log.Printf("Indexed %s: %d emails, %d parse errors", src.dir, n, parseErrs)
+		}
+		if *stats {
+			fmt.Printf("%8d  %s\n", idx.Stats().TotalEmails, src.dir)
+		}
+		idx.Close()
+		accounts = append(accounts, index.AccountIndex{ID: src.dir, IndexPath: src.indexPath})
+	}
+
+	query := strings.Join(fs.Args(), " ")
+	if *stats {
+		merged := index.SearchMulti(accounts, "", 0, 1)
+		fmt.Printf("%8d  merged (duplicates across directories counted once)\n", merged.Total)
+		if query == "" {
+			return
+		}
+	}
+
+	start := time.Now()
+	res := index.SearchMulti(accounts, query, 0, *limit)
+	res.TookMS = time.Since(start).Milliseconds()
+	for _, w := range res.Warnings {
+		log.Printf("WARN: %s", w)
 	}
-	dateStr := strings.TrimSpace(received[idx+1:])
-	for _, layout := range []string{
-		time.RFC1123Z,
-		time.RFC1123,
-		"Mon, 2 Jan 2006 15:04:05 -0700 (MST)",
-		"Mon, 2 Jan 2006 15:04:05 -0700",
-		"2 Jan 2006 15:04:05 -0700",
-		time.RFC822Z,
-		time.RFC822,
-	} {
-		if t, err := time.Parse(layout, dateStr); err == nil {
-			return t
+	for _, h := range res.Hits {
+		fmt.Printf("%s  %-40.40s  %s\n", h.Date.Format("2006-01-02"), h.Subject, filepath.Join(h.AccountID, h.Path))
+		if h.Snippet != "" {
+			fmt.Printf("            %s\n", h.Snippet)
 		}
 	}
-	return time.Time{}
+	fmt.Printf("%d of %d matches in %d ms\n", len(res.Hits), res.Total, res.TookMS)
 }
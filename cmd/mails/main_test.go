@@ -0,0 +1,50 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestAccountSubdirs(t *testing.T) {
+	root := t.TempDir()
+	for _, rel := range []string{
+		"loose.eml",
+		"work/inbox/1.eml",
+		"home/2.eml",
+		".git/config",
+		".mails-index/x.parquet",
+		"notes.txt",
+	} {
+		p := filepath.Join(root, filepath.FromSlash(rel))
+		if err := os.MkdirAll(filepath.Dir(p), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(p, []byte("x"), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// A tree with no email files of its own, and a directory without
+	// subdirectories.
+	tree, flat := filepath.Join(root, "work"), filepath.Join(root, "home")
+
+	got := accountSubdirs([]string{root, tree, flat, "", filepath.Join(root, "missing")}, filepath.Join(root, ".mails-index"))
+	want := []searchSource{
+		// The hidden and index directories are skipped; the loose email
+		// keeps its directory as a source of its own files.
+		{dir: root, exclude: "*"},
+		{dir: flat},
+		{dir: tree},
+		{dir: filepath.Join(tree, "inbox")},
+		{dir: flat},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("accountSubdirs = %+v, want %+v", got, want)
+	}
+
+	// A visible index directory is skipped too.
+	if got := accountSubdirs([]string{root}, filepath.Join(root, "home")); len(got) != 2 || got[1].dir != tree {
+		t.Errorf("with INDEX_DIR=home: %+v, want the root's files and work", got)
+	}
+}
@@ -0,0 +1,27 @@
+package account
+
+import "github.com/eslider/mails/internal/model"
+
+// Clone returns a draft of a new account with src's connection and sync
+// settings, for adding another address at the same provider. It has no
+// ID, and the per-mailbox fields are cleared for the user to fill in: the
+// email, password, TLS client certificate and key, and any external mail
+// directory.
+func Clone(src model.EmailAccount) model.EmailAccount {
+	c := src
+	c.ID = ""
+	c.Email = ""
+	c.Password = ""
+	c.EmailDirOverride = ""
+	c.Sync.PausedReason = ""
+	if src.TLS != nil {
+		t := *src.TLS
+		t.ClientCert = ""
+		t.ClientKey = ""
+		c.TLS = nil
+		if t != (model.TLSOptions{}) {
+			c.TLS = &t
+		}
+	}
+	return c
+}
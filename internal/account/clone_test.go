@@ -0,0 +1,42 @@
+package account_test
+
+import (
+	"testing"
+
+	"github.com/eslider/mails/internal/account"
+	"github.com/eslider/mails/internal/model"
+)
+
+func TestClone(t *testing.T) {
+	src := model.EmailAccount{
+		ID: "a1", Type: model.AccountTypeIMAP, Email: "a@example.com",
+		Host: "imap.example.com", Port: 993, SSL: true, Password: "pw",
+		Folders: "INBOX,Sent", ExcludeFolders: "Spam", IOTimeout: "2m",
+		TLS:  &model.TLSOptions{CACert: "ca", ClientCert: "cert", ClientKey: "key"},
+		Sync: model.SyncConfig{Interval: "1h", Enabled: false, PausedReason: "login failed"},
+	}
+	c := account.Clone(src)
+
+	if c.ID != "" || c.Email != "" || c.Password != "" {
+		t.Errorf("clone kept identity or credentials: %+v", c)
+	}
+	if c.TLS == nil || c.TLS.CACert != "ca" || c.TLS.ClientCert != "" || c.TLS.ClientKey != "" {
+		t.Errorf("clone TLS = %+v, want the CA only", c.TLS)
+	}
+	if c.Sync.PausedReason != "" {
+		t.Errorf("clone kept paused reason %q", c.Sync.PausedReason)
+	}
+	if c.Type != src.Type || c.Host != src.Host || c.Port != src.Port || !c.SSL ||
+		c.Folders != src.Folders || c.ExcludeFolders != src.ExcludeFolders || c.IOTimeout != src.IOTimeout || c.Sync.Interval != "1h" {
+		t.Errorf("clone lost settings: %+v", c)
+	}
+	if src.Password != "pw" || src.TLS.ClientKey != "key" {
+		t.Error("Clone modified its source")
+	}
+
+	// A client certificate was the only TLS setting.
+	src.TLS = &model.TLSOptions{ClientCert: "cert", ClientKey: "key"}
+	if c := account.Clone(src); c.TLS != nil {
+		t.Errorf("clone TLS = %+v, want nil", c.TLS)
+	}
+}
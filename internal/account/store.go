@@ -17,6 +17,10 @@ import (
 
 const accountsFileName = "accounts.yml"
 
+// ErrReadOnly is returned for writes to an account whose mail is read
+// from an external directory (see model.EmailAccount.EmailDirOverride).
+var ErrReadOnly = errors.New("account is read-only")
+
 // Store manages email account configurations per user.
 type Store struct {
 	mu        sync.RWMutex
@@ -63,10 +67,17 @@ func (s *Store) Create(userID string, acct model.EmailAccount) (*model.EmailAcco
 	if acct.Sync.Interval == "" {
 		acct.Sync.Interval = "5m"
 	}
-	// Only default to enabled for syncable account types; PST is import-only.
-	if string(acct.Type) != "PST" {
+	// Only default to enabled for syncable account types; PST and MAILDIR
+	// are import-only, and accounts reading an external directory never
+	// write to it.
+	if acct.Type != model.AccountTypePST && acct.Type != model.AccountTypeMaildir && !acct.ReadOnly() {
 		acct.Sync.Enabled = true
 	}
+	// Junk stays out of new syncing accounts unless they say otherwise;
+	// clearing the list later syncs everything.
+	if acct.ExcludeFolders == "" && acct.Type.Syncable() {
+		acct.ExcludeFolders = model.DefaultExcludeFolders
+	}
 
 	accounts = append(accounts, acct)
 	if err := s.save(userID, accounts); err != nil {
@@ -74,7 +85,7 @@ func (s *Store) Create(userID string, acct model.EmailAccount) (*model.EmailAcco
 	}
 
 	// Create the email storage directory (for local fs; S3 has no dirs).
-	if s.blobStore == nil {
+	if s.blobStore == nil && !acct.ReadOnly() {
 		emailDir := EmailDir(s.usersDir, userID, acct)
 		os.MkdirAll(emailDir, 0o755)
 	}
@@ -107,6 +118,59 @@ func (s *Store) Update(userID string, acct model.EmailAccount) error {
 	return s.save(userID, accounts)
 }
 
+// SetSyncEnabled pauses (enabled=false) or resumes scheduled sync for an account.
+// Sync state and downloaded emails are left untouched.
+func (s *Store) SetSyncEnabled(userID, accountID string, enabled bool) (*model.EmailAccount, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	accounts, err := s.load(userID)
+	if err != nil {
+		return nil, err
+	}
+
+	for i, a := range accounts {
+		if a.ID != accountID {
+			continue
+		}
+		if !a.Type.Syncable() {
+			return nil, fmt.Errorf("%s accounts are import-only and never sync", a.Type)
+		}
+		if a.ReadOnly() {
+			return nil, fmt.Errorf("%w: its mail is read from %s and never syncs", ErrReadOnly, a.EmailDirOverride)
+		}
+		accounts[i].Sync.Enabled = enabled
+		accounts[i].Sync.PausedReason = ""
+		if err := s.save(userID, accounts); err != nil {
+			return nil, err
+		}
+		return &accounts[i], nil
+	}
+	return nil, fmt.Errorf("account %s not found", accountID)
+}
+
+// AutoPause disables scheduled sync for an account and records why, so the
+// user can see the account was paused by the system rather than by hand.
+func (s *Store) AutoPause(userID, accountID, reason string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	accounts, err := s.load(userID)
+	if err != nil {
+		return err
+	}
+
+	for i, a := range accounts {
+		if a.ID != accountID {
+			continue
+		}
+		accounts[i].Sync.Enabled = false
+		accounts[i].Sync.PausedReason = reason
+		return s.save(userID, accounts)
+	}
+	return fmt.Errorf("account %s not found", accountID)
+}
+
 // Delete removes an email account (does NOT delete downloaded emails).
 func (s *Store) Delete(userID, accountID string) error {
 	s.mu.Lock()
@@ -130,10 +194,20 @@ func (s *Store) Delete(userID, accountID string) error {
 	return s.save(userID, filtered)
 }
 
-// EmailDir returns the storage directory for an account's emails.
+// EmailDir returns the storage directory for an account's emails: its
+// EmailDirOverride when set, otherwise DataDir.
+func EmailDir(usersDir, userID string, acct model.EmailAccount) string {
+	if acct.EmailDirOverride != "" {
+		return acct.EmailDirOverride
+	}
+	return DataDir(usersDir, userID, acct)
+}
+
+// DataDir returns the directory the app owns for an account, which holds
+// its emails unless EmailDirOverride is set, and its index either way.
 // Format: users/{userID}/{service-domain}/{local-part}/
 // Example: users/019c.../gmail.com/eslider/
-func EmailDir(usersDir, userID string, acct model.EmailAccount) string {
+func DataDir(usersDir, userID string, acct model.EmailAccount) string {
 	domain, local := splitEmail(acct.Email)
 	return filepath.Join(usersDir, userID, domain, local)
 }
@@ -141,7 +215,7 @@ func EmailDir(usersDir, userID string, acct model.EmailAccount) string {
 // IndexPath returns the parquet index path for an account.
 // Format: users/{userID}/{service-domain}/{local-part}/index.parquet
 func IndexPath(usersDir, userID string, acct model.EmailAccount) string {
-	return filepath.Join(EmailDir(usersDir, userID, acct), "index.parquet")
+	return filepath.Join(DataDir(usersDir, userID, acct), "index.parquet")
 }
 
 func (s *Store) accountsPath(userID string) string {
@@ -0,0 +1,201 @@
+package account
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/eslider/mails/internal/model"
+	"github.com/eslider/mails/internal/sync/mailtls"
+)
+
+// Normalize trims user-entered fields and lower-cases the host so that
+// equivalent configurations compare equal.
+func Normalize(a model.EmailAccount) model.EmailAccount {
+	a.Email = strings.TrimSpace(a.Email)
+	a.Host = strings.ToLower(strings.TrimSpace(a.Host))
+	a.Sync.Interval = strings.TrimSpace(a.Sync.Interval)
+	a.ConnectTimeout = strings.TrimSpace(a.ConnectTimeout)
+	a.IOTimeout = strings.TrimSpace(a.IOTimeout)
+
+	folders := strings.TrimSpace(a.Folders)
+	if folders != "" && !strings.EqualFold(folders, "all") {
+		parts := strings.Split(folders, ",")
+		for i, p := range parts {
+			parts[i] = strings.TrimSpace(p)
+		}
+		folders = strings.Join(parts, ",")
+	}
+	a.Folders = folders
+
+	var exclude []string
+	for _, p := range strings.Split(a.ExcludeFolders, ",") {
+		if p = strings.TrimSpace(p); p != "" {
+			exclude = append(exclude, p)
+		}
+	}
+	a.ExcludeFolders = strings.Join(exclude, ",")
+	a.EmailDirOverride = strings.TrimSpace(a.EmailDirOverride)
+
+	if a.TLS != nil {
+		t := *a.TLS
+		t.CACert = strings.TrimSpace(t.CACert)
+		t.ClientCert = strings.TrimSpace(t.ClientCert)
+		t.ClientKey = strings.TrimSpace(t.ClientKey)
+		if t == (model.TLSOptions{}) {
+			a.TLS = nil
+		} else {
+			a.TLS = &t
+		}
+	}
+	return a
+}
+
+// Validate checks that an account has everything its type needs to sync.
+// It expects a normalized account (see Normalize).
+func Validate(a model.EmailAccount) error {
+	if a.Email == "" {
+		return fmt.Errorf("email is required")
+	}
+	if !strings.Contains(a.Email, "@") {
+		return fmt.Errorf("invalid email %q", a.Email)
+	}
+	if a.Port < 0 || a.Port > 65535 {
+		return fmt.Errorf("port %d out of range 1-65535", a.Port)
+	}
+
+	switch a.Type {
+	case model.AccountTypeIMAP, model.AccountTypePOP3:
+		if a.Host == "" {
+			return fmt.Errorf("host is required for %s accounts", a.Type)
+		}
+		if a.Port == 0 {
+			return fmt.Errorf("port is required for %s accounts", a.Type)
+		}
+		if a.Password == "" {
+			return fmt.Errorf("password is required for %s accounts", a.Type)
+		}
+	case model.AccountTypeGmailAPI:
+		// Authenticated via OAuth; no host or password.
+	case model.AccountTypePST, model.AccountTypeMaildir:
+		if a.Sync.Enabled {
+			return fmt.Errorf("%s accounts are import-only and cannot enable sync", a.Type)
+		}
+	default:
+		return fmt.Errorf("unknown account type %q (want IMAP, POP3, GMAIL_API, PST or MAILDIR)", a.Type)
+	}
+
+	if a.ReadOnly() && a.Sync.Enabled {
+		return fmt.Errorf("accounts with an email dir override are read-only and cannot enable sync")
+	}
+
+	if err := validateFolders(a.Folders); err != nil {
+		return err
+	}
+	if strings.ContainsAny(a.ExcludeFolders, "\r\n\x00") {
+		return fmt.Errorf("invalid exclude folders %q: control characters", a.ExcludeFolders)
+	}
+	if err := mailtls.ValidateOptions(a.TLS); err != nil {
+		return err
+	}
+	for _, d := range []struct{ name, value string }{
+		{"sync interval", a.Sync.Interval},
+		{"connect timeout", a.ConnectTimeout},
+		{"io timeout", a.IOTimeout},
+	} {
+		if err := validateDuration(d.name, d.value); err != nil {
+			return err
+		}
+	}
+	if a.SyncSince.After(time.Now()) {
+		return fmt.Errorf("sync since %s is in the future", a.SyncSince.Format(time.DateOnly))
+	}
+	return nil
+}
+
+// ResolveEmailDirOverride checks an account's EmailDirOverride: it must be
+// an absolute path to an existing directory inside <root>/<userID> for one
+// of roots, symbolic links resolved, so that users only reach the trees put
+// there for them. Directories inside usersDir (DATA_DIR), or containing it,
+// are refused whatever the roots, as they hold every user's archive. It
+// returns the resolved path. With no roots, overrides are refused.
+func ResolveEmailDirOverride(dir string, roots []string, userID, usersDir string) (string, error) {
+	if len(roots) == 0 {
+		return "", fmt.Errorf("email dir overrides are disabled; set EXTERNAL_MAIL_ROOTS to allow them")
+	}
+	if userID == "" || userID != filepath.Base(userID) || userID == ".." {
+		return "", fmt.Errorf("invalid user ID %q", userID)
+	}
+	if !filepath.IsAbs(dir) {
+		return "", fmt.Errorf("email dir override %q must be an absolute path", dir)
+	}
+	resolved, err := filepath.EvalSymlinks(dir)
+	if err != nil {
+		return "", fmt.Errorf("email dir override: %w", err)
+	}
+	info, err := os.Stat(resolved)
+	if err != nil {
+		return "", fmt.Errorf("email dir override: %w", err)
+	}
+	if !info.IsDir() {
+		return "", fmt.Errorf("email dir override %q is not a directory", dir)
+	}
+	if usersDir != "" {
+		users, err := filepath.EvalSymlinks(usersDir)
+		if err != nil {
+			users, _ = filepath.Abs(usersDir)
+		}
+		if within(users, resolved) || within(resolved, users) {
+			return "", fmt.Errorf("email dir override %q overlaps DATA_DIR", dir)
+		}
+	}
+	for _, root := range roots {
+		root, err := filepath.EvalSymlinks(filepath.Join(root, userID))
+		if err != nil {
+			continue
+		}
+		if within(root, resolved) {
+			return resolved, nil
+		}
+	}
+	return "", fmt.Errorf("email dir override %q is outside EXTERNAL_MAIL_ROOTS/%s", dir, userID)
+}
+
+// within reports whether path is dir or inside it; both must be clean.
+func within(dir, path string) bool {
+	rel, err := filepath.Rel(dir, path)
+	return err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator))
+}
+
+// validateDuration accepts "" or a positive Go duration such as "90s".
+func validateDuration(name, value string) error {
+	if value == "" {
+		return nil
+	}
+	d, err := time.ParseDuration(value)
+	if err != nil {
+		return fmt.Errorf("invalid %s %q: %w", name, value, err)
+	}
+	if d <= 0 {
+		return fmt.Errorf("%s must be positive, got %q", name, value)
+	}
+	return nil
+}
+
+// validateFolders accepts "", "all" or a comma-separated list of folder names.
+func validateFolders(folders string) error {
+	if folders == "" || strings.EqualFold(folders, "all") {
+		return nil
+	}
+	for _, f := range strings.Split(folders, ",") {
+		if f == "" {
+			return fmt.Errorf("invalid folders %q: empty folder name", folders)
+		}
+		if strings.ContainsAny(f, "\r\n\x00") {
+			return fmt.Errorf("invalid folders %q: control characters in %q", folders, f)
+		}
+	}
+	return nil
+}
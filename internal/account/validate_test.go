@@ -0,0 +1,118 @@
+package account_test
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/eslider/mails/internal/account"
+	"github.com/eslider/mails/internal/model"
+)
+
+func TestValidate(t *testing.T) {
+	imap := model.EmailAccount{Type: model.AccountTypeIMAP, Email: "a@example.com", Host: "imap.example.com", Port: 993, Password: "pw"}
+
+	tests := []struct {
+		name    string
+		edit    func(a *model.EmailAccount)
+		wantErr string
+	}{
+		{"valid imap", func(a *model.EmailAccount) {}, ""},
+		{"missing host", func(a *model.EmailAccount) { a.Host = "" }, "host is required"},
+		{"missing port", func(a *model.EmailAccount) { a.Port = 0 }, "port is required"},
+		{"negative port", func(a *model.EmailAccount) { a.Port = -1 }, "out of range"},
+		{"port too large", func(a *model.EmailAccount) { a.Port = 70000 }, "out of range"},
+		{"missing password", func(a *model.EmailAccount) { a.Password = "" }, "password is required"},
+		{"bad email", func(a *model.EmailAccount) { a.Email = "nobody" }, "invalid email"},
+		{"bogus type", func(a *model.EmailAccount) { a.Type = "FAX" }, "unknown account type"},
+		{"folder list", func(a *model.EmailAccount) { a.Folders = "INBOX,Sent" }, ""},
+		{"empty folder", func(a *model.EmailAccount) { a.Folders = "INBOX,,Sent" }, "empty folder name"},
+		{"bad interval", func(a *model.EmailAccount) { a.Sync.Interval = "often" }, "invalid sync interval"},
+		{"timeouts", func(a *model.EmailAccount) { a.ConnectTimeout, a.IOTimeout = " 10s ", "5m" }, ""},
+		{"bad connect timeout", func(a *model.EmailAccount) { a.ConnectTimeout = "soon" }, "invalid connect timeout"},
+		{"zero io timeout", func(a *model.EmailAccount) { a.IOTimeout = "0s" }, "io timeout must be positive"},
+		{"sync since", func(a *model.EmailAccount) { a.SyncSince = time.Now().AddDate(-2, 0, 0) }, ""},
+		{"sync since future", func(a *model.EmailAccount) { a.SyncSince = time.Now().AddDate(0, 0, 2) }, "in the future"},
+		{"gmail needs no host", func(a *model.EmailAccount) {
+			*a = model.EmailAccount{Type: model.AccountTypeGmailAPI, Email: "a@gmail.com"}
+		}, ""},
+		{"pst cannot sync", func(a *model.EmailAccount) {
+			*a = model.EmailAccount{Type: model.AccountTypePST, Email: "backup@pst", Sync: model.SyncConfig{Enabled: true}}
+		}, "import-only"},
+		{"override cannot sync", func(a *model.EmailAccount) {
+			a.EmailDirOverride = "/srv/mail"
+			a.Sync.Enabled = true
+		}, "read-only"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a := imap
+			tt.edit(&a)
+			err := account.Validate(account.Normalize(a))
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Errorf("unexpected error: %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("error = %v, want containing %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestNormalize(t *testing.T) {
+	a := account.Normalize(model.EmailAccount{
+		Email:   "  a@example.com ",
+		Host:    " IMAP.Example.COM ",
+		Folders: " INBOX , Sent ",
+	})
+	if a.Email != "a@example.com" || a.Host != "imap.example.com" || a.Folders != "INBOX,Sent" {
+		t.Errorf("got %+v", a)
+	}
+}
+
+func TestResolveEmailDirOverride(t *testing.T) {
+	root := t.TempDir()
+	archive := filepath.Join(root, "user-1", "archive")
+	os.MkdirAll(archive, 0o755)
+	os.MkdirAll(filepath.Join(root, "user-2", "archive"), 0o755)
+	os.WriteFile(filepath.Join(root, "user-1", "file.txt"), nil, 0o644)
+	outside := t.TempDir()
+	os.Symlink(outside, filepath.Join(root, "user-1", "escape"))
+	users := t.TempDir()
+	os.MkdirAll(filepath.Join(users, "user-2", "mail"), 0o755)
+
+	if got, err := account.ResolveEmailDirOverride(archive, []string{outside, root}, "user-1", users); err != nil || got != archive {
+		t.Errorf("archive = %q, %v; want %q", got, err, archive)
+	}
+	for dir, want := range map[string]string{
+		"archive":                                 "absolute path",
+		filepath.Join(root, "user-1", "missing"):  "no such file",
+		filepath.Join(root, "user-1", "file.txt"): "not a directory",
+		filepath.Join(root, "user-1", "escape"):   "outside EXTERNAL_MAIL_ROOTS",
+		filepath.Join(archive, "..", ".."):        "outside EXTERNAL_MAIL_ROOTS",
+		filepath.Join(root, "user-2", "archive"):  "outside EXTERNAL_MAIL_ROOTS",
+	} {
+		_, err := account.ResolveEmailDirOverride(dir, []string{root}, "user-1", users)
+		if err == nil || !strings.Contains(err.Error(), want) {
+			t.Errorf("%s: error = %v, want containing %q", dir, err, want)
+		}
+	}
+	// A root that holds DATA_DIR must not open other users' archives.
+	for _, dir := range []string{filepath.Join(users, "user-2", "mail"), users} {
+		_, err := account.ResolveEmailDirOverride(dir, []string{users, filepath.Dir(users)}, "user-2", users)
+		if err == nil || !strings.Contains(err.Error(), "DATA_DIR") {
+			t.Errorf("%s: error = %v, want DATA_DIR refused", dir, err)
+		}
+	}
+	if _, err := account.ResolveEmailDirOverride(archive, nil, "user-1", users); err == nil || !strings.Contains(err.Error(), "disabled") {
+		t.Errorf("no roots: error = %v, want disabled", err)
+	}
+	if _, err := account.ResolveEmailDirOverride(archive, []string{root}, "../user-1", users); err == nil {
+		t.Error("user ID with a path separator accepted")
+	}
+}
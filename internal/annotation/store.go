@@ -0,0 +1,193 @@
+// Package annotation keeps a user's flags, stars and virtual folders on
+// archived emails. Email files are never modified, so marks live in a
+// per-user file keyed by content checksum: they follow a message through
+// reindexing, folder moves and re-imports.
+package annotation
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/eslider/mails/internal/checksum"
+	"github.com/eslider/mails/internal/storage"
+)
+
+const fileName = "annotations.json"
+
+// Annotation is what a user marked on one email.
+type Annotation struct {
+	Flagged   bool      `json:"flagged,omitempty"`
+	Starred   bool      `json:"starred,omitempty"`
+	UpdatedAt time.Time `json:"updated_at,omitzero"`
+
+	// Folder is the virtual folder the user moved the email to, which
+	// the vfolder: search operator finds besides its real folder.
+	Folder string `json:"folder,omitempty"`
+}
+
+// empty reports whether a carries no mark and can be dropped.
+func (a Annotation) empty() bool {
+	return !a.Flagged && !a.Starred && a.Folder == ""
+}
+
+type file struct {
+	Emails map[string]Annotation `json:"emails"`
+}
+
+// Key returns the key an email is annotated under: the first
+// checksum.LegacyLength characters of the checksum its file name starts
+// with, so copies named under any CHECKSUM_LENGTH share marks. "" when the
+// name has no checksum (see mails migrate-filenames).
+func Key(path string) string {
+	sum := checksum.FromName(filepath.Base(path))
+	if len(sum) < checksum.LegacyLength {
+		return ""
+	}
+	return sum[:checksum.LegacyLength]
+}
+
+// Store manages annotations per user.
+// Layout: {usersDir}/{userID}/annotations.json
+type Store struct {
+	mu        sync.Mutex
+	usersDir  string
+	blobStore storage.BlobStore
+}
+
+// NewStore creates an annotation store. blobStore may be nil to use the
+// local filesystem.
+func NewStore(usersDir string, blobStore storage.BlobStore) *Store {
+	return &Store{usersDir: usersDir, blobStore: blobStore}
+}
+
+// All returns the user's annotations by key.
+func (s *Store) All(userID string) (map[string]Annotation, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	f, err := s.load(userID)
+	return f.Emails, err
+}
+
+// Update applies fn to the annotation under key and saves it, dropping it
+// once it carries no mark.
+func (s *Store) Update(userID, key string, fn func(*Annotation)) (Annotation, error) {
+	if key == "" {
+		return Annotation{}, errors.New("annotation key is empty")
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	f, err := s.load(userID)
+	if err != nil {
+		return Annotation{}, err
+	}
+	a := f.Emails[key]
+	fn(&a)
+	a.UpdatedAt = time.Now().UTC()
+	if a.empty() {
+		delete(f.Emails, key)
+	} else {
+		f.Emails[key] = a
+	}
+	return a, s.save(userID, f)
+}
+
+// UpdateMany applies fn to the annotations under keys and saves them
+// once, like Update for each key.
+func (s *Store) UpdateMany(userID string, keys []string, fn func(*Annotation)) error {
+	if slices.Contains(keys, "") {
+		return errors.New("annotation key is empty")
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	f, err := s.load(userID)
+	if err != nil {
+		return err
+	}
+	now := time.Now().UTC()
+	for _, key := range keys {
+		a := f.Emails[key]
+		fn(&a)
+		a.UpdatedAt = now
+		if a.empty() {
+			delete(f.Emails, key)
+		} else {
+			f.Emails[key] = a
+		}
+	}
+	return s.save(userID, f)
+}
+
+// NormalizeFolder trims a virtual folder name and the slashes around it.
+// Names are matched case-insensitively.
+func NormalizeFolder(name string) (string, error) {
+	name = strings.Trim(strings.TrimSpace(name), "/")
+	switch {
+	case len(name) > maxFolderLen:
+		return "", fmt.Errorf("folder name longer than %d bytes", maxFolderLen)
+	case strings.ContainsAny(name, "\"\r\n"):
+		return "", errors.New("folder name contains a quote or line break")
+	}
+	return name, nil
+}
+
+// maxFolderLen bounds virtual folder names.
+const maxFolderLen = 200
+
+func (s *Store) path(userID string) string {
+	return filepath.Join(s.usersDir, userID, fileName)
+}
+
+func (s *Store) load(userID string) (file, error) {
+	f := file{Emails: make(map[string]Annotation)}
+	var data []byte
+	var err error
+	if s.blobStore != nil {
+		data, err = s.blobStore.Read(context.Background(), userID+"/"+fileName)
+		if errors.Is(err, storage.ErrNotFound) {
+			return f, nil
+		}
+	} else {
+		data, err = os.ReadFile(s.path(userID))
+		if os.IsNotExist(err) {
+			return f, nil
+		}
+	}
+	if err != nil {
+		return f, err
+	}
+	if err := json.Unmarshal(data, &f); err != nil {
+		return f, fmt.Errorf("parse %s: %w", fileName, err)
+	}
+	if f.Emails == nil {
+		f.Emails = make(map[string]Annotation)
+	}
+	return f, nil
+}
+
+func (s *Store) save(userID string, f file) error {
+	data, err := json.MarshalIndent(f, "", "  ")
+	if err != nil {
+		return err
+	}
+	if s.blobStore != nil {
+		return s.blobStore.Write(context.Background(), userID+"/"+fileName, data)
+	}
+	path := s.path(userID)
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return err
+	}
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
@@ -0,0 +1,79 @@
+package annotation
+
+import (
+	"testing"
+)
+
+func TestKey(t *testing.T) {
+	for path, want := range map[string]string{
+		"inbox/0123456789abcdef01234567-12.eml":       "0123456789abcdef",
+		"0123456789abcdef-3.eml.gz":                   "0123456789abcdef",
+		"sent/0123456789abcdef0123456789abcdef-1.eml": "0123456789abcdef",
+		"inbox/readpst-1.eml":                         "",
+	} {
+		if got := Key(path); got != want {
+			t.Errorf("Key(%q) = %q, want %q", path, got, want)
+		}
+	}
+}
+
+func TestUpdateKeepsMarksUntilCleared(t *testing.T) {
+	s := NewStore(t.TempDir(), nil)
+	if all, err := s.All("u1"); err != nil || len(all) != 0 {
+		t.Fatalf("All on a new user = %v, %v", all, err)
+	}
+	if _, err := s.Update("u1", "0123456789abcdef", func(a *Annotation) { a.Flagged = true }); err != nil {
+		t.Fatal(err)
+	}
+	a, err := s.Update("u1", "0123456789abcdef", func(a *Annotation) { a.Starred = true })
+	if err != nil || !a.Flagged || !a.Starred {
+		t.Fatalf("Update = %+v, %v; want flagged and starred", a, err)
+	}
+
+	// A second store reads what the first saved.
+	other := NewStore(s.usersDir, nil)
+	if all, _ := other.All("u1"); !all["0123456789abcdef"].Flagged {
+		t.Errorf("reloaded = %+v", all)
+	}
+	if all, _ := other.All("u2"); len(all) != 0 {
+		t.Errorf("another user sees %+v", all)
+	}
+
+	s.Update("u1", "0123456789abcdef", func(a *Annotation) { a.Flagged = false; a.Starred = false })
+	if all, _ := s.All("u1"); len(all) != 0 {
+		t.Errorf("cleared annotation kept: %+v", all)
+	}
+	if _, err := s.Update("u1", "", func(a *Annotation) { a.Flagged = true }); err == nil {
+		t.Error("Update with an empty key succeeded")
+	}
+}
+
+func TestUpdateManyFilesInFolder(t *testing.T) {
+	s := NewStore(t.TempDir(), nil)
+	keys := []string{"0123456789abcdef", "fedcba9876543210"}
+	if err := s.UpdateMany("u1", keys, func(a *Annotation) { a.Folder = "Invoices" }); err != nil {
+		t.Fatal(err)
+	}
+	s.Update("u1", keys[0], func(a *Annotation) { a.Starred = true })
+	all, _ := s.All("u1")
+	if all[keys[0]].Folder != "Invoices" || !all[keys[0]].Starred || all[keys[1]].Folder != "Invoices" {
+		t.Fatalf("All = %+v", all)
+	}
+	// Moving back out of the folder drops the annotation left empty.
+	s.UpdateMany("u1", keys, func(a *Annotation) { a.Folder = "" })
+	if all, _ := s.All("u1"); len(all) != 1 || all[keys[0]].Folder != "" {
+		t.Errorf("after clearing = %+v, want only the star", all)
+	}
+	if err := s.UpdateMany("u1", []string{""}, func(a *Annotation) {}); err == nil {
+		t.Error("UpdateMany with an empty key succeeded")
+	}
+
+	for in, want := range map[string]string{" /Tax 2024/ ": "Tax 2024", "": ""} {
+		if got, err := NormalizeFolder(in); err != nil || got != want {
+			t.Errorf("NormalizeFolder(%q) = %q, %v; want %q", in, got, err, want)
+		}
+	}
+	if _, err := NormalizeFolder(`a"b`); err == nil {
+		t.Error("NormalizeFolder accepted a quote")
+	}
+}
@@ -65,7 +65,8 @@ func unauthorized(w http.ResponseWriter, r *http.Request) {
 		len(r.URL.Path) >= 4 && r.URL.Path[:4] == "/api" {
 		w.Header().Set("Content-Type", "application/json")
 		w.WriteHeader(http.StatusUnauthorized)
-		w.Write([]byte(`{"error":"unauthorized"}`))
+		// The same envelope as the web package's error responses.
+		w.Write([]byte(`{"error":{"code":"unauthorized","message":"authentication required"}}`))
 		return
 	}
 	http.Redirect(w, r, "/login", http.StatusSeeOther)
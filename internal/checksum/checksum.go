@@ -0,0 +1,88 @@
+// Package checksum implements the content checksums in stored filenames
+// ({checksum}-{id}.eml): a hex prefix of the SHA-256 of the file's bytes.
+// Files with equal checksums are treated as the same message.
+package checksum
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"log"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+const (
+	// LegacyLength is the checksum length of files written before the
+	// length was configurable.
+	LegacyLength = 16
+	// DefaultLength is the CHECKSUM_LENGTH default. 24 hex chars (96 bits)
+	// keep the odds of any two messages colliding below 10^-11 even at a
+	// billion messages; 16 give about 1 in 4,000 at a hundred million.
+	DefaultLength = 24
+	// MaxLength is the full SHA-256 in hex.
+	MaxLength = 2 * sha256.Size
+)
+
+// reName matches the checksum at the start of a stored filename. Any
+// length from LegacyLength up is accepted, so files written under an
+// older setting keep deduplicating and verifying.
+var reName = regexp.MustCompile(`^([0-9a-f]{16,64})-`)
+
+// SQLPattern extracts the checksum of a stored file from its path in
+// DuckDB's regexp_extract; the checksum is capture group 2.
+const SQLPattern = `(^|/)([0-9a-f]{16,64})-`
+
+// length is the number of hex chars new filenames use, from CHECKSUM_LENGTH.
+var length = lengthFromEnv()
+
+func lengthFromEnv() int {
+	v := strings.TrimSpace(os.Getenv("CHECKSUM_LENGTH"))
+	if v == "" {
+		return DefaultLength
+	}
+	n, err := strconv.Atoi(v)
+	if err != nil || n < LegacyLength || n > MaxLength {
+		log.Printf("WARN: CHECKSUM_LENGTH=%q is not between %d and %d; using %d", v, LegacyLength, MaxLength, DefaultLength)
+		return DefaultLength
+	}
+	return n
+}
+
+// SetLength changes the length of new checksums, clamped to
+// [LegacyLength, MaxLength]. It is not safe to call while files are saved.
+func SetLength(n int) {
+	length = min(max(n, LegacyLength), MaxLength)
+}
+
+// Length returns the number of hex chars new checksums have.
+func Length() int {
+	return length
+}
+
+// Sum returns the checksum for new files holding data.
+func Sum(data []byte) string {
+	h := sha256.Sum256(data)
+	return hex.EncodeToString(h[:])[:length]
+}
+
+// FromName returns the checksum a stored filename starts with, or "" when
+// it has none (e.g. files from readpst or copied in by hand).
+func FromName(name string) string {
+	m := reName.FindStringSubmatch(name)
+	if m == nil {
+		return ""
+	}
+	return m[1]
+}
+
+// Verify reports whether sum, of any accepted length, is the checksum of
+// data.
+func Verify(sum string, data []byte) bool {
+	if len(sum) < LegacyLength {
+		return false
+	}
+	h := sha256.Sum256(data)
+	return strings.HasPrefix(hex.EncodeToString(h[:]), sum)
+}
@@ -0,0 +1,58 @@
+package checksum
+
+import "testing"
+
+func TestSum(t *testing.T) {
+	defer SetLength(Length())
+
+	// sha256("hello") = 2cf24dba5fb0a30e26e83b2ac5b9e29e1b161e5c1fa7425e73043362938b9824
+	if got := Sum([]byte("hello")); got != "2cf24dba5fb0a30e26e83b2a" {
+		t.Errorf("default Sum = %s", got)
+	}
+	SetLength(LegacyLength)
+	if got := Sum([]byte("hello")); got != "2cf24dba5fb0a30e" {
+		t.Errorf("legacy Sum = %s", got)
+	}
+	SetLength(1000)
+	if got := Sum([]byte("hello")); len(got) != MaxLength {
+		t.Errorf("Sum length = %d, want clamp to %d", len(got), MaxLength)
+	}
+}
+
+func TestFromNameAndVerify(t *testing.T) {
+	data := []byte("hello")
+	tests := []struct {
+		name string
+		want string
+	}{
+		{"2cf24dba5fb0a30e-12.eml", "2cf24dba5fb0a30e"},
+		{"2cf24dba5fb0a30e26e83b2a-12.eml", "2cf24dba5fb0a30e26e83b2a"},
+		{"2cf24dba5fb0a30e26e83b2ac5b9e29e1b161e5c1fa7425e73043362938b9824-1.vcf", "2cf24dba5fb0a30e26e83b2ac5b9e29e1b161e5c1fa7425e73043362938b9824"},
+		{"2cf24dba-12.eml", ""},
+		{"2025-02-12_legacy_email.eml", ""},
+	}
+	for _, tt := range tests {
+		got := FromName(tt.name)
+		if got != tt.want {
+			t.Errorf("FromName(%s) = %q, want %q", tt.name, got, tt.want)
+		}
+		if got != "" && !Verify(got, data) {
+			t.Errorf("Verify(%s) = false", got)
+		}
+	}
+	if Verify("2cf24dba5fb0a30e26e83b2b", data) {
+		t.Error("Verify accepted a wrong checksum")
+	}
+	if Verify("2cf24dba", data) {
+		t.Error("Verify accepted a checksum shorter than LegacyLength")
+	}
+}
+
+func TestLengthFromEnv(t *testing.T) {
+	for v, want := range map[string]int{"": DefaultLength, "32": 32, "16": 16, "8": DefaultLength, "65": DefaultLength, "x": DefaultLength} {
+		t.Setenv("CHECKSUM_LENGTH", v)
+		if got := lengthFromEnv(); got != want {
+			t.Errorf("CHECKSUM_LENGTH=%q: %d, want %d", v, got, want)
+		}
+	}
+}
@@ -0,0 +1,58 @@
+package model
+
+import (
+	"path"
+	"regexp"
+	"strings"
+)
+
+// DefaultExcludeFolders is the ExcludeFolders of new accounts that sync:
+// the usual junk and deleted-mail folders.
+const DefaultExcludeFolders = "Spam,Junk,Trash,Bin,Deleted*"
+
+// ExcludesFolder reports whether folder matches the account's
+// ExcludeFolders (see FolderExcluded).
+func (a EmailAccount) ExcludesFolder(folder string) bool {
+	return FolderExcluded(a.ExcludeFolders, folder)
+}
+
+// FolderExcluded reports whether folder matches one of the comma-separated
+// patterns, where * and ? are wildcards within a segment ("Spam", "*/spam",
+// "Archive/20??"). folder is an IMAP folder name ("[Gmail]/Spam",
+// "INBOX.Junk") or a directory under an account's email directory
+// ("gmail/spam"); both are compared in the form sync stores folders in:
+// case-insensitive, "." and "\" as "/", brackets dropped and spaces, "-"
+// and "_" alike. A pattern without "/" also matches the last segment
+// alone, so "Spam" matches "[Gmail]/Spam".
+func FolderExcluded(patterns, folder string) bool {
+	if patterns == "" {
+		return false
+	}
+	folder = folderKey(folder)
+	leaf := folder[strings.LastIndex(folder, "/")+1:]
+	for _, p := range strings.Split(patterns, ",") {
+		p = folderKey(p)
+		if p == "" {
+			continue
+		}
+		if ok, _ := path.Match(p, folder); ok {
+			return true
+		}
+		if !strings.Contains(p, "/") {
+			if ok, _ := path.Match(p, leaf); ok {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+var reFolderSep = regexp.MustCompile(`[\s_-]+`)
+
+// folderKey normalises a folder name or pattern for FolderExcluded.
+func folderKey(s string) string {
+	s = strings.ToLower(strings.TrimSpace(s))
+	s = strings.NewReplacer("[", "", "]", "", ".", "/", `\`, "/").Replace(s)
+	s = reFolderSep.ReplaceAllString(s, "_")
+	return strings.Trim(s, "/_")
+}
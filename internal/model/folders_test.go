@@ -0,0 +1,35 @@
+package model_test
+
+import (
+	"testing"
+
+	"github.com/eslider/mails/internal/model"
+)
+
+func TestFolderExcluded(t *testing.T) {
+	tests := []struct {
+		patterns, folder string
+		want             bool
+	}{
+		{"Spam", "[Gmail]/Spam", true},
+		{"Spam", "gmail/spam", true},
+		{"*/spam", "gmail/spam", true},
+		{"*/spam", "Spam", false},
+		{"Junk", "INBOX.Junk", true},
+		{"Deleted*", "Deleted Items", true},
+		{"deleted_items", "Deleted Items", true},
+		{"Archive/20??", "Archive/2024", true},
+		{"Archive/20??", "Archive/2024/Q1", false},
+		{" Trash , Spam ", "trash", true},
+		{model.DefaultExcludeFolders, "INBOX", false},
+		{model.DefaultExcludeFolders, "[Gmail]/Sent Mail", false},
+		{model.DefaultExcludeFolders, "[Gmail]/Trash", true},
+		{"", "Spam", false},
+		{",", "Spam", false},
+	}
+	for _, tt := range tests {
+		if got := model.FolderExcluded(tt.patterns, tt.folder); got != tt.want {
+			t.Errorf("FolderExcluded(%q, %q) = %v, want %v", tt.patterns, tt.folder, got, tt.want)
+		}
+	}
+}
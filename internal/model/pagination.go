@@ -0,0 +1,60 @@
+package model
+
+import (
+	"net/url"
+	"strconv"
+)
+
+// Pagination places a page of results within the full result set, so
+// clients need not derive paging from total, offset and limit.
+type Pagination struct {
+	Page       int  `json:"page"` // 1-based; past TotalPages when offset overshoots
+	TotalPages int  `json:"total_pages"`
+	HasNext    bool `json:"has_next"`
+	HasPrev    bool `json:"has_prev"`
+	// Next and Prev are query strings (without "?") for the adjacent
+	// pages: the request's query with offset and limit replaced. Empty
+	// when there is no such page.
+	Next string `json:"next,omitempty"`
+	Prev string `json:"prev,omitempty"`
+}
+
+// NewPagination describes the page at offset of size limit over total
+// results. A limit below 1 means one page holding everything. query is the
+// request's query, copied into Next and Prev; nil leaves them empty.
+func NewPagination(total, offset, limit int, query url.Values) Pagination {
+	offset = max(offset, 0)
+	if limit < 1 {
+		p := Pagination{Page: 1, HasPrev: offset > 0}
+		if total > 0 {
+			p.TotalPages = 1
+		}
+		return p
+	}
+	p := Pagination{
+		Page:       offset/limit + 1,
+		TotalPages: (total + limit - 1) / limit,
+		HasNext:    offset+limit < total,
+		HasPrev:    offset > 0,
+	}
+	if query == nil {
+		return p
+	}
+	link := func(off int) string {
+		q := url.Values{}
+		for k, v := range query {
+			q[k] = v
+		}
+		q.Set("offset", strconv.Itoa(off))
+		q.Set("limit", strconv.Itoa(limit))
+		return q.Encode()
+	}
+	if p.HasNext {
+		p.Next = link(offset + limit)
+	}
+	if p.HasPrev {
+		// Past the end, "previous" is the last page that has results.
+		p.Prev = link(min(max(offset-limit, 0), max(p.TotalPages-1, 0)*limit))
+	}
+	return p
+}
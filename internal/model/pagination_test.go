@@ -0,0 +1,53 @@
+package model_test
+
+import (
+	"net/url"
+	"testing"
+
+	"github.com/eslider/mails/internal/model"
+)
+
+func TestNewPagination(t *testing.T) {
+	query := url.Values{"q": {"invoice"}, "offset": {"ignored"}}
+	tests := []struct {
+		name                 string
+		total, offset, limit int
+		want                 model.Pagination
+	}{
+		{"empty", 0, 0, 50, model.Pagination{Page: 1}},
+		{"single page", 10, 0, 50, model.Pagination{Page: 1, TotalPages: 1}},
+		{"first of three", 120, 0, 50, model.Pagination{
+			Page: 1, TotalPages: 3, HasNext: true, Next: "limit=50&offset=50&q=invoice"}},
+		{"middle", 120, 50, 50, model.Pagination{
+			Page: 2, TotalPages: 3, HasNext: true, HasPrev: true,
+			Next: "limit=50&offset=100&q=invoice", Prev: "limit=50&offset=0&q=invoice"}},
+		{"last page", 120, 100, 50, model.Pagination{
+			Page: 3, TotalPages: 3, HasPrev: true, Prev: "limit=50&offset=50&q=invoice"}},
+		{"exactly full", 100, 50, 50, model.Pagination{
+			Page: 2, TotalPages: 2, HasPrev: true, Prev: "limit=50&offset=0&q=invoice"}},
+		{"unaligned offset", 120, 30, 50, model.Pagination{
+			Page: 1, TotalPages: 3, HasNext: true, HasPrev: true,
+			Next: "limit=50&offset=80&q=invoice", Prev: "limit=50&offset=0&q=invoice"}},
+		{"over offset", 120, 500, 50, model.Pagination{
+			Page: 11, TotalPages: 3, HasPrev: true, Prev: "limit=50&offset=100&q=invoice"}},
+		{"over offset on empty", 0, 100, 50, model.Pagination{
+			Page: 3, HasPrev: true, Prev: "limit=50&offset=0&q=invoice"}},
+		{"negative offset", 120, -5, 50, model.Pagination{
+			Page: 1, TotalPages: 3, HasNext: true, Next: "limit=50&offset=50&q=invoice"}},
+		{"no limit", 120, 0, 0, model.Pagination{Page: 1, TotalPages: 1}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := model.NewPagination(tt.total, tt.offset, tt.limit, query); got != tt.want {
+				t.Errorf("NewPagination(%d, %d, %d) =\n %+v\nwant\n %+v", tt.total, tt.offset, tt.limit, got, tt.want)
+			}
+		})
+	}
+
+	if p := model.NewPagination(120, 50, 50, nil); p.Next != "" || p.Prev != "" || !p.HasNext || !p.HasPrev {
+		t.Errorf("without a query = %+v, want flags but no links", p)
+	}
+	if query.Get("offset") != "ignored" {
+		t.Error("NewPagination modified the caller's query")
+	}
+}
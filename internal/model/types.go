@@ -19,15 +19,23 @@ func NewID() string {
 
 // User represents a registered user.
 type User struct {
-	ID           string    `json:"id" yaml:"id"`
-	Name         string    `json:"name" yaml:"name"`
-	Email        string    `json:"email" yaml:"email"`
-	AvatarURL    string    `json:"avatar_url,omitempty" yaml:"avatar_url,omitempty"`
-	PasswordHash string    `json:"-" yaml:"password_hash,omitempty"`             // bcrypt hash, never exposed
-	Provider     string    `json:"provider,omitempty" yaml:"provider,omitempty"` // "local", "github", "google", "facebook"
-	ProviderID   string    `json:"provider_id,omitempty" yaml:"provider_id,omitempty"`
-	CreatedAt    time.Time `json:"created_at" yaml:"created_at"`
-	UpdatedAt    time.Time `json:"updated_at" yaml:"updated_at"`
+	ID           string `json:"id" yaml:"id"`
+	Name         string `json:"name" yaml:"name"`
+	Email        string `json:"email" yaml:"email"`
+	AvatarURL    string `json:"avatar_url,omitempty" yaml:"avatar_url,omitempty"`
+	PasswordHash string `json:"-" yaml:"password_hash,omitempty"`             // bcrypt hash, never exposed
+	Provider     string `json:"provider,omitempty" yaml:"provider,omitempty"` // "local", "github", "google", "facebook"
+	ProviderID   string `json:"provider_id,omitempty" yaml:"provider_id,omitempty"`
+	// DefaultAccountID is used when a request names no account; empty means the first account.
+	DefaultAccountID string `json:"default_account_id,omitempty" yaml:"default_account_id,omitempty"`
+	// Admin users may list and stop every user's syncs (/api/admin); set with `mails admin`.
+	Admin     bool      `json:"admin,omitempty" yaml:"admin,omitempty"`
+	CreatedAt time.Time `json:"created_at" yaml:"created_at"`
+	UpdatedAt time.Time `json:"updated_at" yaml:"updated_at"`
+
+	// TrustedSenders are addresses ("a@bank.com") and domains ("bank.com",
+	// covering subdomains) whose emails keep their remote images.
+	TrustedSenders []string `json:"trusted_senders,omitempty" yaml:"trusted_senders,omitempty"`
 }
 
 // AccountType identifies the email protocol.
@@ -38,8 +46,19 @@ const (
 	AccountTypePOP3     AccountType = "POP3"
 	AccountTypeGmailAPI AccountType = "GMAIL_API"
 	AccountTypePST      AccountType = "PST"
+	AccountTypeMaildir  AccountType = "MAILDIR" // Maildir, Thunderbird or Apple Mail import
 )
 
+// Syncable reports whether accounts of this type download mail from a
+// server. Import-only types (PST, MAILDIR) and unknown types never sync.
+func (t AccountType) Syncable() bool {
+	switch t {
+	case AccountTypeIMAP, AccountTypePOP3, AccountTypeGmailAPI:
+		return true
+	}
+	return false
+}
+
 // EmailAccount represents a single email account configuration.
 type EmailAccount struct {
 	ID       string      `json:"id" yaml:"id"`
@@ -51,13 +70,61 @@ type EmailAccount struct {
 	SSL      bool        `json:"ssl,omitempty" yaml:"ssl,omitempty"`
 	Folders  string      `json:"folders,omitempty" yaml:"folders,omitempty"` // "all" or comma-separated
 
+	// SyncSince limits syncs to mail received on or after this day, to
+	// bound very old mailboxes. Zero syncs everything. Mail already
+	// downloaded from before it is kept.
+	SyncSince time.Time `json:"sync_since,omitzero" yaml:"sync_since,omitempty"`
+
+	// ExcludeFolders lists folders to leave out of sync and the search
+	// index, as comma-separated patterns such as "Spam,*/trash" (see
+	// FolderExcluded). New accounts that sync start with
+	// DefaultExcludeFolders.
+	ExcludeFolders string `json:"exclude_folders,omitempty" yaml:"exclude_folders,omitempty"`
+
+	// ConnectTimeout and IOTimeout override IMAP_CONNECT_TIMEOUT and
+	// IMAP_IO_TIMEOUT for this account, as Go durations such as "10s".
+	// IOTimeout bounds each read, so raise it for servers that stall on
+	// large attachments and lower it to detect dead connections sooner.
+	ConnectTimeout string `json:"connect_timeout,omitempty" yaml:"connect_timeout,omitempty"`
+	IOTimeout      string `json:"io_timeout,omitempty" yaml:"io_timeout,omitempty"`
+
+	// TLS customises certificate handling for IMAP/POP3 SSL connections.
+	TLS *TLSOptions `json:"tls,omitempty" yaml:"tls,omitempty"`
+
+	// EmailDirOverride points the account at an existing mail tree the
+	// user maintains outside the data directory, such as a read-only
+	// archive. The tree is only read: the account never syncs, imports or
+	// deletes, and its index stays under the data directory.
+	EmailDirOverride string `json:"email_dir_override,omitempty" yaml:"email_dir_override,omitempty"`
+
 	Sync SyncConfig `json:"sync" yaml:"sync"`
 }
 
+// ReadOnly reports whether the account's mail is read from an external
+// directory (see EmailDirOverride) that the app must not write to.
+func (a EmailAccount) ReadOnly() bool {
+	return a.EmailDirOverride != ""
+}
+
+// TLSOptions holds per-account TLS settings for servers with an internal
+// CA or that require client certificates. Certificates are PEM-encoded.
+type TLSOptions struct {
+	CACert     string `json:"ca_cert,omitempty" yaml:"ca_cert,omitempty"`         // extra trusted CA bundle
+	ClientCert string `json:"client_cert,omitempty" yaml:"client_cert,omitempty"` // client certificate chain
+	ClientKey  string `json:"-" yaml:"client_key,omitempty"`                      // Never expose via JSON
+
+	// InsecureSkipVerify disables server certificate checks. Only for
+	// servers that cannot be fixed; every connection logs a warning.
+	InsecureSkipVerify bool `json:"insecure_skip_verify,omitempty" yaml:"insecure_skip_verify,omitempty"`
+}
+
 // SyncConfig controls sync timing for an email account.
 type SyncConfig struct {
 	Interval string `json:"interval" yaml:"interval"` // e.g. "5m", "1h30m"
 	Enabled  bool   `json:"enabled" yaml:"enabled"`
+	// PausedReason explains an automatic pause (e.g. repeated login
+	// failures). Cleared when the account is resumed.
+	PausedReason string `json:"paused_reason,omitempty" yaml:"paused_reason,omitempty"`
 }
 
 // AccountsFile is the per-user accounts.yml structure.
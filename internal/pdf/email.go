@@ -0,0 +1,201 @@
+package pdf
+
+import (
+	"encoding/base64"
+	"fmt"
+	"html"
+	"log"
+	"regexp"
+	"strings"
+
+	"github.com/eslider/mails/internal/search/eml"
+)
+
+// Email renders a parsed email as a PDF: subject, headers, attachment list
+// and body, followed by any forwarded messages. The HTML body is preferred
+// and reduced to text with its inline (cid:, already data:) images; remote
+// images and scripts are dropped, so the file holds only what the archived
+// message itself contains. Characters no font can show are drawn as "?" and
+// logged.
+func Email(fe eml.FullEmail) []byte {
+	d := New(fe.Subject)
+	d.email(fe)
+	if n := d.Missing(); n > 0 {
+		log.Printf("WARN: PDF of %q: %d characters have no glyph and print as ?; set PDF_FONT to a font that covers them", fe.Subject, n)
+	}
+	return d.Bytes()
+}
+
+func (d *Document) email(fe eml.FullEmail) {
+	subject := fe.Subject
+	if subject == "" {
+		subject = "(no subject)"
+	}
+	d.Paragraph(Bold, 15, subject)
+	d.Space(6)
+	for _, f := range []struct{ label, value string }{
+		{"From", fe.From},
+		{"To", fe.To},
+		{"Cc", fe.CC},
+		{"Reply-To", fe.ReplyTo},
+	} {
+		if f.value != "" {
+			d.Field(f.label, f.value, 10)
+		}
+	}
+	if !fe.Date.IsZero() {
+		d.Field("Date", fe.Date.Format("Mon, 2 Jan 2006 15:04:05 -0700"), 10)
+	}
+	if len(fe.Attachments) > 0 {
+		names := make([]string, len(fe.Attachments))
+		for i, a := range fe.Attachments {
+			names[i] = fmt.Sprintf("%s (%s)", a.Filename, formatSize(int64(a.Size)))
+		}
+		d.Field("Attachments", strings.Join(names, "\n"), 10)
+	}
+	d.Rule()
+
+	if fe.HTMLBody != "" {
+		for _, b := range htmlBlocks(fe.HTMLBody) {
+			if b.image != nil {
+				if err := d.Image(b.image); err == nil {
+					continue
+				}
+				// Undecodable and oversized images are noted rather than
+				// failing the PDF.
+				b.text = "[image]"
+			}
+			d.Paragraph(Regular, 10, b.text)
+		}
+	} else {
+		d.Paragraph(Regular, 10, fe.TextBody)
+	}
+
+	for _, embedded := range fe.Embedded {
+		d.Space(12)
+		d.Paragraph(Bold, 10, "Attached message")
+		d.Rule()
+		d.email(embedded)
+	}
+}
+
+func formatSize(n int64) string {
+	switch {
+	case n >= 1<<20:
+		return fmt.Sprintf("%.1f MB", float64(n)/(1<<20))
+	case n >= 1<<10:
+		return fmt.Sprintf("%.1f KB", float64(n)/(1<<10))
+	default:
+		return fmt.Sprintf("%d B", n)
+	}
+}
+
+// block is a run of body text or one embedded image.
+type block struct {
+	text  string
+	image []byte
+}
+
+var (
+	reDropElements = regexp.MustCompile(`(?is)<!--.*?-->|<(?:script|style|head|title)\b[^>]*>.*?</(?:script|style|head|title)\s*>`)
+	reTag          = regexp.MustCompile(`(?s)<(/?)([a-zA-Z][a-zA-Z0-9]*)\b([^>]*)>`)
+	reAttrSrc      = regexp.MustCompile(`(?is)\bsrc\s*=\s*(?:"([^"]*)"|'([^']*)'|([^\s>]+))`)
+	reAttrAlt      = regexp.MustCompile(`(?is)\balt\s*=\s*(?:"([^"]*)"|'([^']*)')`)
+	reSpaces       = regexp.MustCompile(`[ \t\r\n\f]+`)
+	reBlankLines   = regexp.MustCompile(`\n{3,}`)
+)
+
+// breakTags end a line of text; the rest are inline.
+var breakTags = map[string]bool{
+	"br": true, "p": true, "div": true, "tr": true, "li": true, "table": true,
+	"ul": true, "ol": true, "blockquote": true, "pre": true, "hr": true,
+	"h1": true, "h2": true, "h3": true, "h4": true, "h5": true, "h6": true,
+}
+
+// htmlBlocks reduces an HTML body to text blocks and the images embedded
+// in it as data: URIs. Images with any other source are never loaded;
+// their alt text, if any, stays in the text.
+func htmlBlocks(body string) []block {
+	body = reDropElements.ReplaceAllString(body, " ")
+	var blocks []block
+	var text strings.Builder
+	flush := func() {
+		t := strings.TrimSpace(reBlankLines.ReplaceAllString(text.String(), "\n\n"))
+		if t != "" {
+			blocks = append(blocks, block{text: t})
+		}
+		text.Reset()
+	}
+	newline := func() {
+		s := strings.TrimRight(text.String(), " ")
+		text.Reset()
+		text.WriteString(s)
+		text.WriteByte('\n')
+	}
+
+	pos := 0
+	for _, m := range reTag.FindAllStringSubmatchIndex(body, -1) {
+		text.WriteString(reSpaces.ReplaceAllString(html.UnescapeString(body[pos:m[0]]), " "))
+		pos = m[1]
+		name := strings.ToLower(body[m[4]:m[5]])
+		attrs := body[m[6]:m[7]]
+		switch {
+		case name == "img":
+			if data := dataURIImage(attrValue(reAttrSrc, attrs)); data != nil {
+				flush()
+				blocks = append(blocks, block{image: data})
+			} else if alt := attrValue(reAttrAlt, attrs); alt != "" {
+				text.WriteString("[" + html.UnescapeString(alt) + "]")
+			}
+		case name == "li" && m[3] == m[2]:
+			newline()
+			text.WriteString("• ")
+		case name == "td" || name == "th":
+			text.WriteString("  ")
+		case breakTags[name]:
+			newline()
+		}
+	}
+	text.WriteString(reSpaces.ReplaceAllString(html.UnescapeString(body[pos:]), " "))
+	flush()
+
+	// Tidy lines: drop the spaces left around tags at line starts.
+	for i, b := range blocks {
+		if b.image == nil {
+			lines := strings.Split(b.text, "\n")
+			for j, l := range lines {
+				lines[j] = strings.TrimSpace(l)
+			}
+			blocks[i].text = strings.Join(lines, "\n")
+		}
+	}
+	return blocks
+}
+
+func attrValue(re *regexp.Regexp, attrs string) string {
+	m := re.FindStringSubmatch(attrs)
+	for _, v := range m[min(1, len(m)):] {
+		if v != "" {
+			return v
+		}
+	}
+	return ""
+}
+
+// dataURIImage returns the bytes of a base64 data: URI with an image type,
+// or nil for anything else, remote URLs included.
+func dataURIImage(src string) []byte {
+	rest, ok := strings.CutPrefix(strings.TrimSpace(src), "data:image/")
+	if !ok {
+		return nil
+	}
+	_, payload, ok := strings.Cut(rest, ";base64,")
+	if !ok {
+		return nil
+	}
+	data, err := base64.StdEncoding.DecodeString(payload)
+	if err != nil {
+		return nil
+	}
+	return data
+}
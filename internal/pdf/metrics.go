@@ -0,0 +1,127 @@
+package pdf
+
+// helveticaWidths holds the advance widths of Helvetica for the printable
+// ASCII characters 0x20-0x7e, in 1/1000 of the font size (from the font's
+// AFM file). Other characters are measured as 556, a typical lower-case
+// width.
+var helveticaWidths = [95]int{
+	278, 278, 355, 556, 556, 889, 667, 191, 333, 333, 389, 584, 278, 333, 278, 278, // space - /
+	556, 556, 556, 556, 556, 556, 556, 556, 556, 556, 278, 278, 584, 584, 584, 556, // 0 - ?
+	1015, 667, 667, 722, 722, 667, 611, 778, 722, 278, 500, 667, 556, 833, 722, 778, // @ - O
+	667, 778, 722, 667, 611, 722, 667, 944, 667, 667, 611, 278, 278, 278, 469, 556, // P - _
+	333, 556, 556, 500, 556, 556, 278, 556, 556, 222, 222, 500, 222, 833, 556, 556, // ` - o
+	556, 556, 333, 500, 278, 556, 500, 722, 500, 500, 500, 334, 260, 334, 584, // p - ~
+}
+
+// boldFactor widens Helvetica measurements to stay on the safe side for
+// Helvetica-Bold, whose glyphs are up to about 10% wider.
+const boldFactor = 1.1
+
+// charWidth returns the width of c in ems.
+func charWidth(c byte, f Font) float64 {
+	w := 556
+	if c >= 0x20 && c <= 0x7e {
+		w = helveticaWidths[c-0x20]
+	}
+	if f == Bold {
+		return float64(w) * boldFactor / 1000
+	}
+	return float64(w) / 1000
+}
+
+func textWidth(b []byte, f Font) float64 {
+	var w float64
+	for _, c := range b {
+		w += charWidth(c, f)
+	}
+	return w
+}
+
+// glyph is one character of a laid-out line: a WinAnsiEncoding byte of
+// the standard fonts, or a glyph ID of the embedded font (see shape).
+type glyph struct {
+	code  uint16
+	width float64 // ems
+	space bool
+}
+
+func glyphsWidth(gs []glyph) float64 {
+	var w float64
+	for _, g := range gs {
+		w += g.width
+	}
+	return w
+}
+
+// wrap breaks an encoded line into lines no wider than width ems, at
+// spaces where possible and inside words that do not fit on a line alone.
+func wrap(b []byte, width float64, f Font) [][]byte {
+	gs := make([]glyph, len(b))
+	for i, c := range b {
+		gs[i] = glyph{uint16(c), charWidth(c, f), c == ' '}
+	}
+	var lines [][]byte
+	for _, l := range wrapGlyphs(gs, width) {
+		line := make([]byte, len(l))
+		for i, g := range l {
+			line[i] = byte(g.code)
+		}
+		lines = append(lines, line)
+	}
+	return lines
+}
+
+// wrapGlyphs is wrap for glyphs of either font.
+func wrapGlyphs(b []glyph, width float64) [][]glyph {
+	var lines [][]glyph
+	var line []glyph
+	var lineW float64
+	for len(b) > 0 {
+		// Next word, with the spaces before it.
+		end := 0
+		for end < len(b) && b[end].space {
+			end++
+		}
+		for end < len(b) && !b[end].space {
+			end++
+		}
+		word := b[:end]
+		b = b[end:]
+		wordW := glyphsWidth(word)
+		if lineW+wordW <= width {
+			line = append(line, word...)
+			lineW += wordW
+			continue
+		}
+		if len(line) > 0 {
+			lines = append(lines, line)
+			line, lineW = nil, 0
+		}
+		word = trimLeftSpaces(word)
+		for glyphsWidth(word) > width {
+			n, w := 0, 0.0
+			for n < len(word) && w+word[n].width <= width {
+				w += word[n].width
+				n++
+			}
+			if n == 0 {
+				n = 1
+			}
+			lines = append(lines, word[:n])
+			word = word[n:]
+		}
+		line = append(line, word...)
+		lineW = glyphsWidth(line)
+	}
+	if len(line) > 0 {
+		lines = append(lines, line)
+	}
+	return lines
+}
+
+func trimLeftSpaces(b []glyph) []glyph {
+	for len(b) > 0 && b[0].space {
+		b = b[1:]
+	}
+	return b
+}
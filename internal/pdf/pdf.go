@@ -0,0 +1,474 @@
+// Package pdf writes simple, self-contained PDF documents: wrapped text in
+// the standard Helvetica fonts and embedded raster images on A4 pages. It
+// covers what an archived email needs and fetches nothing from the network.
+// Text outside Windows-1252 (Cyrillic, Greek, CJK, ...) is drawn with a
+// TrueType font embedded whole, once one is loaded with LoadFont.
+package pdf
+
+import (
+	"bytes"
+	"compress/zlib"
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	_ "image/gif" // register decoders for inline images
+	_ "image/jpeg"
+	_ "image/png"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"unicode/utf16"
+
+	"golang.org/x/text/encoding/charmap"
+)
+
+// Page geometry in points (A4).
+const (
+	pageWidth    = 595.28
+	pageHeight   = 841.89
+	margin       = 50.0
+	contentWidth = pageWidth - 2*margin
+	lineSpacing  = 1.3
+	pxToPt       = 0.75 // images are laid out at 96 dpi
+)
+
+// maxImagePixels caps the size of images, checked against their headers
+// before decoding: a few bytes of PNG can claim 60000x60000 pixels, and
+// decoding allocates 4 bytes per pixel or more.
+const maxImagePixels = 25_000_000
+
+// ErrImageTooLarge is returned by Document.Image for images over
+// maxImagePixels.
+var ErrImageTooLarge = errors.New("image too large")
+
+// Font selects one of the two standard fonts a Document uses.
+type Font int
+
+const (
+	Regular Font = iota // Helvetica
+	Bold                // Helvetica-Bold
+)
+
+func (f Font) resource() string {
+	if f == Bold {
+		return "/F2"
+	}
+	return "/F1"
+}
+
+// DefaultFont is where Debian's fonts-dejavu-core package puts DejaVu
+// Sans, which covers Latin, Greek, Cyrillic, Armenian, Georgian, Hebrew and
+// Arabic among others, but not CJK.
+const DefaultFont = "/usr/share/fonts/truetype/dejavu/DejaVuSans.ttf"
+
+// unicodeFont is the font set by LoadFont; nil leaves documents to the
+// standard fonts.
+var unicodeFont *trueType
+
+// LoadFont makes documents embed the TrueType font at path and draw text
+// the standard fonts cannot show with it. Bold text in that font is
+// emboldened by stroking its outlines. Call it once, at startup.
+func LoadFont(path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	f, err := parseTrueType(data)
+	if err != nil {
+		return fmt.Errorf("%s: %w", path, err)
+	}
+	f.name = regexp.MustCompile(`[^A-Za-z0-9-]`).ReplaceAllString(strings.TrimSuffix(filepath.Base(path), filepath.Ext(path)), "")
+	if f.name == "" {
+		f.name = "Embedded"
+	}
+	unicodeFont = f
+	return nil
+}
+
+// pdfImage is an image XObject, ready to be written.
+type pdfImage struct {
+	width, height int
+	colorSpace    string
+	filter        string
+	data          []byte
+}
+
+// Document is a PDF being laid out top to bottom. The zero value is not
+// usable; call New.
+type Document struct {
+	title  string
+	pages  []*bytes.Buffer // uncompressed content streams
+	images []pdfImage
+	y      float64 // baseline of the next line on the current page
+
+	used    map[uint16]rune // glyphs of unicodeFont drawn, and what they show
+	missing int
+}
+
+// New returns an empty document with one page. title becomes the document
+// title shown by PDF viewers.
+func New(title string) *Document {
+	d := &Document{title: title}
+	d.newPage()
+	return d
+}
+
+func (d *Document) newPage() {
+	d.pages = append(d.pages, new(bytes.Buffer))
+	d.y = pageHeight - margin
+}
+
+func (d *Document) page() *bytes.Buffer {
+	return d.pages[len(d.pages)-1]
+}
+
+// ensure starts a new page unless h points fit above the bottom margin.
+func (d *Document) ensure(h float64) {
+	if d.y-h < margin && d.y < pageHeight-margin {
+		d.newPage()
+	}
+}
+
+// Space moves down by h points.
+func (d *Document) Space(h float64) {
+	d.y -= h
+	if d.y < margin {
+		d.newPage()
+	}
+}
+
+// Rule draws a thin horizontal line across the content width.
+func (d *Document) Rule() {
+	d.ensure(8)
+	d.y -= 4
+	fmt.Fprintf(d.page(), "0.6 G 0.5 w %.2f %.2f m %.2f %.2f l S 0 G\n", margin, d.y, pageWidth-margin, d.y)
+	d.y -= 8
+}
+
+// Paragraph writes s wrapped to the content width. Line breaks in s start
+// new lines, and pages are added as needed.
+func (d *Document) Paragraph(f Font, size float64, s string) {
+	d.wrapped(margin, contentWidth, f, size, s)
+}
+
+// Field writes a label in bold followed by value, which wraps in a column
+// of its own to the right of the labels.
+func (d *Document) Field(label, value string, size float64) {
+	const labelWidth = 70.0
+	d.ensure(size * lineSpacing)
+	gs, cid := d.shape(label, Bold)
+	d.text(margin, d.y-size, Bold, size, cid, gs)
+	d.wrapped(margin+labelWidth, contentWidth-labelWidth, Regular, size, value)
+}
+
+func (d *Document) wrapped(x, width float64, f Font, size float64, s string) {
+	s = strings.ReplaceAll(strings.ReplaceAll(s, "\r\n", "\n"), "\t", "    ")
+	for _, para := range strings.Split(s, "\n") {
+		gs, cid := d.shape(para, f)
+		lines := wrapGlyphs(gs, width/size)
+		if len(lines) == 0 {
+			lines = [][]glyph{nil}
+		}
+		for _, line := range lines {
+			d.ensure(size * lineSpacing)
+			d.y -= size * lineSpacing
+			if len(line) > 0 {
+				d.text(x, d.y+size*(lineSpacing-1), f, size, cid, line)
+			}
+		}
+	}
+}
+
+// Missing returns how many characters neither the standard fonts nor the
+// loaded font could show; they were drawn as "?".
+func (d *Document) Missing() int {
+	return d.missing
+}
+
+// shape turns s into glyphs: of the standard fonts when they can show all
+// of it or no font is loaded (cid is false), else of unicodeFont.
+func (d *Document) shape(s string, f Font) (gs []glyph, cid bool) {
+	b, missing := encode(s)
+	if missing == 0 || unicodeFont == nil {
+		d.missing += missing
+		gs = make([]glyph, len(b))
+		for i, c := range b {
+			gs[i] = glyph{uint16(c), charWidth(c, f), c == ' '}
+		}
+		return gs, false
+	}
+	if d.used == nil {
+		d.used = make(map[uint16]rune)
+	}
+	for _, r := range s {
+		if r < 0x20 {
+			continue
+		}
+		id, ok := unicodeFont.glyphs[r]
+		if !ok {
+			d.missing++
+			r = '?'
+			id = unicodeFont.glyphs[r]
+		}
+		d.used[id] = r
+		w := unicodeFont.width(id)
+		if f == Bold {
+			w *= boldFactor
+		}
+		gs = append(gs, glyph{id, w, r == ' '})
+	}
+	return gs, true
+}
+
+// text draws one line of glyphs with its baseline at y.
+func (d *Document) text(x, y float64, f Font, size float64, cid bool, line []glyph) {
+	if !cid {
+		b := make([]byte, len(line))
+		for i, g := range line {
+			b[i] = byte(g.code)
+		}
+		fmt.Fprintf(d.page(), "BT %s %.1f Tf %.2f %.2f Td (%s) Tj ET\n", f.resource(), size, x, y, escape(b))
+		return
+	}
+	var hex strings.Builder
+	for _, g := range line {
+		fmt.Fprintf(&hex, "%04X", g.code)
+	}
+	bold := ""
+	if f == Bold {
+		// Fill and stroke: a faux bold, as only one font is embedded.
+		bold = fmt.Sprintf("2 Tr %.2f w ", size*0.03)
+	}
+	fmt.Fprintf(d.page(), "q BT /F3 %.1f Tf %s%.2f %.2f Td <%s> Tj ET Q\n", size, bold, x, y, hex.String())
+}
+
+// Image embeds a JPEG, PNG or GIF image, scaled down to fit the page.
+// JPEGs are stored as they are; other formats are re-encoded losslessly.
+// Images over 25 megapixels are refused with ErrImageTooLarge.
+func (d *Document) Image(data []byte) error {
+	img, err := newImage(data)
+	if err != nil {
+		return err
+	}
+	w, h := float64(img.width)*pxToPt, float64(img.height)*pxToPt
+	maxH := pageHeight - 2*margin
+	if w > contentWidth {
+		w, h = contentWidth, h*contentWidth/w
+	}
+	if h > maxH {
+		w, h = w*maxH/h, maxH
+	}
+	d.images = append(d.images, img)
+	d.ensure(h)
+	d.y -= h
+	fmt.Fprintf(d.page(), "q %.2f 0 0 %.2f %.2f %.2f cm /Im%d Do Q\n", w, h, margin, d.y, len(d.images))
+	d.y -= 6
+	return nil
+}
+
+func newImage(data []byte) (pdfImage, error) {
+	cfg, format, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return pdfImage{}, fmt.Errorf("decode image: %w", err)
+	}
+	if cfg.Width <= 0 || cfg.Height <= 0 || cfg.Width > maxImagePixels/cfg.Height {
+		return pdfImage{}, fmt.Errorf("%w: %dx%d pixels", ErrImageTooLarge, cfg.Width, cfg.Height)
+	}
+	if format == "jpeg" {
+		switch cfg.ColorModel {
+		case color.YCbCrModel:
+			return pdfImage{cfg.Width, cfg.Height, "/DeviceRGB", "/DCTDecode", data}, nil
+		case color.GrayModel:
+			return pdfImage{cfg.Width, cfg.Height, "/DeviceGray", "/DCTDecode", data}, nil
+		}
+	}
+	src, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return pdfImage{}, fmt.Errorf("decode image: %w", err)
+	}
+	// Everything else, CMYK JPEGs included, is flattened onto white and
+	// stored as raw RGB samples.
+	b := src.Bounds()
+	rgba := image.NewRGBA(b)
+	draw.Draw(rgba, b, image.White, image.Point{}, draw.Src)
+	draw.Draw(rgba, b, src, b.Min, draw.Over)
+	raw := make([]byte, 0, b.Dx()*b.Dy()*3)
+	for i := 0; i < len(rgba.Pix); i += 4 {
+		raw = append(raw, rgba.Pix[i], rgba.Pix[i+1], rgba.Pix[i+2])
+	}
+	return pdfImage{b.Dx(), b.Dy(), "/DeviceRGB", "/FlateDecode", deflate(raw)}, nil
+}
+
+// Bytes returns the finished PDF file.
+func (d *Document) Bytes() []byte {
+	var buf bytes.Buffer
+	var offsets []int
+	obj := func(body string, stream []byte) {
+		offsets = append(offsets, buf.Len())
+		fmt.Fprintf(&buf, "%d 0 obj\n%s\n", len(offsets), body)
+		if stream != nil {
+			buf.WriteString("stream\n")
+			buf.Write(stream)
+			buf.WriteString("\nendstream\n")
+		}
+		buf.WriteString("endobj\n")
+	}
+
+	// Objects 1-4 are fixed, then images, then a page and its content
+	// stream for every page, then the five objects of the embedded font
+	// if any text uses it.
+	firstImage := 5
+	firstPage := firstImage + len(d.images)
+	font := firstPage + 2*len(d.pages)
+	var kids, xobjects strings.Builder
+	for i := range d.pages {
+		fmt.Fprintf(&kids, "%d 0 R ", firstPage+2*i)
+	}
+	for i := range d.images {
+		fmt.Fprintf(&xobjects, "/Im%d %d 0 R ", i+1, firstImage+i)
+	}
+	fonts := "/F1 3 0 R /F2 4 0 R"
+	if len(d.used) > 0 {
+		fonts += fmt.Sprintf(" /F3 %d 0 R", font)
+	}
+	resources := fmt.Sprintf("<< /Font << %s >> /XObject << %s>> >>", fonts, xobjects.String())
+
+	buf.WriteString("%PDF-1.4\n%\xe2\xe3\xcf\xd3\n")
+	obj("<< /Type /Catalog /Pages 2 0 R >>", nil)
+	obj(fmt.Sprintf("<< /Type /Pages /Kids [%s] /Count %d >>", strings.TrimSpace(kids.String()), len(d.pages)), nil)
+	obj("<< /Type /Font /Subtype /Type1 /BaseFont /Helvetica /Encoding /WinAnsiEncoding >>", nil)
+	obj("<< /Type /Font /Subtype /Type1 /BaseFont /Helvetica-Bold /Encoding /WinAnsiEncoding >>", nil)
+	for _, img := range d.images {
+		obj(fmt.Sprintf("<< /Type /XObject /Subtype /Image /Width %d /Height %d /ColorSpace %s /BitsPerComponent 8 /Filter %s /Length %d >>",
+			img.width, img.height, img.colorSpace, img.filter, len(img.data)), img.data)
+	}
+	for i, p := range d.pages {
+		content := deflate(p.Bytes())
+		obj(fmt.Sprintf("<< /Type /Page /Parent 2 0 R /MediaBox [0 0 %.2f %.2f] /Resources %s /Contents %d 0 R >>",
+			pageWidth, pageHeight, resources, firstPage+2*i+1), nil)
+		obj(fmt.Sprintf("<< /Filter /FlateDecode /Length %d >>", len(content)), content)
+	}
+	if len(d.used) > 0 {
+		d.fontObjects(font, obj)
+	}
+	obj(fmt.Sprintf("<< /Title %s /Producer (mail-archive) >>", textString(d.title)), nil)
+
+	xref := buf.Len()
+	fmt.Fprintf(&buf, "xref\n0 %d\n0000000000 65535 f \n", len(offsets)+1)
+	for _, off := range offsets {
+		fmt.Fprintf(&buf, "%010d 00000 n \n", off)
+	}
+	fmt.Fprintf(&buf, "trailer\n<< /Size %d /Root 1 0 R /Info %d 0 R >>\nstartxref\n%d\n%%%%EOF\n", len(offsets)+1, len(offsets), xref)
+	return buf.Bytes()
+}
+
+// fontObjects writes unicodeFont as a Type 0 font with Identity-H
+// encoding, so that the codes in content streams are glyph IDs, numbered
+// from first: the font, its CIDFont, font descriptor, font file and a
+// ToUnicode CMap that keeps the text searchable and copyable.
+func (d *Document) fontObjects(first int, obj func(body string, stream []byte)) {
+	f := unicodeFont
+	ids := make([]int, 0, len(d.used))
+	for id := range d.used {
+		ids = append(ids, int(id))
+	}
+	sort.Ints(ids)
+	var widths, chars strings.Builder
+	for _, id := range ids {
+		fmt.Fprintf(&widths, "%d [%d] ", id, f.scale(int(f.advances[id])))
+	}
+	for i, id := range ids {
+		if i%100 == 0 {
+			if i > 0 {
+				chars.WriteString("endbfchar\n")
+			}
+			fmt.Fprintf(&chars, "%d beginbfchar\n", min(100, len(ids)-i))
+		}
+		fmt.Fprintf(&chars, "<%04X> <", id)
+		for _, u := range utf16.Encode([]rune{d.used[uint16(id)]}) {
+			fmt.Fprintf(&chars, "%04X", u)
+		}
+		chars.WriteString(">\n")
+	}
+	chars.WriteString("endbfchar\n")
+	cmap := "/CIDInit /ProcSet findresource begin\n12 dict begin\nbegincmap\n" +
+		"/CIDSystemInfo << /Registry (Adobe) /Ordering (UCS) /Supplement 0 >> def\n" +
+		"/CMapName /Adobe-Identity-UCS def\n/CMapType 2 def\n" +
+		"1 begincodespacerange\n<0000> <FFFF>\nendcodespacerange\n" +
+		chars.String() +
+		"endcmap\nCMapName currentdict /CMap defineresource pop\nend\nend\n"
+	file := deflate(f.data)
+
+	obj(fmt.Sprintf("<< /Type /Font /Subtype /Type0 /BaseFont /%s /Encoding /Identity-H /DescendantFonts [%d 0 R] /ToUnicode %d 0 R >>",
+		f.name, first+1, first+4), nil)
+	obj(fmt.Sprintf("<< /Type /Font /Subtype /CIDFontType2 /BaseFont /%s /CIDSystemInfo << /Registry (Adobe) /Ordering (Identity) /Supplement 0 >> /FontDescriptor %d 0 R /CIDToGIDMap /Identity /W [%s] >>",
+		f.name, first+2, strings.TrimSpace(widths.String())), nil)
+	obj(fmt.Sprintf("<< /Type /FontDescriptor /FontName /%s /Flags 32 /FontBBox [%d %d %d %d] /ItalicAngle 0 /Ascent %d /Descent %d /CapHeight %d /StemV 80 /FontFile2 %d 0 R >>",
+		f.name, f.scale(f.bbox[0]), f.scale(f.bbox[1]), f.scale(f.bbox[2]), f.scale(f.bbox[3]),
+		f.scale(f.ascent), f.scale(f.descent), f.scale(f.ascent), first+3), nil)
+	obj(fmt.Sprintf("<< /Filter /FlateDecode /Length1 %d /Length %d >>", len(f.data), len(file)), file)
+	obj(fmt.Sprintf("<< /Length %d >>", len(cmap)), []byte(cmap))
+}
+
+// textString returns s as a PDF text string: a literal in PDFDocEncoding
+// (which matches Windows-1252 for the characters used here) when it fits,
+// else UTF-16BE with a byte order mark.
+func textString(s string) string {
+	if b, missing := encode(s); missing == 0 {
+		return "(" + escape(b) + ")"
+	}
+	var sb strings.Builder
+	sb.WriteString("<FEFF")
+	for _, u := range utf16.Encode([]rune(s)) {
+		fmt.Fprintf(&sb, "%04X", u)
+	}
+	sb.WriteString(">")
+	return sb.String()
+}
+
+func deflate(b []byte) []byte {
+	var buf bytes.Buffer
+	zw := zlib.NewWriter(&buf)
+	zw.Write(b)
+	zw.Close()
+	return buf.Bytes()
+}
+
+// encode converts s to WinAnsiEncoding, the encoding of the standard fonts.
+// Characters it lacks become "?" and are counted in missing; control
+// characters are dropped.
+func encode(s string) (out []byte, missing int) {
+	out = make([]byte, 0, len(s))
+	for _, r := range s {
+		if b, ok := charmap.Windows1252.EncodeRune(r); ok && (b >= 0x20 || b == '\t') {
+			out = append(out, b)
+		} else if r >= 0x20 {
+			out = append(out, '?')
+			missing++
+		}
+	}
+	return out, missing
+}
+
+// escape makes b safe inside a PDF literal string.
+func escape(b []byte) string {
+	var sb strings.Builder
+	for _, c := range b {
+		switch c {
+		case '\\', '(', ')':
+			sb.WriteByte('\\')
+			sb.WriteByte(c)
+		default:
+			if c < 0x20 || c >= 0x7f {
+				fmt.Fprintf(&sb, "\\%03o", c)
+			} else {
+				sb.WriteByte(c)
+			}
+		}
+	}
+	return sb.String()
+}
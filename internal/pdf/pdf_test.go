@@ -0,0 +1,183 @@
+package pdf
+
+import (
+	"bytes"
+	"compress/zlib"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"image"
+	"image/png"
+	"io"
+	"regexp"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/eslider/mails/internal/search/eml"
+)
+
+func pngDataURI(t *testing.T) string {
+	t.Helper()
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, image.NewRGBA(image.Rect(0, 0, 4, 3))); err != nil {
+		t.Fatal(err)
+	}
+	return "data:image/png;base64," + base64.StdEncoding.EncodeToString(buf.Bytes())
+}
+
+// pageText inflates every content stream of a PDF written by Document.
+func pageText(t *testing.T, pdf []byte) string {
+	t.Helper()
+	var out strings.Builder
+	re := regexp.MustCompile(`(?s)<< /Filter /FlateDecode /Length (\d+) >>\nstream\n`)
+	for _, m := range re.FindAllSubmatchIndex(pdf, -1) {
+		n, _ := strconv.Atoi(string(pdf[m[2]:m[3]]))
+		zr, err := zlib.NewReader(bytes.NewReader(pdf[m[1] : m[1]+n]))
+		if err != nil {
+			t.Fatal(err)
+		}
+		b, err := io.ReadAll(zr)
+		if err != nil {
+			t.Fatal(err)
+		}
+		out.Write(b)
+	}
+	return out.String()
+}
+
+func TestEmail(t *testing.T) {
+	fe := eml.FullEmail{
+		Subject:     "Quarterly report",
+		From:        "Alice <alice@example.com>",
+		To:          "bob@example.com",
+		Date:        time.Date(2025, 2, 10, 12, 0, 0, 0, time.UTC),
+		Attachments: []eml.Attachment{{Filename: "report.xlsx", Size: 2048}},
+		HTMLBody: `<html><head><style>p{color:red}</style></head><body>
+<p>Numbers are <b>up</b> (again).</p><script>alert("x")</script>
+<img src="https://tracker.example.com/pixel.gif" alt="logo">
+<img src="` + pngDataURI(t) + `"><p>Caf&eacute; &amp; more</p></body></html>`,
+	}
+	pdf := Email(fe)
+
+	if !bytes.HasPrefix(pdf, []byte("%PDF-1.4\n")) || !bytes.HasSuffix(pdf, []byte("%%EOF\n")) {
+		t.Fatal("missing PDF header or trailer")
+	}
+	m := regexp.MustCompile(`startxref\n(\d+)\n`).FindSubmatch(pdf)
+	if m == nil {
+		t.Fatal("no startxref")
+	}
+	if off, _ := strconv.Atoi(string(m[1])); !bytes.HasPrefix(pdf[off:], []byte("xref\n")) {
+		t.Errorf("startxref %d does not point at the xref table", off)
+	}
+	if n := bytes.Count(pdf, []byte("/Subtype /Image")); n != 1 {
+		t.Errorf("%d images embedded, want 1 (the data: image only)", n)
+	}
+
+	text := pageText(t, pdf)
+	for _, want := range []string{
+		"(Quarterly report)",
+		"(Alice <alice@example.com>)",
+		"(Mon, 10 Feb 2025 12:00:00 +0000)",
+		"(report.xlsx \\(2.0 KB\\))",
+		"(Numbers are up \\(again\\).)",
+		"([logo])",
+		"(Caf\\351 & more)",
+		"/Im1 Do",
+	} {
+		if !strings.Contains(text, want) {
+			t.Errorf("page text lacks %q", want)
+		}
+	}
+	for _, unwanted := range []string{"alert", "color:red", "tracker"} {
+		if strings.Contains(text, unwanted) || bytes.Contains(pdf, []byte(unwanted)) {
+			t.Errorf("PDF contains %q", unwanted)
+		}
+	}
+}
+
+func TestEmailTextBodyPaginates(t *testing.T) {
+	body := strings.Repeat("A line of plain text that is long enough to need wrapping on an A4 page, twice over if need be.\n", 200)
+	pdf := Email(eml.FullEmail{Subject: "Long", TextBody: body})
+	if n := bytes.Count(pdf, []byte("/Type /Page ")); n < 2 {
+		t.Errorf("%d pages, want several", n)
+	}
+}
+
+func TestWrap(t *testing.T) {
+	width := 20.0 // ems
+	lines := wrap([]byte("short words fit "+strings.Repeat("x", 100)+" end"), width, Regular)
+	if len(lines) < 3 {
+		t.Fatalf("got %d lines: %q", len(lines), lines)
+	}
+	for _, l := range lines {
+		if w := textWidth(l, Regular); w > width {
+			t.Errorf("line %q is %.1f ems wide, limit %.1f", l, w, width)
+		}
+	}
+	if string(lines[0]) != "short words fit" {
+		t.Errorf("first line = %q", lines[0])
+	}
+}
+
+func TestEmailNonLatin(t *testing.T) {
+	defer func(f *trueType) { unicodeFont = f }(unicodeFont)
+	fe := eml.FullEmail{Subject: "Отчёт", From: "Иван <ivan@example.com>", TextBody: "Привет, мир. Καλημέρα. 你好"}
+
+	unicodeFont = nil
+	d := New(fe.Subject)
+	d.email(fe)
+	if d.Missing() == 0 {
+		t.Error("no missing characters reported without a Unicode font")
+	}
+
+	if err := LoadFont(DefaultFont); err != nil {
+		t.Skipf("no Unicode font: %v", err)
+	}
+	d = New(fe.Subject)
+	d.email(fe)
+	pdf := d.Bytes()
+	if n := d.Missing(); n != 2 {
+		t.Errorf("Missing() = %d, want 2 (the CJK characters)", n)
+	}
+	for _, want := range []string{"/Encoding /Identity-H", "/FontFile2", "/ToUnicode", "/Title <FEFF041E0442044704510442>"} {
+		if !bytes.Contains(pdf, []byte(want)) {
+			t.Errorf("PDF lacks %q", want)
+		}
+	}
+	text := pageText(t, pdf)
+	var hex strings.Builder
+	for _, r := range "Привет" {
+		fmt.Fprintf(&hex, "%04X", unicodeFont.glyphs[r])
+	}
+	if !strings.Contains(text, "/F3 10.0 Tf 50.00") || !strings.Contains(text, "<"+hex.String()) {
+		t.Errorf("page text lacks the glyphs of Привет:\n%s", text)
+	}
+	// Text that fits Windows-1252 stays in the standard fonts.
+	if !strings.Contains(text, "(From)") {
+		t.Errorf("page text lacks the From label:\n%s", text)
+	}
+}
+
+func TestImageTooLarge(t *testing.T) {
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, image.NewGray(image.Rect(0, 0, 1, 1))); err != nil {
+		t.Fatal(err)
+	}
+	// Claim 60000x60000 pixels in the IHDR chunk and fix its CRC.
+	b := buf.Bytes()
+	binary.BigEndian.PutUint32(b[16:], 60000)
+	binary.BigEndian.PutUint32(b[20:], 60000)
+	binary.BigEndian.PutUint32(b[29:], crc32.ChecksumIEEE(b[12:29]))
+
+	if err := New("").Image(b); !errors.Is(err, ErrImageTooLarge) {
+		t.Fatalf("Image = %v, want ErrImageTooLarge", err)
+	}
+	pdf := Email(eml.FullEmail{HTMLBody: `<img src="data:image/png;base64,` + base64.StdEncoding.EncodeToString(b) + `">`})
+	if text := pageText(t, pdf); !strings.Contains(text, "([image])") {
+		t.Errorf("page text lacks the [image] placeholder:\n%s", text)
+	}
+}
@@ -0,0 +1,191 @@
+package pdf
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+)
+
+// trueType is what a Document needs from a TrueType font file to embed it
+// whole as a CID font: glyph IDs, advance widths and the metrics of its
+// font descriptor. Metrics are in font units (see unitsPerEm).
+type trueType struct {
+	name            string // PostScript-safe, for /BaseFont
+	data            []byte
+	unitsPerEm      int
+	bbox            [4]int // xMin, yMin, xMax, yMax
+	ascent, descent int
+	advances        []uint16 // by glyph ID
+	glyphs          map[rune]uint16
+}
+
+// parseTrueType reads the head, hhea, hmtx and cmap tables of a font with
+// TrueType outlines (.ttf). Font collections and CFF outlines (most .otf
+// files) are not supported.
+func parseTrueType(data []byte) (*trueType, error) {
+	if len(data) < 12 {
+		return nil, errors.New("not a TrueType font")
+	}
+	switch binary.BigEndian.Uint32(data) {
+	case 0x00010000, 0x74727565: // 1.0, "true"
+	case 0x74746366: // "ttcf"
+		return nil, errors.New("font collections (.ttc) are not supported")
+	case 0x4f54544f: // "OTTO"
+		return nil, errors.New("CFF outlines are not supported; use a .ttf font")
+	default:
+		return nil, errors.New("not a TrueType font")
+	}
+	tables := make(map[string][]byte)
+	n := int(binary.BigEndian.Uint16(data[4:]))
+	for i := range n {
+		rec := 12 + 16*i
+		if rec+16 > len(data) {
+			return nil, errors.New("truncated table directory")
+		}
+		off := int(binary.BigEndian.Uint32(data[rec+8:]))
+		size := int(binary.BigEndian.Uint32(data[rec+12:]))
+		if off < 0 || size < 0 || off+size > len(data) {
+			return nil, fmt.Errorf("table %q out of bounds", data[rec:rec+4])
+		}
+		tables[string(data[rec:rec+4])] = data[off : off+size]
+	}
+	for _, name := range []string{"head", "hhea", "hmtx", "maxp", "cmap", "glyf"} {
+		if tables[name] == nil {
+			return nil, fmt.Errorf("missing %s table", name)
+		}
+	}
+
+	head, hhea, maxp := tables["head"], tables["hhea"], tables["maxp"]
+	if len(head) < 54 || len(hhea) < 36 || len(maxp) < 6 {
+		return nil, errors.New("truncated head, hhea or maxp table")
+	}
+	f := &trueType{
+		data:       data,
+		unitsPerEm: int(binary.BigEndian.Uint16(head[18:])),
+		ascent:     int(int16(binary.BigEndian.Uint16(hhea[4:]))),
+		descent:    int(int16(binary.BigEndian.Uint16(hhea[6:]))),
+	}
+	if f.unitsPerEm == 0 {
+		return nil, errors.New("unitsPerEm is 0")
+	}
+	for i := range f.bbox {
+		f.bbox[i] = int(int16(binary.BigEndian.Uint16(head[36+2*i:])))
+	}
+
+	numGlyphs := int(binary.BigEndian.Uint16(maxp[4:]))
+	numMetrics := int(binary.BigEndian.Uint16(hhea[34:]))
+	hmtx := tables["hmtx"]
+	if numMetrics == 0 || numMetrics > numGlyphs || len(hmtx) < 4*numMetrics {
+		return nil, errors.New("bad hmtx table")
+	}
+	f.advances = make([]uint16, numGlyphs)
+	for i := range f.advances {
+		// Glyphs past the last metric repeat its advance.
+		f.advances[i] = binary.BigEndian.Uint16(hmtx[4*min(i, numMetrics-1):])
+	}
+
+	glyphs, err := parseCmap(tables["cmap"], numGlyphs)
+	if err != nil {
+		return nil, err
+	}
+	f.glyphs = glyphs
+	return f, nil
+}
+
+// parseCmap maps characters to glyph IDs from the font's Unicode cmap
+// subtable: format 12 (all of Unicode) when there is one, else format 4
+// (the Basic Multilingual Plane).
+func parseCmap(cmap []byte, numGlyphs int) (map[rune]uint16, error) {
+	if len(cmap) < 4 {
+		return nil, errors.New("truncated cmap table")
+	}
+	var best []byte
+	bestFormat := 0
+	for i := range int(binary.BigEndian.Uint16(cmap[2:])) {
+		rec := 4 + 8*i
+		if rec+8 > len(cmap) {
+			break
+		}
+		platform, encoding := binary.BigEndian.Uint16(cmap[rec:]), binary.BigEndian.Uint16(cmap[rec+2:])
+		off := int(binary.BigEndian.Uint32(cmap[rec+4:]))
+		if platform != 0 && !(platform == 3 && (encoding == 1 || encoding == 10)) || off+2 > len(cmap) {
+			continue
+		}
+		sub := cmap[off:]
+		format := int(binary.BigEndian.Uint16(sub))
+		if (format == 12 || format == 4) && format > bestFormat {
+			best, bestFormat = sub, format
+		}
+	}
+
+	glyphs := make(map[rune]uint16)
+	add := func(r rune, gid int) {
+		if gid > 0 && gid < numGlyphs {
+			glyphs[r] = uint16(gid)
+		}
+	}
+	switch bestFormat {
+	case 12:
+		if len(best) < 16 {
+			return nil, errors.New("truncated cmap subtable")
+		}
+		groups := int(binary.BigEndian.Uint32(best[12:]))
+		for i := range groups {
+			g := 16 + 12*i
+			if g+12 > len(best) {
+				return nil, errors.New("truncated cmap subtable")
+			}
+			start, end := binary.BigEndian.Uint32(best[g:]), binary.BigEndian.Uint32(best[g+4:])
+			gid := int(binary.BigEndian.Uint32(best[g+8:]))
+			if end < start || end > 0x10ffff {
+				continue
+			}
+			for c := start; c <= end; c++ {
+				add(rune(c), gid+int(c-start))
+			}
+		}
+	case 4:
+		if len(best) < 14 {
+			return nil, errors.New("truncated cmap subtable")
+		}
+		segs := int(binary.BigEndian.Uint16(best[6:])) / 2
+		ends, starts := 14, 16+2*segs
+		deltas, rangeOffsets := starts+2*segs, starts+4*segs
+		if rangeOffsets+2*segs > len(best) {
+			return nil, errors.New("truncated cmap subtable")
+		}
+		for i := range segs {
+			start := int(binary.BigEndian.Uint16(best[starts+2*i:]))
+			end := int(binary.BigEndian.Uint16(best[ends+2*i:]))
+			delta := int(binary.BigEndian.Uint16(best[deltas+2*i:]))
+			ro := int(binary.BigEndian.Uint16(best[rangeOffsets+2*i:]))
+			for c := start; c <= end && c != 0xffff; c++ {
+				if ro == 0 {
+					add(rune(c), (c+delta)&0xffff)
+					continue
+				}
+				// idRangeOffset counts from its own position into glyphIdArray.
+				at := rangeOffsets + 2*i + ro + 2*(c-start)
+				if at+2 > len(best) {
+					break
+				}
+				if gid := int(binary.BigEndian.Uint16(best[at:])); gid != 0 {
+					add(rune(c), (gid+delta)&0xffff)
+				}
+			}
+		}
+	default:
+		return nil, errors.New("no Unicode cmap subtable")
+	}
+	return glyphs, nil
+}
+
+// scale converts font units to the 1/1000 em of PDF glyph space.
+func (f *trueType) scale(v int) int {
+	return v * 1000 / f.unitsPerEm
+}
+
+// width returns the advance of glyph gid in ems.
+func (f *trueType) width(gid uint16) float64 {
+	return float64(f.advances[gid]) / float64(f.unitsPerEm)
+}
@@ -0,0 +1,202 @@
+package eml
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// parseAttachments controls whether ParseFile and ParseBytes extract the
+// text of attachments into AttachmentText, from INDEX_ATTACHMENTS (default
+// false). Every attachment with an extractor is decoded and read, which
+// makes builds much slower on document-heavy archives, so it is opt-in.
+var parseAttachments = parseAttachmentsFromEnv()
+
+func parseAttachmentsFromEnv() bool {
+	on, _ := strconv.ParseBool(os.Getenv("INDEX_ATTACHMENTS"))
+	return on
+}
+
+// SetParseAttachments turns attachment text extraction on or off. It is
+// not safe to call while emails are being parsed.
+func SetParseAttachments(on bool) {
+	parseAttachments = on
+}
+
+// ParsesAttachments reports whether parsed emails carry AttachmentText.
+func ParsesAttachments() bool {
+	return parseAttachments
+}
+
+const (
+	// maxAttachmentInput skips larger attachments: their text would not
+	// fit maxAttachmentText anyway, and decoding them costs the most.
+	maxAttachmentInput = 20 << 20
+	// maxAttachmentText caps the text kept per email, over all of its
+	// attachments.
+	maxAttachmentText = 256 << 10
+)
+
+// TextExtractor returns the plain text of an attachment, given its decoded
+// bytes.
+type TextExtractor func(data []byte) (string, error)
+
+// extractors maps a media type to its TextExtractor, and extractorExts a
+// lower-case filename extension to a media type in extractors, for the
+// many attachments sent as application/octet-stream.
+var (
+	extractors    = map[string]TextExtractor{}
+	extractorExts = map[string]string{}
+)
+
+func init() {
+	RegisterExtractor("text/plain", plainText, ".txt", ".text", ".log")
+	RegisterExtractor("text/csv", plainText, ".csv")
+	RegisterExtractor("text/markdown", plainText, ".md")
+	RegisterExtractor("application/pdf", pdfText, ".pdf")
+	RegisterExtractor("application/vnd.openxmlformats-officedocument.wordprocessingml.document", docxText, ".docx")
+}
+
+// RegisterExtractor makes attachments of mediaType, and those named with
+// one of exts (".pdf"), searchable through fn, replacing any extractor
+// registered for them. The built-in ones cover plain text, PDF and docx;
+// the PDF one only reads text drawn with simple fonts. It is not safe to
+// call while emails are being parsed.
+func RegisterExtractor(mediaType string, fn TextExtractor, exts ...string) {
+	mediaType = strings.ToLower(mediaType)
+	extractors[mediaType] = fn
+	for _, ext := range exts {
+		extractorExts[strings.ToLower(ext)] = mediaType
+	}
+}
+
+// extractorFor returns the extractor for an attachment by media type, then
+// by filename extension, or nil.
+func extractorFor(mediaType, filename string) TextExtractor {
+	if fn, ok := extractors[strings.ToLower(mediaType)]; ok {
+		return fn
+	}
+	if mt, ok := extractorExts[strings.ToLower(filepath.Ext(filename))]; ok {
+		return extractors[mt]
+	}
+	return nil
+}
+
+// attachmentText collects the text of one email's attachments up to
+// maxAttachmentText. A nil *attachmentText collects nothing.
+type attachmentText struct {
+	b strings.Builder
+}
+
+// add extracts the text of the attachment in r, still transfer-encoded,
+// when an extractor handles it and there is room left.
+func (a *attachmentText) add(r io.Reader, transferEncoding, mediaType, filename string) {
+	if a == nil || a.b.Len() >= maxAttachmentText {
+		return
+	}
+	fn := extractorFor(mediaType, filename)
+	if fn == nil {
+		return
+	}
+	data, err := io.ReadAll(io.LimitReader(decodeTransferEncoding(r, transferEncoding), maxAttachmentInput+1))
+	if err != nil || len(data) > maxAttachmentInput {
+		return
+	}
+	text, err := fn(data)
+	if err != nil {
+		return
+	}
+	text = strings.TrimSpace(ensureUTF8(text))
+	if text == "" {
+		return
+	}
+	if a.b.Len() > 0 {
+		a.b.WriteString("\n")
+	}
+	if room := maxAttachmentText - a.b.Len(); len(text) > room {
+		text = text[:room]
+		for len(text) > 0 && !utf8.ValidString(text) {
+			text = text[:len(text)-1]
+		}
+	}
+	a.b.WriteString(text)
+}
+
+// String returns the collected text.
+func (a *attachmentText) String() string {
+	if a == nil {
+		return ""
+	}
+	return a.b.String()
+}
+
+func plainText(data []byte) (string, error) {
+	return string(data), nil
+}
+
+// docxText returns the paragraphs of a Word document's main part.
+func docxText(data []byte) (string, error) {
+	zr, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		return "", fmt.Errorf("docx: %w", err)
+	}
+	for _, f := range zr.File {
+		if f.Name != "word/document.xml" {
+			continue
+		}
+		rc, err := f.Open()
+		if err != nil {
+			return "", fmt.Errorf("docx: %w", err)
+		}
+		defer rc.Close()
+		return wordprocessingText(io.LimitReader(rc, maxAttachmentInput))
+	}
+	return "", fmt.Errorf("docx: no word/document.xml")
+}
+
+// wordprocessingText returns the text runs (w:t) of WordprocessingML, one
+// line per paragraph.
+func wordprocessingText(r io.Reader) (string, error) {
+	var out strings.Builder
+	dec := xml.NewDecoder(r)
+	inText := false
+	for {
+		tok, err := dec.Token()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return out.String(), nil // keep what was read of a damaged part
+		}
+		switch t := tok.(type) {
+		case xml.StartElement:
+			switch t.Name.Local {
+			case "t":
+				inText = true
+			case "tab":
+				out.WriteString("\t")
+			case "br", "cr":
+				out.WriteString("\n")
+			}
+		case xml.EndElement:
+			switch t.Name.Local {
+			case "t":
+				inText = false
+			case "p":
+				out.WriteString("\n")
+			}
+		case xml.CharData:
+			if inText {
+				out.Write(t)
+			}
+		}
+	}
+	return out.String(), nil
+}
@@ -0,0 +1,110 @@
+package eml_test
+
+import (
+	"archive/zip"
+	"bytes"
+	"compress/zlib"
+	"encoding/base64"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/eslider/mails/internal/search/eml"
+)
+
+// testPDF returns a PDF with one plain and one Flate-compressed content
+// stream.
+func testPDF(t *testing.T) []byte {
+	t.Helper()
+	var z bytes.Buffer
+	zw := zlib.NewWriter(&z)
+	zw.Write([]byte("BT /F1 12 Tf 72 700 Td [(Indemni) -20 (fication) -300 (clause)] TJ ET"))
+	zw.Close()
+	plain := "BT /F1 12 Tf 72 720 Td (Master \\(services\\) agreement) Tj ET"
+	var b bytes.Buffer
+	b.WriteString("%PDF-1.4\n1 0 obj\n<< /Type /Catalog >>\nendobj\n")
+	fmt.Fprintf(&b, "4 0 obj\n<< /Length %d >>\nstream\n%s\nendstream\nendobj\n", len(plain), plain)
+	fmt.Fprintf(&b, "5 0 obj\n<< /Length %d /Filter /FlateDecode >>\nstream\n", z.Len())
+	b.Write(z.Bytes())
+	b.WriteString("\nendstream\nendobj\n%%EOF\n")
+	return b.Bytes()
+}
+
+func testDocx(t *testing.T) []byte {
+	t.Helper()
+	var b bytes.Buffer
+	zw := zip.NewWriter(&b)
+	f, err := zw.Create("word/document.xml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.Write([]byte(`<?xml version="1.0"?><w:document xmlns:w="http://schemas.openxmlformats.org/wordprocessingml/2006/main">` +
+		`<w:body><w:p><w:r><w:t>Quarterly</w:t></w:r><w:r><w:t xml:space="preserve"> forecast</w:t></w:r></w:p>` +
+		`<w:p><w:r><w:t>Second paragraph</w:t></w:r></w:p></w:body></w:document>`))
+	zw.Close()
+	return b.Bytes()
+}
+
+func attachmentEmail(parts ...[3]string) []byte {
+	b := "From: a@test.com\r\nTo: b@test.com\r\nSubject: Contract\r\nMIME-Version: 1.0\r\n" +
+		"Content-Type: multipart/mixed; boundary=XX\r\n\r\n--XX\r\nContent-Type: text/plain\r\n\r\nSee attached.\r\n"
+	for _, p := range parts {
+		b += "--XX\r\nContent-Type: " + p[0] + "\r\nContent-Transfer-Encoding: base64\r\n" +
+			"Content-Disposition: attachment; filename=\"" + p[1] + "\"\r\n\r\n" +
+			base64.StdEncoding.EncodeToString([]byte(p[2])) + "\r\n"
+	}
+	return []byte(b + "--XX--\r\n")
+}
+
+func TestParseAttachmentText(t *testing.T) {
+	content := attachmentEmail(
+		[3]string{"application/pdf", "contract.pdf", string(testPDF(t))},
+		[3]string{"application/octet-stream", "forecast.docx", string(testDocx(t))},
+		[3]string{"image/png", "logo.png", "\x89PNG not text"},
+	)
+
+	e, err := eml.ParseBytes("x.eml", content)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if e.AttachmentText != "" {
+		t.Errorf("AttachmentText = %q with extraction off, want empty", e.AttachmentText)
+	}
+
+	eml.SetParseAttachments(true)
+	t.Cleanup(func() { eml.SetParseAttachments(false) })
+	e, err = eml.ParseBytes("x.eml", content)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{"Master (services) agreement", "Indemnification clause", "Quarterly forecast", "Second paragraph"} {
+		if !strings.Contains(e.AttachmentText, want) {
+			t.Errorf("AttachmentText = %q, missing %q", e.AttachmentText, want)
+		}
+	}
+	if strings.Contains(e.AttachmentText, "PNG") {
+		t.Errorf("AttachmentText = %q, should skip images", e.AttachmentText)
+	}
+	if strings.Contains(e.BodyText, "Indemnification") {
+		t.Errorf("BodyText = %q, should not include attachment text", e.BodyText)
+	}
+}
+
+func TestAttachmentTextBounded(t *testing.T) {
+	eml.SetParseAttachments(true)
+	t.Cleanup(func() { eml.SetParseAttachments(false) })
+	big := strings.Repeat("lorem ipsum ", 100<<10) // 1.2 MB
+	e, err := eml.ParseBytes("x.eml", attachmentEmail(
+		[3]string{"text/plain", "a.txt", big},
+		[3]string{"text/plain", "b.txt", "tail marker"},
+	))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n := len(e.AttachmentText); n == 0 || n > 256<<10 {
+		t.Errorf("len(AttachmentText) = %d, want 1..%d", n, 256<<10)
+	}
+	if strings.Contains(e.AttachmentText, "tail marker") {
+		t.Error("text past the limit should be dropped")
+	}
+}
@@ -0,0 +1,48 @@
+package eml
+
+import (
+	"os"
+	"strconv"
+)
+
+// parseBody controls whether ParseFile and ParseBytes extract BodyText,
+// from INDEX_BODY (default true). Turning it off leaves only headers to
+// search, for a much smaller index; attachments are still counted.
+var parseBody = parseBodyFromEnv()
+
+func parseBodyFromEnv() bool {
+	on, err := strconv.ParseBool(os.Getenv("INDEX_BODY"))
+	return err != nil || on
+}
+
+// SetParseBody turns body extraction on or off. It is not safe to call
+// while emails are being parsed.
+func SetParseBody(on bool) {
+	parseBody = on
+}
+
+// ParsesBody reports whether parsed emails carry BodyText.
+func ParsesBody() bool {
+	return parseBody
+}
+
+// parseHTML controls whether ParseFile and ParseBytes also fill HTMLBody,
+// from INDEX_HTML (default false). The HTML, with inline images embedded,
+// is often many times the size of the text, so it is opt-in.
+var parseHTML = parseHTMLFromEnv()
+
+func parseHTMLFromEnv() bool {
+	on, _ := strconv.ParseBool(os.Getenv("INDEX_HTML"))
+	return on
+}
+
+// SetParseHTML turns HTML extraction on or off. It is not safe to call
+// while emails are being parsed.
+func SetParseHTML(on bool) {
+	parseHTML = on
+}
+
+// ParsesHTML reports whether parsed emails carry HTMLBody.
+func ParsesHTML() bool {
+	return parseHTML
+}
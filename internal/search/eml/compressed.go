@@ -0,0 +1,135 @@
+package eml
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+// Email files may be stored compressed as name.eml.gz or name.eml.zst.
+// They are read as if they were the plain .eml, and keep the checksum
+// prefix of their uncompressed name.
+const (
+	gzipSuffix = ".eml.gz"
+	zstdSuffix = ".eml.zst"
+)
+
+// IsEmailFile reports whether name is an email file: .eml, or .eml
+// compressed with gzip (.eml.gz) or zstd (.eml.zst).
+func IsEmailFile(name string) bool {
+	n := strings.ToLower(name)
+	return strings.HasSuffix(n, ".eml") || strings.HasSuffix(n, gzipSuffix) || strings.HasSuffix(n, zstdSuffix)
+}
+
+// PlainName strips a compression suffix: "a-1.eml.gz" becomes "a-1.eml".
+func PlainName(name string) string {
+	n := strings.ToLower(name)
+	switch {
+	case strings.HasSuffix(n, gzipSuffix):
+		return name[:len(name)-len(".gz")]
+	case strings.HasSuffix(n, zstdSuffix):
+		return name[:len(name)-len(".zst")]
+	}
+	return name
+}
+
+// decompress wraps r in the decompressor name's suffix calls for; plain
+// files are returned as they are.
+func decompress(name string, r io.Reader) (io.ReadCloser, error) {
+	n := strings.ToLower(name)
+	switch {
+	case strings.HasSuffix(n, gzipSuffix):
+		return gzip.NewReader(r)
+	case strings.HasSuffix(n, zstdSuffix):
+		d, err := zstd.NewReader(r, zstd.WithDecoderConcurrency(1))
+		if err != nil {
+			return nil, err
+		}
+		return d.IOReadCloser(), nil
+	}
+	return io.NopCloser(r), nil
+}
+
+// openFile opens the email file at path for reading its message,
+// decrypting and decompressing it when needed. compressed reports whether
+// the message differs in size from the file, as it does for both.
+func openFile(path string) (r io.ReadCloser, compressed bool, err error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, false, fmt.Errorf("open %s: %w", path, err)
+	}
+	br := bufio.NewReader(f)
+	if head, _ := br.Peek(len(sealMagic)); IsSealed(head) {
+		// GCM authenticates the whole file, so it is decrypted in one go.
+		data, err := io.ReadAll(br)
+		f.Close()
+		if err != nil {
+			return nil, true, fmt.Errorf("read %s: %w", path, err)
+		}
+		if data, err = Decompress(path, data); err != nil {
+			return nil, true, err
+		}
+		return io.NopCloser(bytes.NewReader(data)), true, nil
+	}
+	if PlainName(path) == path {
+		return readCloser{io.NopCloser(br), f}, false, nil
+	}
+	d, err := decompress(path, br)
+	if err != nil {
+		f.Close()
+		return nil, true, fmt.Errorf("decompress %s: %w", path, err)
+	}
+	return readCloser{d, f}, true, nil
+}
+
+// readCloser reads from a decompressor and closes it with the file under it.
+type readCloser struct {
+	io.ReadCloser
+	file *os.File
+}
+
+func (rc readCloser) Close() error {
+	rc.ReadCloser.Close()
+	return rc.file.Close()
+}
+
+// Decompress returns the message held in data, the content of the email
+// file name, decrypting sealed files. Plain .eml content is returned
+// unchanged.
+func Decompress(name string, data []byte) ([]byte, error) {
+	if IsSealed(data) {
+		var err error
+		if data, err = unseal(data); err != nil {
+			return nil, fmt.Errorf("decrypt %s: %w", name, err)
+		}
+	}
+	if PlainName(name) == name {
+		return data, nil
+	}
+	d, err := decompress(name, bytes.NewReader(data))
+	if err != nil {
+		return nil, fmt.Errorf("decompress %s: %w", name, err)
+	}
+	defer d.Close()
+	out, err := io.ReadAll(d)
+	if err != nil {
+		return nil, fmt.Errorf("decompress %s: %w", name, err)
+	}
+	return out, nil
+}
+
+// ReadFile reads the email file at path, decrypting and decompressing it
+// when needed.
+func ReadFile(path string) ([]byte, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return Decompress(path, data)
+}
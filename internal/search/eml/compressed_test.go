@@ -0,0 +1,97 @@
+package eml_test
+
+import (
+	"bytes"
+	"compress/gzip"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/klauspost/compress/zstd"
+
+	"github.com/eslider/mails/internal/search/eml"
+)
+
+const compressedMsg = "From: sender@example.com\r\nSubject: Packed\r\nDate: Mon, 10 Feb 2025 14:30:00 +0000\r\nContent-Type: text/plain\r\n\r\nSqueezed body text.\r\n"
+
+func gzipBytes(t *testing.T, data []byte) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	w := gzip.NewWriter(&buf)
+	w.Write(data)
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func zstdBytes(t *testing.T, data []byte) []byte {
+	t.Helper()
+	w, err := zstd.NewWriter(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer w.Close()
+	return w.EncodeAll(data, nil)
+}
+
+func TestParseFile_Compressed(t *testing.T) {
+	dir := t.TempDir()
+	for name, data := range map[string][]byte{
+		"a-1.eml.gz":  gzipBytes(t, []byte(compressedMsg)),
+		"a-2.eml.zst": zstdBytes(t, []byte(compressedMsg)),
+	} {
+		path := filepath.Join(dir, name)
+		if err := os.WriteFile(path, data, 0644); err != nil {
+			t.Fatal(err)
+		}
+		e, err := eml.ParseFile(path)
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		if e.Subject != "Packed" || e.BodyText != "Squeezed body text." {
+			t.Errorf("%s: subject %q, body %q", name, e.Subject, e.BodyText)
+		}
+		if e.Size != int64(len(compressedMsg)) {
+			t.Errorf("%s: size = %d, want the uncompressed %d", name, e.Size, len(compressedMsg))
+		}
+
+		fe, err := eml.ParseFileFull(path)
+		if err != nil {
+			t.Fatalf("%s full: %v", name, err)
+		}
+		if fe.Subject != "Packed" || fe.Size != int64(len(compressedMsg)) {
+			t.Errorf("%s full: subject %q, size %d", name, fe.Subject, fe.Size)
+		}
+
+		raw, err := eml.ReadFile(path)
+		if err != nil || string(raw) != compressedMsg {
+			t.Errorf("%s: ReadFile = %q, %v", name, raw, err)
+		}
+	}
+}
+
+func TestParseFile_CorruptCompressed(t *testing.T) {
+	path := writeTestEml(t, t.TempDir(), "a-1.eml.gz", compressedMsg)
+	if _, err := eml.ParseFile(path); err == nil {
+		t.Error("expected an error for a .gz file that is not gzip")
+	}
+}
+
+func TestIsEmailFile(t *testing.T) {
+	for name, want := range map[string]bool{
+		"a-1.eml":     true,
+		"A-1.EML.GZ":  true,
+		"a-1.eml.zst": true,
+		"a-1.gz":      false,
+		"a-1.eml.bz2": false,
+		"notes.txt":   false,
+	} {
+		if got := eml.IsEmailFile(name); got != want {
+			t.Errorf("IsEmailFile(%q) = %v, want %v", name, got, want)
+		}
+	}
+	if got := eml.PlainName("a-1.EML.GZ"); got != "a-1.EML" {
+		t.Errorf("PlainName = %q", got)
+	}
+}
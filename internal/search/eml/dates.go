@@ -0,0 +1,239 @@
+package eml
+
+import (
+	"bufio"
+	"bytes"
+	"log"
+	"net/mail"
+	"net/textproto"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// headerDate returns when a message was sent according to its headers:
+// the Date header (see ParseDate), else the most recent Received header.
+// Zero when neither parses.
+func headerDate(h mail.Header) time.Time {
+	date := ParseDate(h.Get("Date"))
+	if date.IsZero() {
+		date = parseReceivedDate(textproto.MIMEHeader(h))
+	}
+	return date
+}
+
+// dateLayouts are the non-standard layouts ParseDate tries after RFC 5322,
+// as seen in old or badly generated mail.
+var dateLayouts = []string{
+	time.RFC1123Z,
+	time.RFC1123,
+	"Mon, 2 Jan 2006 15:04:05 -0700 (MST)",
+	"Mon, 2 Jan 2006 15:04:05 -0700",
+	"Mon, 2 Jan 2006 15:04:05",
+	"Mon, 2 Jan 06 15:04:05 -0700",
+	"Mon, 2 Jan 06 15:04:05",
+	"2 Jan 2006 15:04:05 -0700",
+	"2 Jan 2006 15:04:05",
+	"2 Jan 06 15:04:05 -0700",
+	"2 Jan 06 15:04:05",
+	time.RFC822Z,
+	time.RFC822,
+	"Mon, 02 Jan 2006 15:04:05 -0700 (MST)",
+	"Mon, 02 Jan 2006 15:04:05 -0700",
+	"Mon, 02 Jan 2006 15:04:05",
+	time.ANSIC,
+	time.UnixDate,
+	"2006-01-02T15:04:05Z07:00",
+	"2006-01-02T15:04:05",
+	"2006-01-02 15:04:05",
+	"2006-01-02",
+	"02.01.2006 15:04:05",
+	"02.01.2006",
+	"01-02-2006",
+}
+
+// extraDateLayouts are tried after dateLayouts, from DATE_LAYOUTS: Go
+// time layouts separated by "|", for formats peculiar to one archive.
+var extraDateLayouts = dateLayoutsFromEnv()
+
+func dateLayoutsFromEnv() []string {
+	var layouts []string
+	for _, l := range strings.Split(os.Getenv("DATE_LAYOUTS"), "|") {
+		if l = strings.TrimSpace(l); l != "" {
+			layouts = append(layouts, l)
+		}
+	}
+	return layouts
+}
+
+// SetDateLayouts replaces the layouts ParseDate tries after its own. It is
+// not safe to call while emails are being parsed.
+func SetDateLayouts(layouts []string) {
+	extraDateLayouts = layouts
+}
+
+// monthNames maps localized month names and abbreviations, lower-cased
+// and without a trailing dot, to the English abbreviations Go parses.
+var monthNames = map[string]string{
+	// German
+	"januar": "Jan", "jänner": "Jan", "jän": "Jan", "februar": "Feb", "märz": "Mar", "mär": "Mar",
+	"mai": "May", "juni": "Jun", "juli": "Jul", "okt": "Oct", "oktober": "Oct", "dez": "Dec", "dezember": "Dec",
+	// French
+	"janvier": "Jan", "janv": "Jan", "février": "Feb", "févr": "Feb", "fév": "Feb", "mars": "Mar",
+	"avril": "Apr", "avr": "Apr", "juin": "Jun", "juillet": "Jul", "juil": "Jul", "août": "Aug",
+	"aoû": "Aug", "septembre": "Sep", "octobre": "Oct", "novembre": "Nov", "décembre": "Dec", "déc": "Dec",
+	// Spanish, Italian and Portuguese
+	"ene": "Jan", "enero": "Jan", "febrero": "Feb", "marzo": "Mar", "abr": "Apr", "abril": "Apr",
+	"mayo": "May", "junio": "Jun", "julio": "Jul", "ago": "Aug", "agosto": "Aug", "septiembre": "Sep",
+	"set": "Sep", "octubre": "Oct", "noviembre": "Nov", "dic": "Dec", "diciembre": "Dec",
+	"gen": "Jan", "gennaio": "Jan", "febbraio": "Feb", "aprile": "Apr", "maggio": "May", "mag": "May",
+	"giugno": "Jun", "giu": "Jun", "luglio": "Jul", "lug": "Jul", "settembre": "Sep", "ottobre": "Oct",
+	"ott": "Oct", "dicembre": "Dec", "fev": "Feb", "fevereiro": "Feb", "março": "Mar", "maio": "May",
+	"junho": "Jun", "julho": "Jul", "setembro": "Sep", "out": "Oct", "outubro": "Oct",
+	// Dutch
+	"januari": "Jan", "februari": "Feb", "maart": "Mar", "mei": "May", "augustus": "Aug",
+}
+
+// englishMonths turns the localized month name in raw into its English
+// abbreviation, drops the dot of a German "3." day, and drops a leading
+// weekday, which is then most likely localized too. It returns raw
+// unchanged when it has no such month.
+func englishMonths(raw string) string {
+	fields := strings.Fields(raw)
+	found := false
+	for i, f := range fields {
+		if m, ok := monthNames[strings.TrimSuffix(strings.ToLower(f), ".")]; ok {
+			fields[i] = m
+			found = true
+		} else if day, ok := strings.CutSuffix(f, "."); ok && len(day) <= 2 {
+			if _, err := strconv.Atoi(day); err == nil {
+				fields[i] = day
+			}
+		}
+	}
+	if !found {
+		return raw
+	}
+	if len(fields) > 0 && strings.HasSuffix(fields[0], ",") {
+		fields = fields[1:]
+	}
+	return strings.Join(fields, " ")
+}
+
+// Unix times ParseDate accepts as a Date header: 1980 to 2100.
+const (
+	minEpochDate = 315532800
+	maxEpochDate = 4102444800
+)
+
+// ParseDate parses a Date header: RFC 5322 first, then dateLayouts and
+// DATE_LAYOUTS, then those again with localized month names translated,
+// and finally a bare Unix time in seconds. Zero when nothing fits.
+func ParseDate(raw string) time.Time {
+	raw = strings.TrimSpace(raw)
+	if raw == "" {
+		return time.Time{}
+	}
+	if t, err := mail.ParseDate(raw); err == nil {
+		return t
+	}
+	if t := parseDateLayouts(raw); !t.IsZero() {
+		return t
+	}
+	if en := englishMonths(raw); en != raw {
+		if t, err := mail.ParseDate(en); err == nil {
+			return t
+		}
+		if t := parseDateLayouts(en); !t.IsZero() {
+			return t
+		}
+	}
+	if secs, err := strconv.ParseInt(raw, 10, 64); err == nil && secs >= minEpochDate && secs <= maxEpochDate {
+		return time.Unix(secs, 0).UTC()
+	}
+	return time.Time{}
+}
+
+// parseDateLayouts tries dateLayouts, then extraDateLayouts, on raw.
+func parseDateLayouts(raw string) time.Time {
+	for _, layouts := range [][]string{dateLayouts, extraDateLayouts} {
+		for _, layout := range layouts {
+			if t, err := time.Parse(layout, raw); err == nil {
+				return t
+			}
+		}
+	}
+	return time.Time{}
+}
+
+// FileDate reads only the headers of the .eml file at path and returns
+// its sent date (see headerDate), or zero when it cannot be determined.
+func FileDate(path string) time.Time {
+	f, _, err := openFile(path)
+	if err != nil {
+		return time.Time{}
+	}
+	defer f.Close()
+	msg, err := mail.ReadMessage(bufio.NewReader(f))
+	if err != nil {
+		return time.Time{}
+	}
+	return headerDate(msg.Header)
+}
+
+// HeaderDate returns the sent date of the message in data (see
+// headerDate), or zero when it cannot be determined.
+func HeaderDate(data []byte) time.Time {
+	msg, err := mail.ReadMessage(bytes.NewReader(data))
+	if err != nil {
+		return time.Time{}
+	}
+	return headerDate(msg.Header)
+}
+
+// FixDatesResult counts what FixDates did.
+type FixDatesResult struct {
+	Fixed   int `json:"fixed"`   // mtime set from the headers
+	Skipped int `json:"skipped"` // no usable date, or mtime already within a minute
+	Errors  int `json:"errors"`
+}
+
+// FixDates sets the mtime of every .eml file under root to its header date
+// (see FileDate), so file listings and date-based tools order mail by when
+// it was sent. onProgress, if set, is called every 1000 fixed files.
+func FixDates(root string, onProgress func(FixDatesResult)) (FixDatesResult, error) {
+	var res FixDatesResult
+	err := filepath.WalkDir(root, func(path string, d os.DirEntry, err error) error {
+		if err != nil || d.IsDir() || !IsEmailFile(d.Name()) {
+			return nil
+		}
+		date := FileDate(path)
+		if date.IsZero() {
+			res.Skipped++
+			return nil
+		}
+		info, err := d.Info()
+		if err != nil {
+			res.Errors++
+			return nil
+		}
+		// Only update if mtime differs by more than 1 minute.
+		if info.ModTime().Sub(date).Abs() < time.Minute {
+			res.Skipped++
+			return nil
+		}
+		if err := os.Chtimes(path, date, date); err != nil {
+			log.Printf("WARN: %s: %v", path, err)
+			res.Errors++
+			return nil
+		}
+		res.Fixed++
+		if onProgress != nil && res.Fixed%1000 == 0 {
+			onProgress(res)
+		}
+		return nil
+	})
+	return res, err
+}
@@ -0,0 +1,83 @@
+package eml
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestFixDates(t *testing.T) {
+	dir := t.TempDir()
+	write := func(name, content string) string {
+		t.Helper()
+		path := filepath.Join(dir, name)
+		if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		return path
+	}
+	dated := write("dated.eml", "Date: Mon, 10 Feb 2020 12:00:00 +0000\r\nSubject: x\r\n\r\nbody\r\n")
+	received := write("received.eml", "Received: from a by b; Tue, 11 Feb 2020 08:30:00 +0100\r\nSubject: y\r\n\r\nbody\r\n")
+	undated := write("undated.eml", "Subject: z\r\n\r\nbody\r\n")
+	write("notes.txt", "Date: Mon, 10 Feb 2020 12:00:00 +0000\r\n\r\n")
+
+	res, err := FixDates(dir, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res != (FixDatesResult{Fixed: 2, Skipped: 1}) {
+		t.Errorf("FixDates = %+v, want 2 fixed, 1 skipped", res)
+	}
+	for path, want := range map[string]time.Time{
+		dated:    time.Date(2020, 2, 10, 12, 0, 0, 0, time.UTC),
+		received: time.Date(2020, 2, 11, 7, 30, 0, 0, time.UTC),
+	} {
+		info, _ := os.Stat(path)
+		if !info.ModTime().Equal(want) {
+			t.Errorf("%s mtime = %v, want %v", filepath.Base(path), info.ModTime(), want)
+		}
+	}
+	if info, _ := os.Stat(undated); info.ModTime().Year() < 2024 {
+		t.Errorf("undated file mtime changed to %v", info.ModTime())
+	}
+
+	// A second run finds nothing to do.
+	if res, _ := FixDates(dir, nil); res.Fixed != 0 || res.Skipped != 3 {
+		t.Errorf("second FixDates = %+v, want all skipped", res)
+	}
+}
+
+func TestParseDate(t *testing.T) {
+	utc := func(y int, m time.Month, d, h, min int) time.Time { return time.Date(y, m, d, h, min, 0, 0, time.UTC) }
+	tests := []struct {
+		raw  string
+		want time.Time
+	}{
+		{"Mon, 10 Feb 2025 09:30:00 +0000", utc(2025, time.February, 10, 9, 30)},
+		{"10 Feb 2025 09:30:00", utc(2025, time.February, 10, 9, 30)},
+		{"Mon, 10 Feb 25 09:30:00 +0000", utc(2025, time.February, 10, 9, 30)},
+		{"Mon Feb 10 09:30:00 2025", utc(2025, time.February, 10, 9, 30)},
+		{"2025-02-10 09:30:00", utc(2025, time.February, 10, 9, 30)},
+		{"10.02.2025 09:30:00", utc(2025, time.February, 10, 9, 30)},
+		{"Mo, 3 Mär 2025 10:00:00 +0000", utc(2025, time.March, 3, 10, 0)},
+		{"Montag, 3. März 2025 10:00:00", utc(2025, time.March, 3, 10, 0)},
+		{"lun., 3 févr. 2025 10:00:00 +0000", utc(2025, time.February, 3, 10, 0)},
+		{"3 dic 2024 10:00:00", utc(2024, time.December, 3, 10, 0)},
+		{"1739179800", utc(2025, time.February, 10, 9, 30)},
+		{"42", time.Time{}},
+		{"not a date", time.Time{}},
+		{"", time.Time{}},
+	}
+	for _, tt := range tests {
+		if got := ParseDate(tt.raw); !got.Equal(tt.want) {
+			t.Errorf("ParseDate(%q) = %v, want %v", tt.raw, got, tt.want)
+		}
+	}
+
+	SetDateLayouts([]string{"2006/01/02 15h04"})
+	defer SetDateLayouts(nil)
+	if got := ParseDate("2025/02/10 09h30"); !got.Equal(utc(2025, time.February, 10, 9, 30)) {
+		t.Errorf("ParseDate with an extra layout = %v", got)
+	}
+}
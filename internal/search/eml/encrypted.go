@@ -0,0 +1,38 @@
+package eml
+
+import (
+	"mime"
+	"strings"
+)
+
+// Encryption types reported in Email.EncryptionType and
+// FullEmail.EncryptionType.
+const (
+	EncryptionPGP   = "pgp"   // PGP/MIME or an inline PGP message
+	EncryptionSMIME = "smime" // S/MIME enveloped data
+)
+
+// pgpArmor starts an ASCII-armoured PGP message.
+const pgpArmor = "-----BEGIN PGP MESSAGE-----"
+
+// encryption returns how a message is encrypted, from its top-level
+// Content-Type and the body text extracted from it, or "" when it is
+// readable. Signed-only messages are readable and return "".
+func encryption(contentType, bodyText string) string {
+	mediaType, params, err := mime.ParseMediaType(contentType)
+	if err == nil {
+		switch mediaType {
+		case "multipart/encrypted":
+			return EncryptionPGP
+		case "application/pkcs7-mime", "application/x-pkcs7-mime":
+			// smime-type is optional; only signed-data is readable.
+			if !strings.EqualFold(params["smime-type"], "signed-data") {
+				return EncryptionSMIME
+			}
+		}
+	}
+	if strings.HasPrefix(strings.TrimSpace(bodyText), pgpArmor) {
+		return EncryptionPGP
+	}
+	return ""
+}
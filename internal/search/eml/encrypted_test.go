@@ -0,0 +1,66 @@
+package eml_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/eslider/mails/internal/search/eml"
+)
+
+const pgpMIME = "From: a@test.com\r\nTo: b@test.com\r\nSubject: Secret plans\r\nMIME-Version: 1.0\r\n" +
+	"Content-Type: multipart/encrypted; protocol=\"application/pgp-encrypted\"; boundary=\"b1\"\r\n\r\n" +
+	"--b1\r\nContent-Type: application/pgp-encrypted\r\n\r\nVersion: 1\r\n" +
+	"--b1\r\nContent-Type: application/octet-stream; name=\"encrypted.asc\"\r\nContent-Disposition: inline; filename=\"encrypted.asc\"\r\n\r\n" +
+	"-----BEGIN PGP MESSAGE-----\r\n\r\nhQEMA8ZdGr2S5x4zAQf/bW9yZSBjaXBoZXJ0ZXh0\r\n-----END PGP MESSAGE-----\r\n" +
+	"--b1--\r\n"
+
+const smime = "From: a@test.com\r\nTo: b@test.com\r\nSubject: Payroll\r\nMIME-Version: 1.0\r\n" +
+	"Content-Type: application/pkcs7-mime; smime-type=enveloped-data; name=\"smime.p7m\"\r\n" +
+	"Content-Transfer-Encoding: base64\r\nContent-Disposition: attachment; filename=\"smime.p7m\"\r\n\r\n" +
+	"MIAGCSqGSIb3DQEHA6CAMIACAQAxggFAMIIBPAIBADCBpDCBnjELMAkGA1UEBhMCVVMx\r\n"
+
+const inlinePGP = "From: a@test.com\r\nTo: b@test.com\r\nSubject: Inline\r\nContent-Type: text/plain\r\n\r\n" +
+	"\r\n-----BEGIN PGP MESSAGE-----\r\n\r\nhQEMA8ZdGr2S5x4zAQf/bW9yZSBjaXBoZXJ0ZXh0\r\n-----END PGP MESSAGE-----\r\n"
+
+func TestParseEncrypted(t *testing.T) {
+	tests := []struct {
+		name, content, want string
+	}{
+		{"pgp-mime", pgpMIME, eml.EncryptionPGP},
+		{"smime", smime, eml.EncryptionSMIME},
+		{"inline-pgp", inlinePGP, eml.EncryptionPGP},
+		{"signed", strings.Replace(smime, "enveloped-data", "signed-data", 1), ""},
+		{"plain", "From: a@test.com\r\nSubject: Hi\r\n\r\nQuoting -----BEGIN PGP MESSAGE----- in text.\r\n", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			e, err := eml.ParseBytes("x.eml", []byte(tt.content))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if e.Encrypted != (tt.want != "") || e.EncryptionType != tt.want {
+				t.Errorf("Email encryption = %v %q, want %q", e.Encrypted, e.EncryptionType, tt.want)
+			}
+			if tt.want != "" && (e.BodyText != "" || e.Subject == "") {
+				t.Errorf("BodyText = %q, Subject = %q; want no body, the subject kept", e.BodyText, e.Subject)
+			}
+
+			fe, err := eml.ParseFileFullFromBytes("x.eml", []byte(tt.content))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if fe.Encrypted != (tt.want != "") || fe.EncryptionType != tt.want {
+				t.Errorf("FullEmail encryption = %v %q, want %q", fe.Encrypted, fe.EncryptionType, tt.want)
+			}
+			if tt.want != "" && (fe.TextBody != "" || fe.HTMLBody != "") {
+				t.Errorf("FullEmail body = %q / %q, want none", fe.TextBody, fe.HTMLBody)
+			}
+		})
+	}
+
+	// The file path parses the same way.
+	path := writeTestEml(t, t.TempDir(), "pgp.eml", pgpMIME)
+	if e, err := eml.ParseFile(path); err != nil || e.EncryptionType != eml.EncryptionPGP || strings.Contains(e.BodyText, "PGP") {
+		t.Errorf("ParseFile = %+v, %v; want PGP without ciphertext", e, err)
+	}
+}
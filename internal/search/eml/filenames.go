@@ -0,0 +1,93 @@
+package eml
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/eslider/mails/internal/checksum"
+)
+
+// MigrateFilenamesResult counts what MigrateFilenames did or, in a dry
+// run, would do.
+type MigrateFilenamesResult struct {
+	Renamed   int `json:"renamed"`
+	Conformed int `json:"conformed"` // already named {checksum}-{id}
+	Errors    int `json:"errors"`
+}
+
+// MigrateFilenames renames every email file under root whose name does not
+// start with a content checksum to {checksum}-{n}.eml, so checksum
+// deduplication covers files from readpst or other tools. The checksum is
+// of the message, read as ReadFile does, and a compression suffix is kept
+// ("x.eml.gz" becomes "{checksum}-1.eml.gz"). n is the lowest number free
+// in the directory, so messages stored twice keep both copies. Directories
+// starting with "." (such as verify's quarantine) are skipped.
+//
+// With dryRun nothing is renamed. onRename, if set, is called with the old
+// and new path of each file renamed, or that would be.
+func MigrateFilenames(root string, dryRun bool, onRename func(oldPath, newPath string)) (MigrateFilenamesResult, error) {
+	var res MigrateFilenamesResult
+	// taken holds the new names planned per directory, which a dry run
+	// does not create.
+	taken := make(map[string]bool)
+	err := filepath.WalkDir(root, func(path string, d os.DirEntry, err error) error {
+		if err != nil {
+			return nil
+		}
+		if d.IsDir() {
+			if path != root && strings.HasPrefix(d.Name(), ".") {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if !IsEmailFile(d.Name()) {
+			return nil
+		}
+		if checksum.FromName(d.Name()) != "" {
+			res.Conformed++
+			return nil
+		}
+		data, err := ReadFile(path)
+		if err != nil {
+			log.Printf("WARN: %s: %v", path, err)
+			res.Errors++
+			return nil
+		}
+		suffix := d.Name()[len(PlainName(d.Name())):]
+		dir := filepath.Dir(path)
+		sum := checksum.Sum(data)
+		var newPath string
+		for n := 1; ; n++ {
+			newPath = filepath.Join(dir, fmt.Sprintf("%s-%d.eml%s", sum, n, suffix))
+			if taken[newPath] {
+				continue
+			}
+			_, err := os.Lstat(newPath)
+			if os.IsNotExist(err) {
+				break
+			}
+			if err != nil {
+				log.Printf("WARN: %s: %v", newPath, err)
+				res.Errors++
+				return nil
+			}
+		}
+		if !dryRun {
+			if err := os.Rename(path, newPath); err != nil {
+				log.Printf("WARN: %s: %v", path, err)
+				res.Errors++
+				return nil
+			}
+		}
+		taken[newPath] = true
+		res.Renamed++
+		if onRename != nil {
+			onRename(path, newPath)
+		}
+		return nil
+	})
+	return res, err
+}
@@ -0,0 +1,78 @@
+package eml_test
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/eslider/mails/internal/checksum"
+	"github.com/eslider/mails/internal/search/eml"
+)
+
+func TestMigrateFilenames(t *testing.T) {
+	dir := t.TempDir()
+	other := "From: b@example.com\r\nSubject: Other\r\n\r\nDifferent body.\r\n"
+	sum := checksum.Sum([]byte(compressedMsg))
+	files := map[string][]byte{
+		"inbox/1.eml":               []byte(other),
+		"inbox/2.eml":               []byte(compressedMsg),
+		"inbox/3.eml":               []byte(compressedMsg), // same message twice
+		"inbox/4.eml.gz":            gzipBytes(t, []byte(compressedMsg)),
+		"inbox/" + sum + "-7.eml":   []byte(compressedMsg),
+		".quarantine/inbox/bad.eml": []byte(other),
+		"inbox/notes.txt":           []byte("not mail"),
+	}
+	for name, data := range files {
+		p := filepath.Join(dir, name)
+		os.MkdirAll(filepath.Dir(p), 0o755)
+		os.WriteFile(p, data, 0o644)
+	}
+	renames := map[string]string{}
+	res, err := eml.MigrateFilenames(dir, true, func(oldPath, newPath string) {
+		renames[filepath.Base(oldPath)] = filepath.Base(newPath)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]string{
+		"1.eml":    checksum.Sum([]byte(other)) + "-1.eml",
+		"2.eml":    sum + "-1.eml",
+		"3.eml":    sum + "-2.eml",
+		"4.eml.gz": sum + "-1.eml.gz",
+	}
+	if res.Renamed != 4 || res.Conformed != 1 || res.Errors != 0 {
+		t.Errorf("dry run = %+v, want 4 renamed, 1 conformed", res)
+	}
+	for old, name := range want {
+		if renames[old] != name {
+			t.Errorf("dry run renames %s to %q, want %q", old, renames[old], name)
+		}
+	}
+	if _, err := os.Stat(filepath.Join(dir, "inbox/2.eml")); err != nil {
+		t.Error("dry run renamed a file")
+	}
+
+	// A file taking a planned name moves the next one along.
+	os.WriteFile(filepath.Join(dir, "inbox", sum+"-1.eml.gz"), gzipBytes(t, []byte(compressedMsg)), 0o644)
+	want["4.eml.gz"] = sum + "-2.eml.gz"
+
+	res, err = eml.MigrateFilenames(dir, false, nil)
+	if err != nil || res.Renamed != 4 || res.Conformed != 2 {
+		t.Fatalf("apply = %+v, %v; want 4 renamed, 2 conformed", res, err)
+	}
+	for old, name := range want {
+		if _, err := os.Stat(filepath.Join(dir, "inbox", old)); !os.IsNotExist(err) {
+			t.Errorf("%s still there", old)
+		}
+		if data, err := eml.ReadFile(filepath.Join(dir, "inbox", name)); err != nil || len(data) == 0 {
+			t.Errorf("%s: %v", name, err)
+		}
+	}
+	if _, err := os.Stat(filepath.Join(dir, ".quarantine/inbox/bad.eml")); err != nil {
+		t.Error("quarantined file moved")
+	}
+
+	if res, _ := eml.MigrateFilenames(dir, false, nil); res.Renamed != 0 {
+		t.Errorf("second run renamed %d files, want 0", res.Renamed)
+	}
+}
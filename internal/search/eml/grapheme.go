@@ -0,0 +1,82 @@
+package eml
+
+import "unicode"
+
+// Snippets are cut at grapheme cluster boundaries, so an accent is never
+// separated from its letter or an emoji sequence (flags, skin tones, ZWJ
+// families) from its parts. The rules are the parts of UAX #29 that
+// matter for mail text; prepended marks and Indic conjuncts are not
+// handled.
+
+const zwj = '\u200d'
+
+func isRegionalIndicator(r rune) bool {
+	return r >= 0x1F1E6 && r <= 0x1F1FF
+}
+
+// isExtend reports whether r never starts a cluster: combining and spacing
+// marks, variation selectors, emoji skin-tone modifiers, tag characters
+// and the zero-width joiner.
+func isExtend(r rune) bool {
+	switch {
+	case r == zwj,
+		r >= 0xFE00 && r <= 0xFE0F,
+		r >= 0xE0100 && r <= 0xE01EF,
+		r >= 0x1F3FB && r <= 0x1F3FF,
+		r >= 0xE0020 && r <= 0xE007F:
+		return true
+	}
+	return unicode.In(r, unicode.Mn, unicode.Me, unicode.Mc)
+}
+
+// isHangulJamoTail reports whether r is a medial vowel or final consonant
+// jamo, which joins the syllable before it.
+func isHangulJamoTail(r rune) bool {
+	return r >= 0x1160 && r <= 0x11FF
+}
+
+func isHangul(r rune) bool {
+	return r >= 0x1100 && r <= 0x11FF || r >= 0xAC00 && r <= 0xD7A3
+}
+
+// isBoundary reports whether a grapheme cluster starts at runes[i].
+func isBoundary(runes []rune, i int) bool {
+	if i <= 0 || i >= len(runes) {
+		return true
+	}
+	prev, r := runes[i-1], runes[i]
+	switch {
+	case prev == '\r' && r == '\n':
+		return false
+	case isExtend(r):
+		return false
+	case prev == zwj:
+		return false
+	case isHangulJamoTail(r) && isHangul(prev):
+		return false
+	case isRegionalIndicator(prev) && isRegionalIndicator(r):
+		// Flags are pairs: break only after an even run of indicators.
+		n := 0
+		for j := i - 1; j >= 0 && isRegionalIndicator(runes[j]); j-- {
+			n++
+		}
+		return n%2 == 0
+	}
+	return true
+}
+
+// boundaryBefore returns the last cluster boundary at or before i.
+func boundaryBefore(runes []rune, i int) int {
+	for i > 0 && i < len(runes) && !isBoundary(runes, i) {
+		i--
+	}
+	return i
+}
+
+// boundaryAfter returns the first cluster boundary at or after i.
+func boundaryAfter(runes []rune, i int) int {
+	for i > 0 && i < len(runes) && !isBoundary(runes, i) {
+		i++
+	}
+	return i
+}
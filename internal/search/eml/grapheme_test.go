@@ -0,0 +1,30 @@
+package eml_test
+
+import (
+	"testing"
+
+	"github.com/eslider/mails/internal/search/eml"
+)
+
+func TestSnippet_GraphemeBoundaries(t *testing.T) {
+	tests := []struct {
+		name, body, query string
+		context           int
+		want              string
+	}{
+		{"skin tone at start", "👍🏽xq", "q", 2, "...xq"},
+		{"flag pair at end", "q🇩🇪🇫🇷", "q", 3, "q🇩🇪..."},
+		{"combining accent at start", "e\u0301q", "q", 1, "...q"},
+		{"match inside a cluster", "xxcafe\u0301 yy", "e", 0, "...e\u0301..."},
+		{"ZWJ family at end", "q\U0001F468\u200d\U0001F469\u200d\U0001F467", "q", 2, "q..."},
+		{"whole clusters fit", "👍🏽 q 🇩🇪", "q", 4, "👍🏽 q 🇩🇪"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := eml.Snippet(eml.Email{BodyText: tt.body}, tt.query, tt.context)
+			if got != tt.want {
+				t.Errorf("Snippet(%q, %q) = %q, want %q", tt.body, tt.query, got, tt.want)
+			}
+		})
+	}
+}
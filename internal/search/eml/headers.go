@@ -0,0 +1,68 @@
+package eml
+
+import (
+	"net/mail"
+	"net/textproto"
+	"os"
+	"strings"
+)
+
+// indexedHeaders are the canonical names of extra headers captured into
+// Email.Headers, from INDEX_HEADERS (e.g. "List-Id,X-Ticket-ID").
+var indexedHeaders = indexedHeadersFromEnv()
+
+// indexedHeadersFromEnv reads INDEX_HEADERS, a comma-separated list of
+// header names. Unset means no extra headers are captured.
+func indexedHeadersFromEnv() []string {
+	return canonicalHeaderNames(strings.Split(os.Getenv("INDEX_HEADERS"), ","))
+}
+
+// SetIndexedHeaders replaces the headers captured into Email.Headers.
+// It is not safe to call while emails are being parsed.
+func SetIndexedHeaders(names []string) {
+	indexedHeaders = canonicalHeaderNames(names)
+}
+
+func canonicalHeaderNames(names []string) []string {
+	var out []string
+	seen := make(map[string]bool)
+	for _, n := range names {
+		n = textproto.CanonicalMIMEHeaderKey(strings.TrimSpace(n))
+		if n == "" || seen[n] {
+			continue
+		}
+		seen[n] = true
+		out = append(out, n)
+	}
+	return out
+}
+
+// extraHeaders returns the decoded values of the configured headers that
+// are present in h, keyed by lower-case name. Repeated headers are joined
+// with newlines.
+func extraHeaders(h mail.Header) map[string]string {
+	if len(indexedHeaders) == 0 {
+		return nil
+	}
+	var out map[string]string
+	for _, name := range indexedHeaders {
+		values := h[name]
+		if len(values) == 0 {
+			continue
+		}
+		decoded := make([]string, 0, len(values))
+		for _, v := range values {
+			if v = ensureUTF8(strings.TrimSpace(decodeHeader(v))); v != "" {
+				decoded = append(decoded, v)
+			}
+		}
+		if len(decoded) == 0 {
+			continue
+		}
+		if out == nil {
+			out = make(map[string]string)
+		}
+		out[strings.ToLower(name)] = strings.Join(decoded, "\n")
+	}
+	return out
+}
@@ -0,0 +1,171 @@
+package eml
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"strings"
+	"time"
+)
+
+// maxInviteBytes caps how much of a text/calendar part is read.
+const maxInviteBytes = 1 << 20
+
+// Invite is a meeting invitation read from a text/calendar part: the
+// calendar's METHOD and its first VEVENT.
+type Invite struct {
+	Method      string     `json:"method,omitempty"` // REQUEST, CANCEL, REPLY, ...
+	UID         string     `json:"uid,omitempty"`
+	Summary     string     `json:"summary,omitempty"`
+	Description string     `json:"description,omitempty"`
+	Location    string     `json:"location,omitempty"`
+	Start       time.Time  `json:"start,omitzero"`
+	End         time.Time  `json:"end,omitzero"`
+	AllDay      bool       `json:"all_day,omitempty"`
+	Organizer   *Attendee  `json:"organizer,omitempty"`
+	Attendees   []Attendee `json:"attendees,omitempty"`
+}
+
+// Attendee is an ORGANIZER or ATTENDEE of an invite.
+type Attendee struct {
+	Name   string `json:"name,omitempty"`
+	Email  string `json:"email,omitempty"`
+	Status string `json:"status,omitempty"` // PARTSTAT: ACCEPTED, DECLINED, NEEDS-ACTION, ...
+}
+
+// ParseInvite reads the first VEVENT of an iCalendar (RFC 5545) document.
+// Times with a TZID the system does not know, such as Windows zone names,
+// are read as UTC.
+func ParseInvite(data []byte) (*Invite, error) {
+	var inv Invite
+	inEvent, found := false, false
+	for _, line := range unfoldICS(string(data)) {
+		name, params, value := splitICSLine(line)
+		switch {
+		case name == "METHOD" && !inEvent:
+			inv.Method = strings.ToUpper(value)
+		case name == "BEGIN" && strings.EqualFold(value, "VEVENT") && !found:
+			inEvent = true
+		case name == "END" && strings.EqualFold(value, "VEVENT") && inEvent:
+			inEvent, found = false, true
+		case !inEvent:
+		case name == "UID":
+			inv.UID = value
+		case name == "SUMMARY":
+			inv.Summary = unescapeICS(value)
+		case name == "DESCRIPTION":
+			inv.Description = unescapeICS(value)
+		case name == "LOCATION":
+			inv.Location = unescapeICS(value)
+		case name == "DTSTART":
+			inv.Start, inv.AllDay = parseICSTime(value, params)
+		case name == "DTEND":
+			inv.End, _ = parseICSTime(value, params)
+		case name == "ORGANIZER":
+			a := icsAttendee(value, params)
+			inv.Organizer = &a
+		case name == "ATTENDEE":
+			inv.Attendees = append(inv.Attendees, icsAttendee(value, params))
+		}
+	}
+	if !found {
+		return nil, errors.New("no VEVENT in calendar")
+	}
+	return &inv, nil
+}
+
+// parseInvitePart parses a decoded text/calendar part in the given
+// charset, returning nil when it holds no event.
+func parseInvitePart(data []byte, charset string) *Invite {
+	utf8Data, err := io.ReadAll(charsetReader(charset, bytes.NewReader(data)))
+	if err != nil {
+		return nil
+	}
+	inv, err := ParseInvite(utf8Data)
+	if err != nil {
+		return nil
+	}
+	return inv
+}
+
+// unfoldICS splits s into content lines, joining folded continuations
+// (lines starting with a space or tab).
+func unfoldICS(s string) []string {
+	var lines []string
+	for _, l := range strings.Split(strings.ReplaceAll(s, "\r\n", "\n"), "\n") {
+		if (strings.HasPrefix(l, " ") || strings.HasPrefix(l, "\t")) && len(lines) > 0 {
+			lines[len(lines)-1] += l[1:]
+			continue
+		}
+		if l != "" {
+			lines = append(lines, l)
+		}
+	}
+	return lines
+}
+
+// splitICSLine splits `NAME;PARAM=x;PARAM="y:z":value`. Parameter names
+// are upper-cased and quotes removed from their values.
+func splitICSLine(line string) (string, map[string]string, string) {
+	quoted := false
+	colon := -1
+	for i, r := range line {
+		if r == '"' {
+			quoted = !quoted
+		} else if r == ':' && !quoted {
+			colon = i
+			break
+		}
+	}
+	if colon < 0 {
+		return strings.ToUpper(line), nil, ""
+	}
+	head, value := line[:colon], line[colon+1:]
+	parts := strings.Split(head, ";")
+	params := make(map[string]string)
+	for _, p := range parts[1:] {
+		k, v, _ := strings.Cut(p, "=")
+		params[strings.ToUpper(k)] = strings.Trim(v, `"`)
+	}
+	return strings.ToUpper(parts[0]), params, value
+}
+
+func unescapeICS(s string) string {
+	return strings.NewReplacer(`\n`, "\n", `\N`, "\n", `\,`, ",", `\;`, ";", `\\`, `\`).Replace(s)
+}
+
+// parseICSTime parses a DATE-TIME or DATE value. The second result reports
+// a DATE, i.e. an all-day event.
+func parseICSTime(value string, params map[string]string) (time.Time, bool) {
+	if params["VALUE"] == "DATE" || len(value) == len("20060102") {
+		t, err := time.Parse("20060102", value)
+		if err != nil {
+			return time.Time{}, false
+		}
+		return t, true
+	}
+	if strings.HasSuffix(value, "Z") {
+		t, _ := time.Parse("20060102T150405Z", value)
+		return t, false
+	}
+	loc := time.UTC
+	if tz := params["TZID"]; tz != "" {
+		if l, err := time.LoadLocation(tz); err == nil {
+			loc = l
+		}
+	}
+	t, _ := time.ParseInLocation("20060102T150405", value, loc)
+	return t, false
+}
+
+func icsAttendee(value string, params map[string]string) Attendee {
+	email := value
+	if len(email) >= len("mailto:") && strings.EqualFold(email[:len("mailto:")], "mailto:") {
+		email = email[len("mailto:"):]
+	}
+	return Attendee{
+		Name:   unescapeICS(params["CN"]),
+		Email:  email,
+		Status: strings.ToUpper(params["PARTSTAT"]),
+	}
+}
@@ -0,0 +1,127 @@
+package eml_test
+
+import (
+	"testing"
+	"time"
+	_ "time/tzdata" // Europe/Berlin regardless of the host's zoneinfo
+
+	"github.com/eslider/mails/internal/search/eml"
+)
+
+const testInvite = "BEGIN:VCALENDAR\r\n" +
+	"VERSION:2.0\r\n" +
+	"METHOD:REQUEST\r\n" +
+	"BEGIN:VTIMEZONE\r\nTZID:Europe/Berlin\r\nEND:VTIMEZONE\r\n" +
+	"BEGIN:VEVENT\r\n" +
+	"UID:abc-123@example.com\r\n" +
+	"SUMMARY:Quarterly review\\, Q1\r\n" +
+	"DESCRIPTION:Agenda:\\n1. Numbers\\n2. Plans for a very long description that\r\n  gets folded\r\n" +
+	"LOCATION:Room 4\\; 2nd floor\r\n" +
+	"DTSTART;TZID=Europe/Berlin:20250210T100000\r\n" +
+	"DTEND;TZID=Europe/Berlin:20250210T113000\r\n" +
+	"ORGANIZER;CN=\"Smith, Alice\":mailto:alice@example.com\r\n" +
+	"ATTENDEE;CN=Bob;PARTSTAT=ACCEPTED;ROLE=REQ-PARTICIPANT:MAILTO:bob@example.com\r\n" +
+	"ATTENDEE;PARTSTAT=needs-action:mailto:carol@example.com\r\n" +
+	"END:VEVENT\r\n" +
+	"BEGIN:VEVENT\r\nSUMMARY:Second event\r\nEND:VEVENT\r\n" +
+	"END:VCALENDAR\r\n"
+
+func TestParseInvite(t *testing.T) {
+	inv, err := eml.ParseInvite([]byte(testInvite))
+	if err != nil {
+		t.Fatal(err)
+	}
+	berlin, _ := time.LoadLocation("Europe/Berlin")
+	if inv.Method != "REQUEST" || inv.UID != "abc-123@example.com" {
+		t.Errorf("method, uid = %q, %q", inv.Method, inv.UID)
+	}
+	if inv.Summary != "Quarterly review, Q1" {
+		t.Errorf("summary = %q", inv.Summary)
+	}
+	if want := "Agenda:\n1. Numbers\n2. Plans for a very long description that gets folded"; inv.Description != want {
+		t.Errorf("description = %q, want %q", inv.Description, want)
+	}
+	if inv.Location != "Room 4; 2nd floor" {
+		t.Errorf("location = %q", inv.Location)
+	}
+	if want := time.Date(2025, 2, 10, 10, 0, 0, 0, berlin); !inv.Start.Equal(want) || inv.AllDay {
+		t.Errorf("start = %v (all day %v), want %v", inv.Start, inv.AllDay, want)
+	}
+	if want := time.Date(2025, 2, 10, 10, 30, 0, 0, time.UTC); !inv.End.Equal(want) {
+		t.Errorf("end = %v, want %v", inv.End, want)
+	}
+	if inv.Organizer == nil || *inv.Organizer != (eml.Attendee{Name: "Smith, Alice", Email: "alice@example.com"}) {
+		t.Errorf("organizer = %+v", inv.Organizer)
+	}
+	want := []eml.Attendee{
+		{Name: "Bob", Email: "bob@example.com", Status: "ACCEPTED"},
+		{Email: "carol@example.com", Status: "NEEDS-ACTION"},
+	}
+	if len(inv.Attendees) != len(want) {
+		t.Fatalf("attendees = %+v", inv.Attendees)
+	}
+	for i := range want {
+		if inv.Attendees[i] != want[i] {
+			t.Errorf("attendee %d = %+v, want %+v", i, inv.Attendees[i], want[i])
+		}
+	}
+}
+
+func TestParseInviteTimes(t *testing.T) {
+	tests := []struct {
+		start      string
+		want       time.Time
+		wantAllDay bool
+	}{
+		{"DTSTART:20250210T090000Z", time.Date(2025, 2, 10, 9, 0, 0, 0, time.UTC), false},
+		{"DTSTART;VALUE=DATE:20250210", time.Date(2025, 2, 10, 0, 0, 0, 0, time.UTC), true},
+		// Unknown (Windows) zone names fall back to UTC.
+		{"DTSTART;TZID=W. Europe Standard Time:20250210T100000", time.Date(2025, 2, 10, 10, 0, 0, 0, time.UTC), false},
+	}
+	for _, tt := range tests {
+		inv, err := eml.ParseInvite([]byte("BEGIN:VCALENDAR\nBEGIN:VEVENT\n" + tt.start + "\nEND:VEVENT\nEND:VCALENDAR\n"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !inv.Start.Equal(tt.want) || inv.AllDay != tt.wantAllDay {
+			t.Errorf("%s: start = %v (all day %v), want %v (%v)", tt.start, inv.Start, inv.AllDay, tt.want, tt.wantAllDay)
+		}
+	}
+	if _, err := eml.ParseInvite([]byte("BEGIN:VCALENDAR\nEND:VCALENDAR\n")); err == nil {
+		t.Error("calendar without VEVENT should fail")
+	}
+}
+
+func TestParseFileFull_CalendarInvite(t *testing.T) {
+	inline := "From: alice@example.com\r\nSubject: Invitation: Quarterly review\r\nMIME-Version: 1.0\r\n" +
+		"Content-Type: multipart/alternative; boundary=alt\r\n\r\n" +
+		"--alt\r\nContent-Type: text/plain\r\n\r\nYou are invited.\r\n" +
+		"--alt\r\nContent-Type: text/calendar; method=REQUEST; charset=utf-8\r\n\r\n" + testInvite +
+		"--alt--\r\n"
+	fe, err := eml.ParseFileFullFromBytes("inline.eml", []byte(inline))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fe.Invite == nil || fe.Invite.Summary != "Quarterly review, Q1" {
+		t.Fatalf("invite = %+v", fe.Invite)
+	}
+	if fe.TextBody != "You are invited." || len(fe.Attachments) != 0 {
+		t.Errorf("text = %q, attachments = %v", fe.TextBody, fe.Attachments)
+	}
+
+	attached := "From: alice@example.com\r\nSubject: Meeting\r\nMIME-Version: 1.0\r\n" +
+		"Content-Type: multipart/mixed; boundary=mix\r\n\r\n" +
+		"--mix\r\nContent-Type: text/plain\r\n\r\nSee attached.\r\n" +
+		"--mix\r\nContent-Type: text/calendar; name=invite.ics\r\nContent-Disposition: attachment; filename=invite.ics\r\n\r\n" + testInvite +
+		"--mix--\r\n"
+	fe, err = eml.ParseFileFullFromBytes("attached.eml", []byte(attached))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fe.Invite == nil || fe.Invite.Method != "REQUEST" {
+		t.Errorf("invite = %+v", fe.Invite)
+	}
+	if len(fe.Attachments) != 1 || fe.Attachments[0].Filename != "invite.ics" || fe.Attachments[0].Size != len(testInvite)-len("\r\n") {
+		t.Errorf("attachments = %+v", fe.Attachments)
+	}
+}
@@ -0,0 +1,34 @@
+package eml
+
+import (
+	"strings"
+
+	"golang.org/x/text/unicode/norm"
+)
+
+// NormalizeText prepares text for substring search. It drops zero-width
+// characters and soft hyphens that marketing mail hides inside words, turns
+// no-break spaces into plain ones, collapses runs of spaces and tabs, and
+// applies Unicode NFC so composed and decomposed accents compare equal.
+// Line breaks are kept.
+func NormalizeText(s string) string {
+	s = norm.NFC.String(s)
+	var b strings.Builder
+	b.Grow(len(s))
+	space := false
+	for _, r := range s {
+		switch r {
+		case '\u200b', '\u200c', '\u200d', '\u2060', '\ufeff', '\u00ad': // zero-width, BOM, soft hyphen
+			continue
+		case ' ', '\t', '\u00a0', '\u2007', '\u202f': // no-break spaces
+			if !space {
+				b.WriteByte(' ')
+			}
+			space = true
+			continue
+		}
+		space = false
+		b.WriteRune(r)
+	}
+	return b.String()
+}
@@ -0,0 +1,43 @@
+package eml_test
+
+import (
+	"testing"
+
+	"github.com/eslider/mails/internal/search/eml"
+)
+
+func TestNormalizeText(t *testing.T) {
+	tests := []struct {
+		in, want string
+	}{
+		{"in\u200bvoice", "invoice"},
+		{"\ufeffHello", "Hello"},
+		{"re\u00adceipt zero\u200d\u200cwidth", "receipt zerowidth"},
+		{"pay\u00a0now", "pay now"},
+		{"a \u00a0 \t b", "a b"},
+		{"line one\r\nline two", "line one\r\nline two"},
+		{"cafe\u0301", "caf\u00e9"},
+		{"plain text", "plain text"},
+	}
+	for _, tt := range tests {
+		if got := eml.NormalizeText(tt.in); got != tt.want {
+			t.Errorf("NormalizeText(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestParseFile_NormalizesBodyAndSubject(t *testing.T) {
+	dir := t.TempDir()
+	path := writeTestEml(t, dir, "promo.eml", "From: shop@example.com\r\nSubject: =?utf-8?Q?Your_in=E2=80=8Bvoice?=\r\nContent-Type: text/plain; charset=utf-8\r\n\r\nPay\u00a0your in\u200bvoice today.\r\n")
+
+	e, err := eml.ParseFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if e.Subject != "Your invoice" {
+		t.Errorf("subject = %q, want %q", e.Subject, "Your invoice")
+	}
+	if e.BodyText != "Pay your invoice today." {
+		t.Errorf("body = %q", e.BodyText)
+	}
+}
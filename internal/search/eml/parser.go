@@ -25,6 +25,14 @@ import (
 // maxBodyBytes caps stored body text per email to avoid pathological memory use.
 const maxBodyBytes = 64 * 1024
 
+// maxEmbeddedDepth caps how deep message/rfc822 parts are parsed
+// (a forward of a forward of a forward ...).
+const maxEmbeddedDepth = 3
+
+// maxEmbeddedBytes caps the size of a message/rfc822 part that is parsed for
+// display. Larger forwards are still listed (and downloadable) as attachments.
+const maxEmbeddedBytes = 10 * 1024 * 1024
+
 // Email holds the parsed metadata and body text from a single .eml file.
 type Email struct {
 	Path    string    `json:"path"`
@@ -37,6 +45,50 @@ type Email struct {
 	// BodyText is the extracted plain text body, used for search.
 	// Hidden from JSON serialisation — callers add a snippet instead.
 	BodyText string `json:"-"`
+
+	// MessageID is the Message-ID header without angle brackets, used to
+	// fold copies of one message found in several folders.
+	MessageID string `json:"-"`
+
+	// References holds the Message-IDs of the messages this one replies
+	// to, from References and In-Reply-To, oldest first and without angle
+	// brackets. Index builds use them to group messages into threads.
+	References []string `json:"-"`
+
+	// AttachmentCount is the number of parts FullEmail would list as
+	// attachments.
+	AttachmentCount int `json:"attachment_count"`
+
+	// Headers holds the values of the headers named in INDEX_HEADERS,
+	// keyed by lower-case header name. Nil when none are configured or set.
+	Headers map[string]string `json:"-"`
+
+	// HTMLBody is the HTML body as FullEmail has it, set only when
+	// INDEX_HTML is on and it is at most maxIndexedHTML bytes.
+	HTMLBody string `json:"-"`
+
+	// AttachmentText is the text of the attachments an extractor handles
+	// (see RegisterExtractor), up to maxAttachmentText, set only when
+	// INDEX_ATTACHMENTS is on.
+	AttachmentText string `json:"-"`
+
+	// Encrypted is set for PGP and S/MIME encrypted messages, whose
+	// ciphertext is left out of BodyText so only the headers are indexed.
+	// EncryptionType is EncryptionPGP or EncryptionSMIME.
+	Encrypted      bool   `json:"-"`
+	EncryptionType string `json:"-"`
+}
+
+// maxIndexedHTML caps the HTML kept in Email.HTMLBody; larger bodies,
+// usually from embedded images, are left to be parsed from the file.
+const maxIndexedHTML = 1024 * 1024
+
+// indexedHTML returns fe's HTML body if it is small enough to index.
+func indexedHTML(fe FullEmail, err error) string {
+	if err != nil || len(fe.HTMLBody) > maxIndexedHTML {
+		return ""
+	}
+	return fe.HTMLBody
 }
 
 var decoder = &mime.WordDecoder{
@@ -62,51 +114,92 @@ func decodeHeader(raw string) string {
 	return decoded
 }
 
-// ParseFile reads an .eml file, extracts header metadata and body text.
+// ParseFile reads an .eml file (or a compressed .eml.gz or .eml.zst),
+// extracts header metadata and body text.
 func ParseFile(path string) (Email, error) {
-	f, err := os.Open(path)
+	f, compressed, err := openFile(path)
 	if err != nil {
-		return Email{}, fmt.Errorf("open %s: %w", path, err)
+		return Email{}, err
 	}
 	defer f.Close()
 
-	info, err := f.Stat()
+	info, err := os.Stat(path)
 	if err != nil {
 		return Email{}, fmt.Errorf("stat %s: %w", path, err)
 	}
 
-	msg, err := mail.ReadMessage(bufio.NewReader(f))
+	cr := &countingReader{r: f}
+	msg, err := mail.ReadMessage(bufio.NewReader(cr))
 	if err != nil {
 		return Email{}, fmt.Errorf("parse %s: %w", path, err)
 	}
 
 	h := msg.Header
-	date, _ := h.Date()
-	if date.IsZero() {
-		date = parseDateFuzzy(h.Get("Date"))
-	}
-	if date.IsZero() {
-		date = parseReceivedDate(textproto.MIMEHeader(h))
-	}
+	date := headerDate(h)
 	if date.IsZero() {
 		date = info.ModTime()
 	}
 
-	subject := ensureUTF8(strings.TrimSpace(decodeHeader(h.Get("Subject"))))
+	subject := NormalizeText(ensureUTF8(strings.TrimSpace(decodeHeader(h.Get("Subject")))))
 	from := ensureUTF8(strings.TrimSpace(decodeHeader(h.Get("From"))))
 	to := ensureUTF8(strings.TrimSpace(decodeHeader(h.Get("To"))))
 
-	bodyText := extractBodyText(h.Get("Content-Type"), h.Get("Content-Transfer-Encoding"), msg.Body)
+	var attText *attachmentText
+	if parseAttachments {
+		attText = &attachmentText{}
+	}
+	bodyText, attachments := extractBodyText(h.Get("Content-Type"), h.Get("Content-Transfer-Encoding"), msg.Body, attText)
+	enc := encryption(h.Get("Content-Type"), bodyText)
+	if enc != "" {
+		bodyText = ""
+	}
+	bodyText = NormalizeText(bodyText)
+
+	e := Email{
+		Path:       path,
+		Subject:    subject,
+		From:       from,
+		To:         to,
+		Date:       date,
+		Size:       messageSize(info, compressed, cr, msg.Body),
+		BodyText:   bodyText,
+		MessageID:  NormalizeMessageID(h.Get("Message-Id")),
+		References: ParseReferences(h.Get("References"), h.Get("In-Reply-To")),
+		Headers:    extraHeaders(h),
+
+		AttachmentCount: attachments,
+		AttachmentText:  NormalizeText(attText.String()),
+		Encrypted:       enc != "",
+		EncryptionType:  enc,
+	}
+	if parseHTML && enc == "" {
+		// A second pass, only paid for when the HTML is indexed.
+		e.HTMLBody = indexedHTML(ParseFileFull(path))
+	}
+	return e, nil
+}
 
-	return Email{
-		Path:     path,
-		Subject:  subject,
-		From:     from,
-		To:       to,
-		Date:     date,
-		Size:     info.Size(),
-		BodyText: bodyText,
-	}, nil
+// countingReader counts the bytes read through it.
+type countingReader struct {
+	r io.Reader
+	n int64
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	c.n += int64(n)
+	return n, err
+}
+
+// messageSize returns the size of the message read through cr: the file
+// size, or for a compressed or sealed file the plain size, which takes
+// reading the rest of body.
+func messageSize(info os.FileInfo, compressed bool, cr *countingReader, body io.Reader) int64 {
+	if !compressed {
+		return info.Size()
+	}
+	io.Copy(io.Discard, body)
+	return cr.n
 }
 
 // ParseBytes parses .eml content from bytes. path is the logical path for the result.
@@ -116,59 +209,79 @@ func ParseBytes(path string, data []byte) (Email, error) {
 		return Email{}, fmt.Errorf("parse: %w", err)
 	}
 	h := msg.Header
-	date, _ := h.Date()
-	if date.IsZero() {
-		date = parseDateFuzzy(h.Get("Date"))
-	}
-	if date.IsZero() {
-		date = parseReceivedDate(textproto.MIMEHeader(h))
-	}
-	subject := ensureUTF8(strings.TrimSpace(decodeHeader(h.Get("Subject"))))
+	date := headerDate(h)
+	subject := NormalizeText(ensureUTF8(strings.TrimSpace(decodeHeader(h.Get("Subject")))))
 	from := ensureUTF8(strings.TrimSpace(decodeHeader(h.Get("From"))))
 	to := ensureUTF8(strings.TrimSpace(decodeHeader(h.Get("To"))))
-	bodyText := extractBodyText(h.Get("Content-Type"), h.Get("Content-Transfer-Encoding"), msg.Body)
-	return Email{
-		Path:     path,
-		Subject:  subject,
-		From:     from,
-		To:       to,
-		Date:     date,
-		Size:     int64(len(data)),
-		BodyText: bodyText,
-	}, nil
-}
-
-// parseDateFuzzy tries multiple date layouts to handle non-standard Date headers
-// (e.g. missing timezone, unconventional formats).
-func parseDateFuzzy(raw string) time.Time {
-	raw = strings.TrimSpace(raw)
-	if raw == "" {
-		return time.Time{}
-	}
-	// Try common non-standard date formats.
-	for _, layout := range []string{
-		time.RFC1123Z,
-		time.RFC1123,
-		"Mon, 2 Jan 2006 15:04:05 -0700 (MST)",
-		"Mon, 2 Jan 2006 15:04:05 -0700",
-		"Mon, 2 Jan 2006 15:04:05",
-		"2 Jan 2006 15:04:05 -0700",
-		"2 Jan 2006 15:04:05",
-		time.RFC822Z,
-		time.RFC822,
-		"Mon, 02 Jan 2006 15:04:05 -0700 (MST)",
-		"Mon, 02 Jan 2006 15:04:05 -0700",
-		"Mon, 02 Jan 2006 15:04:05",
-		"2006-01-02T15:04:05Z07:00",
-		"2006-01-02T15:04:05",
-		"2006-01-02 15:04:05",
-		"01-02-2006",
-	} {
-		if t, err := time.Parse(layout, raw); err == nil {
-			return t
+	var attText *attachmentText
+	if parseAttachments {
+		attText = &attachmentText{}
+	}
+	bodyText, attachments := extractBodyText(h.Get("Content-Type"), h.Get("Content-Transfer-Encoding"), msg.Body, attText)
+	enc := encryption(h.Get("Content-Type"), bodyText)
+	if enc != "" {
+		bodyText = ""
+	}
+	bodyText = NormalizeText(bodyText)
+	e := Email{
+		Path:       path,
+		Subject:    subject,
+		From:       from,
+		To:         to,
+		Date:       date,
+		Size:       int64(len(data)),
+		BodyText:   bodyText,
+		MessageID:  NormalizeMessageID(h.Get("Message-Id")),
+		References: ParseReferences(h.Get("References"), h.Get("In-Reply-To")),
+		Headers:    extraHeaders(h),
+
+		AttachmentCount: attachments,
+		AttachmentText:  NormalizeText(attText.String()),
+		Encrypted:       enc != "",
+		EncryptionType:  enc,
+	}
+	if parseHTML && enc == "" {
+		e.HTMLBody = indexedHTML(ParseFileFullFromBytes(path, data))
+	}
+	return e, nil
+}
+
+// NormalizeMessageID trims whitespace and the surrounding angle brackets
+// from a Message-ID header value.
+func NormalizeMessageID(raw string) string {
+	id := strings.TrimSpace(raw)
+	id = strings.TrimPrefix(id, "<")
+	id = strings.TrimSuffix(id, ">")
+	return strings.TrimSpace(id)
+}
+
+// reMessageID matches one <id> in a References or In-Reply-To header.
+var reMessageID = regexp.MustCompile(`<([^<>\s]+)>`)
+
+// ParseReferences returns the Message-IDs in a References header followed
+// by those of In-Reply-To not already listed, without angle brackets.
+// Headers without brackets, as some clients write them, are split on
+// whitespace.
+func ParseReferences(references, inReplyTo string) []string {
+	var ids []string
+	seen := make(map[string]bool)
+	for _, raw := range []string{references, inReplyTo} {
+		found := reMessageID.FindAllStringSubmatch(raw, -1)
+		var candidates []string
+		for _, m := range found {
+			candidates = append(candidates, m[1])
+		}
+		if len(found) == 0 {
+			candidates = strings.Fields(raw)
+		}
+		for _, id := range candidates {
+			if id = NormalizeMessageID(id); id != "" && !seen[id] {
+				seen[id] = true
+				ids = append(ids, id)
+			}
 		}
 	}
-	return time.Time{}
+	return ids
 }
 
 // parseReceivedDate extracts the date from the first (most recent) Received header.
@@ -184,56 +297,52 @@ func parseReceivedDate(h textproto.MIMEHeader) time.Time {
 		if idx < 0 {
 			continue
 		}
-		dateStr := strings.TrimSpace(r[idx+1:])
-		for _, layout := range []string{
-			time.RFC1123Z,
-			time.RFC1123,
-			"Mon, 2 Jan 2006 15:04:05 -0700 (MST)",
-			"Mon, 2 Jan 2006 15:04:05 -0700",
-			"2 Jan 2006 15:04:05 -0700",
-			time.RFC822Z,
-			time.RFC822,
-		} {
-			if t, err := time.Parse(layout, dateStr); err == nil {
-				return t
-			}
+		if t := parseReceivedTimestamp(r[idx+1:]); !t.IsZero() {
+			return t
 		}
 	}
 	return time.Time{}
 }
 
 // extractBodyText walks the MIME structure and returns the first usable
-// plain text body. Falls back to stripped HTML if no text/plain part exists.
-func extractBodyText(contentType, transferEncoding string, body io.Reader) string {
+// plain text body and the number of attachments. Falls back to stripped HTML
+// if no text/plain part exists.
+func extractBodyText(contentType, transferEncoding string, body io.Reader, att *attachmentText) (string, int) {
 	if contentType == "" {
 		contentType = "text/plain"
 	}
 	mediaType, params, err := mime.ParseMediaType(contentType)
 	if err != nil {
-		return readLimited(body, transferEncoding, "")
+		return readLimited(body, transferEncoding, ""), 0
 	}
 
 	charset := params["charset"]
 
 	if strings.HasPrefix(mediaType, "multipart/") {
-		return extractFromMultipart(params["boundary"], body)
+		return extractFromMultipart(params["boundary"], body, att)
+	}
+	if !parseBody {
+		return "", 0
 	}
 
 	raw := readLimited(body, transferEncoding, charset)
 	if mediaType == "text/html" {
-		return stripHTML(raw)
+		return stripHTML(raw), 0
 	}
-	return raw
+	return raw, 0
 }
 
-// extractFromMultipart recursively walks multipart MIME parts.
-func extractFromMultipart(boundary string, r io.Reader) string {
+// extractFromMultipart recursively walks multipart MIME parts. It reads
+// every part so attachments are counted even after the body is found, and
+// hands attachments to att.
+func extractFromMultipart(boundary string, r io.Reader, att *attachmentText) (string, int) {
 	if boundary == "" {
-		return ""
+		return "", 0
 	}
 	mr := multipart.NewReader(r, boundary)
 
-	var htmlFallback string
+	var text, htmlFallback string
+	attachments := 0
 
 	for {
 		part, err := mr.NextPart()
@@ -253,32 +362,55 @@ func extractFromMultipart(boundary string, r io.Reader) string {
 
 		charset := partParams["charset"]
 
+		if isAttachmentPart(part, partMedia) {
+			attachments++
+			att.add(part, cte, partMedia, part.FileName())
+			part.Close()
+			continue
+		}
+
 		if strings.HasPrefix(partMedia, "multipart/") {
-			if text := extractFromMultipart(partParams["boundary"], part); text != "" {
-				part.Close()
-				return text
+			nested, n := extractFromMultipart(partParams["boundary"], part, att)
+			attachments += n
+			if text == "" {
+				text = nested
 			}
 			part.Close()
 			continue
 		}
 
-		if partMedia == "text/plain" {
-			text := readLimited(part, cte, charset)
+		if !parseBody {
 			part.Close()
-			if text != "" {
-				return text
-			}
 			continue
 		}
 
-		if partMedia == "text/html" && htmlFallback == "" {
+		if partMedia == "text/plain" && text == "" {
+			text = readLimited(part, cte, charset)
+			part.Close()
+			continue
+		}
+
+		if partMedia == "text/html" && text == "" && htmlFallback == "" {
 			htmlFallback = stripHTML(readLimited(part, cte, charset))
 		}
 
 		part.Close()
 	}
 
-	return htmlFallback
+	if text == "" {
+		text = htmlFallback
+	}
+	return text, attachments
+}
+
+// isAttachmentPart reports whether a part is listed as an attachment.
+// Inline parts with a Content-ID (cid:) are embedded images, not attachments.
+func isAttachmentPart(part *multipart.Part, partMedia string) bool {
+	disposition := strings.ToLower(part.Header.Get("Content-Disposition"))
+	contentID := strings.TrimSpace(part.Header.Get("Content-ID"))
+	isInlineWithCID := contentID != "" && strings.HasPrefix(disposition, "inline")
+	return !isInlineWithCID && (strings.HasPrefix(disposition, "attachment") ||
+		(part.FileName() != "" && !strings.HasPrefix(partMedia, "text/")))
 }
 
 // readLimited reads up to maxBodyBytes from r, applying transfer-encoding and charset decoding.
@@ -392,7 +524,11 @@ func rewriteCIDsInHTML(html string, inline map[string]inlinePart) string {
 type Attachment struct {
 	Filename    string `json:"filename"`
 	ContentType string `json:"content_type"`
-	Size        int    `json:"size"`
+	Size        int    `json:"size"` // decoded size in bytes
+
+	// Truncated is set by the server when Size exceeds its attachment limit,
+	// so downloads stop at the limit.
+	Truncated bool `json:"truncated,omitempty"`
 }
 
 // inlinePart holds data for a Content-ID referenced part (e.g. inline image).
@@ -414,34 +550,51 @@ type FullEmail struct {
 	TextBody    string       `json:"text_body"`
 	HTMLBody    string       `json:"html_body,omitempty"`
 	Attachments []Attachment `json:"attachments,omitempty"`
+
+	// Embedded holds messages forwarded as message/rfc822 parts.
+	Embedded []FullEmail `json:"embedded,omitempty"`
+
+	// Received is the delivery chain of the top-level message, origin first.
+	Received []ReceivedHop `json:"received,omitempty"`
+
+	// Invite is the meeting invitation of the first text/calendar part.
+	Invite *Invite `json:"invite,omitempty"`
+
+	// Encrypted is set for PGP and S/MIME encrypted messages; their
+	// bodies are left empty rather than showing ciphertext.
+	Encrypted      bool   `json:"encrypted,omitempty"`
+	EncryptionType string `json:"encryption_type,omitempty"`
+
+	// Flagged and Starred are the user's marks, and VFolder the virtual
+	// folder they moved the email to (see package annotation), set by
+	// callers that have them.
+	Flagged bool   `json:"flagged,omitempty"`
+	Starred bool   `json:"starred,omitempty"`
+	VFolder string `json:"vfolder,omitempty"`
 }
 
-// ParseFileFull reads an .eml and returns complete content for preview.
+// ParseFileFull reads an .eml (or a compressed one, as ParseFile does) and
+// returns complete content for preview.
 func ParseFileFull(path string) (FullEmail, error) {
-	f, err := os.Open(path)
+	f, compressed, err := openFile(path)
 	if err != nil {
-		return FullEmail{}, fmt.Errorf("open %s: %w", path, err)
+		return FullEmail{}, err
 	}
 	defer f.Close()
 
-	info, err := f.Stat()
+	info, err := os.Stat(path)
 	if err != nil {
 		return FullEmail{}, fmt.Errorf("stat %s: %w", path, err)
 	}
 
-	msg, err := mail.ReadMessage(bufio.NewReader(f))
+	cr := &countingReader{r: f}
+	msg, err := mail.ReadMessage(bufio.NewReader(cr))
 	if err != nil {
 		return FullEmail{}, fmt.Errorf("parse %s: %w", path, err)
 	}
 
 	h := msg.Header
-	date, _ := h.Date()
-	if date.IsZero() {
-		date = parseDateFuzzy(h.Get("Date"))
-	}
-	if date.IsZero() {
-		date = parseReceivedDate(textproto.MIMEHeader(h))
-	}
+	date := headerDate(h)
 	if date.IsZero() {
 		date = info.ModTime()
 	}
@@ -454,30 +607,29 @@ func ParseFileFull(path string) (FullEmail, error) {
 		CC:      ensureUTF8(strings.TrimSpace(decodeHeader(h.Get("Cc")))),
 		ReplyTo: ensureUTF8(strings.TrimSpace(decodeHeader(h.Get("Reply-To")))),
 		Date:    date,
-		Size:    info.Size(),
 	}
 
 	ct := h.Get("Content-Type")
 	cte := h.Get("Content-Transfer-Encoding")
-	extractFullBody(ct, cte, msg.Body, &fe)
+	extractFullBody(ct, cte, msg.Body, &fe, 0)
+	fe.Size = messageSize(info, compressed, cr, msg.Body)
 
 	return fe, nil
 }
 
 // ParseFileFullFromBytes parses .eml content from bytes. path is the logical path for the result.
 func ParseFileFullFromBytes(path string, data []byte) (FullEmail, error) {
+	return parseFullBytes(path, data, 0)
+}
+
+// parseFullBytes parses a message at the given message/rfc822 nesting depth.
+func parseFullBytes(path string, data []byte, depth int) (FullEmail, error) {
 	msg, err := mail.ReadMessage(bytes.NewReader(data))
 	if err != nil {
 		return FullEmail{}, fmt.Errorf("parse: %w", err)
 	}
 	h := msg.Header
-	date, _ := h.Date()
-	if date.IsZero() {
-		date = parseDateFuzzy(h.Get("Date"))
-	}
-	if date.IsZero() {
-		date = parseReceivedDate(textproto.MIMEHeader(h))
-	}
+	date := headerDate(h)
 	fe := FullEmail{
 		Path:    path,
 		Subject: ensureUTF8(strings.TrimSpace(decodeHeader(h.Get("Subject")))),
@@ -488,16 +640,25 @@ func ParseFileFullFromBytes(path string, data []byte) (FullEmail, error) {
 		Date:    date,
 		Size:    int64(len(data)),
 	}
+	if depth == 0 {
+		fe.Received = ParseReceivedChain(textproto.MIMEHeader(h))
+	}
 	ct := h.Get("Content-Type")
 	cte := h.Get("Content-Transfer-Encoding")
-	extractFullBody(ct, cte, msg.Body, &fe)
+	extractFullBody(ct, cte, msg.Body, &fe, depth)
 	return fe, nil
 }
 
-func extractFullBody(contentType, transferEncoding string, body io.Reader, fe *FullEmail) {
+func extractFullBody(contentType, transferEncoding string, body io.Reader, fe *FullEmail, depth int) {
 	if contentType == "" {
 		contentType = "text/plain"
 	}
+	defer func() {
+		if enc := encryption(contentType, fe.TextBody); enc != "" {
+			fe.Encrypted, fe.EncryptionType = true, enc
+			fe.TextBody, fe.HTMLBody = "", ""
+		}
+	}()
 	mediaType, params, err := mime.ParseMediaType(contentType)
 	if err != nil {
 		fe.TextBody = readLimited(body, transferEncoding, "")
@@ -508,13 +669,19 @@ func extractFullBody(contentType, transferEncoding string, body io.Reader, fe *F
 
 	if strings.HasPrefix(mediaType, "multipart/") {
 		inlineParts := make(map[string]inlinePart)
-		extractFullMultipart(params["boundary"], body, fe, inlineParts)
+		extractFullMultipart(params["boundary"], body, fe, inlineParts, depth)
 		if fe.HTMLBody != "" && len(inlineParts) > 0 {
 			fe.HTMLBody = rewriteCIDsInHTML(fe.HTMLBody, inlineParts)
 		}
 		return
 	}
 
+	if mediaType == "text/calendar" {
+		fe.TextBody = readLimited(body, transferEncoding, charset)
+		fe.Invite = parseInvitePart([]byte(fe.TextBody), "")
+		return
+	}
+
 	raw := readLimited(body, transferEncoding, charset)
 	if mediaType == "text/html" {
 		fe.HTMLBody = raw
@@ -524,7 +691,7 @@ func extractFullBody(contentType, transferEncoding string, body io.Reader, fe *F
 	}
 }
 
-func extractFullMultipart(boundary string, r io.Reader, fe *FullEmail, inlineParts map[string]inlinePart) {
+func extractFullMultipart(boundary string, r io.Reader, fe *FullEmail, inlineParts map[string]inlinePart, depth int) {
 	if boundary == "" {
 		return
 	}
@@ -549,26 +716,66 @@ func extractFullMultipart(boundary string, r io.Reader, fe *FullEmail, inlinePar
 
 		charset := partParams["charset"]
 
-		disposition := strings.ToLower(part.Header.Get("Content-Disposition"))
-		contentID := strings.TrimSpace(part.Header.Get("Content-ID"))
-		// Inline parts with Content-ID (cid:) are embedded images, not attachments.
-		isInlineWithCID := contentID != "" && strings.HasPrefix(disposition, "inline")
-		isAttachment := !isInlineWithCID && (strings.HasPrefix(disposition, "attachment") ||
-			(part.FileName() != "" && !strings.HasPrefix(partMedia, "text/")))
+		isAttachment := isAttachmentPart(part, partMedia)
+
+		// Forwarded message: parse it so the UI can show it inline. It stays
+		// in Attachments as well when it has a filename, so downloads by
+		// index keep working.
+		if partMedia == "message/rfc822" && depth < maxEmbeddedDepth {
+			decoded := decodeTransferEncoding(part, cte)
+			data, _ := io.ReadAll(io.LimitReader(decoded, maxEmbeddedBytes+1))
+			rest, _ := io.Copy(io.Discard, decoded)
+			if len(data) <= maxEmbeddedBytes {
+				if embedded, err := parseFullBytes("", data, depth+1); err == nil {
+					fe.Embedded = append(fe.Embedded, embedded)
+				}
+			}
+			if isAttachment {
+				fe.Attachments = append(fe.Attachments, Attachment{
+					Filename:    ensureUTF8(decodeHeader(part.FileName())),
+					ContentType: partMedia,
+					Size:        len(data) + int(rest),
+				})
+			}
+			part.Close()
+			continue
+		}
+
+		// Meeting invite: parse the first one whether it is sent inline or
+		// attached as an .ics file, which stays listed as an attachment.
+		if partMedia == "text/calendar" {
+			decoded := decodeTransferEncoding(part, cte)
+			data, _ := io.ReadAll(io.LimitReader(decoded, maxInviteBytes))
+			rest, _ := io.Copy(io.Discard, decoded)
+			if fe.Invite == nil {
+				fe.Invite = parseInvitePart(data, charset)
+			}
+			if isAttachment {
+				fe.Attachments = append(fe.Attachments, Attachment{
+					Filename:    ensureUTF8(decodeHeader(part.FileName())),
+					ContentType: partMedia,
+					Size:        len(data) + int(rest),
+				})
+			}
+			part.Close()
+			continue
+		}
 
 		if isAttachment {
-			data, _ := io.ReadAll(io.LimitReader(part, 10*1024*1024))
+			// Count the decoded bytes without holding them, so the listing
+			// reports the true size however large the part is.
+			n, _ := io.Copy(io.Discard, decodeTransferEncoding(part, cte))
 			fe.Attachments = append(fe.Attachments, Attachment{
 				Filename:    ensureUTF8(decodeHeader(part.FileName())),
 				ContentType: partMedia,
-				Size:        len(data),
+				Size:        int(n),
 			})
 			part.Close()
 			continue
 		}
 
 		if strings.HasPrefix(partMedia, "multipart/") {
-			extractFullMultipart(partParams["boundary"], part, fe, inlineParts)
+			extractFullMultipart(partParams["boundary"], part, fe, inlineParts, depth)
 			part.Close()
 			continue
 		}
@@ -589,7 +796,7 @@ func extractFullMultipart(boundary string, r io.Reader, fe *FullEmail, inlinePar
 		}
 
 		// Inline part with Content-ID (e.g. embedded image referenced by cid: in HTML).
-		if contentID != "" {
+		if contentID := strings.TrimSpace(part.Header.Get("Content-ID")); contentID != "" {
 			data, _ := io.ReadAll(io.LimitReader(decodeTransferEncoding(part, cte), 5*1024*1024))
 			cid := normalizeCID(contentID)
 			if cid != "" {
@@ -608,9 +815,9 @@ func ExtractPartByCID(path string, cid string) ([]byte, string, error) {
 	if cid == "" {
 		return nil, "", fmt.Errorf("empty content-id")
 	}
-	f, err := os.Open(path)
+	f, _, err := openFile(path)
 	if err != nil {
-		return nil, "", fmt.Errorf("open %s: %w", path, err)
+		return nil, "", err
 	}
 	defer f.Close()
 
@@ -682,7 +889,7 @@ func extractPartByCID(mr *multipart.Reader, targetCID string, outData *[]byte, o
 // ExtractAttachment reads the Nth attachment (0-based index) from an .eml file.
 // Returns the raw bytes, content-type, filename, and any error.
 func ExtractAttachment(path string, index int) ([]byte, string, string, error) {
-	data, err := os.ReadFile(path)
+	data, err := ReadFile(path)
 	if err != nil {
 		return nil, "", "", fmt.Errorf("open %s: %w", path, err)
 	}
@@ -691,6 +898,21 @@ func ExtractAttachment(path string, index int) ([]byte, string, string, error) {
 
 // ExtractAttachmentFromBytes extracts the Nth attachment from .eml content.
 func ExtractAttachmentFromBytes(data []byte, index int) ([]byte, string, string, error) {
+	r, contentType, filename, err := OpenAttachmentFromBytes(data, index)
+	if err != nil {
+		return nil, "", "", err
+	}
+	out, err := io.ReadAll(r)
+	if err != nil {
+		return nil, "", "", fmt.Errorf("read attachment %d: %w", index, err)
+	}
+	return out, contentType, filename, nil
+}
+
+// OpenAttachmentFromBytes returns a reader over the decoded Nth attachment
+// of .eml content, so callers can stream it without buffering. The reader
+// is valid as long as data is.
+func OpenAttachmentFromBytes(data []byte, index int) (io.Reader, string, string, error) {
 	msg, err := mail.ReadMessage(bytes.NewReader(data))
 	if err != nil {
 		return nil, "", "", fmt.Errorf("parse: %w", err)
@@ -712,22 +934,22 @@ func ExtractAttachmentFromBytes(data []byte, index int) ([]byte, string, string,
 		return nil, "", "", fmt.Errorf("multipart missing boundary")
 	}
 
-	var outData []byte
-	var contentType, filename string
-	var found bool
 	var idx int
-	extractPartByIndex(multipart.NewReader(msg.Body, boundary), index, &idx, &outData, &contentType, &filename, &found)
+	r, contentType, filename, found := findPartByIndex(multipart.NewReader(msg.Body, boundary), index, &idx)
 	if !found {
 		return nil, "", "", fmt.Errorf("attachment index %d out of range", index)
 	}
-	return outData, contentType, filename, nil
+	return r, contentType, filename, nil
 }
 
-func extractPartByIndex(mr *multipart.Reader, targetIndex int, currentIndex *int, outData *[]byte, outContentType, outFilename *string, found *bool) {
+// findPartByIndex walks attachments depth-first, counting them in
+// currentIndex, and returns the decoded body of the targetIndex-th one.
+// The matching part is left open for the caller to read.
+func findPartByIndex(mr *multipart.Reader, targetIndex int, currentIndex *int) (io.Reader, string, string, bool) {
 	for {
 		part, err := mr.NextPart()
 		if err != nil {
-			break
+			return nil, "", "", false
 		}
 		ct := part.Header.Get("Content-Type")
 		cte := part.Header.Get("Content-Transfer-Encoding")
@@ -741,17 +963,7 @@ func extractPartByIndex(mr *multipart.Reader, targetIndex int, currentIndex *int
 
 		if isAttachment {
 			if *currentIndex == targetIndex {
-				decoded := decodeTransferEncoding(part, cte)
-				data, readErr := io.ReadAll(io.LimitReader(decoded, 50*1024*1024))
-				part.Close()
-				if readErr != nil {
-					return
-				}
-				*outData = data
-				*outContentType = partMedia
-				*outFilename = ensureUTF8(decodeHeader(part.FileName()))
-				*found = true
-				return
+				return decodeTransferEncoding(part, cte), partMedia, ensureUTF8(decodeHeader(part.FileName())), true
 			}
 			*currentIndex++
 			part.Close()
@@ -759,38 +971,73 @@ func extractPartByIndex(mr *multipart.Reader, targetIndex int, currentIndex *int
 		}
 
 		if strings.HasPrefix(partMedia, "multipart/") && partParams["boundary"] != "" {
-			extractPartByIndex(multipart.NewReader(part, partParams["boundary"]), targetIndex, currentIndex, outData, outContentType, outFilename, found)
-			part.Close()
-			if *found {
-				return
+			if r, ct, name, ok := findPartByIndex(multipart.NewReader(part, partParams["boundary"]), targetIndex, currentIndex); ok {
+				return r, ct, name, true
 			}
+			part.Close()
 			continue
 		}
 		part.Close()
 	}
 }
 
-// Snippet returns a short context window around the first occurrence of query.
+// SnippetSource selects which field Snippet looks in first.
+type SnippetSource int
+
+const (
+	// SnippetSubjectFirst uses the subject match unless the window would
+	// just repeat the whole subject and the body matches too.
+	SnippetSubjectFirst SnippetSource = iota
+	// SnippetBodyFirst uses the body match when there is one.
+	SnippetBodyFirst
+)
+
+// Snippet returns a short context window around the first occurrence of
+// query, preferring the subject (see SnippetSubjectFirst).
 func Snippet(e Email, query string, contextLen int) string {
+	return SnippetFrom(e, query, contextLen, SnippetSubjectFirst)
+}
+
+// SnippetFrom is Snippet with a choice of which field to try first.
+func SnippetFrom(e Email, query string, contextLen int, prefer SnippetSource) string {
 	q := strings.ToLower(query)
 	if q == "" {
 		return ""
 	}
-
-	subjectRunes := []rune(strings.ToLower(e.Subject))
 	queryRunes := []rune(q)
-	if idx := runeIndex(subjectRunes, queryRunes); idx >= 0 {
-		return buildSnippet([]rune(e.Subject), idx, len(queryRunes), contextLen)
-	}
 
-	bodyRunes := []rune(strings.ToLower(e.BodyText))
-	if idx := runeIndex(bodyRunes, queryRunes); idx >= 0 {
-		return buildSnippet([]rune(e.BodyText), idx, len(queryRunes), contextLen)
+	subject := []rune(e.Subject)
+	subjectIdx := runeIndex([]rune(strings.ToLower(e.Subject)), queryRunes)
+	body := []rune(e.BodyText)
+	bodyIdx := runeIndex([]rune(strings.ToLower(e.BodyText)), queryRunes)
+
+	if subjectIdx >= 0 && (bodyIdx < 0 || prefer == SnippetSubjectFirst) {
+		// A window over the entire subject only repeats the title shown
+		// next to it; the body says more when it matches too.
+		wholeSubject := subjectIdx <= contextLen && len(subject)-subjectIdx-len(queryRunes) <= contextLen
+		if bodyIdx < 0 || !wholeSubject {
+			return buildSnippet(subject, subjectIdx, len(queryRunes), contextLen)
+		}
+	}
+	if bodyIdx >= 0 {
+		return buildSnippet(body, bodyIdx, len(queryRunes), contextLen)
 	}
-
 	return ""
 }
 
+// Preview returns the start of text as one line: whitespace runs become a
+// single space, and text longer than n runes is cut on a grapheme cluster
+// boundary and ends in "...". It is the preview line a mail client shows
+// under a subject.
+func Preview(text string, n int) string {
+	s := strings.TrimSpace(reWhitespace.ReplaceAllString(text, " "))
+	runes := []rune(s)
+	if len(runes) <= n {
+		return s
+	}
+	return strings.TrimRight(string(runes[:boundaryBefore(runes, n)]), " ") + "..."
+}
+
 func runeIndex(haystack, needle []rune) int {
 	if len(needle) == 0 || len(needle) > len(haystack) {
 		return -1
@@ -810,15 +1057,15 @@ func runeIndex(haystack, needle []rune) int {
 	return -1
 }
 
+// buildSnippet cuts a window of contextLen runes either side of the match,
+// shrunk to whole grapheme clusters. A match that starts or ends inside a
+// cluster is widened to it, so the snippet always contains it intact.
 func buildSnippet(runes []rune, matchStart, matchLen, contextLen int) string {
-	start := matchStart - contextLen
-	if start < 0 {
-		start = 0
-	}
-	end := matchStart + matchLen + contextLen
-	if end > len(runes) {
-		end = len(runes)
-	}
+	matchEnd := matchStart + matchLen
+	start := max(matchStart-contextLen, 0)
+	start = min(boundaryAfter(runes, start), boundaryBefore(runes, matchStart))
+	end := min(matchEnd+contextLen, len(runes))
+	end = max(boundaryBefore(runes, end), boundaryAfter(runes, matchEnd))
 	s := string(runes[start:end])
 	s = reWhitespace.ReplaceAllString(s, " ")
 
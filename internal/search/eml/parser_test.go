@@ -1,6 +1,10 @@
 package eml_test
 
 import (
+	"bytes"
+	"encoding/base64"
+	"fmt"
+	"io"
 	"os"
 	"path/filepath"
 	"strings"
@@ -148,6 +152,23 @@ func TestParseFile_QuotedPrintableBody(t *testing.T) {
 	}
 }
 
+func TestPreview(t *testing.T) {
+	for _, tc := range []struct {
+		text string
+		n    int
+		want string
+	}{
+		{"", 10, ""},
+		{"\n\n  Hello,\n\n  see you\ttomorrow. ", 40, "Hello, see you tomorrow."},
+		{"one two three four", 9, "one two t..."},
+		{"Grüße aus Mu\u0308nchen", 12, "Grüße aus M..."}, // the u is not split from its accent
+	} {
+		if got := eml.Preview(tc.text, tc.n); got != tc.want {
+			t.Errorf("Preview(%q, %d) = %q, want %q", tc.text, tc.n, got, tc.want)
+		}
+	}
+}
+
 func TestSnippet_SubjectMatch(t *testing.T) {
 	e := eml.Email{Subject: "Meeting about project alpha", BodyText: "Some body text."}
 	s := eml.Snippet(e, "alpha", 20)
@@ -168,6 +189,48 @@ func TestSnippet_BodyMatch(t *testing.T) {
 	}
 }
 
+func TestSnippet_WholeSubjectFallsThroughToBody(t *testing.T) {
+	e := eml.Email{Subject: "Invoice", BodyText: "Please find the invoice for March attached."}
+	s := eml.Snippet(e, "invoice", 20)
+	if !strings.Contains(s, "for March") {
+		t.Errorf("snippet should come from the body, got %q", s)
+	}
+
+	// Without a body match the subject is still used.
+	e.BodyText = "Nothing relevant."
+	if s := eml.Snippet(e, "invoice", 20); s != "Invoice" {
+		t.Errorf("snippet = %q, want the subject", s)
+	}
+}
+
+func TestSnippet_LongSubjectKeepsSubjectWindow(t *testing.T) {
+	e := eml.Email{
+		Subject:  "Quarterly planning notes for the infrastructure team, including the invoice backlog and hiring",
+		BodyText: "The invoice backlog is tracked in the shared sheet.",
+	}
+	s := eml.Snippet(e, "invoice", 10)
+	if !strings.HasPrefix(s, "...") || !strings.Contains(s, "invoice") || strings.Contains(s, "shared sheet") {
+		t.Errorf("snippet should be a subject window, got %q", s)
+	}
+}
+
+func TestSnippetFrom_BodyFirst(t *testing.T) {
+	e := eml.Email{
+		Subject:  "Quarterly planning notes for the infrastructure team, including the invoice backlog and hiring",
+		BodyText: "The invoice backlog is tracked in the shared sheet.",
+	}
+	s := eml.SnippetFrom(e, "invoice", 10, eml.SnippetBodyFirst)
+	if !strings.HasPrefix(s, "The invoice") {
+		t.Errorf("body-first snippet should come from the body, got %q", s)
+	}
+
+	// Falls back to the subject when the body has no match.
+	e.BodyText = "Unrelated."
+	if s := eml.SnippetFrom(e, "invoice", 10, eml.SnippetBodyFirst); !strings.Contains(s, "invoice") {
+		t.Errorf("body-first snippet should fall back to the subject, got %q", s)
+	}
+}
+
 func TestSnippet_NoMatch(t *testing.T) {
 	e := eml.Email{Subject: "Hello", BodyText: "World"}
 	s := eml.Snippet(e, "zzz", 20)
@@ -244,6 +307,45 @@ func TestParseFileFull_Attachments(t *testing.T) {
 	}
 }
 
+func TestLargeAttachmentSizeAndStream(t *testing.T) {
+	// 11 MiB decoded: above the old 10 MiB listing cap.
+	payload := bytes.Repeat([]byte("0123456789abcdef"), 11*1024*1024/16)
+	encoded := base64.StdEncoding.EncodeToString(payload)
+	var wrapped strings.Builder
+	for len(encoded) > 76 {
+		wrapped.WriteString(encoded[:76] + "\r\n")
+		encoded = encoded[76:]
+	}
+	wrapped.WriteString(encoded + "\r\n")
+	raw := "From: a@b.com\r\nSubject: Big\r\nContent-Type: multipart/mixed; boundary=\"MIX\"\r\n\r\n" +
+		"--MIX\r\nContent-Type: text/plain\r\n\r\nBig file.\r\n" +
+		"--MIX\r\nContent-Type: application/octet-stream\r\nContent-Disposition: attachment; filename=\"big.bin\"\r\nContent-Transfer-Encoding: base64\r\n\r\n" +
+		wrapped.String() + "--MIX--\r\n"
+
+	fe, err := eml.ParseFileFullFromBytes("big.eml", []byte(raw))
+	if err != nil {
+		t.Fatalf("parse: %v", err)
+	}
+	if len(fe.Attachments) != 1 || fe.Attachments[0].Size != len(payload) {
+		t.Fatalf("attachments = %+v, want one of size %d", fe.Attachments, len(payload))
+	}
+
+	r, ct, name, err := eml.OpenAttachmentFromBytes([]byte(raw), 0)
+	if err != nil {
+		t.Fatalf("OpenAttachmentFromBytes: %v", err)
+	}
+	if ct != "application/octet-stream" || name != "big.bin" {
+		t.Errorf("content type %q, filename %q", ct, name)
+	}
+	got, err := io.ReadAll(r)
+	if err != nil {
+		t.Fatalf("read: %v", err)
+	}
+	if !bytes.Equal(got, payload) {
+		t.Errorf("streamed %d bytes, want %d identical bytes", len(got), len(payload))
+	}
+}
+
 func TestParseFileFull_NonExistent(t *testing.T) {
 	_, err := eml.ParseFileFull("/nonexistent/file.eml")
 	if err == nil {
@@ -459,3 +561,81 @@ func TestParseFileFull_ISO88591MultipartHTML(t *testing.T) {
 		t.Errorf("html_body should contain 'Schöne Grüße', got %q", fe.HTMLBody)
 	}
 }
+
+func TestParseFileFull_EmbeddedRFC822(t *testing.T) {
+	dir := t.TempDir()
+	inner := "From: alice@example.com\r\nTo: bob@example.com\r\nSubject: Original\r\nDate: Sun, 09 Feb 2025 08:00:00 +0000\r\n" +
+		"Content-Type: multipart/mixed; boundary=\"IN\"\r\n\r\n" +
+		"--IN\r\nContent-Type: text/plain; charset=utf-8\r\n\r\nOriginal body\r\n" +
+		"--IN\r\nContent-Type: application/pdf\r\nContent-Disposition: attachment; filename=\"report.pdf\"\r\n\r\n%PDF-1.4\r\n" +
+		"--IN--\r\n"
+	raw := "From: bob@example.com\r\nTo: carol@example.com\r\nSubject: Fwd: Original\r\nDate: Mon, 10 Feb 2025 12:00:00 +0000\r\n" +
+		"Content-Type: multipart/mixed; boundary=\"OUT\"\r\n\r\n" +
+		"--OUT\r\nContent-Type: text/plain; charset=utf-8\r\n\r\nSee below\r\n" +
+		"--OUT\r\nContent-Type: message/rfc822\r\nContent-Disposition: attachment; filename=\"original.eml\"\r\n\r\n" + inner +
+		"--OUT--\r\n"
+	path := writeTestEml(t, dir, "full-forward.eml", raw)
+
+	fe, err := eml.ParseFileFull(path)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !strings.Contains(fe.TextBody, "See below") {
+		t.Errorf("text_body should be the outer body, got %q", fe.TextBody)
+	}
+	if len(fe.Attachments) != 1 || fe.Attachments[0].ContentType != "message/rfc822" {
+		t.Errorf("forwarded message should stay downloadable as attachment, got %+v", fe.Attachments)
+	}
+	if len(fe.Embedded) != 1 {
+		t.Fatalf("expected 1 embedded message, got %d", len(fe.Embedded))
+	}
+	emb := fe.Embedded[0]
+	if emb.Subject != "Original" || emb.From != "alice@example.com" {
+		t.Errorf("embedded headers: subject=%q from=%q", emb.Subject, emb.From)
+	}
+	if !strings.Contains(emb.TextBody, "Original body") {
+		t.Errorf("embedded text_body: %q", emb.TextBody)
+	}
+	if len(emb.Attachments) != 1 || emb.Attachments[0].Filename != "report.pdf" {
+		t.Errorf("embedded attachments: %+v", emb.Attachments)
+	}
+}
+
+func TestParseFileFull_EmbeddedDepthCapped(t *testing.T) {
+	dir := t.TempDir()
+	msg := "From: a@b.com\r\nSubject: Level 0\r\n\r\nbottom\r\n"
+	for i := 1; i <= 6; i++ {
+		msg = fmt.Sprintf("From: a@b.com\r\nSubject: Level %d\r\n"+
+			"Content-Type: multipart/mixed; boundary=\"L%d\"\r\n\r\n"+
+			"--L%d\r\nContent-Type: message/rfc822\r\n\r\n%s--L%d--\r\n", i, i, i, msg, i)
+	}
+	path := writeTestEml(t, dir, "deep.eml", msg)
+
+	fe, err := eml.ParseFileFull(path)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	depth := 0
+	for cur := fe; len(cur.Embedded) > 0; cur = cur.Embedded[0] {
+		depth++
+	}
+	if depth != 3 {
+		t.Errorf("expected nesting capped at 3, got %d", depth)
+	}
+}
+
+func TestParseReferences(t *testing.T) {
+	for _, tc := range []struct {
+		refs, inReplyTo string
+		want            string
+	}{
+		{"<a@x> <b@x>", "<b@x>", "[a@x b@x]"},
+		{"", "<c@x> (comment)", "[c@x]"},
+		{"a@x\r\n b@x", "", "[a@x b@x]"},
+		{"", "", "[]"},
+	} {
+		if got := fmt.Sprint(eml.ParseReferences(tc.refs, tc.inReplyTo)); got != tc.want {
+			t.Errorf("ParseReferences(%q, %q) = %s, want %s", tc.refs, tc.inReplyTo, got, tc.want)
+		}
+	}
+}
@@ -0,0 +1,217 @@
+package eml
+
+import (
+	"bytes"
+	"compress/zlib"
+	"errors"
+	"io"
+	"regexp"
+	"strings"
+	"unicode/utf16"
+)
+
+// reStream matches the start of a PDF stream with its dictionary.
+var reStream = regexp.MustCompile(`(?s)<<((?:[^<>]|<<(?:[^<>]|<<[^<>]*>>)*>>|<[0-9A-Fa-f\s]*>)*)>>\s*stream\r?\n`)
+
+// pdfText returns the text drawn by the content streams of a PDF. It is a
+// best-effort reader with no font handling: text in simple (8-bit) fonts
+// comes out, text in composite fonts (often CJK) mostly does not, and
+// scanned documents have none. Streams compressed with anything but
+// FlateDecode, images, fonts and object streams are skipped.
+func pdfText(data []byte) (string, error) {
+	if !bytes.HasPrefix(bytes.TrimLeft(data, "\r\n\t "), []byte("%PDF")) {
+		return "", errors.New("pdf: no %PDF header")
+	}
+	var out strings.Builder
+	for _, m := range reStream.FindAllSubmatchIndex(data, -1) {
+		dict := string(data[m[2]:m[3]])
+		if strings.Contains(dict, "/Image") || strings.Contains(dict, "/Length1") || strings.Contains(dict, "/FontFile") ||
+			strings.Contains(dict, "/ObjStm") || strings.Contains(dict, "/XRef") || strings.Contains(dict, "/Metadata") {
+			continue
+		}
+		start := m[1]
+		end := bytes.Index(data[start:], []byte("endstream"))
+		if end < 0 {
+			break
+		}
+		raw := data[start : start+end]
+		content := raw
+		if strings.Contains(dict, "/Filter") {
+			if !strings.Contains(dict, "/FlateDecode") || strings.Count(dict, "Decode") > 1 {
+				continue
+			}
+			zr, err := zlib.NewReader(bytes.NewReader(raw))
+			if err != nil {
+				continue
+			}
+			// A truncated or over-long stream still yields its start.
+			content, _ = io.ReadAll(io.LimitReader(zr, maxAttachmentInput))
+			zr.Close()
+		}
+		contentText(content, &out)
+		if out.Len() >= maxAttachmentText {
+			break
+		}
+	}
+	return out.String(), nil
+}
+
+// contentText appends the strings shown by the text operators (Tj, TJ, '
+// and ") of a content stream to out, breaking lines where the text moves
+// to a new line.
+func contentText(content []byte, out *strings.Builder) {
+	var operands []string // strings since the last operator
+	i := 0
+	for i < len(content) {
+		c := content[i]
+		switch {
+		case c == '(':
+			s, n := pdfLiteral(content[i:])
+			operands = append(operands, s)
+			i += n
+		case c == '<' && i+1 < len(content) && content[i+1] != '<':
+			end := bytes.IndexByte(content[i:], '>')
+			if end < 0 {
+				return
+			}
+			operands = append(operands, pdfHex(content[i+1:i+end]))
+			i += end + 1
+		case c == '-' || c >= '0' && c <= '9' || c == '.':
+			// A large negative TJ adjustment is a word gap.
+			j := i + 1
+			for j < len(content) && (content[j] >= '0' && content[j] <= '9' || content[j] == '.') {
+				j++
+			}
+			if c == '-' && j-i > 3 {
+				operands = append(operands, " ")
+			}
+			i = j
+		case c == '%':
+			for i < len(content) && content[i] != '\n' && content[i] != '\r' {
+				i++
+			}
+		case c >= 'A' && c <= 'Z' || c >= 'a' && c <= 'z' || c == '\'' || c == '"' || c == '*':
+			j := i + 1
+			for j < len(content) && (content[j] >= 'A' && content[j] <= 'Z' || content[j] >= 'a' && content[j] <= 'z' || content[j] == '*') {
+				j++
+			}
+			switch string(content[i:j]) {
+			case "Tj", "TJ":
+				out.WriteString(strings.Join(operands, ""))
+			case "'", "\"":
+				out.WriteString("\n" + strings.Join(operands, ""))
+			case "T*", "Td", "TD", "ET":
+				if out.Len() > 0 && !strings.HasSuffix(out.String(), "\n") {
+					out.WriteString("\n")
+				}
+			}
+			operands = operands[:0]
+			i = j
+		default:
+			i++
+		}
+	}
+}
+
+// pdfLiteral decodes the literal string at the start of b, "(...)" with
+// nested parentheses and backslash escapes, and returns it with the number
+// of bytes it took.
+func pdfLiteral(b []byte) (string, int) {
+	var s []byte
+	depth := 0
+	i := 0
+	for ; i < len(b); i++ {
+		c := b[i]
+		switch {
+		case c == '\\' && i+1 < len(b):
+			i++
+			switch e := b[i]; e {
+			case 'n':
+				s = append(s, '\n')
+			case 'r':
+				s = append(s, '\r')
+			case 't':
+				s = append(s, '\t')
+			case 'b', 'f':
+			case '\r', '\n':
+				// Line continuation.
+			default:
+				if e >= '0' && e <= '7' {
+					v, n := 0, 0
+					for n < 3 && i+n < len(b) && b[i+n] >= '0' && b[i+n] <= '7' {
+						v = v*8 + int(b[i+n]-'0')
+						n++
+					}
+					s = append(s, byte(v))
+					i += n - 1
+				} else {
+					s = append(s, e)
+				}
+			}
+		case c == '(':
+			if depth > 0 {
+				s = append(s, c)
+			}
+			depth++
+		case c == ')':
+			depth--
+			if depth == 0 {
+				return pdfString(s), i + 1
+			}
+			s = append(s, c)
+		default:
+			s = append(s, c)
+		}
+	}
+	return pdfString(s), i
+}
+
+// pdfHex decodes the inside of a hex string "<48656C6C6F>".
+func pdfHex(b []byte) string {
+	var s []byte
+	var hi byte
+	odd := false
+	for _, c := range b {
+		var v byte
+		switch {
+		case c >= '0' && c <= '9':
+			v = c - '0'
+		case c >= 'a' && c <= 'f':
+			v = c - 'a' + 10
+		case c >= 'A' && c <= 'F':
+			v = c - 'A' + 10
+		default:
+			continue
+		}
+		if odd {
+			s = append(s, hi<<4|v)
+		} else {
+			hi = v
+		}
+		odd = !odd
+	}
+	if odd {
+		s = append(s, hi<<4)
+	}
+	return pdfString(s)
+}
+
+// pdfString turns string bytes into text: UTF-16BE with a byte order mark,
+// otherwise PDFDocEncoding, which is Latin-1 for the printable range.
+// Control bytes, as from composite fonts, are dropped.
+func pdfString(b []byte) string {
+	if len(b) >= 2 && b[0] == 0xFE && b[1] == 0xFF {
+		u := make([]uint16, 0, len(b)/2)
+		for i := 2; i+1 < len(b); i += 2 {
+			u = append(u, uint16(b[i])<<8|uint16(b[i+1]))
+		}
+		return string(utf16.Decode(u))
+	}
+	var sb strings.Builder
+	for _, c := range b {
+		if c >= 0x20 || c == '\n' || c == '\t' {
+			sb.WriteRune(rune(c))
+		}
+	}
+	return sb.String()
+}
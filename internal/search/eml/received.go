@@ -0,0 +1,133 @@
+package eml
+
+import (
+	"net/textproto"
+	"strings"
+	"time"
+)
+
+// ReceivedHop is one relay in a message's delivery chain, parsed from a
+// Received header. Clause values keep their comments, so From typically
+// reads "mail.example.org (mail.example.org [203.0.113.7])".
+type ReceivedHop struct {
+	From      string    `json:"from,omitempty"`
+	By        string    `json:"by,omitempty"`
+	With      string    `json:"with,omitempty"`
+	ID        string    `json:"id,omitempty"`
+	For       string    `json:"for,omitempty"`
+	Timestamp time.Time `json:"timestamp,omitzero"`
+}
+
+// ParseReceivedChain parses the Received headers of h into hops in delivery
+// order: the origin relay first, the final receiving server last. Headers
+// are prepended by each relay, so this is the reverse of header order.
+// Unparseable parts are left empty rather than dropping the hop.
+func ParseReceivedChain(h textproto.MIMEHeader) []ReceivedHop {
+	received := h.Values("Received")
+	if len(received) == 0 {
+		return nil
+	}
+	hops := make([]ReceivedHop, 0, len(received))
+	for i := len(received) - 1; i >= 0; i-- {
+		hops = append(hops, parseReceived(received[i]))
+	}
+	return hops
+}
+
+// parseReceived splits one Received value into its clauses. The date
+// follows the last ";"; clause keywords inside comments are ignored.
+func parseReceived(v string) ReceivedHop {
+	v = strings.Join(strings.Fields(v), " ")
+	var hop ReceivedHop
+	if idx := strings.LastIndex(v, ";"); idx >= 0 {
+		hop.Timestamp = parseReceivedTimestamp(v[idx+1:])
+		v = v[:idx]
+	}
+
+	var field *string
+	var value []string
+	flush := func() {
+		if field != nil && *field == "" {
+			*field = strings.Join(value, " ")
+		}
+		value = value[:0]
+	}
+	for _, tok := range receivedTokens(v) {
+		var next *string
+		switch strings.ToLower(tok) {
+		case "from":
+			next = &hop.From
+		case "by":
+			next = &hop.By
+		case "with":
+			next = &hop.With
+		case "id":
+			next = &hop.ID
+		case "for":
+			next = &hop.For
+		case "via":
+			// Rarely used; ends the previous clause without being kept.
+			flush()
+			field = nil
+			continue
+		}
+		if next != nil {
+			flush()
+			field = next
+			continue
+		}
+		if field != nil {
+			value = append(value, tok)
+		}
+	}
+	flush()
+	// Unwrap the angle-bracketed recipient, keeping any trailing comment.
+	if strings.HasPrefix(hop.For, "<") {
+		if end := strings.Index(hop.For, ">"); end > 0 {
+			hop.For = hop.For[1:end] + hop.For[end+1:]
+		}
+	}
+	return hop
+}
+
+// receivedTokens splits s on spaces, keeping each parenthesised comment
+// (including nested ones) as a single token.
+func receivedTokens(s string) []string {
+	var toks []string
+	var cur strings.Builder
+	depth := 0
+	for _, r := range s {
+		switch {
+		case r == '(':
+			depth++
+		case r == ')' && depth > 0:
+			depth--
+		case r == ' ' && depth == 0:
+			if cur.Len() > 0 {
+				toks = append(toks, cur.String())
+				cur.Reset()
+			}
+			continue
+		}
+		cur.WriteRune(r)
+	}
+	if cur.Len() > 0 {
+		toks = append(toks, cur.String())
+	}
+	return toks
+}
+
+// parseReceivedTimestamp parses the date part of a Received header. Relays
+// disagree on zero padding and trailing zone comments, so a few layouts
+// beyond RFC 5322 are accepted.
+func parseReceivedTimestamp(s string) time.Time {
+	s = strings.TrimSpace(s)
+	if t := ParseDate(s); !t.IsZero() {
+		return t
+	}
+	// Drop a trailing comment such as "(GMT+00:00)" and retry.
+	if idx := strings.LastIndex(s, "("); idx > 0 {
+		return parseReceivedTimestamp(s[:idx])
+	}
+	return time.Time{}
+}
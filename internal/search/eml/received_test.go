@@ -0,0 +1,98 @@
+package eml_test
+
+import (
+	"net/textproto"
+	"testing"
+	"time"
+
+	"github.com/eslider/mails/internal/search/eml"
+)
+
+func TestParseReceivedChain(t *testing.T) {
+	h := textproto.MIMEHeader{}
+	// Header order is newest first, as relays prepend.
+	h.Add("Received", "by 2002:a05:6a10:a0c4:b0:5a1:2b3c:4d5e with SMTP id d4csp123456pxb;\r\n        Mon, 10 Feb 2025 01:02:03 -0800 (PST)")
+	h.Add("Received", "from mail-sor-f41.google.com (mail-sor-f41.google.com. [209.85.220.41])\r\n        by mx.google.com with SMTPS id a1sor2345678wrb.12.2025.02.10.01.02.02\r\n        for <alice@example.com>\r\n        (Google Transport Security);\r\n        Mon, 10 Feb 2025 01:02:02 -0800 (PST)")
+	h.Add("Received", "from DB8PR02MB5914.eurprd02.prod.outlook.com (2603:10a6:10:f3::17) by\n DB8PR02MB6008.eurprd02.prod.outlook.com (2603:10a6:10:11c::21) with\n Microsoft SMTP Server (version=TLS1_2,\n cipher=TLS_ECDHE_RSA_WITH_AES_256_GCM_SHA384) id 15.20.8422.15; Mon, 10 Feb\n 2025 09:01:59 +0000")
+	h.Add("Received", "from [192.168.1.20] (unknown [198.51.100.4])\n\t(Authenticated sender: bob)\n\tby smtp.example.org (Postfix) with ESMTPSA id 4YsQ1k2Zz9z1x2y\n\tfor <alice@example.com>; Mon,  10 Feb 2025 10:01:58 +0100 (CET)")
+
+	hops := eml.ParseReceivedChain(h)
+	if len(hops) != 4 {
+		t.Fatalf("got %d hops, want 4", len(hops))
+	}
+
+	tests := []struct {
+		name string
+		got  eml.ReceivedHop
+		want eml.ReceivedHop
+	}{
+		{"postfix", hops[0], eml.ReceivedHop{
+			From: "[192.168.1.20] (unknown [198.51.100.4]) (Authenticated sender: bob)",
+			By:   "smtp.example.org (Postfix)",
+			With: "ESMTPSA",
+			ID:   "4YsQ1k2Zz9z1x2y",
+			For:  "alice@example.com",
+		}},
+		{"exchange", hops[1], eml.ReceivedHop{
+			From: "DB8PR02MB5914.eurprd02.prod.outlook.com (2603:10a6:10:f3::17)",
+			By:   "DB8PR02MB6008.eurprd02.prod.outlook.com (2603:10a6:10:11c::21)",
+			With: "Microsoft SMTP Server (version=TLS1_2, cipher=TLS_ECDHE_RSA_WITH_AES_256_GCM_SHA384)",
+			ID:   "15.20.8422.15",
+		}},
+		{"gmail relay", hops[2], eml.ReceivedHop{
+			From: "mail-sor-f41.google.com (mail-sor-f41.google.com. [209.85.220.41])",
+			By:   "mx.google.com",
+			With: "SMTPS",
+			ID:   "a1sor2345678wrb.12.2025.02.10.01.02.02",
+			For:  "alice@example.com (Google Transport Security)",
+		}},
+		{"gmail internal", hops[3], eml.ReceivedHop{
+			By:   "2002:a05:6a10:a0c4:b0:5a1:2b3c:4d5e",
+			With: "SMTP",
+			ID:   "d4csp123456pxb",
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := tt.got
+			if got.Timestamp.IsZero() {
+				t.Error("timestamp not parsed")
+			}
+			got.Timestamp = time.Time{}
+			if got != tt.want {
+				t.Errorf("got  %+v\nwant %+v", got, tt.want)
+			}
+		})
+	}
+
+	// All four timestamps describe the same minute; origin comes first.
+	want := time.Date(2025, 2, 10, 9, 1, 58, 0, time.UTC)
+	if !hops[0].Timestamp.Equal(want) {
+		t.Errorf("origin timestamp = %v, want %v", hops[0].Timestamp, want)
+	}
+	for i := 1; i < len(hops); i++ {
+		if hops[i].Timestamp.Before(hops[i-1].Timestamp) {
+			t.Errorf("hop %d at %v precedes hop %d", i, hops[i].Timestamp, i-1)
+		}
+	}
+}
+
+func TestParseReceivedChain_Malformed(t *testing.T) {
+	h := textproto.MIMEHeader{}
+	h.Add("Received", "(qmail 12345 invoked by uid 89); 10 Feb 2025 09:00:00 -0000")
+	h.Add("Received", "garbage without clauses")
+
+	hops := eml.ParseReceivedChain(h)
+	if len(hops) != 2 {
+		t.Fatalf("got %d hops, want 2", len(hops))
+	}
+	if hops[0] != (eml.ReceivedHop{}) {
+		t.Errorf("clause-less hop = %+v, want empty", hops[0])
+	}
+	if hops[1].From != "" || hops[1].By != "" || hops[1].Timestamp.IsZero() {
+		t.Errorf("qmail hop = %+v, want only a timestamp", hops[1])
+	}
+	if eml.ParseReceivedChain(textproto.MIMEHeader{}) != nil {
+		t.Error("no Received headers should yield nil")
+	}
+}
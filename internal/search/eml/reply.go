@@ -0,0 +1,90 @@
+package eml
+
+import (
+	"bytes"
+	"fmt"
+	"net/mail"
+	"regexp"
+	"strings"
+)
+
+// ReplyDraft is a reply to a message, pre-filled for the user to edit.
+type ReplyDraft struct {
+	To         string `json:"to"`
+	Subject    string `json:"subject"`
+	InReplyTo  string `json:"in_reply_to,omitempty"` // <message-id> of the original
+	References string `json:"references,omitempty"`  // the original's References plus its Message-ID
+	Body       string `json:"body"`                  // the quoted original, for text above it
+}
+
+// reReplyPrefix matches a subject that already is a reply: "Re:", "RE :",
+// "Re[2]:" and the like.
+var reReplyPrefix = regexp.MustCompile(`(?i)^re(\[\d+\])?\s*:`)
+
+// NewReplyDraft builds a reply to the message in data. It goes to the
+// original's Reply-To, or its From when there is none (RFC 5322 section
+// 3.6.2), is threaded through In-Reply-To and References, and quotes the
+// text body under an "On <date>, <from> wrote:" line.
+func NewReplyDraft(data []byte) (ReplyDraft, error) {
+	msg, err := mail.ReadMessage(bytes.NewReader(data))
+	if err != nil {
+		return ReplyDraft{}, fmt.Errorf("parse: %w", err)
+	}
+	h := msg.Header
+	fe, err := ParseFileFullFromBytes("", data)
+	if err != nil {
+		return ReplyDraft{}, err
+	}
+
+	d := ReplyDraft{
+		To:      ensureUTF8(strings.TrimSpace(decodeHeader(h.Get("Reply-To")))),
+		Subject: ReplySubject(fe.Subject),
+	}
+	if d.To == "" {
+		d.To = fe.From
+	}
+	if id := NormalizeMessageID(h.Get("Message-Id")); id != "" {
+		d.InReplyTo = "<" + id + ">"
+		d.References = strings.TrimSpace(strings.Join(strings.Fields(h.Get("References")), " ") + " " + d.InReplyTo)
+	}
+
+	attribution := fe.From + " wrote:"
+	if !fe.Date.IsZero() {
+		attribution = "On " + fe.Date.Format("Mon, 2 Jan 2006 at 15:04") + ", " + attribution
+	}
+	d.Body = "\n\n" + attribution + "\n" + Quote(fe.TextBody)
+	return d, nil
+}
+
+// ReplySubject prefixes subject with "Re: " unless it already has a reply
+// prefix.
+func ReplySubject(subject string) string {
+	subject = strings.TrimSpace(subject)
+	if reReplyPrefix.MatchString(subject) {
+		return subject
+	}
+	return "Re: " + subject
+}
+
+// Quote prefixes every line of text with "> " (">" for empty lines, so
+// quoting stays free of trailing spaces). Already-quoted lines get one
+// more level.
+func Quote(text string) string {
+	text = strings.TrimRight(strings.ReplaceAll(text, "\r\n", "\n"), "\n")
+	if text == "" {
+		return ""
+	}
+	lines := strings.Split(text, "\n")
+	for i, l := range lines {
+		l = strings.TrimRight(l, " \t")
+		switch {
+		case l == "":
+			lines[i] = ">"
+		case strings.HasPrefix(l, ">"):
+			lines[i] = ">" + l
+		default:
+			lines[i] = "> " + l
+		}
+	}
+	return strings.Join(lines, "\n") + "\n"
+}
@@ -0,0 +1,75 @@
+package eml_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/eslider/mails/internal/search/eml"
+)
+
+func TestReplySubject(t *testing.T) {
+	for in, want := range map[string]string{
+		"Lunch?":         "Re: Lunch?",
+		"Re: Lunch?":     "Re: Lunch?",
+		"RE: Lunch?":     "RE: Lunch?",
+		"re : Lunch?":    "re : Lunch?",
+		"Re[2]: Lunch?":  "Re[2]: Lunch?",
+		"Regarding this": "Re: Regarding this",
+		"":               "Re: ",
+	} {
+		if got := eml.ReplySubject(in); got != want {
+			t.Errorf("ReplySubject(%q) = %q, want %q", in, got, want)
+		}
+	}
+}
+
+func TestQuote(t *testing.T) {
+	in := "Hi,\r\n\r\nsee below.  \r\n> earlier quote\r\n\r\n"
+	want := "> Hi,\n>\n> see below.\n>> earlier quote\n"
+	if got := eml.Quote(in); got != want {
+		t.Errorf("Quote = %q, want %q", got, want)
+	}
+	if got := eml.Quote("\n\n"); got != "" {
+		t.Errorf("Quote of blank text = %q, want empty", got)
+	}
+}
+
+func TestNewReplyDraft(t *testing.T) {
+	msg := "From: Ann <ann@example.com>\r\n" +
+		"Reply-To: list@example.com\r\n" +
+		"To: me@example.com\r\n" +
+		"Subject: =?UTF-8?Q?Caf=C3=A9?=\r\n" +
+		"Date: Mon, 10 Feb 2025 14:30:00 +0000\r\n" +
+		"Message-ID: <b@example.com>\r\n" +
+		"References: <a@example.com>\r\n" +
+		"\r\n" +
+		"Meet at noon?\r\nAnn\r\n"
+	d, err := eml.NewReplyDraft([]byte(msg))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if d.To != "list@example.com" {
+		t.Errorf("to = %q, want the Reply-To", d.To)
+	}
+	if d.Subject != "Re: Café" {
+		t.Errorf("subject = %q", d.Subject)
+	}
+	if d.InReplyTo != "<b@example.com>" || d.References != "<a@example.com> <b@example.com>" {
+		t.Errorf("threading = %q / %q", d.InReplyTo, d.References)
+	}
+	if !strings.Contains(d.Body, "On Mon, 10 Feb 2025 at 14:30, Ann <ann@example.com> wrote:\n> Meet at noon?\n> Ann\n") {
+		t.Errorf("body = %q", d.Body)
+	}
+
+	// Without Reply-To or Message-ID the reply goes to From, unthreaded.
+	d, err = eml.NewReplyDraft([]byte("From: bob@example.com\r\nSubject: Re: Hi\r\n\r\nYo\r\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if d.To != "bob@example.com" || d.Subject != "Re: Hi" || d.InReplyTo != "" || d.References != "" {
+		t.Errorf("draft = %+v", d)
+	}
+	if !strings.HasPrefix(d.Body, "\n\nbob@example.com wrote:\n> Yo\n") {
+		t.Errorf("body = %q", d.Body)
+	}
+}
@@ -0,0 +1,229 @@
+package eml
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hkdf"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+// Email files may be sealed: encrypted at rest with AES-256-GCM under a key
+// derived from a master key (EMAIL_ENCRYPTION_KEY) and the owning user's ID.
+// A sealed file keeps its name and is read as if it were the plain file,
+// so sealed and plain files mix freely. Its layout is
+//
+//	sealMagic | len(userID) | userID | nonce | ciphertext and tag
+//
+// with everything before the nonce authenticated as additional data.
+const sealMagic = "MAILSEAL\x01"
+
+// sealKeySize is the length of the master key and of the per-user keys.
+const sealKeySize = 32
+
+var (
+	sealMaster []byte
+	sealAEADs  sync.Map // user ID -> cipher.AEAD
+)
+
+// ErrNoSealKey is returned for sealed files when no key is set.
+var ErrNoSealKey = errors.New("email is encrypted but EMAIL_ENCRYPTION_KEY is not set")
+
+// ParseSealKey decodes a master key given as 64 hex characters or as
+// base64 of 32 bytes, the form EMAIL_ENCRYPTION_KEY takes.
+func ParseSealKey(s string) ([]byte, error) {
+	s = strings.TrimSpace(s)
+	if key, err := hex.DecodeString(s); err == nil && len(key) == sealKeySize {
+		return key, nil
+	}
+	if key, err := base64.StdEncoding.DecodeString(s); err == nil && len(key) == sealKeySize {
+		return key, nil
+	}
+	return nil, fmt.Errorf("encryption key must be %d bytes as hex or base64", sealKeySize)
+}
+
+// SetSealKey sets the master key new email files are sealed with, and
+// sealed files opened with; nil turns sealing off. It is not safe to call
+// while emails are being read or written.
+func SetSealKey(master []byte) error {
+	if master != nil && len(master) != sealKeySize {
+		return fmt.Errorf("encryption key must be %d bytes, got %d", sealKeySize, len(master))
+	}
+	sealMaster = bytes.Clone(master)
+	sealAEADs.Clear()
+	return nil
+}
+
+// Seals reports whether a master key is set, so new email files are sealed.
+func Seals() bool {
+	return sealMaster != nil
+}
+
+// IsSealed reports whether data, the start of an email file, is sealed.
+func IsSealed(data []byte) bool {
+	return bytes.HasPrefix(data, []byte(sealMagic))
+}
+
+// Seal encrypts data, the content of an email file of userID. Without a
+// master key, or for data already sealed, data is returned unchanged.
+func Seal(userID string, data []byte) ([]byte, error) {
+	if sealMaster == nil || IsSealed(data) {
+		return data, nil
+	}
+	if len(userID) == 0 || len(userID) > 255 {
+		return nil, fmt.Errorf("seal: invalid user ID %q", userID)
+	}
+	aead, err := userAEAD(userID)
+	if err != nil {
+		return nil, err
+	}
+	header := append([]byte(sealMagic), byte(len(userID)))
+	header = append(header, userID...)
+	out := make([]byte, len(header)+aead.NonceSize(), len(header)+aead.NonceSize()+len(data)+aead.Overhead())
+	copy(out, header)
+	nonce := out[len(header):]
+	rand.Read(nonce)
+	return aead.Seal(out, nonce, data, header), nil
+}
+
+// unseal decrypts a sealed email file, with the key of the user named in
+// its header.
+func unseal(data []byte) ([]byte, error) {
+	if sealMaster == nil {
+		return nil, ErrNoSealKey
+	}
+	rest := data[len(sealMagic):]
+	if len(rest) < 1 || len(rest) < 1+int(rest[0]) {
+		return nil, errors.New("truncated encryption header")
+	}
+	n := 1 + int(rest[0])
+	aead, err := userAEAD(string(rest[1:n]))
+	if err != nil {
+		return nil, err
+	}
+	header := data[:len(sealMagic)+n]
+	rest = rest[n:]
+	if len(rest) < aead.NonceSize()+aead.Overhead() {
+		return nil, errors.New("truncated encrypted email")
+	}
+	plain, err := aead.Open(nil, rest[:aead.NonceSize()], rest[aead.NonceSize():], header)
+	if err != nil {
+		return nil, errors.New("cannot decrypt email: wrong EMAIL_ENCRYPTION_KEY or damaged file")
+	}
+	return plain, nil
+}
+
+// userAEAD returns the cipher for userID's files, derived once per user
+// from the master key with HKDF-SHA256.
+func userAEAD(userID string) (cipher.AEAD, error) {
+	if a, ok := sealAEADs.Load(userID); ok {
+		return a.(cipher.AEAD), nil
+	}
+	key, err := hkdf.Key(sha256.New, sealMaster, nil, "mails eml "+userID, sealKeySize)
+	if err != nil {
+		return nil, err
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+	sealAEADs.Store(userID, aead)
+	return aead, nil
+}
+
+// SealFile seals the plain email file at path in place, keeping its mtime,
+// and reports whether it did. Sealed files are left alone.
+func SealFile(userID, path string) (bool, error) {
+	if !Seals() {
+		return false, nil
+	}
+	if sealed, err := fileSealed(path); err != nil || sealed {
+		return false, err
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return false, err
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		return false, err
+	}
+	sealed, err := Seal(userID, data)
+	if err != nil {
+		return false, err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(path), ".seal-*")
+	if err != nil {
+		return false, err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(sealed); err != nil {
+		tmp.Close()
+		return false, err
+	}
+	if err := tmp.Close(); err != nil {
+		return false, err
+	}
+	os.Chmod(tmp.Name(), info.Mode().Perm())
+	os.Chtimes(tmp.Name(), info.ModTime(), info.ModTime())
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// fileSealed reports whether the file at path starts sealed, reading only
+// its header.
+func fileSealed(path string) (bool, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return false, err
+	}
+	defer f.Close()
+	head := make([]byte, len(sealMagic))
+	n, err := io.ReadFull(f, head)
+	if err != nil && err != io.ErrUnexpectedEOF && err != io.EOF {
+		return false, err
+	}
+	return IsSealed(head[:n]), nil
+}
+
+// SealDir seals the plain email files under dir, all of userID, as
+// SealFile does, and returns how many it sealed. A file that cannot be
+// sealed does not stop the walk; the first such error is returned.
+func SealDir(userID, dir string) (int, error) {
+	sealed := 0
+	var firstErr error
+	err := filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() || !IsEmailFile(d.Name()) {
+			return err
+		}
+		ok, err := SealFile(userID, path)
+		if err != nil && firstErr == nil {
+			firstErr = fmt.Errorf("seal %s: %w", path, err)
+		}
+		if ok {
+			sealed++
+		}
+		return nil
+	})
+	if err == nil {
+		err = firstErr
+	}
+	return sealed, err
+}
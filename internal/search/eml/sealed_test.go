@@ -0,0 +1,155 @@
+package eml_test
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/eslider/mails/internal/search/eml"
+)
+
+const sealedMsg = "From: sender@example.com\r\nSubject: Locked\r\nDate: Mon, 10 Feb 2025 14:30:00 +0000\r\nContent-Type: text/plain\r\n\r\nConfidential body text.\r\n"
+
+func setSealKey(t *testing.T, b byte) {
+	t.Helper()
+	if err := eml.SetSealKey(bytes.Repeat([]byte{b}, 32)); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { eml.SetSealKey(nil) })
+}
+
+func TestParseSealKey(t *testing.T) {
+	key := bytes.Repeat([]byte{0xab}, 32)
+	for _, s := range []string{hex.EncodeToString(key), base64.StdEncoding.EncodeToString(key), " " + hex.EncodeToString(key) + "\n"} {
+		if got, err := eml.ParseSealKey(s); err != nil || !bytes.Equal(got, key) {
+			t.Errorf("ParseSealKey(%q) = %x, %v", s, got, err)
+		}
+	}
+	for _, s := range []string{"", "secret", hex.EncodeToString(key[:16]), base64.StdEncoding.EncodeToString(append(key, 1))} {
+		if _, err := eml.ParseSealKey(s); err == nil {
+			t.Errorf("ParseSealKey(%q) accepted", s)
+		}
+	}
+	if err := eml.SetSealKey(key[:16]); err == nil {
+		t.Error("SetSealKey accepted a 16-byte key")
+	}
+}
+
+func TestSealedFileRoundTrip(t *testing.T) {
+	if got, _ := eml.Seal("u1", []byte(sealedMsg)); string(got) != sealedMsg {
+		t.Fatal("Seal without a key changed the data")
+	}
+	setSealKey(t, 1)
+
+	sealed, err := eml.Seal("u1", []byte(sealedMsg))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !eml.IsSealed(sealed) || bytes.Contains(sealed, []byte("Confidential")) {
+		t.Fatal("Seal left the message readable")
+	}
+	if again, _ := eml.Seal("u1", sealed); !bytes.Equal(again, sealed) {
+		t.Error("Seal sealed an already sealed file")
+	}
+	other, _ := eml.Seal("u1", []byte(sealedMsg))
+	if bytes.Equal(other, sealed) {
+		t.Error("two seals of one message are identical; nonce not random")
+	}
+
+	path := filepath.Join(t.TempDir(), "a-1.eml")
+	if err := os.WriteFile(path, sealed, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	e, err := eml.ParseFile(path)
+	if err != nil {
+		t.Fatalf("ParseFile: %v", err)
+	}
+	if e.Subject != "Locked" || !strings.Contains(e.BodyText, "Confidential body") {
+		t.Errorf("ParseFile = subject %q, body %q", e.Subject, e.BodyText)
+	}
+	if e.Size != int64(len(sealedMsg)) {
+		t.Errorf("Size = %d, want the plain size %d", e.Size, len(sealedMsg))
+	}
+	fe, err := eml.ParseFileFull(path)
+	if err != nil || fe.Subject != "Locked" {
+		t.Errorf("ParseFileFull = %q, %v", fe.Subject, err)
+	}
+	if data, err := eml.ReadFile(path); err != nil || string(data) != sealedMsg {
+		t.Errorf("ReadFile = %q, %v", data, err)
+	}
+	if !eml.FileDate(path).Equal(time.Date(2025, 2, 10, 14, 30, 0, 0, time.UTC)) {
+		t.Errorf("FileDate = %v", eml.FileDate(path))
+	}
+}
+
+func TestSealedFileNeedsItsKey(t *testing.T) {
+	setSealKey(t, 1)
+	sealed, err := eml.Seal("u1", []byte(sealedMsg))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Claiming another user's ID picks another key, which fails to open it.
+	forged := bytes.Replace(sealed, []byte("u1"), []byte("u2"), 1)
+	if _, err := eml.Decompress("a.eml", forged); err == nil {
+		t.Error("file opened under another user's key")
+	}
+	damaged := bytes.Clone(sealed)
+	damaged[len(damaged)-1] ^= 1
+	if _, err := eml.Decompress("a.eml", damaged); err == nil {
+		t.Error("damaged file opened")
+	}
+	if _, err := eml.Decompress("a.eml", sealed[:20]); err == nil {
+		t.Error("truncated file opened")
+	}
+
+	setSealKey(t, 2)
+	if _, err := eml.Decompress("a.eml", sealed); err == nil {
+		t.Error("file opened with the wrong master key")
+	}
+	eml.SetSealKey(nil)
+	if _, err := eml.Decompress("a.eml", sealed); !errors.Is(err, eml.ErrNoSealKey) {
+		t.Errorf("without a key err = %v, want ErrNoSealKey", err)
+	}
+}
+
+func TestSealDir(t *testing.T) {
+	dir := t.TempDir()
+	mtime := time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)
+	for _, name := range []string{"inbox/a-1.eml", "inbox/b-2.eml", "notes.txt"} {
+		p := filepath.Join(dir, name)
+		os.MkdirAll(filepath.Dir(p), 0o755)
+		os.WriteFile(p, []byte(sealedMsg), 0o644)
+		os.Chtimes(p, mtime, mtime)
+	}
+
+	if n, err := eml.SealDir("u1", dir); err != nil || n != 0 {
+		t.Errorf("SealDir without a key = %d, %v; want nothing sealed", n, err)
+	}
+	setSealKey(t, 1)
+	if n, err := eml.SealDir("u1", dir); err != nil || n != 2 {
+		t.Fatalf("SealDir = %d, %v; want 2", n, err)
+	}
+	if n, _ := eml.SealDir("u1", dir); n != 0 {
+		t.Errorf("second SealDir sealed %d files, want 0", n)
+	}
+	p := filepath.Join(dir, "inbox", "a-1.eml")
+	if data, _ := os.ReadFile(p); !eml.IsSealed(data) {
+		t.Error("email not sealed")
+	}
+	if info, _ := os.Stat(p); !info.ModTime().Equal(mtime) {
+		t.Errorf("mtime = %v, want %v kept", info.ModTime(), mtime)
+	}
+	if data, _ := os.ReadFile(filepath.Join(dir, "notes.txt")); eml.IsSealed(data) {
+		t.Error("non-email file sealed")
+	}
+	if data, err := eml.ReadFile(p); err != nil || string(data) != sealedMsg {
+		t.Errorf("ReadFile after SealDir = %q, %v", data, err)
+	}
+}
@@ -0,0 +1,317 @@
+package index
+
+import (
+	"bufio"
+	"bytes"
+	"cmp"
+	"context"
+	"io/fs"
+	"log"
+	"net/mail"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/eslider/mails/internal/search/eml"
+)
+
+// Address is an address book entry: an address seen in the From or To of
+// indexed mail, or in an imported vCard.
+type Address struct {
+	Address string `json:"address"` // lower-cased
+	Name    string `json:"name,omitempty"`
+	// Count is how many indexed emails the address appears in; 0 for
+	// addresses known only from vCards.
+	Count    int       `json:"count"`
+	LastSeen time.Time `json:"last_seen,omitzero"`
+}
+
+// AddressSuggestions are address book completions.
+type AddressSuggestions struct {
+	Query     string    `json:"query"`
+	Addresses []Address `json:"addresses"`
+}
+
+// addressBook holds the addresses of one account index, as of the Parquet
+// file's modification time.
+type addressBook struct {
+	modTime time.Time
+	entries map[string]*Address
+}
+
+// addressBooks caches address books by index path. Build replaces an
+// account's book; one whose Parquet file changed otherwise (another
+// process rebuilt it) is reloaded on use.
+var addressBooks = struct {
+	mu    sync.Mutex
+	books map[string]addressBook
+}{books: make(map[string]addressBook)}
+
+// addressCounter collects address frequencies.
+type addressCounter map[string]*Address
+
+// add counts the addresses in the From and To values of one email.
+func (c addressCounter) add(date time.Time, fields ...string) {
+	seen := make(map[string]bool)
+	for _, f := range fields {
+		for _, a := range parseAddresses(f) {
+			key := strings.ToLower(a.Address)
+			if seen[key] {
+				continue
+			}
+			seen[key] = true
+			e := c.entry(key)
+			e.Count++
+			if date.After(e.LastSeen) {
+				e.LastSeen = date
+				if a.Name != "" {
+					e.Name = a.Name
+				}
+			}
+			if e.Name == "" {
+				e.Name = a.Name
+			}
+		}
+	}
+}
+
+// addCard adds an address from a vCard, taking its name when mail gave none.
+func (c addressCounter) addCard(address, name string) {
+	e := c.entry(strings.ToLower(address))
+	if e.Name == "" {
+		e.Name = name
+	}
+}
+
+func (c addressCounter) entry(key string) *Address {
+	e, ok := c[key]
+	if !ok {
+		e = &Address{Address: key}
+		c[key] = e
+	}
+	return e
+}
+
+// parseAddresses returns the addresses in a From or To value, falling back
+// to its comma-separated parts holding an "@" when it does not parse.
+func parseAddresses(f string) []*mail.Address {
+	if strings.TrimSpace(f) == "" {
+		return nil
+	}
+	if list, err := mail.ParseAddressList(f); err == nil {
+		return list
+	}
+	var out []*mail.Address
+	for _, p := range strings.Split(f, ",") {
+		if p = strings.Trim(strings.TrimSpace(p), "<>"); strings.Contains(p, "@") {
+			out = append(out, &mail.Address{Address: p})
+		}
+	}
+	return out
+}
+
+// addVCards adds the addresses of the .vcf files under dir, such as the
+// contacts a PST import writes. A missing dir adds nothing.
+func (c addressCounter) addVCards(dir string) {
+	if dir == "" {
+		return
+	}
+	filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() || !strings.EqualFold(filepath.Ext(path), ".vcf") {
+			return nil
+		}
+		data, err := os.ReadFile(path)
+		if err != nil {
+			log.Printf("WARN: read vCard %s: %v", path, err)
+			return nil
+		}
+		for _, card := range parseVCards(data) {
+			for _, addr := range card.emails {
+				c.addCard(addr, card.name)
+			}
+		}
+		return nil
+	})
+}
+
+type vCard struct {
+	name   string
+	emails []string
+}
+
+// parseVCards reads the FN and EMAIL properties of the cards in data.
+// Folded lines are unfolded; other properties are ignored.
+func parseVCards(data []byte) []vCard {
+	var lines []string
+	sc := bufio.NewScanner(bytes.NewReader(data))
+	sc.Buffer(make([]byte, 0, 64*1024), 1<<20)
+	for sc.Scan() {
+		line := strings.TrimRight(sc.Text(), "\r")
+		if len(lines) > 0 && (strings.HasPrefix(line, " ") || strings.HasPrefix(line, "\t")) {
+			lines[len(lines)-1] += line[1:]
+			continue
+		}
+		lines = append(lines, line)
+	}
+
+	var cards []vCard
+	var card *vCard
+	for _, line := range lines {
+		prop, value, ok := strings.Cut(line, ":")
+		if !ok {
+			continue
+		}
+		name, _, _ := strings.Cut(strings.ToUpper(prop), ";")
+		if i := strings.LastIndex(name, "."); i >= 0 {
+			name = name[i+1:] // grouped, as in "item1.EMAIL"
+		}
+		switch {
+		case name == "BEGIN" && strings.EqualFold(value, "VCARD"):
+			cards = append(cards, vCard{})
+			card = &cards[len(cards)-1]
+		case card == nil:
+		case name == "FN":
+			card.name = strings.TrimSpace(value)
+		case name == "EMAIL":
+			if v := strings.TrimSpace(value); strings.Contains(v, "@") {
+				card.emails = append(card.emails, v)
+			}
+		case name == "END":
+			card = nil
+		}
+	}
+	return cards
+}
+
+// storeAddressBook caches the address book built from emails and the
+// vCards under emailDir for the index at indexPath.
+func storeAddressBook(indexPath, emailDir string, emails []eml.Email) {
+	if indexPath == "" {
+		return
+	}
+	info, err := os.Stat(indexPath)
+	if err != nil {
+		return
+	}
+	c := make(addressCounter)
+	for _, e := range emails {
+		c.add(e.Date, e.From, e.To)
+	}
+	c.addVCards(emailDir)
+	addressBooks.mu.Lock()
+	addressBooks.books[indexPath] = addressBook{modTime: info.ModTime(), entries: c}
+	addressBooks.mu.Unlock()
+}
+
+// loadAddressBook returns the cached address book of an account index,
+// reading it from the Parquet file when the cache has none or an older one.
+func loadAddressBook(ctx context.Context, a AccountIndex) (map[string]*Address, error) {
+	info, err := os.Stat(a.IndexPath)
+	if err != nil {
+		return nil, err
+	}
+	addressBooks.mu.Lock()
+	book, ok := addressBooks.books[a.IndexPath]
+	addressBooks.mu.Unlock()
+	if ok && book.modTime.Equal(info.ModTime()) {
+		return book.entries, nil
+	}
+
+	db, err := openDuckDB()
+	if err != nil {
+		return nil, err
+	}
+	defer db.Close()
+	escaped := strings.ReplaceAll(a.IndexPath, "'", "''")
+	rows, err := db.QueryContext(ctx, "SELECT from_addr, to_addr, date FROM read_parquet('"+escaped+"')")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	c := make(addressCounter)
+	for rows.Next() {
+		var from, to string
+		var date *time.Time
+		if err := rows.Scan(&from, &to, &date); err != nil {
+			return nil, err
+		}
+		var d time.Time
+		if date != nil {
+			d = *date
+		}
+		c.add(d, from, to)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	c.addVCards(a.EmailDir)
+
+	addressBooks.mu.Lock()
+	addressBooks.books[a.IndexPath] = addressBook{modTime: info.ModTime(), entries: c}
+	addressBooks.mu.Unlock()
+	return c, nil
+}
+
+// SuggestAddresses returns up to limit addresses whose address or name
+// contains q across the given account indices, from the mail they sent
+// and received and from imported vCards: most frequent, then most
+// recently seen, first. An empty q returns the most frequent addresses.
+func SuggestAddresses(ctx context.Context, accounts []AccountIndex, q string, limit int) AddressSuggestions {
+	out := AddressSuggestions{Query: q, Addresses: []Address{}}
+	q = strings.ToLower(strings.TrimSpace(q))
+
+	merged := make(map[string]*Address)
+	for _, a := range accounts {
+		if a.IndexPath == "" {
+			continue
+		}
+		book, err := loadAddressBook(ctx, a)
+		if err != nil {
+			if !os.IsNotExist(err) {
+				log.Printf("WARN: address book %s: %v", a.IndexPath, err)
+			}
+			continue
+		}
+		for key, e := range book {
+			if q != "" && !strings.Contains(key, q) && !strings.Contains(strings.ToLower(e.Name), q) {
+				continue
+			}
+			m, ok := merged[key]
+			if !ok {
+				cp := *e
+				merged[key] = &cp
+				continue
+			}
+			m.Count += e.Count
+			if e.LastSeen.After(m.LastSeen) {
+				m.LastSeen = e.LastSeen
+				if e.Name != "" {
+					m.Name = e.Name
+				}
+			}
+			if m.Name == "" {
+				m.Name = e.Name
+			}
+		}
+	}
+
+	for _, e := range merged {
+		out.Addresses = append(out.Addresses, *e)
+	}
+	slices.SortFunc(out.Addresses, func(a, b Address) int {
+		if c := cmp.Compare(b.Count, a.Count); c != 0 {
+			return c
+		}
+		if c := b.LastSeen.Compare(a.LastSeen); c != 0 {
+			return c
+		}
+		return strings.Compare(a.Address, b.Address)
+	})
+	if limit > 0 && len(out.Addresses) > limit {
+		out.Addresses = out.Addresses[:limit]
+	}
+	return out
+}
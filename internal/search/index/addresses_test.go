@@ -0,0 +1,71 @@
+package index_test
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/eslider/mails/internal/search/index"
+)
+
+func TestSuggestAddresses(t *testing.T) {
+	dir := t.TempDir()
+	inbox := filepath.Join(dir, "inbox")
+	contacts := filepath.Join(dir, "contacts")
+	os.MkdirAll(inbox, 0o755)
+	os.MkdirAll(contacts, 0o755)
+	for name, content := range map[string]string{
+		"a.eml": "From: Alice <alice@test.com>\r\nTo: bob@test.com\r\nSubject: One\r\nDate: Mon, 10 Feb 2025 09:00:00 +0000\r\n\r\nx\r\n",
+		"b.eml": "From: Bob Builder <Bob@Test.com>\r\nTo: alice@test.com, carol@test.com\r\nSubject: Two\r\nDate: Tue, 11 Feb 2025 09:00:00 +0000\r\n\r\nx\r\n",
+		"c.eml": "From: carol@test.com\r\nTo: Alice Smith <alice@test.com>\r\nSubject: Three\r\nDate: Wed, 12 Feb 2025 09:00:00 +0000\r\n\r\nx\r\n",
+	} {
+		os.WriteFile(filepath.Join(inbox, name), []byte(content), 0o644)
+	}
+	vcf := "BEGIN:VCARD\r\nVERSION:3.0\r\nFN:Dave Jones\r\nEMAIL;TYPE=INTERNET:dave@\r\n test.com\r\nEND:VCARD\r\nBEGIN:VCARD\r\nFN:Bob Card\r\nitem1.EMAIL:bob@test.com\r\nEND:VCARD\r\n"
+	os.WriteFile(filepath.Join(contacts, "people.vcf"), []byte(vcf), 0o644)
+
+	indexPath := filepath.Join(t.TempDir(), "index.parquet")
+	idx, err := index.New(dir, indexPath, nil, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	idx.Build()
+	idx.Close()
+	accounts := []index.AccountIndex{{ID: "a", IndexPath: indexPath, EmailDir: dir}}
+
+	check := func(label string) {
+		t.Helper()
+		got := index.SuggestAddresses(context.Background(), accounts, "", 0).Addresses
+		if len(got) != 4 {
+			t.Fatalf("%s: got %+v, want 4 addresses", label, got)
+		}
+		alice := got[0]
+		if alice.Address != "alice@test.com" || alice.Count != 3 || alice.Name != "Alice Smith" ||
+			!alice.LastSeen.Equal(time.Date(2025, 2, 12, 9, 0, 0, 0, time.UTC)) {
+			t.Errorf("%s: first = %+v, want alice, 3 emails, newest name", label, alice)
+		}
+		if got[1].Address != "carol@test.com" || got[2].Address != "bob@test.com" || got[2].Name != "Bob Builder" {
+			t.Errorf("%s: order = %+v, want carol then bob (same count, carol seen later)", label, got)
+		}
+		if d := got[3]; d.Address != "dave@test.com" || d.Name != "Dave Jones" || d.Count != 0 {
+			t.Errorf("%s: vCard entry = %+v", label, d)
+		}
+
+		byName := index.SuggestAddresses(context.Background(), accounts, "jones", 10).Addresses
+		if len(byName) != 1 || byName[0].Address != "dave@test.com" {
+			t.Errorf("%s: q=jones = %+v", label, byName)
+		}
+	}
+	check("after Build")
+
+	// A newer Parquet file than the cached book is read again.
+	later := time.Now().Add(time.Minute)
+	os.Chtimes(indexPath, later, later)
+	check("from Parquet")
+
+	if got := index.SuggestAddresses(context.Background(), accounts, "", 1).Addresses; len(got) != 1 {
+		t.Errorf("limit 1 returned %d", len(got))
+	}
+}
@@ -0,0 +1,56 @@
+package index
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestQueryContextCancelAbortsPromptly(t *testing.T) {
+	db, err := openDuckDB()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	// A scan that would run for a long time if not interrupted.
+	const slow = "SELECT COUNT(*) FROM range(1000000000000) a WHERE a.range % 7 = 3"
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	var n int64
+	err = db.QueryRowContext(ctx, slow).Scan(&n)
+	if err == nil {
+		t.Fatal("expected the slow query to be aborted")
+	}
+	if elapsed := time.Since(start); elapsed > 3*time.Second {
+		t.Errorf("cancelled query took %v, want prompt abort", elapsed)
+	}
+
+	// The single connection is usable again.
+	if err := db.QueryRow("SELECT 1").Scan(&n); err != nil {
+		t.Fatalf("connection not released after cancel: %v", err)
+	}
+}
+
+func TestSearchContextCancelled(t *testing.T) {
+	idx, err := New(t.TempDir(), "", nil, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer idx.Close()
+	if _, err := idx.db.Exec("INSERT INTO emails (path, subject, date) VALUES ('a.eml', 'hello', TIMESTAMP '2025-02-10 09:00:00')"); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	res := idx.SearchContext(ctx, "hello", 0, 10)
+	if len(res.Hits) != 0 || res.Total != 0 {
+		t.Errorf("cancelled search should return nothing, got total=%d hits=%d", res.Total, len(res.Hits))
+	}
+	if res := idx.Search("hello", 0, 10); res.Total != 1 {
+		t.Errorf("search after cancel: total=%d, want 1", res.Total)
+	}
+}
@@ -0,0 +1,125 @@
+package index
+
+import (
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/eslider/mails/internal/search/eml"
+)
+
+// DedupScope says how far duplicate detection reaches. Each account index
+// keeps one copy per checksum and Message-ID of its own mail either way;
+// the scope only decides what searching several accounts together returns.
+type DedupScope string
+
+const (
+	// DedupGlobal collapses copies of a message held by several accounts,
+	// e.g. one forwarded into two mailboxes, into a single hit (default).
+	DedupGlobal DedupScope = "global"
+	// DedupAccount returns one hit per account holding the message.
+	DedupAccount DedupScope = "account"
+)
+
+// dedupScope is the scope used by SearchMulti, SuggestMulti and
+// StreamMulti, from DEDUP_SCOPE.
+var dedupScope = dedupScopeFromEnv()
+
+func dedupScopeFromEnv() DedupScope {
+	switch s := DedupScope(strings.ToLower(strings.TrimSpace(os.Getenv("DEDUP_SCOPE")))); s {
+	case "", DedupGlobal:
+		return DedupGlobal
+	case DedupAccount:
+		return DedupAccount
+	default:
+		log.Printf("WARN: DEDUP_SCOPE=%q is not global or account; using global", s)
+		return DedupGlobal
+	}
+}
+
+// SetDedupScope changes the cross-account dedup scope. It is not safe to
+// call while searches run.
+func SetDedupScope(s DedupScope) {
+	dedupScope = s
+}
+
+// folderRanks orders well-known folder names by how canonical a copy found
+// there is: lower wins. Names are lower-cased with spaces, dashes and
+// underscores removed. Unknown folders rank between sent and archive.
+var folderRanks = map[string]int{
+	"inbox":           0,
+	"sent":            1,
+	"sentmail":        1,
+	"sentitems":       1,
+	"sentmessages":    1,
+	"archive":         3,
+	"allmail":         3,
+	"spam":            4,
+	"junk":            4,
+	"junkemail":       4,
+	"trash":           5,
+	"bin":             5,
+	"deleteditems":    5,
+	"deletedmessages": 5,
+}
+
+const unknownFolderRank = 2
+
+// folderRank returns the rank of the innermost well-known folder in path.
+func folderRank(path string) int {
+	segments := strings.Split(filepath.ToSlash(filepath.Dir(path)), "/")
+	for i := len(segments) - 1; i >= 0; i-- {
+		name := strings.NewReplacer(" ", "", "-", "", "_", "").Replace(strings.ToLower(segments[i]))
+		name = strings.TrimPrefix(name, "[gmail]")
+		if r, ok := folderRanks[name]; ok {
+			return r
+		}
+	}
+	return unknownFolderRank
+}
+
+// dedupByMessageID keeps one copy per Message-ID: the one in the most
+// canonical folder (see folderRanks), then the lexically smallest path.
+// Emails without a Message-ID are all kept. The returned map lists, per kept
+// path, the paths of the copies that were dropped.
+func dedupByMessageID(emails []eml.Email) ([]eml.Email, map[string][]string) {
+	best := make(map[string]int) // Message-ID -> index into emails
+	for i, e := range emails {
+		if e.MessageID == "" {
+			continue
+		}
+		j, ok := best[e.MessageID]
+		if !ok || canonicalBefore(e.Path, emails[j].Path) {
+			best[e.MessageID] = i
+		}
+	}
+
+	aliases := make(map[string][]string)
+	kept := make([]eml.Email, 0, len(emails))
+	for i, e := range emails {
+		if e.MessageID == "" {
+			kept = append(kept, e)
+			continue
+		}
+		if j := best[e.MessageID]; j != i {
+			canonical := emails[j].Path
+			aliases[canonical] = append(aliases[canonical], e.Path)
+			continue
+		}
+		kept = append(kept, e)
+	}
+	for _, paths := range aliases {
+		sort.Strings(paths)
+	}
+	return kept, aliases
+}
+
+func canonicalBefore(a, b string) bool {
+	ra, rb := folderRank(a), folderRank(b)
+	if ra != rb {
+		return ra < rb
+	}
+	return a < b
+}
@@ -0,0 +1,74 @@
+package index
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"testing"
+)
+
+func TestFolderRank(t *testing.T) {
+	tests := []struct {
+		path string
+		want int
+	}{
+		{"acct/INBOX/a.eml", 0},
+		{"acct/Sent Items/a.eml", 1},
+		{"acct/Projects/a.eml", unknownFolderRank},
+		{"acct/[Gmail]/All Mail/a.eml", 3},
+		{"acct/allmail/a.eml", 3},
+		{"acct/Junk-Email/a.eml", 4},
+		{"acct/Deleted Items/a.eml", 5},
+		{"acct/Inbox/Receipts/a.eml", 0},
+	}
+	for _, tt := range tests {
+		if got := folderRank(tt.path); got != tt.want {
+			t.Errorf("folderRank(%q) = %d, want %d", tt.path, got, tt.want)
+		}
+	}
+}
+
+func TestLoadParquetWithoutMessageID(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "old.parquet")
+	db, err := openDuckDB()
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Schema used before Message-ID dedup.
+	if _, err := db.Exec(fmt.Sprintf(`COPY (SELECT 'inbox/a.eml' AS path, 'Hello' AS subject, '' AS from_addr, '' AS to_addr,
+		TIMESTAMP '2025-02-10 09:00:00' AS date, 1::BIGINT AS size, '' AS body_text) TO '%s' (FORMAT PARQUET)`, path)); err != nil {
+		t.Fatal(err)
+	}
+	db.Close()
+
+	idx, err := New(dir, path, nil, "")
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	defer idx.Close()
+	if n := idx.Stats().TotalEmails; n != 1 {
+		t.Fatalf("loaded %d emails, want 1", n)
+	}
+	if _, ok := idx.LookupMessageID(context.Background(), "x@example.com"); ok {
+		t.Error("unexpected Message-ID hit in legacy index")
+	}
+	if res := idx.Search("hello", 0, 0); res.Total != 1 {
+		t.Errorf("search total = %d, want 1", res.Total)
+	}
+	// Legacy files have no attachment_count; they count as none.
+	multi := SearchMulti([]AccountIndex{{ID: "a", IndexPath: path}}, "hello has:attachment", 0, 0)
+	if multi.Total != 0 {
+		t.Errorf("has:attachment on legacy index: total = %d, want 0", multi.Total)
+	}
+	if multi := SearchMulti([]AccountIndex{{ID: "a", IndexPath: path}}, "hello", 0, 0); multi.Total != 1 {
+		t.Errorf("multi search on legacy index: total = %d, want 1", multi.Total)
+	}
+	// ... nor indexed headers.
+	if res := idx.Search("header:list-id", 0, 0); res.Total != 0 {
+		t.Errorf("header filter on legacy index: total = %d, want 0", res.Total)
+	}
+	if multi := SearchMulti([]AccountIndex{{ID: "a", IndexPath: path}}, "hello header:list-id", 0, 0); multi.Total != 0 {
+		t.Errorf("header filter on legacy multi index: total = %d, want 0", multi.Total)
+	}
+}
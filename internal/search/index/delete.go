@@ -0,0 +1,213 @@
+package index
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/eslider/mails/internal/search/eml"
+)
+
+// DeleteResult reports what DeleteMatching removed.
+type DeleteResult struct {
+	Matched   int `json:"matched"`   // emails matching the query before deletion
+	Deleted   int `json:"deleted"`   // index rows removed
+	Files     int `json:"files"`     // .eml files removed, duplicate copies included
+	Remaining int `json:"remaining"` // matches left in the index, e.g. because of the limit
+
+	// Paths lists every removed file relative to the email directory, for
+	// cleaning up derived data such as vector points.
+	Paths []string `json:"-"`
+}
+
+// DeleteMatching removes up to limit emails matching query (oldest first)
+// from disk or the blob store and from the index, then re-saves the Parquet
+// file. Every copy of a match goes with it: Message-ID aliases and files
+// sharing its checksum in other folders, so a rebuild does not bring it
+// back. An empty query matches every email; limit <= 0 means no limit.
+//
+// A row stays indexed when one of its files cannot be removed; the first
+// such error is returned together with the partial result.
+func (idx *Index) DeleteMatching(ctx context.Context, query string, fields []string, limit int) (DeleteResult, error) {
+	var res DeleteResult
+	q := strings.ToLower(strings.TrimSpace(query))
+	where, args := matchClause(ctx, q, fields)
+
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+
+	if err := idx.db.QueryRowContext(ctx, "SELECT COUNT(*) FROM emails WHERE "+where, args...).Scan(&res.Matched); err != nil {
+		return res, fmt.Errorf("count matches: %w", err)
+	}
+	res.Remaining = res.Matched
+	if res.Matched == 0 {
+		return res, nil
+	}
+
+	sqlQuery := "SELECT path, aliases FROM emails WHERE " + where + " ORDER BY date ASC NULLS FIRST, path"
+	if limit > 0 {
+		sqlQuery += fmt.Sprintf(" LIMIT %d", limit)
+	}
+	rows, err := idx.db.QueryContext(ctx, sqlQuery, args...)
+	if err != nil {
+		return res, fmt.Errorf("select matches: %w", err)
+	}
+	var matches []MessageCopy
+	for rows.Next() {
+		var c MessageCopy
+		var aliases string
+		if err := rows.Scan(&c.Path, &aliases); err != nil {
+			rows.Close()
+			return res, fmt.Errorf("scan match: %w", err)
+		}
+		if aliases != "" {
+			c.Aliases = strings.Split(aliases, aliasSep)
+		}
+		matches = append(matches, c)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return res, fmt.Errorf("select matches: %w", err)
+	}
+
+	twins, err := idx.checksumTwins(ctx, matches)
+	if err != nil {
+		return res, fmt.Errorf("list emails: %w", err)
+	}
+
+	var firstErr error
+	var removed []string
+	for _, c := range matches {
+		copies := append([]string{c.Path}, c.Aliases...)
+		var files []string
+		seen := make(map[string]bool)
+		for _, p := range copies {
+			for _, f := range append([]string{p}, twins[extractChecksum(filepath.Base(p))]...) {
+				if !seen[f] {
+					seen[f] = true
+					files = append(files, f)
+				}
+			}
+		}
+		ok := true
+		for _, p := range files {
+			if err := idx.removeFile(ctx, p); err != nil {
+				if firstErr == nil {
+					firstErr = fmt.Errorf("remove %s: %w", p, err)
+				}
+				ok = false
+				continue
+			}
+			res.Paths = append(res.Paths, p)
+		}
+		if ok {
+			removed = append(removed, c.Path)
+		}
+	}
+	res.Files = len(res.Paths)
+
+	if len(removed) > 0 {
+		tx, err := idx.db.BeginTx(ctx, nil)
+		if err != nil {
+			return res, fmt.Errorf("begin tx: %w", err)
+		}
+		for _, p := range removed {
+			if _, err := tx.ExecContext(ctx, "DELETE FROM emails WHERE path = ?", p); err != nil {
+				tx.Rollback()
+				return res, fmt.Errorf("delete %s: %w", p, err)
+			}
+		}
+		if err := tx.Commit(); err != nil {
+			return res, fmt.Errorf("commit: %w", err)
+		}
+		res.Deleted = len(removed)
+		res.Remaining -= res.Deleted
+		idx.total -= res.Deleted
+		if err := idx.saveParquet(); err != nil {
+			return res, fmt.Errorf("save parquet: %w", err)
+		}
+	}
+	return res, firstErr
+}
+
+// checksumTwins maps the checksum of each matched file to every .eml file
+// holding the same message: the same checksum, or the same one saved under
+// another CHECKSUM_LENGTH (see checksumKeys). Build skips such twins, so
+// they have no row of their own.
+func (idx *Index) checksumTwins(ctx context.Context, matches []MessageCopy) (map[string][]string, error) {
+	want := make(map[string]bool)
+	for _, c := range matches {
+		for _, p := range append([]string{c.Path}, c.Aliases...) {
+			if cs := extractChecksum(filepath.Base(p)); cs != "" {
+				want[cs] = true
+			}
+		}
+	}
+	twins := make(map[string][]string)
+	if len(want) == 0 {
+		return twins, nil
+	}
+	paths, err := idx.listEmailFiles(ctx)
+	if err != nil {
+		return nil, err
+	}
+	sums := make([]string, len(paths))
+	for i, p := range paths {
+		sums[i] = extractChecksum(filepath.Base(p))
+	}
+	copyKeys := checksumKeys(sums)
+	byKey := make(map[string][]string)
+	for i, p := range paths {
+		if sums[i] != "" {
+			byKey[copyKeys[sums[i]]] = append(byKey[copyKeys[sums[i]]], p)
+		}
+	}
+	for cs := range want {
+		twins[cs] = byKey[copyKeys[cs]]
+	}
+	return twins, nil
+}
+
+// listEmailFiles returns the .eml files under the email directory (or
+// blob prefix), relative to it.
+func (idx *Index) listEmailFiles(ctx context.Context) ([]string, error) {
+	var paths []string
+	if idx.blobStore != nil && idx.emailKeyPref != "" {
+		keys, err := idx.blobStore.List(ctx, idx.emailKeyPref)
+		if err != nil {
+			return nil, err
+		}
+		for _, k := range keys {
+			if eml.IsEmailFile(k) {
+				paths = append(paths, filepath.FromSlash(strings.TrimPrefix(strings.TrimPrefix(k, idx.emailKeyPref), "/")))
+			}
+		}
+		return paths, nil
+	}
+	err := filepath.WalkDir(idx.emailDir, func(path string, d os.DirEntry, err error) error {
+		if err != nil || d.IsDir() || !eml.IsEmailFile(d.Name()) {
+			return nil
+		}
+		if rel, relErr := filepath.Rel(idx.emailDir, path); relErr == nil {
+			paths = append(paths, rel)
+		}
+		return nil
+	})
+	return paths, err
+}
+
+// removeFile deletes one email by path relative to the email directory.
+// A file that is already gone is not an error.
+func (idx *Index) removeFile(ctx context.Context, relPath string) error {
+	if idx.blobStore != nil && idx.emailKeyPref != "" {
+		return idx.blobStore.Delete(ctx, idx.emailKeyPref+"/"+filepath.ToSlash(relPath))
+	}
+	err := os.Remove(filepath.Join(idx.emailDir, relPath))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	return err
+}
@@ -0,0 +1,96 @@
+package index_test
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/eslider/mails/internal/search/index"
+)
+
+func TestDeleteMatching(t *testing.T) {
+	dir := t.TempDir()
+	write := func(rel, from, date, msgID string) {
+		t.Helper()
+		p := filepath.Join(dir, rel)
+		if err := os.MkdirAll(filepath.Dir(p), 0755); err != nil {
+			t.Fatal(err)
+		}
+		body := "From: " + from + "\r\nSubject: Weekly digest\r\nDate: " + date + "\r\nMessage-ID: <" + msgID + ">\r\n\r\nThis week's news.\r\n"
+		if err := os.WriteFile(p, []byte(body), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// An old newsletter with a Message-ID alias and checksum twins (one
+	// saved under CHECKSUM_LENGTH 24), a second old one, a recent one and
+	// an unrelated email.
+	write("inbox/0000000000000001-old.eml", "news@shop.com", "Mon, 10 Feb 2020 09:00:00 +0000", "old@shop")
+	write("archive/0000000000000001-old.eml", "news@shop.com", "Mon, 10 Feb 2020 09:00:00 +0000", "old@shop")
+	write("sent/0000000000000001beefcafe-old.eml", "news@shop.com", "Mon, 10 Feb 2020 09:00:00 +0000", "old@shop")
+	write("promo/0000000000000009-old.eml", "news@shop.com", "Mon, 10 Feb 2020 09:00:00 +0000", "old@shop")
+	write("inbox/0000000000000002-older.eml", "news@shop.com", "Sun, 10 Feb 2019 09:00:00 +0000", "older@shop")
+	write("inbox/0000000000000003-new.eml", "news@shop.com", "Mon, 10 Feb 2025 09:00:00 +0000", "new@shop")
+	write("inbox/0000000000000004-friend.eml", "friend@home.org", "Mon, 10 Feb 2020 09:00:00 +0000", "friend@home")
+
+	indexPath := filepath.Join(t.TempDir(), "index.parquet")
+	idx, err := index.New(dir, indexPath, nil, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer idx.Close()
+	if n, _ := idx.Build(); n != 4 {
+		t.Fatalf("indexed %d emails, want 4", n)
+	}
+
+	const q = "news@shop.com before:2024-01-01"
+	fields := []string{index.FieldFrom}
+	if got := idx.Search(q, 0, 0, fields...).Total; got != 2 {
+		t.Fatalf("Search(%q) total = %d, want 2", q, got)
+	}
+
+	// The limit removes the oldest match first.
+	res, err := idx.DeleteMatching(context.Background(), q, fields, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.Matched != 2 || res.Deleted != 1 || res.Files != 1 || res.Remaining != 1 {
+		t.Fatalf("first batch = %+v", res)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "inbox/0000000000000002-older.eml")); !os.IsNotExist(err) {
+		t.Error("oldest match should be deleted first")
+	}
+
+	res, err = idx.DeleteMatching(context.Background(), q, fields, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.Matched != 1 || res.Deleted != 1 || res.Files != 4 || res.Remaining != 0 {
+		t.Fatalf("second batch = %+v", res)
+	}
+	for _, rel := range []string{"inbox/0000000000000001-old.eml", "archive/0000000000000001-old.eml", "sent/0000000000000001beefcafe-old.eml", "promo/0000000000000009-old.eml"} {
+		if _, err := os.Stat(filepath.Join(dir, rel)); !os.IsNotExist(err) {
+			t.Errorf("%s should be deleted with its copies", rel)
+		}
+	}
+	for _, rel := range []string{"inbox/0000000000000003-new.eml", "inbox/0000000000000004-friend.eml"} {
+		if _, err := os.Stat(filepath.Join(dir, rel)); err != nil {
+			t.Errorf("%s should be kept: %v", rel, err)
+		}
+	}
+
+	if s := idx.Stats(); s.TotalEmails != 2 {
+		t.Errorf("total = %d, want 2", s.TotalEmails)
+	}
+	reloaded, err := index.New(dir, indexPath, nil, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer reloaded.Close()
+	if got := reloaded.Search("weekly", 0, 0).Total; got != 2 {
+		t.Errorf("reloaded total = %d, want 2", got)
+	}
+	if n, _ := reloaded.Build(); n != 2 {
+		t.Errorf("rebuild found %d emails, want 2", n)
+	}
+}
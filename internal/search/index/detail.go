@@ -0,0 +1,56 @@
+package index
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/eslider/mails/internal/search/eml"
+)
+
+// Detail returns the email at relPath as stored in the Parquet index at
+// indexPath, without reading the email file: headers, size, the body text
+// and, when the index was built with INDEX_HTML, the HTML body. CC,
+// Reply-To, attachments and the Received chain are not indexed and stay
+// empty. An email the index does not hold, or an index not built yet,
+// yields ErrNotIndexed.
+func Detail(ctx context.Context, indexPath, relPath string) (eml.FullEmail, error) {
+	if _, err := os.Stat(indexPath); err != nil {
+		return eml.FullEmail{}, ErrNotIndexed
+	}
+	db, err := openDuckDB()
+	if err != nil {
+		return eml.FullEmail{}, err
+	}
+	defer db.Close()
+
+	escaped := strings.ReplaceAll(indexPath, "'", "''")
+	body := "'' AS body_text"
+	if parquetHasColumn(ctx, db, escaped, "body_text") {
+		body = "body_text"
+	}
+	html := "'' AS html_body"
+	if parquetHasColumn(ctx, db, escaped, "html_body") {
+		html = "html_body"
+	}
+	relPath = filepath.Clean(relPath)
+	fe := eml.FullEmail{Path: relPath}
+	var date sql.NullTime
+	err = db.QueryRowContext(ctx,
+		fmt.Sprintf("SELECT subject, from_addr, to_addr, date, size, %s, %s FROM read_parquet('%s') WHERE path = ? LIMIT 1", body, html, escaped),
+		relPath).Scan(&fe.Subject, &fe.From, &fe.To, &date, &fe.Size, &fe.TextBody, &fe.HTMLBody)
+	if errors.Is(err, sql.ErrNoRows) {
+		return eml.FullEmail{}, ErrNotIndexed
+	}
+	if err != nil {
+		return eml.FullEmail{}, fmt.Errorf("read %s: %w", indexPath, err)
+	}
+	if date.Valid {
+		fe.Date = date.Time
+	}
+	return fe, nil
+}
@@ -0,0 +1,68 @@
+package index_test
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/eslider/mails/internal/search/eml"
+	"github.com/eslider/mails/internal/search/index"
+)
+
+func TestDetail(t *testing.T) {
+	const msg = "From: a@b.com\r\nTo: c@d.com\r\nSubject: Styled\r\nDate: Mon, 10 Feb 2025 14:30:00 +0000\r\n" +
+		"MIME-Version: 1.0\r\nContent-Type: text/html; charset=utf-8\r\n\r\n<p>Hello <b>there</b></p>\r\n"
+	build := func(t *testing.T, withHTML bool) string {
+		t.Helper()
+		eml.SetParseHTML(withHTML)
+		t.Cleanup(func() { eml.SetParseHTML(false) })
+		dir := t.TempDir()
+		os.MkdirAll(filepath.Join(dir, "inbox"), 0755)
+		os.WriteFile(filepath.Join(dir, "inbox", "a.eml"), []byte(msg), 0644)
+		indexPath := filepath.Join(t.TempDir(), "index.parquet")
+		idx, err := index.New(dir, indexPath, nil, "")
+		if err != nil {
+			t.Fatal(err)
+		}
+		idx.Build()
+		idx.Close()
+		// The index alone must answer.
+		os.RemoveAll(dir)
+		return indexPath
+	}
+	ctx := context.Background()
+
+	t.Run("with HTML", func(t *testing.T) {
+		indexPath := build(t, true)
+		fe, err := index.Detail(ctx, indexPath, filepath.Join("inbox", "a.eml"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if fe.Subject != "Styled" || fe.From != "a@b.com" || fe.Date.Year() != 2025 {
+			t.Errorf("headers = %q, %q, %v", fe.Subject, fe.From, fe.Date)
+		}
+		if !strings.Contains(fe.HTMLBody, "<b>there</b>") {
+			t.Errorf("html_body = %q", fe.HTMLBody)
+		}
+		if !strings.Contains(fe.TextBody, "Hello there") {
+			t.Errorf("text_body = %q", fe.TextBody)
+		}
+	})
+
+	t.Run("without HTML", func(t *testing.T) {
+		indexPath := build(t, false)
+		fe, err := index.Detail(ctx, indexPath, filepath.Join("inbox", "a.eml"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if fe.HTMLBody != "" || fe.Subject != "Styled" {
+			t.Errorf("subject %q, html_body %q; want no HTML", fe.Subject, fe.HTMLBody)
+		}
+		if _, err := index.Detail(ctx, indexPath, "inbox/missing.eml"); !errors.Is(err, index.ErrNotIndexed) {
+			t.Errorf("missing email: err = %v, want ErrNotIndexed", err)
+		}
+	})
+}
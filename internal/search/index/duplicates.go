@@ -0,0 +1,128 @@
+package index
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/eslider/mails/internal/checksum"
+)
+
+// DuplicateCopy is one stored copy of a duplicated message.
+type DuplicateCopy struct {
+	AccountID string `json:"account_id"`
+	Path      string `json:"path"`
+}
+
+// DuplicateCluster is a message stored more than once.
+type DuplicateCluster struct {
+	// By is "message_id" when the copies share a Message-ID, or
+	// "checksum" when they have none and share the checksum in their
+	// filenames (identical bytes); a shorter checksum of the same message
+	// counts as shared, and Key is then the longest.
+	By      string          `json:"by"`
+	Key     string          `json:"key"`
+	Subject string          `json:"subject"`
+	Size    int64           `json:"size"` // of the largest copy
+	Copies  []DuplicateCopy `json:"copies"`
+}
+
+// DuplicateReport lists the duplicated messages across account indexes.
+type DuplicateReport struct {
+	Emails   int                `json:"emails"`   // stored copies looked at
+	Clusters []DuplicateCluster `json:"clusters"` // most copies first
+	// Redundant counts the copies beyond the first of each cluster, and
+	// RedundantBytes their size: what pruning could free at most.
+	Redundant      int      `json:"redundant"`
+	RedundantBytes int64    `json:"redundant_bytes"`
+	Warnings       []string `json:"warnings,omitempty"`
+}
+
+// Duplicates reports messages stored more than once across the given
+// account indexes: copies with the same Message-ID, including those one
+// build folded into another's aliases, and copies without a Message-ID that
+// share a checksum. Files the walk skipped as checksum duplicates within
+// one account are not indexed and do not appear. Nothing is changed.
+func Duplicates(ctx context.Context, accounts []AccountIndex) (DuplicateReport, error) {
+	report := DuplicateReport{Clusters: []DuplicateCluster{}}
+	db, err := openDuckDB()
+	if err != nil {
+		return report, err
+	}
+	defer db.Close()
+
+	if _, err := db.ExecContext(ctx, `CREATE TEMP TABLE copies (
+		account_id VARCHAR, path VARCHAR, message_id VARCHAR, subject VARCHAR, size BIGINT)`); err != nil {
+		return report, fmt.Errorf("create: %w", err)
+	}
+	for _, a := range accounts {
+		if a.IndexPath == "" {
+			continue
+		}
+		if _, err := os.Stat(a.IndexPath); err != nil {
+			continue
+		}
+		escaped := strings.ReplaceAll(a.IndexPath, "'", "''")
+		id := strings.ReplaceAll(a.ID, "'", "''")
+		messageID := "'' AS message_id"
+		if parquetHasColumn(ctx, db, escaped, "message_id") {
+			messageID = "message_id"
+		}
+		sql := fmt.Sprintf("INSERT INTO copies SELECT '%s', path, %s, subject, size FROM read_parquet('%s')", id, messageID, escaped)
+		if parquetHasColumn(ctx, db, escaped, "aliases") {
+			// Copies folded into a canonical one by Message-ID.
+			sql += fmt.Sprintf(` UNION ALL SELECT '%s', unnest(string_split(aliases, '%s')), message_id, subject, size
+				FROM read_parquet('%s') WHERE aliases <> ''`, id, aliasSep, escaped)
+		}
+		if _, err := db.ExecContext(ctx, sql); err != nil {
+			if ctx.Err() != nil {
+				return report, ctx.Err()
+			}
+			report.Warnings = append(report.Warnings, fmt.Sprintf("account %s: search index could not be read and was skipped", a.ID))
+		}
+	}
+	if err := db.QueryRowContext(ctx, "SELECT COUNT(*) FROM copies").Scan(&report.Emails); err != nil {
+		return report, err
+	}
+
+	if err := createChecksumKeys(ctx, db, "copies"); err != nil {
+		return report, fmt.Errorf("checksum keys: %w", err)
+	}
+	rows, err := db.QueryContext(ctx, `WITH keyed AS (
+			SELECT c.*,
+				CASE WHEN c.message_id <> '' THEN 'message_id' ELSE 'checksum' END AS kind,
+				COALESCE(NULLIF(c.message_id, ''), k.key) AS key
+			FROM copies c
+			LEFT JOIN checksum_keys k ON k.cs = regexp_extract(c.path, '`+checksum.SQLPattern+`', 2)
+		), dup AS (
+			SELECT kind, key, COUNT(*) AS n FROM keyed WHERE key IS NOT NULL GROUP BY kind, key HAVING COUNT(*) > 1
+		)
+		SELECT k.kind, k.key, k.account_id, k.path, k.subject, k.size
+		FROM keyed k JOIN dup d ON k.kind = d.kind AND k.key = d.key
+		ORDER BY d.n DESC, k.kind DESC, k.key, k.account_id, k.path`)
+	if err != nil {
+		return report, fmt.Errorf("group: %w", err)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var kind, key, subject string
+		var c DuplicateCopy
+		var size int64
+		if err := rows.Scan(&kind, &key, &c.AccountID, &c.Path, &subject, &size); err != nil {
+			return report, err
+		}
+		n := len(report.Clusters)
+		if n == 0 || report.Clusters[n-1].By != kind || report.Clusters[n-1].Key != key {
+			report.Clusters = append(report.Clusters, DuplicateCluster{By: kind, Key: key, Subject: subject})
+			n++
+		} else {
+			report.Redundant++
+			report.RedundantBytes += size
+		}
+		cl := &report.Clusters[n-1]
+		cl.Copies = append(cl.Copies, c)
+		cl.Size = max(cl.Size, size)
+	}
+	return report, rows.Err()
+}
@@ -0,0 +1,81 @@
+package index_test
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/eslider/mails/internal/search/index"
+)
+
+func buildAccount(t *testing.T, files map[string]string) string {
+	t.Helper()
+	dir := t.TempDir()
+	for name, content := range files {
+		path := filepath.Join(dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	indexPath := filepath.Join(t.TempDir(), "index.parquet")
+	idx, err := index.New(dir, indexPath, nil, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	idx.Build()
+	idx.Close()
+	return indexPath
+}
+
+func TestDuplicates(t *testing.T) {
+	report := "From: a@test.com\r\nSubject: Report\r\nMessage-ID: <r@test>\r\nDate: Mon, 10 Feb 2025 09:00:00 +0000\r\n\r\nQ1 numbers.\r\n"
+	noID := "From: b@test.com\r\nSubject: No ID\r\nDate: Mon, 10 Feb 2025 10:00:00 +0000\r\n\r\nHello.\r\n"
+	unique := "From: c@test.com\r\nSubject: Unique\r\nMessage-ID: <u@test>\r\nDate: Mon, 10 Feb 2025 11:00:00 +0000\r\n\r\nOnly once.\r\n"
+
+	work := buildAccount(t, map[string]string{
+		"inbox/a.eml":                      report,
+		"archive/a.eml":                    report + "X-Archived: yes\r\n", // same Message-ID, folded into inbox/a.eml
+		"inbox/0123456789abcdef0123-1.eml": noID,
+		"inbox/u.eml":                      unique,
+	})
+	home := buildAccount(t, map[string]string{
+		"inbox/r.eml":                  report,
+		"inbox/0123456789abcdef-7.eml": noID, // named before CHECKSUM_LENGTH was 24
+	})
+
+	got, err := index.Duplicates(context.Background(), []index.AccountIndex{
+		{ID: "work", IndexPath: work},
+		{ID: "home", IndexPath: home},
+		{ID: "missing", IndexPath: filepath.Join(t.TempDir(), "none.parquet")},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.Emails != 6 || len(got.Clusters) != 2 || got.Redundant != 3 {
+		t.Fatalf("report = %+v, want 6 copies in 2 clusters with 3 redundant", got)
+	}
+	byID := got.Clusters[0]
+	if byID.By != "message_id" || byID.Key != "r@test" || byID.Subject != "Report" {
+		t.Errorf("first cluster = %+v, want the 3 copies of r@test", byID)
+	}
+	want := fmt.Sprint([]index.DuplicateCopy{
+		{AccountID: "home", Path: filepath.Join("inbox", "r.eml")},
+		{AccountID: "work", Path: filepath.Join("archive", "a.eml")},
+		{AccountID: "work", Path: filepath.Join("inbox", "a.eml")},
+	})
+	if fmt.Sprint(byID.Copies) != want {
+		t.Errorf("copies = %v, want %s", byID.Copies, want)
+	}
+	byChecksum := got.Clusters[1]
+	if byChecksum.By != "checksum" || byChecksum.Key != "0123456789abcdef0123" || len(byChecksum.Copies) != 2 {
+		t.Errorf("second cluster = %+v, want the 2 copies without Message-ID", byChecksum)
+	}
+	if got.RedundantBytes <= 0 {
+		t.Errorf("redundant bytes = %d, want > 0", got.RedundantBytes)
+	}
+}
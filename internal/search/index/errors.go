@@ -0,0 +1,89 @@
+package index
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"time"
+)
+
+// maxParseErrors caps how many failed files a build remembers; the total
+// keeps counting past it.
+const maxParseErrors = 500
+
+// ParseError is an email file the last build could not read or parse.
+type ParseError struct {
+	Path  string `json:"path"` // relative to the email directory
+	Error string `json:"error"`
+}
+
+// ParseErrorReport lists the files skipped by the last Build. Errors holds
+// at most maxParseErrors entries; Total counts them all.
+type ParseErrorReport struct {
+	Total   int          `json:"total"`
+	Errors  []ParseError `json:"errors"`
+	BuiltAt time.Time    `json:"built_at,omitzero"`
+}
+
+func (r *ParseErrorReport) add(path string, err error) {
+	r.Total++
+	if len(r.Errors) < maxParseErrors {
+		r.Errors = append(r.Errors, ParseError{Path: path, Error: err.Error()})
+	}
+}
+
+// parseErrorsPath is where the last build's report is kept, next to the
+// Parquet file.
+func (idx *Index) parseErrorsPath() string {
+	if idx.indexPath == "" {
+		return ""
+	}
+	return parseErrorsPath(idx.indexPath)
+}
+
+func parseErrorsPath(indexPath string) string {
+	return indexPath + ".errors.json"
+}
+
+func (idx *Index) saveParseErrors(r ParseErrorReport) error {
+	path := idx.parseErrorsPath()
+	if path == "" {
+		return nil
+	}
+	data, err := json.Marshal(r)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, data, 0o644)
+}
+
+// ParseErrors returns the report of the last Build: from memory when this
+// index built it, otherwise from the file saved next to the Parquet index.
+func (idx *Index) ParseErrors() (ParseErrorReport, error) {
+	idx.mu.RLock()
+	r, ok := idx.parseErrors, !idx.parseErrors.BuiltAt.IsZero()
+	idx.mu.RUnlock()
+	if ok || idx.indexPath == "" {
+		return r, nil
+	}
+	return LoadParseErrors(idx.indexPath)
+}
+
+// LoadParseErrors reads the report saved by the last Build of the index
+// at indexPath without loading the index itself. An index built before
+// reports were kept yields an empty report.
+func LoadParseErrors(indexPath string) (ParseErrorReport, error) {
+	var r ParseErrorReport
+	data, err := os.ReadFile(parseErrorsPath(indexPath))
+	if errors.Is(err, os.ErrNotExist) {
+		return r, nil
+	}
+	if err != nil {
+		return r, err
+	}
+	if err := json.Unmarshal(data, &r); err != nil {
+		return r, fmt.Errorf("parse %s: %w", parseErrorsPath(indexPath), err)
+	}
+	return r, nil
+}
@@ -0,0 +1,66 @@
+package index_test
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/eslider/mails/internal/search/index"
+)
+
+func TestParseErrorReport(t *testing.T) {
+	dir := t.TempDir()
+	seedEmails(t, dir)
+	inbox := filepath.Join(dir, "test-account", "inbox")
+	if err := os.WriteFile(filepath.Join(inbox, "empty.eml"), nil, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(inbox, "garbled.eml"), []byte("not a header line\r\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	indexPath := filepath.Join(t.TempDir(), "index.parquet")
+	idx, err := index.New(dir, indexPath, nil, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer idx.Close()
+	if _, errCount := idx.Build(); errCount != 2 {
+		t.Fatalf("errCount = %d, want 2", errCount)
+	}
+
+	report, err := idx.ParseErrors()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.Total != 2 || len(report.Errors) != 2 || report.BuiltAt.IsZero() {
+		t.Fatalf("report = %+v", report)
+	}
+	failed := map[string]string{}
+	for _, e := range report.Errors {
+		failed[e.Path] = e.Error
+		if strings.Contains(e.Error, dir) {
+			t.Errorf("error %q exposes the email directory", e.Error)
+		}
+	}
+	for _, name := range []string{"empty.eml", "garbled.eml"} {
+		if failed[filepath.Join("test-account", "inbox", name)] == "" {
+			t.Errorf("%s missing from report %+v", name, report.Errors)
+		}
+	}
+
+	// The report outlives the process, next to the Parquet file.
+	saved, err := index.LoadParseErrors(indexPath)
+	if err != nil || saved.Total != 2 || len(saved.Errors) != 2 {
+		t.Errorf("LoadParseErrors = %+v, %v", saved, err)
+	}
+	if empty, err := index.LoadParseErrors(filepath.Join(t.TempDir(), "none.parquet")); err != nil || empty.Total != 0 {
+		t.Errorf("LoadParseErrors(no build) = %+v, %v", empty, err)
+	}
+
+	idx.ClearCache()
+	if _, err := os.Stat(indexPath + ".errors.json"); !os.IsNotExist(err) {
+		t.Errorf("ClearCache kept the report: %v", err)
+	}
+}
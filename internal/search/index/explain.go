@@ -0,0 +1,119 @@
+package index
+
+import (
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/eslider/mails/internal/search/eml"
+)
+
+// Explanation says why a hit matched its query, for explain=1 debugging.
+// Hits are ordered by date, newest first, so there is no relevance score
+// to break down.
+type Explanation struct {
+	// Matches lists where each searched term was found: the free text in
+	// any searched field, and from:, to: and subject: values in theirs.
+	Matches []Match `json:"matches"`
+	// Filters are the other operators of the query, which every hit meets,
+	// written as in a query: "attachments:>0", "after:2024-01-01",
+	// "header:list-id:announce", "flagged:true", "vfolder:invoices".
+	Filters []string `json:"filters,omitempty"`
+}
+
+// Match is a term found in one field of a hit.
+type Match struct {
+	Field string `json:"field"` // see ParseFields
+	Term  string `json:"term"`  // normalized and lower-cased, as searched
+}
+
+// Explain returns why h, a hit of query searched over fields, matched. It
+// reads the hit as the scan left it: the body is the window snippets are
+// cut from, so a body match shows there as it does in the snippet. Nil
+// for the empty query, which matches everything.
+func Explain(query string, fields []string, h Hit) *Explanation {
+	q := strings.ToLower(strings.TrimSpace(query))
+	if q == "" {
+		return nil
+	}
+	if len(fields) == 0 {
+		fields = DefaultFields
+	}
+	pq := parseQuery(q)
+	if pq.InAttachment {
+		fields = []string{FieldAttachment}
+	}
+
+	ex := &Explanation{Matches: []Match{}}
+	if pq.Text != "" {
+		// Attachment text is only scanned for in:attachment; when it was
+		// searched but not read, it matched if nothing read did.
+		var unread []string
+		for _, f := range fields {
+			if f == FieldBody && !eml.ParsesBody() {
+				continue
+			}
+			text, ok := hitField(h, f, pq.InAttachment)
+			if !ok {
+				unread = append(unread, f)
+				continue
+			}
+			if strings.Contains(strings.ToLower(text), pq.Text) {
+				ex.Matches = append(ex.Matches, Match{Field: f, Term: pq.Text})
+			}
+		}
+		if len(ex.Matches) == 0 {
+			for _, f := range unread {
+				ex.Matches = append(ex.Matches, Match{Field: f, Term: pq.Text})
+			}
+		}
+	}
+	for _, f := range pq.Fields {
+		ex.Matches = append(ex.Matches, Match{Field: f.Field, Term: f.Value})
+	}
+	for _, f := range pq.Attachments {
+		ex.Filters = append(ex.Filters, "attachments:"+f.Op+strconv.Itoa(f.N))
+	}
+	for _, hf := range pq.Headers {
+		filter := "header:" + hf.Name
+		if hf.Value != "" {
+			filter += ":" + hf.Value
+		}
+		ex.Filters = append(ex.Filters, filter)
+	}
+	for _, f := range pq.Marks {
+		ex.Filters = append(ex.Filters, f.Mark+":"+strconv.FormatBool(f.Want))
+	}
+	for _, name := range pq.Folders {
+		if strings.Contains(name, " ") {
+			name = strconv.Quote(name)
+		}
+		ex.Filters = append(ex.Filters, "vfolder:"+name)
+	}
+	if !pq.After.IsZero() {
+		ex.Filters = append(ex.Filters, "after:"+pq.After.Format(time.DateOnly))
+	}
+	if !pq.Before.IsZero() {
+		ex.Filters = append(ex.Filters, "before:"+pq.Before.Format(time.DateOnly))
+	}
+	return ex
+}
+
+// hitField returns the text of field in h, and false when the scan did not
+// read it. BodyText holds whichever of body and attachment text bodyColumn
+// selected: the attachment text for in:attachment queries.
+func hitField(h Hit, field string, inAttachment bool) (string, bool) {
+	switch field {
+	case FieldSubject:
+		return h.Subject, true
+	case FieldFrom:
+		return h.From, true
+	case FieldTo:
+		return h.To, true
+	case FieldBody:
+		return h.BodyText, !inAttachment
+	case FieldAttachment:
+		return h.BodyText, inAttachment
+	}
+	return "", false
+}
@@ -0,0 +1,65 @@
+package index_test
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/eslider/mails/internal/search/index"
+)
+
+func TestExplain(t *testing.T) {
+	dir := t.TempDir()
+	seedEmails(t, dir)
+	idx := newTestIndex(t, dir)
+	idx.Build()
+
+	explain := func(query string, fields ...string) []*index.Explanation {
+		t.Helper()
+		var out []*index.Explanation
+		for _, h := range idx.Search(query, 0, 10, fields...).Hits {
+			out = append(out, index.Explain(query, fields, h))
+		}
+		return out
+	}
+
+	// "alice" is the sender of one email and a recipient of the others.
+	got := explain("Alice")
+	if len(got) != 3 {
+		t.Fatalf("hits = %d, want 3", len(got))
+	}
+	for _, ex := range got {
+		if len(ex.Matches) != 1 || ex.Matches[0].Term != "alice" ||
+			(ex.Matches[0].Field != index.FieldFrom && ex.Matches[0].Field != index.FieldTo) {
+			t.Errorf("alice matches = %+v, want one from or to", ex.Matches)
+		}
+	}
+
+	// A body match is found in the window the snippet is cut from.
+	got = explain("trampoline")
+	if len(got) != 1 || !reflect.DeepEqual(got[0].Matches, []index.Match{{Field: index.FieldBody, Term: "trampoline"}}) {
+		t.Errorf("trampoline = %+v, want a body match", got)
+	}
+
+	// Only the searched fields are reported.
+	got = explain("meeting", index.FieldSubject)
+	if len(got) != 2 || !reflect.DeepEqual(got[0].Matches, []index.Match{{Field: index.FieldSubject, Term: "meeting"}}) {
+		t.Errorf("meeting in subject = %+v", got)
+	}
+
+	got = explain("from:carol invoice after:2025-02-11 has:attachment")
+	if len(got) != 0 {
+		t.Fatalf("has:attachment matched %d emails without attachments", len(got))
+	}
+	got = explain("from:carol invoice after:2025-02-11")
+	want := &index.Explanation{
+		Matches: []index.Match{{Field: index.FieldSubject, Term: "invoice"}, {Field: index.FieldBody, Term: "invoice"}, {Field: index.FieldFrom, Term: "carol"}},
+		Filters: []string{"after:2025-02-11"},
+	}
+	if len(got) != 1 || !reflect.DeepEqual(got[0], want) {
+		t.Errorf("operators = %+v, want %+v", got, want)
+	}
+
+	if ex := index.Explain("", nil, index.Hit{}); ex != nil {
+		t.Errorf("empty query explanation = %+v, want nil", ex)
+	}
+}
@@ -0,0 +1,140 @@
+package index
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/eslider/mails/internal/search/eml"
+)
+
+// Searchable fields for keyword search, as accepted by the fields= parameter.
+const (
+	FieldSubject = "subject"
+	FieldBody    = "body"
+	FieldFrom    = "from"
+	FieldTo      = "to"
+	// FieldAttachment is the text of attachments, indexed only with
+	// INDEX_ATTACHMENTS. It is not a default field; in:attachment selects it.
+	FieldAttachment = "attachment"
+)
+
+// DefaultFields are matched when no fields are given.
+var DefaultFields = []string{FieldSubject, FieldBody, FieldFrom, FieldTo}
+
+// fieldColumns maps a field name to its column in the emails table.
+var fieldColumns = map[string]string{
+	FieldSubject: "subject",
+	FieldBody:    "body_text",
+	FieldFrom:    "from_addr",
+	FieldTo:      "to_addr",
+
+	FieldAttachment: "attachment_text",
+}
+
+// ParseFields parses a comma-separated field list such as "subject,from".
+// An empty string yields DefaultFields.
+func ParseFields(s string) ([]string, error) {
+	if strings.TrimSpace(s) == "" {
+		return DefaultFields, nil
+	}
+	var fields []string
+	for _, f := range strings.Split(s, ",") {
+		f = strings.ToLower(strings.TrimSpace(f))
+		if f == "" {
+			continue
+		}
+		if _, ok := fieldColumns[f]; !ok {
+			return nil, fmt.Errorf("unknown search field %q (want subject, body, from, to or attachment)", f)
+		}
+		fields = append(fields, f)
+	}
+	if len(fields) == 0 {
+		return DefaultFields, nil
+	}
+	return fields, nil
+}
+
+// matchClause builds the WHERE predicate for q (already lower-cased): its
+// free text must match one of fields and every operator (see parseQuery)
+// must hold. flagged:, starred: and vfolder: are answered from ctx's Marks.
+func matchClause(ctx context.Context, q string, fields []string) (string, []any) {
+	if len(fields) == 0 {
+		fields = DefaultFields
+	}
+	pq := parseQuery(q)
+	if pq.InAttachment {
+		fields = []string{FieldAttachment}
+	}
+	var preds []string
+	var args []any
+	if pq.Text != "" {
+		parts := make([]string, 0, len(fields))
+		for _, f := range fields {
+			col, ok := fieldColumns[f]
+			if !ok || (f == FieldBody && !eml.ParsesBody()) {
+				continue
+			}
+			parts = append(parts, fmt.Sprintf("contains(LOWER(%s), ?)", col))
+			args = append(args, pq.Text)
+		}
+		if len(parts) == 0 {
+			// Only fields that are not indexed, such as body with
+			// INDEX_BODY=false: nothing matches.
+			preds = append(preds, "FALSE")
+		} else {
+			preds = append(preds, "("+strings.Join(parts, " OR ")+")")
+		}
+	}
+	if pq.InAttachment && pq.Text == "" {
+		preds = append(preds, "attachment_text <> ''")
+	}
+	for _, f := range pq.Attachments {
+		preds = append(preds, "attachment_count "+f.Op+" ?")
+		args = append(args, f.N)
+	}
+	for _, f := range pq.Fields {
+		preds = append(preds, fmt.Sprintf("contains(LOWER(%s), ?)", fieldColumns[f.Field]))
+		args = append(args, f.Value)
+	}
+	for _, h := range pq.Headers {
+		value := "COALESCE(json_extract_string(extra, ?), '')"
+		args = append(args, `$."`+h.Name+`"`)
+		if h.Value == "" {
+			preds = append(preds, value+" <> ''")
+			continue
+		}
+		preds = append(preds, "contains(LOWER("+value+"), ?)")
+		args = append(args, h.Value)
+	}
+	if len(pq.Marks) > 0 {
+		marks := marksFrom(ctx)
+		for _, f := range pq.Marks {
+			keys := marks.Flagged
+			if f.Mark == "starred" {
+				keys = marks.Starred
+			}
+			preds = append(preds, markPredicate(keys, f.Want))
+		}
+	}
+	if len(pq.Folders) > 0 {
+		folders := marksFrom(ctx).Folders
+		for _, name := range pq.Folders {
+			pred, predArgs := folderPredicate(folders[name], name)
+			preds = append(preds, pred)
+			args = append(args, predArgs...)
+		}
+	}
+	if !pq.Before.IsZero() {
+		preds = append(preds, "date < ?")
+		args = append(args, pq.Before)
+	}
+	if !pq.After.IsZero() {
+		preds = append(preds, "date >= ?")
+		args = append(args, pq.After)
+	}
+	if len(preds) == 0 {
+		return "TRUE", nil
+	}
+	return strings.Join(preds, " AND "), args
+}
@@ -0,0 +1,123 @@
+package index
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"log"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/eslider/mails/internal/search/eml"
+)
+
+// fingerprint summarises the set of email files without reading them: the
+// sorted paths of every .eml file plus, on the filesystem, their sizes and
+// modification times. Blob keys carry a content checksum, so keys alone
+// are enough there. Files in excluded folders are left out, and the
+// exclude patterns themselves are included.
+func (idx *Index) fingerprint() (string, error) {
+	idx.mu.RLock()
+	exclude := idx.exclude
+	idx.mu.RUnlock()
+	var entries []string
+	if exclude != "" {
+		entries = append(entries, "exclude\x00"+exclude)
+	}
+	if idx.blobStore != nil && idx.emailKeyPref != "" {
+		keys, err := idx.blobStore.List(context.Background(), idx.emailKeyPref)
+		if err != nil {
+			return "", err
+		}
+		for _, k := range keys {
+			rel := strings.TrimPrefix(strings.TrimPrefix(k, idx.emailKeyPref), "/")
+			if eml.IsEmailFile(k) && !excludedDir(exclude, path.Dir(rel)) {
+				entries = append(entries, k)
+			}
+		}
+	} else {
+		err := filepath.WalkDir(idx.emailDir, func(p string, d os.DirEntry, err error) error {
+			if err != nil {
+				return nil
+			}
+			if d.IsDir() {
+				if walkExcluded(exclude, idx.emailDir, p) {
+					return filepath.SkipDir
+				}
+				return nil
+			}
+			if !eml.IsEmailFile(d.Name()) {
+				return nil
+			}
+			info, err := d.Info()
+			if err != nil {
+				return nil
+			}
+			entries = append(entries, fmt.Sprintf("%s\x00%d\x00%d", p, info.Size(), info.ModTime().UnixNano()))
+			return nil
+		})
+		if err != nil {
+			return "", err
+		}
+	}
+	sort.Strings(entries)
+	h := sha256.New()
+	for _, e := range entries {
+		h.Write([]byte(e))
+		h.Write([]byte{'\n'})
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// fingerprintPath is where the fingerprint of the last build is kept,
+// next to the Parquet file.
+func (idx *Index) fingerprintPath() string {
+	if idx.indexPath == "" {
+		return ""
+	}
+	return idx.indexPath + ".fingerprint"
+}
+
+// UpToDate reports whether the saved index was built from exactly the
+// email files present now. Without a saved index, or when NeedsRebuild,
+// it is always false.
+func (idx *Index) UpToDate() bool {
+	path := idx.fingerprintPath()
+	if path == "" || idx.NeedsRebuild() {
+		return false
+	}
+	saved, err := os.ReadFile(path)
+	if err != nil {
+		return false
+	}
+	if _, err := os.Stat(idx.indexPath); err != nil {
+		return false
+	}
+	fp, err := idx.fingerprint()
+	return err == nil && fp == strings.TrimSpace(string(saved))
+}
+
+// BuildIfChanged runs Build unless the index is UpToDate. It reports
+// whether a build ran, with Build's counts (zero when skipped).
+func (idx *Index) BuildIfChanged() (built bool, count, errCount int) {
+	if idx.UpToDate() {
+		return false, 0, 0
+	}
+	count, errCount = idx.Build()
+	return true, count, errCount
+}
+
+// saveFingerprint records fp as the fingerprint of the saved index.
+func (idx *Index) saveFingerprint(fp string) {
+	path := idx.fingerprintPath()
+	if path == "" || fp == "" {
+		return
+	}
+	if err := os.WriteFile(path, []byte(fp+"\n"), 0o644); err != nil {
+		log.Printf("WARN: save index fingerprint: %v", err)
+	}
+}
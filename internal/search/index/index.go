@@ -4,24 +4,27 @@ package index
 import (
 	"context"
 	"database/sql"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"log"
 	"os"
+	"path"
 	"path/filepath"
-	"regexp"
+	"slices"
+	"strconv"
 	"strings"
 	"sync"
 	"time"
 
 	_ "github.com/marcboeker/go-duckdb"
 
+	"github.com/eslider/mails/internal/checksum"
+	"github.com/eslider/mails/internal/model"
 	"github.com/eslider/mails/internal/search/eml"
 	"github.com/eslider/mails/internal/storage"
 )
 
-// reChecksum matches the 16-hex-char checksum prefix in filenames like "a1b2c3d4e5f67890-123.eml".
-var reChecksum = regexp.MustCompile(`^([0-9a-f]{16})-`)
-
 // Index stores parsed email metadata in a DuckDB in-memory database,
 // persisted to a Parquet file with zstd compression.
 type Index struct {
@@ -33,6 +36,11 @@ type Index struct {
 	blobStore    storage.BlobStore
 	emailKeyPref string // key prefix when using blobStore
 	total        int
+	parseErrors  ParseErrorReport // files skipped by the last Build in this process
+	exclude      string           // folder patterns Build skips, see SetExcludeFolders
+	loadError    string           // why the Parquet file was not served on open, see New
+	needsRebuild bool             // set by New until the next Build, see NeedsRebuild
+	schema       int              // SchemaVersion of the loaded file or the last Build
 }
 
 const createTableSQL = `CREATE TABLE IF NOT EXISTS emails (
@@ -42,18 +50,41 @@ const createTableSQL = `CREATE TABLE IF NOT EXISTS emails (
 	to_addr   VARCHAR NOT NULL DEFAULT '',
 	date      TIMESTAMP,
 	size      BIGINT  NOT NULL DEFAULT 0,
-	body_text VARCHAR NOT NULL DEFAULT ''
+	body_text VARCHAR NOT NULL DEFAULT '',
+	message_id VARCHAR NOT NULL DEFAULT '',
+	aliases   VARCHAR NOT NULL DEFAULT '',
+	attachment_count INTEGER NOT NULL DEFAULT 0,
+	extra     VARCHAR NOT NULL DEFAULT '{}',
+	html_body VARCHAR NOT NULL DEFAULT '',
+	thread_id VARCHAR NOT NULL DEFAULT '',
+	attachment_text VARCHAR NOT NULL DEFAULT ''
 )`
 
+// SchemaVersion is the version of the emails table layout, kept in the
+// key/value metadata of the Parquet files saveParquet writes. Bump it when
+// existing indexes must be rebuilt to serve a change, rather than patched
+// up by loadParquet; New flags files written with an older version with
+// NeedsRebuild (files from before the marker count as 0).
+const SchemaVersion = 1
+
+// schemaVersionKey names SchemaVersion in Parquet key/value metadata.
+const schemaVersionKey = "mails_schema_version"
+
+// aliasSep separates paths in the aliases column.
+const aliasSep = "\n"
+
 // New creates a new index. If indexPath points to an existing Parquet file,
-// the index is loaded from it (fast startup).
+// the index is loaded from it (fast startup). A file that cannot be loaded
+// or fails checkLoaded is not served: the index opens empty. A file with an
+// older SchemaVersion is served as it is. Either way NeedsRebuild reports
+// it, so the caller builds once it has called SetExcludeFolders; Stats says
+// why. Without emails to rebuild from, an older file is not flagged.
 // blobStore and usersDir are optional; when set, emails are read from S3.
 func New(emailDir, indexPath string, blobStore storage.BlobStore, usersDir string) (*Index, error) {
-	db, err := sql.Open("duckdb", "")
+	db, err := openDuckDB()
 	if err != nil {
-		return nil, fmt.Errorf("open duckdb: %w", err)
+		return nil, err
 	}
-	db.SetMaxOpenConns(1)
 
 	idx := &Index{
 		db:        db,
@@ -71,13 +102,25 @@ func New(emailDir, indexPath string, blobStore storage.BlobStore, usersDir strin
 	if indexPath != "" {
 		if info, statErr := os.Stat(indexPath); statErr == nil && info.Size() > 0 {
 			count, loadErr := idx.loadParquet()
+			if loadErr == nil {
+				loadErr = idx.checkLoaded()
+			}
 			if loadErr == nil {
 				idx.total = count
 				idx.buildAt = info.ModTime()
+				idx.schema = idx.fileSchemaVersion()
 				log.Printf("Loaded %d emails from %s", count, indexPath)
+				if idx.schema < SchemaVersion && idx.canBuild() {
+					idx.loadError = fmt.Sprintf("schema version %d is older than %d", idx.schema, SchemaVersion)
+					idx.needsRebuild = true
+					log.Printf("WARN: %s: %s, needs a rebuild", indexPath, idx.loadError)
+				}
 				return idx, nil
 			}
-			log.Printf("WARN: could not load %s: %v, will rebuild", indexPath, loadErr)
+			log.Printf("WARN: %s: %v, needs a rebuild", indexPath, loadErr)
+			idx.loadError = loadErr.Error()
+			idx.needsRebuild = true
+			idx.db.Exec("DROP TABLE IF EXISTS emails")
 		}
 	}
 
@@ -88,6 +131,118 @@ func New(emailDir, indexPath string, blobStore storage.BlobStore, usersDir strin
 	return idx, nil
 }
 
+// NeedsRebuild reports whether New found the Parquet file unusable or of
+// an older SchemaVersion and no Build has run since. An unusable file
+// leaves the index empty until built.
+func (idx *Index) NeedsRebuild() bool {
+	idx.mu.RLock()
+	defer idx.mu.RUnlock()
+	return idx.needsRebuild
+}
+
+// canBuild reports whether Build has emails to read: an email directory
+// or a blob store prefix.
+func (idx *Index) canBuild() bool {
+	return idx.emailDir != "" || idx.emailKeyPref != ""
+}
+
+// fileSchemaVersion returns the SchemaVersion saveParquet recorded in the
+// Parquet file, or 0 when it has none.
+func (idx *Index) fileSchemaVersion() int {
+	escaped := strings.ReplaceAll(idx.indexPath, "'", "''")
+	var v string
+	err := idx.db.QueryRow(fmt.Sprintf(
+		"SELECT decode(value) FROM parquet_kv_metadata('%s') WHERE decode(key) = '%s'", escaped, schemaVersionKey)).Scan(&v)
+	if err != nil {
+		return 0
+	}
+	n, _ := strconv.Atoi(v)
+	return n
+}
+
+// requiredColumns are the columns every index has had since the first
+// release, with the DuckDB type each must load as (a prefix, so TIMESTAMP
+// also accepts TIMESTAMP WITH TIME ZONE). loadParquet adds the later ones.
+var requiredColumns = []struct{ name, typ string }{
+	{"path", "VARCHAR"},
+	{"subject", "VARCHAR"},
+	{"from_addr", "VARCHAR"},
+	{"to_addr", "VARCHAR"},
+	{"date", "TIMESTAMP"},
+	{"size", "BIGINT"},
+}
+
+// checkLoaded verifies that the table loadParquet created has the required
+// columns and can be queried, so a truncated or foreign Parquet file is
+// rebuilt rather than failing every search.
+func (idx *Index) checkLoaded() error {
+	rows, err := idx.db.Query(
+		"SELECT column_name, data_type FROM information_schema.columns WHERE table_name = 'emails'")
+	if err != nil {
+		return fmt.Errorf("integrity check: %w", err)
+	}
+	types := map[string]string{}
+	for rows.Next() {
+		var name, typ string
+		if err := rows.Scan(&name, &typ); err != nil {
+			rows.Close()
+			return fmt.Errorf("integrity check: %w", err)
+		}
+		types[name] = typ
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("integrity check: %w", err)
+	}
+	for _, col := range requiredColumns {
+		typ, ok := types[col.name]
+		if !ok {
+			return fmt.Errorf("integrity check: missing column %s", col.name)
+		}
+		if !strings.HasPrefix(typ, col.typ) {
+			return fmt.Errorf("integrity check: column %s is %s, want %s", col.name, typ, col.typ)
+		}
+	}
+	if _, err := idx.db.Exec("SELECT COUNT(path), MAX(date), SUM(size) FROM emails"); err != nil {
+		return fmt.Errorf("integrity check: %w", err)
+	}
+	return nil
+}
+
+// SetExcludeFolders makes Build skip the email directory's folders that
+// match patterns, an account's ExcludeFolders (see model.FolderExcluded).
+// Changing them makes the index out of date.
+func (idx *Index) SetExcludeFolders(patterns string) {
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+	idx.exclude = patterns
+}
+
+// excludedDir reports whether dir, relative to the email directory, or
+// one of its parents matches the exclude patterns.
+func excludedDir(exclude, dir string) bool {
+	if exclude == "" {
+		return false
+	}
+	for dir = filepath.ToSlash(dir); dir != "." && dir != "/" && dir != ""; dir = path.Dir(dir) {
+		if model.FolderExcluded(exclude, dir) {
+			return true
+		}
+	}
+	return false
+}
+
+// walkExcluded reports whether a walk of root should skip the directory
+// dir because it matches the exclude patterns; its parents were checked on
+// the way down.
+func walkExcluded(exclude, root, dir string) bool {
+	if exclude == "" {
+		return false
+	}
+	rel, err := filepath.Rel(root, dir)
+	return err == nil && rel != "." && model.FolderExcluded(exclude, filepath.ToSlash(rel))
+}
+
 // Close releases the DuckDB database connection.
 func (idx *Index) Close() error {
 	if idx.db != nil {
@@ -105,12 +260,43 @@ func (idx *Index) ClearCache() {
 	idx.db.Exec("DROP TABLE IF EXISTS emails")
 	if idx.indexPath != "" {
 		os.Remove(idx.indexPath)
+		os.Remove(idx.fingerprintPath())
+		os.Remove(idx.parseErrorsPath())
 	}
+	idx.parseErrors = ParseErrorReport{}
 	idx.total = 0
+	idx.schema = 0
 	idx.buildAt = time.Time{}
 	log.Printf("INFO: index cache cleared (%s)", idx.indexPath)
 }
 
+// openDuckDB opens an in-memory DuckDB with a single connection. DUCKDB_MEMORY_LIMIT
+// (e.g. "512MB") and DUCKDB_TEMP_DIR (spill directory) are applied when set;
+// otherwise DuckDB's defaults are left alone.
+func openDuckDB() (*sql.DB, error) {
+	db, err := sql.Open("duckdb", "")
+	if err != nil {
+		return nil, fmt.Errorf("open duckdb: %w", err)
+	}
+	db.SetMaxOpenConns(1)
+
+	for _, setting := range []struct{ name, env string }{
+		{"memory_limit", "DUCKDB_MEMORY_LIMIT"},
+		{"temp_directory", "DUCKDB_TEMP_DIR"},
+	} {
+		v := strings.TrimSpace(os.Getenv(setting.env))
+		if v == "" {
+			continue
+		}
+		escaped := strings.ReplaceAll(v, "'", "''")
+		if _, err := db.Exec(fmt.Sprintf("SET %s = '%s'", setting.name, escaped)); err != nil {
+			db.Close()
+			return nil, fmt.Errorf("%s=%q: %w", setting.env, v, err)
+		}
+	}
+	return db, nil
+}
+
 func (idx *Index) loadParquet() (int, error) {
 	escaped := strings.ReplaceAll(idx.indexPath, "'", "''")
 	if _, err := idx.db.Exec(
@@ -118,6 +304,24 @@ func (idx *Index) loadParquet() (int, error) {
 	); err != nil {
 		return 0, fmt.Errorf("load parquet: %w", err)
 	}
+	// Indexes written before Message-ID dedup lack these columns, body-less
+	// ones (INDEX_BODY=false) lack body_text, and most lack html_body.
+	// Without thread_id, written before threading, every email is its own
+	// thread until the next build. Only INDEX_ATTACHMENTS builds keep
+	// attachment_text.
+	for _, col := range []string{"message_id", "aliases", "body_text", "html_body", "thread_id", "attachment_text"} {
+		if _, err := idx.db.Exec("ALTER TABLE emails ADD COLUMN IF NOT EXISTS " + col + " VARCHAR DEFAULT ''"); err != nil {
+			return 0, fmt.Errorf("load parquet: add %s: %w", col, err)
+		}
+	}
+	// Older indexes also lack attachment counts; they read as 0 until rebuilt.
+	if _, err := idx.db.Exec("ALTER TABLE emails ADD COLUMN IF NOT EXISTS attachment_count INTEGER DEFAULT 0"); err != nil {
+		return 0, fmt.Errorf("load parquet: add attachment_count: %w", err)
+	}
+	// ... and the INDEX_HEADERS values.
+	if _, err := idx.db.Exec("ALTER TABLE emails ADD COLUMN IF NOT EXISTS extra VARCHAR DEFAULT '{}'"); err != nil {
+		return 0, fmt.Errorf("load parquet: add extra: %w", err)
+	}
 	var n int
 	if err := idx.db.QueryRow("SELECT COUNT(*) FROM emails").Scan(&n); err != nil {
 		return 0, err
@@ -136,37 +340,52 @@ func (idx *Index) saveParquet() error {
 	}
 	os.Remove(idx.indexPath)
 	escaped := strings.ReplaceAll(idx.indexPath, "'", "''")
-	_, err := idx.db.Exec(
-		fmt.Sprintf("COPY emails TO '%s' (FORMAT PARQUET, CODEC 'ZSTD')", escaped))
+	var exclude []string
+	if !eml.ParsesBody() {
+		exclude = append(exclude, "body_text")
+	}
+	if !eml.ParsesHTML() {
+		exclude = append(exclude, "html_body")
+	}
+	if !eml.ParsesAttachments() {
+		exclude = append(exclude, "attachment_text")
+	}
+	source := "emails"
+	if len(exclude) > 0 {
+		source = "(SELECT * EXCLUDE (" + strings.Join(exclude, ", ") + ") FROM emails)"
+	}
+	_, err := idx.db.Exec(fmt.Sprintf(
+		"COPY %s TO '%s' (FORMAT PARQUET, CODEC 'ZSTD', KV_METADATA {%s: '%d'})", source, escaped, schemaVersionKey, SchemaVersion))
 	return err
 }
 
-func walkEmailsFromBlobStore(blob storage.BlobStore, prefix string) ([]eml.Email, int) {
+func walkEmailsFromBlobStore(blob storage.BlobStore, prefix, exclude string) ([]eml.Email, ParseErrorReport) {
 	ctx := context.Background()
+	var report ParseErrorReport
 	keys, err := blob.List(ctx, prefix)
 	if err != nil {
 		log.Printf("WARN: list %s: %v", prefix, err)
-		return nil, 0
+		return nil, report
 	}
 	var parsed []eml.Email
-	var errCount int
+	var sums []string
+	for _, k := range keys {
+		if eml.IsEmailFile(k) {
+			sums = append(sums, extractChecksum(filepath.Base(k)))
+		}
+	}
+	copyKeys := checksumKeys(sums)
 	seen := make(map[string]bool)
 	for _, k := range keys {
-		if !strings.HasSuffix(strings.ToLower(k), ".eml") {
+		if !eml.IsEmailFile(k) {
 			continue
 		}
 		name := filepath.Base(k)
 		if cs := extractChecksum(name); cs != "" {
-			if seen[cs] {
+			if seen[copyKeys[cs]] {
 				continue
 			}
-			seen[cs] = true
-		}
-		data, err := blob.Read(ctx, k)
-		if err != nil {
-			log.Printf("WARN: read %s: %v", k, err)
-			errCount++
-			continue
+			seen[copyKeys[cs]] = true
 		}
 		relPath := k
 		if strings.HasPrefix(k, prefix+"/") {
@@ -177,63 +396,134 @@ func walkEmailsFromBlobStore(blob storage.BlobStore, prefix string) ([]eml.Email
 				relPath = relPath[1:]
 			}
 		}
+		if excludedDir(exclude, path.Dir(relPath)) {
+			continue
+		}
+		data, err := blob.Read(ctx, k)
+		if err == nil {
+			data, err = eml.Decompress(relPath, data)
+		}
+		if err != nil {
+			log.Printf("WARN: read %s: %v", k, err)
+			report.add(relPath, fmt.Errorf("read: %w", err))
+			continue
+		}
 		e, parseErr := eml.ParseBytes(relPath, data)
 		if parseErr != nil {
 			log.Printf("WARN: parse %s: %v", k, parseErr)
-			errCount++
+			report.add(relPath, parseErr)
 			continue
 		}
 		e.Path = filepath.ToSlash(relPath)
 		parsed = append(parsed, e)
 	}
-	return parsed, errCount
+	return parsed, report
 }
 
-// WalkEmails walks the email directory, parses .eml files, and returns
+// WalkEmails walks the email directory, parses .eml files (plain or
+// compressed, see eml.IsEmailFile), and returns
 // deduplicated emails by checksum.
 func WalkEmails(emailDir string) ([]eml.Email, int) {
+	parsed, report := walkEmails(emailDir, "")
+	return parsed, report.Total
+}
+
+// StreamEmails is WalkEmails handing each email to yield as soon as it is
+// parsed instead of collecting them, so callers hold only what they keep.
+// Emails arrive in WalkDir order. An error from yield stops the walk and
+// is returned, along with the number of files that failed to parse.
+func StreamEmails(emailDir string, yield func(eml.Email) error) (int, error) {
+	report, err := streamEmails(emailDir, "", yield)
+	return report.Total, err
+}
+
+// walkEmails is WalkEmails skipping the folders matching exclude,
+// reporting which files failed and why.
+func walkEmails(emailDir, exclude string) ([]eml.Email, ParseErrorReport) {
 	var parsed []eml.Email
-	var errCount int
-	seen := make(map[string]bool)
+	report, _ := streamEmails(emailDir, exclude, func(e eml.Email) error {
+		parsed = append(parsed, e)
+		return nil
+	})
+	return parsed, report
+}
 
-	_ = filepath.WalkDir(emailDir, func(path string, d os.DirEntry, err error) error {
-		if err != nil || d.IsDir() {
+// streamEmails is StreamEmails skipping the folders matching exclude,
+// reporting which files failed and why.
+func streamEmails(emailDir, exclude string, yield func(eml.Email) error) (ParseErrorReport, error) {
+	var report ParseErrorReport
+	// Names first: which copies are one message depends on all of them.
+	var paths, sums []string
+	filepath.WalkDir(emailDir, func(path string, d os.DirEntry, err error) error {
+		if err != nil {
 			return nil
 		}
-		if !strings.HasSuffix(strings.ToLower(d.Name()), ".eml") {
+		if d.IsDir() {
+			if walkExcluded(exclude, emailDir, path) {
+				return filepath.SkipDir
+			}
 			return nil
 		}
-		if cs := extractChecksum(d.Name()); cs != "" {
-			if seen[cs] {
-				return nil
+		if eml.IsEmailFile(d.Name()) {
+			paths = append(paths, path)
+			sums = append(sums, extractChecksum(d.Name()))
+		}
+		return nil
+	})
+	copyKeys := checksumKeys(sums)
+	seen := make(map[string]bool)
+
+	for i, path := range paths {
+		if cs := sums[i]; cs != "" {
+			if seen[copyKeys[cs]] {
+				continue
 			}
-			seen[cs] = true
+			seen[copyKeys[cs]] = true
+		}
+		rel, relErr := filepath.Rel(emailDir, path)
+		if relErr != nil {
+			rel = path
 		}
 		e, parseErr := eml.ParseFile(path)
 		if parseErr != nil {
 			log.Printf("WARN: skip %s: %v", path, parseErr)
-			errCount++
-			return nil
+			// Keep the server's directory layout out of the report.
+			report.add(rel, errors.New(strings.ReplaceAll(parseErr.Error(), path, rel)))
+			continue
 		}
-		if rel, relErr := filepath.Rel(emailDir, path); relErr == nil {
+		if relErr == nil {
 			e.Path = rel
 		}
-		parsed = append(parsed, e)
-		return nil
-	})
-	return parsed, errCount
+		if err := yield(e); err != nil {
+			return report, err
+		}
+	}
+	return report, nil
 }
 
 // Build walks the email directory (or S3 prefix), parses every .eml file,
-// stores them in DuckDB and exports to Parquet with zstd.
+// keeps one canonical copy per Message-ID (see dedupByMessageID), stores
+// them in DuckDB and exports to Parquet with zstd.
 func (idx *Index) Build() (int, int) {
+	// Taken before the walk, so files arriving mid-build trigger the next one.
+	fp, fpErr := idx.fingerprint()
+	if fpErr != nil {
+		log.Printf("WARN: index fingerprint: %v", fpErr)
+	}
+
+	idx.mu.RLock()
+	exclude := idx.exclude
+	idx.mu.RUnlock()
 	var parsed []eml.Email
-	var errCount int
+	var report ParseErrorReport
 	if idx.blobStore != nil && idx.emailKeyPref != "" {
-		parsed, errCount = walkEmailsFromBlobStore(idx.blobStore, idx.emailKeyPref)
+		parsed, report = walkEmailsFromBlobStore(idx.blobStore, idx.emailKeyPref, exclude)
 	} else {
-		parsed, errCount = WalkEmails(idx.emailDir)
+		parsed, report = walkEmails(idx.emailDir, exclude)
 	}
+	errCount := report.Total
+	parsed, aliases := dedupByMessageID(parsed)
+	threads := threadIDs(parsed)
 
 	idx.mu.Lock()
 	defer idx.mu.Unlock()
@@ -250,14 +540,14 @@ func (idx *Index) Build() (int, int) {
 		return 0, errCount
 	}
 	stmt, err := tx.Prepare(
-		"INSERT INTO emails (path, subject, from_addr, to_addr, date, size, body_text) VALUES (?, ?, ?, ?, ?, ?, ?)")
+		"INSERT INTO emails (path, subject, from_addr, to_addr, date, size, body_text, message_id, aliases, attachment_count, extra, html_body, thread_id, attachment_text) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)")
 	if err != nil {
 		tx.Rollback()
 		log.Printf("ERROR: prepare: %v", err)
 		return 0, errCount
 	}
 	for _, e := range parsed {
-		if _, err := stmt.Exec(e.Path, e.Subject, e.From, e.To, e.Date, e.Size, e.BodyText); err != nil {
+		if _, err := stmt.Exec(e.Path, e.Subject, e.From, e.To, e.Date, e.Size, e.BodyText, e.MessageID, strings.Join(aliases[e.Path], aliasSep), e.AttachmentCount, extraJSON(e), e.HTMLBody, threads[e.Path], e.AttachmentText); err != nil {
 			log.Printf("WARN: insert %s: %v", e.Path, err)
 		}
 	}
@@ -271,10 +561,20 @@ func (idx *Index) Build() (int, int) {
 		log.Printf("WARN: save parquet: %v", err)
 	} else if idx.indexPath != "" {
 		log.Printf("Saved index to %s", idx.indexPath)
+		idx.saveFingerprint(fp)
 	}
 
+	storeAddressBook(idx.indexPath, idx.emailDir, parsed)
+
 	idx.total = len(parsed)
 	idx.buildAt = time.Now()
+	idx.schema = SchemaVersion
+	idx.needsRebuild = false
+	report.BuiltAt = idx.buildAt
+	idx.parseErrors = report
+	if err := idx.saveParseErrors(report); err != nil {
+		log.Printf("WARN: save parse errors: %v", err)
+	}
 	return len(parsed), errCount
 }
 
@@ -283,12 +583,28 @@ type Hit struct {
 	eml.Email
 	Snippet   string `json:"snippet,omitempty"`
 	AccountID string `json:"account_id,omitempty"`
+
+	// ThreadID identifies the conversation the email belongs to (see
+	// threadIDs). Empty in indexes built before threading.
+	ThreadID string `json:"thread_id,omitempty"`
+
+	// Explain says why the hit matched; set by callers that asked for it
+	// (see Explain).
+	Explain *Explanation `json:"explain,omitempty"`
+
+	// Flagged and Starred are the user's marks, and VFolder the virtual
+	// folder they moved the email to (see package annotation), set by
+	// callers that have them.
+	Flagged bool   `json:"flagged,omitempty"`
+	Starred bool   `json:"starred,omitempty"`
+	VFolder string `json:"vfolder,omitempty"`
 }
 
 // AccountIndex identifies an account and its parquet index path for multi-account search.
 type AccountIndex struct {
 	ID        string
 	IndexPath string
+	EmailDir  string // optional; where SuggestAddresses looks for vCards
 }
 
 // SearchResult wraps matched emails with metadata.
@@ -299,10 +615,35 @@ type SearchResult struct {
 	Limit   int       `json:"limit"`
 	Hits    []Hit     `json:"hits"`
 	IndexAt time.Time `json:"indexed_at"`
+
+	// Warnings lists account indices SearchMulti skipped because they
+	// could not be read; the hits come from the remaining accounts.
+	Warnings []string `json:"warnings,omitempty"`
+
+	// TookMS is how long the search took in milliseconds, including
+	// loading or building cold indexes. Set by the caller that timed it.
+	TookMS int64 `json:"took_ms"`
+
+	// Pagination places this page among all of them, with links relative
+	// to the request. Set by the HTTP handler that knows the request.
+	Pagination model.Pagination `json:"pagination"`
+
+	// Group is "thread" when the caller grouped the hits with
+	// GroupByThread; Threads then holds the page of conversations, Total
+	// counts conversations and Hits is empty.
+	Group   string      `json:"group,omitempty"`
+	Threads []ThreadHit `json:"threads,omitempty"`
 }
 
-// Search returns emails whose subject or body contains the query.
-func (idx *Index) Search(query string, offset, limit int) SearchResult {
+// Search returns emails whose subject, body, sender or recipients contain
+// the query. Pass fields (see ParseFields) to match only some of them.
+func (idx *Index) Search(query string, offset, limit int, fields ...string) SearchResult {
+	return idx.SearchContext(context.Background(), query, offset, limit, fields...)
+}
+
+// SearchContext is Search with cancellation: a cancelled ctx aborts the
+// running DuckDB scan and frees the connection.
+func (idx *Index) SearchContext(ctx context.Context, query string, offset, limit int, fields ...string) SearchResult {
 	q := strings.ToLower(strings.TrimSpace(query))
 
 	idx.mu.RLock()
@@ -313,10 +654,10 @@ func (idx *Index) Search(query string, offset, limit int) SearchResult {
 
 	if q == "" {
 		total = idx.total
-		hits = idx.queryPage(offset, limit)
+		hits = idx.queryPage(ctx, offset, limit)
 	} else {
-		total = idx.countMatches(q)
-		hits = idx.queryMatches(q, offset, limit)
+		total = idx.countMatches(ctx, q, fields)
+		hits = idx.queryMatches(ctx, q, fields, offset, limit)
 	}
 
 	return SearchResult{
@@ -331,20 +672,74 @@ func (idx *Index) Search(query string, offset, limit int) SearchResult {
 
 // SearchMulti searches across multiple account indices. Hits include AccountID.
 // Returns empty result if no indices exist. Skips accounts whose parquet file is missing.
-func SearchMulti(accounts []AccountIndex, query string, offset, limit int) SearchResult {
+func SearchMulti(accounts []AccountIndex, query string, offset, limit int, fields ...string) SearchResult {
+	return SearchMultiContext(context.Background(), accounts, query, offset, limit, fields...)
+}
+
+// SearchMultiContext is SearchMulti with cancellation.
+func SearchMultiContext(ctx context.Context, accounts []AccountIndex, query string, offset, limit int, fields ...string) SearchResult {
 	if len(accounts) == 0 {
 		return SearchResult{Query: query, Total: 0, Offset: offset, Limit: limit, Hits: []Hit{}}
 	}
 
-	db, err := sql.Open("duckdb", "")
+	db, warnings, err := openMultiDB(ctx, accounts)
 	if err != nil {
-		log.Printf("ERROR: SearchMulti open duckdb: %v", err)
+		log.Printf("ERROR: SearchMulti: %v", err)
 		return SearchResult{Query: query, Total: 0, Offset: offset, Limit: limit, Hits: []Hit{}}
 	}
+	if db == nil {
+		return SearchResult{Query: query, Total: 0, Offset: offset, Limit: limit, Hits: []Hit{}, Warnings: warnings}
+	}
 	defer db.Close()
-	db.SetMaxOpenConns(1)
 
-	var unionParts []string
+	q := strings.ToLower(strings.TrimSpace(query))
+	var total int
+	if q == "" {
+		_ = db.QueryRowContext(ctx, "SELECT COUNT(*) FROM emails").Scan(&total)
+	} else {
+		where, args := matchClause(ctx, q, fields)
+		_ = db.QueryRowContext(ctx, "SELECT COUNT(*) FROM emails WHERE "+where, args...).Scan(&total)
+	}
+
+	var hits []Hit
+	if q == "" {
+		hits = queryMultiPage(ctx, db, offset, limit)
+	} else {
+		hits = queryMultiMatches(ctx, db, q, fields, offset, limit)
+	}
+
+	return SearchResult{
+		Query:    query,
+		Total:    total,
+		Offset:   offset,
+		Limit:    limit,
+		Hits:     hits,
+		IndexAt:  time.Time{},
+		Warnings: warnings,
+	}
+}
+
+// openMultiDB loads the given account indices into a temp "emails" table with
+// an account_id column, deduplicated across accounts. Indices that fail to
+// load (e.g. a truncated parquet file) are skipped and reported in warnings.
+// It returns a nil DB when no index could be loaded.
+func openMultiDB(ctx context.Context, accounts []AccountIndex) (*sql.DB, []string, error) {
+	db, err := openDuckDB()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if _, err := db.ExecContext(ctx, `CREATE TEMP TABLE raw_emails (
+		account_id VARCHAR, path VARCHAR, subject VARCHAR, from_addr VARCHAR, to_addr VARCHAR,
+		date TIMESTAMP, size BIGINT, attachment_count INTEGER, body_text VARCHAR, extra VARCHAR, thread_id VARCHAR,
+		attachment_text VARCHAR)`); err != nil {
+		db.Close()
+		return nil, nil, fmt.Errorf("create: %w", err)
+	}
+
+	// Load each file on its own so one bad index cannot fail the others.
+	var warnings []string
+	loaded := 0
 	for _, a := range accounts {
 		if a.IndexPath == "" {
 			continue
@@ -353,96 +748,209 @@ func SearchMulti(accounts []AccountIndex, query string, offset, limit int) Searc
 			continue
 		}
 		escaped := strings.ReplaceAll(a.IndexPath, "'", "''")
-		unionParts = append(unionParts,
-			fmt.Sprintf("SELECT '%s' AS account_id, path, subject, from_addr, to_addr, date, size, body_text FROM read_parquet('%s')",
-				strings.ReplaceAll(a.ID, "'", "''"), escaped))
+		// Indexes built before attachment counting lack the column.
+		attachments := "0 AS attachment_count"
+		if parquetHasColumn(ctx, db, escaped, "attachment_count") {
+			attachments = "attachment_count"
+		}
+		extra := "'{}' AS extra"
+		if parquetHasColumn(ctx, db, escaped, "extra") {
+			extra = "extra"
+		}
+		body := "'' AS body_text"
+		if parquetHasColumn(ctx, db, escaped, "body_text") {
+			body = "body_text"
+		}
+		thread := "'' AS thread_id"
+		if parquetHasColumn(ctx, db, escaped, "thread_id") {
+			thread = "thread_id"
+		}
+		attText := "'' AS attachment_text"
+		if parquetHasColumn(ctx, db, escaped, "attachment_text") {
+			attText = "attachment_text"
+		}
+		_, err := db.ExecContext(ctx,
+			fmt.Sprintf("INSERT INTO raw_emails SELECT '%s' AS account_id, path, subject, from_addr, to_addr, date, size, %s, %s, %s, %s, %s FROM read_parquet('%s')",
+				strings.ReplaceAll(a.ID, "'", "''"), attachments, body, extra, thread, attText, escaped))
+		if err != nil {
+			if ctx.Err() != nil {
+				db.Close()
+				return nil, nil, ctx.Err()
+			}
+			log.Printf("WARN: skip unreadable index %s: %v", a.IndexPath, err)
+			warnings = append(warnings, fmt.Sprintf("account %s: search index could not be read and was skipped", a.ID))
+			continue
+		}
+		loaded++
 	}
-	if len(unionParts) == 0 {
-		return SearchResult{Query: query, Total: 0, Offset: offset, Limit: limit, Hits: []Hit{}}
+	if loaded == 0 {
+		db.Close()
+		return nil, warnings, nil
 	}
 
-	// Build raw union first.
-	rawUnion := strings.Join(unionParts, " UNION ALL ")
-	// Deduplicate: same email in multiple accounts (e.g. re-imported PST) appears once.
-	// - Path with checksum (go-pst): use checksum for dedup.
+	// Deduplicate: same email in multiple accounts (e.g. re-imported PST) appears once,
+	// or once per account with DedupAccount.
+	// - Path with checksum (go-pst): use checksum for dedup; shorter
+	//   checksums of the same message match (see createChecksumKeys).
 	// - Path without checksum (readpst): use content fingerprint (subject|from|to|date|body).
 	// NULLIF ensures regexp_extract '' is treated as NULL for fallback.
+	partition := ""
+	if dedupScope == DedupAccount {
+		partition = "account_id, "
+	}
+	if err := createChecksumKeys(ctx, db, "raw_emails"); err != nil {
+		db.Close()
+		return nil, nil, fmt.Errorf("checksum keys: %w", err)
+	}
 	createSQL := `CREATE TEMP TABLE emails AS
-		SELECT account_id, path, subject, from_addr, to_addr, date, size, body_text
+		SELECT account_id, path, subject, from_addr, to_addr, date, size, attachment_count, body_text, extra, thread_id, attachment_text
 		FROM (
-			SELECT *,
+			SELECT r.*,
 				ROW_NUMBER() OVER (
-					PARTITION BY COALESCE(
-						NULLIF(regexp_extract(path, '([0-9a-f]{16})-', 1), ''),
+					PARTITION BY ` + partition + `COALESCE(
+						k.key,
 						subject || '|' || COALESCE(from_addr, '') || '|' || COALESCE(to_addr, '') || '|' || COALESCE(CAST(date AS VARCHAR), '') || '|' || COALESCE(body_text, '')
 					)
 					ORDER BY date DESC NULLS LAST
 				) AS rn
-			FROM (` + rawUnion + `) u
+			FROM raw_emails r
+			LEFT JOIN checksum_keys k ON k.cs = regexp_extract(r.path, '` + checksum.SQLPattern + `', 2)
 		) ranked
 		WHERE rn = 1`
-	if _, err := db.Exec(createSQL); err != nil {
-		log.Printf("ERROR: SearchMulti create: %v", err)
-		return SearchResult{Query: query, Total: 0, Offset: offset, Limit: limit, Hits: []Hit{}}
+
+	if _, err := db.ExecContext(ctx, createSQL); err != nil {
+		db.Close()
+		return nil, nil, fmt.Errorf("create: %w", err)
 	}
+	if _, err := db.ExecContext(ctx, "DROP TABLE raw_emails"); err != nil {
+		log.Printf("WARN: drop raw_emails: %v", err)
+	}
+	return db, warnings, nil
+}
 
-	q := strings.ToLower(strings.TrimSpace(query))
-	var total int
+// parquetHasColumn reports whether the parquet file (path already
+// quote-escaped) has a top-level column named col.
+func parquetHasColumn(ctx context.Context, db *sql.DB, escapedPath, col string) bool {
+	var n int
+	err := db.QueryRowContext(ctx,
+		fmt.Sprintf("SELECT COUNT(*) FROM parquet_schema('%s') WHERE name = ?", escapedPath), col).Scan(&n)
+	return err == nil && n > 0
+}
+
+// Suggestions are autocomplete candidates for the search box.
+type Suggestions struct {
+	Query    string   `json:"query"`
+	Subjects []string `json:"subjects"`
+	Senders  []string `json:"senders"`
+}
+
+// SuggestMulti returns up to limit subjects and sender addresses containing q
+// across the given account indices, most frequent (then most recent) first.
+func SuggestMulti(accounts []AccountIndex, q string, limit int) Suggestions {
+	return SuggestMultiContext(context.Background(), accounts, q, limit)
+}
+
+// SuggestMultiContext is SuggestMulti with cancellation.
+func SuggestMultiContext(ctx context.Context, accounts []AccountIndex, q string, limit int) Suggestions {
+	out := Suggestions{Query: q, Subjects: []string{}, Senders: []string{}}
+	q = strings.ToLower(strings.TrimSpace(q))
 	if q == "" {
-		_ = db.QueryRow("SELECT COUNT(*) FROM emails").Scan(&total)
-	} else {
-		_ = db.QueryRow(
-			"SELECT COUNT(*) FROM emails WHERE contains(LOWER(subject), ?) OR contains(LOWER(body_text), ?)",
-			q, q).Scan(&total)
+		return out
 	}
 
-	var hits []Hit
-	if q == "" {
-		hits = queryMultiPage(db, "", offset, limit)
-	} else {
-		hits = queryMultiMatches(db, q, offset, limit)
+	var files []string
+	for _, a := range accounts {
+		if a.IndexPath == "" {
+			continue
+		}
+		if _, statErr := os.Stat(a.IndexPath); statErr != nil {
+			continue
+		}
+		files = append(files, "'"+strings.ReplaceAll(a.IndexPath, "'", "''")+"'")
+	}
+	if len(files) == 0 {
+		return out
 	}
 
-	return SearchResult{
-		Query:   query,
-		Total:   total,
-		Offset:  offset,
-		Limit:   limit,
-		Hits:    hits,
-		IndexAt: time.Time{},
+	db, err := openDuckDB()
+	if err != nil {
+		log.Printf("ERROR: SuggestMulti open duckdb: %v", err)
+		return out
 	}
+	defer db.Close()
+
+	source := "read_parquet([" + strings.Join(files, ", ") + "])"
+	out.Subjects = suggestColumn(ctx, db, source, "subject", q, limit)
+	out.Senders = suggestColumn(ctx, db, source, "from_addr", q, limit)
+	return out
 }
 
-func queryMultiPage(db *sql.DB, _ string, offset, limit int) []Hit {
+func suggestColumn(ctx context.Context, db *sql.DB, source, column, q string, limit int) []string {
+	rows, err := db.QueryContext(ctx, fmt.Sprintf(`SELECT %[1]s
+		FROM %[2]s
+		WHERE %[1]s <> '' AND contains(LOWER(%[1]s), ?)
+		GROUP BY %[1]s
+		ORDER BY COUNT(*) DESC, MAX(date) DESC NULLS LAST
+		LIMIT ?`, column, source), q, limit)
+	if err != nil {
+		log.Printf("WARN: suggest %s: %v", column, err)
+		return []string{}
+	}
+	defer rows.Close()
+	values := make([]string, 0, limit)
+	for rows.Next() {
+		var v string
+		if err := rows.Scan(&v); err != nil {
+			log.Printf("WARN: suggest %s: %v", column, err)
+			continue
+		}
+		values = append(values, v)
+	}
+	return values
+}
+
+func queryMultiPage(ctx context.Context, db *sql.DB, offset, limit int) []Hit {
+	columns := "account_id, path, subject, from_addr, to_addr, date, size, attachment_count, thread_id"
+	preview := wantsPreview(ctx)
+	if preview {
+		columns += ", " + previewColumn
+	}
 	var rows *sql.Rows
 	var err error
 	if limit > 0 {
-		rows, err = db.Query(
-			"SELECT account_id, path, subject, from_addr, to_addr, date, size FROM emails ORDER BY date DESC NULLS LAST LIMIT ? OFFSET ?",
+		rows, err = db.QueryContext(ctx,
+			"SELECT "+columns+" FROM emails ORDER BY date DESC NULLS LAST LIMIT ? OFFSET ?",
 			limit, offset)
 	} else {
-		rows, err = db.Query(
-			"SELECT account_id, path, subject, from_addr, to_addr, date, size FROM emails ORDER BY date DESC NULLS LAST")
+		rows, err = db.QueryContext(ctx,
+			"SELECT "+columns+" FROM emails ORDER BY date DESC NULLS LAST")
 	}
 	if err != nil {
 		log.Printf("WARN: queryMultiPage: %v", err)
 		return nil
 	}
 	defer rows.Close()
-	return scanMultiHits(rows, "", false)
+	hits := scanMultiHits(rows, "", preview)
+	if preview {
+		setPreviews(hits)
+	}
+	return hits
 }
 
-func queryMultiMatches(db *sql.DB, q string, offset, limit int) []Hit {
-	const base = `SELECT account_id, path, subject, from_addr, to_addr, date, size, body_text
+func queryMultiMatches(ctx context.Context, db *sql.DB, q string, fields []string, offset, limit int) []Hit {
+	body, args := bodyColumn(q)
+	where, whereArgs := matchClause(ctx, q, fields)
+	args = append(args, whereArgs...)
+	base := `SELECT account_id, path, subject, from_addr, to_addr, date, size, attachment_count, thread_id, ` + body + `
 		FROM emails
-		WHERE contains(LOWER(subject), ?) OR contains(LOWER(body_text), ?)
+		WHERE ` + where + `
 		ORDER BY date DESC NULLS LAST`
 	var rows *sql.Rows
 	var err error
 	if limit > 0 {
-		rows, err = db.Query(base+" LIMIT ? OFFSET ?", q, q, limit, offset)
+		rows, err = db.QueryContext(ctx, base+" LIMIT ? OFFSET ?", append(args, limit, offset)...)
 	} else {
-		rows, err = db.Query(base, q, q)
+		rows, err = db.QueryContext(ctx, base, args...)
 	}
 	if err != nil {
 		log.Printf("WARN: queryMultiMatches: %v", err)
@@ -454,65 +962,63 @@ func queryMultiMatches(db *sql.DB, q string, offset, limit int) []Hit {
 
 func scanMultiHits(rows *sql.Rows, query string, withBody bool) []Hit {
 	var hits []Hit
-	for rows.Next() {
-		var h Hit
-		var scanErr error
-		if withBody {
-			scanErr = rows.Scan(&h.AccountID, &h.Path, &h.Subject, &h.From, &h.To, &h.Date, &h.Size, &h.BodyText)
-		} else {
-			scanErr = rows.Scan(&h.AccountID, &h.Path, &h.Subject, &h.From, &h.To, &h.Date, &h.Size)
-		}
-		if scanErr != nil {
-			log.Printf("WARN: scanMultiHits: %v", scanErr)
-			continue
-		}
-		if query != "" {
-			h.Snippet = eml.Snippet(eml.Email{Path: h.Path, Subject: h.Subject, From: h.From, To: h.To, Date: h.Date, Size: h.Size, BodyText: h.BodyText}, query, 80)
-		}
+	_ = eachHit(rows, query, withBody, true, func(h Hit) error {
 		hits = append(hits, h)
-	}
+		return nil
+	})
 	return hits
 }
 
-func (idx *Index) queryPage(offset, limit int) []Hit {
+func (idx *Index) queryPage(ctx context.Context, offset, limit int) []Hit {
+	columns := "path, subject, from_addr, to_addr, date, size, attachment_count, thread_id"
+	preview := wantsPreview(ctx)
+	if preview {
+		columns += ", " + previewColumn
+	}
 	var rows *sql.Rows
 	var err error
 	if limit > 0 {
-		rows, err = idx.db.Query(
-			"SELECT path, subject, from_addr, to_addr, date, size FROM emails ORDER BY date DESC LIMIT ? OFFSET ?",
+		rows, err = idx.db.QueryContext(ctx,
+			"SELECT "+columns+" FROM emails ORDER BY date DESC LIMIT ? OFFSET ?",
 			limit, offset)
 	} else {
-		rows, err = idx.db.Query(
-			"SELECT path, subject, from_addr, to_addr, date, size FROM emails ORDER BY date DESC")
+		rows, err = idx.db.QueryContext(ctx,
+			"SELECT "+columns+" FROM emails ORDER BY date DESC")
 	}
 	if err != nil {
 		log.Printf("WARN: queryPage: %v", err)
 		return make([]Hit, 0)
 	}
 	defer rows.Close()
-	return scanHits(rows, "", false)
+	hits := scanHits(rows, "", preview)
+	if preview {
+		setPreviews(hits)
+	}
+	return hits
 }
 
-func (idx *Index) countMatches(q string) int {
+func (idx *Index) countMatches(ctx context.Context, q string, fields []string) int {
 	var n int
-	_ = idx.db.QueryRow(
-		"SELECT COUNT(*) FROM emails WHERE contains(LOWER(subject), ?) OR contains(LOWER(body_text), ?)",
-		q, q).Scan(&n)
+	where, args := matchClause(ctx, q, fields)
+	_ = idx.db.QueryRowContext(ctx, "SELECT COUNT(*) FROM emails WHERE "+where, args...).Scan(&n)
 	return n
 }
 
-func (idx *Index) queryMatches(q string, offset, limit int) []Hit {
-	const base = `SELECT path, subject, from_addr, to_addr, date, size, body_text
+func (idx *Index) queryMatches(ctx context.Context, q string, fields []string, offset, limit int) []Hit {
+	body, args := bodyColumn(q)
+	where, whereArgs := matchClause(ctx, q, fields)
+	args = append(args, whereArgs...)
+	base := `SELECT path, subject, from_addr, to_addr, date, size, attachment_count, thread_id, ` + body + `
 		FROM emails
-		WHERE contains(LOWER(subject), ?) OR contains(LOWER(body_text), ?)
+		WHERE ` + where + `
 		ORDER BY date DESC`
 
 	var rows *sql.Rows
 	var err error
 	if limit > 0 {
-		rows, err = idx.db.Query(base+" LIMIT ? OFFSET ?", q, q, limit, offset)
+		rows, err = idx.db.QueryContext(ctx, base+" LIMIT ? OFFSET ?", append(args, limit, offset)...)
 	} else {
-		rows, err = idx.db.Query(base, q, q)
+		rows, err = idx.db.QueryContext(ctx, base, args...)
 	}
 	if err != nil {
 		log.Printf("WARN: queryMatches: %v", err)
@@ -524,25 +1030,233 @@ func (idx *Index) queryMatches(q string, offset, limit int) []Hit {
 
 func scanHits(rows *sql.Rows, query string, withBody bool) []Hit {
 	hits := make([]Hit, 0)
+	_ = eachHit(rows, query, withBody, false, func(h Hit) error {
+		hits = append(hits, h)
+		return nil
+	})
+	return hits
+}
+
+// HitFunc receives hits one at a time from the Stream functions.
+// Returning an error stops the scan.
+type HitFunc func(Hit) error
+
+// eachHit scans rows into hits and passes them to fn as they are read.
+// Rows start with account_id when withAccount is set; body_text (or the
+// window of it from bodyColumn) ends them when withBody is set. Rows that fail to scan are logged and skipped.
+// Snippets are cut around the query's free text, without operators.
+func eachHit(rows *sql.Rows, query string, withBody, withAccount bool, fn HitFunc) error {
+	query = parseQuery(query).Text
 	for rows.Next() {
-		var e eml.Email
-		var scanErr error
+		var h Hit
+		dest := []any{&h.Path, &h.Subject, &h.From, &h.To, &h.Date, &h.Size, &h.AttachmentCount, &h.ThreadID}
+		if withAccount {
+			dest = append([]any{&h.AccountID}, dest...)
+		}
 		if withBody {
-			scanErr = rows.Scan(&e.Path, &e.Subject, &e.From, &e.To, &e.Date, &e.Size, &e.BodyText)
-		} else {
-			scanErr = rows.Scan(&e.Path, &e.Subject, &e.From, &e.To, &e.Date, &e.Size)
+			dest = append(dest, &h.BodyText)
 		}
-		if scanErr != nil {
-			log.Printf("WARN: scan row: %v", scanErr)
+		if err := rows.Scan(dest...); err != nil {
+			log.Printf("WARN: scan row: %v", err)
 			continue
 		}
-		var snippet string
 		if query != "" {
-			snippet = eml.Snippet(e, query, 80)
+			h.Snippet = eml.Snippet(h.Email, query, snippetContext)
+		}
+		if err := fn(h); err != nil {
+			return err
 		}
-		hits = append(hits, Hit{Email: e, Snippet: snippet})
 	}
-	return hits
+	return rows.Err()
+}
+
+// Stream calls fn for every email matching query (all emails when empty),
+// newest first, without collecting the result in memory.
+func (idx *Index) Stream(ctx context.Context, query string, fields []string, fn HitFunc) error {
+	q := strings.ToLower(strings.TrimSpace(query))
+
+	idx.mu.RLock()
+	defer idx.mu.RUnlock()
+
+	rows, err := streamRows(ctx, idx.db, "path, subject, from_addr, to_addr, date, size, attachment_count, thread_id", q, fields)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	return eachHit(rows, q, q != "", false, fn)
+}
+
+// StreamMulti is Stream across account indices, deduplicated like SearchMulti.
+func StreamMulti(ctx context.Context, accounts []AccountIndex, query string, fields []string, fn HitFunc) error {
+	// Unreadable indices are skipped; openMultiDB logs them.
+	db, _, err := openMultiDB(ctx, accounts)
+	if err != nil || db == nil {
+		return err
+	}
+	defer db.Close()
+
+	q := strings.ToLower(strings.TrimSpace(query))
+	rows, err := streamRows(ctx, db, "account_id, path, subject, from_addr, to_addr, date, size, attachment_count, thread_id", q, fields)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	return eachHit(rows, q, q != "", true, fn)
+}
+
+func streamRows(ctx context.Context, db *sql.DB, columns, q string, fields []string) (*sql.Rows, error) {
+	if q == "" {
+		return db.QueryContext(ctx, "SELECT "+columns+" FROM emails ORDER BY date DESC NULLS LAST")
+	}
+	body, args := bodyColumn(q)
+	where, whereArgs := matchClause(ctx, q, fields)
+	return db.QueryContext(ctx, "SELECT "+columns+", "+body+" FROM emails WHERE "+where+" ORDER BY date DESC NULLS LAST", append(args, whereArgs...)...)
+}
+
+// ErrNotIndexed is returned by Reparse when the path has no row in the index.
+var ErrNotIndexed = errors.New("email not in index")
+
+// Reparse re-reads one email (relPath is relative to the email directory),
+// parses it with the current parser and rewrites its row in place, thread
+// included (see rethread), then re-saves the Parquet file. Other rows, and
+// the row's aliases, are kept, except for the threads the email now joins.
+func (idx *Index) Reparse(ctx context.Context, relPath string) (eml.Email, error) {
+	relPath = filepath.Clean(relPath)
+	var e eml.Email
+	var err error
+	if idx.blobStore != nil && idx.emailKeyPref != "" {
+		key := idx.emailKeyPref + "/" + filepath.ToSlash(relPath)
+		data, readErr := idx.blobStore.Read(ctx, key)
+		if readErr == nil {
+			data, readErr = eml.Decompress(key, data)
+		}
+		if readErr != nil {
+			return eml.Email{}, fmt.Errorf("read %s: %w", key, readErr)
+		}
+		e, err = eml.ParseBytes(relPath, data)
+	} else {
+		e, err = eml.ParseFile(filepath.Join(idx.emailDir, relPath))
+	}
+	if err != nil {
+		return eml.Email{}, err
+	}
+	e.Path = relPath
+
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+	tx, err := idx.db.BeginTx(ctx, nil)
+	if err != nil {
+		return eml.Email{}, fmt.Errorf("begin tx: %w", err)
+	}
+	defer tx.Rollback()
+	thread, err := rethread(ctx, tx, e)
+	if err != nil {
+		return eml.Email{}, fmt.Errorf("thread %s: %w", relPath, err)
+	}
+	res, err := tx.ExecContext(ctx, `UPDATE emails
+		SET subject = ?, from_addr = ?, to_addr = ?, date = ?, size = ?, body_text = ?, message_id = ?, attachment_count = ?, extra = ?, html_body = ?, thread_id = ?, attachment_text = ?
+		WHERE path = ?`,
+		e.Subject, e.From, e.To, e.Date, e.Size, e.BodyText, e.MessageID, e.AttachmentCount, extraJSON(e), e.HTMLBody, thread, e.AttachmentText, relPath)
+	if err != nil {
+		return eml.Email{}, fmt.Errorf("update %s: %w", relPath, err)
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return eml.Email{}, fmt.Errorf("%s: %w", relPath, ErrNotIndexed)
+	}
+	if err := tx.Commit(); err != nil {
+		return eml.Email{}, fmt.Errorf("commit: %w", err)
+	}
+	if err := idx.saveParquet(); err != nil {
+		return e, fmt.Errorf("save parquet: %w", err)
+	}
+	return e, nil
+}
+
+// MessageCopy is the canonical indexed copy of a message and the paths of
+// the duplicate copies folded into it.
+type MessageCopy struct {
+	Path    string   `json:"path"`
+	Aliases []string `json:"aliases,omitempty"`
+}
+
+// LookupMessageID returns the canonical copy for a Message-ID (with or
+// without angle brackets).
+func (idx *Index) LookupMessageID(ctx context.Context, messageID string) (MessageCopy, bool) {
+	id := eml.NormalizeMessageID(messageID)
+	if id == "" {
+		return MessageCopy{}, false
+	}
+	idx.mu.RLock()
+	defer idx.mu.RUnlock()
+
+	var c MessageCopy
+	var aliases string
+	err := idx.db.QueryRowContext(ctx,
+		"SELECT path, aliases FROM emails WHERE message_id = ? ORDER BY path LIMIT 1", id).Scan(&c.Path, &aliases)
+	if err != nil {
+		if err != sql.ErrNoRows {
+			log.Printf("WARN: lookup message id: %v", err)
+		}
+		return MessageCopy{}, false
+	}
+	if aliases != "" {
+		c.Aliases = strings.Split(aliases, aliasSep)
+	}
+	return c, true
+}
+
+// CompactResult reports what Compact changed.
+type CompactResult struct {
+	RowsBefore  int   `json:"rows_before"`
+	RowsAfter   int   `json:"rows_after"`
+	BytesBefore int64 `json:"bytes_before"`
+	BytesAfter  int64 `json:"bytes_after"`
+	ParseErrors int   `json:"parse_errors"`
+}
+
+// Compact rebuilds the index from disk, re-writes the Parquet file and
+// reclaims DuckDB memory. Afterwards the row count equals the number of
+// distinct (by checksum and Message-ID) .eml files that parsed; anything
+// else is churn.
+func (idx *Index) Compact() (CompactResult, error) {
+	var res CompactResult
+	idx.mu.RLock()
+	if err := idx.db.QueryRow("SELECT COUNT(*) FROM emails").Scan(&res.RowsBefore); err != nil {
+		log.Printf("WARN: compact count: %v", err)
+	}
+	idx.mu.RUnlock()
+	res.BytesBefore = fileSize(idx.indexPath)
+
+	res.RowsAfter, res.ParseErrors = idx.Build()
+
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+	if _, err := idx.db.Exec("CHECKPOINT"); err != nil {
+		return res, fmt.Errorf("checkpoint: %w", err)
+	}
+	if _, err := idx.db.Exec("VACUUM"); err != nil {
+		return res, fmt.Errorf("vacuum: %w", err)
+	}
+	var n int
+	if err := idx.db.QueryRow("SELECT COUNT(*) FROM emails").Scan(&n); err != nil {
+		return res, fmt.Errorf("count: %w", err)
+	}
+	if n != res.RowsAfter {
+		return res, fmt.Errorf("row count %d after compact, expected %d", n, res.RowsAfter)
+	}
+	res.BytesAfter = fileSize(idx.indexPath)
+	return res, nil
+}
+
+func fileSize(path string) int64 {
+	if path == "" {
+		return 0
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		return 0
+	}
+	return info.Size()
 }
 
 // EmailDir returns the root email directory path.
@@ -550,12 +1264,27 @@ func (idx *Index) EmailDir() string {
 	return idx.emailDir
 }
 
+// IndexPath returns the Parquet index file path.
+func (idx *Index) IndexPath() string {
+	return idx.indexPath
+}
+
 // Stats holds index statistics.
 type Stats struct {
 	TotalEmails int       `json:"total_emails"`
 	IndexedAt   time.Time `json:"indexed_at"`
 	EmailDir    string    `json:"email_dir"`
 	IndexPath   string    `json:"index_path,omitempty"`
+
+	// NeedsRebuild is set when New found the Parquet file unusable or of
+	// an older SchemaVersion and no Build has run since; LoadError says
+	// what was wrong with the file.
+	NeedsRebuild bool   `json:"needs_rebuild,omitempty"`
+	LoadError    string `json:"load_error,omitempty"`
+
+	// SchemaVersion is that of the loaded file or the last build; 0 for
+	// a file from before versions were recorded.
+	SchemaVersion int `json:"schema_version"`
 }
 
 // Stats returns current index statistics.
@@ -563,17 +1292,78 @@ func (idx *Index) Stats() Stats {
 	idx.mu.RLock()
 	defer idx.mu.RUnlock()
 	return Stats{
-		TotalEmails: idx.total,
-		IndexedAt:   idx.buildAt,
-		EmailDir:    idx.emailDir,
-		IndexPath:   idx.indexPath,
+		TotalEmails:   idx.total,
+		IndexedAt:     idx.buildAt,
+		EmailDir:      idx.emailDir,
+		IndexPath:     idx.indexPath,
+		NeedsRebuild:  idx.needsRebuild,
+		LoadError:     idx.loadError,
+		SchemaVersion: idx.schema,
+	}
+}
+
+// extraJSON encodes the email's INDEX_HEADERS values for the extra column.
+func extraJSON(e eml.Email) string {
+	if len(e.Headers) == 0 {
+		return "{}"
+	}
+	data, err := json.Marshal(e.Headers)
+	if err != nil {
+		return "{}"
 	}
+	return string(data)
 }
 
+// extractChecksum returns the checksum prefix of filenames like
+// "a1b2c3d4e5f67890-123.eml", of any length package checksum accepts.
 func extractChecksum(name string) string {
-	m := reChecksum.FindStringSubmatch(name)
-	if m == nil {
-		return ""
+	return checksum.FromName(name)
+}
+
+// checksumKeys is createChecksumKeys for the filename checksums of one
+// account: it maps each non-empty checksum in sums to the key its copies
+// share.
+func checksumKeys(sums []string) map[string]string {
+	byPrefix := make(map[string][]string)
+	for _, cs := range sums {
+		if cs != "" && !slices.Contains(byPrefix[cs[:checksum.LegacyLength]], cs) {
+			byPrefix[cs[:checksum.LegacyLength]] = append(byPrefix[cs[:checksum.LegacyLength]], cs)
+		}
+	}
+	keys := make(map[string]string)
+	for _, group := range byPrefix {
+		for _, cs := range group {
+			keys[cs] = cs
+			var longer []string
+			for _, other := range group {
+				if len(other) > len(cs) && strings.HasPrefix(other, cs) {
+					longer = append(longer, other)
+				}
+			}
+			if len(longer) == 1 {
+				keys[cs] = longer[0]
+			}
+		}
 	}
-	return m[1]
+	return keys
+}
+
+// createChecksumKeys creates the temp table checksum_keys (cs, key) for
+// the paths in table: for each distinct filename checksum, the key its
+// copies are grouped on across accounts. A checksum that is the prefix of
+// exactly one longer checksum, the same message saved under a shorter
+// CHECKSUM_LENGTH (such as checksum.LegacyLength), takes that one as key;
+// any other is its own key, so distinct messages that merely share a
+// prefix stay apart.
+func createChecksumKeys(ctx context.Context, db *sql.DB, table string) error {
+	_, err := db.ExecContext(ctx, fmt.Sprintf(`CREATE TEMP TABLE checksum_keys AS
+		WITH sums AS (
+			SELECT DISTINCT regexp_extract(path, '%[1]s', 2) AS cs FROM %[2]s
+		)
+		SELECT a.cs, CASE WHEN COUNT(DISTINCT b.cs) = 1 THEN MAX(b.cs) ELSE a.cs END AS key
+		FROM sums a LEFT JOIN sums b
+			ON left(b.cs, %[3]d) = left(a.cs, %[3]d) AND length(b.cs) > length(a.cs) AND starts_with(b.cs, a.cs)
+		WHERE a.cs <> ''
+		GROUP BY a.cs`, checksum.SQLPattern, table, checksum.LegacyLength))
+	return err
 }
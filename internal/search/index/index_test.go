@@ -1,10 +1,18 @@
 package index_test
 
 import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"database/sql"
+	"errors"
 	"os"
 	"path/filepath"
+	"strings"
 	"testing"
+	"time"
 
+	"github.com/eslider/mails/internal/search/eml"
 	"github.com/eslider/mails/internal/search/index"
 )
 
@@ -173,6 +181,32 @@ func TestSearchBodyText(t *testing.T) {
 	}
 }
 
+func TestSearchRecipientAndSender(t *testing.T) {
+	dir := t.TempDir()
+	seedEmails(t, dir)
+
+	idx := newTestIndex(t, dir)
+	idx.Build()
+
+	// alice@test.com is the recipient of b.eml and c.eml and the sender of a.eml.
+	if res := idx.Search("alice@test.com", 0, 0); res.Total != 3 {
+		t.Errorf("search 'alice@test.com' total = %d, want 3", res.Total)
+	}
+	if res := idx.Search("alice@test.com", 0, 0, index.FieldTo); res.Total != 2 {
+		t.Errorf("to-only search total = %d, want 2", res.Total)
+	}
+	if res := idx.Search("carol", 0, 0, index.FieldFrom); res.Total != 1 {
+		t.Errorf("from-only search total = %d, want 1", res.Total)
+	}
+	if res := idx.Search("alice@test.com", 0, 0, index.FieldSubject, index.FieldBody); res.Total != 0 {
+		t.Errorf("subject/body search for an address total = %d, want 0", res.Total)
+	}
+
+	if _, err := index.ParseFields("subject,cc"); err == nil {
+		t.Error("expected error for unknown field")
+	}
+}
+
 func TestSearchSnippetForSubjectMatch(t *testing.T) {
 	dir := t.TempDir()
 	seedEmails(t, dir)
@@ -374,6 +408,145 @@ func TestSearchMultiDeduplicatesByChecksum(t *testing.T) {
 	t.Logf("SearchMulti: 4 rows across 2 accounts -> %d unique (deduplicated)", result.Total)
 }
 
+func TestBuildCompressed(t *testing.T) {
+	msg := func(subject string) []byte {
+		return []byte("From: a@b.com\r\nSubject: " + subject + "\r\nMessage-ID: <" + subject + "@b.com>\r\n\r\nBody.\r\n")
+	}
+	var gz bytes.Buffer
+	w := gzip.NewWriter(&gz)
+	w.Write(msg("packed"))
+	w.Close()
+
+	dir := t.TempDir()
+	os.MkdirAll(filepath.Join(dir, "inbox"), 0755)
+	os.MkdirAll(filepath.Join(dir, "archive"), 0755)
+	os.WriteFile(filepath.Join(dir, "inbox", "a1b2c3d4e5f67890aaaaaaaa-1.eml"), msg("plain"), 0644)
+	os.WriteFile(filepath.Join(dir, "inbox", "a1b2c3d4e5f67890bbbbbbbb-2.eml.gz"), gz.Bytes(), 0644)
+	// The plain copy of the compressed message shares its checksum.
+	os.WriteFile(filepath.Join(dir, "archive", "a1b2c3d4e5f67890bbbbbbbb-2.eml"), msg("packed"), 0644)
+
+	idx, err := index.New(dir, filepath.Join(dir, "index.parquet"), nil, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer idx.Close()
+	if total, errs := idx.Build(); total != 2 || errs != 0 {
+		t.Fatalf("Build = %d emails, %d errors; want 2, 0", total, errs)
+	}
+	res := idx.Search("packed", 0, 10)
+	if res.Total != 1 {
+		t.Fatalf("search packed: %d hits, want 1", res.Total)
+	}
+}
+
+func TestChecksumPrefixCollision(t *testing.T) {
+	// Distinct messages whose checksums share the legacy 16-char prefix
+	// must all be indexed; only an identical checksum marks a copy.
+	msg := func(subject string) []byte {
+		return []byte("From: a@b.com\r\nTo: c@d.com\r\nSubject: " + subject + "\r\nMessage-ID: <" + strings.ReplaceAll(subject, " ", "-") + "@b.com>\r\n\r\nBody.\r\n")
+	}
+	root := t.TempDir()
+	var accounts []index.AccountIndex
+	for _, id := range []string{"one", "two"} {
+		dir := filepath.Join(root, id)
+		os.MkdirAll(filepath.Join(dir, "inbox"), 0755)
+		os.MkdirAll(filepath.Join(dir, "archive"), 0755)
+		os.WriteFile(filepath.Join(dir, "inbox", "a1b2c3d4e5f67890-1.eml"), msg("legacy name"), 0644)
+		os.WriteFile(filepath.Join(dir, "inbox", "a1b2c3d4e5f67890aaaaaaaa-2.eml"), msg("first twin"), 0644)
+		os.WriteFile(filepath.Join(dir, "inbox", "a1b2c3d4e5f67890bbbbbbbb-3.eml"), msg("second twin"), 0644)
+		// A real copy, under the same full checksum, is still skipped.
+		os.WriteFile(filepath.Join(dir, "archive", "a1b2c3d4e5f67890bbbbbbbb-9.eml"), msg("second twin"), 0644)
+
+		indexPath := filepath.Join(root, id+".parquet")
+		idx, err := index.New(dir, indexPath, nil, "")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if total, _ := idx.Build(); total != 3 {
+			t.Errorf("%s: indexed %d emails, want 3", id, total)
+		}
+		idx.Close()
+		accounts = append(accounts, index.AccountIndex{ID: id, IndexPath: indexPath})
+	}
+
+	// Across accounts each message is one hit, and none is lost.
+	if got := index.SearchMulti(accounts, "", 0, 10).Total; got != 3 {
+		t.Errorf("SearchMulti total = %d, want 3", got)
+	}
+}
+
+func TestSearchMultiDeduplicatesMixedChecksumLengths(t *testing.T) {
+	// The same message saved with CHECKSUM_LENGTH 16 in one account and
+	// 24 in the other.
+	msg := "From: a@b.com\r\nSubject: Mixed\r\nDate: Mon, 10 Feb 2025 12:00:00 +0000\r\n\r\nSaved twice.\r\n"
+	old := buildAccount(t, map[string]string{"inbox/a1b2c3d4e5f60001-1.eml": msg})
+	current := buildAccount(t, map[string]string{"inbox/a1b2c3d4e5f60001beefcafe-1.eml": msg})
+
+	accounts := []index.AccountIndex{{ID: "old", IndexPath: old}, {ID: "current", IndexPath: current}}
+	if got := index.SearchMulti(accounts, "mixed", 0, 10).Total; got != 1 {
+		t.Errorf("SearchMulti total = %d, want 1 (deduplicated)", got)
+	}
+}
+
+func TestBuildDeduplicatesMixedChecksumLengths(t *testing.T) {
+	// The same message, without a Message-ID, saved with CHECKSUM_LENGTH 16
+	// and, after a change, 24 in another folder of one account.
+	msg := []byte("From: a@b.com\r\nSubject: Mixed\r\nDate: Mon, 10 Feb 2025 12:00:00 +0000\r\n\r\nSaved twice.\r\n")
+	dir := t.TempDir()
+	os.MkdirAll(filepath.Join(dir, "inbox"), 0755)
+	os.MkdirAll(filepath.Join(dir, "archive"), 0755)
+	os.WriteFile(filepath.Join(dir, "inbox", "a1b2c3d4e5f60001-1.eml"), msg, 0644)
+	os.WriteFile(filepath.Join(dir, "archive", "a1b2c3d4e5f60001beefcafe-1.eml"), msg, 0644)
+
+	idx, err := index.New(dir, filepath.Join(t.TempDir(), "index.parquet"), nil, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer idx.Close()
+	if total, _ := idx.Build(); total != 1 {
+		t.Errorf("indexed %d emails, want 1", total)
+	}
+}
+
+func TestSearchMultiDedupScope(t *testing.T) {
+	t.Cleanup(func() { index.SetDedupScope(index.DedupGlobal) })
+	forwarded := "From: a@b.com\r\nTo: team@b.com\r\nSubject: Forwarded memo\r\nDate: Mon, 10 Feb 2025 12:00:00 +0000\r\n\r\nSame message in two mailboxes.\r\n"
+	root := t.TempDir()
+	var accounts []index.AccountIndex
+	for _, id := range []string{"work", "home"} {
+		dir := filepath.Join(root, id)
+		for _, folder := range []string{"inbox", "archive"} {
+			os.MkdirAll(filepath.Join(dir, folder), 0755)
+			// A second copy in the same account is always collapsed.
+			os.WriteFile(filepath.Join(dir, folder, "c0ffee0000000001-1.eml"), []byte(forwarded), 0644)
+		}
+		indexPath := filepath.Join(root, id+".parquet")
+		idx, err := index.New(dir, indexPath, nil, "")
+		if err != nil {
+			t.Fatal(err)
+		}
+		idx.Build()
+		if got := idx.Search("memo", 0, 0).Total; got != 1 {
+			t.Errorf("%s index: total = %d, want 1", id, got)
+		}
+		idx.Close()
+		accounts = append(accounts, index.AccountIndex{ID: id, IndexPath: indexPath})
+	}
+
+	if got := index.SearchMulti(accounts, "memo", 0, 10).Total; got != 1 {
+		t.Errorf("global scope: total = %d, want 1", got)
+	}
+
+	index.SetDedupScope(index.DedupAccount)
+	res := index.SearchMulti(accounts, "memo", 0, 10)
+	if res.Total != 2 || len(res.Hits) != 2 {
+		t.Fatalf("account scope: total = %d, hits = %d, want 2", res.Total, len(res.Hits))
+	}
+	if res.Hits[0].AccountID == res.Hits[1].AccountID {
+		t.Errorf("account scope: both hits from %s", res.Hits[0].AccountID)
+	}
+}
+
 func TestSearchMultiKeepsAllWhenNoChecksumInPath(t *testing.T) {
 	// Paths without checksum format: content fingerprint used for dedup.
 	// Single account with 3 different emails -> 3 results.
@@ -438,3 +611,851 @@ func TestSearchMultiDeduplicatesByContentWhenNoChecksumInPath(t *testing.T) {
 		t.Errorf("SearchMulti total = %d, want 2 (deduplicated by content when no checksum in path)", result.Total)
 	}
 }
+
+func TestCompact(t *testing.T) {
+	dir := t.TempDir()
+	seedEmails(t, dir)
+	parquetPath := filepath.Join(t.TempDir(), "index.parquet")
+
+	idx, err := index.New(dir, parquetPath, nil, "")
+	if err != nil {
+		t.Fatalf("index.New: %v", err)
+	}
+	defer idx.Close()
+	idx.Build()
+
+	// One more file on disk: compaction must pick it up.
+	extra := "From: dave@test.com\r\nSubject: Late arrival\r\nDate: Wed, 12 Feb 2025 08:00:00 +0000\r\n\r\nhello\r\n"
+	if err := os.WriteFile(filepath.Join(dir, "test-account", "inbox", "d.eml"), []byte(extra), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	res, err := idx.Compact()
+	if err != nil {
+		t.Fatalf("Compact: %v", err)
+	}
+	if res.RowsBefore != 3 || res.RowsAfter != 4 {
+		t.Errorf("rows before/after = %d/%d, want 3/4", res.RowsBefore, res.RowsAfter)
+	}
+	if res.BytesBefore == 0 || res.BytesAfter == 0 {
+		t.Errorf("parquet sizes should be reported, got %d/%d", res.BytesBefore, res.BytesAfter)
+	}
+	if got := idx.Search("", 0, 0).Total; got != 4 {
+		t.Errorf("search total after compact = %d, want 4", got)
+	}
+}
+
+func TestDuckDBLimitsFromEnv(t *testing.T) {
+	dir := t.TempDir()
+	seedEmails(t, dir)
+	t.Setenv("DUCKDB_MEMORY_LIMIT", "256MB")
+	t.Setenv("DUCKDB_TEMP_DIR", t.TempDir())
+
+	idx := newTestIndex(t, dir)
+	if total, _ := idx.Build(); total != 3 {
+		t.Fatalf("total = %d, want 3", total)
+	}
+
+	t.Setenv("DUCKDB_MEMORY_LIMIT", "not-a-size")
+	if _, err := index.New(dir, "", nil, ""); err == nil {
+		t.Error("expected error for invalid DUCKDB_MEMORY_LIMIT")
+	}
+}
+
+func TestSuggestMulti(t *testing.T) {
+	dir := t.TempDir()
+	seedEmails(t, dir)
+	parquetPath := filepath.Join(t.TempDir(), "index.parquet")
+	idx, err := index.New(dir, parquetPath, nil, "")
+	if err != nil {
+		t.Fatalf("index.New: %v", err)
+	}
+	idx.Build()
+	idx.Close()
+
+	accounts := []index.AccountIndex{{ID: "acct-1", IndexPath: parquetPath}}
+
+	s := index.SuggestMulti(accounts, "MEET", 10)
+	if len(s.Subjects) != 2 {
+		t.Errorf("subjects = %v, want 2 meeting subjects", s.Subjects)
+	}
+
+	// alice@test.com sent one email; bob@test.com sent one; both contain "test.com".
+	s = index.SuggestMulti(accounts, "test.com", 1)
+	if len(s.Senders) != 1 {
+		t.Errorf("senders = %v, want limit 1", s.Senders)
+	}
+
+	s = index.SuggestMulti(accounts, "", 10)
+	if len(s.Subjects) != 0 || len(s.Senders) != 0 {
+		t.Errorf("empty query should suggest nothing, got %+v", s)
+	}
+}
+
+func TestTimelineMulti(t *testing.T) {
+	dir := t.TempDir()
+	seedEmails(t, dir)
+	march := "From: dave@test.com\r\nSubject: Meeting notes\r\nDate: Mon, 03 Mar 2025 08:00:00 +0000\r\n\r\nNotes.\r\n"
+	os.WriteFile(filepath.Join(dir, "d.eml"), []byte(march), 0644)
+	parquetPath := filepath.Join(t.TempDir(), "index.parquet")
+	idx, err := index.New(dir, parquetPath, nil, "")
+	if err != nil {
+		t.Fatalf("index.New: %v", err)
+	}
+	idx.Build()
+	idx.Close()
+
+	accounts := []index.AccountIndex{{ID: "acct-1", IndexPath: parquetPath}}
+	feb := time.Date(2025, 2, 1, 0, 0, 0, 0, time.UTC)
+	mar := time.Date(2025, 3, 1, 0, 0, 0, 0, time.UTC)
+
+	tl := index.TimelineMulti(context.Background(), accounts, "meeting", nil)
+	if len(tl.Months) != 2 || !tl.Months[0].Month.Equal(feb) || tl.Months[0].Count != 2 ||
+		!tl.Months[1].Month.Equal(mar) || tl.Months[1].Count != 1 {
+		t.Errorf("meeting timeline = %+v, want 2 in Feb and 1 in Mar", tl.Months)
+	}
+
+	tl = index.TimelineMulti(context.Background(), accounts, "", nil)
+	total := 0
+	for _, m := range tl.Months {
+		total += m.Count
+	}
+	if total != 4 {
+		t.Errorf("timeline counts %d emails, want all 4", total)
+	}
+
+	if tl := index.TimelineMulti(context.Background(), nil, "meeting", nil); len(tl.Months) != 0 {
+		t.Errorf("no accounts: months = %+v", tl.Months)
+	}
+}
+
+func TestStreamMatchesSearch(t *testing.T) {
+	dir := t.TempDir()
+	seedEmails(t, dir)
+	parquetPath := filepath.Join(t.TempDir(), "index.parquet")
+	idx, err := index.New(dir, parquetPath, nil, "")
+	if err != nil {
+		t.Fatalf("index.New: %v", err)
+	}
+	defer idx.Close()
+	idx.Build()
+
+	var paths []string
+	err = idx.Stream(context.Background(), "meeting", nil, func(h index.Hit) error {
+		paths = append(paths, h.Path)
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("Stream: %v", err)
+	}
+	want := idx.Search("meeting", 0, 0)
+	if len(paths) != want.Total {
+		t.Fatalf("streamed %d hits, search found %d", len(paths), want.Total)
+	}
+	for i, h := range want.Hits {
+		if paths[i] != h.Path {
+			t.Errorf("hit %d: streamed %s, searched %s", i, paths[i], h.Path)
+		}
+	}
+
+	// Multi-account stream tags hits and stops when the callback fails.
+	stop := errors.New("stop")
+	n := 0
+	err = index.StreamMulti(context.Background(), []index.AccountIndex{{ID: "acct-1", IndexPath: parquetPath}}, "", nil, func(h index.Hit) error {
+		if h.AccountID != "acct-1" {
+			t.Errorf("hit without account id: %+v", h)
+		}
+		n++
+		return stop
+	})
+	if !errors.Is(err, stop) || n != 1 {
+		t.Errorf("StreamMulti: err=%v after %d hits, want stop after 1", err, n)
+	}
+}
+
+func TestBuildDeduplicatesByMessageID(t *testing.T) {
+	dir := t.TempDir()
+	for _, folder := range []string{"allmail", "inbox", "trash"} {
+		if err := os.MkdirAll(filepath.Join(dir, "account", folder), 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// Same Message-ID, different bytes (and so different checksums) per folder.
+	msg := func(extra string) []byte {
+		return []byte("Message-ID: <thread-1@example.com>\r\nFrom: a@b.com\r\nTo: c@d.com\r\nSubject: Copied Around\r\nDate: Mon, 10 Feb 2025 12:00:00 +0000\r\n" + extra + "Content-Type: text/plain\r\n\r\nBody.\r\n")
+	}
+	os.WriteFile(filepath.Join(dir, "account", "allmail", "1111111111111111-1.eml"), msg("X-Gmail-Labels: Inbox\r\n"), 0644)
+	os.WriteFile(filepath.Join(dir, "account", "inbox", "2222222222222222-2.eml"), msg(""), 0644)
+	os.WriteFile(filepath.Join(dir, "account", "trash", "3333333333333333-3.eml"), msg("X-Trashed: yes\r\n"), 0644)
+	os.WriteFile(filepath.Join(dir, "account", "allmail", "4444444444444444-4.eml"),
+		[]byte("From: x@y.com\r\nSubject: No Message-ID\r\nDate: Tue, 11 Feb 2025 08:00:00 +0000\r\n\r\nBody.\r\n"), 0644)
+
+	idx := newTestIndex(t, dir)
+	total, _ := idx.Build()
+	if total != 2 {
+		t.Fatalf("total = %d, want 2 (one per Message-ID plus one without)", total)
+	}
+
+	res := idx.Search("copied around", 0, 0)
+	if res.Total != 1 {
+		t.Fatalf("search total = %d, want 1", res.Total)
+	}
+	wantPath := filepath.Join("account", "inbox", "2222222222222222-2.eml")
+	if res.Hits[0].Path != wantPath {
+		t.Errorf("canonical copy = %s, want %s", res.Hits[0].Path, wantPath)
+	}
+
+	c, ok := idx.LookupMessageID(context.Background(), "<thread-1@example.com>")
+	if !ok {
+		t.Fatal("LookupMessageID: not found")
+	}
+	if c.Path != wantPath {
+		t.Errorf("lookup path = %s, want %s", c.Path, wantPath)
+	}
+	wantAliases := []string{
+		filepath.Join("account", "allmail", "1111111111111111-1.eml"),
+		filepath.Join("account", "trash", "3333333333333333-3.eml"),
+	}
+	if len(c.Aliases) != 2 || c.Aliases[0] != wantAliases[0] || c.Aliases[1] != wantAliases[1] {
+		t.Errorf("aliases = %v, want %v", c.Aliases, wantAliases)
+	}
+	if _, ok := idx.LookupMessageID(context.Background(), "missing@example.com"); ok {
+		t.Error("unexpected hit for unknown Message-ID")
+	}
+}
+
+func TestSearchByAttachmentCount(t *testing.T) {
+	dir := t.TempDir()
+	sub := filepath.Join(dir, "account", "inbox")
+	if err := os.MkdirAll(sub, 0755); err != nil {
+		t.Fatal(err)
+	}
+	withAttachments := func(subject string, n int) []byte {
+		b := "From: a@b.com\r\nSubject: " + subject + "\r\nDate: Mon, 10 Feb 2025 12:00:00 +0000\r\n" +
+			"Content-Type: multipart/mixed; boundary=XX\r\n\r\n" +
+			"--XX\r\nContent-Type: text/plain\r\n\r\nReport attached.\r\n"
+		for i := 0; i < n; i++ {
+			b += "--XX\r\nContent-Type: application/pdf\r\nContent-Disposition: attachment; filename=\"r.pdf\"\r\n\r\n%PDF\r\n"
+		}
+		return []byte(b + "--XX--\r\n")
+	}
+	os.WriteFile(filepath.Join(sub, "none.eml"), withAttachments("Report none", 0), 0644)
+	os.WriteFile(filepath.Join(sub, "one.eml"), withAttachments("Report one", 1), 0644)
+	os.WriteFile(filepath.Join(sub, "three.eml"), withAttachments("Report three", 3), 0644)
+
+	indexPath := filepath.Join(t.TempDir(), "index.parquet")
+	idx, err := index.New(dir, indexPath, nil, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer idx.Close()
+	idx.Build()
+
+	tests := []struct {
+		q    string
+		want int
+	}{
+		{"has:attachment", 2},
+		{"report has:attachment", 2},
+		{"attachments:>2", 1},
+		{"attachments:>=1", 2},
+		{"attachments:0", 1},
+		{"three attachments:<2", 0},
+	}
+	for _, tt := range tests {
+		if got := idx.Search(tt.q, 0, 0).Total; got != tt.want {
+			t.Errorf("Search(%q) total = %d, want %d", tt.q, got, tt.want)
+		}
+		multi := index.SearchMulti([]index.AccountIndex{{ID: "a1", IndexPath: indexPath}}, tt.q, 0, 0)
+		if multi.Total != tt.want {
+			t.Errorf("SearchMulti(%q) total = %d, want %d", tt.q, multi.Total, tt.want)
+		}
+	}
+
+	res := idx.Search("attachments:>2", 0, 0)
+	if len(res.Hits) != 1 || res.Hits[0].AttachmentCount != 3 {
+		t.Fatalf("hits = %+v, want one with attachment_count 3", res.Hits)
+	}
+	if snip := idx.Search("report has:attachment", 0, 0).Hits[0].Snippet; snip == "" {
+		t.Error("snippet should be cut around the free text")
+	}
+}
+
+func TestSearchInAttachment(t *testing.T) {
+	eml.SetParseAttachments(true)
+	t.Cleanup(func() { eml.SetParseAttachments(false) })
+	dir := t.TempDir()
+	sub := filepath.Join(dir, "account", "inbox")
+	if err := os.MkdirAll(sub, 0755); err != nil {
+		t.Fatal(err)
+	}
+	os.WriteFile(filepath.Join(sub, "notes.eml"), []byte("From: a@b.com\r\nSubject: Notes\r\nDate: Mon, 10 Feb 2025 12:00:00 +0000\r\n"+
+		"Content-Type: multipart/mixed; boundary=XX\r\n\r\n"+
+		"--XX\r\nContent-Type: text/plain\r\n\r\nMinutes attached.\r\n"+
+		"--XX\r\nContent-Type: text/plain\r\nContent-Disposition: attachment; filename=\"minutes.txt\"\r\n\r\n"+
+		"The indemnification clause was approved.\r\n--XX--\r\n"), 0644)
+	os.WriteFile(filepath.Join(sub, "body.eml"), []byte("From: a@b.com\r\nSubject: Question\r\nDate: Mon, 10 Feb 2025 13:00:00 +0000\r\n"+
+		"Content-Type: text/plain\r\n\r\nWhat does indemnification mean?\r\n"), 0644)
+
+	indexPath := filepath.Join(t.TempDir(), "index.parquet")
+	idx, err := index.New(dir, indexPath, nil, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer idx.Close()
+	idx.Build()
+
+	tests := []struct {
+		q    string
+		want int
+	}{
+		{"indemnification", 1},
+		{"in:attachment indemnification", 1},
+		{"in:attachment approved", 1},
+		{"in:attachment minutes", 0}, // body and filename only
+		{"in:attachment question", 0},
+		{"in:attachment", 1},
+	}
+	for _, tt := range tests {
+		if got := idx.Search(tt.q, 0, 0).Total; got != tt.want {
+			t.Errorf("Search(%q) total = %d, want %d", tt.q, got, tt.want)
+		}
+		multi := index.SearchMulti([]index.AccountIndex{{ID: "a1", IndexPath: indexPath}}, tt.q, 0, 0)
+		if multi.Total != tt.want {
+			t.Errorf("SearchMulti(%q) total = %d, want %d", tt.q, multi.Total, tt.want)
+		}
+	}
+	res := idx.Search("in:attachment approved", 0, 0)
+	if len(res.Hits) != 1 || res.Hits[0].Subject != "Notes" || !strings.Contains(res.Hits[0].Snippet, "approved") {
+		t.Errorf("hits = %+v, want Notes with an attachment snippet", res.Hits)
+	}
+}
+
+func TestSearchMultiSkipsCorruptIndex(t *testing.T) {
+	dir := t.TempDir()
+	seedEmails(t, dir)
+	goodPath := filepath.Join(t.TempDir(), "good.parquet")
+	idx, err := index.New(dir, goodPath, nil, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	idx.Build()
+	idx.Close()
+
+	// Truncate a copy of the good file so its footer is missing.
+	data, err := os.ReadFile(goodPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	badPath := filepath.Join(t.TempDir(), "bad.parquet")
+	if err := os.WriteFile(badPath, data[:len(data)/2], 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	accounts := []index.AccountIndex{
+		{ID: "good", IndexPath: goodPath},
+		{ID: "broken", IndexPath: badPath},
+	}
+	res := index.SearchMulti(accounts, "meeting", 0, 0)
+	if res.Total != 2 {
+		t.Errorf("total = %d, want 2 from the healthy index", res.Total)
+	}
+	if len(res.Warnings) != 1 || !strings.Contains(res.Warnings[0], "broken") {
+		t.Errorf("warnings = %v, want one naming the broken account", res.Warnings)
+	}
+
+	var streamed int
+	if err := index.StreamMulti(context.Background(), accounts, "meeting", nil, func(index.Hit) error {
+		streamed++
+		return nil
+	}); err != nil {
+		t.Fatalf("StreamMulti: %v", err)
+	}
+	if streamed != 2 {
+		t.Errorf("streamed %d hits, want 2", streamed)
+	}
+
+	only := index.SearchMulti(accounts[1:], "meeting", 0, 0)
+	if only.Total != 0 || len(only.Warnings) != 1 {
+		t.Errorf("only broken index: total=%d warnings=%v", only.Total, only.Warnings)
+	}
+}
+
+func TestReparseSingleEmail(t *testing.T) {
+	dir := t.TempDir()
+	seedEmails(t, dir)
+	parquetPath := filepath.Join(t.TempDir(), "index.parquet")
+	idx, err := index.New(dir, parquetPath, nil, "")
+	if err != nil {
+		t.Fatalf("index.New: %v", err)
+	}
+	defer idx.Close()
+	idx.Build()
+
+	rel := filepath.Join("test-account", "inbox", "c.eml")
+	updated := "From: carol@test.com\r\nTo: alice@test.com\r\nSubject: Invoice #1234 (corrected)\r\nDate: Tue, 11 Feb 2025 08:00:00 +0000\r\nContent-Type: text/plain\r\n\r\nNow with a marimba.\r\n"
+	if err := os.WriteFile(filepath.Join(dir, rel), []byte(updated), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	e, err := idx.Reparse(context.Background(), rel)
+	if err != nil {
+		t.Fatalf("Reparse: %v", err)
+	}
+	if e.Subject != "Invoice #1234 (corrected)" {
+		t.Errorf("subject = %q", e.Subject)
+	}
+	if res := idx.Search("marimba", 0, 0); res.Total != 1 || res.Hits[0].Path != rel {
+		t.Errorf("search new body: %+v", res)
+	}
+	if res := idx.Search("xylophone", 0, 0); res.Total != 0 {
+		t.Errorf("stale body still indexed: total = %d", res.Total)
+	}
+	if s := idx.Stats(); s.TotalEmails != 3 {
+		t.Errorf("total = %d, want 3", s.TotalEmails)
+	}
+
+	// The change is persisted to Parquet.
+	reloaded, err := index.New(dir, parquetPath, nil, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer reloaded.Close()
+	if res := reloaded.Search("marimba", 0, 0); res.Total != 1 {
+		t.Errorf("reloaded search total = %d, want 1", res.Total)
+	}
+
+	if _, err := idx.Reparse(context.Background(), "nope.eml"); err == nil {
+		t.Error("expected error for missing file")
+	}
+	os.WriteFile(filepath.Join(dir, "new.eml"), []byte(updated), 0644)
+	if _, err := idx.Reparse(context.Background(), "new.eml"); !errors.Is(err, index.ErrNotIndexed) {
+		t.Errorf("err = %v, want ErrNotIndexed", err)
+	}
+}
+
+func TestReparseRethreads(t *testing.T) {
+	dir := t.TempDir()
+	write := func(name, headers string) {
+		t.Helper()
+		if err := os.WriteFile(filepath.Join(dir, name), []byte("From: a@test.com\r\nSubject: Plan\r\n"+headers+"\r\nBody.\r\n"), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	write("a.eml", "Message-ID: <a@test>\r\n")
+	write("b.eml", "Message-ID: <b@test>\r\n")
+	write("c.eml", "Message-ID: <c@test>\r\nIn-Reply-To: <b@test>\r\n")
+	idx, err := index.New(dir, filepath.Join(t.TempDir(), "index.parquet"), nil, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer idx.Close()
+	idx.Build()
+	threads := func() map[string]string {
+		got := make(map[string]string)
+		for _, h := range idx.Search("plan", 0, 0).Hits {
+			got[h.Path] = h.ThreadID
+		}
+		return got
+	}
+	if got := threads(); got["a.eml"] == got["b.eml"] || got["b.eml"] != got["c.eml"] {
+		t.Fatalf("threads before = %v", got)
+	}
+
+	// b turns out to reply to a, which joins its whole thread to a's.
+	write("b.eml", "Message-ID: <b@test>\r\nIn-Reply-To: <a@test>\r\n")
+	if _, err := idx.Reparse(context.Background(), "b.eml"); err != nil {
+		t.Fatal(err)
+	}
+	if got := threads(); got["a.eml"] == "" || got["b.eml"] != got["a.eml"] || got["c.eml"] != got["a.eml"] {
+		t.Errorf("threads after = %v, want one conversation", got)
+	}
+}
+
+func TestSearchByIndexedHeader(t *testing.T) {
+	eml.SetIndexedHeaders([]string{"list-id", "X-Ticket-ID"})
+	t.Cleanup(func() { eml.SetIndexedHeaders(nil) })
+
+	dir := t.TempDir()
+	sub := filepath.Join(dir, "account", "inbox")
+	if err := os.MkdirAll(sub, 0755); err != nil {
+		t.Fatal(err)
+	}
+	emails := map[string]string{
+		"list.eml":   "From: a@b.com\r\nSubject: Release notes\r\nList-Id: Announcements <announce.example.org>\r\nDate: Mon, 10 Feb 2025 12:00:00 +0000\r\n\r\nv2 is out.\r\n",
+		"ticket.eml": "From: desk@b.com\r\nSubject: Re: printer\r\nX-Ticket-ID: HD-4711\r\nDate: Mon, 10 Feb 2025 13:00:00 +0000\r\n\r\nFixed.\r\n",
+		"plain.eml":  "From: c@d.com\r\nSubject: Release party\r\nX-Mailer: announce-bot\r\nDate: Mon, 10 Feb 2025 14:00:00 +0000\r\n\r\nCake.\r\n",
+	}
+	for name, body := range emails {
+		os.WriteFile(filepath.Join(sub, name), []byte(body), 0644)
+	}
+
+	indexPath := filepath.Join(t.TempDir(), "index.parquet")
+	idx, err := index.New(dir, indexPath, nil, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer idx.Close()
+	idx.Build()
+
+	tests := []struct {
+		q    string
+		want int
+	}{
+		{"header:list-id:announce", 1},
+		{"header:List-Id:ANNOUNCE.example", 1},
+		{"release header:list-id", 1},
+		{"header:x-ticket-id", 1},
+		{"header:x-ticket-id:hd-4711", 1},
+		{"header:x-ticket-id:hd-9999", 0},
+		// X-Mailer is not configured, so it is not searchable.
+		{"header:x-mailer:announce", 0},
+	}
+	for _, tt := range tests {
+		if got := idx.Search(tt.q, 0, 0).Total; got != tt.want {
+			t.Errorf("Search(%q) total = %d, want %d", tt.q, got, tt.want)
+		}
+		multi := index.SearchMulti([]index.AccountIndex{{ID: "a1", IndexPath: indexPath}}, tt.q, 0, 0)
+		if multi.Total != tt.want {
+			t.Errorf("SearchMulti(%q) total = %d, want %d", tt.q, multi.Total, tt.want)
+		}
+	}
+}
+
+func TestBuildIfChanged(t *testing.T) {
+	dir := t.TempDir()
+	sub := filepath.Join(dir, "inbox")
+	os.MkdirAll(sub, 0755)
+	os.WriteFile(filepath.Join(sub, "a.eml"), []byte("From: a@b.com\r\nSubject: One\r\n\r\nbody\r\n"), 0644)
+	indexPath := filepath.Join(t.TempDir(), "index.parquet")
+
+	idx, err := index.New(dir, indexPath, nil, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if idx.UpToDate() {
+		t.Error("never-built index reported up to date")
+	}
+	if built, n, _ := idx.BuildIfChanged(); !built || n != 1 {
+		t.Fatalf("first BuildIfChanged = %v, %d; want a build of 1 email", built, n)
+	}
+	idx.Close()
+
+	// A fresh handle, as after a restart, sees the saved fingerprint.
+	idx, err = index.New(dir, indexPath, nil, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer idx.Close()
+	if built, _, _ := idx.BuildIfChanged(); built {
+		t.Error("rebuilt although nothing changed")
+	}
+
+	os.WriteFile(filepath.Join(sub, "b.eml"), []byte("From: c@d.com\r\nSubject: Two\r\n\r\nbody\r\n"), 0644)
+	if idx.UpToDate() {
+		t.Error("new file not noticed")
+	}
+	if built, n, _ := idx.BuildIfChanged(); !built || n != 2 {
+		t.Errorf("BuildIfChanged after new file = %v, %d; want a build of 2 emails", built, n)
+	}
+
+	idx.ClearCache()
+	if idx.UpToDate() {
+		t.Error("cleared index reported up to date")
+	}
+}
+
+func TestSearchFromOperator(t *testing.T) {
+	dir := t.TempDir()
+	sub := filepath.Join(dir, "inbox")
+	os.MkdirAll(sub, 0755)
+	os.WriteFile(filepath.Join(sub, "john.eml"), []byte("From: \"John Smith\" <jsmith@corp.com>\r\nTo: me@example.com\r\nSubject: Budget\r\n\r\nSee attached.\r\n"), 0644)
+	os.WriteFile(filepath.Join(sub, "other.eml"), []byte("From: Jane Doe <jane@corp.com>\r\nTo: me@example.com\r\nSubject: Re: Smith's budget\r\n\r\nAsk John Smith.\r\n"), 0644)
+
+	indexPath := filepath.Join(t.TempDir(), "index.parquet")
+	idx, err := index.New(dir, indexPath, nil, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer idx.Close()
+	idx.Build()
+
+	for _, q := range []string{"from:smith", "from:jsmith", "FROM:JSmith@Corp.com", `from:"John Smith"`, `budget from:"john smith"`} {
+		res := idx.Search(q, 0, 0)
+		if res.Total != 1 || !strings.Contains(res.Hits[0].From, "jsmith@corp.com") {
+			t.Errorf("Search(%q) = %d hits, want only John's email", q, res.Total)
+		}
+		multi := index.SearchMulti([]index.AccountIndex{{ID: "a1", IndexPath: indexPath}}, q, 0, 0)
+		if multi.Total != 1 {
+			t.Errorf("SearchMulti(%q) total = %d, want 1", q, multi.Total)
+		}
+	}
+	if res := idx.Search("from:corp.com", 0, 0); res.Total != 2 {
+		t.Errorf("from:corp.com total = %d, want 2", res.Total)
+	}
+	if res := idx.Search(`subject:"smith's budget"`, 0, 0); res.Total != 1 {
+		t.Errorf("subject filter total = %d, want 1", res.Total)
+	}
+}
+
+func TestBodylessIndex(t *testing.T) {
+	eml.SetParseBody(false)
+	t.Cleanup(func() { eml.SetParseBody(true) })
+
+	dir := t.TempDir()
+	sub := filepath.Join(dir, "inbox")
+	os.MkdirAll(sub, 0755)
+	os.WriteFile(filepath.Join(sub, "plain.eml"), []byte("From: alice@example.com\r\nTo: bob@example.com\r\nSubject: Quarterly report\r\nDate: Mon, 10 Feb 2025 12:00:00 +0000\r\n\r\nThe numbers look sharp.\r\n"), 0644)
+	os.WriteFile(filepath.Join(sub, "multi.eml"), []byte("From: carol@example.com\r\nSubject: Photos\r\nMIME-Version: 1.0\r\nContent-Type: multipart/mixed; boundary=b\r\n\r\n--b\r\nContent-Type: text/plain\r\n\r\nSharp pictures attached.\r\n--b\r\nContent-Type: image/png\r\nContent-Disposition: attachment; filename=a.png\r\n\r\nxx\r\n--b--\r\n"), 0644)
+
+	indexPath := filepath.Join(t.TempDir(), "index.parquet")
+	idx, err := index.New(dir, indexPath, nil, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer idx.Close()
+	idx.Build()
+
+	tests := []struct {
+		q    string
+		want int
+	}{
+		{"quarterly", 1},
+		{"alice", 1},
+		{"bob", 1},
+		{"has:attachment", 1},
+		// Body text is not indexed.
+		{"sharp", 0},
+	}
+	accounts := []index.AccountIndex{{ID: "a1", IndexPath: indexPath}}
+	for _, tt := range tests {
+		if got := idx.Search(tt.q, 0, 0).Total; got != tt.want {
+			t.Errorf("Search(%q) total = %d, want %d", tt.q, got, tt.want)
+		}
+		if got := index.SearchMulti(accounts, tt.q, 0, 0).Total; got != tt.want {
+			t.Errorf("SearchMulti(%q) total = %d, want %d", tt.q, got, tt.want)
+		}
+	}
+
+	// fields=body has no column to match: no hits, not an SQL error.
+	for fields, want := range map[string]int{"body": 0, "body,subject": 1} {
+		hits := 0
+		err := idx.Stream(context.Background(), "quarterly", strings.Split(fields, ","), func(index.Hit) error { hits++; return nil })
+		if err != nil || hits != want {
+			t.Errorf("Stream(fields=%s) = %d hits, %v; want %d", fields, hits, err, want)
+		}
+	}
+
+	db, err := sql.Open("duckdb", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	var n int
+	if err := db.QueryRow("SELECT COUNT(*) FROM (DESCRIBE SELECT * FROM read_parquet(?)) WHERE column_name = 'body_text'", indexPath).Scan(&n); err != nil {
+		t.Fatal(err)
+	}
+	if n != 0 {
+		t.Error("body-less index still has a body_text column")
+	}
+
+	// Reopening loads the body-less Parquet file.
+	reopened, err := index.New(dir, indexPath, nil, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer reopened.Close()
+	if got := reopened.Search("quarterly", 0, 0).Total; got != 1 {
+		t.Errorf("after reload: total = %d, want 1", got)
+	}
+}
+
+func TestSearchIgnoresZeroWidthChars(t *testing.T) {
+	dir := t.TempDir()
+	sub := filepath.Join(dir, "inbox")
+	os.MkdirAll(sub, 0755)
+	os.WriteFile(filepath.Join(sub, "promo.eml"), []byte("From: shop@example.com\r\nSubject: Last chance\r\nContent-Type: text/plain; charset=utf-8\r\n\r\nYour in\u200bvoice is\u00a0ready.\r\n"), 0644)
+
+	idx := newTestIndex(t, dir)
+	idx.Build()
+
+	for _, q := range []string{"invoice", "in\u200bvoice", "invoice is ready", "invoice is\u00a0ready"} {
+		if got := idx.Search(q, 0, 0).Total; got != 1 {
+			t.Errorf("Search(%q) total = %d, want 1", q, got)
+		}
+	}
+}
+
+func TestBuildExcludesFolders(t *testing.T) {
+	dir := t.TempDir()
+	for _, f := range []string{"inbox/a.eml", "gmail/spam/b.eml", "archive/spam-reports/c.eml"} {
+		p := filepath.Join(dir, f)
+		os.MkdirAll(filepath.Dir(p), 0755)
+		os.WriteFile(p, []byte("From: a@b.com\r\nSubject: "+f+"\r\n\r\nbody\r\n"), 0644)
+	}
+	indexPath := filepath.Join(t.TempDir(), "index.parquet")
+
+	idx, err := index.New(dir, indexPath, nil, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer idx.Close()
+	if built, n, _ := idx.BuildIfChanged(); !built || n != 3 {
+		t.Fatalf("BuildIfChanged = %v, %d; want a build of 3 emails", built, n)
+	}
+
+	idx.SetExcludeFolders("Spam")
+	if idx.UpToDate() {
+		t.Error("changed exclusions not noticed")
+	}
+	if built, n, _ := idx.BuildIfChanged(); !built || n != 2 {
+		t.Fatalf("BuildIfChanged with Spam excluded = %v, %d; want a build of 2 emails", built, n)
+	}
+	for _, h := range idx.Search("", 0, 10).Hits {
+		if strings.Contains(h.Path, "gmail/spam") {
+			t.Errorf("excluded email %s indexed", h.Path)
+		}
+	}
+
+	// Mail arriving in an excluded folder does not make the index stale.
+	os.WriteFile(filepath.Join(dir, "gmail", "spam", "d.eml"), []byte("From: x@y.com\r\nSubject: New\r\n\r\nbody\r\n"), 0644)
+	if !idx.UpToDate() {
+		t.Error("new file in an excluded folder made the index stale")
+	}
+}
+
+func TestNewLeavesBrokenParquetToCaller(t *testing.T) {
+	dir := t.TempDir()
+	seedEmails(t, dir)
+	spam := filepath.Join(dir, "test-account", "spam")
+	if err := os.MkdirAll(spam, 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(spam, "s.eml"), []byte("From: x@y.com\r\nSubject: Meeting offer\r\n\r\nbody\r\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	// A readable Parquet file that is not an index: loading it succeeds,
+	// but the email columns are missing.
+	foreign := filepath.Join(t.TempDir(), "index.parquet")
+	db, err := sql.Open("duckdb", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = db.Exec("COPY (SELECT 1 AS x) TO '" + foreign + "' (FORMAT PARQUET)")
+	db.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	garbage := filepath.Join(t.TempDir(), "index.parquet")
+	if err := os.WriteFile(garbage, []byte("not a parquet file"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	for name, path := range map[string]string{"missing columns": foreign, "unreadable": garbage} {
+		t.Run(name, func(t *testing.T) {
+			idx, err := index.New(dir, path, nil, "")
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer idx.Close()
+			// New does not build: the caller has not set exclusions yet.
+			stats := idx.Stats()
+			if !stats.NeedsRebuild || stats.LoadError == "" || stats.TotalEmails != 0 {
+				t.Fatalf("stats = %+v, want an empty index that needs a rebuild", stats)
+			}
+			if idx.UpToDate() {
+				t.Error("index needing a rebuild reported up to date")
+			}
+
+			idx.SetExcludeFolders("Spam")
+			if built, n, _ := idx.BuildIfChanged(); !built || n != 3 {
+				t.Fatalf("BuildIfChanged = %v, %d; want a build of 3 emails", built, n)
+			}
+			if idx.NeedsRebuild() {
+				t.Error("NeedsRebuild still set after Build")
+			}
+			if res := idx.Search("meeting", 0, 0); res.Total != 2 {
+				t.Errorf("search total = %d, want 2 (spam excluded)", res.Total)
+			}
+
+			// The rebuilt file loads cleanly next time.
+			again, err := index.New(dir, path, nil, "")
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer again.Close()
+			if s := again.Stats(); s.NeedsRebuild || s.TotalEmails != 3 {
+				t.Errorf("reopened stats = %+v", s)
+			}
+		})
+	}
+}
+
+func TestNewFlagsOlderSchemaVersion(t *testing.T) {
+	dir := t.TempDir()
+	seedEmails(t, dir)
+	path := filepath.Join(t.TempDir(), "index.parquet")
+
+	idx, err := index.New(dir, path, nil, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	idx.Build()
+	idx.Close()
+
+	// Rewrite the file as one from before schema versions were recorded.
+	db, err := sql.Open("duckdb", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	old := path + ".old"
+	_, err = db.Exec("COPY (SELECT * FROM read_parquet('" + path + "')) TO '" + old + "' (FORMAT PARQUET)")
+	db.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Rename(old, path); err != nil {
+		t.Fatal(err)
+	}
+
+	// Without emails to rebuild from, the old file is still served.
+	stale, err := index.New("", path, nil, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s := stale.Stats(); s.NeedsRebuild || s.SchemaVersion != 0 || s.TotalEmails != 3 {
+		t.Errorf("stats without emails = %+v, want the old file served", s)
+	}
+	stale.Close()
+
+	idx, err = index.New(dir, path, nil, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer idx.Close()
+	// The old file is served until the caller rebuilds it.
+	if s := idx.Stats(); !s.NeedsRebuild || s.SchemaVersion != 0 || s.TotalEmails != 3 {
+		t.Fatalf("stats = %+v, want the old file served and flagged", s)
+	}
+	if res := idx.Search("meeting", 0, 0); res.Total != 2 {
+		t.Errorf("search total on the old file = %d, want 2", res.Total)
+	}
+	if idx.UpToDate() {
+		t.Error("index needing a rebuild reported up to date")
+	}
+	idx.Build()
+	if s := idx.Stats(); s.NeedsRebuild || s.SchemaVersion != index.SchemaVersion || s.TotalEmails != 3 {
+		t.Fatalf("stats after Build = %+v, want version %d", s, index.SchemaVersion)
+	}
+
+	again, err := index.New(dir, path, nil, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer again.Close()
+	if s := again.Stats(); s.NeedsRebuild || s.SchemaVersion != index.SchemaVersion {
+		t.Errorf("reopened stats = %+v", s)
+	}
+}
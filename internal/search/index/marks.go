@@ -0,0 +1,89 @@
+package index
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/eslider/mails/internal/checksum"
+	"github.com/eslider/mails/internal/search/eml"
+)
+
+// Marks are the emails a user flagged and starred, as annotation keys:
+// the first checksum.LegacyLength characters of a file name's checksum
+// (see annotation.Key). They live outside the index, so a search for
+// flagged:, starred: or vfolder: is given them with WithMarks.
+type Marks struct {
+	Flagged []string
+	Starred []string
+
+	// Folders lists the keys moved to each virtual folder, by lower-cased
+	// folder name.
+	Folders map[string][]string
+}
+
+type marksKey struct{}
+
+// WithMarks returns a context whose searches answer the flagged:, starred:
+// and vfolder: operators from m. Without it no email is flagged or
+// starred, and vfolder: finds real folders only.
+func WithMarks(ctx context.Context, m Marks) context.Context {
+	return context.WithValue(ctx, marksKey{}, m)
+}
+
+// FolderKey returns the key of Marks.Folders for the virtual folder name,
+// normalized as parseQuery normalizes vfolder: values.
+func FolderKey(name string) string {
+	return strings.ToLower(eml.NormalizeText(name))
+}
+
+func marksFrom(ctx context.Context) Marks {
+	m, _ := ctx.Value(marksKey{}).(Marks)
+	return m
+}
+
+// markFilter is a flagged: or starred: operator.
+type markFilter struct {
+	Mark string // "flagged" or "starred"
+	Want bool
+}
+
+// folderPredicate matches the emails moved to the virtual folder name
+// (lower-case), with keys, or stored in a directory of that name: any
+// directory of the path, or a run of them such as "gmail/sent".
+func folderPredicate(keys []string, name string) (string, []any) {
+	return "(" + markPredicate(keys, true) + " OR contains('/' || LOWER(path), ?))", []any{"/" + name + "/"}
+}
+
+// markPredicate restricts rows to those whose key is in keys, or not in
+// them when want is false. Keys are hex, so they are written inline.
+func markPredicate(keys []string, want bool) string {
+	quoted := make([]string, 0, len(keys))
+	for _, k := range keys {
+		if isHex(k) {
+			quoted = append(quoted, "'"+k+"'")
+		}
+	}
+	if len(quoted) == 0 {
+		return strconv.FormatBool(!want)
+	}
+	key := fmt.Sprintf("left(regexp_extract(path, '%s', 2), %d)", checksum.SQLPattern, checksum.LegacyLength)
+	in := key + " IN (" + strings.Join(quoted, ", ") + ")"
+	if !want {
+		return "NOT " + in
+	}
+	return in
+}
+
+func isHex(s string) bool {
+	if s == "" {
+		return false
+	}
+	for _, r := range s {
+		if !(r >= '0' && r <= '9' || r >= 'a' && r <= 'f') {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,204 @@
+package index
+
+import (
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/eslider/mails/internal/search/eml"
+)
+
+// countFilter is a numeric comparison such as attachments:>2.
+type countFilter struct {
+	Op string // one of =, >, >=, <, <=
+	N  int
+}
+
+// headerFilter matches a header captured via INDEX_HEADERS. An empty Value
+// only requires the header to be present.
+type headerFilter struct {
+	Name  string // lower-case header name
+	Value string
+}
+
+// fieldFilter restricts one searchable field (see fieldColumns) to values
+// containing Value.
+type fieldFilter struct {
+	Field string
+	Value string
+}
+
+// parsedQuery is a search query split into free text and operators.
+type parsedQuery struct {
+	Text        string
+	Fields      []fieldFilter
+	Attachments []countFilter
+	Headers     []headerFilter
+	Marks       []markFilter
+	Folders     []string  // vfolder: names, lower-case
+	Before      time.Time // exclusive; zero means unbounded
+	After       time.Time // inclusive; zero means unbounded
+
+	// InAttachment matches Text against attachment text only.
+	InAttachment bool
+}
+
+// parseQuery extracts search operators from q, leaving the remaining words
+// as free text:
+//
+//	from:smith         the From header, display name or address, contains "smith"
+//	from:"John Smith"  quoted values may contain spaces (also to:, subject:)
+//	has:attachment     at least one attachment
+//	attachments:>2     more than two (also >=, <, <=, = or a bare number)
+//	before:2023-01-01  dated before that day (UTC)
+//	after:2023-01-01   dated on or after that day (UTC)
+//	header:list-id:announce  an indexed header (INDEX_HEADERS) contains "announce"
+//	header:x-ticket-id       an indexed header is present
+//	in:attachment      the free text is searched in attachment text
+//	                   (INDEX_ATTACHMENTS) instead of the email itself
+//	flagged:true       flagged by the user (also starred:, and false for
+//	                   the rest); see WithMarks
+//	vfolder:invoices   moved to the virtual folder "invoices" by the user,
+//	                   or stored in a folder of that name; see WithMarks
+//
+// Tokens that look like operators but do not parse stay in the text. q is
+// normalized like indexed text (see eml.NormalizeText) so the two line up.
+func parseQuery(q string) parsedQuery {
+	q = eml.NormalizeText(q)
+	var pq parsedQuery
+	var words []string
+	for _, tok := range queryTokens(q) {
+		lower := strings.ToLower(tok)
+		switch {
+		case strings.HasPrefix(lower, "from:"), strings.HasPrefix(lower, "to:"), strings.HasPrefix(lower, "subject:"):
+			field, value, _ := strings.Cut(lower, ":")
+			if value = unquote(value); value == "" {
+				words = append(words, tok)
+				continue
+			}
+			pq.Fields = append(pq.Fields, fieldFilter{Field: field, Value: value})
+		case lower == "in:attachment" || lower == "in:attachments":
+			pq.InAttachment = true
+		case lower == "has:attachment" || lower == "has:attachments":
+			pq.Attachments = append(pq.Attachments, countFilter{Op: ">", N: 0})
+		case strings.HasPrefix(lower, "attachments:"):
+			f, ok := parseCountFilter(strings.TrimPrefix(lower, "attachments:"))
+			if !ok {
+				words = append(words, tok)
+				continue
+			}
+			pq.Attachments = append(pq.Attachments, f)
+		case strings.HasPrefix(lower, "header:"):
+			name, value, _ := strings.Cut(strings.TrimPrefix(lower, "header:"), ":")
+			if !isHeaderName(name) {
+				words = append(words, tok)
+				continue
+			}
+			pq.Headers = append(pq.Headers, headerFilter{Name: name, Value: unquote(value)})
+		case strings.HasPrefix(lower, "flagged:"), strings.HasPrefix(lower, "starred:"):
+			mark, value, _ := strings.Cut(lower, ":")
+			want, err := strconv.ParseBool(value)
+			if err != nil {
+				words = append(words, tok)
+				continue
+			}
+			pq.Marks = append(pq.Marks, markFilter{Mark: mark, Want: want})
+		case strings.HasPrefix(lower, "vfolder:"):
+			name := strings.Trim(unquote(strings.TrimPrefix(lower, "vfolder:")), "/")
+			if name == "" {
+				words = append(words, tok)
+				continue
+			}
+			pq.Folders = append(pq.Folders, name)
+		case strings.HasPrefix(lower, "before:"), strings.HasPrefix(lower, "after:"):
+			name, value, _ := strings.Cut(lower, ":")
+			d, ok := parseDay(value)
+			if !ok {
+				words = append(words, tok)
+				continue
+			}
+			if name == "before" {
+				pq.Before = d
+			} else {
+				pq.After = d
+			}
+		default:
+			words = append(words, tok)
+		}
+	}
+	pq.Text = strings.Join(words, " ")
+	return pq
+}
+
+// queryTokens splits q on whitespace, except inside double quotes, so
+// from:"John Smith" is one token.
+func queryTokens(q string) []string {
+	var toks []string
+	var cur strings.Builder
+	quoted := false
+	for _, r := range q {
+		switch {
+		case r == '"':
+			quoted = !quoted
+		case unicode.IsSpace(r) && !quoted:
+			if cur.Len() > 0 {
+				toks = append(toks, cur.String())
+				cur.Reset()
+			}
+			continue
+		}
+		cur.WriteRune(r)
+	}
+	if cur.Len() > 0 {
+		toks = append(toks, cur.String())
+	}
+	return toks
+}
+
+// unquote strips one pair of surrounding double quotes from s.
+func unquote(s string) string {
+	if len(s) >= 2 && s[0] == '"' && s[len(s)-1] == '"' {
+		return s[1 : len(s)-1]
+	}
+	return s
+}
+
+// parseCountFilter parses ">2", ">=1", "<3", "<=3", "=0" or "2".
+func parseCountFilter(s string) (countFilter, bool) {
+	op := "="
+	for _, candidate := range []string{">=", "<=", ">", "<", "="} {
+		if strings.HasPrefix(s, candidate) {
+			op = candidate
+			s = s[len(candidate):]
+			break
+		}
+	}
+	n, err := strconv.Atoi(s)
+	if err != nil || n < 0 {
+		return countFilter{}, false
+	}
+	return countFilter{Op: op, N: n}, true
+}
+
+// parseDay parses "2023-01-31" or "2023/01/31" as midnight UTC.
+func parseDay(s string) (time.Time, bool) {
+	t, err := time.Parse("2006-01-02", strings.ReplaceAll(s, "/", "-"))
+	if err != nil {
+		return time.Time{}, false
+	}
+	return t, true
+}
+
+// isHeaderName reports whether s is a plausible header field name.
+func isHeaderName(s string) bool {
+	if s == "" {
+		return false
+	}
+	for _, r := range s {
+		if !(r >= 'a' && r <= 'z' || r >= '0' && r <= '9' || r == '-' || r == '_') {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,55 @@
+package index
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestParseQuery(t *testing.T) {
+	tests := []struct {
+		q    string
+		want parsedQuery
+	}{
+		{"invoice", parsedQuery{Text: "invoice"}},
+		{"has:attachment", parsedQuery{Attachments: []countFilter{{">", 0}}}},
+		{"invoice HAS:Attachments", parsedQuery{Text: "invoice", Attachments: []countFilter{{">", 0}}}},
+		{"attachments:>2 report", parsedQuery{Text: "report", Attachments: []countFilter{{">", 2}}}},
+		{"attachments:>=1", parsedQuery{Attachments: []countFilter{{">=", 1}}}},
+		{"attachments:<3", parsedQuery{Attachments: []countFilter{{"<", 3}}}},
+		{"attachments:<=3", parsedQuery{Attachments: []countFilter{{"<=", 3}}}},
+		{"attachments:=0", parsedQuery{Attachments: []countFilter{{"=", 0}}}},
+		{"attachments:2", parsedQuery{Attachments: []countFilter{{"=", 2}}}},
+		{"attachments:>1 attachments:<4", parsedQuery{Attachments: []countFilter{{">", 1}, {"<", 4}}}},
+		{"before:2023-01-01 newsletter", parsedQuery{Text: "newsletter", Before: time.Date(2023, 1, 1, 0, 0, 0, 0, time.UTC)}},
+		{"after:2022/06/30", parsedQuery{After: time.Date(2022, 6, 30, 0, 0, 0, 0, time.UTC)}},
+		{"from:smith", parsedQuery{Fields: []fieldFilter{{"from", "smith"}}}},
+		{`invoice from:"John Smith" to:me@corp.com`, parsedQuery{Text: "invoice", Fields: []fieldFilter{{"from", "john smith"}, {"to", "me@corp.com"}}}},
+		{`subject:"quarterly  report" draft`, parsedQuery{Text: "draft", Fields: []fieldFilter{{"subject", "quarterly report"}}}},
+		{"in\u200bvoice", parsedQuery{Text: "invoice"}},
+		{`header:x-team:"red team"`, parsedQuery{Headers: []headerFilter{{"x-team", "red team"}}}},
+		{"header:List-Id:announce", parsedQuery{Headers: []headerFilter{{"list-id", "announce"}}}},
+		{"header:x-ticket-id ticket", parsedQuery{Text: "ticket", Headers: []headerFilter{{"x-ticket-id", ""}}}},
+		{"header:x-url:https://a.example", parsedQuery{Headers: []headerFilter{{"x-url", "https://a.example"}}}},
+		{"flagged:true report", parsedQuery{Text: "report", Marks: []markFilter{{"flagged", true}}}},
+		{"Starred:false", parsedQuery{Marks: []markFilter{{"starred", false}}}},
+		{"vfolder:Invoices tax", parsedQuery{Text: "tax", Folders: []string{"invoices"}}},
+		{`vfolder:"tax 2024/"`, parsedQuery{Folders: []string{"tax 2024"}}},
+		// Malformed operators are searched as text.
+		{"flagged:maybe", parsedQuery{Text: "flagged:maybe"}},
+		{"vfolder:", parsedQuery{Text: "vfolder:"}},
+		{"attachments:many", parsedQuery{Text: "attachments:many"}},
+		{"attachments:>", parsedQuery{Text: "attachments:>"}},
+		{"attachments:-1", parsedQuery{Text: "attachments:-1"}},
+		{"has:stars", parsedQuery{Text: "has:stars"}},
+		{"before:yesterday", parsedQuery{Text: "before:yesterday"}},
+		{"header:", parsedQuery{Text: "header:"}},
+		{"from: smith", parsedQuery{Text: "from: smith"}},
+		{`header:"x":y`, parsedQuery{Text: `header:"x":y`}},
+	}
+	for _, tt := range tests {
+		if got := parseQuery(tt.q); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("parseQuery(%q) = %+v, want %+v", tt.q, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,79 @@
+package index
+
+import (
+	"context"
+	"fmt"
+	"unicode/utf8"
+
+	"github.com/eslider/mails/internal/search/eml"
+)
+
+// snippetContext is the number of characters kept either side of a match
+// in hit snippets.
+const snippetContext = 80
+
+// previewLen is the number of characters in the body preview of browse
+// results (see WithPreview).
+const previewLen = 140
+
+// previewColumn selects the start of body_text for previews. It reads more
+// than previewLen characters because eml.Preview collapses whitespace, and
+// bodies often open with blank lines.
+var previewColumn = fmt.Sprintf("left(body_text, %d) AS body_text", 8*previewLen)
+
+type previewKey struct{}
+
+// WithPreview returns a context that makes searches for the empty query
+// set each hit's Snippet to the start of its body (see eml.Preview), as
+// matching queries set it to the match. It costs reading the bodies, so
+// browse views ask for it.
+func WithPreview(ctx context.Context) context.Context {
+	return context.WithValue(ctx, previewKey{}, true)
+}
+
+// wantsPreview reports whether ctx came from WithPreview.
+func wantsPreview(ctx context.Context) bool {
+	on, _ := ctx.Value(previewKey{}).(bool)
+	return on
+}
+
+// setPreviews sets the Snippet of hits scanned with previewColumn.
+func setPreviews(hits []Hit) {
+	for i := range hits {
+		hits[i].Snippet = eml.Preview(hits[i].BodyText, previewLen)
+	}
+}
+
+// sqlSnippets makes matching queries cut body_text down to a window around
+// the first match inside DuckDB, so full bodies never cross into Go. When
+// false, the whole body is selected and Go finds the match (the original
+// path, kept as a fallback and for comparison).
+var sqlSnippets = true
+
+// bodyColumn returns the select expression standing in for body_text in
+// matching queries, with its arguments (they precede the WHERE arguments).
+// For in:attachment queries it is the attachment text, so snippets show
+// the match there.
+//
+// The window keeps one character more than snippetContext on each side, so
+// eml.Snippet still sees whether the match was cut from a longer body and
+// adds the same ellipses as on the full text.
+func bodyColumn(q string) (string, []any) {
+	pq := parseQuery(q)
+	col := "body_text"
+	if pq.InAttachment {
+		col = "attachment_text"
+	}
+	if !sqlSnippets {
+		return col + " AS body_text", nil
+	}
+	text := pq.Text
+	if text == "" {
+		return "'' AS body_text", nil
+	}
+	margin := snippetContext + 1
+	expr := fmt.Sprintf(`CASE WHEN strpos(LOWER(%[3]s), ?) > 0
+		THEN substring(%[3]s, greatest(strpos(LOWER(%[3]s), ?) - %[1]d, 1), least(strpos(LOWER(%[3]s), ?) - 1, %[1]d) + %[2]d + %[1]d)
+		ELSE '' END AS body_text`, margin, utf8.RuneCountInString(text), col)
+	return expr, []any{text, text, text}
+}
@@ -0,0 +1,106 @@
+package index
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+)
+
+// newRowsIndex returns an in-memory index holding the given subject/body pairs.
+func newRowsIndex(t testing.TB, rows [][2]string) *Index {
+	t.Helper()
+	idx, err := New(t.TempDir(), "", nil, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { idx.Close() })
+	for i, r := range rows {
+		if _, err := idx.db.Exec("INSERT INTO emails (path, subject, body_text, date) VALUES (?, ?, ?, TIMESTAMP '2025-02-10 09:00:00' + INTERVAL (?) MINUTE)",
+			fmt.Sprintf("m%04d.eml", i), r[0], r[1], i); err != nil {
+			t.Fatal(err)
+		}
+	}
+	idx.total = len(rows)
+	return idx
+}
+
+func withGoSnippets(fn func()) {
+	sqlSnippets = false
+	defer func() { sqlSnippets = true }()
+	fn()
+}
+
+func TestSQLSnippetsMatchGoSnippets(t *testing.T) {
+	long := strings.Repeat("filler words here ", 20)
+	idx := newRowsIndex(t, [][2]string{
+		{"Needle", "short body with needle"},
+		{"Report", "needle at the very start " + long},
+		{"Report", long + "ends with the needle"},
+		{"Report", long + "the NEEDLE sits\n\n in   the middle " + long},
+		{"Report", "Grüße aus München — " + long + " needle über alles 🎉 " + long},
+		{"日本語の件名", long + "日本語の本文に needle があります" + long},
+		{"Needle in a very long subject line that goes on and on well past the snippet context window, really", long},
+		{"Two matches", "needle first, " + long + " needle second"},
+	})
+
+	for _, q := range []string{"needle", "NEEDLE sits", "über", "日本語", "report needle", "needle has:attachment", "attachments:0 needle"} {
+		got := idx.Search(q, 0, 0)
+		var want SearchResult
+		withGoSnippets(func() { want = idx.Search(q, 0, 0) })
+		if got.Total != want.Total || len(got.Hits) != len(want.Hits) {
+			t.Fatalf("%q: total %d/%d, want %d/%d", q, got.Total, len(got.Hits), want.Total, len(want.Hits))
+		}
+		for i := range want.Hits {
+			if want.Hits[i].Snippet == "" {
+				t.Errorf("%q %s: empty snippet", q, want.Hits[i].Path)
+			}
+			if got.Hits[i].Snippet != want.Hits[i].Snippet {
+				t.Errorf("%q %s:\n sql snippet %q\n  go snippet %q", q, want.Hits[i].Path, got.Hits[i].Snippet, want.Hits[i].Snippet)
+			}
+		}
+	}
+}
+
+func BenchmarkQueryMatchesSnippets(b *testing.B) {
+	body := strings.Repeat("lorem ipsum dolor sit amet ", 800) + "needle" + strings.Repeat(" consectetur adipiscing elit", 800)
+	rows := make([][2]string, 500)
+	for i := range rows {
+		rows[i] = [2]string{fmt.Sprintf("Message %d", i), body}
+	}
+	idx := newRowsIndex(b, rows)
+
+	run := func(b *testing.B) {
+		b.ReportAllocs()
+		for b.Loop() {
+			if res := idx.Search("needle", 0, 500); len(res.Hits) != 500 {
+				b.Fatalf("hits = %d", len(res.Hits))
+			}
+		}
+	}
+	b.Run("sql", run)
+	b.Run("go", func(b *testing.B) { withGoSnippets(func() { run(b) }) })
+}
+
+func TestEmptyQueryPreview(t *testing.T) {
+	idx := newRowsIndex(t, [][2]string{
+		{"Short", "\n\nSee you\n  at noon."},
+		{"Long", strings.Repeat("word ", 100)},
+	})
+
+	for _, h := range idx.Search("", 0, 0).Hits {
+		if h.Snippet != "" {
+			t.Errorf("%s: snippet %q without WithPreview", h.Path, h.Snippet)
+		}
+	}
+	got := map[string]string{}
+	for _, h := range idx.SearchContext(WithPreview(context.Background()), "", 0, 0).Hits {
+		got[h.Subject] = h.Snippet
+	}
+	if got["Short"] != "See you at noon." {
+		t.Errorf("short preview = %q", got["Short"])
+	}
+	if long := got["Long"]; !strings.HasSuffix(long, "...") || len(long) > previewLen+3 {
+		t.Errorf("long preview = %q, want at most %d characters and ...", long, previewLen)
+	}
+}
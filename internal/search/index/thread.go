@@ -0,0 +1,201 @@
+package index
+
+import (
+	"context"
+	"database/sql"
+	"net/mail"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/eslider/mails/internal/search/eml"
+)
+
+// threadIDs groups emails into conversations and returns the thread ID of
+// each by path. Emails share a thread when one's Message-ID appears in the
+// other's References or In-Reply-To, directly or through other messages,
+// even ones not in the archive. The ID is the smallest Message-ID in the
+// conversation, so it does not depend on walk order. Emails with neither a
+// Message-ID nor references get none.
+func threadIDs(emails []eml.Email) map[string]string {
+	parent := make(map[string]string)
+	var find func(string) string
+	find = func(id string) string {
+		p, ok := parent[id]
+		if !ok || p == id {
+			parent[id] = id
+			return id
+		}
+		root := find(p)
+		parent[id] = root
+		return root
+	}
+	union := func(a, b string) {
+		ra, rb := find(a), find(b)
+		switch {
+		case ra < rb:
+			parent[rb] = ra
+		case rb < ra:
+			parent[ra] = rb
+		}
+	}
+
+	for _, e := range emails {
+		ids := e.References
+		if e.MessageID != "" {
+			ids = append([]string{e.MessageID}, ids...)
+		}
+		for _, id := range ids {
+			union(ids[0], id)
+		}
+	}
+
+	threads := make(map[string]string, len(emails))
+	for _, e := range emails {
+		switch {
+		case e.MessageID != "":
+			threads[e.Path] = find(e.MessageID)
+		case len(e.References) > 0:
+			threads[e.Path] = find(e.References[0])
+		}
+	}
+	return threads
+}
+
+// ThreadHit is one conversation in search results grouped by thread.
+type ThreadHit struct {
+	ThreadID string    `json:"thread_id"`
+	Subject  string    `json:"subject"` // of the newest matching message
+	Date     time.Time `json:"date"`    // of the newest matching message
+	Count    int       `json:"count"`   // matching messages in the thread
+
+	// Participants are the senders and recipients of the matching
+	// messages, by address, newest message first.
+	Participants []string `json:"participants"`
+
+	// Latest is the newest matching message, with its snippet.
+	Latest Hit `json:"latest"`
+}
+
+// rethread returns the thread ID of e, reparsed, among the other indexed
+// emails, as threadIDs would give it: the smallest Message-ID among its
+// own, its references and the threads of the emails these name. Threads
+// the email now joins are merged into the result.
+func rethread(ctx context.Context, tx *sql.Tx, e eml.Email) (string, error) {
+	ids := e.References
+	if e.MessageID != "" {
+		ids = append([]string{e.MessageID}, ids...)
+	}
+	if len(ids) == 0 {
+		return "", nil
+	}
+	marks := strings.TrimSuffix(strings.Repeat("?, ", len(ids)), ", ")
+	args := make([]any, 0, 2*len(ids)+1)
+	args = append(args, e.Path)
+	for range 2 {
+		for _, id := range ids {
+			args = append(args, id)
+		}
+	}
+	rows, err := tx.QueryContext(ctx, "SELECT DISTINCT thread_id FROM emails WHERE path <> ? AND thread_id <> '' AND (message_id IN ("+marks+") OR thread_id IN ("+marks+"))", args...)
+	if err != nil {
+		return "", err
+	}
+	var joined []any
+	thread := slices.Min(ids)
+	for rows.Next() {
+		var t string
+		if err := rows.Scan(&t); err != nil {
+			rows.Close()
+			return "", err
+		}
+		joined = append(joined, t)
+		thread = min(thread, t)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return "", err
+	}
+	if len(joined) > 0 {
+		marks = strings.TrimSuffix(strings.Repeat("?, ", len(joined)), ", ")
+		if _, err := tx.ExecContext(ctx, "UPDATE emails SET thread_id = ? WHERE thread_id IN ("+marks+")", append([]any{thread}, joined...)...); err != nil {
+			return "", err
+		}
+	}
+	return thread, nil
+}
+
+// GroupByThread collapses hits of one conversation (same ThreadID) into a
+// ThreadHit, newest conversation first, and returns limit of them from
+// offset (all when limit <= 0) with the number of conversations. Hits
+// without a ThreadID are conversations of their own.
+func GroupByThread(hits []Hit, offset, limit int) ([]ThreadHit, int) {
+	var threads []*ThreadHit
+	byID := make(map[string]*ThreadHit)
+	seen := make(map[*ThreadHit]map[string]bool)
+	for _, h := range hits {
+		key := h.ThreadID
+		if key == "" {
+			key = "\x00" + h.AccountID + "\x00" + h.Path
+		}
+		t, ok := byID[key]
+		if !ok {
+			t = &ThreadHit{ThreadID: h.ThreadID, Participants: []string{}}
+			byID[key] = t
+			seen[t] = make(map[string]bool)
+			threads = append(threads, t)
+		}
+		t.Count++
+		if t.Count == 1 || h.Date.After(t.Date) {
+			t.Latest, t.Subject, t.Date = h, h.Subject, h.Date
+		}
+		for _, p := range participants(h.From, h.To) {
+			if k := strings.ToLower(p); !seen[t][k] {
+				seen[t][k] = true
+				t.Participants = append(t.Participants, p)
+			}
+		}
+	}
+	sort.SliceStable(threads, func(i, j int) bool { return threads[i].Date.After(threads[j].Date) })
+
+	total := len(threads)
+	if offset > total {
+		offset = total
+	}
+	end := total
+	if limit > 0 && offset+limit < total {
+		end = offset + limit
+	}
+	out := make([]ThreadHit, 0, end-offset)
+	for _, t := range threads[offset:end] {
+		if t.ThreadID == "" {
+			t.ThreadID = t.Latest.Path
+		}
+		out = append(out, *t)
+	}
+	return out, total
+}
+
+// participants returns the addresses in the From and To values of a hit,
+// falling back to the comma-separated text when it does not parse.
+func participants(fields ...string) []string {
+	var out []string
+	for _, f := range fields {
+		if strings.TrimSpace(f) == "" {
+			continue
+		}
+		if list, err := mail.ParseAddressList(f); err == nil {
+			for _, a := range list {
+				out = append(out, a.Address)
+			}
+			continue
+		}
+		for _, p := range strings.Split(f, ",") {
+			if p = strings.TrimSpace(p); p != "" {
+				out = append(out, p)
+			}
+		}
+	}
+	return out
+}
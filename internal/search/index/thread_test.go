@@ -0,0 +1,74 @@
+package index_test
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/eslider/mails/internal/search/index"
+)
+
+func TestSearchGroupByThread(t *testing.T) {
+	dir := t.TempDir()
+	inbox := filepath.Join(dir, "inbox")
+	if err := os.MkdirAll(inbox, 0755); err != nil {
+		t.Fatal(err)
+	}
+	// c.eml replies to a message that is not in the archive, which in turn
+	// replied to a.eml: all three belong to one thread.
+	for name, content := range map[string]string{
+		"a.eml": "From: Alice <alice@test.com>\r\nTo: bob@test.com\r\nSubject: Trip plans\r\nMessage-ID: <a@test>\r\nDate: Mon, 10 Feb 2025 09:00:00 +0000\r\n\r\nWhere to go?\r\n",
+		"b.eml": "From: bob@test.com\r\nTo: alice@test.com\r\nSubject: Re: Trip plans\r\nMessage-ID: <b@test>\r\nIn-Reply-To: <a@test>\r\nDate: Mon, 10 Feb 2025 10:00:00 +0000\r\n\r\nThe trip to the coast.\r\n",
+		"c.eml": "From: carol@test.com\r\nTo: alice@test.com, bob@test.com\r\nSubject: Re: Trip plans\r\nMessage-ID: <c@test>\r\nReferences: <a@test> <missing@test>\r\nIn-Reply-To: <missing@test>\r\nDate: Wed, 12 Feb 2025 08:00:00 +0000\r\n\r\nCount me in for the trip.\r\n",
+		"d.eml": "From: dave@test.com\r\nTo: alice@test.com\r\nSubject: Trip report\r\nMessage-ID: <d@test>\r\nDate: Tue, 11 Feb 2025 08:00:00 +0000\r\n\r\nMy trip was fine.\r\n",
+	} {
+		if err := os.WriteFile(filepath.Join(inbox, name), []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	indexPath := filepath.Join(t.TempDir(), "index.parquet")
+	idx, err := index.New(dir, indexPath, nil, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	idx.Build()
+	res := idx.Search("trip", 0, 0)
+	idx.Close()
+
+	threads, total := index.GroupByThread(res.Hits, 0, 0)
+	if total != 2 || len(threads) != 2 {
+		t.Fatalf("got %d threads (%+v), want 2", total, threads)
+	}
+	first := threads[0]
+	if first.ThreadID != "a@test" || first.Count != 3 || first.Latest.Path != filepath.Join("inbox", "c.eml") || first.Subject != "Re: Trip plans" {
+		t.Errorf("first thread = %+v, want a@test with 3 matches, newest c.eml", first)
+	}
+	if want := "[carol@test.com alice@test.com bob@test.com]"; fmt.Sprint(first.Participants) != want {
+		t.Errorf("participants = %v, want %s", first.Participants, want)
+	}
+	if threads[1].ThreadID != "d@test" || threads[1].Count != 1 {
+		t.Errorf("second thread = %+v, want d@test alone", threads[1])
+	}
+
+	// Paging counts conversations, not messages.
+	page, total := index.GroupByThread(res.Hits, 1, 1)
+	if total != 2 || len(page) != 1 || page[0].ThreadID != "d@test" {
+		t.Errorf("page 2 = %+v (total %d), want the d@test thread", page, total)
+	}
+
+	// Thread IDs survive the Parquet round trip into multi-account search.
+	multi := index.SearchMulti([]index.AccountIndex{{ID: "acct", IndexPath: indexPath}}, "trip", 0, 0)
+	if threads, _ := index.GroupByThread(multi.Hits, 0, 0); len(threads) != 2 || threads[0].Count != 3 {
+		t.Errorf("multi-account threads = %+v, want the same 2", threads)
+	}
+}
+
+func TestGroupByThreadWithoutThreadIDs(t *testing.T) {
+	hits := []index.Hit{{}, {}}
+	hits[0].Path, hits[1].Path = "a.eml", "b.eml"
+	threads, total := index.GroupByThread(hits, 0, 0)
+	if total != 2 || threads[0].ThreadID != "a.eml" || threads[1].ThreadID != "b.eml" {
+		t.Errorf("threads = %+v, want one per hit, keyed by path", threads)
+	}
+}
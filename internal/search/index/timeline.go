@@ -0,0 +1,66 @@
+package index
+
+import (
+	"context"
+	"log"
+	"strings"
+	"time"
+)
+
+// Timeline is the number of emails matching a search per calendar month,
+// oldest first, for a mail-over-time histogram.
+type Timeline struct {
+	Query  string          `json:"query"`
+	Months []TimelineMonth `json:"months"`
+
+	// Warnings lists account indices that could not be read, as in
+	// SearchResult.
+	Warnings []string `json:"warnings,omitempty"`
+}
+
+// TimelineMonth counts the matching emails of the month starting at Month.
+type TimelineMonth struct {
+	Month time.Time `json:"month"`
+	Count int       `json:"count"`
+}
+
+// TimelineMulti counts the emails matching query (all emails when empty)
+// across the given account indices per month, with the same matching and
+// deduplication as SearchMulti. Emails without a date are left out.
+func TimelineMulti(ctx context.Context, accounts []AccountIndex, query string, fields []string) Timeline {
+	out := Timeline{Query: query, Months: []TimelineMonth{}}
+	db, warnings, err := openMultiDB(ctx, accounts)
+	if err != nil {
+		log.Printf("ERROR: TimelineMulti: %v", err)
+		return out
+	}
+	out.Warnings = warnings
+	if db == nil {
+		return out
+	}
+	defer db.Close()
+
+	where, args := "date IS NOT NULL", []any(nil)
+	if q := strings.ToLower(strings.TrimSpace(query)); q != "" {
+		clause, clauseArgs := matchClause(ctx, q, fields)
+		where += " AND " + clause
+		args = clauseArgs
+	}
+	rows, err := db.QueryContext(ctx, `SELECT date_trunc('month', date) AS month, COUNT(*)
+		FROM emails WHERE `+where+`
+		GROUP BY month ORDER BY month`, args...)
+	if err != nil {
+		log.Printf("WARN: timeline: %v", err)
+		return out
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var m TimelineMonth
+		if err := rows.Scan(&m.Month, &m.Count); err != nil {
+			log.Printf("WARN: timeline: %v", err)
+			continue
+		}
+		out.Months = append(out.Months, m)
+	}
+	return out
+}
@@ -0,0 +1,47 @@
+package vector
+
+import (
+	"context"
+	"fmt"
+	"math"
+)
+
+// Comparison is the outcome of embedding two texts with the same model.
+type Comparison struct {
+	Model      string  `json:"model"`
+	Dimension  int     `json:"dimension"`
+	Similarity float64 `json:"similarity"` // cosine similarity, -1 to 1
+}
+
+// Compare embeds a and b and returns their cosine similarity, for checking
+// that a model ranks related texts ("invoice", "bill") above unrelated
+// ones ("invoice", "vacation").
+func Compare(ctx context.Context, e Embedder, model, a, b string) (Comparison, error) {
+	vecs, err := e.Embed(ctx, []string{a, b})
+	if err != nil {
+		return Comparison{}, err
+	}
+	if len(vecs) != 2 || len(vecs[0]) == 0 {
+		return Comparison{}, fmt.Errorf("embed model %q returned %d vectors, want 2", model, len(vecs))
+	}
+	if len(vecs[0]) != len(vecs[1]) {
+		return Comparison{}, fmt.Errorf("embed model %q returned vectors of %d and %d dimensions", model, len(vecs[0]), len(vecs[1]))
+	}
+	return Comparison{Model: model, Dimension: len(vecs[0]), Similarity: CosineSimilarity(vecs[0], vecs[1])}, nil
+}
+
+// CosineSimilarity returns the cosine of the angle between a and b, or 0
+// when either is a zero vector. Both must have the same length.
+func CosineSimilarity(a, b []float32) float64 {
+	var dot, na, nb float64
+	for i := range a {
+		x, y := float64(a[i]), float64(b[i])
+		dot += x * y
+		na += x * x
+		nb += y * y
+	}
+	if na == 0 || nb == 0 {
+		return 0
+	}
+	return dot / (math.Sqrt(na) * math.Sqrt(nb))
+}
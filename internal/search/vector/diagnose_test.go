@@ -0,0 +1,59 @@
+package vector
+
+import (
+	"context"
+	"encoding/json"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestCosineSimilarity(t *testing.T) {
+	tests := []struct {
+		a, b []float32
+		want float64
+	}{
+		{[]float32{1, 0}, []float32{2, 0}, 1},
+		{[]float32{1, 0}, []float32{0, 3}, 0},
+		{[]float32{1, 1}, []float32{-1, -1}, -1},
+		{[]float32{0, 0}, []float32{1, 1}, 0},
+	}
+	for _, tt := range tests {
+		if got := CosineSimilarity(tt.a, tt.b); math.Abs(got-tt.want) > 1e-9 {
+			t.Errorf("CosineSimilarity(%v, %v) = %v, want %v", tt.a, tt.b, got, tt.want)
+		}
+	}
+}
+
+func TestCompare(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req struct {
+			Input []string `json:"input"`
+		}
+		json.NewDecoder(r.Body).Decode(&req)
+		vecs := map[string][]float64{"invoice": {1, 0, 0}, "bill": {0.9, 0.1, 0}, "vacation": {0, 0, 1}}
+		var out ollamaEmbedResp
+		for _, s := range req.Input {
+			out.Embeddings = append(out.Embeddings, vecs[s])
+		}
+		json.NewEncoder(w).Encode(out)
+	}))
+	defer srv.Close()
+	e := NewOllamaEmbedder(srv.URL, "test-model")
+
+	related, err := Compare(context.Background(), e, "test-model", "invoice", "bill")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if related.Model != "test-model" || related.Dimension != 3 {
+		t.Errorf("Compare = %+v", related)
+	}
+	unrelated, err := Compare(context.Background(), e, "test-model", "invoice", "vacation")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if related.Similarity < 0.9 || unrelated.Similarity != 0 {
+		t.Errorf("similarity related = %v, unrelated = %v", related.Similarity, unrelated.Similarity)
+	}
+}
@@ -4,26 +4,121 @@ import (
 	"bytes"
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"net/http"
+	"os"
+	"strconv"
 	"strings"
+	"sync"
 	"time"
 )
 
 const maxTextLen = 2000
 const batchSize = 8
 
+// ErrModelNotFound is returned when Ollama does not have the embedding model.
+var ErrModelNotFound = errors.New("embedding model not found")
+
 // Embedder generates vector embeddings from text.
 type Embedder interface {
 	Embed(ctx context.Context, texts []string) ([][]float32, error)
 }
 
+// Limits bounds the load put on the embedding backend. Zero values mean no limit.
+type Limits struct {
+	RPS         float64 // embed requests per second (EMBED_RPS)
+	MaxInFlight int     // concurrent embed requests (EMBED_MAX_INFLIGHT)
+	ChunkSize   int     // emails embedded and upserted per step (EMBED_CHUNK, default 500)
+}
+
+const defaultChunkSize = 500
+
+// LimitsFromEnv reads EMBED_RPS, EMBED_MAX_INFLIGHT and EMBED_CHUNK.
+// Unset or invalid values keep the unlimited defaults.
+func LimitsFromEnv() Limits {
+	l := Limits{ChunkSize: defaultChunkSize}
+	if v, err := strconv.ParseFloat(os.Getenv("EMBED_RPS"), 64); err == nil && v > 0 {
+		l.RPS = v
+	}
+	if v, err := strconv.Atoi(os.Getenv("EMBED_MAX_INFLIGHT")); err == nil && v > 0 {
+		l.MaxInFlight = v
+	}
+	if v, err := strconv.Atoi(os.Getenv("EMBED_CHUNK")); err == nil && v > 0 {
+		l.ChunkSize = v
+	}
+	return l
+}
+
+// throttle spaces requests to at most rps per second and caps concurrency.
+type throttle struct {
+	interval time.Duration
+	sem      chan struct{}
+
+	mu   sync.Mutex
+	next time.Time
+}
+
+func newThrottle(l Limits) *throttle {
+	if l.RPS <= 0 && l.MaxInFlight <= 0 {
+		return nil
+	}
+	t := &throttle{}
+	if l.RPS > 0 {
+		t.interval = time.Duration(float64(time.Second) / l.RPS)
+	}
+	if l.MaxInFlight > 0 {
+		t.sem = make(chan struct{}, l.MaxInFlight)
+	}
+	return t
+}
+
+// acquire blocks until a request may start. The returned func releases the slot.
+func (t *throttle) acquire(ctx context.Context) (func(), error) {
+	if t.sem != nil {
+		select {
+		case t.sem <- struct{}{}:
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+	release := func() {
+		if t.sem != nil {
+			<-t.sem
+		}
+	}
+
+	if t.interval > 0 {
+		t.mu.Lock()
+		now := time.Now()
+		start := t.next
+		if start.Before(now) {
+			start = now
+		}
+		t.next = start.Add(t.interval)
+		t.mu.Unlock()
+
+		if wait := time.Until(start); wait > 0 {
+			timer := time.NewTimer(wait)
+			defer timer.Stop()
+			select {
+			case <-timer.C:
+			case <-ctx.Done():
+				release()
+				return nil, ctx.Err()
+			}
+		}
+	}
+	return release, nil
+}
+
 // OllamaEmbedder calls Ollama's /api/embed endpoint.
 type OllamaEmbedder struct {
-	baseURL string
-	model   string
-	client  *http.Client
+	baseURL  string
+	model    string
+	client   *http.Client
+	throttle *throttle
 }
 
 // NewOllamaEmbedder creates an embedder for the given Ollama server.
@@ -35,6 +130,11 @@ func NewOllamaEmbedder(baseURL, model string) *OllamaEmbedder {
 	}
 }
 
+// SetLimits applies request-rate and concurrency limits to every /api/embed call.
+func (e *OllamaEmbedder) SetLimits(l Limits) {
+	e.throttle = newThrottle(l)
+}
+
 type ollamaEmbedReq struct {
 	Model string      `json:"model"`
 	Input interface{} `json:"input"`
@@ -75,6 +175,14 @@ func (e *OllamaEmbedder) Embed(ctx context.Context, texts []string) ([][]float32
 }
 
 func (e *OllamaEmbedder) embedBatch(ctx context.Context, texts []string) ([][]float32, error) {
+	if e.throttle != nil {
+		release, err := e.throttle.acquire(ctx)
+		if err != nil {
+			return nil, err
+		}
+		defer release()
+	}
+
 	body, err := json.Marshal(ollamaEmbedReq{Model: e.model, Input: texts})
 	if err != nil {
 		return nil, err
@@ -94,6 +202,9 @@ func (e *OllamaEmbedder) embedBatch(ctx context.Context, texts []string) ([][]fl
 
 	if resp.StatusCode != http.StatusOK {
 		b, _ := io.ReadAll(resp.Body)
+		if isModelNotFound(resp.StatusCode, b) {
+			return nil, fmt.Errorf("%w: run `ollama pull %s`", ErrModelNotFound, e.model)
+		}
 		return nil, fmt.Errorf("ollama embed %s: %s", resp.Status, string(b))
 	}
 
@@ -111,3 +222,52 @@ func (e *OllamaEmbedder) embedBatch(ctx context.Context, texts []string) ([][]fl
 	}
 	return vecs, nil
 }
+
+// isModelNotFound reports whether an Ollama error response means the model
+// has not been pulled, e.g. 404 {"error":"model \"x\" not found, try pulling it first"}.
+func isModelNotFound(status int, body []byte) bool {
+	var e struct {
+		Error string `json:"error"`
+	}
+	_ = json.Unmarshal(body, &e)
+	msg := strings.ToLower(e.Error)
+	if msg == "" {
+		msg = strings.ToLower(string(body))
+	}
+	return strings.Contains(msg, "not found") && (status == http.StatusNotFound || strings.Contains(msg, "model"))
+}
+
+// Pull asks Ollama to download the model and waits until it finishes.
+func (e *OllamaEmbedder) Pull(ctx context.Context) error {
+	body, err := json.Marshal(map[string]any{"model": e.model, "stream": false})
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, "POST", e.baseURL+"/api/pull", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	// Pulls can take minutes; rely on ctx rather than the embed client timeout.
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		b, _ := io.ReadAll(resp.Body)
+		return fmt.Errorf("ollama pull %s: %s", resp.Status, strings.TrimSpace(string(b)))
+	}
+	var out struct {
+		Status string `json:"status"`
+		Error  string `json:"error"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&out); err != nil {
+		return fmt.Errorf("ollama pull: %w", err)
+	}
+	if out.Error != "" {
+		return fmt.Errorf("ollama pull: %s", out.Error)
+	}
+	return nil
+}
@@ -0,0 +1,70 @@
+package vector
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// fakeOllama serves /api/embed, reporting the model as missing until /api/pull is called.
+func fakeOllama(t *testing.T) (*httptest.Server, *atomic.Int32) {
+	t.Helper()
+	var pulled atomic.Bool
+	var pulls atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/api/embed":
+			if !pulled.Load() {
+				w.WriteHeader(http.StatusNotFound)
+				w.Write([]byte(`{"error":"model \"all-minilm\" not found, try pulling it first"}`))
+				return
+			}
+			json.NewEncoder(w).Encode(ollamaEmbedResp{Embeddings: [][]float64{{0.1, 0.2, 0.3}}})
+		case "/api/pull":
+			pulls.Add(1)
+			pulled.Store(true)
+			w.Write([]byte(`{"status":"success"}`))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	t.Cleanup(srv.Close)
+	return srv, &pulls
+}
+
+func TestProbeDimensionModelNotFound(t *testing.T) {
+	srv, pulls := fakeOllama(t)
+	e := NewOllamaEmbedder(srv.URL, "all-minilm")
+
+	_, err := probeDimension(e, "all-minilm", ProbeOptions{Timeout: 5 * time.Second})
+	if !errors.Is(err, ErrModelNotFound) {
+		t.Fatalf("err = %v, want ErrModelNotFound", err)
+	}
+	if !strings.Contains(err.Error(), "ollama pull all-minilm") {
+		t.Errorf("error %q does not suggest ollama pull", err)
+	}
+	if pulls.Load() != 0 {
+		t.Errorf("pulled without AutoPull")
+	}
+}
+
+func TestProbeDimensionAutoPull(t *testing.T) {
+	srv, pulls := fakeOllama(t)
+	e := NewOllamaEmbedder(srv.URL, "all-minilm")
+
+	dim, err := probeDimension(e, "all-minilm", ProbeOptions{Timeout: 5 * time.Second, AutoPull: true})
+	if err != nil {
+		t.Fatalf("probeDimension: %v", err)
+	}
+	if dim != 3 {
+		t.Errorf("dim = %d, want 3", dim)
+	}
+	if pulls.Load() != 1 {
+		t.Errorf("pulls = %d, want 1", pulls.Load())
+	}
+}
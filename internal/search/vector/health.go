@@ -0,0 +1,97 @@
+package vector
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+)
+
+// Health reports whether the similarity search backends answer.
+type Health struct {
+	QdrantReachable bool `json:"qdrant_reachable"`
+	OllamaReachable bool `json:"ollama_reachable"`
+	// ModelAvailable is set when Ollama has the embedding model pulled.
+	ModelAvailable bool     `json:"model_available"`
+	Problems       []string `json:"problems,omitempty"`
+}
+
+// CheckHealth asks Qdrant (REST, with QDRANT_API_KEY and QDRANT_TLS as
+// NewStore uses them) and Ollama whether they are up, and Ollama whether
+// embedModel is pulled. Nothing is embedded or created; ctx bounds both
+// requests, which run in parallel.
+func CheckHealth(ctx context.Context, qdrantAddr, ollamaURL, embedModel string) Health {
+	var h Health
+	var mu sync.Mutex
+	problem := func(format string, args ...any) {
+		mu.Lock()
+		h.Problems = append(h.Problems, fmt.Sprintf(format, args...))
+		mu.Unlock()
+	}
+
+	var wg sync.WaitGroup
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		host, _, err := parseHostPort(qdrantAddr)
+		if err != nil {
+			problem("qdrant: %v", err)
+			return
+		}
+		conn := connOptionsFor(qdrantAddr)
+		if err := getOK(ctx, restBase(host, conn.TLS)+"/collections", conn.APIKey, nil); err != nil {
+			problem("qdrant: %v", err)
+			return
+		}
+		h.QdrantReachable = true
+	}()
+	go func() {
+		defer wg.Done()
+		var tags struct {
+			Models []struct {
+				Name string `json:"name"`
+			} `json:"models"`
+		}
+		if err := getOK(ctx, strings.TrimSuffix(ollamaURL, "/")+"/api/tags", "", &tags); err != nil {
+			problem("ollama: %v", err)
+			return
+		}
+		h.OllamaReachable = true
+		for _, m := range tags.Models {
+			if m.Name == embedModel || m.Name == embedModel+":latest" {
+				h.ModelAvailable = true
+			}
+		}
+		if !h.ModelAvailable {
+			problem("ollama: model %q is not pulled; run `ollama pull %s` or set EMBED_AUTO_PULL=true", embedModel, embedModel)
+		}
+	}()
+	wg.Wait()
+	return h
+}
+
+// getOK GETs url and decodes the JSON response into out when it is not
+// nil. Any status but 200 is an error.
+func getOK(ctx context.Context, url, apiKey string, out any) error {
+	req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
+	if err != nil {
+		return err
+	}
+	if apiKey != "" {
+		req.Header.Set("api-key", apiKey)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("GET %s: %s", url, resp.Status)
+	}
+	if out == nil {
+		return nil
+	}
+	return json.NewDecoder(resp.Body).Decode(out)
+}
@@ -0,0 +1,37 @@
+package vector
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestCheckHealthOllamaModel(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/api/tags" {
+			http.NotFound(w, r)
+			return
+		}
+		w.Write([]byte(`{"models":[{"name":"all-minilm:latest"},{"name":"llama3:8b"}]}`))
+	}))
+	defer srv.Close()
+	// Nothing listens on the Qdrant address.
+	qdrant := "127.0.0.1:1"
+
+	h := CheckHealth(context.Background(), qdrant, srv.URL+"/", "all-minilm")
+	if !h.OllamaReachable || !h.ModelAvailable {
+		t.Errorf("health = %+v, want Ollama up with all-minilm", h)
+	}
+
+	h = CheckHealth(context.Background(), qdrant, srv.URL, "nomic-embed-text")
+	if !h.OllamaReachable || h.ModelAvailable || !strings.Contains(strings.Join(h.Problems, "\n"), "nomic-embed-text") {
+		t.Errorf("health = %+v, want the missing model reported", h)
+	}
+
+	h = CheckHealth(context.Background(), qdrant, "http://127.0.0.1:1", "all-minilm")
+	if h.OllamaReachable || len(h.Problems) == 0 {
+		t.Errorf("health = %+v, want Ollama unreachable", h)
+	}
+}
@@ -0,0 +1,185 @@
+package vector
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/eslider/mails/internal/search/eml"
+)
+
+// IndexOptions controls IndexEmails.
+type IndexOptions struct {
+	// Rebuild wipes the collection and any saved cursor before indexing.
+	// Otherwise points are upserted into the existing collection.
+	Rebuild bool
+
+	// CursorPath, when set, names a file recording the last path of the
+	// last upserted chunk. A run interrupted by an error resumes after it;
+	// the file is removed once every email is indexed.
+	CursorPath string
+
+	// Retries is how often a failed chunk is retried, with backoff, before
+	// IndexEmails gives up (default 3; negative disables retries).
+	Retries int
+}
+
+const defaultChunkRetries = 3
+
+// retryBackoff is the wait before the first retry; it doubles each attempt.
+var retryBackoff = 2 * time.Second
+
+// indexCursor is the CursorPath file content.
+type indexCursor struct {
+	LastPath string `json:"last_path"`
+	Indexed  int    `json:"indexed"`
+	Total    int    `json:"total"`
+}
+
+func loadCursor(path string) (indexCursor, bool) {
+	var c indexCursor
+	if path == "" {
+		return c, false
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return c, false
+	}
+	if err := json.Unmarshal(data, &c); err != nil || c.LastPath == "" {
+		log.Printf("WARN: ignoring vector index cursor %s: %v", path, err)
+		return indexCursor{}, false
+	}
+	return c, true
+}
+
+func saveCursor(path string, c indexCursor) error {
+	if path == "" {
+		return nil
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return err
+	}
+	data, err := json.Marshal(c)
+	if err != nil {
+		return err
+	}
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+// indexChunks upserts the emails of stream, chunkSize at a time, skipping
+// those at or before the saved cursor in walk order (see walkOrderBefore)
+// and advancing it after each chunk. Only chunkSize emails are held here;
+// the cursor is removed once stream ends without error.
+func indexChunks(ctx context.Context, stream *emailStream, chunkSize int, opts IndexOptions, upsert func(context.Context, []eml.Email) error, progress IndexProgressFunc) (int, error) {
+	if chunkSize <= 0 {
+		chunkSize = defaultChunkSize
+	}
+	retries := opts.Retries
+	if retries == 0 {
+		retries = defaultChunkRetries
+	}
+
+	c, resuming := loadCursor(opts.CursorPath)
+	if resuming {
+		log.Printf("Resuming vector index after %s (%d emails already indexed)", c.LastPath, c.Indexed)
+	}
+
+	began := time.Now()
+	indexed, skipped := 0, 0
+	reported := false
+	chunk := make([]eml.Email, 0, chunkSize)
+	// One email of lookahead tells whether a chunk is the last, so its
+	// progress call can carry the then-known total.
+	e, ok := <-stream.C
+	for ok {
+		if resuming && !walkOrderBefore(c.LastPath, e.Path) {
+			indexed++
+			skipped++
+			e, ok = <-stream.C
+			continue
+		}
+		chunk = append(chunk, e)
+		e, ok = <-stream.C
+		if ok && len(chunk) < chunkSize {
+			continue
+		}
+		if err := upsertWithRetry(ctx, chunk, retries, upsert); err != nil {
+			return indexed, err
+		}
+		indexed += len(chunk)
+		total := 0
+		if !ok && stream.err == nil {
+			total = indexed
+		}
+		if err := saveCursor(opts.CursorPath, indexCursor{LastPath: chunk[len(chunk)-1].Path, Indexed: indexed, Total: total}); err != nil {
+			log.Printf("WARN: save vector index cursor: %v", err)
+		}
+		if progress != nil {
+			progress(indexed, total)
+			reported = true
+		}
+		rate := float64(indexed-skipped) / time.Since(began).Seconds()
+		log.Printf("Indexed %d emails into Qdrant (%.1f/sec)", indexed, rate)
+		chunk = chunk[:0]
+	}
+	if stream.err != nil {
+		return indexed, stream.err
+	}
+	// Everything was indexed by the earlier run.
+	if progress != nil && !reported && indexed > 0 {
+		progress(indexed, indexed)
+	}
+	if opts.CursorPath != "" {
+		if err := os.Remove(opts.CursorPath); err != nil && !os.IsNotExist(err) {
+			log.Printf("WARN: remove vector index cursor: %v", err)
+		}
+	}
+	return indexed, nil
+}
+
+// walkOrderBefore reports whether path a comes before b in the order
+// filepath.WalkDir visits files: component by component, each compared
+// lexically. Plain string order differs once names contain characters
+// below "/", e.g. "a-b/x" and "a/y".
+func walkOrderBefore(a, b string) bool {
+	as := strings.Split(filepath.ToSlash(a), "/")
+	bs := strings.Split(filepath.ToSlash(b), "/")
+	for i := 0; i < len(as) && i < len(bs); i++ {
+		if as[i] != bs[i] {
+			return as[i] < bs[i]
+		}
+	}
+	return len(as) < len(bs)
+}
+
+// upsertWithRetry retries a failed chunk with exponential backoff. A
+// missing model or a cancelled context is not retried.
+func upsertWithRetry(ctx context.Context, chunk []eml.Email, retries int, upsert func(context.Context, []eml.Email) error) error {
+	wait := retryBackoff
+	for attempt := 0; ; attempt++ {
+		err := upsert(ctx, chunk)
+		if err == nil {
+			return nil
+		}
+		if attempt >= retries || errors.Is(err, ErrModelNotFound) || ctx.Err() != nil {
+			return fmt.Errorf("chunk ending at %s: %w", chunk[len(chunk)-1].Path, err)
+		}
+		log.Printf("WARN: vector index chunk failed (attempt %d/%d), retrying in %s: %v", attempt+1, retries+1, wait, err)
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(wait):
+		}
+		wait *= 2
+	}
+}
@@ -0,0 +1,140 @@
+package vector
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/eslider/mails/internal/search/eml"
+)
+
+func testEmails(n int) *emailStream {
+	emails := make([]eml.Email, n)
+	for i := range emails {
+		// Reverse order: SliceSource must sort into walk order.
+		emails[i] = eml.Email{Path: fmt.Sprintf("inbox/%02d.eml", n-1-i)}
+	}
+	return startStream(context.Background(), SliceSource(emails), "", 2)
+}
+
+func TestIndexChunksResumesFromCursor(t *testing.T) {
+	cursor := filepath.Join(t.TempDir(), "vector.cursor")
+	opts := IndexOptions{CursorPath: cursor, Retries: -1}
+
+	var upserted []string
+	failAt := "inbox/04.eml"
+	upsert := func(_ context.Context, chunk []eml.Email) error {
+		for _, e := range chunk {
+			if e.Path == failAt {
+				return errors.New("embedder unavailable")
+			}
+		}
+		for _, e := range chunk {
+			upserted = append(upserted, e.Path)
+		}
+		return nil
+	}
+
+	n, err := indexChunks(context.Background(), testEmails(10), 2, opts, upsert, nil)
+	if err == nil || n != 4 {
+		t.Fatalf("first run = %d, %v; want 4 and an error", n, err)
+	}
+	if c, ok := loadCursor(cursor); !ok || c.LastPath != "inbox/03.eml" || c.Indexed != 4 {
+		t.Fatalf("cursor = %+v, %v", c, ok)
+	}
+
+	failAt = ""
+	upserted = nil
+	var progress []string
+	n, err = indexChunks(context.Background(), testEmails(10), 2, opts, upsert, func(indexed, total int) {
+		progress = append(progress, fmt.Sprintf("%d/%d", indexed, total))
+	})
+	if err != nil || n != 10 {
+		t.Fatalf("resumed run = %d, %v; want 10", n, err)
+	}
+	if len(upserted) != 6 || upserted[0] != "inbox/04.eml" {
+		t.Errorf("resumed run upserted %v, want 04..09", upserted)
+	}
+	if want := []string{"6/0", "8/0", "10/10"}; fmt.Sprint(progress) != fmt.Sprint(want) {
+		t.Errorf("progress = %v, want %v", progress, want)
+	}
+	if _, err := os.Stat(cursor); !os.IsNotExist(err) {
+		t.Error("cursor should be removed after a complete run")
+	}
+}
+
+func TestIndexChunksRetriesTransientFailures(t *testing.T) {
+	defer func(d time.Duration) { retryBackoff = d }(retryBackoff)
+	retryBackoff = time.Millisecond
+
+	calls := 0
+	flaky := func(_ context.Context, chunk []eml.Email) error {
+		calls++
+		if calls <= 2 {
+			return errors.New("connection reset")
+		}
+		return nil
+	}
+	n, err := indexChunks(context.Background(), testEmails(3), 10, IndexOptions{}, flaky, nil)
+	if err != nil || n != 3 || calls != 3 {
+		t.Errorf("got %d, %v after %d calls; want 3 indexed after 3 calls", n, err, calls)
+	}
+
+	calls = 0
+	missing := func(_ context.Context, chunk []eml.Email) error {
+		calls++
+		return ErrModelNotFound
+	}
+	if _, err := indexChunks(context.Background(), testEmails(3), 10, IndexOptions{}, missing, nil); !errors.Is(err, ErrModelNotFound) || calls != 1 {
+		t.Errorf("missing model: err = %v after %d calls; want no retry", err, calls)
+	}
+}
+
+func TestIndexChunksKeepsCursorOnWalkError(t *testing.T) {
+	cursor := filepath.Join(t.TempDir(), "vector.cursor")
+	walkErr := errors.New("disk gone")
+	source := func(_ string, yield func(eml.Email) error) (int, error) {
+		for i := range 3 {
+			if err := yield(eml.Email{Path: fmt.Sprintf("inbox/%02d.eml", i)}); err != nil {
+				return 0, err
+			}
+		}
+		return 0, walkErr
+	}
+	upsert := func(context.Context, []eml.Email) error { return nil }
+	var progress []string
+	n, err := indexChunks(context.Background(), startStream(context.Background(), source, "", 2), 2, IndexOptions{CursorPath: cursor}, upsert, func(indexed, total int) {
+		progress = append(progress, fmt.Sprintf("%d/%d", indexed, total))
+	})
+	if !errors.Is(err, walkErr) || n != 3 {
+		t.Fatalf("got %d, %v; want 3 and the walk error", n, err)
+	}
+	if want := []string{"2/0", "3/0"}; fmt.Sprint(progress) != fmt.Sprint(want) {
+		t.Errorf("progress = %v, want %v (no total after a failed walk)", progress, want)
+	}
+	if c, ok := loadCursor(cursor); !ok || c.LastPath != "inbox/02.eml" {
+		t.Errorf("cursor = %+v, %v; want it kept at inbox/02.eml", c, ok)
+	}
+}
+
+func TestWalkOrderBefore(t *testing.T) {
+	// WalkDir visits "a" (and all below it) before "a-b", though "a-b/x" < "a/y" as strings.
+	for _, tc := range []struct {
+		a, b string
+		want bool
+	}{
+		{"a/y.eml", "a-b/x.eml", true},
+		{"a-b/x.eml", "a/y.eml", false},
+		{"inbox/01.eml", "inbox/02.eml", true},
+		{"inbox/02.eml", "inbox/02.eml", false},
+		{"inbox/z.eml", "inbox/sub/a.eml", false},
+	} {
+		if got := walkOrderBefore(tc.a, tc.b); got != tc.want {
+			t.Errorf("walkOrderBefore(%q, %q) = %v, want %v", tc.a, tc.b, got, tc.want)
+		}
+	}
+}
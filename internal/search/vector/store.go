@@ -3,17 +3,25 @@ package vector
 
 import (
 	"context"
+	"crypto/sha256"
+	"encoding/hex"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"hash/fnv"
 	"log"
 	"net"
 	"net/http"
 	"net/url"
+	"os"
+	"path/filepath"
+	"slices"
 	"strconv"
 	"strings"
 	"time"
 
+	"github.com/eslider/mails/internal/checksum"
+	"github.com/eslider/mails/internal/model"
 	"github.com/eslider/mails/internal/search/eml"
 	"github.com/qdrant/go-client/qdrant"
 )
@@ -21,46 +29,162 @@ import (
 const collectionName = "mail_emails"
 const vectorDistance = qdrant.Distance_Cosine
 
+// snippetLen caps the body preview stored in each point's payload (in runes).
+const snippetLen = 300
+
 // Store manages the Qdrant vector index for email similarity search.
 type Store struct {
 	client     *qdrant.Client
 	embedder   Embedder
 	vectorSize int
 	restHost   string
+	apiKey     string
+	chunkSize  int
+	scope      Scope
+}
+
+// Scope confines a Store to the points of one user's account. Scoped
+// points are keyed on the user and account as well as the message (see
+// Scope.pointID) and carry both in their payload, which Search filters
+// on, so users and accounts holding the same message, or files at the
+// same relative path, never share or overwrite a point. The zero Scope
+// is the unscoped collection of a single archive.
+type Scope struct {
+	UserID    string
+	AccountID string
+}
+
+// In returns a Store on s's connections confined to scope. Close s, not
+// the returned Store.
+func (s *Store) In(scope Scope) *Store {
+	scoped := *s
+	scoped.scope = scope
+	return &scoped
+}
+
+// ConnOptions configures the connection to Qdrant. The zero value is a
+// plaintext connection without authentication, as to a local container.
+type ConnOptions struct {
+	APIKey string // sent with every request (QDRANT_API_KEY)
+	TLS    bool   // gRPC and REST over TLS (QDRANT_TLS, or an https:// QDRANT_URL)
+}
+
+// ConnOptionsFromEnv reads QDRANT_API_KEY and QDRANT_TLS.
+func ConnOptionsFromEnv() ConnOptions {
+	o := ConnOptions{APIKey: strings.TrimSpace(os.Getenv("QDRANT_API_KEY"))}
+	o.TLS, _ = strconv.ParseBool(os.Getenv("QDRANT_TLS"))
+	return o
+}
+
+// connOptionsFor is ConnOptionsFromEnv with TLS also implied by an
+// https:// qdrantAddr.
+func connOptionsFor(qdrantAddr string) ConnOptions {
+	conn := ConnOptionsFromEnv()
+	if strings.HasPrefix(strings.ToLower(strings.TrimSpace(qdrantAddr)), "https://") {
+		conn.TLS = true
+	}
+	return conn
 }
 
-// NewStore creates a Qdrant store.
+// NewStore creates a Qdrant store. Embedding load limits and the Qdrant
+// API key and TLS setting are read from the environment (see LimitsFromEnv
+// and ConnOptionsFromEnv).
 func NewStore(qdrantAddr, ollamaURL, embedModel string) (*Store, error) {
 	host, port, err := parseHostPort(qdrantAddr)
 	if err != nil {
 		return nil, err
 	}
+	conn := connOptionsFor(qdrantAddr)
 
 	client, err := qdrant.NewClient(&qdrant.Config{
-		Host: host,
-		Port: int(port),
+		Host:   host,
+		Port:   int(port),
+		APIKey: conn.APIKey,
+		UseTLS: conn.TLS,
 	})
 	if err != nil {
 		return nil, err
 	}
 
+	limits := LimitsFromEnv()
 	embedder := NewOllamaEmbedder(ollamaURL, embedModel)
-	ctx, cancel := context.WithTimeout(context.Background(), 15*time.Second)
-	defer cancel()
-	vecs, err := embedder.Embed(ctx, []string{"x"})
+	embedder.SetLimits(limits)
+	dim, err := probeDimension(embedder, embedModel, ProbeOptionsFromEnv())
 	if err != nil {
 		client.Close()
-		return nil, fmt.Errorf("embed model %q: %w", embedModel, err)
-	}
-	if len(vecs) == 0 || len(vecs[0]) == 0 {
-		client.Close()
-		return nil, fmt.Errorf("embed model %q returned empty vector", embedModel)
+		return nil, err
 	}
-	dim := len(vecs[0])
 	log.Printf("Embedding model %q: %d dimensions", embedModel, dim)
+	if limits.RPS > 0 || limits.MaxInFlight > 0 {
+		log.Printf("Embedding limits: %.1f req/s, %d in flight, chunk %d", limits.RPS, limits.MaxInFlight, limits.ChunkSize)
+	}
+
+	return &Store{client: client, embedder: embedder, vectorSize: dim, restHost: restBase(host, conn.TLS), apiKey: conn.APIKey, chunkSize: limits.ChunkSize}, nil
+}
 
-	restBase := "http://" + net.JoinHostPort(host, "6333")
-	return &Store{client: client, embedder: embedder, vectorSize: dim, restHost: restBase}, nil
+// restBase is the URL of Qdrant's REST API on host, which listens on 6333
+// next to gRPC on 6334.
+func restBase(host string, useTLS bool) string {
+	scheme := "http"
+	if useTLS {
+		scheme = "https"
+	}
+	return scheme + "://" + net.JoinHostPort(host, "6333")
+}
+
+// ProbeOptions controls the startup embed call that resolves the vector size.
+type ProbeOptions struct {
+	Timeout  time.Duration // per attempt (EMBED_PROBE_TIMEOUT, default 15s)
+	AutoPull bool          // pull a missing model and retry (EMBED_AUTO_PULL)
+}
+
+const (
+	defaultProbeTimeout = 15 * time.Second
+	pullTimeout         = 30 * time.Minute
+)
+
+// ProbeOptionsFromEnv reads EMBED_PROBE_TIMEOUT and EMBED_AUTO_PULL.
+func ProbeOptionsFromEnv() ProbeOptions {
+	o := ProbeOptions{Timeout: defaultProbeTimeout}
+	if d, err := time.ParseDuration(os.Getenv("EMBED_PROBE_TIMEOUT")); err == nil && d > 0 {
+		o.Timeout = d
+	}
+	o.AutoPull, _ = strconv.ParseBool(os.Getenv("EMBED_AUTO_PULL"))
+	return o
+}
+
+// probeDimension embeds a short string to learn the model's vector size.
+// A missing model is pulled first when opts.AutoPull is set.
+func probeDimension(e *OllamaEmbedder, model string, opts ProbeOptions) (int, error) {
+	embed := func() ([][]float32, error) {
+		ctx, cancel := context.WithTimeout(context.Background(), opts.Timeout)
+		defer cancel()
+		vecs, err := e.Embed(ctx, []string{"x"})
+		if errors.Is(err, context.DeadlineExceeded) {
+			return nil, fmt.Errorf("no response within %s (model may still be loading; raise EMBED_PROBE_TIMEOUT): %w", opts.Timeout, err)
+		}
+		return vecs, err
+	}
+
+	vecs, err := embed()
+	if errors.Is(err, ErrModelNotFound) && opts.AutoPull {
+		log.Printf("Embedding model %q not found, pulling...", model)
+		ctx, cancel := context.WithTimeout(context.Background(), pullTimeout)
+		perr := e.Pull(ctx)
+		cancel()
+		if perr != nil {
+			return 0, fmt.Errorf("embed model %q: pull: %w", model, perr)
+		}
+		log.Printf("Pulled embedding model %q", model)
+		vecs, err = embed()
+	}
+	if err != nil {
+		return 0, fmt.Errorf("embed model %q: %w", model, err)
+	}
+	if len(vecs) == 0 || len(vecs[0]) == 0 {
+		return 0, fmt.Errorf("embed model %q returned empty vector", model)
+	}
+	return len(vecs[0]), nil
 }
 
 func parseHostPort(addr string) (string, int64, error) {
@@ -105,6 +229,9 @@ func (s *Store) collectionVectorSize(ctx context.Context) (int, error) {
 	if err != nil {
 		return 0, err
 	}
+	if s.apiKey != "" {
+		req.Header.Set("api-key", s.apiKey)
+	}
 	resp, err := http.DefaultClient.Do(req)
 	if err != nil {
 		return 0, err
@@ -135,25 +262,32 @@ func (s *Store) collectionVectorSize(ctx context.Context) (int, error) {
 
 // EnsureCollection creates or recreates the collection if needed.
 func (s *Store) EnsureCollection(ctx context.Context) error {
+	_, err := s.ensureCollection(ctx)
+	return err
+}
+
+// ensureCollection is EnsureCollection, also reporting whether the
+// collection was (re)created empty.
+func (s *Store) ensureCollection(ctx context.Context) (bool, error) {
 	exists, err := s.client.CollectionExists(ctx, collectionName)
 	if err != nil {
-		return err
+		return false, err
 	}
 	if exists {
 		currentDim, err := s.collectionVectorSize(ctx)
 		if err != nil {
-			return err
+			return false, err
 		}
 		if currentDim != s.vectorSize {
 			log.Printf("Qdrant collection has %d dims, model has %d — recreating", currentDim, s.vectorSize)
 			if err := s.client.DeleteCollection(ctx, collectionName); err != nil {
-				return err
+				return false, err
 			}
 		} else {
-			return nil
+			return false, nil
 		}
 	}
-	return s.client.CreateCollection(ctx, &qdrant.CreateCollection{
+	return true, s.client.CreateCollection(ctx, &qdrant.CreateCollection{
 		CollectionName: collectionName,
 		VectorsConfig: qdrant.NewVectorsConfig(&qdrant.VectorParams{
 			Size:     uint64(s.vectorSize),
@@ -178,84 +312,369 @@ func (s *Store) RecreateCollection(ctx context.Context) error {
 	})
 }
 
-// WalkEmailsFn is a function that walks an email directory and returns parsed emails.
-type WalkEmailsFn func(emailDir string) ([]eml.Email, int)
+// EmailSource walks an email directory, handing each parsed email to
+// yield in filepath.WalkDir order, and returns the number of files that
+// failed to parse. An error from yield must stop the walk and be returned.
+// index.StreamEmails is one.
+type EmailSource func(emailDir string, yield func(eml.Email) error) (int, error)
+
+// SliceSource is an EmailSource over emails already in memory, in walk
+// order whatever their order in the slice.
+func SliceSource(emails []eml.Email) EmailSource {
+	sorted := slices.Clone(emails)
+	slices.SortStableFunc(sorted, func(a, b eml.Email) int {
+		switch {
+		case walkOrderBefore(a.Path, b.Path):
+			return -1
+		case walkOrderBefore(b.Path, a.Path):
+			return 1
+		}
+		return 0
+	})
+	return func(_ string, yield func(eml.Email) error) (int, error) {
+		for _, e := range sorted {
+			if err := yield(e); err != nil {
+				return 0, err
+			}
+		}
+		return 0, nil
+	}
+}
+
+// emailStream runs an EmailSource in its own goroutine, so parsing overlaps
+// embedding. C is buffered to one chunk; err and errCount are set before C
+// is closed.
+type emailStream struct {
+	C        <-chan eml.Email
+	err      error
+	errCount int
+}
 
-// IndexProgressFunc is called during indexing with (indexed, total).
+func startStream(ctx context.Context, source EmailSource, emailDir string, buffer int) *emailStream {
+	ch := make(chan eml.Email, buffer)
+	s := &emailStream{C: ch}
+	go func() {
+		defer close(ch)
+		s.errCount, s.err = source(emailDir, func(e eml.Email) error {
+			select {
+			case ch <- e:
+				return nil
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+		})
+	}()
+	return s
+}
+
+// IndexProgressFunc is called during indexing with (indexed, total). The
+// total is 0 while the walk is still running and equals indexed on the
+// last call.
 type IndexProgressFunc func(indexed, total int)
 
-// IndexEmails parses emails from the directory and indexes them into Qdrant.
-func (s *Store) IndexEmails(ctx context.Context, emailDir string, walkFn WalkEmailsFn, progress IndexProgressFunc) (int, int, error) {
-	emails, errCount := walkFn(emailDir)
-	if len(emails) == 0 {
-		return 0, errCount, nil
+// IndexEmails upserts the emails of source into Qdrant as they are parsed,
+// EMBED_CHUNK at a time, so memory stays bounded by the chunk size rather
+// than the archive (but for the IDs of the points written, 8 bytes per
+// message). Emails already embedded from the same text are not embedded
+// again (see upsertRun). With opts.Rebuild the collection is recreated first;
+// otherwise an interrupted earlier run resumes from opts.CursorPath, and
+// the progress callback counts the emails already indexed.
+func (s *Store) IndexEmails(ctx context.Context, emailDir string, source EmailSource, opts IndexOptions, progress IndexProgressFunc) (int, int, error) {
+	fresh := opts.Rebuild
+	if opts.Rebuild {
+		if err := s.RecreateCollection(ctx); err != nil {
+			return 0, 0, err
+		}
+	} else {
+		created, err := s.ensureCollection(ctx)
+		if err != nil {
+			return 0, 0, err
+		}
+		fresh = created
+	}
+	// A new collection holds nothing a saved cursor could refer to.
+	if fresh && opts.CursorPath != "" {
+		os.Remove(opts.CursorPath)
+	}
+
+	chunkSize := s.chunkSize
+	if chunkSize <= 0 {
+		chunkSize = defaultChunkSize
 	}
+	walkCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	stream := startStream(walkCtx, source, emailDir, chunkSize)
 
-	if err := s.RecreateCollection(ctx); err != nil {
-		return 0, errCount, err
+	log.Printf("Vector indexing %s in chunks of %d...", emailDir, chunkSize)
+	indexed, err := indexChunks(ctx, stream, chunkSize, opts, s.upsertRun(make(map[uint64]bool)), progress)
+	// Stop the walk if indexing failed, and wait for it to finish.
+	cancel()
+	for range stream.C {
 	}
+	return indexed, stream.errCount, err
+}
 
-	start := time.Now()
-	log.Printf("Vector indexing %d emails...", len(emails))
-	const chunkSize = 500
-	var totalIndexed int
-	for chunkStart := 0; chunkStart < len(emails); chunkStart += chunkSize {
-		chunkEnd := chunkStart + chunkSize
-		if chunkEnd > len(emails) {
-			chunkEnd = len(emails)
+// UpsertEmail re-embeds a single email whose text changed, e.g. after it
+// was re-parsed, and replaces its point. The collection is created if
+// missing.
+func (s *Store) UpsertEmail(ctx context.Context, e eml.Email) error {
+	if err := s.EnsureCollection(ctx); err != nil {
+		return err
+	}
+	return s.upsertRun(make(map[uint64]bool))(ctx, []eml.Email{e})
+}
+
+// DeleteEmails removes the points of emails by path, e.g. after the files
+// were deleted. Paths without a point are ignored. Copies of a message
+// in the Store's scope share a point (see pointKey), so deleting one copy
+// drops the point of the others too; the next IndexEmails embeds them
+// again. Points of other scopes are never touched.
+func (s *Store) DeleteEmails(ctx context.Context, paths []string) error {
+	if len(paths) == 0 {
+		return nil
+	}
+	ids := make([]*qdrant.PointId, 0, 2*len(paths))
+	for _, p := range paths {
+		id := s.scope.pointID(p)
+		ids = append(ids, qdrant.NewIDNum(id))
+		for _, legacy := range s.scope.legacyIDs(p) {
+			if legacy != id {
+				ids = append(ids, qdrant.NewIDNum(legacy))
+			}
 		}
-		chunk := emails[chunkStart:chunkEnd]
-		texts := make([]string, len(chunk))
-		for i, e := range chunk {
-			texts[i] = textToEmbed(e)
+	}
+	wait := true
+	_, err := s.client.Delete(ctx, &qdrant.DeletePoints{
+		CollectionName: collectionName,
+		Points:         qdrant.NewPointsSelector(ids...),
+		Wait:           &wait,
+	})
+	return err
+}
+
+// upsertRun returns the upsert of one indexing run. It writes one point
+// per message, keyed on pointKey, and embeds only the emails whose point
+// is missing or was embedded from other text (its embedded_hash payload),
+// so a message moved to another folder, or stored in several, is embedded
+// once. written holds the points the run has written; later copies of
+// their messages are skipped, so the point keeps the path of the first
+// copy in walk order instead of switching between copies each run.
+func (s *Store) upsertRun(written map[uint64]bool) func(context.Context, []eml.Email) error {
+	return func(ctx context.Context, emails []eml.Email) error {
+		ids := make([]*qdrant.PointId, 0, len(emails))
+		for _, e := range emails {
+			ids = append(ids, qdrant.NewIDNum(s.scope.pointID(e.Path)))
 		}
-		vecs, err := s.embedder.Embed(ctx, texts)
+		stored, err := s.client.Get(ctx, &qdrant.GetPoints{
+			CollectionName: collectionName,
+			Ids:            ids,
+			WithPayload:    qdrant.NewWithPayloadInclude("embedded_hash", "path"),
+		})
 		if err != nil {
-			return totalIndexed, errCount, err
+			return err
 		}
-		if len(vecs) != len(chunk) {
-			return totalIndexed, errCount, fmt.Errorf("embed returned %d vectors for %d emails", len(vecs), len(chunk))
+		existing := make(map[uint64]storedPoint, len(stored))
+		for _, p := range stored {
+			existing[p.GetId().GetNum()] = storedPoint{
+				Hash: getPayloadStr(p.GetPayload(), "embedded_hash"),
+				Path: getPayloadStr(p.GetPayload(), "path"),
+			}
 		}
 
-		points := make([]*qdrant.PointStruct, len(chunk))
-		for j, e := range chunk {
-			points[j] = &qdrant.PointStruct{
-				Id:      qdrant.NewIDNum(pathToID(e.Path)),
-				Vectors: newVector(vecs[j]),
-				Payload: qdrant.NewValueMap(map[string]any{
-					"path":    e.Path,
-					"subject": e.Subject,
-					"from":    e.From,
-					"to":      e.To,
-					"date":    e.Date.Unix(),
-				}),
+		plan := planUpsert(s.scope, emails, existing, written)
+		wait := true
+		for id, path := range plan.Moved {
+			if _, err := s.client.SetPayload(ctx, &qdrant.SetPayloadPoints{
+				CollectionName: collectionName,
+				Payload:        qdrant.NewValueMap(map[string]any{"path": path}),
+				PointsSelector: qdrant.NewPointsSelector(qdrant.NewIDNum(id)),
+				Wait:           &wait,
+			}); err != nil {
+				return err
 			}
 		}
-		wait := true
-		if _, err := s.client.Upsert(ctx, &qdrant.UpsertPoints{
-			CollectionName: collectionName,
-			Points:         points,
-			Wait:           &wait,
-		}); err != nil {
-			return totalIndexed, errCount, err
+		if len(plan.Legacy) > 0 {
+			legacy := make([]*qdrant.PointId, len(plan.Legacy))
+			for i, id := range plan.Legacy {
+				legacy[i] = qdrant.NewIDNum(id)
+			}
+			if _, err := s.client.Delete(ctx, &qdrant.DeletePoints{
+				CollectionName: collectionName,
+				Points:         qdrant.NewPointsSelector(legacy...),
+				Wait:           &wait,
+			}); err != nil {
+				return err
+			}
+		}
+		if len(plan.Embed) > 0 {
+			if err := s.embedAndUpsert(ctx, plan.Embed); err != nil {
+				return err
+			}
 		}
-		totalIndexed += len(chunk)
-		if progress != nil {
-			progress(totalIndexed, len(emails))
+		for _, e := range emails {
+			written[s.scope.pointID(e.Path)] = true
 		}
-		elapsed := time.Since(start)
-		rate := float64(totalIndexed) / elapsed.Seconds()
-		log.Printf("Indexed %d/%d emails into Qdrant (%.1f/sec)", totalIndexed, len(emails), rate)
+		return nil
 	}
-	return totalIndexed, errCount, nil
 }
 
-func pathToID(path string) uint64 {
+// storedPoint is the payload upsertRun reads back from an existing point.
+type storedPoint struct {
+	Hash string // embedded_hash
+	Path string
+}
+
+// upsertPlan is what a chunk of emails needs written.
+type upsertPlan struct {
+	Embed  []eml.Email       // missing points, or embedded from other text
+	Moved  map[uint64]string // point ID -> new path; same text
+	Legacy []uint64          // path-keyed points of the emails, from before pointKey
+}
+
+// planUpsert decides, for a chunk of emails in scope, which to embed and
+// which points only need their path updated. existing holds the chunk's
+// stored points and written the points written earlier in the run.
+func planUpsert(scope Scope, emails []eml.Email, existing map[uint64]storedPoint, written map[uint64]bool) upsertPlan {
+	plan := upsertPlan{Moved: map[uint64]string{}}
+	planned := make(map[uint64]bool, len(emails))
+	for _, e := range emails {
+		id := scope.pointID(e.Path)
+		for _, legacy := range scope.legacyIDs(e.Path) {
+			if legacy != id && !planned[legacy] {
+				plan.Legacy = append(plan.Legacy, legacy)
+				planned[legacy] = true
+			}
+		}
+		if written[id] || planned[id] {
+			continue // a copy seen before
+		}
+		planned[id] = true
+		p, ok := existing[id]
+		if !ok || p.Hash != embeddedHash(textToEmbed(e)) {
+			plan.Embed = append(plan.Embed, e)
+			continue
+		}
+		if p.Path != e.Path {
+			plan.Moved[id] = e.Path
+		}
+	}
+	return plan
+}
+
+// embedAndUpsert embeds emails and writes their points.
+func (s *Store) embedAndUpsert(ctx context.Context, emails []eml.Email) error {
+	texts := make([]string, len(emails))
+	for i, e := range emails {
+		texts[i] = textToEmbed(e)
+	}
+	vecs, err := s.embedder.Embed(ctx, texts)
+	if err != nil {
+		return err
+	}
+	if len(vecs) != len(emails) {
+		return fmt.Errorf("embed returned %d vectors for %d emails", len(vecs), len(emails))
+	}
+
+	points := make([]*qdrant.PointStruct, len(emails))
+	for j, e := range emails {
+		payload := map[string]any{
+			"path":          e.Path,
+			"subject":       e.Subject,
+			"from":          e.From,
+			"to":            e.To,
+			"date":          e.Date.Unix(),
+			"snippet":       bodySnippet(e.BodyText),
+			"embedded_hash": embeddedHash(texts[j]),
+		}
+		if s.scope != (Scope{}) {
+			payload["user_id"] = s.scope.UserID
+			payload["account_id"] = s.scope.AccountID
+		}
+		points[j] = &qdrant.PointStruct{
+			Id:      qdrant.NewIDNum(s.scope.pointID(e.Path)),
+			Vectors: newVector(vecs[j]),
+			Payload: qdrant.NewValueMap(payload),
+		}
+	}
+	wait := true
+	_, err = s.client.Upsert(ctx, &qdrant.UpsertPoints{
+		CollectionName: collectionName,
+		Points:         points,
+		Wait:           &wait,
+	})
+	return err
+}
+
+// pointKey is what the point of the email at path is keyed on: the first
+// checksum.LegacyLength characters of the content checksum its filename
+// starts with (see checksum.FromName), as annotation keys are, so copies of
+// a message in several folders, one moved between them or one saved under
+// another CHECKSUM_LENGTH share a point. Files named otherwise are keyed on
+// their path.
+func pointKey(path string) string {
+	if sum := checksum.FromName(filepath.Base(path)); sum != "" {
+		return sum[:checksum.LegacyLength]
+	}
+	return path
+}
+
+// pointID is the Qdrant point ID of the email at path in the scope.
+func (sc Scope) pointID(path string) uint64 {
+	return sc.keyID(pointKey(path))
+}
+
+// keyID is the Qdrant point ID of key in the scope.
+func (sc Scope) keyID(key string) uint64 {
+	if sc == (Scope{}) {
+		return checksumToID(key)
+	}
+	return checksumToID(sc.UserID + "\x00" + sc.AccountID + "\x00" + key)
+}
+
+// legacyIDs are the IDs the email at path had before points were keyed on
+// pointKey: its full checksum, when longer than checksum.LegacyLength, and
+// in the unscoped collection, which predates scopes, its path.
+func (sc Scope) legacyIDs(path string) []uint64 {
+	var ids []uint64
+	if sc == (Scope{}) {
+		ids = append(ids, pathToID(path))
+	}
+	if sum := checksum.FromName(filepath.Base(path)); len(sum) > checksum.LegacyLength {
+		ids = append(ids, sc.keyID(sum))
+	}
+	return ids
+}
+
+// filter restricts a query to the scope's points; nil when unscoped.
+func (sc Scope) filter() *qdrant.Filter {
+	if sc == (Scope{}) {
+		return nil
+	}
+	return &qdrant.Filter{Must: []*qdrant.Condition{
+		qdrant.NewMatchKeyword("user_id", sc.UserID),
+		qdrant.NewMatchKeyword("account_id", sc.AccountID),
+	}}
+}
+
+func checksumToID(key string) uint64 {
 	h := fnv.New64a()
-	h.Write([]byte(path))
+	h.Write([]byte(key))
 	return h.Sum64()
 }
 
+// pathToID is the point ID of the email at path in collections indexed
+// before points were keyed on pointKey.
+func pathToID(path string) uint64 {
+	return checksumToID(path)
+}
+
+// embeddedHash identifies the text a vector was embedded from; it is kept
+// in the point's embedded_hash payload.
+func embeddedHash(text string) string {
+	sum := sha256.Sum256([]byte(text))
+	return hex.EncodeToString(sum[:16])
+}
+
 func textToEmbed(e eml.Email) string {
 	var b strings.Builder
 	if e.Subject != "" {
@@ -268,6 +687,15 @@ func textToEmbed(e eml.Email) string {
 	return b.String()
 }
 
+// bodySnippet returns the first snippetLen runes of body with whitespace collapsed.
+func bodySnippet(body string) string {
+	runes := []rune(strings.Join(strings.Fields(body), " "))
+	if len(runes) <= snippetLen {
+		return string(runes)
+	}
+	return string(runes[:snippetLen]) + "..."
+}
+
 func newVector(v []float32) *qdrant.Vectors {
 	return qdrant.NewVectors(v...)
 }
@@ -279,20 +707,46 @@ type SearchResult struct {
 	From    string  `json:"from"`
 	To      string  `json:"to"`
 	Date    int64   `json:"date"`
+	Snippet string  `json:"snippet,omitempty"`
 	Score   float32 `json:"score"`
 }
 
-// Search runs a similarity search and returns hits with metadata.
+// SearchPage is a page of similarity hits shaped like a keyword search
+// result.
+type SearchPage struct {
+	Query  string         `json:"query"`
+	Total  int            `json:"total"`
+	Offset int            `json:"offset"`
+	Limit  int            `json:"limit"`
+	Hits   []SearchResult `json:"hits"`
+	// Pagination's TotalPages and Page count only as far as one result
+	// past this page (see Search); HasNext is exact.
+	Pagination model.Pagination `json:"pagination"`
+}
+
+// SearchPage runs Search and adds pagination, with Next and Prev links
+// built from query (nil for none).
+func (s *Store) SearchPage(ctx context.Context, q string, limit, offset int, query url.Values) (SearchPage, error) {
+	hits, total, err := s.Search(ctx, q, limit, offset)
+	if err != nil {
+		return SearchPage{}, err
+	}
+	limit, offset = pageBounds(limit, offset)
+	return SearchPage{
+		Query:      q,
+		Total:      total,
+		Offset:     offset,
+		Limit:      limit,
+		Hits:       hits,
+		Pagination: model.NewPagination(total, offset, limit, query),
+	}, nil
+}
+
+// Search runs a similarity search and returns hits with metadata. The
+// total counts matches up to one past the page, enough to tell whether
+// another page exists: nearest-neighbour search has no fixed match count.
 func (s *Store) Search(ctx context.Context, query string, limit, offset int) ([]SearchResult, int, error) {
-	if limit < 1 {
-		limit = 50
-	}
-	if limit > 500 {
-		limit = 500
-	}
-	if offset < 0 {
-		offset = 0
-	}
+	limit, offset = pageBounds(limit, offset)
 
 	query = strings.TrimSpace(query)
 	if query == "" {
@@ -318,6 +772,7 @@ func (s *Store) Search(ctx context.Context, query string, limit, offset int) ([]
 	hits, err := s.client.Query(ctx, &qdrant.QueryPoints{
 		CollectionName: collectionName,
 		Query:          qdrant.NewQuery(queryFloats...),
+		Filter:         s.scope.filter(),
 		Limit:          ptr(uint64(reqLimit)),
 		WithPayload:    qdrant.NewWithPayload(true),
 	})
@@ -348,12 +803,22 @@ func (s *Store) Search(ctx context.Context, query string, limit, offset int) ([]
 			From:    getPayloadStr(payload, "from"),
 			To:      getPayloadStr(payload, "to"),
 			Date:    getPayloadInt64(payload, "date"),
+			Snippet: getPayloadStr(payload, "snippet"),
 			Score:   float32(p.GetScore()),
 		}
 	}
 	return results, total, nil
 }
 
+// pageBounds applies Search's defaults: limit 50 when unset, at most 500,
+// and no negative offset.
+func pageBounds(limit, offset int) (int, int) {
+	if limit < 1 {
+		limit = 50
+	}
+	return min(limit, 500), max(offset, 0)
+}
+
 func ptr[T any](v T) *T { return &v }
 
 func getPayloadStr(payload map[string]*qdrant.Value, key string) string {
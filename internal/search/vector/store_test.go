@@ -0,0 +1,122 @@
+package vector
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+
+	"github.com/eslider/mails/internal/search/eml"
+)
+
+func TestConnOptionsFromEnv(t *testing.T) {
+	t.Setenv("QDRANT_API_KEY", " secret ")
+	t.Setenv("QDRANT_TLS", "true")
+	if o := ConnOptionsFromEnv(); o.APIKey != "secret" || !o.TLS {
+		t.Errorf("ConnOptionsFromEnv = %+v, want key and TLS", o)
+	}
+	if got := restBase("db.example.com", true); got != "https://db.example.com:6333" {
+		t.Errorf("restBase = %s", got)
+	}
+	if got := restBase("localhost", false); got != "http://localhost:6333" {
+		t.Errorf("restBase = %s", got)
+	}
+}
+
+func TestCollectionVectorSizeSendsAPIKey(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("api-key") != "secret" {
+			http.Error(w, "forbidden", http.StatusForbidden)
+			return
+		}
+		w.Write([]byte(`{"result":{"config":{"params":{"vectors":{"size":384}}}}}`))
+	}))
+	defer srv.Close()
+
+	s := &Store{restHost: srv.URL, apiKey: "secret"}
+	if n, err := s.collectionVectorSize(context.Background()); err != nil || n != 384 {
+		t.Errorf("collectionVectorSize = %d, %v; want 384", n, err)
+	}
+	s.apiKey = ""
+	if _, err := s.collectionVectorSize(context.Background()); err == nil {
+		t.Error("request without the key should fail")
+	}
+}
+
+func TestPointKeyFollowsContent(t *testing.T) {
+	const sum = "0123456789abcdef01234567"
+	if (Scope{}).pointID("INBOX/"+sum+"-4.eml") != (Scope{}).pointID("Archive/2024/"+sum+"-9.eml.gz") {
+		t.Error("copies of a message in two folders have different points")
+	}
+	if (Scope{}).pointID("INBOX/"+sum+"-4.eml") == (Scope{}).pointID("INBOX/fedcba9876543210fedcba98-4.eml") {
+		t.Error("two messages share a point")
+	}
+	if (Scope{}).pointID("INBOX/"+sum[:16]+"-4.eml") != (Scope{}).pointID("INBOX/"+sum+"-4.eml") {
+		t.Error("a message saved under CHECKSUM_LENGTH 16 and 24 has two points")
+	}
+	if got := pointKey("import/12.eml"); got != "import/12.eml" {
+		t.Errorf("pointKey of a file without checksum = %q, want its path", got)
+	}
+}
+
+func TestScopedPoints(t *testing.T) {
+	const sum = "0123456789abcdef01234567"
+	alice := Scope{UserID: "alice", AccountID: "acct-1"}
+	bob := Scope{UserID: "bob", AccountID: "acct-2"}
+	if alice.pointID("INBOX/"+sum+"-4.eml") == bob.pointID("INBOX/"+sum+"-4.eml") {
+		t.Error("two users holding the same message share a point")
+	}
+	if alice.pointID("INBOX/1.eml") == (Scope{UserID: "alice", AccountID: "acct-3"}).pointID("INBOX/1.eml") {
+		t.Error("two accounts with a file at the same path share a point")
+	}
+	if alice.pointID("INBOX/"+sum+"-4.eml") != alice.pointID("Archive/"+sum+"-9.eml") {
+		t.Error("copies of a message within one account have different points")
+	}
+	if f := alice.filter(); len(f.GetMust()) != 2 {
+		t.Errorf("filter = %v, want user and account conditions", f)
+	}
+	if (Scope{}).filter() != nil {
+		t.Error("the unscoped collection should not be filtered")
+	}
+
+	// Path-keyed points predate scopes; a scoped run must not delete them,
+	// only the point it keyed on the full checksum before.
+	e := eml.Email{Path: "INBOX/" + sum + "-4.eml"}
+	want := []uint64{alice.keyID(sum)}
+	if plan := planUpsert(alice, []eml.Email{e}, nil, map[uint64]bool{}); !reflect.DeepEqual(plan.Legacy, want) {
+		t.Errorf("scoped Legacy = %v, want %v", plan.Legacy, want)
+	}
+}
+
+func TestPlanUpsertEmbedsChangedEmailsOnly(t *testing.T) {
+	const a, b, c = "aaaaaaaaaaaaaaaaaaaaaaaa", "bbbbbbbbbbbbbbbbbbbbbbbb", "cccccccccccccccccccccccc"
+	same := eml.Email{Path: "Archive/" + a + "-1.eml", Subject: "Moved", BodyText: "unchanged"}
+	edited := eml.Email{Path: "INBOX/" + b + "-1.eml", Subject: "Reparsed", BodyText: "new text"}
+	fresh := eml.Email{Path: "INBOX/" + c + "-1.eml", Subject: "New"}
+	copyOfFresh := eml.Email{Path: "All Mail/" + c + "-2.eml", Subject: "New"}
+	written := eml.Email{Path: "Sent/" + a + "-2.eml", Subject: "Moved", BodyText: "unchanged"}
+	existing := map[uint64]storedPoint{
+		(Scope{}).pointID(same.Path):   {Hash: embeddedHash(textToEmbed(same)), Path: "INBOX/" + a + "-1.eml"},
+		(Scope{}).pointID(edited.Path): {Hash: embeddedHash("old text"), Path: edited.Path},
+	}
+
+	plan := planUpsert(Scope{}, []eml.Email{same, edited, fresh, copyOfFresh}, existing, map[uint64]bool{})
+	if !reflect.DeepEqual(plan.Embed, []eml.Email{edited, fresh}) {
+		t.Errorf("Embed = %+v, want the edited and the new email, each message once", plan.Embed)
+	}
+	if want := map[uint64]string{(Scope{}).pointID(same.Path): same.Path}; !reflect.DeepEqual(plan.Moved, want) {
+		t.Errorf("Moved = %v, want the moved email's new path", plan.Moved)
+	}
+	// The path-keyed IDs of the 4 emails and the full-checksum IDs of the 3
+	// messages.
+	if len(plan.Legacy) != 7 || plan.Legacy[0] != pathToID(same.Path) || plan.Legacy[1] != checksumToID(a) {
+		t.Errorf("Legacy = %v, want the path- and full-checksum-keyed IDs", plan.Legacy)
+	}
+
+	// A copy of a message written earlier in the run keeps the first path.
+	plan = planUpsert(Scope{}, []eml.Email{written}, existing, map[uint64]bool{(Scope{}).pointID(same.Path): true})
+	if len(plan.Embed) != 0 || len(plan.Moved) != 0 {
+		t.Errorf("plan for a copy written earlier = %+v, want nothing", plan)
+	}
+}
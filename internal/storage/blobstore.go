@@ -15,6 +15,10 @@ type BlobStore interface {
 	Write(ctx context.Context, key string, data []byte) error
 	Read(ctx context.Context, key string) ([]byte, error)
 	List(ctx context.Context, prefix string) ([]string, error)
+	// Delete removes a blob. Deleting a missing key is not an error.
+	Delete(ctx context.Context, key string) error
+	// Size returns the total bytes of all blobs under prefix.
+	Size(ctx context.Context, prefix string) (int64, error)
 }
 
 // FSBlobStore stores blobs on the local filesystem.
@@ -49,6 +53,15 @@ func (f *FSBlobStore) Read(ctx context.Context, key string) ([]byte, error) {
 	return data, nil
 }
 
+// Delete removes a blob by key.
+func (f *FSBlobStore) Delete(ctx context.Context, key string) error {
+	err := os.Remove(filepath.Join(f.root, filepath.FromSlash(key)))
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
+
 // List returns keys under prefix (non-recursive for first level, or recursive based on impl).
 // FS impl walks recursively to match S3 List behavior.
 func (f *FSBlobStore) List(ctx context.Context, prefix string) ([]string, error) {
@@ -74,6 +87,27 @@ func (f *FSBlobStore) List(ctx context.Context, prefix string) ([]string, error)
 	return keys, err
 }
 
+// Size sums the sizes of all files under prefix.
+func (f *FSBlobStore) Size(ctx context.Context, prefix string) (int64, error) {
+	var total int64
+	err := filepath.WalkDir(filepath.Join(f.root, filepath.FromSlash(prefix)), func(path string, d os.DirEntry, err error) error {
+		if err != nil {
+			if os.IsNotExist(err) {
+				return nil
+			}
+			return err
+		}
+		if d.IsDir() {
+			return nil
+		}
+		if info, err := d.Info(); err == nil {
+			total += info.Size()
+		}
+		return nil
+	})
+	return total, err
+}
+
 // S3BlobStore stores blobs in S3. Keys are used as S3 object keys.
 type S3BlobStore struct {
 	client *S3Client
@@ -99,6 +133,16 @@ func (s *S3BlobStore) Read(ctx context.Context, key string) ([]byte, error) {
 	return s.client.Get(ctx, s.prefix+key)
 }
 
+// Delete removes a blob by key.
+func (s *S3BlobStore) Delete(ctx context.Context, key string) error {
+	return s.client.Delete(ctx, s.prefix+key)
+}
+
+// Size sums the sizes of all objects under prefix.
+func (s *S3BlobStore) Size(ctx context.Context, prefix string) (int64, error) {
+	return s.client.Size(ctx, s.prefix+prefix)
+}
+
 // NewBlobStore returns a BlobStore from env. If S3 env vars are set, returns S3BlobStore;
 // otherwise returns FSBlobStore rooted at dataDir.
 func NewBlobStore(dataDir string) (BlobStore, error) {
@@ -164,6 +164,15 @@ func (c *S3Client) Get(ctx context.Context, key string) ([]byte, error) {
 	return io.ReadAll(out.Body)
 }
 
+// Delete removes an object by key. S3 treats a missing key as deleted.
+func (c *S3Client) Delete(ctx context.Context, key string) error {
+	_, err := c.client.DeleteObject(ctx, &s3.DeleteObjectInput{
+		Bucket: aws.String(c.bucket),
+		Key:    aws.String(key),
+	})
+	return err
+}
+
 // List lists object keys with the given prefix.
 func (c *S3Client) List(ctx context.Context, prefix string) ([]string, error) {
 	var keys []string
@@ -190,5 +199,29 @@ func (c *S3Client) List(ctx context.Context, prefix string) ([]string, error) {
 	return keys, nil
 }
 
+// Size returns the total size in bytes of all objects under prefix.
+func (c *S3Client) Size(ctx context.Context, prefix string) (int64, error) {
+	var total int64
+	var contToken *string
+	for {
+		out, err := c.client.ListObjectsV2(ctx, &s3.ListObjectsV2Input{
+			Bucket:            aws.String(c.bucket),
+			Prefix:            aws.String(prefix),
+			ContinuationToken: contToken,
+		})
+		if err != nil {
+			return 0, err
+		}
+		for _, obj := range out.Contents {
+			total += aws.ToInt64(obj.Size)
+		}
+		if !aws.ToBool(out.IsTruncated) {
+			break
+		}
+		contToken = out.NextContinuationToken
+	}
+	return total, nil
+}
+
 // ErrNotFound is returned when an object does not exist.
 var ErrNotFound = errors.New("object not found")
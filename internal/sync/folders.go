@@ -0,0 +1,77 @@
+package sync
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/eslider/mails/internal/model"
+	sync_imap "github.com/eslider/mails/internal/sync/imap"
+)
+
+// ErrNoFolderList is returned by ListFolders for account types whose
+// server has no folders to choose from, such as POP3 and PST.
+var ErrNoFolderList = errors.New("folder listing needs an IMAP account")
+
+// folderTTL is how long a server's folder list is reused, so reopening the
+// account form does not log in again.
+const folderTTL = 5 * time.Minute
+
+type folderEntry struct {
+	folders  []sync_imap.Folder
+	listedAt time.Time
+}
+
+// folderCache remembers LIST results keyed by account and server, so an
+// edited host or login is listed afresh.
+type folderCache struct {
+	mu      sync.Mutex
+	entries map[string]folderEntry
+}
+
+func (c *folderCache) get(key string) ([]sync_imap.Folder, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	e, ok := c.entries[key]
+	if !ok || time.Since(e.listedAt) > folderTTL {
+		return nil, false
+	}
+	return e.folders, true
+}
+
+func (c *folderCache) set(key string, folders []sync_imap.Folder) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.entries == nil {
+		c.entries = make(map[string]folderEntry)
+	}
+	c.entries[key] = folderEntry{folders: folders, listedAt: time.Now()}
+}
+
+// ListFolders returns the folders on the account's IMAP server, for
+// choosing what its Folders setting syncs. Nothing is downloaded. Results
+// are cached for a few minutes; refresh forces a new LIST.
+func (s *Service) ListFolders(ctx context.Context, userID, accountID string, refresh bool) ([]sync_imap.Folder, error) {
+	acct, err := s.accounts.Get(userID, accountID)
+	if err != nil {
+		return nil, err
+	}
+	if acct.Type != model.AccountTypeIMAP {
+		return nil, fmt.Errorf("%s (%s): %w", acct.Email, acct.Type, ErrNoFolderList)
+	}
+
+	key := fmt.Sprintf("%s|%s|%d|%s", acct.ID, acct.Host, acct.Port, acct.Email)
+	if !refresh {
+		if folders, ok := s.folders.get(key); ok {
+			return folders, nil
+		}
+	}
+	folders, err := sync_imap.ListFolders(ctx, *acct)
+	if err != nil {
+		return nil, err
+	}
+	s.folders.set(key, folders)
+	return folders, nil
+}
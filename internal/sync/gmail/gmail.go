@@ -41,7 +41,8 @@ func SyncWithContext(ctx context.Context, acct model.EmailAccount, emailDir stri
 	// 4. Convert Gmail message format to raw RFC822 .eml
 
 	// The implementation should:
-	// - List all messages using users.messages.list
+	// - List all messages using users.messages.list, with q=after:YYYY/MM/DD
+	//   when acct.SyncSince is set
 	// - For each new message ID (not in state), fetch raw RFC822
 	// - Map Gmail labels to filesystem paths
 	// - Save as {checksum}-{messageID}.eml
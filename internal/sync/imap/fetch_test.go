@@ -0,0 +1,120 @@
+package imap
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+// fakeServer answers each command read from the client with the response
+// reply returns for its tag, after the greeting.
+func fakeServer(t *testing.T, reply func(tag, cmd string) string) *imapClient {
+	t.Helper()
+	server, conn := net.Pipe()
+	t.Cleanup(func() { server.Close(); conn.Close() })
+	go func() {
+		server.Write([]byte("* OK ready\r\n"))
+		r := bufio.NewReader(server)
+		for {
+			line, err := r.ReadString('\n')
+			if err != nil {
+				return
+			}
+			tag, cmd, _ := strings.Cut(strings.TrimRight(line, "\r\n"), " ")
+			if _, err := server.Write([]byte(reply(tag, cmd))); err != nil {
+				return
+			}
+		}
+	}()
+	c, err := newIMAPClient(conn, 5*time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return c
+}
+
+func syntheticMessage(bodySize int) []byte {
+	var b bytes.Buffer
+	b.WriteString("From: a@example.com\r\nSubject: big\r\n\r\n")
+	line := strings.Repeat("x", 76) + "\r\n"
+	for b.Len() < bodySize {
+		b.WriteString(line)
+	}
+	return b.Bytes()
+}
+
+func TestFetchBatchSpoolsLargeMessages(t *testing.T) {
+	old := spoolLiteralBytes
+	spoolLiteralBytes = 64 << 10
+	t.Cleanup(func() { spoolLiteralBytes = old })
+
+	big := syntheticMessage(1 << 20)
+	small := []byte("Subject: small\r\n\r\nhi\r\n")
+	c := fakeServer(t, func(tag, cmd string) string {
+		return fmt.Sprintf("* 1 FETCH (UID 7 RFC822 {%d}\r\n%s)\r\n* 2 FETCH (RFC822 {%d}\r\n%s UID 8)\r\n%s OK done\r\n",
+			len(big), big, len(small), small, tag)
+	})
+
+	got, err := c.fetchBatch([]int{7, 8})
+	if err != nil {
+		t.Fatal(err)
+	}
+	item := got[7]
+	if item.spool == "" || item.data != nil {
+		t.Fatalf("large message not spooled: %+v", item)
+	}
+	if data, err := item.load(); err != nil || !bytes.Equal(data, big) {
+		t.Fatalf("spooled message = %d bytes, %v; want %d", len(data), err, len(big))
+	}
+	item.discard()
+	if _, err := os.Stat(item.spool); !os.IsNotExist(err) {
+		t.Errorf("spool file left after discard: %v", err)
+	}
+	if got[8].spool != "" || !bytes.Equal(got[8].data, small) {
+		t.Errorf("message after the large one = %+v", got[8])
+	}
+}
+
+func TestFetchBatchResyncsOnLiteralMismatch(t *testing.T) {
+	msg := []byte("Subject: one\r\n\r\nfirst line\r\nsecond line\r\n")
+	c := fakeServer(t, func(tag, cmd string) string {
+		if strings.HasPrefix(cmd, "NOOP") {
+			return tag + " OK NOOP completed\r\n"
+		}
+		// The server claims fewer bytes than it sends for UID 7.
+		return fmt.Sprintf("* 1 FETCH (UID 7 RFC822 {20}\r\n%s)\r\n* 2 FETCH (UID 8 RFC822 {%d}\r\n%s)\r\n%s OK done\r\n",
+			msg, len(msg), msg, tag)
+	})
+
+	got, err := c.fetchBatch([]int{7, 8})
+	if !errors.Is(err, errLiteralMismatch) {
+		t.Fatalf("err = %v, want errLiteralMismatch", err)
+	}
+	if len(got) != 0 {
+		t.Errorf("got %d messages from a desynced response", len(got))
+	}
+	if _, err := c.command("NOOP"); err != nil {
+		t.Errorf("command after resync: %v", err)
+	}
+}
+
+func TestIsFetchTail(t *testing.T) {
+	for line, want := range map[string]bool{
+		")":                  true,
+		" UID 8)":            true,
+		" FLAGS (\\Seen))":   true,
+		"second line":        false,
+		"(see attachment)":   false,
+		"* 2 FETCH (UID 8 {": false,
+	} {
+		if got := isFetchTail(line); got != want {
+			t.Errorf("isFetchTail(%q) = %v, want %v", line, got, want)
+		}
+	}
+}
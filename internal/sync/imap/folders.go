@@ -0,0 +1,197 @@
+package imap
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/eslider/mails/internal/model"
+)
+
+// Folder is a selectable mailbox reported by the server's LIST command.
+type Folder struct {
+	Name string `json:"name"`
+	// DisplayName is Name decoded from modified UTF-7, set when the two
+	// differ ("Entwürfe" for "Entw&APw-rfe").
+	DisplayName string `json:"display_name,omitempty"`
+	Delimiter   string `json:"delimiter,omitempty"` // hierarchy separator, e.g. "/" or "."
+	// SpecialUse is the RFC 6154 role without the backslash, such as
+	// "Sent", "Drafts" or "All"; empty for ordinary folders.
+	SpecialUse string `json:"special_use,omitempty"`
+}
+
+// specialUse lists the RFC 6154 mailbox attributes, lowercased.
+var specialUse = map[string]string{
+	`\all`:     "All",
+	`\archive`: "Archive",
+	`\drafts`:  "Drafts",
+	`\flagged`: "Flagged",
+	`\junk`:    "Junk",
+	`\sent`:    "Sent",
+	`\trash`:   "Trash",
+}
+
+// ListFolders logs in to the account's server and returns its selectable
+// folders without selecting or downloading anything. The names are the
+// ones accepted in the account's Folders setting.
+func ListFolders(ctx context.Context, acct model.EmailAccount) ([]Folder, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	client, err := connect(acct)
+	if err != nil {
+		return nil, err
+	}
+	defer client.logout()
+
+	stop := context.AfterFunc(ctx, func() { client.conn.SetDeadline(time.Now()) })
+	defer stop()
+
+	folders, err := client.list()
+	if err != nil {
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+		return nil, fmt.Errorf("list folders: %w", err)
+	}
+	return folders, nil
+}
+
+// parseListLine parses one untagged LIST response such as
+//
+//   - LIST (\HasNoChildren \Sent) "/" "[Gmail]/Sent Mail"
+//
+// The delimiter may be NIL and the name a quoted string (with \" and \\
+// escapes) or a bare atom. Lines that are not LIST responses, and folders
+// flagged \Noselect or \NonExistent, report ok=false.
+func parseListLine(line string) (f Folder, ok bool) {
+	const prefix = "* LIST "
+	if len(line) < len(prefix) || !strings.EqualFold(line[:len(prefix)], prefix) {
+		return Folder{}, false
+	}
+	rest := strings.TrimSpace(line[len(prefix):])
+	if !strings.HasPrefix(rest, "(") {
+		return Folder{}, false
+	}
+	end := strings.Index(rest, ")")
+	if end < 0 {
+		return Folder{}, false
+	}
+	for _, flag := range strings.Fields(strings.ToLower(rest[1:end])) {
+		switch flag {
+		case `\noselect`, `\nonexistent`:
+			return Folder{}, false
+		}
+		if role, ok := specialUse[flag]; ok && f.SpecialUse == "" {
+			f.SpecialUse = role
+		}
+	}
+
+	rest = strings.TrimSpace(rest[end+1:])
+	if len(rest) >= 4 && strings.EqualFold(rest[:4], "NIL ") {
+		rest = rest[4:]
+	} else if f.Delimiter, rest, ok = listToken(rest); !ok {
+		return Folder{}, false
+	}
+	name, _, ok := listToken(strings.TrimSpace(rest))
+	if !ok || name == "" {
+		return Folder{}, false
+	}
+	f.Name = name
+	if d := decodeModifiedUTF7(name); d != name {
+		f.DisplayName = d
+	}
+	return f, true
+}
+
+// listToken reads a quoted string or an atom from the start of s and
+// returns it unquoted together with the remainder.
+func listToken(s string) (tok, rest string, ok bool) {
+	if s == "" {
+		return "", "", false
+	}
+	if s[0] != '"' {
+		if i := strings.IndexByte(s, ' '); i >= 0 {
+			return s[:i], s[i+1:], true
+		}
+		return s, "", true
+	}
+	var b strings.Builder
+	for i := 1; i < len(s); i++ {
+		switch s[i] {
+		case '\\':
+			if i+1 < len(s) {
+				i++
+				b.WriteByte(s[i])
+			}
+		case '"':
+			return b.String(), s[i+1:], true
+		default:
+			b.WriteByte(s[i])
+		}
+	}
+	return "", "", false
+}
+
+// defaultFolderPriority puts the mail users look at first ahead of large
+// archive folders such as "All Mail".
+var defaultFolderPriority = []string{"INBOX", "Sent"}
+
+// folderPriorityFromEnv reads IMAP_FOLDER_PRIORITY, a comma-separated list
+// of folder names synced first, in that order. Unset keeps the default.
+func folderPriorityFromEnv() []string {
+	v := strings.TrimSpace(os.Getenv("IMAP_FOLDER_PRIORITY"))
+	if v == "" {
+		return defaultFolderPriority
+	}
+	var names []string
+	for _, n := range strings.Split(v, ",") {
+		if n = strings.TrimSpace(n); n != "" {
+			names = append(names, n)
+		}
+	}
+	return names
+}
+
+// sortFolders orders folders by their first matching priority entry;
+// unmatched folders follow in server order. A name matches a folder
+// case-insensitively when it equals the folder or its last path segment,
+// or is the first word of that segment ("Sent" matches "[Gmail]/Sent Mail"
+// and "INBOX.Sent Items").
+func sortFolders(folders, priority []string) []string {
+	rank := func(folder string) int {
+		leaf := strings.ToLower(folder)
+		if i := strings.LastIndexAny(leaf, "/."); i >= 0 {
+			leaf = leaf[i+1:]
+		}
+		for i, p := range priority {
+			p = strings.ToLower(p)
+			if strings.EqualFold(folder, p) || leaf == p || strings.HasPrefix(leaf, p+" ") {
+				return i
+			}
+		}
+		return len(priority)
+	}
+	sorted := append([]string(nil), folders...)
+	sort.SliceStable(sorted, func(i, j int) bool { return rank(sorted[i]) < rank(sorted[j]) })
+	return sorted
+}
+
+// excludeFolders drops the folders matching the account's ExcludeFolders.
+// Their directories are matched the same way by the search index, so
+// mail synced before they were excluded is not searched either.
+func excludeFolders(folders []string, acct model.EmailAccount) []string {
+	kept := folders[:0:0]
+	for _, f := range folders {
+		if acct.ExcludesFolder(f) || acct.ExcludesFolder(decodeModifiedUTF7(f)) || acct.ExcludesFolder(imapFolderToPath(f)) {
+			log.Printf("IMAP: skipping excluded folder %q", f)
+			continue
+		}
+		kept = append(kept, f)
+	}
+	return kept
+}
@@ -0,0 +1,87 @@
+package imap
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/eslider/mails/internal/model"
+)
+
+func TestSortFoldersInboxFirst(t *testing.T) {
+	server := []string{"[Gmail]/All Mail", "Archive", "[Gmail]/Sent Mail", "Newsletters", "INBOX", "Drafts"}
+
+	got := sortFolders(server, defaultFolderPriority)
+	want := []string{"INBOX", "[Gmail]/Sent Mail", "[Gmail]/All Mail", "Archive", "Newsletters", "Drafts"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("sortFolders = %v, want %v", got, want)
+	}
+	if server[0] != "[Gmail]/All Mail" {
+		t.Error("sortFolders must not reorder its input")
+	}
+
+	// Dovecot-style names and subfolders of INBOX.
+	got = sortFolders([]string{"INBOX.Trash", "INBOX.Sent Items", "INBOX"}, defaultFolderPriority)
+	want = []string{"INBOX", "INBOX.Sent Items", "INBOX.Trash"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("dovecot sortFolders = %v, want %v", got, want)
+	}
+}
+
+func TestFolderPriorityFromEnv(t *testing.T) {
+	t.Setenv("IMAP_FOLDER_PRIORITY", " Important , INBOX,")
+	priority := folderPriorityFromEnv()
+	if want := []string{"Important", "INBOX"}; !reflect.DeepEqual(priority, want) {
+		t.Fatalf("priority = %v, want %v", priority, want)
+	}
+	got := sortFolders([]string{"INBOX", "Sent", "Work/Important"}, priority)
+	if want := []string{"Work/Important", "INBOX", "Sent"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("sortFolders = %v, want %v", got, want)
+	}
+
+	t.Setenv("IMAP_FOLDER_PRIORITY", "")
+	if got := folderPriorityFromEnv(); !reflect.DeepEqual(got, defaultFolderPriority) {
+		t.Errorf("unset priority = %v, want default", got)
+	}
+}
+
+func TestParseListLine(t *testing.T) {
+	tests := []struct {
+		line string
+		want Folder
+		ok   bool
+	}{
+		{`* LIST (\HasNoChildren) "/" "INBOX"`, Folder{Name: "INBOX", Delimiter: "/"}, true},
+		{`* LIST (\HasNoChildren \Sent) "/" "[Gmail]/Sent Mail"`, Folder{Name: "[Gmail]/Sent Mail", Delimiter: "/", SpecialUse: "Sent"}, true},
+		{`* list (\HasChildren) "." INBOX`, Folder{Name: "INBOX", Delimiter: "."}, true},
+		{`* LIST () NIL "Shared"`, Folder{Name: "Shared"}, true},
+		{`* LIST (\Drafts) "/" "INBOX/Entw&APw-rfe"`, Folder{Name: "INBOX/Entw&APw-rfe", DisplayName: "INBOX/Entwürfe", Delimiter: "/", SpecialUse: "Drafts"}, true},
+		{`* LIST (\Trash) "/" "Say \"hi\" \\ bye"`, Folder{Name: `Say "hi" \ bye`, Delimiter: "/", SpecialUse: "Trash"}, true},
+		{`* LIST (\Noselect \HasChildren) "/" "[Gmail]"`, Folder{}, false},
+		{`* LIST (\NonExistent) "/" "Gone"`, Folder{}, false},
+		{`* LSUB () "/" "INBOX"`, Folder{}, false},
+		{`* LIST (\HasNoChildren) "/" "unterminated`, Folder{}, false},
+	}
+	for _, tt := range tests {
+		got, ok := parseListLine(tt.line)
+		if ok != tt.ok || got != tt.want {
+			t.Errorf("parseListLine(%s) = %+v, %v; want %+v, %v", tt.line, got, ok, tt.want, tt.ok)
+		}
+	}
+}
+
+func TestExcludeFolders(t *testing.T) {
+	server := []string{"INBOX", "[Gmail]/Spam", "[Gmail]/Sent Mail", "INBOX.Junk", "Projects/Old"}
+	acct := model.EmailAccount{ExcludeFolders: "Spam,Junk,projects/*"}
+
+	got := excludeFolders(server, acct)
+	want := []string{"INBOX", "[Gmail]/Sent Mail"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("excludeFolders = %v, want %v", got, want)
+	}
+	if server[1] != "[Gmail]/Spam" {
+		t.Error("excludeFolders must not modify its input")
+	}
+	if got := excludeFolders(server, model.EmailAccount{}); !reflect.DeepEqual(got, server) {
+		t.Errorf("without patterns = %v, want all folders", got)
+	}
+}
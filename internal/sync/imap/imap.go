@@ -4,9 +4,10 @@ package imap
 
 import (
 	"context"
-	"crypto/sha256"
 	"crypto/tls"
+	"errors"
 	"fmt"
+	"io"
 	"log"
 	"net"
 	"net/mail"
@@ -16,7 +17,10 @@ import (
 	"strings"
 	"time"
 
+	"github.com/eslider/mails/internal/checksum"
 	"github.com/eslider/mails/internal/model"
+	"github.com/eslider/mails/internal/search/eml"
+	"github.com/eslider/mails/internal/sync/mailtls"
 )
 
 // SyncState abstracts the sync state storage (implemented by sync.StateDB).
@@ -25,8 +29,20 @@ type SyncState interface {
 	MarkUIDSynced(accountID, folder, uid string) error
 }
 
-// ProgressFunc is called with human-readable progress updates during sync.
-type ProgressFunc func(msg string)
+// Progress is a sync progress snapshot. Message is the human-readable form;
+// the counters let callers draw a progress bar. MessagesDone/MessagesTotal
+// count new (not yet synced) messages in the current folder.
+type Progress struct {
+	Message       string
+	Folder        string
+	FoldersDone   int
+	FoldersTotal  int
+	MessagesDone  int
+	MessagesTotal int
+}
+
+// ProgressFunc is called with progress updates during sync.
+type ProgressFunc func(p Progress)
 
 // SaveEmailFunc saves email data by full path. If nil, os.WriteFile is used.
 type SaveEmailFunc func(path string, data []byte) error
@@ -41,41 +57,26 @@ func Sync(acct model.EmailAccount, emailDir string, state SyncState) (int, error
 // saveFn optionally stores emails (e.g. to S3). If nil, uses os.WriteFile.
 func SyncWithContext(ctx context.Context, acct model.EmailAccount, emailDir string, state SyncState, onProgress ProgressFunc, saveFn SaveEmailFunc) (int, error) {
 	if onProgress == nil {
-		onProgress = func(string) {}
-	}
-
-	addr := net.JoinHostPort(acct.Host, fmt.Sprintf("%d", acct.Port))
-	log.Printf("IMAP: connecting to %s as %s", addr, acct.Email)
-	onProgress("connecting to " + acct.Host)
-
-	var conn net.Conn
-	var err error
-	if acct.SSL {
-		conn, err = tls.Dial("tcp", addr, &tls.Config{ServerName: acct.Host})
-	} else {
-		conn, err = net.DialTimeout("tcp", addr, 30*time.Second)
+		onProgress = func(Progress) {}
 	}
-	if err != nil {
-		return 0, fmt.Errorf("connect %s: %w", addr, err)
-	}
-	defer conn.Close()
 
-	client, err := newIMAPClient(conn)
+	onProgress(Progress{Message: "connecting to " + acct.Host})
+	client, err := connect(acct)
 	if err != nil {
-		return 0, fmt.Errorf("imap init: %w", err)
+		return 0, err
 	}
 	defer client.logout()
-
-	if err := client.login(acct.Email, acct.Password); err != nil {
-		return 0, fmt.Errorf("imap login: %w", err)
-	}
 	log.Printf("IMAP: logged in to %s", acct.Host)
-	onProgress("logged in, listing folders")
+	onProgress(Progress{Message: "logged in, listing folders"})
 
 	folders, err := client.listFolders(acct.Folders)
 	if err != nil {
 		return 0, fmt.Errorf("list folders: %w", err)
 	}
+	if acct.Folders == "all" {
+		folders = sortFolders(folders, folderPriorityFromEnv())
+	}
+	folders = excludeFolders(folders, acct)
 	log.Printf("IMAP: %d folders to sync", len(folders))
 
 	totalNew := 0
@@ -88,8 +89,18 @@ func SyncWithContext(ctx context.Context, acct model.EmailAccount, emailDir stri
 		default:
 		}
 
-		onProgress(fmt.Sprintf("folder %d/%d: %s", fi+1, len(folders), folder))
-		n, err := syncFolderWithContext(ctx, client, acct, folder, emailDir, state, saveFn)
+		p := Progress{
+			Message:      fmt.Sprintf("folder %d/%d: %s", fi+1, len(folders), folder),
+			Folder:       folder,
+			FoldersDone:  fi,
+			FoldersTotal: len(folders),
+		}
+		onProgress(p)
+		n, err := syncFolderWithContext(ctx, client, acct, folder, emailDir, state, saveFn, func(done, total int) {
+			p.MessagesDone, p.MessagesTotal = done, total
+			p.Message = fmt.Sprintf("folder %d/%d: %s (%d/%d)", fi+1, len(folders), folder, done, total)
+			onProgress(p)
+		})
 		if err != nil {
 			if ctx.Err() != nil {
 				return totalNew, ctx.Err()
@@ -100,22 +111,95 @@ func SyncWithContext(ctx context.Context, acct model.EmailAccount, emailDir stri
 		totalNew += n
 	}
 
+	onProgress(Progress{
+		Message:      fmt.Sprintf("%d folders done", len(folders)),
+		FoldersDone:  len(folders),
+		FoldersTotal: len(folders),
+	})
 	log.Printf("IMAP: %s downloaded %d new messages", acct.Email, totalNew)
 	return totalNew, nil
 }
 
+// connect dials the account's IMAP server and logs in. Callers must logout.
+func connect(acct model.EmailAccount) (*imapClient, error) {
+	addr := net.JoinHostPort(acct.Host, fmt.Sprintf("%d", acct.Port))
+	log.Printf("IMAP: connecting to %s as %s", addr, acct.Email)
+
+	connectTimeout, ioTimeout := accountTimeouts(acct)
+	dialer := &net.Dialer{Timeout: connectTimeout}
+	var conn net.Conn
+	var err error
+	if acct.SSL {
+		var tlsCfg *tls.Config
+		tlsCfg, err = mailtls.Config(acct)
+		if err != nil {
+			return nil, fmt.Errorf("tls config: %w", err)
+		}
+		conn, err = tls.DialWithDialer(dialer, "tcp", addr, tlsCfg)
+	} else {
+		conn, err = dialer.Dial("tcp", addr)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("connect %s: %w", addr, err)
+	}
+
+	client, err := newIMAPClient(conn, ioTimeout)
+	if err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("imap init: %w", err)
+	}
+	if err := client.login(acct.Email, acct.Password); err != nil {
+		client.logout()
+		return nil, fmt.Errorf("imap login: %w", err)
+	}
+	return client, nil
+}
+
+// Append uploads a raw RFC 822 message to folder on the account's server,
+// e.g. to file a sent reply under "Sent". flags such as `\Seen` are set on
+// the new message. This is the only call that writes to the server; it
+// never modifies or deletes existing messages.
+func Append(ctx context.Context, acct model.EmailAccount, folder string, flags []string, raw []byte) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	client, err := connect(acct)
+	if err != nil {
+		return err
+	}
+	defer client.logout()
+
+	// Unblock the literal upload if ctx is cancelled mid-way.
+	stop := context.AfterFunc(ctx, func() { client.conn.SetDeadline(time.Now()) })
+	defer stop()
+
+	if err := client.append(folder, flags, raw); err != nil {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		return fmt.Errorf("append to %q: %w", folder, err)
+	}
+	log.Printf("IMAP: appended %d bytes to %s/%s", len(raw), acct.Email, folder)
+	return nil
+}
+
 const fetchBatchSize = 50
 
-func syncFolderWithContext(ctx context.Context, client *imapClient, acct model.EmailAccount, folder, emailDir string, state SyncState, saveFn SaveEmailFunc) (int, error) {
+// syncFolderWithContext downloads new messages in folder, calling onBatch
+// with (processed, new) after each fetch batch.
+func syncFolderWithContext(ctx context.Context, client *imapClient, acct model.EmailAccount, folder, emailDir string, state SyncState, saveFn SaveEmailFunc, onBatch func(done, total int)) (int, error) {
 	folderPath := imapFolderToPath(folder)
 	dir := filepath.Join(emailDir, folderPath)
 	if saveFn == nil {
+		if err := migrateLegacyFolderDir(emailDir, folder); err != nil {
+			return 0, fmt.Errorf("move legacy folder directory: %w", err)
+		}
 		if err := os.MkdirAll(dir, 0o755); err != nil {
 			return 0, err
 		}
 	}
 
-	uids, err := client.selectAndSearch(folder)
+	uids, err := client.selectAndSearch(folder, SearchCriteria{Since: acct.SyncSince})
 	if err != nil {
 		return 0, err
 	}
@@ -133,6 +217,7 @@ func syncFolderWithContext(ctx context.Context, client *imapClient, acct model.E
 	}
 
 	log.Printf("IMAP: folder %q: %d new of %d total", folder, len(newUIDs), len(uids))
+	onBatch(0, len(newUIDs))
 
 	newCount := 0
 	// Fetch in batches (like Python's IMAPClient batch of 100).
@@ -150,10 +235,24 @@ func syncFolderWithContext(ctx context.Context, client *imapClient, acct model.E
 		batch := newUIDs[i:end]
 
 		messages, err := client.fetchBatch(batch)
+		for uid, item := range messages {
+			raw, loadErr := item.load()
+			item.discard()
+			if loadErr != nil {
+				log.Printf("WARN: fetch UID %d: %v", uid, loadErr)
+				continue
+			}
+			if saveEmail(dir, uid, raw, acct.ID, folder, state, saveFn) {
+				newCount++
+			}
+		}
 		if err != nil {
 			log.Printf("WARN: batch fetch in %q: %v", folder, err)
-			// Fall back to one-by-one for this batch.
+			// Fall back to one-by-one for what the batch did not return.
 			for _, uid := range batch {
+				if _, ok := messages[uid]; ok {
+					continue
+				}
 				raw, err := client.fetch(uid)
 				if err != nil {
 					log.Printf("WARN: fetch UID %d: %v", uid, err)
@@ -163,14 +262,8 @@ func syncFolderWithContext(ctx context.Context, client *imapClient, acct model.E
 					newCount++
 				}
 			}
-			continue
-		}
-
-		for uid, raw := range messages {
-			if saveEmail(dir, uid, raw, acct.ID, folder, state, saveFn) {
-				newCount++
-			}
 		}
+		onBatch(end, len(newUIDs))
 	}
 
 	return newCount, nil
@@ -180,7 +273,7 @@ func saveEmail(dir string, uid int, raw []byte, accountID, folder string, state
 	if len(raw) == 0 {
 		return false
 	}
-	checksum := contentChecksum(raw)
+	checksum := ContentChecksum(raw)
 	filename := fmt.Sprintf("%s-%d.eml", checksum, uid)
 	path := filepath.Join(dir, filename)
 
@@ -201,10 +294,10 @@ func saveEmail(dir string, uid int, raw []byte, accountID, folder string, state
 	return true
 }
 
-// contentChecksum returns the first 16 hex chars of SHA-256.
-func contentChecksum(data []byte) string {
-	h := sha256.Sum256(data)
-	return fmt.Sprintf("%x", h[:8])
+// ContentChecksum returns the checksum prefix used in stored filenames
+// ({checksum}-{uid}.eml); see package checksum.
+func ContentChecksum(data []byte) string {
+	return checksum.Sum(data)
 }
 
 // setFileMtime sets the file's modification time from the email Date header.
@@ -214,10 +307,7 @@ func setFileMtime(path string, raw []byte) {
 	if err != nil {
 		return
 	}
-	date, _ := msg.Header.Date()
-	if date.IsZero() {
-		date = parseDateFuzzy(msg.Header.Get("Date"))
-	}
+	date := eml.ParseDate(msg.Header.Get("Date"))
 	if date.IsZero() {
 		date = parseReceivedDate(msg.Header)
 	}
@@ -227,30 +317,6 @@ func setFileMtime(path string, raw []byte) {
 	os.Chtimes(path, date, date)
 }
 
-// parseDateFuzzy tries multiple date layouts for non-standard Date headers.
-func parseDateFuzzy(raw string) time.Time {
-	raw = strings.TrimSpace(raw)
-	if raw == "" {
-		return time.Time{}
-	}
-	for _, layout := range []string{
-		time.RFC1123Z,
-		time.RFC1123,
-		"Mon, 2 Jan 2006 15:04:05 -0700 (MST)",
-		"Mon, 2 Jan 2006 15:04:05 -0700",
-		"Mon, 2 Jan 2006 15:04:05",
-		"2 Jan 2006 15:04:05 -0700",
-		"2 Jan 2006 15:04:05",
-		time.RFC822Z,
-		time.RFC822,
-	} {
-		if t, err := time.Parse(layout, raw); err == nil {
-			return t
-		}
-	}
-	return time.Time{}
-}
-
 // parseReceivedDate extracts the date from the first Received header.
 func parseReceivedDate(h mail.Header) time.Time {
 	received := h.Get("Received")
@@ -261,21 +327,7 @@ func parseReceivedDate(h mail.Header) time.Time {
 	if idx < 0 {
 		return time.Time{}
 	}
-	dateStr := strings.TrimSpace(received[idx+1:])
-	for _, layout := range []string{
-		time.RFC1123Z,
-		time.RFC1123,
-		"Mon, 2 Jan 2006 15:04:05 -0700 (MST)",
-		"Mon, 2 Jan 2006 15:04:05 -0700",
-		"2 Jan 2006 15:04:05 -0700",
-		time.RFC822Z,
-		time.RFC822,
-	} {
-		if t, err := time.Parse(layout, dateStr); err == nil {
-			return t
-		}
-	}
-	return time.Time{}
+	return eml.ParseDate(received[idx+1:])
 }
 
 // --- IMAP folder name to filesystem path mapping ---
@@ -304,7 +356,7 @@ var imapFolderMap = map[string]string{
 	"[gmail]/wichtig":          "gmail/important",
 }
 
-var reSlugUnsafe = regexp.MustCompile(`[^\w\s\-.]`)
+var reSlugUnsafe = regexp.MustCompile(`[^\pL\pN_\s\-.]`)
 var reSlugSep = regexp.MustCompile(`[.\s_\-]+`)
 
 func slugifyPart(name string) string {
@@ -317,13 +369,75 @@ func slugifyPart(name string) string {
 	if name == "" {
 		return "other"
 	}
-	if len(name) > 40 {
-		name = name[:40]
+	if r := []rune(name); len(r) > 40 {
+		name = string(r[:40])
 	}
 	return name
 }
 
+// imapFolderToPath maps a folder name as the server lists it, in modified
+// UTF-7, to the directory its mail is stored in: well-known folders to
+// fixed names, others to their decoded name slugified part by part.
 func imapFolderToPath(folderName string) string {
+	return folderNameToPath(decodeModifiedUTF7(folderName))
+}
+
+// legacyFolderPath is the directory a folder's mail was stored in before
+// imapFolderToPath decoded modified UTF-7: the encoded name slugified, so
+// "Entw&APw-rfe" was "entwapw_rfe".
+func legacyFolderPath(folderName string) string {
+	return folderNameToPath(folderName)
+}
+
+// migrateLegacyFolderDir moves the mail of folder from its legacy
+// directory (see legacyFolderPath) under emailDir to its current one, once,
+// so a folder with a non-ASCII name is not split across two directories.
+// The directory is renamed when the current one does not exist yet;
+// otherwise its files are moved over one by one, dropping those already
+// there, and it is removed once empty. Subdirectories, the mail of subfolders, are left to their own
+// folder's migration.
+func migrateLegacyFolderDir(emailDir, folder string) error {
+	legacy, current := legacyFolderPath(folder), imapFolderToPath(folder)
+	if legacy == current {
+		return nil
+	}
+	from, to := filepath.Join(emailDir, legacy), filepath.Join(emailDir, current)
+	entries, err := os.ReadDir(from)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if _, err := os.Stat(to); errors.Is(err, os.ErrNotExist) {
+		if err := os.MkdirAll(filepath.Dir(to), 0o755); err != nil {
+			return err
+		}
+		log.Printf("IMAP: folder %q: moving %s to %s", folder, legacy, current)
+		return os.Rename(from, to)
+	}
+	for _, e := range entries {
+		if e.IsDir() {
+			continue
+		}
+		src, dst := filepath.Join(from, e.Name()), filepath.Join(to, e.Name())
+		if _, err := os.Lstat(dst); err == nil {
+			// The same message, saved again in the current directory.
+			if err := os.Remove(src); err != nil {
+				return err
+			}
+			continue
+		}
+		if err := os.Rename(src, dst); err != nil {
+			return err
+		}
+	}
+	os.Remove(from) // fails, as it should, while anything is left
+	return nil
+}
+
+// folderNameToPath is imapFolderToPath for a decoded name.
+func folderNameToPath(folderName string) string {
 	key := strings.TrimSpace(strings.ToLower(folderName))
 	if mapped, ok := imapFolderMap[key]; ok {
 		return mapped
@@ -350,13 +464,17 @@ func imapFolderToPath(folderName string) string {
 // Uses UID commands (stable across sessions) and proper literal parsing.
 
 type imapClient struct {
-	conn net.Conn
-	buf  []byte // read buffer
-	tag  int
+	conn      net.Conn
+	buf       []byte // read buffer
+	tag       int
+	ioTimeout time.Duration // max wait for each read from the server
 }
 
-func newIMAPClient(conn net.Conn) (*imapClient, error) {
-	c := &imapClient{conn: conn, buf: make([]byte, 0, 8192)}
+func newIMAPClient(conn net.Conn, ioTimeout time.Duration) (*imapClient, error) {
+	if ioTimeout <= 0 {
+		ioTimeout = defaultIOTimeout
+	}
+	c := &imapClient{conn: conn, buf: make([]byte, 0, 8192), ioTimeout: ioTimeout}
 	// Read server greeting.
 	if _, err := c.readLine(); err != nil {
 		return nil, err
@@ -367,12 +485,35 @@ func newIMAPClient(conn net.Conn) (*imapClient, error) {
 func (c *imapClient) command(format string, args ...any) ([]string, error) {
 	c.tag++
 	tag := fmt.Sprintf("A%04d", c.tag)
-	cmd := fmt.Sprintf("%s %s\r\n", tag, fmt.Sprintf(format, args...))
-	if _, err := c.conn.Write([]byte(cmd)); err != nil {
+	chunks, err := splitLiterals(fmt.Sprintf("%s %s", tag, fmt.Sprintf(format, args...)))
+	if err != nil {
 		return nil, err
 	}
 
 	var lines []string
+	for i, chunk := range chunks {
+		if _, err := c.conn.Write([]byte(chunk)); err != nil {
+			return lines, err
+		}
+		if i == len(chunks)-1 {
+			break
+		}
+		// Wait for the server to ask for the literal.
+		for {
+			line, err := c.readLine()
+			if err != nil {
+				return lines, err
+			}
+			if strings.HasPrefix(line, "+") {
+				break
+			}
+			if strings.HasPrefix(line, tag+" ") {
+				return lines, fmt.Errorf("IMAP error: %s", line)
+			}
+			lines = append(lines, line)
+		}
+	}
+
 	for {
 		line, err := c.readLine()
 		if err != nil {
@@ -398,7 +539,7 @@ func (c *imapClient) readLine() (string, error) {
 			return strings.TrimRight(line, "\r"), nil
 		}
 		// Read more data into buffer.
-		c.conn.SetReadDeadline(time.Now().Add(120 * time.Second))
+		c.conn.SetReadDeadline(time.Now().Add(c.ioTimeout))
 		tmp := make([]byte, 8192)
 		n, err := c.conn.Read(tmp)
 		if n > 0 {
@@ -419,7 +560,7 @@ func (c *imapClient) readLine() (string, error) {
 // readExact reads exactly n bytes from the connection (for IMAP literals).
 func (c *imapClient) readExact(n int) ([]byte, error) {
 	for len(c.buf) < n {
-		c.conn.SetReadDeadline(time.Now().Add(120 * time.Second))
+		c.conn.SetReadDeadline(time.Now().Add(c.ioTimeout))
 		tmp := make([]byte, 8192)
 		nr, err := c.conn.Read(tmp)
 		if nr > 0 {
@@ -435,6 +576,48 @@ func (c *imapClient) readExact(n int) ([]byte, error) {
 	return data, nil
 }
 
+// readLiteralTo copies exactly n bytes from the connection to w, without
+// holding more than one read of them in memory.
+func (c *imapClient) readLiteralTo(w io.Writer, n int) error {
+	if len(c.buf) > 0 {
+		k := min(n, len(c.buf))
+		if _, err := w.Write(c.buf[:k]); err != nil {
+			return err
+		}
+		c.buf = c.buf[k:]
+		n -= k
+	}
+	tmp := make([]byte, 64*1024)
+	for n > 0 {
+		c.conn.SetReadDeadline(time.Now().Add(c.ioTimeout))
+		nr, err := c.conn.Read(tmp[:min(n, len(tmp))])
+		if nr > 0 {
+			if _, werr := w.Write(tmp[:nr]); werr != nil {
+				return werr
+			}
+			n -= nr
+		}
+		if err != nil && n > 0 {
+			return err
+		}
+	}
+	return nil
+}
+
+// skipToTag reads and drops lines up to the tagged response ending the
+// command tagged tag, so the connection is in step for the next command.
+func (c *imapClient) skipToTag(tag string) error {
+	for {
+		line, err := c.readLine()
+		if err != nil {
+			return err
+		}
+		if strings.HasPrefix(line, tag+" ") {
+			return nil
+		}
+	}
+}
+
 func indexOf(b []byte, c byte) int {
 	for i, v := range b {
 		if v == c {
@@ -449,6 +632,133 @@ func (c *imapClient) login(user, password string) error {
 	return err
 }
 
+// append issues APPEND with a synchronizing literal: it sends the size,
+// waits for the server's "+" continuation, then sends the message.
+func (c *imapClient) append(folder string, flags []string, raw []byte) error {
+	msg := toCRLF(raw)
+
+	c.tag++
+	tag := fmt.Sprintf("A%04d", c.tag)
+	var flagList string
+	if len(flags) > 0 {
+		flagList = "(" + strings.Join(flags, " ") + ") "
+	}
+	cmd := fmt.Sprintf("%s APPEND %s %s{%d}\r\n", tag, quoteString(folder), flagList, len(msg))
+	if _, err := c.conn.Write([]byte(cmd)); err != nil {
+		return err
+	}
+
+	for {
+		line, err := c.readLine()
+		if err != nil {
+			return err
+		}
+		if strings.HasPrefix(line, "+") {
+			break
+		}
+		if strings.HasPrefix(line, tag+" ") {
+			// Rejected before the literal, e.g. NO [TRYCREATE] for a missing folder.
+			return fmt.Errorf("IMAP error: %s", line)
+		}
+	}
+
+	if _, err := c.conn.Write(append(msg, '\r', '\n')); err != nil {
+		return err
+	}
+	for {
+		line, err := c.readLine()
+		if err != nil {
+			return err
+		}
+		if strings.HasPrefix(line, tag+" ") {
+			if strings.HasPrefix(line, tag+" OK") {
+				return nil
+			}
+			return fmt.Errorf("IMAP error: %s", line)
+		}
+	}
+}
+
+// toCRLF converts bare LF line endings to CRLF, as IMAP literals require.
+func toCRLF(raw []byte) []byte {
+	out := make([]byte, 0, len(raw)+len(raw)/40)
+	for i, b := range raw {
+		if b == '\n' && (i == 0 || raw[i-1] != '\r') {
+			out = append(out, '\r')
+		}
+		out = append(out, b)
+	}
+	return out
+}
+
+// ErrLineBreak is returned for text with CR, LF or NUL, which no IMAP
+// string can carry: sent as is, a line break would end the command and
+// start another.
+var ErrLineBreak = errors.New("IMAP text must not contain CR, LF or NUL")
+
+// CheckText returns ErrLineBreak if s cannot be sent as an IMAP string.
+func CheckText(s string) error {
+	if strings.ContainsAny(s, "\r\n\x00") {
+		return ErrLineBreak
+	}
+	return nil
+}
+
+// splitLiterals splits a command (without its final CRLF) after each
+// literal's "{size}\r\n" (see literal) and ends it with CRLF; every chunk
+// but the last waits for the server's "+" before the next is sent. Any
+// other line break is refused with ErrLineBreak.
+func splitLiterals(cmd string) ([]string, error) {
+	var chunks []string
+	start, pos := 0, 0
+	for {
+		i := strings.Index(cmd[pos:], "\r\n")
+		if i < 0 {
+			break
+		}
+		i += pos
+		line := cmd[start:i]
+		open := strings.LastIndexByte(line, '{')
+		var size int
+		if open < 0 || !strings.HasSuffix(line, "}") || strings.ContainsAny(line, "\r\n") {
+			return nil, ErrLineBreak
+		}
+		if _, err := fmt.Sscanf(line[open:], "{%d}", &size); err != nil || size < 0 || i+2+size > len(cmd) {
+			return nil, ErrLineBreak
+		}
+		chunks = append(chunks, cmd[start:i+2])
+		start, pos = i+2, i+2+size
+	}
+	if strings.ContainsAny(cmd[pos:], "\r\n") || strings.ContainsRune(cmd, 0) {
+		return nil, ErrLineBreak
+	}
+	return append(chunks, cmd[start:]+"\r\n"), nil
+}
+
+// literal renders s as an IMAP synchronizing literal (RFC 3501 section
+// 4.3); command sends it once the server asks for it.
+func literal(s string) string {
+	return fmt.Sprintf("{%d}\r\n%s", len(s), s)
+}
+
+// astring renders s as a quoted string, or as a literal when it holds
+// 8-bit characters, which quoted strings may not.
+func astring(s string) string {
+	for i := 0; i < len(s); i++ {
+		if s[i] >= 0x80 {
+			return literal(s)
+		}
+	}
+	return quoteString(s)
+}
+
+// quoteString renders s as an IMAP quoted string.
+func quoteString(s string) string {
+	s = strings.ReplaceAll(s, `\`, `\\`)
+	s = strings.ReplaceAll(s, `"`, `\"`)
+	return `"` + s + `"`
+}
+
 func (c *imapClient) logout() {
 	c.command("LOGOUT")
 	c.conn.Close()
@@ -458,34 +768,27 @@ func (c *imapClient) listFolders(foldersCfg string) ([]string, error) {
 	if foldersCfg != "all" {
 		return strings.Split(foldersCfg, ","), nil
 	}
+	listed, err := c.list()
+	if err != nil {
+		return nil, err
+	}
+	folders := make([]string, len(listed))
+	for i, f := range listed {
+		folders[i] = f.Name
+	}
+	return folders, nil
+}
+
+// list runs LIST "" "*" and returns the selectable folders in server order.
+func (c *imapClient) list() ([]Folder, error) {
 	lines, err := c.command(`LIST "" "*"`)
 	if err != nil {
 		return nil, err
 	}
-	var folders []string
+	var folders []Folder
 	for _, line := range lines {
-		// Parse: * LIST (\flags) "." "FolderName"
-		if strings.Contains(strings.ToLower(line), "\\noselect") {
-			continue
-		}
-		// Extract folder name (last quoted string or last word).
-		parts := strings.SplitN(line, ") ", 2)
-		if len(parts) < 2 {
-			continue
-		}
-		rest := parts[1]
-		// Skip delimiter, get folder name.
-		if idx := strings.LastIndex(rest, `"`); idx > 0 {
-			start := strings.LastIndex(rest[:idx], `"`)
-			if start >= 0 {
-				folders = append(folders, rest[start+1:idx])
-				continue
-			}
-		}
-		// Fallback: last space-separated token.
-		tokens := strings.Fields(rest)
-		if len(tokens) > 0 {
-			folders = append(folders, tokens[len(tokens)-1])
+		if f, ok := parseListLine(line); ok {
+			folders = append(folders, f)
 		}
 	}
 	return folders, nil
@@ -493,45 +796,74 @@ func (c *imapClient) listFolders(foldersCfg string) ([]string, error) {
 
 // selectAndSearch uses UID SEARCH to get stable UIDs (like Python's IMAPClient).
 // Sequence numbers change between sessions; UIDs are persistent.
-func (c *imapClient) selectAndSearch(folder string) ([]int, error) {
+func (c *imapClient) selectAndSearch(folder string, criteria SearchCriteria) ([]int, error) {
 	_, err := c.command(`SELECT "%s"`, folder)
 	if err != nil {
 		return nil, err
 	}
-	lines, err := c.command("UID SEARCH ALL")
-	if err != nil {
-		return nil, err
-	}
-	var uids []int
-	for _, line := range lines {
-		if !strings.HasPrefix(line, "* SEARCH") {
-			continue
-		}
-		for _, s := range strings.Fields(line)[2:] {
-			var uid int
-			if _, err := fmt.Sscanf(s, "%d", &uid); err == nil {
-				uids = append(uids, uid)
-			}
-		}
-	}
-	return uids, nil
+	return c.search(criteria)
 }
 
 // fetch retrieves a single email by UID.
 func (c *imapClient) fetch(uid int) ([]byte, error) {
 	result, err := c.fetchBatch([]int{uid})
+	for _, item := range result {
+		defer item.discard()
+	}
 	if err != nil {
 		return nil, err
 	}
-	if raw, ok := result[uid]; ok {
-		return raw, nil
+	if item, ok := result[uid]; ok {
+		return item.load()
 	}
 	return nil, fmt.Errorf("UID %d not in FETCH response", uid)
 }
 
 // fetchBatch retrieves multiple emails in one UID FETCH command.
-// Returns map[uid]rawBytes. Matches Python's `client.fetch(batch, ["RFC822"])`.
-func (c *imapClient) fetchBatch(uids []int) (map[int][]byte, error) {
+// Matches Python's `client.fetch(batch, ["RFC822"])`. On error the
+// messages read before it are returned with it; callers must discard
+// every item returned.
+func (c *imapClient) fetchBatch(uids []int) (map[int]fetchedItem, error) {
+	return c.fetchItems(uids, "RFC822")
+}
+
+// spoolLiteralBytes is the literal size above which fetchItems writes a
+// message to a temporary file instead of memory, so a batch holding a
+// huge message does not hold it alongside the rest. A var for tests.
+var spoolLiteralBytes = 8 << 20
+
+// errLiteralMismatch is returned when a FETCH response does not continue
+// where its literal's size said it would, so the size was wrong.
+var errLiteralMismatch = errors.New("literal size does not match the response")
+
+// fetchedItem is one message of a fetchItems response: the literal the
+// items returned (the whole message or its header), in data or, above
+// spoolLiteralBytes, in the temporary file spool; and, when requested,
+// RFC822.SIZE.
+type fetchedItem struct {
+	data  []byte
+	spool string
+	size  int64
+}
+
+// load returns the literal, reading it back from its spool file.
+func (f fetchedItem) load() ([]byte, error) {
+	if f.spool == "" {
+		return f.data, nil
+	}
+	return os.ReadFile(f.spool)
+}
+
+// discard removes the spool file, if any.
+func (f fetchedItem) discard() {
+	if f.spool != "" {
+		os.Remove(f.spool)
+	}
+}
+
+// fetchItems runs UID FETCH with items for uids. items must return one
+// literal per message, such as RFC822 or "(RFC822.SIZE BODY.PEEK[HEADER])".
+func (c *imapClient) fetchItems(uids []int, items string) (map[int]fetchedItem, error) {
 	if len(uids) == 0 {
 		return nil, nil
 	}
@@ -545,12 +877,12 @@ func (c *imapClient) fetchBatch(uids []int) (map[int][]byte, error) {
 
 	c.tag++
 	tag := fmt.Sprintf("A%04d", c.tag)
-	cmd := fmt.Sprintf("%s UID FETCH %s RFC822\r\n", tag, uidSet)
+	cmd := fmt.Sprintf("%s UID FETCH %s %s\r\n", tag, uidSet, items)
 	if _, err := c.conn.Write([]byte(cmd)); err != nil {
 		return nil, err
 	}
 
-	result := make(map[int][]byte)
+	result := make(map[int]fetchedItem)
 	for {
 		line, err := c.readLine()
 		if err != nil {
@@ -573,10 +905,8 @@ func (c *imapClient) fetchBatch(uids []int) (map[int][]byte, error) {
 		// Extract UID from the response line.
 		// Format: * <seq> FETCH (UID <uid> RFC822 {<size>})
 		// or:     * <seq> FETCH (RFC822 {<size>} UID <uid>)
-		msgUID := 0
-		if idx := strings.Index(strings.ToUpper(line), "UID "); idx >= 0 {
-			fmt.Sscanf(line[idx+4:], "%d", &msgUID)
-		}
+		msgUID := fetchNumber(line, "UID ")
+		msgSize := fetchNumber(line, "RFC822.SIZE ")
 
 		// Extract literal size.
 		braceStart := strings.LastIndex(line, "{")
@@ -590,7 +920,7 @@ func (c *imapClient) fetchBatch(uids []int) (map[int][]byte, error) {
 		}
 
 		// Read exactly `size` bytes of literal data.
-		rawData, err := c.readExact(size)
+		item, err := c.readLiteral(size)
 		if err != nil {
 			return result, fmt.Errorf("fetchBatch literal UID %d: %w", msgUID, err)
 		}
@@ -599,16 +929,80 @@ func (c *imapClient) fetchBatch(uids []int) (map[int][]byte, error) {
 		// If UID wasn't in the pre-literal line, look for it here.
 		trailing, trailErr := c.readLine()
 		if trailErr != nil {
+			item.discard()
 			return result, fmt.Errorf("fetchBatch trailing: %w", trailErr)
 		}
-		if msgUID == 0 {
-			if idx := strings.Index(strings.ToUpper(trailing), "UID "); idx >= 0 {
-				fmt.Sscanf(trailing[idx+4:], "%d", &msgUID)
+		if !isFetchTail(trailing) {
+			// The literal ended inside the message or past it: drop it and
+			// skip the rest of the response rather than parse message text
+			// as protocol. The caller fetches what is missing again.
+			item.discard()
+			log.Printf("WARN: IMAP FETCH UID %d: {%d} literal followed by %.40q; resyncing", msgUID, size, trailing)
+			if err := c.skipToTag(tag); err != nil {
+				return result, fmt.Errorf("fetchBatch resync: %w", err)
 			}
+			return result, fmt.Errorf("fetchBatch UID %d: %w", msgUID, errLiteralMismatch)
+		}
+		if msgUID == 0 {
+			msgUID = fetchNumber(trailing, "UID ")
+		}
+		if msgSize == 0 {
+			msgSize = fetchNumber(trailing, "RFC822.SIZE ")
 		}
 
 		if msgUID > 0 {
-			result[msgUID] = rawData
+			item.size = int64(msgSize)
+			result[msgUID] = item
+		} else {
+			item.discard()
 		}
 	}
 }
+
+// readLiteral reads a literal of size bytes, spooling it to a temporary
+// file when it is larger than spoolLiteralBytes.
+func (c *imapClient) readLiteral(size int) (fetchedItem, error) {
+	if size <= spoolLiteralBytes {
+		data, err := c.readExact(size)
+		return fetchedItem{data: data}, err
+	}
+	f, err := os.CreateTemp("", "mails-imap-*.eml")
+	if err != nil {
+		return fetchedItem{}, err
+	}
+	err = c.readLiteralTo(f, size)
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		os.Remove(f.Name())
+		return fetchedItem{}, err
+	}
+	return fetchedItem{spool: f.Name()}, nil
+}
+
+// isFetchTail reports whether line, read right after a literal, is the
+// rest of a FETCH response (")" or " UID 123)"), as it is when the
+// literal's size was right.
+func isFetchTail(line string) bool {
+	return strings.HasSuffix(line, ")") && (strings.HasPrefix(line, ")") || strings.HasPrefix(line, " "))
+}
+
+// fetchNumber returns the number following key (e.g. "UID ") in a FETCH
+// response line, or 0. "UID " does not match inside "RFC822.SIZE ".
+func fetchNumber(line, key string) int {
+	upper := strings.ToUpper(line)
+	for from := 0; ; {
+		idx := strings.Index(upper[from:], key)
+		if idx < 0 {
+			return 0
+		}
+		idx += from
+		if idx == 0 || upper[idx-1] == ' ' || upper[idx-1] == '(' {
+			var n int
+			fmt.Sscanf(line[idx+len(key):], "%d", &n)
+			return n
+		}
+		from = idx + len(key)
+	}
+}
@@ -0,0 +1,164 @@
+package imap
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/eslider/mails/internal/model"
+	"github.com/eslider/mails/internal/search/eml"
+)
+
+// SearchCriteria narrows a server-side SEARCH. Zero fields are ignored, so
+// the zero value matches every message. Text fields are case-insensitive
+// substring matches, as defined by the server.
+type SearchCriteria struct {
+	Since   time.Time // internal date on or after this day
+	Before  time.Time // internal date before this day
+	From    string
+	Subject string
+	Body    string
+}
+
+// keys renders c as IMAP SEARCH keys (RFC 3501 section 6.4.4), such as
+// `SINCE 1-Feb-2024 FROM "billing"`. Non-ASCII text is announced with
+// CHARSET UTF-8 and sent as a literal.
+func (c SearchCriteria) keys() string {
+	var keys []string
+	if !c.Since.IsZero() {
+		keys = append(keys, "SINCE "+c.Since.Format("2-Jan-2006"))
+	}
+	if !c.Before.IsZero() {
+		keys = append(keys, "BEFORE "+c.Before.Format("2-Jan-2006"))
+	}
+	utf8 := false
+	for _, kv := range []struct{ key, value string }{
+		{"FROM", c.From},
+		{"SUBJECT", c.Subject},
+		{"BODY", c.Body},
+	} {
+		v := strings.TrimSpace(kv.value)
+		if v == "" {
+			continue
+		}
+		keys = append(keys, kv.key+" "+astring(v))
+		utf8 = utf8 || strings.IndexFunc(v, func(r rune) bool { return r > unicode.MaxASCII }) >= 0
+	}
+	if len(keys) == 0 {
+		return "ALL"
+	}
+	if utf8 {
+		return "CHARSET UTF-8 " + strings.Join(keys, " ")
+	}
+	return strings.Join(keys, " ")
+}
+
+// Check returns ErrLineBreak if a text field holds CR, LF or NUL.
+func (c SearchCriteria) Check() error {
+	for _, v := range []string{c.From, c.Subject, c.Body} {
+		if err := CheckText(v); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// search runs UID SEARCH in the selected folder and returns matching UIDs.
+func (c *imapClient) search(criteria SearchCriteria) ([]int, error) {
+	lines, err := c.command("UID SEARCH %s", criteria.keys())
+	if err != nil {
+		return nil, err
+	}
+	var uids []int
+	for _, line := range lines {
+		if !strings.HasPrefix(line, "* SEARCH") {
+			continue
+		}
+		for _, s := range strings.Fields(line)[2:] {
+			var uid int
+			if _, err := fmt.Sscanf(s, "%d", &uid); err == nil {
+				uids = append(uids, uid)
+			}
+		}
+	}
+	return uids, nil
+}
+
+// Message summarises a message found by Search, from its headers only.
+type Message struct {
+	UID       int       `json:"uid"`
+	Subject   string    `json:"subject"`
+	From      string    `json:"from"`
+	To        string    `json:"to"`
+	Date      time.Time `json:"date,omitzero"`
+	MessageID string    `json:"message_id,omitempty"`
+	Size      int64     `json:"size"` // RFC822.SIZE of the whole message
+}
+
+// Search runs criteria against folder on the account's server, without
+// syncing or indexing anything. It returns header summaries of the newest
+// limit matches (highest UIDs first) and the total number of matches.
+// The folder is opened read-only and headers are fetched with BODY.PEEK,
+// so flags such as \Seen are left untouched.
+func Search(ctx context.Context, acct model.EmailAccount, folder string, criteria SearchCriteria, limit int) ([]Message, int, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, 0, err
+	}
+	if err := errors.Join(CheckText(folder), criteria.Check()); err != nil {
+		return nil, 0, err
+	}
+	client, err := connect(acct)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer client.logout()
+
+	stop := context.AfterFunc(ctx, func() { client.conn.SetDeadline(time.Now()) })
+	defer stop()
+	fail := func(what string, err error) ([]Message, int, error) {
+		if ctx.Err() != nil {
+			return nil, 0, ctx.Err()
+		}
+		return nil, 0, fmt.Errorf("%s: %w", what, err)
+	}
+
+	if _, err := client.command("EXAMINE %s", astring(folder)); err != nil {
+		return fail(fmt.Sprintf("examine %q", folder), err)
+	}
+	uids, err := client.search(criteria)
+	if err != nil {
+		return fail("search", err)
+	}
+	total := len(uids)
+	sort.Sort(sort.Reverse(sort.IntSlice(uids)))
+	if limit > 0 && len(uids) > limit {
+		uids = uids[:limit]
+	}
+
+	fetched, err := client.fetchItems(uids, "(RFC822.SIZE BODY.PEEK[HEADER])")
+	if err != nil {
+		for _, f := range fetched {
+			f.discard()
+		}
+		return fail("fetch headers", err)
+	}
+	msgs := make([]Message, 0, len(uids))
+	for _, uid := range uids {
+		f, ok := fetched[uid]
+		if !ok {
+			continue
+		}
+		m := Message{UID: uid, Size: f.size}
+		data, err := f.load()
+		f.discard()
+		if e, perr := eml.ParseBytes("", data); err == nil && perr == nil {
+			m.Subject, m.From, m.To, m.Date, m.MessageID = e.Subject, e.From, e.To, e.Date, e.MessageID
+		}
+		msgs = append(msgs, m)
+	}
+	return msgs, total, nil
+}
@@ -0,0 +1,107 @@
+package imap
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/eslider/mails/internal/model"
+)
+
+func TestSearchCriteriaKeys(t *testing.T) {
+	tests := []struct {
+		criteria SearchCriteria
+		want     string
+	}{
+		{SearchCriteria{}, "ALL"},
+		{SearchCriteria{From: "  "}, "ALL"},
+		{
+			SearchCriteria{Since: time.Date(2024, 2, 1, 0, 0, 0, 0, time.UTC), From: "billing", Subject: `say "hi"`},
+			`SINCE 1-Feb-2024 FROM "billing" SUBJECT "say \"hi\""`,
+		},
+		{
+			SearchCriteria{Before: time.Date(2024, 12, 25, 0, 0, 0, 0, time.UTC), Body: "Grüße"},
+			"CHARSET UTF-8 BEFORE 25-Dec-2024 BODY {7}\r\nGrüße",
+		},
+	}
+	for _, tt := range tests {
+		if got := tt.criteria.keys(); got != tt.want {
+			t.Errorf("keys(%+v) = %s, want %s", tt.criteria, got, tt.want)
+		}
+	}
+}
+
+func TestFetchNumber(t *testing.T) {
+	line := "* 3 FETCH (RFC822.SIZE 2048 UID 17 BODY[HEADER] {312}"
+	if got := fetchNumber(line, "UID "); got != 17 {
+		t.Errorf("UID = %d, want 17", got)
+	}
+	if got := fetchNumber(line, "RFC822.SIZE "); got != 2048 {
+		t.Errorf("RFC822.SIZE = %d, want 2048", got)
+	}
+	if got := fetchNumber("* 3 FETCH (FLAGS (\\Seen) {10}", "UID "); got != 0 {
+		t.Errorf("missing UID = %d, want 0", got)
+	}
+}
+
+// recordingServer is fakeServer that also returns the lines it read.
+func recordingServer(t *testing.T, reply func(tag, cmd string) string) (*imapClient, func() []string) {
+	var mu sync.Mutex
+	var got []string
+	c := fakeServer(t, func(tag, cmd string) string {
+		mu.Lock()
+		got = append(got, strings.TrimSpace(tag+" "+cmd))
+		mu.Unlock()
+		return reply(tag, cmd)
+	})
+	return c, func() []string {
+		mu.Lock()
+		defer mu.Unlock()
+		return append([]string(nil), got...)
+	}
+}
+
+func TestCommandRefusesLineBreaks(t *testing.T) {
+	c, lines := recordingServer(t, func(tag, cmd string) string { return tag + " OK done\r\n" })
+	for _, criteria := range []SearchCriteria{
+		{Subject: "x\r\nA0002 STORE 1:* +FLAGS (\\Deleted)"},
+		{From: "x\nEXPUNGE"},
+		{Body: "nul\x00"},
+	} {
+		if _, err := c.command("UID SEARCH %s", criteria.keys()); !errors.Is(err, ErrLineBreak) {
+			t.Errorf("%+v: err = %v, want ErrLineBreak", criteria, err)
+		}
+	}
+	if _, err := c.command("NOOP"); err != nil {
+		t.Fatal(err)
+	}
+	if got := lines(); len(got) != 1 || !strings.HasSuffix(got[0], " NOOP") {
+		t.Errorf("server read %q, want only the NOOP", got)
+	}
+
+	_, _, err := Search(context.Background(), model.EmailAccount{}, "INBOX\r\nA1 DELETE INBOX", SearchCriteria{}, 10)
+	if !errors.Is(err, ErrLineBreak) {
+		t.Errorf("Search with a CRLF folder: err = %v, want ErrLineBreak before connecting", err)
+	}
+}
+
+func TestCommandSendsLiterals(t *testing.T) {
+	var tag string
+	c, lines := recordingServer(t, func(t, cmd string) string {
+		if strings.HasSuffix(cmd, "}") {
+			tag = t
+			return "+ go ahead\r\n"
+		}
+		return tag + " OK SEARCH completed\r\n"
+	})
+	if _, err := c.command("UID SEARCH %s", SearchCriteria{Subject: "Grüße", From: "bob"}.keys()); err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"A0001 UID SEARCH CHARSET UTF-8 FROM \"bob\" SUBJECT {7}", "Grüße"}
+	if got := lines(); strings.Join(got, "|") != strings.Join(want, "|") {
+		t.Errorf("server read %q, want %q", got, want)
+	}
+}
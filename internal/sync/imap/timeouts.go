@@ -0,0 +1,44 @@
+package imap
+
+import (
+	"log"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/eslider/mails/internal/model"
+)
+
+// Defaults suit most servers: a dead host fails within half a minute, and
+// a large literal may stall for two minutes between reads.
+const (
+	defaultConnectTimeout = 30 * time.Second
+	defaultIOTimeout      = 120 * time.Second
+)
+
+// accountTimeouts returns the dial (including the TLS handshake) and
+// per-read timeouts for acct. The account's own settings win over
+// IMAP_CONNECT_TIMEOUT and IMAP_IO_TIMEOUT, which win over the defaults.
+func accountTimeouts(acct model.EmailAccount) (connect, io time.Duration) {
+	connect = durationSetting(acct.ConnectTimeout, "IMAP_CONNECT_TIMEOUT", defaultConnectTimeout)
+	io = durationSetting(acct.IOTimeout, "IMAP_IO_TIMEOUT", defaultIOTimeout)
+	return connect, io
+}
+
+// durationSetting parses the first non-empty of value and the env var as a
+// positive duration; anything unparseable falls back to def.
+func durationSetting(value, env string, def time.Duration) time.Duration {
+	src := "account"
+	if strings.TrimSpace(value) == "" {
+		value, src = os.Getenv(env), env
+	}
+	if value = strings.TrimSpace(value); value == "" {
+		return def
+	}
+	d, err := time.ParseDuration(value)
+	if err != nil || d <= 0 {
+		log.Printf("WARN: %s timeout %q invalid, using %s", src, value, def)
+		return def
+	}
+	return d
+}
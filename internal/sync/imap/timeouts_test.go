@@ -0,0 +1,50 @@
+package imap
+
+import (
+	"errors"
+	"net"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/eslider/mails/internal/model"
+)
+
+func TestAccountTimeouts(t *testing.T) {
+	t.Setenv("IMAP_CONNECT_TIMEOUT", "")
+	t.Setenv("IMAP_IO_TIMEOUT", "")
+	if c, io := accountTimeouts(model.EmailAccount{}); c != defaultConnectTimeout || io != defaultIOTimeout {
+		t.Errorf("defaults = %s, %s", c, io)
+	}
+
+	t.Setenv("IMAP_CONNECT_TIMEOUT", "5s")
+	t.Setenv("IMAP_IO_TIMEOUT", "bogus")
+	if c, io := accountTimeouts(model.EmailAccount{}); c != 5*time.Second || io != defaultIOTimeout {
+		t.Errorf("env = %s, %s; want 5s and the default", c, io)
+	}
+
+	acct := model.EmailAccount{ConnectTimeout: "2s", IOTimeout: "10m"}
+	if c, io := accountTimeouts(acct); c != 2*time.Second || io != 10*time.Minute {
+		t.Errorf("account override = %s, %s", c, io)
+	}
+}
+
+func TestReadLineHonoursIOTimeout(t *testing.T) {
+	server, conn := net.Pipe()
+	defer server.Close()
+	go server.Write([]byte("* OK ready\r\n"))
+
+	c, err := newIMAPClient(conn, 50*time.Millisecond)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	start := time.Now()
+	if _, err := c.readLine(); !errors.Is(err, os.ErrDeadlineExceeded) {
+		t.Fatalf("readLine on a silent server = %v, want deadline exceeded", err)
+	}
+	if elapsed := time.Since(start); elapsed > 2*time.Second {
+		t.Errorf("readLine waited %s", elapsed)
+	}
+}
@@ -0,0 +1,65 @@
+package imap
+
+import (
+	"encoding/base64"
+	"strings"
+	"unicode/utf16"
+	"unicode/utf8"
+)
+
+// modifiedBase64 is the base64 alphabet of modified UTF-7, with "," in
+// place of "/" and no padding.
+var modifiedBase64 = base64.NewEncoding("ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz0123456789+,").WithPadding(base64.NoPadding)
+
+// decodeModifiedUTF7 decodes a mailbox name from modified UTF-7 (RFC 3501
+// section 5.1.3), the encoding servers use for non-ASCII folder names:
+// "&" starts a run of modified base64 UTF-16 ended by "-", and "&-" is a
+// literal "&". "Entw&APw-rfe" becomes "Entwürfe". Runs that do not decode
+// are kept as they are, so a name that is not modified UTF-7 still maps
+// to a readable path. Only use the result for display and paths; commands
+// such as SELECT need the name as the server sent it.
+func decodeModifiedUTF7(name string) string {
+	if !strings.Contains(name, "&") {
+		return name
+	}
+	var b strings.Builder
+	for {
+		start := strings.IndexByte(name, '&')
+		if start < 0 {
+			b.WriteString(name)
+			return b.String()
+		}
+		b.WriteString(name[:start])
+		end := strings.IndexByte(name[start:], '-')
+		if end < 0 {
+			b.WriteString(name[start:])
+			return b.String()
+		}
+		run := name[start+1 : start+end]
+		if run == "" {
+			b.WriteByte('&')
+		} else if s, ok := decodeModifiedBase64(run); ok {
+			b.WriteString(s)
+		} else {
+			b.WriteString(name[start : start+end+1])
+		}
+		name = name[start+end+1:]
+	}
+}
+
+// decodeModifiedBase64 decodes one run of modified base64 UTF-16BE text.
+func decodeModifiedBase64(run string) (string, bool) {
+	raw, err := modifiedBase64.DecodeString(run)
+	if err != nil || len(raw)%2 != 0 {
+		return "", false
+	}
+	units := make([]uint16, len(raw)/2)
+	for i := range units {
+		units[i] = uint16(raw[2*i])<<8 | uint16(raw[2*i+1])
+	}
+	s := string(utf16.Decode(units))
+	if strings.ContainsRune(s, utf8.RuneError) {
+		return "", false
+	}
+	return s, true
+}
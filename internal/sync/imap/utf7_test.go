@@ -0,0 +1,91 @@
+package imap
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestDecodeModifiedUTF7(t *testing.T) {
+	for in, want := range map[string]string{
+		"INBOX":                           "INBOX",
+		"Entw&APw-rfe":                    "Entwürfe",
+		"Gel&APY-schte Elemente":          "Gelöschte Elemente",
+		"&BBIERQQ+BDQETwRJBDgENQ-":        "Входящие",
+		"&ZeVnLIqe-":                      "日本語",
+		"~peter/mail/&U,BTFw-/&ZeVnLIqe-": "~peter/mail/台北/日本語",
+		"Tom &- Jerry":                    "Tom & Jerry",
+		"&2D3eAA-":                        "\U0001F600",
+		// Malformed runs are kept.
+		"Broken &AP-":   "Broken &AP-",
+		"Unended &APw":  "Unended &APw",
+		"Lone &2D0- hi": "Lone &2D0- hi",
+	} {
+		if got := decodeModifiedUTF7(in); got != want {
+			t.Errorf("decodeModifiedUTF7(%q) = %q, want %q", in, got, want)
+		}
+	}
+}
+
+func TestImapFolderToPathDecodesNames(t *testing.T) {
+	for in, want := range map[string]string{
+		"INBOX/Entw&APw-rfe":            "inbox/entwürfe",
+		"&BBIERQQ+BDQETwRJBDgENQ-":      "входящие",
+		"Archiv/Gel&APY-schte Elemente": "archiv/gelöschte_elemente",
+		"[Gmail]/Sent Mail":             "gmail/sent",
+	} {
+		if got := imapFolderToPath(in); got != want {
+			t.Errorf("imapFolderToPath(%q) = %q, want %q", in, got, want)
+		}
+	}
+}
+
+func TestMigrateLegacyFolderDir(t *testing.T) {
+	emailDir := t.TempDir()
+	write := func(rel string) {
+		t.Helper()
+		p := filepath.Join(emailDir, filepath.FromSlash(rel))
+		if err := os.MkdirAll(filepath.Dir(p), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(p, []byte("x"), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	exists := func(rel string) bool {
+		_, err := os.Stat(filepath.Join(emailDir, filepath.FromSlash(rel)))
+		return err == nil
+	}
+
+	// Only the legacy directory: renamed, subfolders and all.
+	write("inbox/entwapw_rfe/1.eml")
+	write("inbox/entwapw_rfe/alt/2.eml")
+	if err := migrateLegacyFolderDir(emailDir, "INBOX/Entw&APw-rfe"); err != nil {
+		t.Fatal(err)
+	}
+	if !exists("inbox/entwürfe/1.eml") || !exists("inbox/entwürfe/alt/2.eml") || exists("inbox/entwapw_rfe") {
+		t.Error("legacy directory not renamed")
+	}
+
+	// Both, after mail was synced into each: files move, the legacy one goes.
+	write("gelapy_schte_elemente/3.eml")
+	write("gelapy_schte_elemente/4.eml")
+	write("gelöschte_elemente/4.eml")
+	if err := migrateLegacyFolderDir(emailDir, "Gel&APY-schte Elemente"); err != nil {
+		t.Fatal(err)
+	}
+	if !exists("gelöschte_elemente/3.eml") || !exists("gelöschte_elemente/4.eml") || exists("gelapy_schte_elemente") {
+		t.Error("legacy directory not merged")
+	}
+
+	// ASCII names and folders never synced before are left alone.
+	write("inbox/1.eml")
+	for _, folder := range []string{"INBOX", "&BBIERQQ+BDQETwRJBDgENQ-"} {
+		if err := migrateLegacyFolderDir(emailDir, folder); err != nil {
+			t.Errorf("%s: %v", folder, err)
+		}
+	}
+	if !exists("inbox/1.eml") || exists("входящие") {
+		t.Error("nothing to migrate, yet something moved")
+	}
+}
@@ -0,0 +1,200 @@
+package maildir
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Defaults for Limits.
+const (
+	DefaultMaxBytes   = 32 << 30 // 32 GiB
+	DefaultMaxEntries = 1_000_000
+)
+
+// ErrArchiveTooLarge is returned by Unpack when an archive expands past its
+// Limits, as a zip or tar.gz bomb does.
+var ErrArchiveTooLarge = errors.New("archive too large")
+
+// Limits bounds what Unpack extracts: MaxBytes of file content in all and
+// MaxEntries archive entries. Zero fields mean the defaults.
+type Limits struct {
+	MaxBytes   int64
+	MaxEntries int
+}
+
+// Unpack extracts the .zip, .tar or .tar.gz archive at archivePath, told
+// apart by content, into dstDir and returns the directory to import: dstDir,
+// or the one directory in it when the archive wraps everything in one (as
+// "zip -r Maildir.zip Maildir" does). Entries outside dstDir, links and
+// devices are skipped. Past limits it stops with ErrArchiveTooLarge; what
+// was extracted stays in dstDir for the caller to remove.
+func Unpack(archivePath, dstDir string, limits Limits) (string, error) {
+	if limits.MaxBytes <= 0 {
+		limits.MaxBytes = DefaultMaxBytes
+	}
+	if limits.MaxEntries <= 0 {
+		limits.MaxEntries = DefaultMaxEntries
+	}
+	x := &extractor{dstDir: dstDir, limits: limits}
+
+	if err := os.MkdirAll(dstDir, 0o755); err != nil {
+		return "", err
+	}
+	f, err := os.Open(archivePath)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	br := bufio.NewReader(f)
+	magic, _ := br.Peek(4)
+	switch {
+	case bytes.HasPrefix(magic, []byte("PK\x03\x04")):
+		fi, err := f.Stat()
+		if err != nil {
+			return "", err
+		}
+		err = x.unzip(f, fi.Size())
+		if err != nil {
+			return "", err
+		}
+	case bytes.HasPrefix(magic, []byte{0x1f, 0x8b}):
+		gz, err := gzip.NewReader(br)
+		if err != nil {
+			return "", fmt.Errorf("gunzip: %w", err)
+		}
+		defer gz.Close()
+		if err := x.untar(gz); err != nil {
+			return "", err
+		}
+	default:
+		if err := x.untar(br); err != nil {
+			return "", err
+		}
+	}
+	return singleDir(dstDir), nil
+}
+
+// singleDir descends into dir's only entry while that is a directory
+// other than a Maildir's cur, new or tmp.
+func singleDir(dir string) string {
+	for {
+		entries, err := os.ReadDir(dir)
+		if err != nil || len(entries) != 1 || !entries[0].IsDir() {
+			return dir
+		}
+		switch entries[0].Name() {
+		case "cur", "new", "tmp":
+			return dir
+		}
+		dir = filepath.Join(dir, entries[0].Name())
+	}
+}
+
+// extractor writes archive entries under dstDir, counting them against
+// limits.
+type extractor struct {
+	dstDir  string
+	limits  Limits
+	bytes   int64
+	entries int
+}
+
+// entry counts one more archive entry.
+func (x *extractor) entry() error {
+	x.entries++
+	if x.entries > x.limits.MaxEntries {
+		return fmt.Errorf("%w: more than %d entries", ErrArchiveTooLarge, x.limits.MaxEntries)
+	}
+	return nil
+}
+
+func (x *extractor) unzip(r io.ReaderAt, size int64) error {
+	zr, err := zip.NewReader(r, size)
+	if err != nil {
+		return fmt.Errorf("unzip: %w", err)
+	}
+	for _, zf := range zr.File {
+		if err := x.entry(); err != nil {
+			return err
+		}
+		if !zf.Mode().IsRegular() {
+			continue
+		}
+		rc, err := zf.Open()
+		if err != nil {
+			return fmt.Errorf("unzip %s: %w", zf.Name, err)
+		}
+		err = x.extractFile(zf.Name, rc)
+		rc.Close()
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (x *extractor) untar(r io.Reader) error {
+	tr := tar.NewReader(r)
+	for {
+		h, err := tr.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("untar: %w", err)
+		}
+		if err := x.entry(); err != nil {
+			return err
+		}
+		if h.Typeflag != tar.TypeReg {
+			continue
+		}
+		if err := x.extractFile(h.Name, tr); err != nil {
+			return err
+		}
+	}
+}
+
+// extractFile writes r to name under dstDir. Names that would land outside
+// dstDir, and the resource forks macOS adds to zips, are skipped.
+func (x *extractor) extractFile(name string, r io.Reader) error {
+	clean := filepath.Clean(filepath.FromSlash(name))
+	if filepath.IsAbs(clean) || clean == ".." || strings.HasPrefix(clean, ".."+string(filepath.Separator)) ||
+		strings.HasPrefix(filepath.ToSlash(clean), "__MACOSX/") {
+		return nil
+	}
+	path := filepath.Join(x.dstDir, clean)
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return err
+	}
+	out, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	// Read one byte past the limit to tell a file that ends there from one
+	// that goes on.
+	n, err := io.Copy(out, io.LimitReader(r, x.limits.MaxBytes-x.bytes+1))
+	x.bytes += n
+	if err != nil {
+		out.Close()
+		return fmt.Errorf("extract %s: %w", name, err)
+	}
+	if err := out.Close(); err != nil {
+		return err
+	}
+	if x.bytes > x.limits.MaxBytes {
+		os.Remove(path)
+		return fmt.Errorf("%w: more than %d bytes unpacked", ErrArchiveTooLarge, x.limits.MaxBytes)
+	}
+	return nil
+}
@@ -0,0 +1,350 @@
+// Package maildir imports mail trees copied from other clients: Maildir
+// and Maildir++ directories (Dovecot, Courier, Thunderbird's maildir
+// store), Thunderbird mbox folders, and Apple Mail .emlx messages. Each
+// message is stored as {checksum}-{seq}.eml under its folder, like PST
+// imports, with its mtime set from the Date header.
+package maildir
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/eslider/mails/internal/checksum"
+	"github.com/eslider/mails/internal/search/eml"
+)
+
+// ProgressFunc receives progress updates during an import.
+type ProgressFunc func(phase string, current, total int)
+
+// SaveEmailFunc saves a message by full path. If nil, os.WriteFile is used.
+type SaveEmailFunc func(path string, data []byte) error
+
+// source is one file holding messages.
+type source struct {
+	path   string
+	folder string // folder path under emailDir
+	kind   sourceKind
+	count  int // messages in the file
+}
+
+type sourceKind int
+
+const (
+	kindMessage sourceKind = iota // one RFC 5322 message: Maildir entry or .eml
+	kindEmlx                      // Apple Mail: byte count line, message, plist
+	kindMbox                      // Thunderbird or exported mbox
+)
+
+// Import copies every message found under srcDir into emailDir and returns
+// (imported count, error count). See ImportTo.
+func Import(srcDir, emailDir string, onProgress ProgressFunc) (int, int, error) {
+	return ImportTo(srcDir, emailDir, onProgress, nil)
+}
+
+// ImportTo is Import storing messages through saveFn (e.g. to S3) when it
+// is not nil. Folder names are kept: "Sent" in a Maildir++ tree becomes
+// sent/, "Inbox.sbd/Work" in a Thunderbird profile becomes inbox/work/,
+// and the Maildir root itself is inbox/. Messages in tmp/ are still being
+// delivered and are skipped.
+func ImportTo(srcDir, emailDir string, onProgress ProgressFunc, saveFn SaveEmailFunc) (int, int, error) {
+	if onProgress == nil {
+		onProgress = func(string, int, int) {}
+	}
+	onProgress("counting", 0, 0)
+	sources, err := scan(srcDir)
+	if err != nil {
+		return 0, 0, err
+	}
+	total := 0
+	for _, s := range sources {
+		total += s.count
+	}
+	onProgress("importing", 0, total)
+
+	imported, errCount, seq := 0, 0, 0
+	save := func(folder string, data []byte) {
+		if err := writeMessage(filepath.Join(emailDir, folder), seq, data, saveFn); err != nil {
+			log.Printf("WARN: maildir import: %v", err)
+			errCount++
+		} else {
+			imported++
+		}
+		seq++
+		if (imported+errCount)%100 == 0 {
+			onProgress("importing", imported+errCount, total)
+		}
+	}
+	for _, s := range sources {
+		if err := readSource(s, func(data []byte) { save(s.folder, data) }); err != nil {
+			log.Printf("WARN: maildir import %s: %v", s.path, err)
+			errCount++
+		}
+	}
+
+	onProgress("done", imported, imported)
+	return imported, errCount, nil
+}
+
+// scan walks srcDir and lists the files holding messages, in walk order.
+func scan(srcDir string) ([]source, error) {
+	fi, err := os.Stat(srcDir)
+	if err != nil {
+		return nil, err
+	}
+	if !fi.IsDir() {
+		return nil, fmt.Errorf("%s is not a directory", srcDir)
+	}
+	var sources []source
+	err = filepath.WalkDir(srcDir, func(path string, d os.DirEntry, err error) error {
+		if err != nil {
+			log.Printf("WARN: maildir import: %v", err)
+			return nil
+		}
+		if d.IsDir() {
+			if d.Name() == "tmp" && path != srcDir {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if !d.Type().IsRegular() {
+			return nil
+		}
+		rel, err := filepath.Rel(srcDir, path)
+		if err != nil {
+			return nil
+		}
+		dirs := strings.Split(filepath.ToSlash(filepath.Dir(rel)), "/")
+		if dirs[0] == "." {
+			dirs = nil
+		}
+		name := d.Name()
+		s := source{path: path, count: 1}
+		switch {
+		case len(dirs) > 0 && (dirs[len(dirs)-1] == "cur" || dirs[len(dirs)-1] == "new"):
+			if strings.HasPrefix(name, ".") {
+				return nil
+			}
+			s.kind = kindMessage
+			s.folder = folderPath(dirs[:len(dirs)-1])
+		case strings.HasSuffix(strings.ToLower(name), ".emlx"):
+			s.kind = kindEmlx
+			s.folder = folderPath(dirs)
+		case eml.IsEmailFile(name):
+			s.kind = kindMessage
+			s.folder = folderPath(dirs)
+		case isMbox(path):
+			s.kind = kindMbox
+			s.count = countMbox(path)
+			if name != "mbox" { // Apple Mail exports hold their mbox in Name.mbox/mbox
+				dirs = append(dirs, name)
+			}
+			s.folder = folderPath(dirs)
+		default:
+			return nil
+		}
+		sources = append(sources, s)
+		return nil
+	})
+	return sources, err
+}
+
+// reAppleID matches the UUID and version (V10) directories of an Apple
+// Mail store.
+var reAppleID = regexp.MustCompile(`^([0-9A-Fa-f]{8}-[0-9A-Fa-f]{4}-[0-9A-Fa-f]{4}-[0-9A-Fa-f]{4}-[0-9A-Fa-f]{12}|V[0-9]+)$`)
+
+// folderPath turns the directories holding a message into its folder under
+// emailDir. Client storage details are dropped: Thunderbird's .sbd and
+// Apple Mail's .mbox suffixes, Apple Mail's UUID, Data and Messages
+// directories and the numbered buckets under Data. A Maildir++ folder such
+// as ".Work.Projects" becomes work/projects. The root is inbox.
+func folderPath(dirs []string) string {
+	var parts []string
+	inData := false
+	for _, d := range dirs {
+		lower := strings.ToLower(d)
+		switch {
+		case lower == "data":
+			inData = true
+			continue
+		case inData && strings.Trim(d, "0123456789") == "":
+			continue
+		case lower == "messages" || lower == "attachments" || reAppleID.MatchString(d):
+			continue
+		case strings.HasPrefix(d, ".") && len(d) > 1:
+			for _, p := range strings.Split(d[1:], ".") {
+				if p != "" {
+					parts = append(parts, p)
+				}
+			}
+			continue
+		case strings.HasSuffix(lower, ".sbd"):
+			d = d[:len(d)-len(".sbd")]
+		case strings.HasSuffix(lower, ".mbox"):
+			d = d[:len(d)-len(".mbox")]
+		}
+		inData = false
+		parts = append(parts, d)
+	}
+	if len(parts) == 0 {
+		return "inbox"
+	}
+	for i, p := range parts {
+		parts[i] = sanitizeFolderName(p)
+	}
+	return filepath.Join(parts...)
+}
+
+// sanitizeFolderName makes one folder name safe as a directory name, as
+// PST imports do.
+func sanitizeFolderName(name string) string {
+	name = strings.TrimSpace(strings.ToLower(name))
+	name = strings.Map(func(r rune) rune {
+		if r == '/' || r == '\\' || r == ':' || r == '*' || r == '?' || r == '"' || r == '<' || r == '>' || r == '|' {
+			return '_'
+		}
+		return r
+	}, name)
+	if name == "" || name == "." || name == ".." {
+		return "other"
+	}
+	if len(name) > 60 {
+		name = name[:60]
+	}
+	return name
+}
+
+// isMbox reports whether the file at path starts with an mbox "From " line.
+func isMbox(path string) bool {
+	f, err := os.Open(path)
+	if err != nil {
+		return false
+	}
+	defer f.Close()
+	head := make([]byte, 5)
+	n, _ := io.ReadFull(f, head)
+	return string(head[:n]) == "From "
+}
+
+// countMbox counts the messages in the mbox at path.
+func countMbox(path string) int {
+	n := 0
+	f, err := os.Open(path)
+	if err != nil {
+		return 0
+	}
+	defer f.Close()
+	splitMbox(f, func([]byte) { n++ })
+	return n
+}
+
+// readSource hands each message in s to fn.
+func readSource(s source, fn func([]byte)) error {
+	switch s.kind {
+	case kindMbox:
+		f, err := os.Open(s.path)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		return splitMbox(f, fn)
+	case kindEmlx:
+		data, err := os.ReadFile(s.path)
+		if err != nil {
+			return err
+		}
+		msg, err := emlxMessage(data)
+		if err != nil {
+			return err
+		}
+		fn(msg)
+	default:
+		data, err := eml.ReadFile(s.path)
+		if err != nil {
+			return err
+		}
+		fn(data)
+	}
+	return nil
+}
+
+// emlxMessage returns the message in an Apple Mail .emlx file: a line with
+// its length in bytes, the message, then a property list.
+func emlxMessage(data []byte) ([]byte, error) {
+	line, rest, ok := bytes.Cut(data, []byte("\n"))
+	if !ok {
+		return nil, fmt.Errorf("emlx: no length line")
+	}
+	n, err := strconv.Atoi(strings.TrimSpace(string(line)))
+	if err != nil || n < 0 || n > len(rest) {
+		return nil, fmt.Errorf("emlx: bad length %q", line)
+	}
+	return rest[:n], nil
+}
+
+// splitMbox hands each message of the mbox in r to fn, without its "From "
+// separator line. Lines quoted as ">From " (mboxrd) lose one ">".
+func splitMbox(r io.Reader, fn func([]byte)) error {
+	br := bufio.NewReader(r)
+	var msg bytes.Buffer
+	started := false
+	flush := func() {
+		if started {
+			fn(bytes.TrimSuffix(msg.Bytes(), []byte("\n")))
+		}
+		msg.Reset()
+	}
+	prevBlank := true
+	for {
+		line, err := br.ReadBytes('\n')
+		if len(line) > 0 {
+			switch {
+			case prevBlank && bytes.HasPrefix(line, []byte("From ")):
+				flush()
+				started = true
+			case bytes.HasPrefix(bytes.TrimLeft(line, ">"), []byte("From ")) && line[0] == '>':
+				msg.Write(line[1:])
+			default:
+				msg.Write(line)
+			}
+			prevBlank = len(bytes.TrimRight(line, "\r\n")) == 0
+		}
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+	}
+	flush()
+	return nil
+}
+
+// writeMessage stores data in dir as {checksum}-{seq}.eml, with its mtime
+// set from the Date header when written to the filesystem.
+func writeMessage(dir string, seq int, data []byte, saveFn SaveEmailFunc) error {
+	path := filepath.Join(dir, fmt.Sprintf("%s-%d.eml", checksum.Sum(data), seq))
+	if saveFn != nil {
+		if err := saveFn(path, data); err != nil {
+			return fmt.Errorf("write %s: %w", path, err)
+		}
+		return nil
+	}
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return err
+	}
+	if err := os.WriteFile(path, data, 0o644); err != nil {
+		return fmt.Errorf("write %s: %w", path, err)
+	}
+	if date := eml.HeaderDate(data); !date.IsZero() {
+		os.Chtimes(path, date, date)
+	}
+	return nil
+}
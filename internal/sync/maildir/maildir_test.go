@@ -0,0 +1,242 @@
+package maildir
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/eslider/mails/internal/checksum"
+)
+
+func message(subject, date string) string {
+	return "From: a@example.com\r\nTo: b@example.com\r\nSubject: " + subject + "\r\nDate: " + date + "\r\n\r\nBody of " + subject + "\r\n"
+}
+
+func writeFile(t *testing.T, path, content string) {
+	t.Helper()
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// imported lists the stored files under emailDir as "folder: subject".
+func imported(t *testing.T, emailDir string) []string {
+	t.Helper()
+	var got []string
+	filepath.WalkDir(emailDir, func(path string, d os.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+		data, err := os.ReadFile(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !strings.HasPrefix(d.Name(), checksum.Sum(data)+"-") || !strings.HasSuffix(d.Name(), ".eml") {
+			t.Errorf("%s is not named {checksum}-{seq}.eml", path)
+		}
+		rel, _ := filepath.Rel(emailDir, filepath.Dir(path))
+		for _, line := range strings.Split(string(data), "\n") {
+			if s, ok := strings.CutPrefix(line, "Subject: "); ok {
+				got = append(got, filepath.ToSlash(rel)+": "+strings.TrimSpace(s))
+			}
+		}
+		return nil
+	})
+	sort.Strings(got)
+	return got
+}
+
+func TestImportMaildir(t *testing.T) {
+	src := t.TempDir()
+	// Maildir++: the root is the inbox, dot-folders below it.
+	writeFile(t, filepath.Join(src, "cur", "1700000000.1.host:2,S"), message("seen", "Mon, 2 Jan 2006 15:04:05 +0000"))
+	writeFile(t, filepath.Join(src, "new", "1700000001.2.host"), message("unseen", "Tue, 3 Jan 2006 10:00:00 +0000"))
+	writeFile(t, filepath.Join(src, "tmp", "1700000002.3.host"), message("in delivery", "Tue, 3 Jan 2006 10:00:00 +0000"))
+	writeFile(t, filepath.Join(src, ".Sent", "cur", "1700000003.4.host:2,S"), message("sent", "Wed, 4 Jan 2006 10:00:00 +0000"))
+	writeFile(t, filepath.Join(src, ".Work.Projects", "new", "1700000004.5.host"), message("project", "Thu, 5 Jan 2006 10:00:00 +0000"))
+	writeFile(t, filepath.Join(src, "dovecot-uidlist"), "3 V1 N5\n")
+
+	emailDir := t.TempDir()
+	var phases []string
+	n, errCount, err := Import(src, emailDir, func(phase string, current, total int) {
+		phases = append(phases, fmt.Sprintf("%s %d/%d", phase, current, total))
+	})
+	if err != nil || n != 4 || errCount != 0 {
+		t.Fatalf("Import = %d, %d, %v; want 4, 0, nil", n, errCount, err)
+	}
+	want := []string{"inbox: seen", "inbox: unseen", "sent: sent", "work/projects: project"}
+	if got := imported(t, emailDir); fmt.Sprint(got) != fmt.Sprint(want) {
+		t.Errorf("imported %v, want %v", got, want)
+	}
+	if last := phases[len(phases)-1]; last != "done 4/4" {
+		t.Errorf("last progress = %q, want done 4/4", last)
+	}
+
+	matches, _ := filepath.Glob(filepath.Join(emailDir, "inbox", "*.eml"))
+	for _, m := range matches {
+		data, _ := os.ReadFile(m)
+		if !strings.Contains(string(data), "Subject: seen") {
+			continue
+		}
+		fi, _ := os.Stat(m)
+		if want := time.Date(2006, 1, 2, 15, 4, 5, 0, time.UTC); !fi.ModTime().Equal(want) {
+			t.Errorf("mtime = %v, want the Date header %v", fi.ModTime(), want)
+		}
+	}
+}
+
+func TestImportThunderbirdAndAppleMail(t *testing.T) {
+	src := t.TempDir()
+	mbox := "From - Mon Jan  2 15:04:05 2006\n" + strings.ReplaceAll(message("first", "Mon, 2 Jan 2006 15:04:05 +0000"), "\r\n", "\n") +
+		">From the quoted line\n\n" +
+		"From - Tue Jan  3 10:00:00 2006\n" + strings.ReplaceAll(message("second", "Tue, 3 Jan 2006 10:00:00 +0000"), "\r\n", "\n") + "\n"
+	writeFile(t, filepath.Join(src, "Local Folders", "Inbox"), mbox)
+	writeFile(t, filepath.Join(src, "Local Folders", "Inbox.msf"), "// <!-- <mdb:mork:z v=\"1.4\"/> -->\n")
+	writeFile(t, filepath.Join(src, "Local Folders", "Inbox.sbd", "Work"), "From - Wed Jan  4 10:00:00 2006\n"+strings.ReplaceAll(message("work", "Wed, 4 Jan 2006 10:00:00 +0000"), "\r\n", "\n"))
+
+	msg := message("apple", "Thu, 5 Jan 2006 10:00:00 +0000")
+	emlx := fmt.Sprintf("%d\n%s<?xml version=\"1.0\"?>\n<plist version=\"1.0\"><dict/></plist>\n", len(msg), msg)
+	writeFile(t, filepath.Join(src, "V10", "0F8E3C1A-1111-2222-3333-444455556666", "Archive.mbox", "0F8E3C1A-1111-2222-3333-444455556666", "Data", "1", "Messages", "42.emlx"), emlx)
+
+	emailDir := t.TempDir()
+	n, errCount, err := Import(src, emailDir, nil)
+	if err != nil || n != 4 || errCount != 0 {
+		t.Fatalf("Import = %d, %d, %v; want 4, 0, nil", n, errCount, err)
+	}
+	want := []string{"archive: apple", "local folders/inbox/work: work", "local folders/inbox: first", "local folders/inbox: second"}
+	if got := imported(t, emailDir); fmt.Sprint(got) != fmt.Sprint(want) {
+		t.Errorf("imported %v, want %v", got, want)
+	}
+
+	matches, _ := filepath.Glob(filepath.Join(emailDir, "archive", "*.eml"))
+	if len(matches) != 1 {
+		t.Fatalf("archive holds %v", matches)
+	}
+	if data, _ := os.ReadFile(matches[0]); string(data) != msg {
+		t.Errorf("emlx message = %q, want %q without length line or plist", data, msg)
+	}
+}
+
+func TestSplitMboxUnquotesFrom(t *testing.T) {
+	var got []string
+	splitMbox(strings.NewReader("From x\nSubject: a\n\n>From here\n>>From there\n\nFrom y\nSubject: b\n\nbody\n"), func(m []byte) {
+		got = append(got, string(m))
+	})
+	want := []string{"Subject: a\n\nFrom here\n>From there\n", "Subject: b\n\nbody"}
+	if fmt.Sprintf("%q", got) != fmt.Sprintf("%q", want) {
+		t.Errorf("messages = %q, want %q", got, want)
+	}
+}
+
+func TestUnpackZip(t *testing.T) {
+	archive := filepath.Join(t.TempDir(), "mail.zip")
+	f, err := os.Create(archive)
+	if err != nil {
+		t.Fatal(err)
+	}
+	zw := zip.NewWriter(f)
+	for name, content := range map[string]string{
+		"Maildir/cur/1.host:2,S": message("zipped", "Mon, 2 Jan 2006 15:04:05 +0000"),
+		"Maildir/new/2.host":     message("zipped new", "Mon, 2 Jan 2006 15:04:05 +0000"),
+		"../escape.eml":          "outside",
+		"__MACOSX/Maildir/._cur": "resource fork",
+	} {
+		w, err := zw.Create(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		w.Write([]byte(content))
+	}
+	zw.Close()
+	f.Close()
+
+	dst := filepath.Join(t.TempDir(), "out")
+	srcDir, err := Unpack(archive, dst, Limits{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if srcDir != filepath.Join(dst, "Maildir") {
+		t.Errorf("Unpack = %s, want the wrapping Maildir directory", srcDir)
+	}
+	if _, err := os.Stat(filepath.Join(filepath.Dir(dst), "escape.eml")); !os.IsNotExist(err) {
+		t.Error("an entry outside the destination was extracted")
+	}
+
+	emailDir := t.TempDir()
+	if n, _, err := Import(srcDir, emailDir, nil); err != nil || n != 2 {
+		t.Fatalf("Import = %d, %v; want 2", n, err)
+	}
+	if got := imported(t, emailDir); fmt.Sprint(got) != "[inbox: zipped inbox: zipped new]" {
+		t.Errorf("imported %v", got)
+	}
+}
+
+func TestUnpackStopsArchiveBombs(t *testing.T) {
+	zeros := bytes.Repeat([]byte{0}, 8<<20) // compresses to a few KiB
+	write := func(name string, fn func(f *os.File)) string {
+		path := filepath.Join(t.TempDir(), name)
+		f, err := os.Create(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		fn(f)
+		f.Close()
+		return path
+	}
+	bombZip := write("bomb.zip", func(f *os.File) {
+		zw := zip.NewWriter(f)
+		for i := range 4 {
+			w, _ := zw.Create(fmt.Sprintf("Maildir/cur/%d", i))
+			w.Write(zeros)
+		}
+		zw.Close()
+	})
+	bombTarGz := write("bomb.tar.gz", func(f *os.File) {
+		gz := gzip.NewWriter(f)
+		tw := tar.NewWriter(gz)
+		for i := range 4 {
+			tw.WriteHeader(&tar.Header{Name: fmt.Sprintf("Maildir/cur/%d", i), Mode: 0o644, Size: int64(len(zeros)), Typeflag: tar.TypeReg})
+			tw.Write(zeros)
+		}
+		tw.Close()
+		gz.Close()
+	})
+
+	for _, archive := range []string{bombZip, bombTarGz} {
+		dst := filepath.Join(t.TempDir(), "out")
+		_, err := Unpack(archive, dst, Limits{MaxBytes: 10 << 20})
+		if !errors.Is(err, ErrArchiveTooLarge) {
+			t.Errorf("%s: err = %v, want ErrArchiveTooLarge", filepath.Base(archive), err)
+		}
+		var total int64
+		filepath.WalkDir(dst, func(path string, d fs.DirEntry, err error) error {
+			if info, err := d.Info(); err == nil && d.Type().IsRegular() {
+				total += info.Size()
+			}
+			return nil
+		})
+		if total > 10<<20 {
+			t.Errorf("%s: %d bytes left unpacked, limit %d", filepath.Base(archive), total, 10<<20)
+		}
+
+		if _, err := Unpack(archive, filepath.Join(t.TempDir(), "out"), Limits{MaxEntries: 3}); !errors.Is(err, ErrArchiveTooLarge) {
+			t.Errorf("%s: 4 entries with MaxEntries 3: err = %v, want ErrArchiveTooLarge", filepath.Base(archive), err)
+		}
+		if _, err := Unpack(archive, filepath.Join(t.TempDir(), "out"), Limits{}); err != nil {
+			t.Errorf("%s within the defaults: %v", filepath.Base(archive), err)
+		}
+	}
+}
@@ -0,0 +1,120 @@
+// Package mailtls builds the tls.Config used by the IMAP and POP3 clients.
+//
+// Server-wide settings come from the environment (file paths, set by the
+// operator); per-account settings come from model.TLSOptions (PEM text,
+// set by the user). Per-account values add to or override the global ones.
+package mailtls
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"log"
+	"os"
+
+	"github.com/eslider/mails/internal/model"
+)
+
+// Environment variables for server-wide TLS settings.
+const (
+	EnvCAFile         = "MAIL_TLS_CA_FILE"
+	EnvClientCertFile = "MAIL_TLS_CLIENT_CERT_FILE"
+	EnvClientKeyFile  = "MAIL_TLS_CLIENT_KEY_FILE"
+)
+
+// Config returns the TLS client configuration for connecting to acct.Host.
+func Config(acct model.EmailAccount) (*tls.Config, error) {
+	cfg := &tls.Config{ServerName: acct.Host}
+	opts := acct.TLS
+	if opts == nil {
+		opts = &model.TLSOptions{}
+	}
+
+	globalCA, err := readEnvFile(EnvCAFile)
+	if err != nil {
+		return nil, err
+	}
+	if len(globalCA) > 0 || opts.CACert != "" {
+		pool, err := x509.SystemCertPool()
+		if err != nil || pool == nil {
+			pool = x509.NewCertPool()
+		}
+		if len(globalCA) > 0 && !pool.AppendCertsFromPEM(globalCA) {
+			return nil, fmt.Errorf("%s: no PEM certificates found", EnvCAFile)
+		}
+		if opts.CACert != "" && !pool.AppendCertsFromPEM([]byte(opts.CACert)) {
+			return nil, fmt.Errorf("account CA: no PEM certificates found")
+		}
+		cfg.RootCAs = pool
+	}
+
+	cert, err := clientCertificate(opts)
+	if err != nil {
+		return nil, err
+	}
+	if cert != nil {
+		cfg.Certificates = []tls.Certificate{*cert}
+	}
+
+	if opts.InsecureSkipVerify {
+		log.Printf("WARN: TLS certificate verification is DISABLED for %s (%s); the connection can be intercepted", acct.Email, acct.Host)
+		cfg.InsecureSkipVerify = true
+	}
+	return cfg, nil
+}
+
+// ValidateOptions checks that per-account TLS settings parse: the CA bundle
+// holds certificates and the client certificate matches its key.
+func ValidateOptions(opts *model.TLSOptions) error {
+	if opts == nil {
+		return nil
+	}
+	if opts.CACert != "" && !x509.NewCertPool().AppendCertsFromPEM([]byte(opts.CACert)) {
+		return fmt.Errorf("tls.ca_cert: no PEM certificates found")
+	}
+	if (opts.ClientCert == "") != (opts.ClientKey == "") {
+		return fmt.Errorf("tls: client certificate and key must be given together")
+	}
+	if opts.ClientCert != "" {
+		if _, err := tls.X509KeyPair([]byte(opts.ClientCert), []byte(opts.ClientKey)); err != nil {
+			return fmt.Errorf("tls: client certificate: %w", err)
+		}
+	}
+	return nil
+}
+
+// clientCertificate returns the account's client certificate, or the
+// server-wide one, or nil when neither is configured.
+func clientCertificate(opts *model.TLSOptions) (*tls.Certificate, error) {
+	if opts.ClientCert != "" {
+		cert, err := tls.X509KeyPair([]byte(opts.ClientCert), []byte(opts.ClientKey))
+		if err != nil {
+			return nil, fmt.Errorf("account client certificate: %w", err)
+		}
+		return &cert, nil
+	}
+	certFile, keyFile := os.Getenv(EnvClientCertFile), os.Getenv(EnvClientKeyFile)
+	if certFile == "" && keyFile == "" {
+		return nil, nil
+	}
+	if certFile == "" || keyFile == "" {
+		return nil, fmt.Errorf("%s and %s must be set together", EnvClientCertFile, EnvClientKeyFile)
+	}
+	cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+	if err != nil {
+		return nil, fmt.Errorf("load client certificate: %w", err)
+	}
+	return &cert, nil
+}
+
+func readEnvFile(key string) ([]byte, error) {
+	path := os.Getenv(key)
+	if path == "" {
+		return nil, nil
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", key, err)
+	}
+	return data, nil
+}
@@ -0,0 +1,230 @@
+package mailtls
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/eslider/mails/internal/model"
+)
+
+// testCA is a throwaway certificate authority.
+type testCA struct {
+	cert *x509.Certificate
+	key  *ecdsa.PrivateKey
+	pem  string
+}
+
+func newTestCA(t *testing.T) *testCA {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "Test CA"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		KeyUsage:              x509.KeyUsageCertSign,
+		BasicConstraintsValid: true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, _ := x509.ParseCertificate(der)
+	return &testCA{cert: cert, key: key, pem: string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}))}
+}
+
+// issue returns a PEM certificate and key signed by the CA.
+func (ca *testCA) issue(t *testing.T, name string, usage x509.ExtKeyUsage) (certPEM, keyPEM string) {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(time.Now().UnixNano()),
+		Subject:      pkix.Name{CommonName: name},
+		DNSNames:     []string{name},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{usage},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, ca.cert, &key.PublicKey, ca.key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})),
+		string(pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}))
+}
+
+// serve starts a TLS listener for "mail.internal" and returns its address.
+// When clientCA is set, the server requires a client certificate from it.
+func serve(t *testing.T, serverCA, clientCA *testCA) string {
+	t.Helper()
+	certPEM, keyPEM := serverCA.issue(t, "mail.internal", x509.ExtKeyUsageServerAuth)
+	cert, err := tls.X509KeyPair([]byte(certPEM), []byte(keyPEM))
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg := &tls.Config{Certificates: []tls.Certificate{cert}}
+	if clientCA != nil {
+		pool := x509.NewCertPool()
+		pool.AddCert(clientCA.cert)
+		cfg.ClientCAs = pool
+		cfg.ClientAuth = tls.RequireAndVerifyClientCert
+	}
+	l, err := tls.Listen("tcp", "127.0.0.1:0", cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { l.Close() })
+	go func() {
+		for {
+			c, err := l.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer c.Close()
+				if c.(*tls.Conn).Handshake() == nil {
+					c.Write([]byte("+OK\r\n"))
+				}
+			}()
+		}
+	}()
+	return l.Addr().String()
+}
+
+// dial connects with Config(acct) and reads the greeting, which the server
+// only sends after a successful handshake (TLS 1.3 reports client
+// certificate rejections on the first read).
+func dial(t *testing.T, addr string, acct model.EmailAccount) error {
+	t.Helper()
+	acct.Host = "mail.internal"
+	cfg, err := Config(acct)
+	if err != nil {
+		return err
+	}
+	conn, err := tls.Dial("tcp", addr, cfg)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(5 * time.Second))
+	buf := make([]byte, 5)
+	_, err = conn.Read(buf)
+	return err
+}
+
+func TestConfigCustomCA(t *testing.T) {
+	ca := newTestCA(t)
+	addr := serve(t, ca, nil)
+
+	if err := dial(t, addr, model.EmailAccount{}); err == nil {
+		t.Fatal("handshake with an unknown CA should fail")
+	}
+	if err := dial(t, addr, model.EmailAccount{TLS: &model.TLSOptions{CACert: ca.pem}}); err != nil {
+		t.Fatalf("account CA: %v", err)
+	}
+
+	caFile := filepath.Join(t.TempDir(), "ca.pem")
+	os.WriteFile(caFile, []byte(ca.pem), 0o600)
+	t.Setenv(EnvCAFile, caFile)
+	if err := dial(t, addr, model.EmailAccount{}); err != nil {
+		t.Fatalf("%s: %v", EnvCAFile, err)
+	}
+}
+
+func TestConfigClientCertificate(t *testing.T) {
+	serverCA, clientCA := newTestCA(t), newTestCA(t)
+	addr := serve(t, serverCA, clientCA)
+	certPEM, keyPEM := clientCA.issue(t, "archiver", x509.ExtKeyUsageClientAuth)
+
+	opts := &model.TLSOptions{CACert: serverCA.pem}
+	if err := dial(t, addr, model.EmailAccount{TLS: opts}); err == nil {
+		t.Fatal("handshake without a client certificate should fail")
+	}
+	opts.ClientCert, opts.ClientKey = certPEM, keyPEM
+	if err := dial(t, addr, model.EmailAccount{TLS: opts}); err != nil {
+		t.Fatalf("account client certificate: %v", err)
+	}
+
+	dir := t.TempDir()
+	os.WriteFile(filepath.Join(dir, "c.pem"), []byte(certPEM), 0o600)
+	os.WriteFile(filepath.Join(dir, "k.pem"), []byte(keyPEM), 0o600)
+	t.Setenv(EnvClientCertFile, filepath.Join(dir, "c.pem"))
+	t.Setenv(EnvClientKeyFile, filepath.Join(dir, "k.pem"))
+	if err := dial(t, addr, model.EmailAccount{TLS: &model.TLSOptions{CACert: serverCA.pem}}); err != nil {
+		t.Fatalf("env client certificate: %v", err)
+	}
+}
+
+func TestConfigInsecureSkipVerify(t *testing.T) {
+	addr := serve(t, newTestCA(t), nil)
+	if err := dial(t, addr, model.EmailAccount{TLS: &model.TLSOptions{InsecureSkipVerify: true}}); err != nil {
+		t.Fatalf("insecure: %v", err)
+	}
+}
+
+func TestValidateOptions(t *testing.T) {
+	ca := newTestCA(t)
+	certPEM, keyPEM := ca.issue(t, "archiver", x509.ExtKeyUsageClientAuth)
+	_, otherKey := ca.issue(t, "other", x509.ExtKeyUsageClientAuth)
+
+	tests := []struct {
+		name    string
+		opts    *model.TLSOptions
+		wantErr string
+	}{
+		{"nil", nil, ""},
+		{"ca", &model.TLSOptions{CACert: ca.pem}, ""},
+		{"pair", &model.TLSOptions{ClientCert: certPEM, ClientKey: keyPEM}, ""},
+		{"bad ca", &model.TLSOptions{CACert: "not a cert"}, "ca_cert"},
+		{"cert without key", &model.TLSOptions{ClientCert: certPEM}, "together"},
+		{"key without cert", &model.TLSOptions{ClientKey: keyPEM}, "together"},
+		{"mismatched key", &model.TLSOptions{ClientCert: certPEM, ClientKey: otherKey}, "client certificate"},
+	}
+	for _, tt := range tests {
+		err := ValidateOptions(tt.opts)
+		if tt.wantErr == "" {
+			if err != nil {
+				t.Errorf("%s: unexpected error %v", tt.name, err)
+			}
+			continue
+		}
+		if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+			t.Errorf("%s: error = %v, want containing %q", tt.name, err, tt.wantErr)
+		}
+	}
+}
+
+func TestConfigEnvErrors(t *testing.T) {
+	t.Setenv(EnvClientCertFile, "/nonexistent/c.pem")
+	if _, err := Config(model.EmailAccount{Host: "h"}); err == nil || !strings.Contains(err.Error(), EnvClientKeyFile) {
+		t.Errorf("cert without key file: err = %v", err)
+	}
+	t.Setenv(EnvClientCertFile, "")
+	t.Setenv(EnvCAFile, "/nonexistent/ca.pem")
+	if _, err := Config(model.EmailAccount{Host: "h"}); err == nil {
+		t.Error("missing CA file should fail")
+	}
+}
@@ -4,6 +4,7 @@ package pop3
 
 import (
 	"bufio"
+	"bytes"
 	"context"
 	"crypto/sha256"
 	"crypto/tls"
@@ -16,7 +17,10 @@ import (
 	"strings"
 	"time"
 
+	"github.com/eslider/mails/internal/checksum"
 	"github.com/eslider/mails/internal/model"
+	"github.com/eslider/mails/internal/search/eml"
+	"github.com/eslider/mails/internal/sync/mailtls"
 )
 
 // SyncState abstracts the sync state storage (implemented by sync.StateDB).
@@ -28,8 +32,14 @@ type SyncState interface {
 // SaveEmailFunc saves email data by full path. If nil, os.WriteFile is used.
 type SaveEmailFunc func(path string, data []byte) error
 
+// uidlFolder is the sync_uids folder holding the server's UIDL values,
+// kept apart from the content hashes stored under "inbox".
+const uidlFolder = "uidl"
+
 // Sync downloads new emails from a POP3 account.
-// Uses SHA-256 hash deduplication since POP3 has no stable UIDs.
+// Messages are keyed on their UIDL when the server supports it, so only
+// unseen ones are retrieved even if message numbers change between
+// sessions; SHA-256 content hashes deduplicate the rest.
 // Returns (newMessages, error). NEVER deletes messages from the server.
 func Sync(acct model.EmailAccount, emailDir string, state SyncState) (int, error) {
 	return SyncWithContext(context.Background(), acct, emailDir, state, nil)
@@ -53,7 +63,12 @@ func SyncWithContext(ctx context.Context, acct model.EmailAccount, emailDir stri
 	var conn net.Conn
 	var err error
 	if acct.SSL {
-		conn, err = tls.Dial("tcp", addr, &tls.Config{ServerName: acct.Host})
+		var tlsCfg *tls.Config
+		tlsCfg, err = mailtls.Config(acct)
+		if err != nil {
+			return 0, fmt.Errorf("tls config: %w", err)
+		}
+		conn, err = tls.Dial("tcp", addr, tlsCfg)
 	} else {
 		conn, err = net.DialTimeout("tcp", addr, 30*time.Second)
 	}
@@ -85,12 +100,23 @@ func SyncWithContext(ctx context.Context, acct model.EmailAccount, emailDir stri
 	}
 	log.Printf("POP3: %d messages in mailbox", count)
 
+	uidls, err := pop3Uidl(conn, reader)
+	if err != nil {
+		return 0, fmt.Errorf("POP3 UIDL: %w", err)
+	}
+	if uidls == nil {
+		log.Printf("POP3: %s does not support UIDL, retrieving every message", acct.Host)
+	}
+
 	inboxDir := filepath.Join(emailDir, "inbox")
 	if saveFn == nil {
 		os.MkdirAll(inboxDir, 0o755)
 	}
 
-	totalNew := 0
+	// POP3 has no search, so SyncSince is applied to the Date header read
+	// with TOP, which servers may not support; then everything is fetched.
+	filterSince := !acct.SyncSince.IsZero()
+	totalNew, older := 0, 0
 	for i := 1; i <= count; i++ {
 		// Check for cancellation between messages.
 		select {
@@ -101,6 +127,22 @@ func SyncWithContext(ctx context.Context, acct model.EmailAccount, emailDir stri
 		default:
 		}
 
+		uidl := uidls[i]
+		if uidl != "" && state.IsUIDSynced(acct.ID, uidlFolder, uidl) {
+			continue
+		}
+
+		if filterSince {
+			before, err := receivedBefore(conn, reader, i, acct.SyncSince)
+			if err != nil {
+				log.Printf("POP3: %s: TOP failed (%v), ignoring sync_since", acct.Host, err)
+				filterSince = false
+			} else if before {
+				older++
+				continue
+			}
+		}
+
 		raw, err := pop3Retr(conn, reader, i)
 		if err != nil {
 			log.Printf("WARN: POP3 RETR %d: %v", i, err)
@@ -109,11 +151,14 @@ func SyncWithContext(ctx context.Context, acct model.EmailAccount, emailDir stri
 
 		msgHash := hashContent(raw)
 		if state.IsUIDSynced(acct.ID, "inbox", msgHash) {
+			// Downloaded before UIDLs were tracked, or a copy of another message.
+			if uidl != "" {
+				state.MarkUIDSynced(acct.ID, uidlFolder, uidl)
+			}
 			continue
 		}
 
-		checksum := contentChecksum(raw)
-		filename := fmt.Sprintf("%s-%s.eml", checksum, msgHash)
+		filename := fmt.Sprintf("%s-%s.eml", checksum.Sum(raw), msgHash)
 		path := filepath.Join(inboxDir, filename)
 
 		if saveFn != nil {
@@ -130,32 +175,37 @@ func SyncWithContext(ctx context.Context, acct model.EmailAccount, emailDir stri
 			setFileMtime(path, raw)
 		}
 		state.MarkUIDSynced(acct.ID, "inbox", msgHash)
+		if uidl != "" {
+			state.MarkUIDSynced(acct.ID, uidlFolder, uidl)
+		}
 		totalNew++
 	}
 
 	// QUIT (don't delete anything).
 	pop3Command(conn, reader, "QUIT")
 
+	if older > 0 {
+		log.Printf("POP3: %s skipped %d messages dated before %s", acct.Email, older, acct.SyncSince.Format(time.DateOnly))
+	}
 	log.Printf("POP3: %s downloaded %d new messages", acct.Email, totalNew)
 	return totalNew, nil
 }
 
+// hashContent is the 16-hex-char content key under which messages are
+// recorded as synced. It stays fixed so existing sync state keeps
+// matching when CHECKSUM_LENGTH changes the filename checksum.
 func hashContent(data []byte) string {
 	h := sha256.Sum256(data)
 	return fmt.Sprintf("%x", h[:8])
 }
 
-func contentChecksum(data []byte) string {
-	return hashContent(data)
-}
-
 func setFileMtime(path string, raw []byte) {
 	msg, err := mail.ReadMessage(strings.NewReader(string(raw)))
 	if err != nil {
 		return
 	}
-	date, err := msg.Header.Date()
-	if err != nil || date.IsZero() {
+	date := eml.ParseDate(msg.Header.Get("Date"))
+	if date.IsZero() {
 		return
 	}
 	os.Chtimes(path, date, date)
@@ -195,9 +245,61 @@ func pop3Stat(conn net.Conn, reader *bufio.Reader) (int, error) {
 	return count, nil
 }
 
+// pop3Uidl lists the unique-id of every message, keyed by message number.
+// It returns nil without error when the server does not support UIDL.
+func pop3Uidl(conn net.Conn, reader *bufio.Reader) (map[int]string, error) {
+	if _, err := conn.Write([]byte("UIDL\r\n")); err != nil {
+		return nil, err
+	}
+	line, err := readPOP3Line(reader)
+	if err != nil {
+		return nil, err
+	}
+	if !strings.HasPrefix(line, "+OK") {
+		return nil, nil
+	}
+	uidls := make(map[int]string)
+	for {
+		line, err := readPOP3Line(reader)
+		if err != nil {
+			return nil, err
+		}
+		if line == "." {
+			return uidls, nil
+		}
+		var n int
+		var uid string
+		if _, err := fmt.Sscanf(line, "%d %s", &n, &uid); err == nil && uid != "" {
+			uidls[n] = uid
+		}
+	}
+}
+
+// receivedBefore reports whether message msgNum is dated before since,
+// reading only its headers. Messages without a usable Date are kept.
+func receivedBefore(conn net.Conn, reader *bufio.Reader, msgNum int, since time.Time) (bool, error) {
+	head, err := pop3Multiline(conn, reader, "TOP", fmt.Sprintf("TOP %d 0", msgNum))
+	if err != nil {
+		return false, err
+	}
+	msg, err := mail.ReadMessage(bytes.NewReader(append(head, "\r\n"...)))
+	if err != nil {
+		return false, nil
+	}
+	date := eml.ParseDate(msg.Header.Get("Date"))
+	if date.IsZero() {
+		return false, nil
+	}
+	return date.Before(since), nil
+}
+
 func pop3Retr(conn net.Conn, reader *bufio.Reader, msgNum int) ([]byte, error) {
-	cmd := fmt.Sprintf("RETR %d\r\n", msgNum)
-	if _, err := conn.Write([]byte(cmd)); err != nil {
+	return pop3Multiline(conn, reader, "RETR", fmt.Sprintf("RETR %d", msgNum))
+}
+
+// pop3Multiline sends cmd and returns its dot-terminated response.
+func pop3Multiline(conn net.Conn, reader *bufio.Reader, name, cmd string) ([]byte, error) {
+	if _, err := conn.Write([]byte(cmd + "\r\n")); err != nil {
 		return nil, err
 	}
 	line, err := readPOP3Line(reader)
@@ -205,7 +307,7 @@ func pop3Retr(conn net.Conn, reader *bufio.Reader, msgNum int) ([]byte, error) {
 		return nil, err
 	}
 	if !strings.HasPrefix(line, "+OK") {
-		return nil, fmt.Errorf("POP3 RETR error: %s", line)
+		return nil, fmt.Errorf("POP3 %s error: %s", name, line)
 	}
 
 	// Read multi-line response until "."
@@ -0,0 +1,195 @@
+package pop3
+
+import (
+	"bufio"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/eslider/mails/internal/model"
+)
+
+type memState struct {
+	mu   sync.Mutex
+	uids map[string]bool
+}
+
+func (s *memState) IsUIDSynced(accountID, folder, uid string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.uids[accountID+"/"+folder+"/"+uid]
+}
+
+func (s *memState) MarkUIDSynced(accountID, folder, uid string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.uids[accountID+"/"+folder+"/"+uid] = true
+	return nil
+}
+
+type fakeMessage struct {
+	uidl, body string
+}
+
+// fakePOP3 serves the current mailbox to each connection and counts RETRs.
+type fakePOP3 struct {
+	mu      sync.Mutex
+	mailbox []fakeMessage
+	uidl    bool
+	noTop   bool
+	retrs   int
+}
+
+func (f *fakePOP3) serve(t *testing.T) (host string, port int) {
+	t.Helper()
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { l.Close() })
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			go f.session(conn)
+		}
+	}()
+	addr := l.Addr().(*net.TCPAddr)
+	return addr.IP.String(), addr.Port
+}
+
+func (f *fakePOP3) session(conn net.Conn) {
+	defer conn.Close()
+	f.mu.Lock()
+	box := append([]fakeMessage(nil), f.mailbox...)
+	f.mu.Unlock()
+
+	r := bufio.NewReader(conn)
+	fmt.Fprint(conn, "+OK ready\r\n")
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			return
+		}
+		cmd := strings.Fields(strings.TrimSpace(line))
+		switch strings.ToUpper(cmd[0]) {
+		case "STAT":
+			fmt.Fprintf(conn, "+OK %d 0\r\n", len(box))
+		case "UIDL":
+			if !f.uidl {
+				fmt.Fprint(conn, "-ERR unsupported\r\n")
+				continue
+			}
+			fmt.Fprint(conn, "+OK\r\n")
+			for i, m := range box {
+				fmt.Fprintf(conn, "%d %s\r\n", i+1, m.uidl)
+			}
+			fmt.Fprint(conn, ".\r\n")
+		case "RETR":
+			n, _ := strconv.Atoi(cmd[1])
+			f.mu.Lock()
+			f.retrs++
+			f.mu.Unlock()
+			fmt.Fprintf(conn, "+OK\r\n%s\r\n.\r\n", box[n-1].body)
+		case "TOP":
+			n, _ := strconv.Atoi(cmd[1])
+			if f.noTop {
+				fmt.Fprint(conn, "-ERR unsupported\r\n")
+				continue
+			}
+			head, _, _ := strings.Cut(box[n-1].body, "\r\n\r\n")
+			fmt.Fprintf(conn, "+OK\r\n%s\r\n\r\n.\r\n", head)
+		case "QUIT":
+			fmt.Fprint(conn, "+OK bye\r\n")
+			return
+		default:
+			fmt.Fprint(conn, "+OK\r\n")
+		}
+	}
+}
+
+func message(subject string) string {
+	return "From: a@example.com\r\nSubject: " + subject + "\r\n\r\nbody of " + subject
+}
+
+func TestSyncKeysOnUIDL(t *testing.T) {
+	srv := &fakePOP3{uidl: true, mailbox: []fakeMessage{
+		{"uid-a", message("a")}, {"uid-b", message("b")},
+	}}
+	host, port := srv.serve(t)
+	acct := model.EmailAccount{ID: "p1", Email: "me@example.com", Host: host, Port: port, Password: "pw"}
+	state := &memState{uids: make(map[string]bool)}
+	dir := t.TempDir()
+
+	if n, err := Sync(acct, dir, state); err != nil || n != 2 {
+		t.Fatalf("first sync = %d, %v; want 2", n, err)
+	}
+
+	// The server renumbers: a message is gone and a new one arrives first.
+	srv.mu.Lock()
+	srv.mailbox = []fakeMessage{{"uid-c", message("c")}, {"uid-b", message("b")}}
+	srv.retrs = 0
+	srv.mu.Unlock()
+
+	if n, err := Sync(acct, dir, state); err != nil || n != 1 {
+		t.Fatalf("second sync = %d, %v; want 1", n, err)
+	}
+	if srv.retrs != 1 {
+		t.Errorf("second sync retrieved %d messages, want only the new one", srv.retrs)
+	}
+	if !state.IsUIDSynced("p1", uidlFolder, "uid-c") {
+		t.Error("UIDL of the new message not recorded")
+	}
+}
+
+func TestSyncWithoutUIDL(t *testing.T) {
+	srv := &fakePOP3{mailbox: []fakeMessage{{"", message("a")}, {"", message("b")}}}
+	host, port := srv.serve(t)
+	acct := model.EmailAccount{ID: "p1", Email: "me@example.com", Host: host, Port: port, Password: "pw"}
+	state := &memState{uids: make(map[string]bool)}
+	dir := t.TempDir()
+
+	if n, err := Sync(acct, dir, state); err != nil || n != 2 {
+		t.Fatalf("first sync = %d, %v; want 2", n, err)
+	}
+	// Content hashes still prevent duplicates, at the cost of a RETR each.
+	if n, err := Sync(acct, dir, state); err != nil || n != 0 {
+		t.Fatalf("second sync = %d, %v; want 0", n, err)
+	}
+}
+
+func TestSyncSince(t *testing.T) {
+	dated := func(subject, date string) string {
+		return "From: a@example.com\r\nSubject: " + subject + "\r\nDate: " + date + "\r\n\r\nbody of " + subject
+	}
+	mailbox := []fakeMessage{
+		{"uid-old", dated("old", "Mon, 10 Feb 2020 09:00:00 +0000")},
+		{"uid-new", dated("new", "Mon, 10 Feb 2025 09:00:00 +0000")},
+		{"uid-undated", message("undated")},
+	}
+	since := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	for _, noTop := range []bool{false, true} {
+		srv := &fakePOP3{uidl: true, noTop: noTop, mailbox: mailbox}
+		host, port := srv.serve(t)
+		acct := model.EmailAccount{ID: "p1", Email: "me@example.com", Host: host, Port: port, Password: "pw", SyncSince: since}
+		state := &memState{uids: make(map[string]bool)}
+
+		want := 2 // the old message is never retrieved
+		if noTop {
+			want = 3
+		}
+		if n, err := Sync(acct, t.TempDir(), state); err != nil || n != want || srv.retrs != want {
+			t.Errorf("noTop=%v: sync = %d (%d RETRs), %v; want %d", noTop, n, srv.retrs, err, want)
+		}
+		if !noTop && state.IsUIDSynced("p1", uidlFolder, "uid-old") {
+			t.Error("skipped message must not be marked synced, so an earlier SyncSince still fetches it")
+		}
+	}
+}
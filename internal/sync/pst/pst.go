@@ -5,14 +5,15 @@
 package pst
 
 import (
-	"crypto/sha256"
 	"fmt"
 	"io"
 	"log"
 	"os"
 	"os/exec"
 	"path/filepath"
+	"strconv"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/mooijtech/go-pst/v6/pkg"
@@ -22,6 +23,8 @@ import (
 	"golang.org/x/text/encoding"
 
 	charsets "github.com/emersion/go-message/charset"
+
+	"github.com/eslider/mails/internal/checksum"
 )
 
 // MAPI property IDs for common item properties (PidTagSubject, PidTagBody).
@@ -75,6 +78,42 @@ func Import(pstPath, emailDir string, onProgress ProgressFunc, saveFn SaveEmailF
 	return importReadpst(pstPath, emailDir, onProgress)
 }
 
+// defaultWorkers is the number of goroutines writing extracted items when
+// PST_WORKERS is unset.
+const defaultWorkers = 4
+
+// workersFromEnv reads PST_WORKERS; invalid or non-positive values keep the default.
+func workersFromEnv() int {
+	if n, err := strconv.Atoi(os.Getenv("PST_WORKERS")); err == nil && n > 0 {
+		return n
+	}
+	return defaultWorkers
+}
+
+// extractedItem is one converted PST item waiting to be written.
+type extractedItem struct {
+	dir  string
+	seq  int
+	data []byte
+	ext  string
+	date time.Time
+}
+
+// countMessages sums the folder message counts, which go-pst reads from the
+// folder table without touching the messages themselves.
+func countMessages(pstFile *pst.File) int {
+	total := 0
+	if err := pstFile.WalkFolders(func(folder *pst.Folder) error {
+		if folder.MessageCount > 0 {
+			total += int(folder.MessageCount)
+		}
+		return nil
+	}); err != nil {
+		log.Printf("WARN: PST count pass: %v", err)
+	}
+	return total
+}
+
 func importGoPst(pstPath, emailDir string, onProgress ProgressFunc, saveFn SaveEmailFunc) (int, int, error) {
 	f, err := os.Open(pstPath)
 	if err != nil {
@@ -88,74 +127,114 @@ func importGoPst(pstPath, emailDir string, onProgress ProgressFunc, saveFn SaveE
 	}
 	defer pstFile.Cleanup()
 
-	var extracted, errCount int
-
-	onProgress("extracting", 0, 0)
-
-	if err := pstFile.WalkFolders(func(folder *pst.Folder) error {
-		folderPath := sanitizeFolderName(folder.Name)
-		dir := filepath.Join(emailDir, folderPath)
-		if saveFn == nil {
-			if err := os.MkdirAll(dir, 0o755); err != nil {
-				return err
+	onProgress("counting", 0, 0)
+	total := countMessages(pstFile)
+	onProgress("extracting", 0, total)
+
+	// go-pst readers are not safe for concurrent use, so items are read and
+	// converted on this goroutine; checksumming and writing (the slow part,
+	// especially to S3) fan out to a worker pool.
+	var (
+		mu        sync.Mutex
+		extracted int
+		errCount  int
+	)
+	items := make(chan extractedItem, 64)
+	var wg sync.WaitGroup
+	for range workersFromEnv() {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for it := range items {
+				ok := writeItem(it, saveFn)
+				mu.Lock()
+				if ok {
+					extracted++
+					if extracted%100 == 0 {
+						onProgress("extracting", extracted, total)
+					}
+				} else {
+					errCount++
+				}
+				mu.Unlock()
 			}
-		}
-
-		iter, err := folder.GetMessageIterator()
-		if eris.Is(err, pst.ErrMessagesNotFound) {
-			return nil
-		} else if err != nil {
-			log.Printf("WARN: PST folder %q: %v", folder.Name, err)
-			return nil
-		}
+		}()
+	}
 
-		for iter.Next() {
-			msg := iter.Value()
-			data, ext, date := itemToStoredFormat(msg, folderPath)
-			if data == nil {
-				errCount++
-				continue
+	seq := 0
+	walkErr := func() error {
+		// Always let the workers finish, even if the walk panics (Import
+		// recovers and falls back to readpst).
+		defer func() {
+			close(items)
+			wg.Wait()
+		}()
+		return pstFile.WalkFolders(func(folder *pst.Folder) error {
+			folderPath := sanitizeFolderName(folder.Name)
+			dir := filepath.Join(emailDir, folderPath)
+			if saveFn == nil {
+				if err := os.MkdirAll(dir, 0o755); err != nil {
+					return err
+				}
 			}
 
-			checksum := contentChecksum(data)
-			filename := fmt.Sprintf("%s-%d.%s", checksum, extracted, ext)
-			path := filepath.Join(dir, filename)
+			iter, err := folder.GetMessageIterator()
+			if eris.Is(err, pst.ErrMessagesNotFound) {
+				return nil
+			} else if err != nil {
+				log.Printf("WARN: PST folder %q: %v", folder.Name, err)
+				return nil
+			}
 
-			if saveFn != nil {
-				if err := saveFn(path, data); err != nil {
-					log.Printf("WARN: write %s: %v", path, err)
+			for iter.Next() {
+				data, ext, date := itemToStoredFormat(iter.Value(), folderPath)
+				if data == nil {
+					mu.Lock()
 					errCount++
+					mu.Unlock()
 					continue
 				}
-			} else if err := os.WriteFile(path, data, 0o644); err != nil {
-				log.Printf("WARN: write %s: %v", path, err)
-				errCount++
-				continue
+				items <- extractedItem{dir: dir, seq: seq, data: data, ext: ext, date: date}
+				seq++
 			}
 
-			if saveFn == nil && !date.IsZero() {
-				os.Chtimes(path, date, date)
+			if iter.Err() != nil {
+				log.Printf("WARN: PST iterator %q: %v", folder.Name, iter.Err())
 			}
-
-			extracted++
-			if extracted%100 == 0 {
-				onProgress("extracting", extracted, 0)
-			}
-		}
-
-		if iter.Err() != nil {
-			log.Printf("WARN: PST iterator %q: %v", folder.Name, iter.Err())
-		}
-
-		return nil
-	}); err != nil {
-		return extracted, errCount, fmt.Errorf("walk PST: %w", err)
+			return nil
+		})
+	}()
+	if walkErr != nil {
+		return extracted, errCount, fmt.Errorf("walk PST: %w", walkErr)
 	}
 
 	onProgress("done", extracted, extracted)
 	return extracted, errCount, nil
 }
 
+// writeItem stores one item as {checksum}-{seq}.{ext}. The sequence number
+// keeps names unique when identical items appear more than once.
+func writeItem(it extractedItem, saveFn SaveEmailFunc) bool {
+	filename := fmt.Sprintf("%s-%d.%s", checksum.Sum(it.data), it.seq, it.ext)
+	path := filepath.Join(it.dir, filename)
+
+	if saveFn != nil {
+		if err := saveFn(path, it.data); err != nil {
+			log.Printf("WARN: write %s: %v", path, err)
+			return false
+		}
+		return true
+	}
+	if err := os.WriteFile(path, it.data, 0o644); err != nil {
+		log.Printf("WARN: write %s: %v", path, err)
+		return false
+	}
+	if !it.date.IsZero() {
+		os.Chtimes(path, it.date, it.date)
+	}
+	return true
+}
+
 // itemToStoredFormat converts a PST item to the appropriate storage format.
 // Returns (data, ext, date). ext is "eml", "vcf", "ics", or "txt".
 func itemToStoredFormat(msg *pst.Message, folderPath string) ([]byte, string, time.Time) {
@@ -429,11 +508,6 @@ func escapeHeader(s string) string {
 	return s
 }
 
-func contentChecksum(data []byte) string {
-	h := sha256.Sum256(data)
-	return fmt.Sprintf("%x", h[:8])
-}
-
 // importReadpst uses the readpst command (pst-utils) when go-pst fails.
 // Requires: apt install pst-utils (Debian/Ubuntu) or equivalent.
 func importReadpst(pstPath, emailDir string, onProgress ProgressFunc) (int, int, error) {
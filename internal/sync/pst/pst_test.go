@@ -5,6 +5,7 @@ import (
 	"os/exec"
 	"path/filepath"
 	"runtime"
+	"sort"
 	"strings"
 	"testing"
 )
@@ -98,9 +99,10 @@ func TestImportFromDataFiles(t *testing.T) {
 	}
 }
 
-// TestImportExtractionWorks verifies email extraction using go-pst's bundled test fixtures.
-// Ensures Import produces .eml files when given a compatible PST.
-func TestImportExtractionWorks(t *testing.T) {
+// goPstFixture returns a PST from go-pst's bundled test data, skipping the
+// test when none is available.
+func goPstFixture(t *testing.T) string {
+	t.Helper()
 	gopstData, ok := goPstDataDir()
 	if !ok {
 		t.Skip("go-pst module data dir not found")
@@ -138,6 +140,13 @@ func TestImportExtractionWorks(t *testing.T) {
 	if pstPath == "" {
 		pstPath = files[0]
 	}
+	return pstPath
+}
+
+// TestImportExtractionWorks verifies email extraction using go-pst's bundled test fixtures.
+// Ensures Import produces .eml files when given a compatible PST.
+func TestImportExtractionWorks(t *testing.T) {
+	pstPath := goPstFixture(t)
 
 	emailDir := t.TempDir()
 	extracted, errCount, err := Import(pstPath, emailDir, func(phase string, current, total int) {}, nil)
@@ -192,6 +201,50 @@ func TestImportExtractionWorks(t *testing.T) {
 	t.Logf("extracted %d items (eml/vcf/ics/txt), %d errors", extracted, errCount)
 }
 
+// TestImportWorkersMatchSequential checks the worker pool extracts the same
+// items as a single worker and that progress reports a message total.
+func TestImportWorkersMatchSequential(t *testing.T) {
+	pstPath := goPstFixture(t)
+
+	run := func(workers string) (int, []string, int) {
+		t.Setenv("PST_WORKERS", workers)
+		emailDir := t.TempDir()
+		var maxTotal int
+		extracted, _, err := Import(pstPath, emailDir, func(phase string, current, total int) {
+			if phase == "extracting" && total > maxTotal {
+				maxTotal = total
+			}
+		}, nil)
+		if err != nil {
+			t.Fatalf("Import (PST_WORKERS=%s): %v", workers, err)
+		}
+		// Undated items embed the import time, so compare folder and
+		// extension rather than checksums.
+		var files []string
+		filepath.Walk(emailDir, func(path string, info os.FileInfo, err error) error {
+			if err == nil && !info.IsDir() {
+				rel, _ := filepath.Rel(emailDir, path)
+				files = append(files, filepath.Dir(rel)+"/*"+filepath.Ext(rel))
+			}
+			return nil
+		})
+		sort.Strings(files)
+		return extracted, files, maxTotal
+	}
+
+	n1, files1, total := run("1")
+	n8, files8, _ := run("8")
+	if n1 != n8 {
+		t.Fatalf("extracted %d with 1 worker, %d with 8", n1, n8)
+	}
+	if strings.Join(files1, ",") != strings.Join(files8, ",") {
+		t.Errorf("1 and 8 workers produced different items")
+	}
+	if n1 > 0 && total == 0 {
+		t.Errorf("progress never reported a message total")
+	}
+}
+
 // verifyNonEmailFormats checks that extracted .vcf, .ics, .txt files have valid content.
 func verifyNonEmailFormats(t *testing.T, emailDir string) {
 	var vcfCount, icsCount, txtCount int
@@ -2,19 +2,25 @@ package sync
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"log"
 	"os"
 	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
 	"sync"
 	"time"
 
 	"github.com/eslider/mails/internal/account"
 	"github.com/eslider/mails/internal/model"
+	"github.com/eslider/mails/internal/search/eml"
 	"github.com/eslider/mails/internal/search/index"
 	"github.com/eslider/mails/internal/storage"
 	sync_gmail "github.com/eslider/mails/internal/sync/gmail"
 	sync_imap "github.com/eslider/mails/internal/sync/imap"
+	sync_maildir "github.com/eslider/mails/internal/sync/maildir"
 	sync_pop3 "github.com/eslider/mails/internal/sync/pop3"
 	sync_pst "github.com/eslider/mails/internal/sync/pst"
 )
@@ -22,9 +28,16 @@ import (
 // syncEntry tracks a running sync's cancel function and progress.
 type syncEntry struct {
 	cancel    context.CancelFunc
+	userID    string
 	startedAt time.Time
 	progress  string // human-readable status
 	lastError string
+
+	// Structured IMAP progress; zero until the first folder starts.
+	foldersDone   int
+	foldersTotal  int
+	messagesDone  int
+	messagesTotal int
 }
 
 // Service orchestrates email sync for all accounts of a user.
@@ -34,26 +47,83 @@ type Service struct {
 	accounts  *account.Store
 	blobStore storage.BlobStore
 	running   map[string]*syncEntry // accountID -> entry
+
+	// maxFailures is how many consecutive failed syncs auto-pause an
+	// account; 0 disables auto-pause.
+	maxFailures int
+
+	// quota is the per-user archive size limit in bytes; 0 means none.
+	quota int64
+	usage usageCache
+
+	folders folderCache
+
+	// webhookURL receives a NewMailEvent after syncs that found new
+	// mail, from SYNC_WEBHOOK_URL; empty disables it.
+	webhookURL string
+
+	// liveIndexInterval is the pause between index refreshes while a sync
+	// runs, from LIVE_INDEX_INTERVAL; 0 disables them.
+	liveIndexInterval time.Duration
+}
+
+// defaultMaxFailures is the SYNC_MAX_FAILURES default.
+const defaultMaxFailures = 5
+
+// maxFailuresFromEnv reads SYNC_MAX_FAILURES; 0 disables auto-pause and
+// invalid or negative values keep the default.
+func maxFailuresFromEnv() int {
+	if n, err := strconv.Atoi(os.Getenv("SYNC_MAX_FAILURES")); err == nil && n >= 0 {
+		return n
+	}
+	return defaultMaxFailures
+}
+
+// defaultLiveIndexInterval is the LIVE_INDEX_INTERVAL default.
+const defaultLiveIndexInterval = 5 * time.Second
+
+// liveIndexIntervalFromEnv reads LIVE_INDEX_INTERVAL as a duration; 0
+// disables live indexing and invalid or negative values keep the default.
+func liveIndexIntervalFromEnv() time.Duration {
+	if d, err := time.ParseDuration(os.Getenv("LIVE_INDEX_INTERVAL")); err == nil && d >= 0 {
+		return d
+	}
+	return defaultLiveIndexInterval
 }
 
 // NewService creates a sync service. blobStore may be nil to use local filesystem only.
 func NewService(usersDir string, accounts *account.Store, blobStore storage.BlobStore) *Service {
 	return &Service{
-		usersDir:  usersDir,
-		accounts:  accounts,
-		blobStore: blobStore,
-		running:   make(map[string]*syncEntry),
+		usersDir:    usersDir,
+		accounts:    accounts,
+		blobStore:   blobStore,
+		running:     make(map[string]*syncEntry),
+		maxFailures: maxFailuresFromEnv(),
+		quota:       quotaFromEnv(),
+		webhookURL:  webhookURLFromEnv(),
+
+		liveIndexInterval: liveIndexIntervalFromEnv(),
 	}
 }
 
+// ErrImportOnly is returned by SyncAccount for accounts that cannot sync,
+// such as PST archives.
+var ErrImportOnly = errors.New("account is import-only")
+
 // SyncAccount triggers a sync for a single account. Non-blocking; runs in background.
 func (s *Service) SyncAccount(userID, accountID string) error {
 	acct, err := s.accounts.Get(userID, accountID)
 	if err != nil {
 		return err
 	}
-	if acct.Type == model.AccountTypePST {
-		return fmt.Errorf("PST accounts are import-only; use Import to add emails")
+	if !acct.Type.Syncable() {
+		return fmt.Errorf("%s (%s): %w; use Import to add emails", acct.Email, acct.Type, ErrImportOnly)
+	}
+	if acct.ReadOnly() {
+		return fmt.Errorf("%s: %w; its mail is read from %s", acct.Email, account.ErrReadOnly, acct.EmailDirOverride)
+	}
+	if err := s.CheckQuota(userID); err != nil {
+		return err
 	}
 
 	s.mu.Lock()
@@ -65,6 +135,7 @@ func (s *Service) SyncAccount(userID, accountID string) error {
 	ctx, cancel := context.WithCancel(context.Background())
 	s.running[accountID] = &syncEntry{
 		cancel:    cancel,
+		userID:    userID,
 		startedAt: time.Now(),
 		progress:  "starting",
 	}
@@ -105,17 +176,17 @@ func (s *Service) SyncAccount(userID, accountID string) error {
 		emailDir := account.EmailDir(s.usersDir, userID, *acct)
 		indexPath := account.IndexPath(s.usersDir, userID, *acct)
 
-		// Start live indexing goroutine: rebuild index every 5s during sync.
+		// Start live indexing goroutine: refresh the index during sync.
 		indexCtx, indexCancel := context.WithCancel(ctx)
 		var indexWg sync.WaitGroup
 		indexWg.Add(1)
 		go func() {
 			defer indexWg.Done()
-			s.liveIndex(indexCtx, emailDir, indexPath, accountID)
+			s.liveIndex(indexCtx, emailDir, indexPath, acct.ExcludeFolders, accountID)
 		}()
 
 		s.setProgress(accountID, "syncing", "")
-		saveFn := s.makeSaveEmailFunc()
+		saveFn := s.makeSaveEmailFunc(userID)
 		newMsgs, syncErr := s.doSync(ctx, *acct, emailDir, stateDB, accountID, saveFn)
 
 		// Stop live indexing and wait for it to fully exit before final rebuild.
@@ -130,20 +201,66 @@ func (s *Service) SyncAccount(userID, accountID string) error {
 			job.Error = syncErr.Error()
 			s.setProgress(accountID, "", syncErr.Error())
 			log.Printf("ERROR: sync %s (%s): %v", acct.Email, acct.Type, syncErr)
+			// A user-initiated stop is not a failure of the account.
+			if ctx.Err() == nil {
+				s.recordFailure(stateDB, userID, *acct, syncErr)
+			}
 		} else {
 			job.Status = model.SyncStatusDone
 			s.setProgress(accountID, "done", "")
 			log.Printf("INFO: synced %s (%s): %d new messages", acct.Email, acct.Type, newMsgs)
+			if err := stateDB.ResetFailures(accountID); err != nil {
+				log.Printf("WARN: reset sync failures for %s: %v", acct.Email, err)
+			}
 		}
 		stateDB.UpdateJob(job)
+		if n, err := stateDB.Compact(); err != nil {
+			log.Printf("WARN: compact sync state for %s: %v", acct.Email, err)
+		} else if n > 0 {
+			log.Printf("INFO: compacted %d synced UIDs for %s", n, acct.Email)
+		}
 
 		// Final index rebuild after sync completes.
-		s.rebuildIndex(emailDir, indexPath)
+		s.rebuildIndex(emailDir, indexPath, acct.ExcludeFolders)
+		s.usage.invalidate(emailDir)
+
+		if newMsgs > 0 && s.webhookURL != "" {
+			ev := NewMailEvent{
+				UserID:      userID,
+				AccountID:   accountID,
+				Account:     acct.Email,
+				AccountType: acct.Type,
+				NewMessages: newMsgs,
+				Subjects:    s.newestSubjects(emailDir, indexPath, min(newMsgs, webhookSubjects)),
+				FinishedAt:  now,
+			}
+			go s.notifyNewMail(ev)
+		}
 	}()
 
 	return nil
 }
 
+// recordFailure bumps the account's consecutive failure count and pauses
+// scheduled sync once it reaches maxFailures, so a stale password does not
+// keep hitting the server (and risk a lockout). Manual syncs still run.
+func (s *Service) recordFailure(stateDB *StateDB, userID string, acct model.EmailAccount, syncErr error) {
+	n, err := stateDB.RecordFailure(acct.ID)
+	if err != nil {
+		log.Printf("WARN: record sync failure for %s: %v", acct.Email, err)
+		return
+	}
+	if s.maxFailures == 0 || n < s.maxFailures || !acct.Sync.Enabled {
+		return
+	}
+	reason := fmt.Sprintf("paused after %d consecutive failed syncs: %v", n, syncErr)
+	if err := s.accounts.AutoPause(userID, acct.ID, reason); err != nil {
+		log.Printf("WARN: auto-pause %s: %v", acct.Email, err)
+		return
+	}
+	log.Printf("WARN: %s auto-paused after %d consecutive failures", acct.Email, n)
+}
+
 // StopSync cancels a running sync for the given account.
 func (s *Service) StopSync(accountID string) error {
 	s.mu.Lock()
@@ -159,19 +276,23 @@ func (s *Service) StopSync(accountID string) error {
 	return nil
 }
 
-// SyncAll triggers sync for all accounts of a user.
+// SyncAll triggers sync for all accounts of a user. Paused accounts
+// (Sync.Enabled=false) are skipped; use SyncAccount to run them manually.
 func (s *Service) SyncAll(userID string) error {
 	accounts, err := s.accounts.List(userID)
 	if err != nil {
 		return err
 	}
+	if err := s.CheckQuota(userID); err != nil {
+		return err
+	}
 
 	for _, acct := range accounts {
-		if acct.Type == model.AccountTypePST {
-			continue // PST is import-only
+		if !acct.Type.Syncable() || acct.ReadOnly() {
+			continue // import-only or read-only
 		}
 		if !acct.Sync.Enabled {
-			continue
+			continue // paused
 		}
 		if err := s.SyncAccount(userID, acct.ID); err != nil {
 			log.Printf("WARN: skip sync %s: %v", acct.Email, err)
@@ -188,19 +309,99 @@ func (s *Service) IsRunning(accountID string) bool {
 	return ok
 }
 
+// RunningSync is a sync in progress, as RunningSyncs lists it.
+type RunningSync struct {
+	UserID    string    `json:"user_id"`
+	AccountID string    `json:"account_id"`
+	Account   string    `json:"account"` // the account's email; empty if it was deleted
+	StartedAt time.Time `json:"started_at"`
+	Progress  string    `json:"progress"`
+	LastError string    `json:"last_error,omitempty"`
+
+	// IMAP progress, as in AccountStatus; zero until the first folder starts.
+	FoldersDone   int `json:"folders_done,omitempty"`
+	FoldersTotal  int `json:"folders_total,omitempty"`
+	MessagesDone  int `json:"messages_done,omitempty"`
+	MessagesTotal int `json:"messages_total,omitempty"`
+}
+
+// RunningSyncs returns the syncs in progress for every user, oldest
+// first, for operators of shared instances.
+func (s *Service) RunningSyncs() []RunningSync {
+	s.mu.Lock()
+	syncs := make([]RunningSync, 0, len(s.running))
+	for accountID, e := range s.running {
+		syncs = append(syncs, RunningSync{
+			UserID:        e.userID,
+			AccountID:     accountID,
+			StartedAt:     e.startedAt,
+			Progress:      e.progress,
+			LastError:     e.lastError,
+			FoldersDone:   e.foldersDone,
+			FoldersTotal:  e.foldersTotal,
+			MessagesDone:  e.messagesDone,
+			MessagesTotal: e.messagesTotal,
+		})
+	}
+	s.mu.Unlock()
+
+	for i, rs := range syncs {
+		if acct, err := s.accounts.Get(rs.UserID, rs.AccountID); err == nil {
+			syncs[i].Account = acct.Email
+		}
+	}
+	slices.SortFunc(syncs, func(a, b RunningSync) int {
+		if c := a.StartedAt.Compare(b.StartedAt); c != 0 {
+			return c
+		}
+		return strings.Compare(a.AccountID, b.AccountID)
+	})
+	return syncs
+}
+
 // AccountStatus returns the current sync status for a single account.
+// Import-only and read-only accounts get a fixed status with
+// syncable=false and no errors from sync attempts made before they were
+// recognised as such.
 func (s *Service) AccountStatus(userID string, acct model.EmailAccount) map[string]any {
+	if !acct.Type.Syncable() || acct.ReadOnly() {
+		status := map[string]any{
+			"id":          acct.ID,
+			"name":        acct.Email,
+			"type":        string(acct.Type),
+			"syncing":     false,
+			"syncable":    false,
+			"import_only": true,
+		}
+		if acct.ReadOnly() {
+			status["read_only"] = true
+		}
+		s.addSize(status, userID, acct)
+		return status
+	}
+
 	syncing := s.IsRunning(acct.ID)
 	status := map[string]any{
-		"id":      acct.ID,
-		"name":    acct.Email,
-		"type":    string(acct.Type),
-		"syncing": syncing,
+		"id":       acct.ID,
+		"name":     acct.Email,
+		"type":     string(acct.Type),
+		"syncing":  syncing,
+		"syncable": true,
+		"paused":   !acct.Sync.Enabled,
+	}
+	if acct.Sync.PausedReason != "" {
+		status["paused_reason"] = acct.Sync.PausedReason
 	}
 
 	s.mu.Lock()
 	if entry, ok := s.running[acct.ID]; ok {
 		status["progress"] = entry.progress
+		if entry.foldersTotal > 0 {
+			status["folders_done"] = entry.foldersDone
+			status["folders_total"] = entry.foldersTotal
+			status["messages_done"] = entry.messagesDone
+			status["messages_total"] = entry.messagesTotal
+		}
 		status["started_at"] = entry.startedAt.Unix()
 		if entry.lastError != "" {
 			status["last_error"] = entry.lastError
@@ -220,11 +421,39 @@ func (s *Service) AccountStatus(userID string, acct model.EmailAccount) map[stri
 				status["last_error"] = job.Error
 			}
 		}
+		if n, err := stateDB.ConsecutiveFailures(acct.ID); err == nil {
+			status["consecutive_failures"] = n
+		}
+		seen, err := stateDB.LastSeen(acct.ID)
+		if err == nil && !seen.IsZero() {
+			status["last_viewed"] = seen.Unix()
+		}
+		if n, latest, err := stateDB.NewSince(acct.ID, seen); err == nil {
+			status["new_since_last_view"] = n
+			if n > 0 {
+				status["new_latest_at"] = latest.Unix()
+			}
+		}
 	}
 
+	s.addSize(status, userID, acct)
 	return status
 }
 
+// MarkSeen records that the user has looked at the account's mail now,
+// resetting new_since_last_view in AccountStatus.
+func (s *Service) MarkSeen(userID, accountID string) error {
+	if _, err := s.accounts.Get(userID, accountID); err != nil {
+		return err
+	}
+	stateDB, err := OpenStateDB(s.usersDir, userID)
+	if err != nil {
+		return err
+	}
+	defer stateDB.Close()
+	return stateDB.MarkSeen(accountID, time.Now())
+}
+
 func (s *Service) setProgress(accountID, progress, lastError string) {
 	s.mu.Lock()
 	if entry, ok := s.running[accountID]; ok {
@@ -238,36 +467,67 @@ func (s *Service) setProgress(accountID, progress, lastError string) {
 	s.mu.Unlock()
 }
 
-func (s *Service) makeSaveEmailFunc() sync_imap.SaveEmailFunc {
-	if s.blobStore == nil {
+// setIMAPProgress records a structured IMAP progress update.
+func (s *Service) setIMAPProgress(accountID string, p sync_imap.Progress) {
+	s.mu.Lock()
+	if entry, ok := s.running[accountID]; ok {
+		if p.Message != "" {
+			entry.progress = p.Message
+		}
+		if p.FoldersTotal > 0 {
+			entry.foldersDone = p.FoldersDone
+			entry.foldersTotal = p.FoldersTotal
+			entry.messagesDone = p.MessagesDone
+			entry.messagesTotal = p.MessagesTotal
+		}
+	}
+	s.mu.Unlock()
+}
+
+// makeSaveEmailFunc returns how sync and imports store userID's emails:
+// in the blob store, and sealed when EMAIL_ENCRYPTION_KEY is set (see
+// eml.Seal). It is nil, leaving the writers to os.WriteFile, when neither
+// applies.
+func (s *Service) makeSaveEmailFunc(userID string) sync_imap.SaveEmailFunc {
+	if s.blobStore == nil && !eml.Seals() {
 		return nil
 	}
 	return func(path string, data []byte) error {
+		sealed, err := eml.Seal(userID, data)
+		if err != nil {
+			return err
+		}
+		if s.blobStore == nil {
+			return writeSealed(path, data, sealed)
+		}
 		rel, err := filepath.Rel(s.usersDir, path)
 		if err != nil {
 			return err
 		}
-		return s.blobStore.Write(context.Background(), filepath.ToSlash(rel), data)
+		return s.blobStore.Write(context.Background(), filepath.ToSlash(rel), sealed)
 	}
 }
 
-func (s *Service) makePstSaveFunc() sync_pst.SaveEmailFunc {
-	if s.blobStore == nil {
-		return nil
+// writeSealed writes sealed, the sealed form of the email data, to path
+// with its mtime set from data's headers, as the writers do for plain
+// files.
+func writeSealed(path string, data, sealed []byte) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return err
 	}
-	return sync_pst.SaveEmailFunc(func(path string, data []byte) error {
-		rel, err := filepath.Rel(s.usersDir, path)
-		if err != nil {
-			return err
-		}
-		return s.blobStore.Write(context.Background(), filepath.ToSlash(rel), data)
-	})
+	if err := os.WriteFile(path, sealed, 0o644); err != nil {
+		return err
+	}
+	if date := eml.HeaderDate(data); !date.IsZero() {
+		os.Chtimes(path, date, date)
+	}
+	return nil
 }
 
 func (s *Service) doSync(ctx context.Context, acct model.EmailAccount, emailDir string, stateDB *StateDB, accountID string, saveFn sync_imap.SaveEmailFunc) (int, error) {
 	// Progress callback: update in-memory progress visible via API.
-	onProgress := func(msg string) {
-		s.setProgress(accountID, msg, "")
+	onProgress := func(p sync_imap.Progress) {
+		s.setIMAPProgress(accountID, p)
 	}
 
 	switch acct.Type {
@@ -282,71 +542,203 @@ func (s *Service) doSync(ctx context.Context, acct model.EmailAccount, emailDir
 	}
 }
 
-// liveIndex rebuilds the search index every 5 seconds while sync is running.
-func (s *Service) liveIndex(ctx context.Context, emailDir, indexPath, accountID string) {
-	ticker := time.NewTicker(5 * time.Second)
-	defer ticker.Stop()
+// liveIndex refreshes the search index while sync is running. It waits
+// liveIndexInterval after each refresh, or as long as the refresh took if
+// that was longer, so rebuilding a large mailbox cannot take up the whole
+// sync. Refreshes are skipped while no email files changed.
+func (s *Service) liveIndex(ctx context.Context, emailDir, indexPath, exclude, accountID string) {
+	if s.liveIndexInterval <= 0 {
+		return
+	}
+	timer := time.NewTimer(s.liveIndexInterval)
+	defer timer.Stop()
 
 	for {
 		select {
 		case <-ctx.Done():
 			return
-		case <-ticker.C:
-			s.rebuildIndex(emailDir, indexPath)
-			s.setProgress(accountID, "syncing (index updated)", "")
+		case <-timer.C:
+			start := time.Now()
+			if s.rebuildIndex(emailDir, indexPath, exclude) {
+				s.setProgress(accountID, "syncing (index updated)", "")
+			}
+			timer.Reset(max(s.liveIndexInterval, time.Since(start)))
 		}
 	}
 }
 
-func (s *Service) rebuildIndex(emailDir, indexPath string) {
+// rebuildIndex builds the index, leaving out folders matching exclude,
+// unless it is up to date and reports whether it did.
+func (s *Service) rebuildIndex(emailDir, indexPath, exclude string) bool {
 	idx, err := index.New(emailDir, indexPath, s.blobStore, s.usersDir)
 	if err != nil {
 		log.Printf("WARN: live index open: %v", err)
-		return
+		return false
 	}
 	defer idx.Close()
-	idx.Build()
-	log.Printf("INFO: index rebuilt (%d emails)", idx.Stats().TotalEmails)
+	idx.SetExcludeFolders(exclude)
+	built, _, _ := idx.BuildIfChanged()
+	if built {
+		log.Printf("INFO: index rebuilt (%d emails)", idx.Stats().TotalEmails)
+	}
+	return built
+}
+
+// RebuildOutdatedIndexes rebuilds, one at a time, the indexes of every
+// user's accounts that index.New flags with NeedsRebuild: unusable files
+// and those written with an older index.SchemaVersion, which are served
+// as they are meanwhile. Each is built with its account's excluded
+// folders. Accounts being synced are skipped; the sync rebuilds them.
+// The server runs it in the background at startup.
+func (s *Service) RebuildOutdatedIndexes() {
+	entries, err := os.ReadDir(s.usersDir)
+	if err != nil {
+		log.Printf("WARN: outdated indexes: %v", err)
+		return
+	}
+	for _, ent := range entries {
+		if !ent.IsDir() {
+			continue
+		}
+		accts, err := s.accounts.List(ent.Name())
+		if err != nil {
+			log.Printf("WARN: outdated indexes of %s: %v", ent.Name(), err)
+			continue
+		}
+		for _, acct := range accts {
+			if s.IsRunning(acct.ID) {
+				continue
+			}
+			idx, err := index.New(account.EmailDir(s.usersDir, ent.Name(), acct), account.IndexPath(s.usersDir, ent.Name(), acct), s.blobStore, s.usersDir)
+			if err != nil {
+				log.Printf("WARN: outdated index of %s: %v", acct.Email, err)
+				continue
+			}
+			if idx.NeedsRebuild() {
+				idx.SetExcludeFolders(acct.ExcludeFolders)
+				n, _ := idx.Build()
+				log.Printf("INFO: rebuilt outdated index of %s (%d emails)", acct.Email, n)
+			}
+			idx.Close()
+		}
+	}
+}
+
+// ImportResult reports what an import did.
+type ImportResult struct {
+	Imported int // messages written
+	Errors   int // messages that could not be extracted
+	// FixDates is the mtime pass run after a PST import, nil otherwise.
+	FixDates *eml.FixDatesResult
 }
 
 // ImportPST extracts emails from an uploaded PST/OST file into the account's
 // email directory and builds the search index. Runs synchronously; call from
 // a goroutine for non-blocking behavior.
-// Returns (extracted count, error count, error).
-func (s *Service) ImportPST(userID, accountID, pstPath string, onProgress sync_pst.ProgressFunc) (int, int, error) {
+//
+// go-pst sets each file's mtime from its message date but the readpst
+// fallback does not, so before indexing every local file's mtime is set
+// from its headers (see eml.FixDates); files already right are skipped.
+func (s *Service) ImportPST(userID, accountID, pstPath string, onProgress sync_pst.ProgressFunc) (ImportResult, error) {
 	if onProgress == nil {
 		onProgress = func(string, int, int) {}
 	}
 
-	acct, err := s.accounts.Get(userID, accountID)
+	acct, emailDir, err := s.importTarget(userID, accountID, model.AccountTypePST)
+	if err != nil {
+		return ImportResult{}, err
+	}
+	defer s.usage.invalidate(emailDir)
+
+	saveFn := sync_pst.SaveEmailFunc(s.makeSaveEmailFunc(userID))
+	extracted, errCount, importErr := sync_pst.Import(pstPath, emailDir, onProgress, saveFn)
+	res := ImportResult{Imported: extracted, Errors: errCount}
+	if importErr != nil {
+		return res, fmt.Errorf("PST import: %w", importErr)
+	}
+
+	// readpst writes locally even with a blob store, so this walks
+	// whatever it left; S3 objects written by go-pst are not local.
+	onProgress("fixing-dates", 0, extracted)
+	fixed, err := eml.FixDates(emailDir, func(p eml.FixDatesResult) {
+		onProgress("fixing-dates", p.Fixed+p.Skipped+p.Errors, extracted)
+	})
 	if err != nil {
-		return 0, 0, fmt.Errorf("account not found: %w", err)
+		log.Printf("WARN: fix dates after PST import %s: %v", acct.Email, err)
+	} else if fixed.Fixed > 0 {
+		log.Printf("INFO: PST import %s: set %d file dates from headers", acct.Email, fixed.Fixed)
 	}
+	res.FixDates = &fixed
 
-	if string(acct.Type) != "PST" {
-		return 0, 0, fmt.Errorf("account %s is not a PST account", accountID)
+	// readpst bypasses saveFn, so its files are sealed after the fact.
+	if sealed, err := eml.SealDir(userID, emailDir); err != nil {
+		log.Printf("WARN: encrypt after PST import %s: %v", acct.Email, err)
+	} else if sealed > 0 {
+		log.Printf("INFO: PST import %s: encrypted %d files", acct.Email, sealed)
+	}
+
+	onProgress("indexing", extracted, extracted)
+	return res, s.indexImport(userID, *acct, emailDir)
+}
+
+// ImportMaildir copies the messages of a Maildir, Thunderbird or Apple Mail
+// tree at srcDir into the account's email directory and builds the search
+// index, like ImportPST.
+func (s *Service) ImportMaildir(userID, accountID, srcDir string, onProgress sync_maildir.ProgressFunc) (ImportResult, error) {
+	if onProgress == nil {
+		onProgress = func(string, int, int) {}
+	}
+	acct, emailDir, err := s.importTarget(userID, accountID, model.AccountTypeMaildir)
+	if err != nil {
+		return ImportResult{}, err
+	}
+	defer s.usage.invalidate(emailDir)
+
+	imported, errCount, importErr := sync_maildir.ImportTo(srcDir, emailDir, onProgress, sync_maildir.SaveEmailFunc(s.makeSaveEmailFunc(userID)))
+	res := ImportResult{Imported: imported, Errors: errCount}
+	if importErr != nil {
+		return res, fmt.Errorf("maildir import: %w", importErr)
+	}
+	onProgress("indexing", imported, imported)
+	return res, s.indexImport(userID, *acct, emailDir)
+}
+
+// importTarget returns the account an import writes to, which must be of
+// type want and within quota, and its email directory, created when mail
+// is stored on the filesystem.
+func (s *Service) importTarget(userID, accountID string, want model.AccountType) (*model.EmailAccount, string, error) {
+	acct, err := s.accounts.Get(userID, accountID)
+	if err != nil {
+		return nil, "", fmt.Errorf("account not found: %w", err)
+	}
+	if acct.Type != want {
+		return nil, "", fmt.Errorf("account %s is not a %s account", accountID, want)
+	}
+	if acct.ReadOnly() {
+		return nil, "", fmt.Errorf("account %s: %w", accountID, account.ErrReadOnly)
+	}
+	if err := s.CheckQuota(userID); err != nil {
+		return nil, "", err
 	}
 
 	emailDir := account.EmailDir(s.usersDir, userID, *acct)
 	if s.blobStore == nil {
 		if err := os.MkdirAll(emailDir, 0o755); err != nil {
-			return 0, 0, fmt.Errorf("create email dir: %w", err)
+			return nil, "", fmt.Errorf("create email dir: %w", err)
 		}
 	}
+	return acct, emailDir, nil
+}
 
-	saveFn := s.makePstSaveFunc()
-	extracted, errCount, importErr := sync_pst.Import(pstPath, emailDir, onProgress, saveFn)
-	if importErr != nil {
-		return extracted, errCount, fmt.Errorf("PST import: %w", importErr)
-	}
-
-	indexPath := account.IndexPath(s.usersDir, userID, *acct)
-	idx, idxErr := index.New(emailDir, indexPath, s.blobStore, s.usersDir)
-	if idxErr != nil {
-		return extracted, errCount, fmt.Errorf("index: %w", idxErr)
+// indexImport builds the search index of an account after an import.
+func (s *Service) indexImport(userID string, acct model.EmailAccount, emailDir string) error {
+	indexPath := account.IndexPath(s.usersDir, userID, acct)
+	idx, err := index.New(emailDir, indexPath, s.blobStore, s.usersDir)
+	if err != nil {
+		return fmt.Errorf("index: %w", err)
 	}
+	idx.SetExcludeFolders(acct.ExcludeFolders)
 	idx.Build()
 	idx.Close()
-
-	return extracted, errCount, nil
+	return nil
 }
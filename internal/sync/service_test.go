@@ -0,0 +1,536 @@
+package sync
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/eslider/mails/internal/account"
+	"github.com/eslider/mails/internal/model"
+	"github.com/eslider/mails/internal/search/eml"
+	"github.com/eslider/mails/internal/search/index"
+	"github.com/eslider/mails/internal/storage"
+	sync_imap "github.com/eslider/mails/internal/sync/imap"
+)
+
+// closedPort returns a localhost port with nothing listening on it.
+func closedPort(t *testing.T) int {
+	t.Helper()
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	port := l.Addr().(*net.TCPAddr).Port
+	l.Close()
+	return port
+}
+
+func waitIdle(t *testing.T, svc *Service, accountID string) {
+	t.Helper()
+	deadline := time.Now().Add(10 * time.Second)
+	for svc.IsRunning(accountID) {
+		if time.Now().After(deadline) {
+			t.Fatal("sync did not finish")
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+}
+
+func TestAutoPauseAfterConsecutiveFailures(t *testing.T) {
+	t.Setenv("SYNC_MAX_FAILURES", "2")
+	dir := t.TempDir()
+	accounts := account.NewStore(dir, nil)
+	svc := NewService(dir, accounts, nil)
+
+	acct, err := accounts.Create("u1", model.EmailAccount{
+		Type:  model.AccountTypeIMAP,
+		Email: "stale@example.com",
+		Host:  "127.0.0.1",
+		Port:  closedPort(t),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for i := 1; i <= 2; i++ {
+		if err := svc.SyncAccount("u1", acct.ID); err != nil {
+			t.Fatal(err)
+		}
+		waitIdle(t, svc, acct.ID)
+
+		st := svc.AccountStatus("u1", *mustGet(t, accounts, acct.ID))
+		if st["consecutive_failures"] != i {
+			t.Errorf("after sync %d: consecutive_failures = %v", i, st["consecutive_failures"])
+		}
+	}
+
+	got := mustGet(t, accounts, acct.ID)
+	if got.Sync.Enabled {
+		t.Error("account should be auto-paused")
+	}
+	if got.Sync.PausedReason == "" {
+		t.Error("auto-pause should record a reason")
+	}
+	if st := svc.AccountStatus("u1", *got); st["paused_reason"] != got.Sync.PausedReason {
+		t.Errorf("paused_reason = %v", st["paused_reason"])
+	}
+
+	// Resuming clears the reason; the counter only resets on success.
+	resumed, err := accounts.SetSyncEnabled("u1", acct.ID, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resumed.Sync.PausedReason != "" {
+		t.Errorf("resume kept reason %q", resumed.Sync.PausedReason)
+	}
+
+	stateDB, err := OpenStateDB(dir, "u1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer stateDB.Close()
+	if err := stateDB.ResetFailures(acct.ID); err != nil {
+		t.Fatal(err)
+	}
+	if n, _ := stateDB.ConsecutiveFailures(acct.ID); n != 0 {
+		t.Errorf("after reset: %d failures", n)
+	}
+}
+
+func mustGet(t *testing.T, accounts *account.Store, id string) *model.EmailAccount {
+	t.Helper()
+	a, err := accounts.Get("u1", id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return a
+}
+
+func TestImportOnlyAccountsNeverSync(t *testing.T) {
+	dir := t.TempDir()
+	accounts := account.NewStore(dir, nil)
+	svc := NewService(dir, accounts, nil)
+
+	pst, err := accounts.Create("u1", model.EmailAccount{Type: model.AccountTypePST, Email: "archive@example.com"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := svc.SyncAccount("u1", pst.ID); !errors.Is(err, ErrImportOnly) {
+		t.Errorf("SyncAccount(PST) = %v, want ErrImportOnly", err)
+	}
+	if err := svc.SyncAll("u1"); err != nil {
+		t.Fatal(err)
+	}
+	if svc.IsRunning(pst.ID) {
+		t.Error("SyncAll started a PST account")
+	}
+
+	st := svc.AccountStatus("u1", *pst)
+	if st["syncable"] != false || st["import_only"] != true {
+		t.Errorf("PST status = %v, want syncable=false import_only=true", st)
+	}
+	if _, ok := st["last_error"]; ok {
+		t.Errorf("PST status should carry no sync error: %v", st)
+	}
+
+	imap := model.EmailAccount{ID: "x", Type: model.AccountTypeIMAP, Email: "a@example.com"}
+	if st := svc.AccountStatus("u1", imap); st["syncable"] != true {
+		t.Errorf("IMAP status syncable = %v, want true", st["syncable"])
+	}
+}
+
+func TestNewSinceLastView(t *testing.T) {
+	dir := t.TempDir()
+	accounts := account.NewStore(dir, nil)
+	svc := NewService(dir, accounts, nil)
+	acct, err := accounts.Create("u1", model.EmailAccount{Type: model.AccountTypeIMAP, Email: "me@example.com", Host: "imap.example.com"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	stateDB, err := OpenStateDB(dir, "u1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer stateDB.Close()
+	finishJob := func(newMessages int) {
+		t.Helper()
+		job, err := stateDB.CreateJob(acct.ID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		now := time.Now()
+		job.Status, job.FinishedAt, job.NewMessages = model.SyncStatusDone, &now, newMessages
+		if err := stateDB.UpdateJob(job); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	finishJob(3)
+	finishJob(0)
+	if st := svc.AccountStatus("u1", *acct); st["new_since_last_view"] != 3 || st["new_latest_at"] == nil {
+		t.Fatalf("never viewed: %v", st)
+	}
+
+	if err := svc.MarkSeen("u1", acct.ID); err != nil {
+		t.Fatal(err)
+	}
+	st := svc.AccountStatus("u1", *acct)
+	if st["new_since_last_view"] != 0 || st["last_viewed"] == nil {
+		t.Fatalf("after MarkSeen: %v", st)
+	}
+	if _, ok := st["new_latest_at"]; ok {
+		t.Errorf("new_latest_at set with nothing new: %v", st)
+	}
+
+	time.Sleep(10 * time.Millisecond)
+	finishJob(2)
+	finishJob(5)
+	if st := svc.AccountStatus("u1", *acct); st["new_since_last_view"] != 7 {
+		t.Errorf("after two syncs: new_since_last_view = %v, want 7", st["new_since_last_view"])
+	}
+
+	if err := svc.MarkSeen("u1", "missing"); err == nil {
+		t.Error("MarkSeen on an unknown account should fail")
+	}
+}
+
+func TestQuotaBlocksSyncAndImport(t *testing.T) {
+	t.Setenv("USER_QUOTA_BYTES", "100")
+	dir := t.TempDir()
+	accounts := account.NewStore(dir, nil)
+	svc := NewService(dir, accounts, storage.NewFSBlobStore(dir))
+	acct, err := accounts.Create("u1", model.EmailAccount{Type: model.AccountTypeIMAP, Email: "me@example.com", Host: "127.0.0.1", Port: closedPort(t)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	pst, err := accounts.Create("u1", model.EmailAccount{Type: model.AccountTypePST, Email: "archive.pst"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	inbox := filepath.Join(account.EmailDir(dir, "u1", *acct), "inbox")
+	if err := os.MkdirAll(inbox, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(inbox, "a.eml"), make([]byte, 60), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if used, err := svc.UserUsage("u1"); err != nil || used != 60 {
+		t.Fatalf("UserUsage = %d, %v; want 60", used, err)
+	}
+	if st := svc.AccountStatus("u1", *acct); st["size_bytes"] != int64(60) {
+		t.Errorf("size_bytes = %v, want 60", st["size_bytes"])
+	}
+	if err := svc.CheckQuota("u1"); err != nil {
+		t.Fatalf("under quota: %v", err)
+	}
+
+	// Sizes are cached, so a new file only counts once the cache is dropped.
+	if err := os.WriteFile(filepath.Join(inbox, "b.eml"), make([]byte, 60), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	svc.usage.invalidate(account.EmailDir(dir, "u1", *acct))
+
+	if err := svc.SyncAccount("u1", acct.ID); !errors.Is(err, ErrQuotaExceeded) {
+		t.Errorf("SyncAccount over quota = %v, want ErrQuotaExceeded", err)
+	}
+	if err := svc.SyncAll("u1"); !errors.Is(err, ErrQuotaExceeded) {
+		t.Errorf("SyncAll over quota = %v, want ErrQuotaExceeded", err)
+	}
+	if _, err := svc.ImportPST("u1", pst.ID, "missing.pst", nil); !errors.Is(err, ErrQuotaExceeded) {
+		t.Errorf("ImportPST over quota = %v, want ErrQuotaExceeded", err)
+	}
+	if svc.IsRunning(acct.ID) {
+		t.Error("sync started over quota")
+	}
+}
+
+func TestListFolders(t *testing.T) {
+	dir := t.TempDir()
+	accounts := account.NewStore(dir, nil)
+	svc := NewService(dir, accounts, nil)
+	pop, err := accounts.Create("u1", model.EmailAccount{Type: model.AccountTypePOP3, Email: "pop@example.com"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := svc.ListFolders(context.Background(), "u1", pop.ID, false); !errors.Is(err, ErrNoFolderList) {
+		t.Errorf("ListFolders(POP3) = %v, want ErrNoFolderList", err)
+	}
+
+	port := closedPort(t)
+	acct, err := accounts.Create("u1", model.EmailAccount{Type: model.AccountTypeIMAP, Email: "me@example.com", Host: "127.0.0.1", Port: port})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := svc.ListFolders(context.Background(), "u1", acct.ID, false); err == nil {
+		t.Fatal("ListFolders with no server should fail")
+	}
+
+	// A cached list is served without connecting; refresh bypasses it.
+	cached := []sync_imap.Folder{{Name: "INBOX", Delimiter: "/"}}
+	svc.folders.set(fmt.Sprintf("%s|127.0.0.1|%d|me@example.com", acct.ID, port), cached)
+	got, err := svc.ListFolders(context.Background(), "u1", acct.ID, false)
+	if err != nil || len(got) != 1 || got[0].Name != "INBOX" {
+		t.Errorf("cached ListFolders = %v, %v", got, err)
+	}
+	if _, err := svc.ListFolders(context.Background(), "u1", acct.ID, true); err == nil {
+		t.Error("refresh should reconnect and fail")
+	}
+}
+
+func TestLiveIndexIntervalFromEnv(t *testing.T) {
+	for v, want := range map[string]time.Duration{
+		"":      defaultLiveIndexInterval,
+		"30s":   30 * time.Second,
+		"0":     0,
+		"-1s":   defaultLiveIndexInterval,
+		"often": defaultLiveIndexInterval,
+	} {
+		t.Setenv("LIVE_INDEX_INTERVAL", v)
+		if got := liveIndexIntervalFromEnv(); got != want {
+			t.Errorf("LIVE_INDEX_INTERVAL=%q: %v, want %v", v, got, want)
+		}
+	}
+}
+
+func TestRebuildIndexSkipsUnchangedFiles(t *testing.T) {
+	dir := t.TempDir()
+	emailDir := filepath.Join(dir, "mail")
+	inbox := filepath.Join(emailDir, "inbox")
+	if err := os.MkdirAll(inbox, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	write := func(name string) {
+		raw := "From: a@b.com\r\nSubject: " + name + "\r\n\r\nBody.\r\n"
+		if err := os.WriteFile(filepath.Join(inbox, name+".eml"), []byte(raw), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	svc := &Service{usersDir: dir}
+	indexPath := filepath.Join(dir, "index.parquet")
+
+	write("first")
+	if !svc.rebuildIndex(emailDir, indexPath, "") {
+		t.Error("first refresh did not build")
+	}
+	if svc.rebuildIndex(emailDir, indexPath, "") {
+		t.Error("refresh without new files rebuilt the index")
+	}
+	write("second")
+	if !svc.rebuildIndex(emailDir, indexPath, "") {
+		t.Error("refresh after a new file did not build")
+	}
+}
+
+func TestRebuildOutdatedIndexes(t *testing.T) {
+	dir := t.TempDir()
+	accounts := account.NewStore(dir, nil)
+	svc := NewService(dir, accounts, nil)
+	acct, err := accounts.Create("u1", model.EmailAccount{
+		Type:           model.AccountTypeIMAP,
+		Email:          "old@example.com",
+		ExcludeFolders: "Spam",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	emailDir := account.EmailDir(dir, "u1", *acct)
+	for _, folder := range []string{"inbox", "spam"} {
+		if err := os.MkdirAll(filepath.Join(emailDir, folder), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		raw := "From: a@b.com\r\nSubject: " + folder + "\r\n\r\nBody.\r\n"
+		if err := os.WriteFile(filepath.Join(emailDir, folder, "1.eml"), []byte(raw), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	indexPath := account.IndexPath(dir, "u1", *acct)
+	if err := os.MkdirAll(filepath.Dir(indexPath), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(indexPath, []byte("not a parquet file"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	svc.RebuildOutdatedIndexes()
+
+	idx, err := index.New(emailDir, indexPath, nil, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer idx.Close()
+	if s := idx.Stats(); s.NeedsRebuild || s.TotalEmails != 1 {
+		t.Errorf("stats = %+v, want a rebuild of the inbox alone", s)
+	}
+}
+
+// fakeReadpst puts a readpst on PATH that writes one message. go-pst
+// rejects the returned file, so imports of it fall back to this readpst,
+// which like the real one leaves the files' mtimes at the time of writing.
+func fakeReadpst(t *testing.T) (pstPath string) {
+	t.Helper()
+	bin := t.TempDir()
+	script := "#!/bin/sh\n# readpst -e -o DIR -j 0 FILE\nmkdir -p \"$3/inbox\"\n" +
+		"printf 'From: a@b.com\\r\\nSubject: Old\\r\\nDate: Mon, 10 Feb 2014 09:00:00 +0000\\r\\n\\r\\nHi\\r\\n' > \"$3/inbox/1.eml\"\n"
+	if err := os.WriteFile(filepath.Join(bin, "readpst"), []byte(script), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("PATH", bin+string(os.PathListSeparator)+os.Getenv("PATH"))
+
+	pstPath = filepath.Join(t.TempDir(), "archive.pst")
+	if err := os.WriteFile(pstPath, []byte("not a pst file"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	return pstPath
+}
+
+func TestImportPSTFixesReadpstDates(t *testing.T) {
+	pstPath := fakeReadpst(t)
+	dir := t.TempDir()
+	accounts := account.NewStore(dir, nil)
+	svc := NewService(dir, accounts, nil)
+	pst, err := accounts.Create("u1", model.EmailAccount{Type: model.AccountTypePST, Email: "archive.pst"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var phases []string
+	res, err := svc.ImportPST("u1", pst.ID, pstPath, func(phase string, _, _ int) { phases = append(phases, phase) })
+	if err != nil {
+		t.Fatalf("ImportPST: %v", err)
+	}
+	if res.Imported != 1 || res.FixDates == nil || res.FixDates.Fixed != 1 {
+		t.Fatalf("result = %+v (fix dates %+v), want 1 imported and 1 date fixed", res, res.FixDates)
+	}
+	info, err := os.Stat(filepath.Join(account.EmailDir(dir, "u1", *pst), "inbox", "1.eml"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := time.Date(2014, 2, 10, 9, 0, 0, 0, time.UTC); !info.ModTime().Equal(want) {
+		t.Errorf("mtime = %v, want %v", info.ModTime(), want)
+	}
+	if !slices.Contains(phases, "fixing-dates") {
+		t.Errorf("phases = %v, want fixing-dates reported", phases)
+	}
+}
+
+func setSealKey(t *testing.T) {
+	t.Helper()
+	if err := eml.SetSealKey(bytes.Repeat([]byte{7}, 32)); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { eml.SetSealKey(nil) })
+}
+
+func TestSaveEmailSealed(t *testing.T) {
+	setSealKey(t)
+	raw := []byte("From: a@b.com\r\nSubject: Private\r\nDate: Mon, 10 Feb 2014 09:00:00 +0000\r\n\r\nSecret body\r\n")
+
+	dir := t.TempDir()
+	svc := NewService(dir, account.NewStore(dir, nil), nil)
+	path := filepath.Join(dir, "u1", "b.com", "a", "inbox", "x-1.eml")
+	if err := svc.makeSaveEmailFunc("u1")(path, raw); err != nil {
+		t.Fatal(err)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !eml.IsSealed(data) || bytes.Contains(data, []byte("Secret body")) {
+		t.Fatal("email stored in the clear")
+	}
+	if got, err := eml.ReadFile(path); err != nil || !bytes.Equal(got, raw) {
+		t.Errorf("ReadFile = %q, %v; want the message back", got, err)
+	}
+	info, _ := os.Stat(path)
+	if want := time.Date(2014, 2, 10, 9, 0, 0, 0, time.UTC); !info.ModTime().Equal(want) {
+		t.Errorf("mtime = %v, want %v", info.ModTime(), want)
+	}
+
+	blobDir := t.TempDir()
+	blob := storage.NewFSBlobStore(blobDir)
+	svc = NewService(blobDir, account.NewStore(blobDir, nil), blob)
+	if err := svc.makeSaveEmailFunc("u1")(filepath.Join(blobDir, "u1", "x-1.eml"), raw); err != nil {
+		t.Fatal(err)
+	}
+	if data, err := blob.Read(context.Background(), "u1/x-1.eml"); err != nil || !eml.IsSealed(data) {
+		t.Errorf("blob store copy sealed = %v (%v), want sealed", eml.IsSealed(data), err)
+	}
+}
+
+func TestImportPSTSealsReadpstOutput(t *testing.T) {
+	setSealKey(t)
+	pstPath := fakeReadpst(t)
+	dir := t.TempDir()
+	accounts := account.NewStore(dir, nil)
+	svc := NewService(dir, accounts, nil)
+	pst, err := accounts.Create("u1", model.EmailAccount{Type: model.AccountTypePST, Email: "archive.pst"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := svc.ImportPST("u1", pst.ID, pstPath, nil); err != nil {
+		t.Fatalf("ImportPST: %v", err)
+	}
+	path := filepath.Join(account.EmailDir(dir, "u1", *pst), "inbox", "1.eml")
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !eml.IsSealed(data) {
+		t.Error("readpst output left unencrypted")
+	}
+	info, _ := os.Stat(path)
+	if want := time.Date(2014, 2, 10, 9, 0, 0, 0, time.UTC); !info.ModTime().Equal(want) {
+		t.Errorf("mtime = %v, want the fixed date %v kept", info.ModTime(), want)
+	}
+	if e, err := eml.ParseFile(path); err != nil || e.Subject != "Old" {
+		t.Errorf("ParseFile = %q, %v; want the subject", e.Subject, err)
+	}
+}
+
+func TestRunningSyncs(t *testing.T) {
+	dir := t.TempDir()
+	accounts := account.NewStore(dir, nil)
+	svc := NewService(dir, accounts, nil)
+	if got := svc.RunningSyncs(); len(got) != 0 {
+		t.Fatalf("RunningSyncs = %+v, want none", got)
+	}
+
+	acct, err := accounts.Create("u2", model.EmailAccount{Type: model.AccountTypeIMAP, Email: "bob@example.com", Host: "imap.example.com"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	t0 := time.Now()
+	svc.mu.Lock()
+	svc.running[acct.ID] = &syncEntry{cancel: cancel, userID: "u2", startedAt: t0.Add(time.Minute), progress: "INBOX",
+		foldersDone: 1, foldersTotal: 3, messagesDone: 10, messagesTotal: 50}
+	svc.running["gone"] = &syncEntry{cancel: func() {}, userID: "u1", startedAt: t0, progress: "starting"}
+	svc.mu.Unlock()
+
+	got := svc.RunningSyncs()
+	want := []RunningSync{
+		{UserID: "u1", AccountID: "gone", StartedAt: t0, Progress: "starting"},
+		{UserID: "u2", AccountID: acct.ID, Account: "bob@example.com", StartedAt: t0.Add(time.Minute), Progress: "INBOX",
+			FoldersDone: 1, FoldersTotal: 3, MessagesDone: 10, MessagesTotal: 50},
+	}
+	if !slices.Equal(got, want) {
+		t.Errorf("RunningSyncs =\n %+v\nwant oldest first\n %+v", got, want)
+	}
+
+	if err := svc.StopSync(acct.ID); err != nil {
+		t.Fatal(err)
+	}
+	if ctx.Err() == nil {
+		t.Error("StopSync did not cancel another user's sync")
+	}
+}
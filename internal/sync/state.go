@@ -6,6 +6,7 @@ import (
 	"fmt"
 	"os"
 	"path/filepath"
+	"strconv"
 	"time"
 
 	_ "github.com/mattn/go-sqlite3"
@@ -33,6 +34,25 @@ CREATE TABLE IF NOT EXISTS sync_uids (
 	PRIMARY KEY (account_id, folder, uid)
 );
 
+-- Runs of numeric UIDs folded out of sync_uids by Compact.
+CREATE TABLE IF NOT EXISTS sync_uid_ranges (
+	account_id TEXT NOT NULL,
+	folder     TEXT NOT NULL DEFAULT '',
+	lo         INTEGER NOT NULL,
+	hi         INTEGER NOT NULL,
+	PRIMARY KEY (account_id, folder, lo)
+);
+
+CREATE TABLE IF NOT EXISTS sync_failures (
+	account_id  TEXT PRIMARY KEY,
+	consecutive INTEGER NOT NULL DEFAULT 0
+);
+
+CREATE TABLE IF NOT EXISTS account_views (
+	account_id TEXT PRIMARY KEY,
+	seen_at    DATETIME NOT NULL
+);
+
 CREATE INDEX IF NOT EXISTS idx_sync_jobs_account ON sync_jobs(account_id);
 CREATE INDEX IF NOT EXISTS idx_sync_jobs_status ON sync_jobs(status);
 `
@@ -118,14 +138,103 @@ func (s *StateDB) LastJob(accountID string) (*model.SyncJob, error) {
 	return &job, nil
 }
 
+// RecordFailure increments the account's consecutive failure counter and
+// returns the new value.
+func (s *StateDB) RecordFailure(accountID string) (int, error) {
+	_, err := s.db.Exec(
+		`INSERT INTO sync_failures (account_id, consecutive) VALUES (?, 1)
+		 ON CONFLICT(account_id) DO UPDATE SET consecutive = consecutive + 1`,
+		accountID,
+	)
+	if err != nil {
+		return 0, err
+	}
+	return s.ConsecutiveFailures(accountID)
+}
+
+// ResetFailures clears the account's consecutive failure counter.
+func (s *StateDB) ResetFailures(accountID string) error {
+	_, err := s.db.Exec(`DELETE FROM sync_failures WHERE account_id = ?`, accountID)
+	return err
+}
+
+// ConsecutiveFailures returns how many syncs in a row have failed for an account.
+func (s *StateDB) ConsecutiveFailures(accountID string) (int, error) {
+	var n int
+	err := s.db.QueryRow(
+		`SELECT consecutive FROM sync_failures WHERE account_id = ?`, accountID,
+	).Scan(&n)
+	if err == sql.ErrNoRows {
+		return 0, nil
+	}
+	return n, err
+}
+
+// MarkSeen records when the user last looked at an account's mail.
+func (s *StateDB) MarkSeen(accountID string, at time.Time) error {
+	_, err := s.db.Exec(
+		`INSERT INTO account_views (account_id, seen_at) VALUES (?, ?)
+		 ON CONFLICT(account_id) DO UPDATE SET seen_at = excluded.seen_at`,
+		accountID, at,
+	)
+	return err
+}
+
+// LastSeen returns when MarkSeen was last called for an account, or the
+// zero time if never.
+func (s *StateDB) LastSeen(accountID string) (time.Time, error) {
+	var at time.Time
+	err := s.db.QueryRow(
+		`SELECT seen_at FROM account_views WHERE account_id = ?`, accountID,
+	).Scan(&at)
+	if err == sql.ErrNoRows {
+		return time.Time{}, nil
+	}
+	return at, err
+}
+
+// NewSince sums the new messages of sync jobs that finished after since,
+// and returns when the latest of those jobs finished (zero if none).
+func (s *StateDB) NewSince(accountID string, since time.Time) (int, time.Time, error) {
+	rows, err := s.db.Query(
+		`SELECT finished_at, new_messages FROM sync_jobs
+		 WHERE account_id = ? AND new_messages > 0 AND finished_at IS NOT NULL`,
+		accountID,
+	)
+	if err != nil {
+		return 0, time.Time{}, err
+	}
+	defer rows.Close()
+
+	// Compared in Go: stored timestamps may carry different zone offsets.
+	var n int
+	var latest time.Time
+	for rows.Next() {
+		var at time.Time
+		var count int
+		if err := rows.Scan(&at, &count); err != nil {
+			return 0, time.Time{}, err
+		}
+		if !at.After(since) {
+			continue
+		}
+		n += count
+		if at.After(latest) {
+			latest = at
+		}
+	}
+	return n, latest, rows.Err()
+}
+
 // IsUIDSynced checks whether a UID has been synced for an account+folder.
 func (s *StateDB) IsUIDSynced(accountID, folder, uid string) bool {
-	var count int
+	var found bool
 	s.db.QueryRow(
-		`SELECT COUNT(*) FROM sync_uids WHERE account_id = ? AND folder = ? AND uid = ?`,
-		accountID, folder, uid,
-	).Scan(&count)
-	return count > 0
+		`SELECT EXISTS (SELECT 1 FROM sync_uids WHERE account_id = ? AND folder = ? AND uid = ?)
+			OR EXISTS (SELECT 1 FROM sync_uid_ranges WHERE account_id = ? AND folder = ? AND ? BETWEEN lo AND hi)`,
+		accountID, folder, uid, accountID, folder, numericUID(uid),
+	).Scan(&found)
+	return found
 }
 
 // MarkUIDSynced records a UID as synced.
@@ -137,7 +246,8 @@ func (s *StateDB) MarkUIDSynced(accountID, folder, uid string) error {
 	return err
 }
 
-// SyncedUIDs returns all synced UIDs for an account+folder.
+// SyncedUIDs returns all synced UIDs for an account+folder, expanding
+// compacted ranges.
 func (s *StateDB) SyncedUIDs(accountID, folder string) (map[string]bool, error) {
 	rows, err := s.db.Query(
 		`SELECT uid FROM sync_uids WHERE account_id = ? AND folder = ?`,
@@ -156,5 +266,177 @@ func (s *StateDB) SyncedUIDs(accountID, folder string) (map[string]bool, error)
 		}
 		uids[uid] = true
 	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	ranges, err := s.uidRanges(accountID, folder)
+	if err != nil {
+		return nil, err
+	}
+	for _, r := range ranges {
+		for n := r.lo; n <= r.hi; n++ {
+			uids[strconv.FormatInt(n, 10)] = true
+		}
+	}
 	return uids, nil
 }
+
+// compactMinUIDs is how many numeric UIDs a folder needs in sync_uids
+// before Compact folds them into ranges; smaller folders are left alone.
+const compactMinUIDs = 1000
+
+// numericUIDFilter selects UIDs in canonical decimal form (no sign or
+// leading zeros), the only ones that can round-trip through a range.
+const numericUIDFilter = `uid != '' AND uid NOT GLOB '*[^0-9]*' AND (uid = '0' OR uid NOT GLOB '0*') AND length(uid) <= 18`
+
+// numericUID returns uid as a number for range lookups, or -1 when it is
+// not in canonical decimal form.
+func numericUID(uid string) int64 {
+	n, err := strconv.ParseInt(uid, 10, 64)
+	if err != nil || n < 0 || strconv.FormatInt(n, 10) != uid {
+		return -1
+	}
+	return n
+}
+
+type uidRange struct{ lo, hi int64 }
+
+func (s *StateDB) uidRanges(accountID, folder string) ([]uidRange, error) {
+	rows, err := s.db.Query(
+		`SELECT lo, hi FROM sync_uid_ranges WHERE account_id = ? AND folder = ? ORDER BY lo`,
+		accountID, folder,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var ranges []uidRange
+	for rows.Next() {
+		var r uidRange
+		if err := rows.Scan(&r.lo, &r.hi); err != nil {
+			return nil, err
+		}
+		ranges = append(ranges, r)
+	}
+	return ranges, rows.Err()
+}
+
+// Compact folds the numeric UIDs of large folders (IMAP "All Mail" can
+// hold hundreds of thousands) from one row each into runs of consecutive
+// UIDs in sync_uid_ranges, then VACUUMs the file if rows were removed.
+// Non-numeric UIDs, such as POP3 UIDLs and content hashes, stay as rows.
+// It returns the number of sync_uids rows removed.
+func (s *StateDB) Compact() (int, error) {
+	rows, err := s.db.Query(
+		`SELECT account_id, folder FROM sync_uids WHERE `+numericUIDFilter+`
+		GROUP BY account_id, folder HAVING COUNT(*) >= ?`, compactMinUIDs)
+	if err != nil {
+		return 0, fmt.Errorf("find folders: %w", err)
+	}
+	type folderKey struct{ accountID, folder string }
+	var folders []folderKey
+	for rows.Next() {
+		var k folderKey
+		if err := rows.Scan(&k.accountID, &k.folder); err != nil {
+			rows.Close()
+			return 0, fmt.Errorf("find folders: %w", err)
+		}
+		folders = append(folders, k)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, fmt.Errorf("find folders: %w", err)
+	}
+
+	removed := 0
+	for _, k := range folders {
+		n, err := s.compactFolder(k.accountID, k.folder)
+		if err != nil {
+			return removed, fmt.Errorf("compact %s/%s: %w", k.accountID, k.folder, err)
+		}
+		removed += n
+	}
+	if removed > 0 {
+		if _, err := s.db.Exec(`VACUUM`); err != nil {
+			return removed, fmt.Errorf("vacuum: %w", err)
+		}
+	}
+	return removed, nil
+}
+
+// compactFolder merges one folder's numeric UID rows with its existing
+// ranges in a single transaction.
+func (s *StateDB) compactFolder(accountID, folder string) (int, error) {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	rows, err := tx.Query(
+		`SELECT CAST(uid AS INTEGER) AS n FROM sync_uids WHERE account_id = ? AND folder = ? AND `+numericUIDFilter+`
+		UNION ALL SELECT lo FROM sync_uid_ranges WHERE account_id = ? AND folder = ?
+		ORDER BY n`,
+		accountID, folder, accountID, folder)
+	if err != nil {
+		return 0, err
+	}
+	// Range starts are merged as single UIDs; their ends are read below.
+	var uids []int64
+	for rows.Next() {
+		var n int64
+		if err := rows.Scan(&n); err != nil {
+			rows.Close()
+			return 0, err
+		}
+		uids = append(uids, n)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, err
+	}
+	ends := make(map[int64]int64)
+	rangeRows, err := tx.Query(`SELECT lo, hi FROM sync_uid_ranges WHERE account_id = ? AND folder = ?`, accountID, folder)
+	if err != nil {
+		return 0, err
+	}
+	for rangeRows.Next() {
+		var lo, hi int64
+		if err := rangeRows.Scan(&lo, &hi); err != nil {
+			rangeRows.Close()
+			return 0, err
+		}
+		ends[lo] = max(ends[lo], hi)
+	}
+	rangeRows.Close()
+	if err := rangeRows.Err(); err != nil {
+		return 0, err
+	}
+
+	var merged []uidRange
+	for _, n := range uids {
+		hi := max(n, ends[n])
+		if last := len(merged) - 1; last >= 0 && n <= merged[last].hi+1 {
+			merged[last].hi = max(merged[last].hi, hi)
+			continue
+		}
+		merged = append(merged, uidRange{n, hi})
+	}
+
+	if _, err := tx.Exec(`DELETE FROM sync_uid_ranges WHERE account_id = ? AND folder = ?`, accountID, folder); err != nil {
+		return 0, err
+	}
+	for _, r := range merged {
+		if _, err := tx.Exec(`INSERT INTO sync_uid_ranges (account_id, folder, lo, hi) VALUES (?, ?, ?, ?)`,
+			accountID, folder, r.lo, r.hi); err != nil {
+			return 0, err
+		}
+	}
+	res, err := tx.Exec(`DELETE FROM sync_uids WHERE account_id = ? AND folder = ? AND `+numericUIDFilter, accountID, folder)
+	if err != nil {
+		return 0, err
+	}
+	removed, _ := res.RowsAffected()
+	return int(removed), tx.Commit()
+}
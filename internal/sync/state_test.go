@@ -0,0 +1,89 @@
+package sync
+
+import (
+	"strconv"
+	"testing"
+)
+
+func TestCompactFoldsNumericUIDsIntoRanges(t *testing.T) {
+	dir := t.TempDir()
+	stateDB, err := OpenStateDB(dir, "u1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer stateDB.Close()
+
+	mark := func(folder, uid string) {
+		t.Helper()
+		if err := stateDB.MarkUIDSynced("a1", folder, uid); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// A large folder with a gap (UIDs 1-700 and 801-1500), plus a UID that
+	// is not in canonical form and a small folder that stays as it is.
+	for n := 1; n <= 1500; n++ {
+		if n <= 700 || n > 800 {
+			mark("All Mail", strconv.Itoa(n))
+		}
+	}
+	mark("All Mail", "0042")
+	for n := 1; n <= 10; n++ {
+		mark("INBOX", strconv.Itoa(n))
+	}
+
+	removed, err := stateDB.Compact()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if removed != 1400 {
+		t.Errorf("removed %d rows, want 1400", removed)
+	}
+	ranges, err := stateDB.uidRanges("a1", "All Mail")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []uidRange{{1, 700}, {801, 1500}}; len(ranges) != 2 || ranges[0] != want[0] || ranges[1] != want[1] {
+		t.Errorf("ranges = %v, want %v", ranges, want)
+	}
+	if r, _ := stateDB.uidRanges("a1", "INBOX"); len(r) != 0 {
+		t.Errorf("small folder was compacted: %v", r)
+	}
+
+	for uid, want := range map[string]bool{"1": true, "700": true, "750": false, "1500": true, "1501": false, "0042": true, "042": false} {
+		if got := stateDB.IsUIDSynced("a1", "All Mail", uid); got != want {
+			t.Errorf("IsUIDSynced(%q) = %v, want %v", uid, got, want)
+		}
+	}
+	if !stateDB.IsUIDSynced("a1", "INBOX", "3") || stateDB.IsUIDSynced("a2", "All Mail", "1") {
+		t.Error("lookups leaked across folders or accounts")
+	}
+	uids, err := stateDB.SyncedUIDs("a1", "All Mail")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(uids) != 1401 || !uids["801"] || !uids["0042"] {
+		t.Errorf("SyncedUIDs returned %d UIDs, want 1401", len(uids))
+	}
+
+	// New UIDs join the existing ranges on the next pass once the folder
+	// has enough rows again; until then they are found as rows.
+	for n := 701; n <= 800; n++ {
+		mark("All Mail", strconv.Itoa(n))
+	}
+	for n := 1501; n <= 2500; n++ {
+		mark("All Mail", strconv.Itoa(n))
+	}
+	if !stateDB.IsUIDSynced("a1", "All Mail", "750") {
+		t.Error("row-stored UID not found next to ranges")
+	}
+	if removed, err := stateDB.Compact(); err != nil || removed != 1100 {
+		t.Fatalf("second Compact = %d, %v; want 1100", removed, err)
+	}
+	ranges, _ = stateDB.uidRanges("a1", "All Mail")
+	if len(ranges) != 1 || ranges[0] != (uidRange{1, 2500}) {
+		t.Errorf("after second pass: ranges = %v, want [{1 2500}]", ranges)
+	}
+	if removed, err := stateDB.Compact(); err != nil || removed != 0 {
+		t.Errorf("idle Compact = %d, %v; want 0", removed, err)
+	}
+}
@@ -0,0 +1,162 @@
+package sync
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/eslider/mails/internal/account"
+	"github.com/eslider/mails/internal/model"
+)
+
+// ErrQuotaExceeded is returned when starting a sync or import for a user
+// whose archive is at or above USER_QUOTA_BYTES.
+var ErrQuotaExceeded = errors.New("storage quota exceeded")
+
+// usageTTL is how long a measured account size is reused. Syncs and
+// imports invalidate it as soon as they finish.
+const usageTTL = 5 * time.Minute
+
+// quotaFromEnv reads USER_QUOTA_BYTES; unset, invalid or 0 means no quota.
+func quotaFromEnv() int64 {
+	if n, err := strconv.ParseInt(os.Getenv("USER_QUOTA_BYTES"), 10, 64); err == nil && n > 0 {
+		return n
+	}
+	return 0
+}
+
+type usageEntry struct {
+	bytes      int64
+	measuredAt time.Time
+}
+
+// usageCache remembers account sizes, keyed by email directory, so status
+// polling does not walk the archive on every request.
+type usageCache struct {
+	mu      sync.Mutex
+	entries map[string]usageEntry
+}
+
+func (c *usageCache) get(key string) (int64, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	e, ok := c.entries[key]
+	if !ok || time.Since(e.measuredAt) > usageTTL {
+		return 0, false
+	}
+	return e.bytes, true
+}
+
+func (c *usageCache) set(key string, bytes int64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.entries == nil {
+		c.entries = make(map[string]usageEntry)
+	}
+	c.entries[key] = usageEntry{bytes: bytes, measuredAt: time.Now()}
+}
+
+func (c *usageCache) invalidate(key string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	delete(c.entries, key)
+}
+
+// AccountSize returns the bytes the account's archive takes up: every file
+// under its email directory (or blob prefix), .eml files and index alike.
+// Read-only accounts count only the directory the app owns, not the
+// external tree they read. Results are cached for a few minutes.
+func (s *Service) AccountSize(userID string, acct model.EmailAccount) (int64, error) {
+	emailDir := account.EmailDir(s.usersDir, userID, acct)
+	if acct.ReadOnly() {
+		emailDir = account.DataDir(s.usersDir, userID, acct)
+	}
+	if n, ok := s.usage.get(emailDir); ok {
+		return n, nil
+	}
+	n, err := s.measure(emailDir)
+	if err != nil {
+		return 0, err
+	}
+	s.usage.set(emailDir, n)
+	return n, nil
+}
+
+func (s *Service) measure(emailDir string) (int64, error) {
+	if s.blobStore != nil {
+		rel, err := filepath.Rel(s.usersDir, emailDir)
+		if err != nil {
+			return 0, err
+		}
+		return s.blobStore.Size(context.Background(), filepath.ToSlash(rel))
+	}
+	var total int64
+	err := filepath.WalkDir(emailDir, func(path string, d os.DirEntry, err error) error {
+		if err != nil {
+			if os.IsNotExist(err) {
+				return nil
+			}
+			return err
+		}
+		if info, err := d.Info(); err == nil && !d.IsDir() {
+			total += info.Size()
+		}
+		return nil
+	})
+	return total, err
+}
+
+// addSize sets size_bytes in an AccountStatus map; a failed measurement
+// is logged and leaves it out.
+func (s *Service) addSize(status map[string]any, userID string, acct model.EmailAccount) {
+	n, err := s.AccountSize(userID, acct)
+	if err != nil {
+		log.Printf("WARN: size of %s: %v", acct.Email, err)
+		return
+	}
+	status["size_bytes"] = n
+}
+
+// UserUsage returns the combined archive size of all the user's accounts.
+func (s *Service) UserUsage(userID string) (int64, error) {
+	accounts, err := s.accounts.List(userID)
+	if err != nil {
+		return 0, err
+	}
+	var total int64
+	for _, acct := range accounts {
+		n, err := s.AccountSize(userID, acct)
+		if err != nil {
+			return total, fmt.Errorf("size of %s: %w", acct.Email, err)
+		}
+		total += n
+	}
+	return total, nil
+}
+
+// Quota returns the per-user byte limit, or 0 when there is none.
+func (s *Service) Quota() int64 {
+	return s.quota
+}
+
+// CheckQuota returns an error wrapping ErrQuotaExceeded when the user's
+// archive has reached the quota. Without a quota it always returns nil.
+func (s *Service) CheckQuota(userID string) error {
+	if s.quota <= 0 {
+		return nil
+	}
+	used, err := s.UserUsage(userID)
+	if err != nil {
+		return fmt.Errorf("check quota: %w", err)
+	}
+	if used >= s.quota {
+		return fmt.Errorf("%w: %d of %d bytes used; delete mail or raise USER_QUOTA_BYTES", ErrQuotaExceeded, used, s.quota)
+	}
+	return nil
+}
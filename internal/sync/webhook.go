@@ -0,0 +1,121 @@
+package sync
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/eslider/mails/internal/model"
+	"github.com/eslider/mails/internal/search/index"
+)
+
+const (
+	// webhookTimeout bounds each delivery attempt.
+	webhookTimeout = 10 * time.Second
+	// webhookSubjects is how many subjects a NewMailEvent carries.
+	webhookSubjects = 5
+)
+
+// webhookRetryDelay is the pause before the one retry of a failed delivery.
+var webhookRetryDelay = 2 * time.Second
+
+// NewMailEvent is the JSON body POSTed to SYNC_WEBHOOK_URL when a sync
+// downloads new messages.
+type NewMailEvent struct {
+	Event       string            `json:"event"` // always "sync.new_mail"
+	UserID      string            `json:"user_id"`
+	AccountID   string            `json:"account_id"`
+	Account     string            `json:"account"` // the account's email address
+	AccountType model.AccountType `json:"account_type"`
+	NewMessages int               `json:"new_message_count"`
+	// Subjects of the newest messages in the account, at most
+	// webhookSubjects and never more than NewMessages.
+	Subjects   []string  `json:"subjects"`
+	FinishedAt time.Time `json:"finished_at"`
+}
+
+// webhookURLFromEnv reads SYNC_WEBHOOK_URL; anything but an http(s) URL
+// is logged and ignored.
+func webhookURLFromEnv() string {
+	v := strings.TrimSpace(os.Getenv("SYNC_WEBHOOK_URL"))
+	if v == "" {
+		return ""
+	}
+	u, err := url.Parse(v)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		log.Printf("WARN: SYNC_WEBHOOK_URL=%q is not an http(s) URL; webhook disabled", v)
+		return ""
+	}
+	return v
+}
+
+// notifyNewMail POSTs ev to the webhook, retrying once after a failure.
+// Errors are only logged: a slow or broken receiver must not affect sync.
+func (s *Service) notifyNewMail(ev NewMailEvent) {
+	if s.webhookURL == "" {
+		return
+	}
+	ev.Event = "sync.new_mail"
+	if ev.Subjects == nil {
+		ev.Subjects = []string{}
+	}
+	body, err := json.Marshal(ev)
+	if err != nil {
+		log.Printf("WARN: webhook for %s: %v", ev.Account, err)
+		return
+	}
+	for attempt := 1; ; attempt++ {
+		err = postWebhook(s.webhookURL, body)
+		if err == nil {
+			return
+		}
+		if attempt == 2 {
+			break
+		}
+		time.Sleep(webhookRetryDelay)
+	}
+	log.Printf("WARN: webhook for %s: %v", ev.Account, err)
+}
+
+func postWebhook(target string, body []byte) error {
+	ctx, cancel := context.WithTimeout(context.Background(), webhookTimeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, target, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "mails-webhook/1")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("POST %s: %s", target, resp.Status)
+	}
+	return nil
+}
+
+// newestSubjects returns up to n subjects of the newest messages in the
+// account's index, for a NewMailEvent.
+func (s *Service) newestSubjects(emailDir, indexPath string, n int) []string {
+	idx, err := index.New(emailDir, indexPath, s.blobStore, s.usersDir)
+	if err != nil {
+		log.Printf("WARN: webhook subjects: %v", err)
+		return nil
+	}
+	defer idx.Close()
+	var subjects []string
+	for _, h := range idx.Search("", 0, n).Hits {
+		subjects = append(subjects, h.Subject)
+	}
+	return subjects
+}
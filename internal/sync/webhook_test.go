@@ -0,0 +1,115 @@
+package sync
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	gosync "sync"
+	"testing"
+	"time"
+
+	"github.com/eslider/mails/internal/model"
+)
+
+func TestNotifyNewMailRetriesOnce(t *testing.T) {
+	defer func(d time.Duration) { webhookRetryDelay = d }(webhookRetryDelay)
+	webhookRetryDelay = time.Millisecond
+
+	var mu gosync.Mutex
+	var events []NewMailEvent
+	failFirst := true
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		var ev NewMailEvent
+		if r.Method != http.MethodPost || r.Header.Get("Content-Type") != "application/json" {
+			t.Errorf("%s with Content-Type %q", r.Method, r.Header.Get("Content-Type"))
+		}
+		if err := json.NewDecoder(r.Body).Decode(&ev); err != nil {
+			t.Errorf("decode: %v", err)
+		}
+		events = append(events, ev)
+		if failFirst {
+			failFirst = false
+			w.WriteHeader(http.StatusBadGateway)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer srv.Close()
+
+	svc := &Service{webhookURL: srv.URL}
+	svc.notifyNewMail(NewMailEvent{
+		UserID:      "u1",
+		AccountID:   "a1",
+		Account:     "me@example.com",
+		AccountType: model.AccountTypeIMAP,
+		NewMessages: 3,
+		Subjects:    []string{"Invoice 42", "Lunch?"},
+		FinishedAt:  time.Now(),
+	})
+	if len(events) != 2 {
+		t.Fatalf("got %d deliveries, want 2 (one retry)", len(events))
+	}
+	ev := events[1]
+	if ev.Event != "sync.new_mail" || ev.Account != "me@example.com" || ev.NewMessages != 3 || len(ev.Subjects) != 2 || ev.Subjects[0] != "Invoice 42" {
+		t.Errorf("payload = %+v", ev)
+	}
+
+	// A receiver that keeps failing gets exactly one retry.
+	events, failFirst = nil, false
+	broken := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		events = append(events, NewMailEvent{})
+		mu.Unlock()
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer broken.Close()
+	svc.webhookURL = broken.URL
+	svc.notifyNewMail(NewMailEvent{Account: "me@example.com", NewMessages: 1})
+	if len(events) != 2 {
+		t.Errorf("failing receiver: %d attempts, want 2", len(events))
+	}
+}
+
+func TestWebhookURLFromEnv(t *testing.T) {
+	for v, want := range map[string]string{
+		"":                          "",
+		"https://hooks.example/new": "https://hooks.example/new",
+		"ftp://hooks.example/new":   "",
+		"not a url":                 "",
+	} {
+		t.Setenv("SYNC_WEBHOOK_URL", v)
+		if got := webhookURLFromEnv(); got != want {
+			t.Errorf("SYNC_WEBHOOK_URL=%q: %q, want %q", v, got, want)
+		}
+	}
+}
+
+func TestNewestSubjects(t *testing.T) {
+	dir := t.TempDir()
+	inbox := filepath.Join(dir, "mail", "inbox")
+	if err := os.MkdirAll(inbox, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	for i, m := range []struct{ subject, date string }{
+		{"Oldest", "Mon, 10 Feb 2025 09:00:00 +0000"},
+		{"Newest", "Wed, 12 Feb 2025 09:00:00 +0000"},
+		{"Middle", "Tue, 11 Feb 2025 09:00:00 +0000"},
+	} {
+		raw := "From: a@b.com\r\nSubject: " + m.subject + "\r\nDate: " + m.date + "\r\n\r\nBody.\r\n"
+		if err := os.WriteFile(filepath.Join(inbox, string(rune('a'+i))+".eml"), []byte(raw), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	svc := &Service{usersDir: dir}
+	indexPath := filepath.Join(dir, "index.parquet")
+	svc.rebuildIndex(filepath.Join(dir, "mail"), indexPath, "")
+
+	got := svc.newestSubjects(filepath.Join(dir, "mail"), indexPath, 2)
+	if len(got) != 2 || got[0] != "Newest" || got[1] != "Middle" {
+		t.Errorf("newestSubjects = %v, want [Newest Middle]", got)
+	}
+}
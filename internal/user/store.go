@@ -131,6 +131,79 @@ func (s *Store) CreateWithPassword(name, email, passwordHash string) (*model.Use
 	return &user, nil
 }
 
+// SetDefaultAccount stores the user's default account ID ("" clears it)
+// and returns the updated user.
+func (s *Store) SetDefaultAccount(userID, accountID string) (*model.User, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	u, ok := s.reload(userID)
+	if !ok {
+		return nil, fmt.Errorf("user %q not found", userID)
+	}
+	u.DefaultAccountID = accountID
+	u.UpdatedAt = time.Now()
+	if err := s.saveUser(u); err != nil {
+		return nil, err
+	}
+	s.users[userID] = u
+	return &u, nil
+}
+
+// IsAdmin reports whether the user has the admin role. The role is read
+// from storage, not the cache, so grants and revokes by another process
+// (mails admin) apply at once.
+func (s *Store) IsAdmin(userID string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	u, ok := s.reload(userID)
+	return ok && u.Admin
+}
+
+// SetAdmin grants or revokes the admin role and returns the updated user.
+func (s *Store) SetAdmin(userID string, admin bool) (*model.User, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	u, ok := s.reload(userID)
+	if !ok {
+		return nil, fmt.Errorf("user %q not found", userID)
+	}
+	u.Admin = admin
+	u.UpdatedAt = time.Now()
+	if err := s.saveUser(u); err != nil {
+		return nil, err
+	}
+	s.users[userID] = u
+	return &u, nil
+}
+
+// reload refreshes the cached user from storage and returns it, so that
+// an update does not write back fields another process changed since
+// NewStore (the admin role, set by mails admin). When the file cannot be
+// read it returns the cached user. s.mu must be held for writing.
+func (s *Store) reload(userID string) (model.User, bool) {
+	cached, ok := s.users[userID]
+	if !ok {
+		return cached, false
+	}
+	var data []byte
+	var err error
+	if s.blobStore != nil {
+		data, err = s.blobStore.Read(context.Background(), userID+"/"+userMetaFile)
+	} else {
+		data, err = os.ReadFile(filepath.Join(s.UserDir(userID), userMetaFile))
+	}
+	if err != nil {
+		return cached, true
+	}
+	var f userFile
+	if err := json.Unmarshal(data, &f); err != nil || f.ID != userID {
+		return cached, true
+	}
+	u := fromUserFile(f)
+	s.users[userID] = u
+	return u, true
+}
+
 // UserDir returns the filesystem path for a user's data directory.
 func (s *Store) UserDir(userID string) string {
 	return filepath.Join(s.dataDir, userID)
@@ -174,42 +247,51 @@ func (s *Store) create(oauthUser *model.User) (*model.User, error) {
 // The model.User struct hides PasswordHash from API responses (json:"-"),
 // so we use this wrapper for persistence only.
 type userFile struct {
-	ID           string    `json:"id"`
-	Name         string    `json:"name"`
-	Email        string    `json:"email"`
-	AvatarURL    string    `json:"avatar_url,omitempty"`
-	PasswordHash string    `json:"password_hash,omitempty"`
-	Provider     string    `json:"provider,omitempty"`
-	ProviderID   string    `json:"provider_id,omitempty"`
-	CreatedAt    time.Time `json:"created_at"`
-	UpdatedAt    time.Time `json:"updated_at"`
+	ID               string    `json:"id"`
+	Name             string    `json:"name"`
+	Email            string    `json:"email"`
+	AvatarURL        string    `json:"avatar_url,omitempty"`
+	PasswordHash     string    `json:"password_hash,omitempty"`
+	Provider         string    `json:"provider,omitempty"`
+	ProviderID       string    `json:"provider_id,omitempty"`
+	DefaultAccountID string    `json:"default_account_id,omitempty"`
+	Admin            bool      `json:"admin,omitempty"`
+	TrustedSenders   []string  `json:"trusted_senders,omitempty"`
+	CreatedAt        time.Time `json:"created_at"`
+	UpdatedAt        time.Time `json:"updated_at"`
 }
 
 func toUserFile(u model.User) userFile {
 	return userFile{
-		ID:           u.ID,
-		Name:         u.Name,
-		Email:        u.Email,
-		AvatarURL:    u.AvatarURL,
-		PasswordHash: u.PasswordHash,
-		Provider:     u.Provider,
-		ProviderID:   u.ProviderID,
-		CreatedAt:    u.CreatedAt,
-		UpdatedAt:    u.UpdatedAt,
+		ID:               u.ID,
+		Name:             u.Name,
+		Email:            u.Email,
+		AvatarURL:        u.AvatarURL,
+		PasswordHash:     u.PasswordHash,
+		Provider:         u.Provider,
+		ProviderID:       u.ProviderID,
+		DefaultAccountID: u.DefaultAccountID,
+		Admin:            u.Admin,
+		TrustedSenders:   u.TrustedSenders,
+		CreatedAt:        u.CreatedAt,
+		UpdatedAt:        u.UpdatedAt,
 	}
 }
 
 func fromUserFile(f userFile) model.User {
 	return model.User{
-		ID:           f.ID,
-		Name:         f.Name,
-		Email:        f.Email,
-		AvatarURL:    f.AvatarURL,
-		PasswordHash: f.PasswordHash,
-		Provider:     f.Provider,
-		ProviderID:   f.ProviderID,
-		CreatedAt:    f.CreatedAt,
-		UpdatedAt:    f.UpdatedAt,
+		ID:               f.ID,
+		Name:             f.Name,
+		Email:            f.Email,
+		AvatarURL:        f.AvatarURL,
+		PasswordHash:     f.PasswordHash,
+		Provider:         f.Provider,
+		ProviderID:       f.ProviderID,
+		DefaultAccountID: f.DefaultAccountID,
+		Admin:            f.Admin,
+		TrustedSenders:   f.TrustedSenders,
+		CreatedAt:        f.CreatedAt,
+		UpdatedAt:        f.UpdatedAt,
 	}
 }
 
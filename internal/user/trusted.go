@@ -0,0 +1,90 @@
+package user
+
+import (
+	"fmt"
+	"net/mail"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/eslider/mails/internal/model"
+)
+
+// NormalizeTrustedSender returns the form a trusted sender is stored in:
+// a lower-cased address, or a lower-cased domain without a leading "@".
+func NormalizeTrustedSender(sender string) (string, error) {
+	s := strings.ToLower(strings.TrimSpace(sender))
+	s = strings.TrimPrefix(s, "@")
+	if s == "" {
+		return "", fmt.Errorf("sender is empty")
+	}
+	if strings.ContainsAny(s, " \t\r\n<>,;\"") || strings.Count(s, "@") > 1 {
+		return "", fmt.Errorf("invalid sender %q: want an address or a domain", sender)
+	}
+	local, domain, isAddr := strings.Cut(s, "@")
+	if !isAddr {
+		domain = local
+	} else if local == "" {
+		return "", fmt.Errorf("invalid sender %q: want an address or a domain", sender)
+	}
+	if !strings.Contains(domain, ".") || strings.HasPrefix(domain, ".") || strings.HasSuffix(domain, ".") {
+		return "", fmt.Errorf("invalid sender %q: want an address or a domain", sender)
+	}
+	return s, nil
+}
+
+// SetTrustedSender adds sender to the user's trusted senders (trust) or
+// removes it, and returns the updated user. The list stays sorted.
+func (s *Store) SetTrustedSender(userID, sender string, trust bool) (*model.User, error) {
+	sender, err := NormalizeTrustedSender(sender)
+	if err != nil {
+		return nil, err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	u, ok := s.reload(userID)
+	if !ok {
+		return nil, fmt.Errorf("user %q not found", userID)
+	}
+	list := slices.Clone(u.TrustedSenders)
+	i, found := slices.BinarySearch(list, sender)
+	switch {
+	case trust && !found:
+		list = slices.Insert(list, i, sender)
+	case !trust && found:
+		list = slices.Delete(list, i, i+1)
+	default:
+		return &u, nil
+	}
+	u.TrustedSenders = list
+	u.UpdatedAt = time.Now()
+	if err := s.saveUser(u); err != nil {
+		return nil, err
+	}
+	s.users[userID] = u
+	return &u, nil
+}
+
+// SenderTrusted reports whether the From header value from names a sender
+// in the user's trusted senders: the address itself, its domain or a
+// parent domain. A nil user trusts no one.
+func SenderTrusted(u *model.User, from string) bool {
+	if u == nil || len(u.TrustedSenders) == 0 {
+		return false
+	}
+	addr, err := mail.ParseAddress(from)
+	if err != nil {
+		return false
+	}
+	address := strings.ToLower(addr.Address)
+	_, domain, ok := strings.Cut(address, "@")
+	if !ok {
+		return false
+	}
+	for _, t := range u.TrustedSenders {
+		if t == address || t == domain || strings.HasSuffix(domain, "."+t) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,63 @@
+package web
+
+import (
+	"net/http"
+	"strings"
+)
+
+// Error codes are the stable, machine-readable part of an error response.
+// Clients should branch on them; messages are for people and may change.
+const (
+	codeBadRequest       = "bad_request"
+	codeInvalidPath      = "invalid_path"      // missing, absolute or escaping email path
+	codeMissingParameter = "missing_parameter" // a required query or form field is empty
+	codeInvalidBody      = "invalid_body"      // request body is not valid JSON or form data
+	codeForbidden        = "forbidden"
+	codeNotFound         = "not_found"
+	codeNotIndexed       = "not_indexed" // the email exists but is not in the search index
+	codeSyncConflict     = "sync_conflict"
+	codeConfirmRequired  = "confirm_required"
+	codeQuotaExceeded    = "quota_exceeded"
+	codeInternal         = "internal_error"
+	codeUpstream         = "upstream_error" // a mail server or embedding service failed
+	codeNotConfigured    = "not_configured"
+	codeMethodNotAllowed = "method_not_allowed"
+	codeTooLarge         = "too_large"      // request body over Config.MaxBodyBytes
+	codeTimeout          = "timeout"        // handler ran past Config.RequestTimeout
+	codeIndexBuilding    = "index_building" // an account's first index build outlasted coldBuildWait
+)
+
+// errorDetail says what went wrong.
+type errorDetail struct {
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+// errorResponse is the body of every API error:
+// {"error": {"code": "not_found", "message": "email not found"}}.
+type errorResponse struct {
+	Error errorDetail `json:"error"`
+}
+
+func writeError(w http.ResponseWriter, status int, code, msg string) {
+	writeJSON(w, status, errorResponse{Error: errorDetail{Code: code, Message: msg}})
+}
+
+// apiNotFound answers unknown /api routes with the error envelope; other
+// paths keep the plain 404 page.
+func apiNotFound(w http.ResponseWriter, r *http.Request) {
+	if !strings.HasPrefix(r.URL.Path, "/api/") {
+		http.NotFound(w, r)
+		return
+	}
+	writeError(w, http.StatusNotFound, codeNotFound, "no such endpoint: "+r.URL.Path)
+}
+
+// apiMethodNotAllowed is apiNotFound for a known route and the wrong method.
+func apiMethodNotAllowed(w http.ResponseWriter, r *http.Request) {
+	if !strings.HasPrefix(r.URL.Path, "/api/") {
+		http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+		return
+	}
+	writeError(w, http.StatusMethodNotAllowed, codeMethodNotAllowed, r.Method+" is not supported on "+r.URL.Path)
+}
@@ -0,0 +1,70 @@
+package web
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/eslider/mails/internal/account"
+	"github.com/eslider/mails/internal/auth"
+	"github.com/eslider/mails/internal/model"
+)
+
+func TestErrorEnvelope(t *testing.T) {
+	dir := t.TempDir()
+	sessions, err := auth.NewSessionStore(dir, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	accounts := account.NewStore(dir, nil)
+	token, err := sessions.Create("user-1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	acct, err := accounts.Create("user-1", model.EmailAccount{Type: model.AccountTypeIMAP, Email: "me@example.com", Host: "imap.example.com"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	handler := NewRouter(Config{Accounts: accounts, Sessions: sessions, UsersDir: dir})
+
+	tests := []struct {
+		method, target string
+		anonymous      bool
+		status         int
+		code           string
+	}{
+		{http.MethodGet, "/api/me", true, http.StatusUnauthorized, "unauthorized"},
+		{http.MethodGet, "/api/email", false, http.StatusBadRequest, codeInvalidPath},
+		{http.MethodGet, "/api/email?path=../../etc/passwd", false, http.StatusBadRequest, codeInvalidPath},
+		{http.MethodGet, "/api/email?source=index&path=inbox/a.eml&account_id=" + acct.ID, false, http.StatusNotFound, codeNotIndexed},
+		{http.MethodGet, "/api/live-search", false, http.StatusBadRequest, codeMissingParameter},
+		{http.MethodGet, "/api/live-search?subject=x%0D%0AA1+EXPUNGE&account_id=" + acct.ID, false, http.StatusBadRequest, codeBadRequest},
+		{http.MethodPost, "/api/accounts", false, http.StatusBadRequest, codeInvalidBody},
+		{http.MethodPost, "/api/sync/stop", false, http.StatusBadRequest, codeMissingParameter},
+		{http.MethodPost, "/api/delete?q=x&account_id=someone-else", false, http.StatusNotFound, codeNotFound},
+		{http.MethodPost, "/api/vector/diagnose", false, http.StatusServiceUnavailable, codeNotConfigured},
+		{http.MethodGet, "/api/no-such-endpoint", false, http.StatusNotFound, codeNotFound},
+		{http.MethodDelete, "/api/search", false, http.StatusMethodNotAllowed, codeMethodNotAllowed},
+	}
+	for _, tt := range tests {
+		t.Run(tt.method+" "+tt.target, func(t *testing.T) {
+			req := httptest.NewRequest(tt.method, tt.target, nil)
+			if !tt.anonymous {
+				req.Header.Set("Authorization", "Bearer "+token)
+			}
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, req)
+			if rec.Code != tt.status {
+				t.Errorf("status = %d, want %d (%s)", rec.Code, tt.status, rec.Body.String())
+			}
+			var out map[string]map[string]string
+			if err := json.Unmarshal(rec.Body.Bytes(), &out); err != nil {
+				t.Fatalf("body %q is not the error envelope: %v", rec.Body.String(), err)
+			}
+			if len(out) != 1 || out["error"]["code"] != tt.code || out["error"]["message"] == "" {
+				t.Errorf("body = %v, want {error: {code: %q, message: ...}}", out, tt.code)
+			}
+		})
+	}
+}
@@ -3,6 +3,8 @@ package web
 import (
 	"context"
 	"crypto/rand"
+	"crypto/sha256"
+	"encoding/csv"
 	"encoding/hex"
 	"encoding/json"
 	"errors"
@@ -12,6 +14,9 @@ import (
 	"net/http"
 	"os"
 	"path/filepath"
+	"slices"
+	"sort"
+	"strconv"
 	"strings"
 	gosync "sync"
 	"time"
@@ -19,12 +24,17 @@ import (
 	"github.com/go-chi/chi/v5"
 
 	"github.com/eslider/mails/internal/account"
+	"github.com/eslider/mails/internal/annotation"
 	"github.com/eslider/mails/internal/auth"
 	"github.com/eslider/mails/internal/model"
+	"github.com/eslider/mails/internal/pdf"
 	"github.com/eslider/mails/internal/search/eml"
 	"github.com/eslider/mails/internal/search/index"
+	"github.com/eslider/mails/internal/search/vector"
 	"github.com/eslider/mails/internal/storage"
 	"github.com/eslider/mails/internal/sync"
+	sync_imap "github.com/eslider/mails/internal/sync/imap"
+	sync_maildir "github.com/eslider/mails/internal/sync/maildir"
 	sync_pst "github.com/eslider/mails/internal/sync/pst"
 	"github.com/eslider/mails/internal/user"
 )
@@ -41,7 +51,7 @@ func handleLoginPage() http.HandlerFunc {
 func handleLoginSubmit(sessions *auth.SessionStore, users *user.Store) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		if err := r.ParseForm(); err != nil {
-			writeError(w, http.StatusBadRequest, "invalid form data")
+			writeError(w, http.StatusBadRequest, codeInvalidBody, "invalid form data")
 			return
 		}
 		email := strings.TrimSpace(r.FormValue("email"))
@@ -62,7 +72,7 @@ func handleLoginSubmit(sessions *auth.SessionStore, users *user.Store) http.Hand
 
 		token, err := sessions.Create(u.ID)
 		if err != nil {
-			writeError(w, http.StatusInternalServerError, "session creation failed")
+			writeError(w, http.StatusInternalServerError, codeInternal, "session creation failed")
 			return
 		}
 
@@ -81,7 +91,7 @@ func handleRegisterPage() http.HandlerFunc {
 func handleRegisterSubmit(sessions *auth.SessionStore, users *user.Store) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		if err := r.ParseForm(); err != nil {
-			writeError(w, http.StatusBadRequest, "invalid form data")
+			writeError(w, http.StatusBadRequest, codeInvalidBody, "invalid form data")
 			return
 		}
 
@@ -118,7 +128,7 @@ func handleRegisterSubmit(sessions *auth.SessionStore, users *user.Store) http.H
 
 		token, err := sessions.Create(u.ID)
 		if err != nil {
-			writeError(w, http.StatusInternalServerError, "session creation failed")
+			writeError(w, http.StatusInternalServerError, codeInternal, "session creation failed")
 			return
 		}
 
@@ -143,7 +153,7 @@ func handleOAuthStart(providers *auth.Providers, sessions *auth.SessionStore) ht
 
 		url, err := providers.AuthURL(provider, state)
 		if err != nil {
-			writeError(w, http.StatusBadRequest, err.Error())
+			writeError(w, http.StatusBadRequest, codeBadRequest, err.Error())
 			return
 		}
 		http.Redirect(w, r, url, http.StatusTemporaryRedirect)
@@ -157,20 +167,20 @@ func handleOAuthCallback(providers *auth.Providers, sessions *auth.SessionStore,
 		// Validate state.
 		stateCookie, err := r.Cookie("oauth_state")
 		if err != nil || stateCookie.Value != r.URL.Query().Get("state") {
-			writeError(w, http.StatusBadRequest, "invalid oauth state")
+			writeError(w, http.StatusBadRequest, codeBadRequest, "invalid oauth state")
 			return
 		}
 
 		code := r.URL.Query().Get("code")
 		if code == "" {
-			writeError(w, http.StatusBadRequest, "missing authorization code")
+			writeError(w, http.StatusBadRequest, codeMissingParameter, "missing authorization code")
 			return
 		}
 
 		oauthUser, err := providers.Exchange(r.Context(), provider, code)
 		if err != nil {
 			log.Printf("ERROR: oauth exchange %s: %v", provider, err)
-			writeError(w, http.StatusInternalServerError, "authentication failed")
+			writeError(w, http.StatusInternalServerError, codeInternal, "authentication failed")
 			return
 		}
 
@@ -178,14 +188,14 @@ func handleOAuthCallback(providers *auth.Providers, sessions *auth.SessionStore,
 		u, err := users.FindOrCreate(oauthUser)
 		if err != nil {
 			log.Printf("ERROR: create user: %v", err)
-			writeError(w, http.StatusInternalServerError, "user creation failed")
+			writeError(w, http.StatusInternalServerError, codeInternal, "user creation failed")
 			return
 		}
 
 		// Create session.
 		token, err := sessions.Create(u.ID)
 		if err != nil {
-			writeError(w, http.StatusInternalServerError, "session creation failed")
+			writeError(w, http.StatusInternalServerError, codeInternal, "session creation failed")
 			return
 		}
 
@@ -219,13 +229,119 @@ func handleMe(users *user.Store) http.HandlerFunc {
 		userID := auth.UserIDFromContext(r.Context())
 		u := users.Get(userID)
 		if u == nil {
-			writeError(w, http.StatusNotFound, "user not found")
+			writeError(w, http.StatusNotFound, codeNotFound, "user not found")
 			return
 		}
 		writeJSON(w, http.StatusOK, u)
 	}
 }
 
+type preferencesRequest struct {
+	DefaultAccountID *string `json:"default_account_id"`
+}
+
+// handleUpdatePreferences sets the user's default account. An empty
+// default_account_id clears it, falling back to the first account.
+func handleUpdatePreferences(users *user.Store, accounts *account.Store) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		userID := auth.UserIDFromContext(r.Context())
+		var req preferencesRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			writeError(w, http.StatusBadRequest, codeInvalidBody, "invalid JSON")
+			return
+		}
+		if req.DefaultAccountID == nil {
+			writeError(w, http.StatusBadRequest, codeMissingParameter, "missing default_account_id")
+			return
+		}
+		id := strings.TrimSpace(*req.DefaultAccountID)
+		if id != "" {
+			if _, err := accounts.Get(userID, id); err != nil {
+				writeError(w, http.StatusBadRequest, codeBadRequest, "unknown account "+id)
+				return
+			}
+		}
+		u, err := users.SetDefaultAccount(userID, id)
+		if err != nil {
+			writeError(w, http.StatusInternalServerError, codeInternal, err.Error())
+			return
+		}
+		writeJSON(w, http.StatusOK, u)
+	}
+}
+
+// trustedSenders is the /api/allowlist response.
+type trustedSenders struct {
+	TrustedSenders []string `json:"trusted_senders"`
+}
+
+func newTrustedSenders(u *model.User) trustedSenders {
+	out := trustedSenders{TrustedSenders: u.TrustedSenders}
+	if out.TrustedSenders == nil {
+		out.TrustedSenders = []string{}
+	}
+	return out
+}
+
+// handleListTrustedSenders returns the user's trusted senders, whose
+// emails keep their remote images.
+func handleListTrustedSenders(users *user.Store) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		u := users.Get(auth.UserIDFromContext(r.Context()))
+		if u == nil {
+			writeError(w, http.StatusNotFound, codeNotFound, "user not found")
+			return
+		}
+		writeJSON(w, http.StatusOK, newTrustedSenders(u))
+	}
+}
+
+// handleSetTrustedSender adds (trust) or removes the sender given as the
+// sender query parameter or JSON body field: an address or a domain.
+func handleSetTrustedSender(users *user.Store, trust bool) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		sender := r.URL.Query().Get("sender")
+		if sender == "" && r.ContentLength != 0 {
+			var req struct {
+				Sender string `json:"sender"`
+			}
+			if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+				writeError(w, http.StatusBadRequest, codeInvalidBody, "invalid JSON")
+				return
+			}
+			sender = req.Sender
+		}
+		if strings.TrimSpace(sender) == "" {
+			writeError(w, http.StatusBadRequest, codeMissingParameter, "missing sender")
+			return
+		}
+		u, err := users.SetTrustedSender(auth.UserIDFromContext(r.Context()), sender, trust)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, codeBadRequest, err.Error())
+			return
+		}
+		writeJSON(w, http.StatusOK, newTrustedSenders(u))
+	}
+}
+
+// defaultAccount picks the user's default account from accts, falling back
+// to the first one when no default is set or it no longer exists.
+func defaultAccount(cfg Config, userID string, accts []model.EmailAccount) (model.EmailAccount, bool) {
+	if len(accts) == 0 {
+		return model.EmailAccount{}, false
+	}
+	if cfg.Users != nil {
+		if u := cfg.Users.Get(userID); u != nil && u.DefaultAccountID != "" {
+			for _, a := range accts {
+				if a.ID == u.DefaultAccountID {
+					return a, true
+				}
+			}
+		}
+	}
+	return accts[0], true
+}
+
 // --- Account API ---
 
 func handleListAccounts(accounts *account.Store) http.HandlerFunc {
@@ -233,7 +349,7 @@ func handleListAccounts(accounts *account.Store) http.HandlerFunc {
 		userID := auth.UserIDFromContext(r.Context())
 		list, err := accounts.List(userID)
 		if err != nil {
-			writeError(w, http.StatusInternalServerError, err.Error())
+			writeError(w, http.StatusInternalServerError, codeInternal, err.Error())
 			return
 		}
 		if list == nil {
@@ -243,39 +359,60 @@ func handleListAccounts(accounts *account.Store) http.HandlerFunc {
 	}
 }
 
-func handleCreateAccount(accounts *account.Store) http.HandlerFunc {
+func handleCreateAccount(cfg Config) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		userID := auth.UserIDFromContext(r.Context())
 
-		var acct model.EmailAccount
-		if err := json.NewDecoder(r.Body).Decode(&acct); err != nil {
-			writeError(w, http.StatusBadRequest, "invalid request body")
+		var in accountInput
+		if err := json.NewDecoder(r.Body).Decode(&in); err != nil {
+			writeError(w, http.StatusBadRequest, codeInvalidBody, "invalid request body")
+			return
+		}
+		acct := in.account()
+		if err := validateAccount(cfg, userID, &acct); err != nil {
+			writeError(w, http.StatusBadRequest, codeBadRequest, err.Error())
 			return
 		}
 
-		created, err := accounts.Create(userID, acct)
+		created, err := cfg.Accounts.Create(userID, acct)
 		if err != nil {
-			writeError(w, http.StatusInternalServerError, err.Error())
+			writeError(w, http.StatusInternalServerError, codeInternal, err.Error())
 			return
 		}
 		writeJSON(w, http.StatusCreated, created)
 	}
 }
 
-func handleUpdateAccount(accounts *account.Store) http.HandlerFunc {
+func handleUpdateAccount(cfg Config) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		userID := auth.UserIDFromContext(r.Context())
 		accountID := chi.URLParam(r, "id")
 
-		var acct model.EmailAccount
-		if err := json.NewDecoder(r.Body).Decode(&acct); err != nil {
-			writeError(w, http.StatusBadRequest, "invalid request body")
+		var in accountInput
+		if err := json.NewDecoder(r.Body).Decode(&in); err != nil {
+			writeError(w, http.StatusBadRequest, codeInvalidBody, "invalid request body")
 			return
 		}
+		acct := in.account()
 		acct.ID = accountID
 
-		if err := accounts.Update(userID, acct); err != nil {
-			writeError(w, http.StatusInternalServerError, err.Error())
+		// The password and client key are never sent to the client, so
+		// empty ones keep the stored values.
+		if existing, err := cfg.Accounts.Get(userID, accountID); err == nil {
+			if acct.Password == "" {
+				acct.Password = existing.Password
+			}
+			if acct.TLS != nil && acct.TLS.ClientCert != "" && acct.TLS.ClientKey == "" && existing.TLS != nil {
+				acct.TLS.ClientKey = existing.TLS.ClientKey
+			}
+		}
+		if err := validateAccount(cfg, userID, &acct); err != nil {
+			writeError(w, http.StatusBadRequest, codeBadRequest, err.Error())
+			return
+		}
+
+		if err := cfg.Accounts.Update(userID, acct); err != nil {
+			writeError(w, http.StatusInternalServerError, codeInternal, err.Error())
 			return
 		}
 		writeJSON(w, http.StatusOK, acct)
@@ -288,13 +425,374 @@ func handleDeleteAccount(accounts *account.Store) http.HandlerFunc {
 		accountID := chi.URLParam(r, "id")
 
 		if err := accounts.Delete(userID, accountID); err != nil {
-			writeError(w, http.StatusNotFound, err.Error())
+			writeError(w, http.StatusNotFound, codeNotFound, err.Error())
 			return
 		}
 		writeJSON(w, http.StatusOK, map[string]string{"status": "deleted"})
 	}
 }
 
+// handleCloneAccount returns an unsaved copy of an account's settings
+// (see account.Clone) for the add-account form: an account cannot be
+// stored without its own email, as its data directory is named after it.
+func handleCloneAccount(accounts *account.Store) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		userID := auth.UserIDFromContext(r.Context())
+		src, err := accounts.Get(userID, chi.URLParam(r, "id"))
+		if err != nil {
+			writeError(w, http.StatusNotFound, codeNotFound, err.Error())
+			return
+		}
+		writeJSON(w, http.StatusOK, account.Clone(*src))
+	}
+}
+
+// validateAccount validates an account sent by a client and resolves its
+// EmailDirOverride, which must lie inside <root>/<user ID> for one of
+// cfg.ExternalMailRoots and outside cfg.UsersDir. Overrides need local
+// storage, as blob keys are relative to UsersDir.
+func validateAccount(cfg Config, userID string, acct *model.EmailAccount) error {
+	if err := account.Validate(*acct); err != nil {
+		return err
+	}
+	if acct.EmailDirOverride == "" {
+		return nil
+	}
+	if cfg.BlobStore != nil {
+		return errors.New("email dir overrides need local storage")
+	}
+	dir, err := account.ResolveEmailDirOverride(acct.EmailDirOverride, cfg.ExternalMailRoots, userID, cfg.UsersDir)
+	if err != nil {
+		return err
+	}
+	acct.EmailDirOverride = dir
+	return nil
+}
+
+// accountInput is an account as sent by clients. Unlike EmailAccount it
+// accepts a password and TLS client key; EmailAccount never serialises
+// them back.
+type accountInput struct {
+	model.EmailAccount
+	Password  string `json:"password"`
+	ClientKey string `json:"client_key"` // PEM key for tls.client_cert
+}
+
+// account returns the normalized account including the secrets.
+func (in accountInput) account() model.EmailAccount {
+	acct := in.EmailAccount
+	acct.Password = in.Password
+	if in.ClientKey != "" {
+		if acct.TLS == nil {
+			acct.TLS = &model.TLSOptions{}
+		}
+		acct.TLS.ClientKey = in.ClientKey
+	}
+	return account.Normalize(acct)
+}
+
+// bulkAccountResult reports the outcome for one input row (1-based).
+type bulkAccountResult struct {
+	Row    int    `json:"row"`
+	Email  string `json:"email"`
+	Status string `json:"status"` // "created", "skipped" or "error"
+	ID     string `json:"id,omitempty"`
+	Error  string `json:"error,omitempty"`
+}
+
+// bulkCSVColumns are the recognised CSV header names.
+var bulkCSVColumns = []string{"type", "email", "host", "port", "password", "ssl", "folders", "interval"}
+
+// handleBulkCreateAccounts creates many accounts from a JSON array or, with
+// Content-Type text/csv, a CSV file with a header row. Accounts whose
+// email+host already exist are skipped; each row gets its own result.
+func handleBulkCreateAccounts(cfg Config) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		userID := auth.UserIDFromContext(r.Context())
+
+		var rows []accountInput
+		var err error
+		if strings.Contains(r.Header.Get("Content-Type"), "csv") {
+			rows, err = parseBulkCSV(r.Body)
+		} else {
+			err = json.NewDecoder(r.Body).Decode(&rows)
+		}
+		if err != nil {
+			writeError(w, http.StatusBadRequest, codeInvalidBody, "invalid request body: "+err.Error())
+			return
+		}
+
+		existing, err := cfg.Accounts.List(userID)
+		if err != nil {
+			writeError(w, http.StatusInternalServerError, codeInternal, err.Error())
+			return
+		}
+		seen := make(map[string]bool, len(existing)+len(rows))
+		for _, a := range existing {
+			seen[bulkAccountKey(a)] = true
+		}
+
+		results := make([]bulkAccountResult, 0, len(rows))
+		created := 0
+		for i, row := range rows {
+			acct := row.account()
+			acct.ID = ""
+			res := bulkAccountResult{Row: i + 1, Email: acct.Email}
+
+			key := bulkAccountKey(acct)
+			if seen[key] {
+				res.Status, res.Error = "skipped", "account already exists"
+			} else if err := validateAccount(cfg, userID, &acct); err != nil {
+				res.Status, res.Error = "error", err.Error()
+			} else if out, err := cfg.Accounts.Create(userID, acct); err != nil {
+				res.Status, res.Error = "error", err.Error()
+			} else {
+				seen[key] = true
+				res.Status, res.ID = "created", out.ID
+				created++
+			}
+			results = append(results, res)
+		}
+
+		writeJSON(w, http.StatusOK, map[string]any{
+			"created": created,
+			"total":   len(rows),
+			"results": results,
+		})
+	}
+}
+
+func bulkAccountKey(a model.EmailAccount) string {
+	return strings.ToLower(a.Email) + "|" + a.Host
+}
+
+// parseBulkCSV reads accounts from CSV with a header row naming bulkCSVColumns
+// (any order, unknown columns ignored).
+func parseBulkCSV(r io.Reader) ([]accountInput, error) {
+	cr := csv.NewReader(r)
+	cr.TrimLeadingSpace = true
+	records, err := cr.ReadAll()
+	if err != nil {
+		return nil, err
+	}
+	if len(records) == 0 {
+		return nil, nil
+	}
+
+	col := make(map[string]int)
+	for i, name := range records[0] {
+		col[strings.ToLower(strings.TrimSpace(name))] = i
+	}
+	if _, ok := col["email"]; !ok {
+		return nil, fmt.Errorf("CSV header must include an email column (known columns: %s)", strings.Join(bulkCSVColumns, ", "))
+	}
+	get := func(rec []string, name string) string {
+		if i, ok := col[name]; ok && i < len(rec) {
+			return strings.TrimSpace(rec[i])
+		}
+		return ""
+	}
+
+	rows := make([]accountInput, 0, len(records)-1)
+	for _, rec := range records[1:] {
+		var row accountInput
+		row.Type = model.AccountType(strings.ToUpper(get(rec, "type")))
+		row.Email = get(rec, "email")
+		row.Host = get(rec, "host")
+		row.Port, _ = strconv.Atoi(get(rec, "port"))
+		row.Password = get(rec, "password")
+		row.SSL, _ = strconv.ParseBool(get(rec, "ssl"))
+		row.Folders = get(rec, "folders")
+		row.Sync.Interval = get(rec, "interval")
+		rows = append(rows, row)
+	}
+	return rows, nil
+}
+
+// handleSetSyncEnabled pauses or resumes scheduled sync for an account
+// without touching its sync state. A manual POST /api/sync still runs it.
+func handleSetSyncEnabled(accounts *account.Store, enabled bool) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		userID := auth.UserIDFromContext(r.Context())
+		accountID := chi.URLParam(r, "id")
+
+		if _, err := accounts.Get(userID, accountID); err != nil {
+			writeError(w, http.StatusNotFound, codeNotFound, err.Error())
+			return
+		}
+
+		acct, err := accounts.SetSyncEnabled(userID, accountID, enabled)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, codeBadRequest, err.Error())
+			return
+		}
+		writeJSON(w, http.StatusOK, acct)
+	}
+}
+
+// handleAccountSeen marks the account's mail as seen now and returns its
+// sync status, whose new_since_last_view starts again from zero.
+func handleAccountSeen(syncSvc *sync.Service, accounts *account.Store) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		userID := auth.UserIDFromContext(r.Context())
+		acct, err := accounts.Get(userID, chi.URLParam(r, "id"))
+		if err != nil {
+			writeError(w, http.StatusNotFound, codeNotFound, err.Error())
+			return
+		}
+		if err := syncSvc.MarkSeen(userID, acct.ID); err != nil {
+			writeError(w, http.StatusInternalServerError, codeInternal, err.Error())
+			return
+		}
+		writeJSON(w, http.StatusOK, syncSvc.AccountStatus(userID, *acct))
+	}
+}
+
+// handleAccountFolders lists the folders on an IMAP account's server so the
+// UI can offer them for the account's Folders setting. ?refresh=true skips
+// the short-lived cache.
+func handleAccountFolders(syncSvc *sync.Service, accounts *account.Store) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		userID := auth.UserIDFromContext(r.Context())
+		acct, err := accounts.Get(userID, chi.URLParam(r, "id"))
+		if err != nil {
+			writeError(w, http.StatusNotFound, codeNotFound, err.Error())
+			return
+		}
+		refresh := r.URL.Query().Get("refresh") == "true"
+		folders, err := syncSvc.ListFolders(r.Context(), userID, acct.ID, refresh)
+		if errors.Is(err, sync.ErrNoFolderList) {
+			writeError(w, http.StatusBadRequest, codeBadRequest, err.Error())
+			return
+		}
+		if err != nil {
+			writeError(w, http.StatusBadGateway, codeUpstream, err.Error())
+			return
+		}
+		writeJSON(w, http.StatusOK, map[string]any{"folders": folders})
+	}
+}
+
+// maxLiveSearch caps the messages /api/live-search fetches headers for.
+const maxLiveSearch = 200
+
+// handleLiveSearch asks an IMAP account's server to search one folder
+// (?folder=, default INBOX) with SEARCH, for mail that is not synced or
+// indexed yet. from, subject and body are substring filters; since and
+// before are YYYY-MM-DD dates. Only headers of the newest matches are
+// fetched; nothing is stored.
+func handleLiveSearch(cfg Config) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		userID := auth.UserIDFromContext(r.Context())
+		q := r.URL.Query()
+		accountID := q.Get("account_id")
+		if accountID == "" {
+			writeError(w, http.StatusBadRequest, codeMissingParameter, "missing account_id parameter")
+			return
+		}
+		acct, err := cfg.Accounts.Get(userID, accountID)
+		if err != nil {
+			writeError(w, http.StatusNotFound, codeNotFound, "account not found")
+			return
+		}
+		if acct.Type != model.AccountTypeIMAP {
+			writeError(w, http.StatusBadRequest, codeBadRequest, fmt.Sprintf("live search needs an IMAP account, not %s", acct.Type))
+			return
+		}
+
+		// A line break would end the IMAP command and start another.
+		for _, key := range []string{"from", "subject", "body", "folder"} {
+			if err := sync_imap.CheckText(q.Get(key)); err != nil {
+				writeError(w, http.StatusBadRequest, codeBadRequest, fmt.Sprintf("invalid %s: %v", key, err))
+				return
+			}
+		}
+		criteria := sync_imap.SearchCriteria{From: q.Get("from"), Subject: q.Get("subject"), Body: q.Get("body")}
+		for _, d := range []struct {
+			key string
+			to  *time.Time
+		}{{"since", &criteria.Since}, {"before", &criteria.Before}} {
+			if v := q.Get(d.key); v != "" {
+				t, err := time.Parse("2006-01-02", v)
+				if err != nil {
+					writeError(w, http.StatusBadRequest, codeBadRequest, fmt.Sprintf("invalid %s %q: want YYYY-MM-DD", d.key, v))
+					return
+				}
+				*d.to = t
+			}
+		}
+		folder := q.Get("folder")
+		if folder == "" {
+			folder = "INBOX"
+		}
+		limit := queryInt(r, "limit", 50)
+		if limit < 1 || limit > maxLiveSearch {
+			limit = maxLiveSearch
+		}
+
+		msgs, total, err := sync_imap.Search(r.Context(), *acct, folder, criteria, limit)
+		if err != nil {
+			writeError(w, http.StatusBadGateway, codeUpstream, err.Error())
+			return
+		}
+		writeJSON(w, http.StatusOK, map[string]any{
+			"account_id": acct.ID,
+			"folder":     folder,
+			"total":      total,
+			"messages":   msgs,
+		})
+	}
+}
+
+// handleAccountFixDates resets the mtime of the account's .eml files from
+// their Date/Received headers in the background, like `mails fix-dates`
+// for a single account. Progress is polled via /api/import/status/{job_id}
+// or streamed from /api/import/{job_id}/events.
+func handleAccountFixDates(cfg Config) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		userID := auth.UserIDFromContext(r.Context())
+		acct, err := cfg.Accounts.Get(userID, chi.URLParam(r, "id"))
+		if err != nil {
+			writeError(w, http.StatusNotFound, codeNotFound, err.Error())
+			return
+		}
+		if _, ok := cfg.BlobStore.(*storage.S3BlobStore); ok {
+			writeError(w, http.StatusBadRequest, codeBadRequest, "fix-dates needs local storage; S3 objects have no settable mtime")
+			return
+		}
+		if acct.ReadOnly() {
+			writeError(w, http.StatusForbidden, codeForbidden, account.ErrReadOnly.Error()+": its mail is read from "+acct.EmailDirOverride)
+			return
+		}
+
+		jobID := model.NewID()
+		job := &importJob{ID: jobID, UserID: userID, AccountID: acct.ID, Phase: "fixing-dates"}
+		setImportJob(jobID, job)
+
+		emailDir := account.EmailDir(cfg.UsersDir, userID, *acct)
+		go func() {
+			defer scheduleImportJobCleanup(jobID)
+			res, err := eml.FixDates(emailDir, func(p eml.FixDatesResult) {
+				updateImportJob(job, func(j *importJob) { j.Current = p.Fixed + p.Skipped + p.Errors })
+			})
+			log.Printf("INFO: fix-dates %s: %d fixed, %d skipped, %d errors", acct.Email, res.Fixed, res.Skipped, res.Errors)
+
+			updateImportJob(job, func(j *importJob) {
+				j.FixDates = &res
+				j.Current = res.Fixed + res.Skipped + res.Errors
+				j.Total = j.Current
+				j.Phase = "done"
+				if err != nil {
+					j.Phase = "error"
+					j.Error = err.Error()
+				}
+			})
+		}()
+
+		writeJSON(w, http.StatusAccepted, map[string]string{"job_id": jobID, "account_id": acct.ID})
+	}
+}
+
 // --- Sync API ---
 
 func handleSyncTrigger(syncSvc *sync.Service, accounts *account.Store) http.HandlerFunc {
@@ -313,8 +811,16 @@ func handleSyncTrigger(syncSvc *sync.Service, accounts *account.Store) http.Hand
 			err = syncSvc.SyncAll(userID)
 		}
 
+		if errors.Is(err, sync.ErrImportOnly) || errors.Is(err, account.ErrReadOnly) {
+			writeError(w, http.StatusBadRequest, codeBadRequest, err.Error())
+			return
+		}
+		if errors.Is(err, sync.ErrQuotaExceeded) {
+			writeError(w, http.StatusInsufficientStorage, codeQuotaExceeded, err.Error())
+			return
+		}
 		if err != nil {
-			writeError(w, http.StatusConflict, err.Error())
+			writeError(w, http.StatusConflict, codeSyncConflict, err.Error())
 			return
 		}
 		writeJSON(w, http.StatusAccepted, map[string]string{"status": "started"})
@@ -331,20 +837,40 @@ func handleSyncStop(syncSvc *sync.Service, accounts *account.Store) http.Handler
 		json.NewDecoder(r.Body).Decode(&req)
 
 		if req.AccountID == "" {
-			writeError(w, http.StatusBadRequest, "account_id is required")
+			writeError(w, http.StatusBadRequest, codeMissingParameter, "account_id is required")
 			return
 		}
 
 		// Verify the account belongs to the authenticated user.
 		if _, err := accounts.Get(userID, req.AccountID); err != nil {
-			writeError(w, http.StatusForbidden, "account not found or access denied")
+			writeError(w, http.StatusForbidden, codeForbidden, "account not found or access denied")
 			return
 		}
 
 		if err := syncSvc.StopSync(req.AccountID); err != nil {
-			writeError(w, http.StatusConflict, err.Error())
+			writeError(w, http.StatusConflict, codeSyncConflict, err.Error())
+			return
+		}
+		writeJSON(w, http.StatusOK, map[string]string{"status": "stopped"})
+	}
+}
+
+// handleAdminSyncs lists the running syncs of all users.
+func handleAdminSyncs(syncSvc *sync.Service) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, http.StatusOK, syncSvc.RunningSyncs())
+	}
+}
+
+// handleAdminStopSync cancels the running sync of any user's account.
+func handleAdminStopSync(syncSvc *sync.Service) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		accountID := chi.URLParam(r, "accountID")
+		if err := syncSvc.StopSync(accountID); err != nil {
+			writeError(w, http.StatusConflict, codeSyncConflict, err.Error())
 			return
 		}
+		log.Printf("INFO: admin %s stopped the sync of account %s", auth.UserIDFromContext(r.Context()), accountID)
 		writeJSON(w, http.StatusOK, map[string]string{"status": "stopped"})
 	}
 }
@@ -354,23 +880,12 @@ func handleSyncStatus(syncSvc *sync.Service, accounts *account.Store) http.Handl
 		userID := auth.UserIDFromContext(r.Context())
 		accts, err := accounts.List(userID)
 		if err != nil {
-			writeError(w, http.StatusInternalServerError, err.Error())
+			writeError(w, http.StatusInternalServerError, codeInternal, err.Error())
 			return
 		}
 
 		var statuses []map[string]any
 		for _, acct := range accts {
-			if acct.Type == model.AccountTypePST {
-				// PST is import-only: return clean status, no last_error from old sync attempts.
-				statuses = append(statuses, map[string]any{
-					"id":          acct.ID,
-					"name":        acct.Email,
-					"type":        "PST",
-					"syncing":     false,
-					"import_only": true,
-				})
-				continue
-			}
 			statuses = append(statuses, syncSvc.AccountStatus(userID, acct))
 		}
 		writeJSON(w, http.StatusOK, statuses)
@@ -381,23 +896,42 @@ func handleSyncStatus(syncSvc *sync.Service, accounts *account.Store) http.Handl
 
 func handleSearch(cfg Config) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
 		userID := auth.UserIDFromContext(r.Context())
 		q := r.URL.Query().Get("q")
 		accountFilter := r.URL.Query().Get("account_id")
 		accountIDsFilter := r.URL.Query().Get("account_ids")
-		limit := queryInt(r, "limit", 50)
+		limit := searchLimit(cfg, w, r)
 		offset := queryInt(r, "offset", 0)
-
-		if limit < 1 {
-			limit = 50
+		fields, err := index.ParseFields(r.URL.Query().Get("fields"))
+		if err != nil {
+			writeError(w, http.StatusBadRequest, codeBadRequest, err.Error())
+			return
 		}
-		if limit > 500 {
-			limit = 500
+		group := r.URL.Query().Get("group")
+		if group != "" && group != "thread" {
+			writeError(w, http.StatusBadRequest, codeBadRequest, `group must be "thread"`)
+			return
+		}
+		explain, _ := strconv.ParseBool(r.URL.Query().Get("explain"))
+		annotations := userAnnotations(cfg, userID)
+		ctx := index.WithMarks(r.Context(), marksOf(annotations))
+		if preview, _ := strconv.ParseBool(r.URL.Query().Get("preview")); preview {
+			ctx = index.WithPreview(ctx)
 		}
+		// Conversations are grouped over the newest maxThreadHits matches,
+		// then paged.
+		pageOffset, pageLimit := offset, limit
+		if group == "thread" {
+			offset, limit = 0, maxThreadHits
+		}
+
+		empty := index.SearchResult{Query: q, Offset: pageOffset, Limit: pageLimit, Hits: []index.Hit{},
+			Pagination: model.NewPagination(0, pageOffset, pageLimit, r.URL.Query())}
 
 		accts, _ := cfg.Accounts.List(userID)
 		if len(accts) == 0 {
-			writeJSON(w, http.StatusOK, index.SearchResult{Hits: []index.Hit{}})
+			writeJSON(w, http.StatusOK, empty)
 			return
 		}
 
@@ -408,17 +942,12 @@ func handleSearch(cfg Config) http.HandlerFunc {
 			found := false
 			for _, a := range accts {
 				if a.ID == accountFilter {
-					emailDir := account.EmailDir(cfg.UsersDir, userID, a)
-					indexPath := account.IndexPath(cfg.UsersDir, userID, a)
-					idx, err := index.New(emailDir, indexPath, cfg.BlobStore, cfg.UsersDir)
+					idx, err := openAccountIndex(ctx, cfg, userID, a)
 					if err != nil {
-						writeError(w, http.StatusInternalServerError, "index error: "+err.Error())
+						writeIndexError(w, err)
 						return
 					}
-					if idx.Stats().TotalEmails == 0 {
-						idx.Build()
-					}
-					result = idx.Search(q, offset, limit)
+					result = idx.SearchContext(ctx, q, offset, limit, fields...)
 					idx.Close()
 					for i := range result.Hits {
 						result.Hits[i].AccountID = a.ID
@@ -428,262 +957,1343 @@ func handleSearch(cfg Config) http.HandlerFunc {
 				}
 			}
 			if !found {
-				writeJSON(w, http.StatusOK, index.SearchResult{Hits: []index.Hit{}})
+				writeJSON(w, http.StatusOK, empty)
 				return
 			}
 		} else {
-			// Filter by account_ids (comma-separated) if provided.
-			var allowedIDs map[string]bool
-			if accountIDsFilter != "" {
-				allowedIDs = make(map[string]bool)
-				for _, id := range strings.Split(accountIDsFilter, ",") {
-					if id = strings.TrimSpace(id); id != "" {
-						allowedIDs[id] = true
-					}
-				}
-			}
-			accountIndices := make([]index.AccountIndex, 0, len(accts))
-			for _, a := range accts {
-				if allowedIDs != nil && !allowedIDs[a.ID] {
-					continue
-				}
-				accountIndices = append(accountIndices, index.AccountIndex{
-					ID:        a.ID,
-					IndexPath: account.IndexPath(cfg.UsersDir, userID, a),
-				})
-			}
-			result = index.SearchMulti(accountIndices, q, offset, limit)
+			accountIndices := accountIndicesFor(cfg, userID, accts, accountIDsFilter)
+			result = index.SearchMultiContext(ctx, accountIndices, q, offset, limit, fields...)
+		}
+
+		if explain {
+			for i := range result.Hits {
+				result.Hits[i].Explain = index.Explain(q, fields, result.Hits[i])
+			}
+		}
+		markHits(result.Hits, annotations)
+		if group == "thread" {
+			result.Threads, result.Total = index.GroupByThread(result.Hits, pageOffset, pageLimit)
+			result.Hits = []index.Hit{}
+			result.Offset, result.Limit = pageOffset, pageLimit
+			result.Group = group
+		}
+		result.Pagination = model.NewPagination(result.Total, result.Offset, result.Limit, r.URL.Query())
+		result.TookMS = time.Since(start).Milliseconds()
+		writeJSON(w, http.StatusOK, result)
+	}
+}
+
+// maxThreadHits caps the matches group=thread loads to group into
+// conversations: the newest ones, so a broad query does not load the whole
+// archive into memory.
+var maxThreadHits = 10000
+
+// handleSearchStream writes every hit as one JSON object per line
+// (application/x-ndjson) straight from the DuckDB cursor. It accepts the same
+// q, account_id, account_ids and fields parameters as /api/search.
+func handleSearchStream(cfg Config) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		userID := auth.UserIDFromContext(r.Context())
+		q := r.URL.Query().Get("q")
+		accountFilter := r.URL.Query().Get("account_id")
+		fields, err := index.ParseFields(r.URL.Query().Get("fields"))
+		if err != nil {
+			writeError(w, http.StatusBadRequest, codeBadRequest, err.Error())
+			return
+		}
+
+		accts, _ := cfg.Accounts.List(userID)
+
+		var idx *index.Index
+		var acctID string
+		if accountFilter != "" {
+			for _, a := range accts {
+				if a.ID != accountFilter {
+					continue
+				}
+				idx, err = openAccountIndex(r.Context(), cfg, userID, a)
+				if err != nil {
+					writeIndexError(w, err)
+					return
+				}
+				defer idx.Close()
+				acctID = a.ID
+				break
+			}
+			if idx == nil {
+				writeError(w, http.StatusNotFound, codeNotFound, "account not found")
+				return
+			}
+		}
+
+		annotations := userAnnotations(cfg, userID)
+		ctx := index.WithMarks(r.Context(), marksOf(annotations))
+
+		w.Header().Set("Content-Type", "application/x-ndjson")
+		w.WriteHeader(http.StatusOK)
+		enc := json.NewEncoder(w)
+		flusher, _ := w.(http.Flusher)
+		n := 0
+		write := func(h index.Hit) error {
+			if acctID != "" {
+				h.AccountID = acctID
+			}
+			if a, ok := annotations[annotation.Key(h.Path)]; ok {
+				h.Flagged, h.Starred, h.VFolder = a.Flagged, a.Starred, a.Folder
+			}
+			if err := enc.Encode(h); err != nil {
+				return err
+			}
+			if n++; flusher != nil && n%100 == 0 {
+				flusher.Flush()
+			}
+			return nil
+		}
+
+		if idx != nil {
+			err = idx.Stream(ctx, q, fields, write)
+		} else {
+			err = index.StreamMulti(ctx, accountIndicesFor(cfg, userID, accts, r.URL.Query().Get("account_ids")), q, fields, write)
+		}
+		if err != nil && r.Context().Err() == nil {
+			// Headers are already sent; the truncated stream is the only signal left.
+			log.Printf("WARN: search stream for %s: %v", userID, err)
+		}
+	}
+}
+
+// accountIndicesFor returns the parquet indices of accts, restricted to the
+// comma-separated accountIDs when non-empty.
+func accountIndicesFor(cfg Config, userID string, accts []model.EmailAccount, accountIDs string) []index.AccountIndex {
+	var allowedIDs map[string]bool
+	if accountIDs != "" {
+		allowedIDs = make(map[string]bool)
+		for _, id := range strings.Split(accountIDs, ",") {
+			if id = strings.TrimSpace(id); id != "" {
+				allowedIDs[id] = true
+			}
+		}
+	}
+	accountIndices := make([]index.AccountIndex, 0, len(accts))
+	for _, a := range accts {
+		if allowedIDs != nil && !allowedIDs[a.ID] {
+			continue
+		}
+		accountIndices = append(accountIndices, index.AccountIndex{
+			ID:        a.ID,
+			IndexPath: account.IndexPath(cfg.UsersDir, userID, a),
+			EmailDir:  account.EmailDir(cfg.UsersDir, userID, a),
+		})
+	}
+	return accountIndices
+}
+
+// handleTimeline counts the hits of a search per month for a
+// mail-over-time histogram. It accepts the same q, account_id, account_ids
+// and fields parameters as /api/search.
+func handleTimeline(cfg Config) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		userID := auth.UserIDFromContext(r.Context())
+		fields, err := index.ParseFields(r.URL.Query().Get("fields"))
+		if err != nil {
+			writeError(w, http.StatusBadRequest, codeBadRequest, err.Error())
+			return
+		}
+		accountIDs := r.URL.Query().Get("account_ids")
+		if id := r.URL.Query().Get("account_id"); id != "" {
+			accountIDs = id
+		}
+
+		accts, _ := cfg.Accounts.List(userID)
+		accountIndices := accountIndicesFor(cfg, userID, accts, accountIDs)
+		ctx := index.WithMarks(r.Context(), marksOf(userAnnotations(cfg, userID)))
+		writeJSON(w, http.StatusOK, index.TimelineMulti(ctx, accountIndices, r.URL.Query().Get("q"), fields))
+	}
+}
+
+// handleSuggest returns subject and sender completions for the search box.
+func handleSuggest(cfg Config) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		userID := auth.UserIDFromContext(r.Context())
+		q := r.URL.Query().Get("q")
+		limit := queryInt(r, "limit", 10)
+		if limit < 1 || limit > 50 {
+			limit = 10
+		}
+
+		accts, _ := cfg.Accounts.List(userID)
+		accountIndices := accountIndicesFor(cfg, userID, accts, r.URL.Query().Get("account_ids"))
+		writeJSON(w, http.StatusOK, index.SuggestMultiContext(r.Context(), accountIndices, q, limit))
+	}
+}
+
+// handleAddresses returns address book completions for q: addresses from
+// the user's indexed mail and imported vCards.
+func handleAddresses(cfg Config) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		userID := auth.UserIDFromContext(r.Context())
+		limit := queryInt(r, "limit", 10)
+		if limit < 1 || limit > 50 {
+			limit = 10
+		}
+
+		accts, _ := cfg.Accounts.List(userID)
+		accountIndices := accountIndicesFor(cfg, userID, accts, r.URL.Query().Get("account_ids"))
+		writeJSON(w, http.StatusOK, index.SuggestAddresses(r.Context(), accountIndices, r.URL.Query().Get("q"), limit))
+	}
+}
+
+func handleEmailDetail(cfg Config) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		userID := auth.UserIDFromContext(r.Context())
+		p := r.URL.Query().Get("path")
+		accountID := r.URL.Query().Get("account_id")
+
+		if p == "" {
+			writeError(w, http.StatusBadRequest, codeInvalidPath, "missing path parameter")
+			return
+		}
+
+		cleaned := filepath.Clean(p)
+		if strings.Contains(cleaned, "..") {
+			writeError(w, http.StatusBadRequest, codeInvalidPath, "invalid path")
+			return
+		}
+
+		accts, _ := cfg.Accounts.List(userID)
+		var emailDir, indexPath string
+		if accountID != "" {
+			for _, a := range accts {
+				if a.ID == accountID {
+					emailDir = account.EmailDir(cfg.UsersDir, userID, a)
+					indexPath = account.IndexPath(cfg.UsersDir, userID, a)
+					break
+				}
+			}
+		} else if a, ok := defaultAccount(cfg, userID, accts); ok {
+			emailDir = account.EmailDir(cfg.UsersDir, userID, a)
+			indexPath = account.IndexPath(cfg.UsersDir, userID, a)
+		}
+
+		if emailDir == "" {
+			writeError(w, http.StatusNotFound, codeNotFound, "no accounts configured")
+			return
+		}
+
+		// source=index answers from the Parquet index alone: no attachments
+		// or CC, and HTML only when it was built with INDEX_HTML.
+		if r.URL.Query().Get("source") == "index" {
+			fe, err := index.Detail(r.Context(), indexPath, cleaned)
+			if err != nil {
+				if errors.Is(err, index.ErrNotIndexed) {
+					writeError(w, http.StatusNotFound, codeNotIndexed, "email not in index")
+					return
+				}
+				writeError(w, http.StatusInternalServerError, codeInternal, "index error: "+err.Error())
+				return
+			}
+			writeJSON(w, http.StatusOK, fe)
+			return
+		}
+
+		full := filepath.Join(emailDir, cleaned)
+		data, err := readEmailBytes(cfg, full)
+		if err != nil {
+			if errors.Is(err, storage.ErrNotFound) {
+				writeError(w, http.StatusNotFound, codeNotFound, "email not found")
+				return
+			}
+			writeError(w, http.StatusInternalServerError, codeInternal, "failed to read email")
+			return
+		}
+		fe, err := eml.ParseFileFullFromBytes(cleaned, data)
+		if err != nil {
+			writeError(w, http.StatusNotFound, codeNotFound, "email not found")
+			return
+		}
+		if r.URL.Query().Get("headers") != "1" {
+			fe.Received = nil
+		}
+		markTruncated(&fe, cfg.MaxAttachmentBytes)
+		a := userAnnotations(cfg, userID)[annotation.Key(cleaned)]
+		fe.Flagged, fe.Starred, fe.VFolder = a.Flagged, a.Starred, a.Folder
+		writeJSON(w, http.StatusOK, fe)
+	}
+}
+
+// emailMarks is the answer to the flag, unflag, star and unstar endpoints.
+type emailMarks struct {
+	Path    string `json:"path"`
+	Flagged bool   `json:"flagged"`
+	Starred bool   `json:"starred"`
+}
+
+// handleAnnotate applies mark to the user's annotation of the email at
+// ?path=. Annotations are keyed by the checksum the file name starts
+// with, so they hold for every copy of the message in any account and
+// survive reindexing; files named without one cannot be marked.
+func handleAnnotate(cfg Config, mark func(*annotation.Annotation)) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		userID := auth.UserIDFromContext(r.Context())
+		p := r.URL.Query().Get("path")
+		if p == "" {
+			writeError(w, http.StatusBadRequest, codeInvalidPath, "missing path parameter")
+			return
+		}
+		key := annotation.Key(p)
+		if key == "" {
+			writeError(w, http.StatusBadRequest, codeInvalidPath, "file name has no checksum to annotate the email by; run mails migrate-filenames")
+			return
+		}
+		a, err := cfg.Annotations.Update(userID, key, mark)
+		if err != nil {
+			writeError(w, http.StatusInternalServerError, codeInternal, "save annotation: "+err.Error())
+			return
+		}
+		writeJSON(w, http.StatusOK, emailMarks{Path: p, Flagged: a.Flagged, Starred: a.Starred})
+	}
+}
+
+// moveRequest is the body of POST /api/email/move.
+type moveRequest struct {
+	Paths  []string `json:"paths"`
+	Folder string   `json:"folder"`
+}
+
+// moveResult is the answer to POST /api/email/move. Skipped lists the
+// paths whose file name has no checksum to annotate them by.
+type moveResult struct {
+	Folder  string   `json:"folder"`
+	Moved   int      `json:"moved"`
+	Skipped []string `json:"skipped,omitempty"`
+}
+
+// handleMoveEmails puts emails in a virtual folder, which the vfolder:
+// search operator finds as well as the folder the files are in. Files are
+// never moved: like flags, the folder is an annotation keyed by checksum,
+// so it holds for every copy and survives reindexing. An empty folder
+// moves the emails back to their real folders only.
+func handleMoveEmails(cfg Config) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		userID := auth.UserIDFromContext(r.Context())
+		var req moveRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			writeError(w, http.StatusBadRequest, codeInvalidBody, "invalid request body")
+			return
+		}
+		if len(req.Paths) == 0 {
+			writeError(w, http.StatusBadRequest, codeMissingParameter, "paths is required")
+			return
+		}
+		folder, err := annotation.NormalizeFolder(req.Folder)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, codeBadRequest, err.Error())
+			return
+		}
+
+		res := moveResult{Folder: folder}
+		var keys []string
+		for _, p := range req.Paths {
+			key := annotation.Key(p)
+			if key == "" {
+				res.Skipped = append(res.Skipped, p)
+				continue
+			}
+			keys = append(keys, key)
+			res.Moved++
+		}
+		if len(keys) > 0 {
+			if err := cfg.Annotations.UpdateMany(userID, keys, func(a *annotation.Annotation) { a.Folder = folder }); err != nil {
+				writeError(w, http.StatusInternalServerError, codeInternal, "save annotation: "+err.Error())
+				return
+			}
+		}
+		writeJSON(w, http.StatusOK, res)
+	}
+}
+
+// userAnnotations returns the user's annotations by key. A store error is
+// logged and leaves every email unmarked.
+func userAnnotations(cfg Config, userID string) map[string]annotation.Annotation {
+	all, err := cfg.Annotations.All(userID)
+	if err != nil {
+		log.Printf("WARN: annotations of user %s: %v", userID, err)
+	}
+	return all
+}
+
+// marksOf lists the flagged, starred and moved keys of annotations, for
+// the flagged:, starred: and vfolder: search operators.
+func marksOf(annotations map[string]annotation.Annotation) index.Marks {
+	m := index.Marks{Folders: make(map[string][]string)}
+	for key, a := range annotations {
+		if a.Flagged {
+			m.Flagged = append(m.Flagged, key)
+		}
+		if a.Starred {
+			m.Starred = append(m.Starred, key)
+		}
+		if a.Folder != "" {
+			name := index.FolderKey(a.Folder)
+			m.Folders[name] = append(m.Folders[name], key)
+		}
+	}
+	return m
+}
+
+// markHits sets Flagged and Starred on hits from annotations.
+func markHits(hits []index.Hit, annotations map[string]annotation.Annotation) {
+	if len(annotations) == 0 {
+		return
+	}
+	for i := range hits {
+		a := annotations[annotation.Key(hits[i].Path)]
+		hits[i].Flagged, hits[i].Starred, hits[i].VFolder = a.Flagged, a.Starred, a.Folder
+	}
+}
+
+// readEmailBytes returns email content by full path, decompressing
+// .eml.gz and .eml.zst files. Uses BlobStore when configured.
+func readEmailBytes(cfg Config, fullPath string) ([]byte, error) {
+	if cfg.BlobStore != nil {
+		rel, err := filepath.Rel(cfg.UsersDir, fullPath)
+		if err != nil {
+			return nil, err
+		}
+		key := filepath.ToSlash(rel)
+		data, err := cfg.BlobStore.Read(context.Background(), key)
+		if err != nil {
+			return nil, err
+		}
+		return eml.Decompress(key, data)
+	}
+	return eml.ReadFile(fullPath)
+}
+
+// resolveEmailPath returns the full filesystem path for an email from path + account_id query params.
+func resolveEmailPath(cfg Config, r *http.Request) (string, bool) {
+	userID := auth.UserIDFromContext(r.Context())
+	p := r.URL.Query().Get("path")
+	accountID := r.URL.Query().Get("account_id")
+	if p == "" {
+		return "", false
+	}
+	cleaned := filepath.Clean(p)
+	if strings.Contains(cleaned, "..") {
+		return "", false
+	}
+	accts, _ := cfg.Accounts.List(userID)
+	var emailDir string
+	if accountID != "" {
+		for _, a := range accts {
+			if a.ID == accountID {
+				emailDir = account.EmailDir(cfg.UsersDir, userID, a)
+				break
+			}
+		}
+	} else if a, ok := defaultAccount(cfg, userID, accts); ok {
+		emailDir = account.EmailDir(cfg.UsersDir, userID, a)
+	}
+	if emailDir == "" {
+		return "", false
+	}
+	return filepath.Join(emailDir, cleaned), true
+}
+
+func handleEmailDownload(cfg Config) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		full, ok := resolveEmailPath(cfg, r)
+		if !ok {
+			writeError(w, http.StatusBadRequest, codeInvalidPath, "missing or invalid path")
+			return
+		}
+		data, err := readEmailBytes(cfg, full)
+		if err != nil {
+			if errors.Is(err, storage.ErrNotFound) {
+				writeError(w, http.StatusNotFound, codeNotFound, "email not found")
+				return
+			}
+			writeError(w, http.StatusInternalServerError, codeInternal, "failed to read email")
+			return
+		}
+		name := eml.PlainName(filepath.Base(full))
+		w.Header().Set("Content-Disposition", `attachment; filename="`+name+`"`)
+		w.Header().Set("Content-Type", "message/rfc822")
+		w.Write(data)
+	}
+}
+
+// handleEmailPDF renders one email as a PDF for sharing or archival. Remote
+// content is never fetched; see pdf.Email.
+func handleEmailPDF(cfg Config) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		full, ok := resolveEmailPath(cfg, r)
+		if !ok {
+			writeError(w, http.StatusBadRequest, codeInvalidPath, "missing or invalid path")
+			return
+		}
+		data, err := readEmailBytes(cfg, full)
+		if err != nil {
+			if errors.Is(err, storage.ErrNotFound) {
+				writeError(w, http.StatusNotFound, codeNotFound, "email not found")
+				return
+			}
+			writeError(w, http.StatusInternalServerError, codeInternal, "failed to read email")
+			return
+		}
+		fe, err := eml.ParseFileFullFromBytes(filepath.Base(full), data)
+		if err != nil {
+			writeError(w, http.StatusNotFound, codeNotFound, "email not found")
+			return
+		}
+		base := eml.PlainName(filepath.Base(full))
+		name := strings.TrimSuffix(base, filepath.Ext(base)) + ".pdf"
+		w.Header().Set("Content-Disposition", `inline; filename="`+name+`"`)
+		w.Header().Set("Content-Type", "application/pdf")
+		w.Write(pdf.Email(fe))
+	}
+}
+
+// handleEmailPrint renders one email as a standalone HTML page for the
+// browser's print dialog or saving: headers as a table, the body inlined
+// with its cid: images as data: URIs, and remote content blocked. Emails
+// from the user's trusted senders keep their remote images.
+func handleEmailPrint(cfg Config) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		full, ok := resolveEmailPath(cfg, r)
+		if !ok {
+			writeError(w, http.StatusBadRequest, codeInvalidPath, "missing or invalid path")
+			return
+		}
+		data, err := readEmailBytes(cfg, full)
+		if err != nil {
+			if errors.Is(err, storage.ErrNotFound) || errors.Is(err, os.ErrNotExist) {
+				writeError(w, http.StatusNotFound, codeNotFound, "email not found")
+				return
+			}
+			writeError(w, http.StatusInternalServerError, codeInternal, "failed to read email")
+			return
+		}
+		fe, err := eml.ParseFileFullFromBytes(filepath.Base(full), data)
+		if err != nil {
+			writeError(w, http.StatusNotFound, codeNotFound, "email not found")
+			return
+		}
+		base := eml.PlainName(filepath.Base(full))
+		name := strings.TrimSuffix(base, filepath.Ext(base)) + ".html"
+		w.Header().Set("Content-Disposition", `inline; filename="`+name+`"`)
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		csp, trusted := printCSP, false
+		if cfg.Users != nil && user.SenderTrusted(cfg.Users.Get(auth.UserIDFromContext(r.Context())), fe.From) {
+			csp, trusted = printCSPRemoteImages, true
+		}
+		w.Header().Set("Content-Security-Policy", csp)
+		w.Header().Set("Referrer-Policy", "no-referrer")
+		if err := renderPrint(w, newPrintMessage(fe, trusted)); err != nil {
+			log.Printf("WARN: print %s: %v", full, err)
+		}
+	}
+}
+
+// handleReplyDraft returns a reply to one email, addressed, threaded and
+// with the original quoted, for the client to edit before sending.
+func handleReplyDraft(cfg Config) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		full, ok := resolveEmailPath(cfg, r)
+		if !ok {
+			writeError(w, http.StatusBadRequest, codeInvalidPath, "missing or invalid path")
+			return
+		}
+		data, err := readEmailBytes(cfg, full)
+		if err != nil {
+			if errors.Is(err, storage.ErrNotFound) || errors.Is(err, os.ErrNotExist) {
+				writeError(w, http.StatusNotFound, codeNotFound, "email not found")
+				return
+			}
+			writeError(w, http.StatusInternalServerError, codeInternal, "failed to read email")
+			return
+		}
+		draft, err := eml.NewReplyDraft(data)
+		if err != nil {
+			writeError(w, http.StatusNotFound, codeNotFound, "email not found")
+			return
+		}
+		writeJSON(w, http.StatusOK, draft)
+	}
+}
+
+func handleAttachmentDownload(cfg Config) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		full, ok := resolveEmailPath(cfg, r)
+		if !ok {
+			writeError(w, http.StatusBadRequest, codeInvalidPath, "missing or invalid path")
+			return
+		}
+		emailData, err := readEmailBytes(cfg, full)
+		if err != nil {
+			if errors.Is(err, storage.ErrNotFound) {
+				writeError(w, http.StatusNotFound, codeNotFound, "attachment not found")
+				return
+			}
+			writeError(w, http.StatusInternalServerError, codeInternal, "failed to read email")
+			return
+		}
+		idx := queryInt(r, "index", -1)
+		if idx < 0 {
+			writeError(w, http.StatusBadRequest, codeMissingParameter, "missing or invalid index parameter")
+			return
+		}
+		body, contentType, filename, err := eml.OpenAttachmentFromBytes(emailData, idx)
+		if err != nil {
+			writeError(w, http.StatusNotFound, codeNotFound, "attachment not found")
+			return
+		}
+		if filename == "" {
+			filename = "attachment"
+		}
+		// Escape quotes in filename to avoid breaking header
+		safeName := strings.ReplaceAll(filename, `"`, `_`)
+		w.Header().Set("Content-Disposition", `attachment; filename="`+safeName+`"`)
+		if contentType != "" {
+			w.Header().Set("Content-Type", contentType)
+		}
+		// Stream the decoded part; only the configured hard limit cuts it short.
+		if cfg.MaxAttachmentBytes > 0 {
+			body = io.LimitReader(body, cfg.MaxAttachmentBytes)
+		}
+		if _, err := io.Copy(w, body); err != nil {
+			log.Printf("WARN: attachment %d of %s: %v", idx, full, err)
+		}
+	}
+}
+
+// markTruncated flags attachments (including those of forwarded messages)
+// that are larger than limit and will be cut short on download.
+func markTruncated(fe *eml.FullEmail, limit int64) {
+	if limit <= 0 {
+		return
+	}
+	for i := range fe.Attachments {
+		if int64(fe.Attachments[i].Size) > limit {
+			fe.Attachments[i].Truncated = true
+		}
+	}
+	for i := range fe.Embedded {
+		markTruncated(&fe.Embedded[i], limit)
+	}
+}
+
+// handleCIDResource serves inline MIME parts by Content-ID. Protected by RequireAuth;
+// resolveEmailPath scopes access to the logged-in user's accounts only.
+func handleCIDResource(cfg Config) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		full, ok := resolveEmailPath(cfg, r)
+		if !ok {
+			writeError(w, http.StatusBadRequest, codeInvalidPath, "missing or invalid path")
+			return
+		}
+		cid := strings.TrimSpace(r.URL.Query().Get("cid"))
+		if cid == "" {
+			writeError(w, http.StatusBadRequest, codeMissingParameter, "missing cid parameter")
+			return
+		}
+		data, contentType, err := eml.ExtractPartByCID(full, cid)
+		if err != nil {
+			writeError(w, http.StatusNotFound, codeNotFound, "resource not found")
+			return
+		}
+		if contentType != "" {
+			w.Header().Set("Content-Type", contentType)
+		}
+		w.Header().Set("Cache-Control", "private, max-age=3600")
+		w.Write(data)
+	}
+}
+
+func handleSearchStats(cfg Config) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		userID := auth.UserIDFromContext(r.Context())
+		accts, _ := cfg.Accounts.List(userID)
+
+		out := map[string]any{
+			"total_emails":         0,
+			"accounts":             len(accts),
+			"similarity_available": cfg.QdrantURL != "" && cfg.OllamaURL != "",
+		}
+		if cfg.Sync != nil {
+			if used, err := cfg.Sync.UserUsage(userID); err != nil {
+				log.Printf("WARN: stats: disk usage: %v", err)
+			} else {
+				out["disk_bytes"] = used
+				if quota := cfg.Sync.Quota(); quota > 0 {
+					out["quota_bytes"] = quota
+					out["quota_exceeded"] = used >= quota
+				}
+			}
+		}
+		writeJSON(w, http.StatusOK, out)
+	}
+}
+
+// setupStatus is the /api/setup-status response, which the dashboard uses
+// to guide a new user through setup.
+type setupStatus struct {
+	// Providers are the configured OAuth providers, sorted.
+	Providers  []string         `json:"providers"`
+	Similarity similarityStatus `json:"similarity"`
+	Accounts   int              `json:"accounts"`
+	// IndexedEmails counts the user's indexed emails, duplicates across
+	// accounts once.
+	IndexedEmails int `json:"indexed_emails"`
+	// NextStep is "add_account" without accounts, "sync" while nothing is
+	// indexed, then "search".
+	NextStep string `json:"next_step"`
+}
+
+// similarityStatus reports whether similarity search can work: configured
+// (QDRANT_URL and OLLAMA_URL set) and, if so, whether the backends answer.
+type similarityStatus struct {
+	Configured bool `json:"configured"`
+	vector.Health
+}
+
+// setupCheckTimeout bounds the Qdrant and Ollama checks of /api/setup-status.
+const setupCheckTimeout = 3 * time.Second
+
+// handleSetupStatus reports what is configured and what the user has set up
+// so far. It only reads state; the backends are asked whether they are up.
+func handleSetupStatus(cfg Config) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		userID := auth.UserIDFromContext(r.Context())
+		accts, err := cfg.Accounts.List(userID)
+		if err != nil {
+			writeError(w, http.StatusInternalServerError, codeInternal, err.Error())
+			return
+		}
+
+		out := setupStatus{Providers: []string{}, Accounts: len(accts)}
+		if cfg.Auth != nil {
+			out.Providers = append(out.Providers, cfg.Auth.Available()...)
+			sort.Strings(out.Providers)
+		}
+		if cfg.QdrantURL != "" && cfg.OllamaURL != "" {
+			ctx, cancel := context.WithTimeout(r.Context(), setupCheckTimeout)
+			out.Similarity = similarityStatus{Configured: true, Health: vector.CheckHealth(ctx, cfg.QdrantURL, cfg.OllamaURL, cfg.EmbedModel)}
+			cancel()
+		}
+		if len(accts) > 0 {
+			out.IndexedEmails = index.SearchMultiContext(r.Context(), accountIndicesFor(cfg, userID, accts, ""), "", 0, 1).Total
+		}
+		switch {
+		case out.Accounts == 0:
+			out.NextStep = "add_account"
+		case out.IndexedEmails == 0:
+			out.NextStep = "sync"
+		default:
+			out.NextStep = "search"
+		}
+		writeJSON(w, http.StatusOK, out)
+	}
+}
+
+// handleReindex rebuilds, in the background, the keyword index of every
+// account whose email files changed since its last build. With force=true
+// all indexes are rebuilt, e.g. after changing INDEX_HEADERS. When
+// similarity search is configured and Config.ReindexVectors is set, the
+// rebuilt accounts' vectors are brought up to date afterwards.
+func handleReindex(cfg Config) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		userID := auth.UserIDFromContext(r.Context())
+		force := r.URL.Query().Get("force") == "true"
+		accts, err := cfg.Accounts.List(userID)
+		if err != nil {
+			writeError(w, http.StatusInternalServerError, codeInternal, err.Error())
+			return
+		}
+
+		jobID := model.NewID()
+		job := &importJob{ID: jobID, UserID: userID, Phase: "indexing"}
+		var stale []*index.Index
+		var failed []accountProgress
+		for _, acct := range accts {
+			emailDir := account.EmailDir(cfg.UsersDir, userID, acct)
+			indexPath := account.IndexPath(cfg.UsersDir, userID, acct)
+			idx, err := index.New(emailDir, indexPath, cfg.BlobStore, cfg.UsersDir)
+			if err != nil {
+				log.Printf("WARN: reindex %s: %v", acct.Email, err)
+				failed = append(failed, accountProgress{AccountID: acct.ID, Status: "error", Error: err.Error()})
+				continue
+			}
+			idx.SetExcludeFolders(acct.ExcludeFolders)
+			if !force && idx.UpToDate() {
+				idx.Close()
+				continue
+			}
+			stale = append(stale, idx)
+			job.Accounts = append(job.Accounts, accountProgress{AccountID: acct.ID, Status: "pending"})
+		}
+		if len(stale) == 0 {
+			writeJSON(w, http.StatusOK, map[string]string{"status": "unchanged"})
+			return
+		}
+		// Accounts that failed to open follow the ones being rebuilt.
+		job.Accounts = append(job.Accounts, failed...)
+		job.Total = len(job.Accounts)
+		job.Current = len(failed)
+		setImportJob(jobID, job)
+
+		dirs := make([]string, len(stale))
+		cursors := make([]string, len(stale))
+		for i, idx := range stale {
+			dirs[i] = idx.EmailDir()
+			cursors[i] = filepath.Join(filepath.Dir(idx.IndexPath()), vectorCursorFile)
+		}
+		go func() {
+			defer scheduleImportJobCleanup(jobID)
+			reindexAccounts(job, stale, cfg.ReindexWorkers)
+			if cfg.ReindexVectors && cfg.QdrantURL != "" && cfg.OllamaURL != "" {
+				reindexVectors(cfg, job, dirs, cursors)
+			}
+			updateImportJob(job, func(j *importJob) { j.Phase = "done" })
+		}()
+
+		writeJSON(w, http.StatusAccepted, map[string]string{"status": "started", "job_id": jobID})
+	}
+}
+
+// defaultReindexWorkers is how many accounts a reindex builds at once when
+// Config.ReindexWorkers is 0.
+const defaultReindexWorkers = 2
+
+// reindexAccounts builds the stale indexes, whose accounts are the first
+// len(stale) of job.Accounts, on up to workers goroutines, and closes
+// them; the caller marks the job done. Each index has its own DuckDB
+// connection and parquet file, so the builds share nothing but job, which
+// importJobsMu guards. A build that panics fails its account only.
+func reindexAccounts(job *importJob, stale []*index.Index, workers int) {
+	if workers <= 0 {
+		workers = defaultReindexWorkers
+	}
+	update := func(i int, fn func(p *accountProgress)) {
+		updateImportJob(job, func(j *importJob) { fn(&j.Accounts[i]) })
+	}
+
+	work := make(chan int)
+	var wg gosync.WaitGroup
+	for range min(workers, len(stale)) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range work {
+				update(i, func(p *accountProgress) { p.Status = "indexing" })
+				n, err := buildIndex(stale[i])
+				update(i, func(p *accountProgress) {
+					p.Status, p.Emails = "done", n
+					if err != nil {
+						p.Status, p.Error = "error", err.Error()
+					}
+					job.Current++
+				})
+				if err != nil {
+					log.Printf("WARN: reindex %s: %v", stale[i].EmailDir(), err)
+				} else {
+					log.Printf("INFO: reindexed %s (%d emails)", stale[i].EmailDir(), n)
+				}
+			}
+		}()
+	}
+	for i := range stale {
+		work <- i
+	}
+	close(work)
+	wg.Wait()
+}
+
+// vectorCursorFile names the file, beside an account's index, that lets
+// an interrupted vector reindex resume (see vector.IndexOptions).
+const vectorCursorFile = ".vector-cursor.json"
+
+// reindexVectors updates the similarity index from the email directories
+// of the accounts reindexAccounts rebuilt, the first len(dirs) of
+// job.Accounts, one account at a time, keeping each one's resume cursor
+// at the path of the same index in cursors. Each account writes only
+// points scoped to it and job.UserID (see vector.Scope). Only emails whose text changed
+// are embedded again, so this is cheap after a sync. The job's phase is
+// "embedding"; each account's status is "embedding" while it runs, with
+// vectors counting its emails done. A failure is recorded as the
+// account's vector_error and leaves its keyword index in place.
+func reindexVectors(cfg Config, job *importJob, dirs, cursors []string) {
+	update := func(i int, fn func(p *accountProgress)) {
+		updateImportJob(job, func(j *importJob) { fn(&j.Accounts[i]) })
+	}
+	updateImportJob(job, func(j *importJob) { j.Phase = "embedding" })
+
+	store, err := vector.NewStore(cfg.QdrantURL, cfg.OllamaURL, cfg.EmbedModel)
+	if err != nil {
+		log.Printf("WARN: reindex vectors: %v", err)
+		for i := range dirs {
+			update(i, func(p *accountProgress) { p.VectorError = err.Error() })
+		}
+		return
+	}
+	defer store.Close()
+
+	ctx := context.Background()
+	for i, dir := range dirs {
+		var status, accountID string
+		update(i, func(p *accountProgress) {
+			status, accountID = p.Status, p.AccountID
+			if status == "done" {
+				p.Status = "embedding"
+			}
+		})
+		if status != "done" {
+			continue
+		}
+		opts := vector.IndexOptions{CursorPath: cursors[i]}
+		scoped := store.In(vector.Scope{UserID: job.UserID, AccountID: accountID})
+		n, _, err := scoped.IndexEmails(ctx, dir, index.StreamEmails, opts, func(done, _ int) {
+			update(i, func(p *accountProgress) { p.Vectors = done })
+		})
+		update(i, func(p *accountProgress) {
+			p.Status, p.Vectors = "done", n
+			if err != nil {
+				p.VectorError = err.Error()
+			}
+		})
+		if err != nil {
+			log.Printf("WARN: reindex vectors %s: %v", dir, err)
+		} else {
+			log.Printf("INFO: reindexed vectors %s (%d emails)", dir, n)
+		}
+	}
+}
+
+// coldBuildWait is how long openAccountIndex waits for the first build of
+// an index before giving up with errIndexBuilding; the build goes on.
+var coldBuildWait = 20 * time.Second
+
+// errIndexBuilding means an account's index is still being built for the
+// first time; the client should retry.
+var errIndexBuilding = errors.New("the account's index is being built, try again shortly")
+
+var (
+	coldBuildsMu gosync.Mutex
+	coldBuilds   = make(map[string]chan struct{}) // index path -> closed when built
+	// buildColdIndex builds and closes the index of a cold build.
+	buildColdIndex = buildIndex
+)
+
+// openAccountIndex opens the account's index with its excluded folders
+// set. An empty one is first built in the background (see buildCold),
+// outside the request's time limit; openAccountIndex waits up to
+// coldBuildWait for it, then returns errIndexBuilding. The caller closes
+// the index.
+func openAccountIndex(ctx context.Context, cfg Config, userID string, acct model.EmailAccount) (*index.Index, error) {
+	emailDir := account.EmailDir(cfg.UsersDir, userID, acct)
+	indexPath := account.IndexPath(cfg.UsersDir, userID, acct)
+	idx, err := index.New(emailDir, indexPath, cfg.BlobStore, cfg.UsersDir)
+	if err != nil {
+		return nil, err
+	}
+	idx.SetExcludeFolders(acct.ExcludeFolders)
+	if idx.Stats().TotalEmails > 0 {
+		return idx, nil
+	}
+	idx.Close()
+
+	timer := time.NewTimer(coldBuildWait)
+	defer timer.Stop()
+	select {
+	case <-buildCold(cfg, userID, acct):
+	case <-timer.C:
+		return nil, errIndexBuilding
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+	idx, err = index.New(emailDir, indexPath, cfg.BlobStore, cfg.UsersDir)
+	if err != nil {
+		return nil, err
+	}
+	idx.SetExcludeFolders(acct.ExcludeFolders)
+	return idx, nil
+}
+
+// buildCold starts building the account's index in the background unless
+// a build of it is already running, and returns a channel closed when
+// that build is done. Requests for the same account share one build.
+func buildCold(cfg Config, userID string, acct model.EmailAccount) <-chan struct{} {
+	indexPath := account.IndexPath(cfg.UsersDir, userID, acct)
+	coldBuildsMu.Lock()
+	defer coldBuildsMu.Unlock()
+	if done, ok := coldBuilds[indexPath]; ok {
+		return done
+	}
+	done := make(chan struct{})
+	coldBuilds[indexPath] = done
+	go func() {
+		defer func() {
+			coldBuildsMu.Lock()
+			delete(coldBuilds, indexPath)
+			coldBuildsMu.Unlock()
+			close(done)
+		}()
+		idx, err := index.New(account.EmailDir(cfg.UsersDir, userID, acct), indexPath, cfg.BlobStore, cfg.UsersDir)
+		if err != nil {
+			log.Printf("WARN: build %s: %v", acct.Email, err)
+			return
+		}
+		idx.SetExcludeFolders(acct.ExcludeFolders)
+		n, err := buildColdIndex(idx)
+		if err != nil {
+			log.Printf("WARN: build %s: %v", acct.Email, err)
+		} else {
+			log.Printf("INFO: built %s (%d emails)", acct.Email, n)
 		}
+	}()
+	return done
+}
 
-		writeJSON(w, http.StatusOK, result)
+// writeIndexError reports an openAccountIndex failure: 503 with
+// Retry-After while the first build runs, 500 otherwise.
+func writeIndexError(w http.ResponseWriter, err error) {
+	if errors.Is(err, errIndexBuilding) {
+		w.Header().Set("Retry-After", "5")
+		writeError(w, http.StatusServiceUnavailable, codeIndexBuilding, err.Error())
+		return
 	}
+	writeError(w, http.StatusInternalServerError, codeInternal, "index error: "+err.Error())
 }
 
-func handleEmailDetail(cfg Config) http.HandlerFunc {
+// buildIndex builds and closes idx, turning a panic in the build into an
+// error.
+func buildIndex(idx *index.Index) (n int, err error) {
+	defer idx.Close()
+	defer func() {
+		if p := recover(); p != nil {
+			err = fmt.Errorf("build panicked: %v", p)
+		}
+	}()
+	n, _ = idx.Build()
+	return n, nil
+}
+
+// handleReparseEmail re-parses one email with the current parser and
+// rewrites its keyword-index row and, when similarity search is configured
+// and Config.ReindexVectors is set, its vector point. Avoids a full reindex
+// after a parser fix.
+func handleReparseEmail(cfg Config) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		userID := auth.UserIDFromContext(r.Context())
 		p := r.URL.Query().Get("path")
 		accountID := r.URL.Query().Get("account_id")
-
-		if p == "" {
-			writeError(w, http.StatusBadRequest, "missing path parameter")
-			return
-		}
-
 		cleaned := filepath.Clean(p)
-		if strings.Contains(cleaned, "..") {
-			writeError(w, http.StatusBadRequest, "invalid path")
+		if p == "" || strings.Contains(cleaned, "..") || filepath.IsAbs(cleaned) {
+			writeError(w, http.StatusBadRequest, codeInvalidPath, "missing or invalid path")
 			return
 		}
 
 		accts, _ := cfg.Accounts.List(userID)
-		var emailDir string
+		var acct model.EmailAccount
+		var found bool
 		if accountID != "" {
 			for _, a := range accts {
 				if a.ID == accountID {
-					emailDir = account.EmailDir(cfg.UsersDir, userID, a)
+					acct, found = a, true
 					break
 				}
 			}
-		} else if len(accts) > 0 {
-			emailDir = account.EmailDir(cfg.UsersDir, userID, accts[0])
+		} else {
+			acct, found = defaultAccount(cfg, userID, accts)
 		}
-
-		if emailDir == "" {
-			writeError(w, http.StatusNotFound, "no accounts configured")
+		if !found {
+			writeError(w, http.StatusNotFound, codeNotFound, "account not found")
 			return
 		}
 
-		full := filepath.Join(emailDir, cleaned)
-		data, err := readEmailBytes(cfg, full)
+		idx, err := index.New(account.EmailDir(cfg.UsersDir, userID, acct), account.IndexPath(cfg.UsersDir, userID, acct), cfg.BlobStore, cfg.UsersDir)
 		if err != nil {
-			if errors.Is(err, storage.ErrNotFound) {
-				writeError(w, http.StatusNotFound, "email not found")
-				return
-			}
-			writeError(w, http.StatusInternalServerError, "failed to read email")
+			writeError(w, http.StatusInternalServerError, codeInternal, "index error: "+err.Error())
 			return
 		}
-		fe, err := eml.ParseFileFullFromBytes(cleaned, data)
+		defer idx.Close()
+
+		e, err := idx.Reparse(r.Context(), cleaned)
 		if err != nil {
-			writeError(w, http.StatusNotFound, "email not found")
+			switch {
+			case errors.Is(err, index.ErrNotIndexed):
+				writeError(w, http.StatusNotFound, codeNotFound, err.Error())
+			case errors.Is(err, storage.ErrNotFound), errors.Is(err, os.ErrNotExist):
+				writeError(w, http.StatusNotFound, codeNotFound, "email not found")
+			default:
+				writeError(w, http.StatusInternalServerError, codeInternal, err.Error())
+			}
 			return
 		}
-		writeJSON(w, http.StatusOK, fe)
-	}
-}
 
-// readEmailBytes returns email content by full path. Uses BlobStore when configured.
-func readEmailBytes(cfg Config, fullPath string) ([]byte, error) {
-	if cfg.BlobStore != nil {
-		rel, err := filepath.Rel(cfg.UsersDir, fullPath)
-		if err != nil {
-			return nil, err
+		out := map[string]any{
+			"account_id":     acct.ID,
+			"email":          e,
+			"vector_updated": false,
+		}
+		if cfg.ReindexVectors && cfg.QdrantURL != "" && cfg.OllamaURL != "" {
+			if err := upsertVector(r.Context(), cfg, vector.Scope{UserID: userID, AccountID: acct.ID}, e); err != nil {
+				log.Printf("WARN: reparse %s: vector upsert: %v", cleaned, err)
+				out["vector_error"] = err.Error()
+			} else {
+				out["vector_updated"] = true
+			}
 		}
-		key := filepath.ToSlash(rel)
-		return cfg.BlobStore.Read(context.Background(), key)
+		writeJSON(w, http.StatusOK, out)
 	}
-	return os.ReadFile(fullPath)
 }
 
-// resolveEmailPath returns the full filesystem path for an email from path + account_id query params.
-func resolveEmailPath(cfg Config, r *http.Request) (string, bool) {
-	userID := auth.UserIDFromContext(r.Context())
-	p := r.URL.Query().Get("path")
-	accountID := r.URL.Query().Get("account_id")
-	if p == "" {
-		return "", false
-	}
-	cleaned := filepath.Clean(p)
-	if strings.Contains(cleaned, "..") {
-		return "", false
-	}
-	accts, _ := cfg.Accounts.List(userID)
-	var emailDir string
-	if accountID != "" {
-		for _, a := range accts {
-			if a.ID == accountID {
-				emailDir = account.EmailDir(cfg.UsersDir, userID, a)
-				break
-			}
-		}
-	} else if len(accts) > 0 {
-		emailDir = account.EmailDir(cfg.UsersDir, userID, accts[0])
-	}
-	if emailDir == "" {
-		return "", false
+// upsertVector re-embeds e as a point scoped to its user and account, the
+// same point a reindex writes for it.
+func upsertVector(ctx context.Context, cfg Config, scope vector.Scope, e eml.Email) error {
+	store, err := vector.NewStore(cfg.QdrantURL, cfg.OllamaURL, cfg.EmbedModel)
+	if err != nil {
+		return err
 	}
-	return filepath.Join(emailDir, cleaned), true
+	defer store.Close()
+	return store.In(scope).UpsertEmail(ctx, e)
 }
 
-func handleEmailDownload(cfg Config) http.HandlerFunc {
+// maxBulkDelete caps how many emails one /api/delete call removes; a
+// non-zero remaining count in the response means the client calls again.
+const maxBulkDelete = 1000
+
+// bulkDeleteToken is the confirm value /api/delete expects. It is derived
+// from the user, account, query and fields, so a token shown for one
+// selection cannot confirm the deletion of another.
+func bulkDeleteToken(userID, accountID, q string, fields []string) string {
+	sum := sha256.Sum256([]byte(strings.Join([]string{
+		userID, accountID, strings.ToLower(strings.TrimSpace(q)), strings.Join(fields, ","),
+	}, "\x00")))
+	return hex.EncodeToString(sum[:8])
+}
+
+// handleBulkDelete deletes the emails of one account matching q (same q and
+// fields as /api/search): their .eml files, index rows and, when similarity
+// search is configured, vector points. Without the matching confirm token
+// nothing is deleted; the 409 response carries the match count and the token.
+func handleBulkDelete(cfg Config) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
-		full, ok := resolveEmailPath(cfg, r)
-		if !ok {
-			writeError(w, http.StatusBadRequest, "missing or invalid path")
+		userID := auth.UserIDFromContext(r.Context())
+		q := strings.TrimSpace(r.URL.Query().Get("q"))
+		accountID := r.URL.Query().Get("account_id")
+		fields, err := index.ParseFields(r.URL.Query().Get("fields"))
+		if err != nil {
+			writeError(w, http.StatusBadRequest, codeBadRequest, err.Error())
 			return
 		}
-		data, err := readEmailBytes(cfg, full)
-		if err != nil {
-			if errors.Is(err, storage.ErrNotFound) {
-				writeError(w, http.StatusNotFound, "email not found")
-				return
-			}
-			writeError(w, http.StatusInternalServerError, "failed to read email")
+		if q == "" {
+			writeError(w, http.StatusBadRequest, codeMissingParameter, "missing q parameter")
 			return
 		}
-		name := filepath.Base(full)
-		w.Header().Set("Content-Disposition", `attachment; filename="`+name+`"`)
-		w.Header().Set("Content-Type", "message/rfc822")
-		w.Write(data)
-	}
-}
-
-func handleAttachmentDownload(cfg Config) http.HandlerFunc {
-	return func(w http.ResponseWriter, r *http.Request) {
-		full, ok := resolveEmailPath(cfg, r)
-		if !ok {
-			writeError(w, http.StatusBadRequest, "missing or invalid path")
+		if accountID == "" {
+			writeError(w, http.StatusBadRequest, codeMissingParameter, "missing account_id parameter")
 			return
 		}
-		emailData, err := readEmailBytes(cfg, full)
+		limit := queryInt(r, "limit", maxBulkDelete)
+		if limit < 1 || limit > maxBulkDelete {
+			limit = maxBulkDelete
+		}
+
+		acct, err := cfg.Accounts.Get(userID, accountID)
 		if err != nil {
-			if errors.Is(err, storage.ErrNotFound) {
-				writeError(w, http.StatusNotFound, "attachment not found")
-				return
-			}
-			writeError(w, http.StatusInternalServerError, "failed to read email")
+			writeError(w, http.StatusNotFound, codeNotFound, "account not found")
 			return
 		}
-		idx := queryInt(r, "index", -1)
-		if idx < 0 {
-			writeError(w, http.StatusBadRequest, "missing or invalid index parameter")
+		if acct.ReadOnly() {
+			writeError(w, http.StatusForbidden, codeForbidden, account.ErrReadOnly.Error()+": its mail is read from "+acct.EmailDirOverride)
 			return
 		}
-		data, contentType, filename, err := eml.ExtractAttachmentFromBytes(emailData, idx)
+		idx, err := openAccountIndex(r.Context(), cfg, userID, *acct)
 		if err != nil {
-			writeError(w, http.StatusNotFound, "attachment not found")
+			writeIndexError(w, err)
 			return
 		}
-		if filename == "" {
-			filename = "attachment"
+		defer idx.Close()
+
+		// flagged:, starred: and vfolder: must select what /api/search shows.
+		ctx := index.WithMarks(r.Context(), marksOf(userAnnotations(cfg, userID)))
+		token := bulkDeleteToken(userID, acct.ID, q, fields)
+		if r.URL.Query().Get("confirm") != token {
+			writeJSON(w, http.StatusConflict, map[string]any{
+				"error":   errorDetail{Code: codeConfirmRequired, Message: "confirm token required"},
+				"matched": idx.SearchContext(ctx, q, 0, 0, fields...).Total,
+				"confirm": token,
+			})
+			return
 		}
-		// Escape quotes in filename to avoid breaking header
-		safeName := strings.ReplaceAll(filename, `"`, `_`)
-		w.Header().Set("Content-Disposition", `attachment; filename="`+safeName+`"`)
-		if contentType != "" {
-			w.Header().Set("Content-Type", contentType)
+
+		res, err := idx.DeleteMatching(ctx, q, fields, limit)
+		log.Printf("INFO: bulk delete %s %q: %d of %d matches, %d files", acct.Email, q, res.Deleted, res.Matched, res.Files)
+		out := map[string]any{
+			"account_id":     acct.ID,
+			"matched":        res.Matched,
+			"deleted":        res.Deleted,
+			"files":          res.Files,
+			"remaining":      res.Remaining,
+			"vector_deleted": false,
+		}
+		status := http.StatusOK
+		if err != nil {
+			log.Printf("WARN: bulk delete %s: %v", acct.Email, err)
+			out["error"] = err.Error()
+			status = http.StatusInternalServerError
+		}
+		if cfg.QdrantURL != "" && cfg.OllamaURL != "" && len(res.Paths) > 0 {
+			if err := deleteVectors(r.Context(), cfg, vector.Scope{UserID: userID, AccountID: acct.ID}, res.Paths); err != nil {
+				log.Printf("WARN: bulk delete %s: vector delete: %v", acct.Email, err)
+				out["vector_error"] = err.Error()
+			} else {
+				out["vector_deleted"] = true
+			}
 		}
-		w.Write(data)
+		writeJSON(w, status, out)
 	}
 }
 
-// handleCIDResource serves inline MIME parts by Content-ID. Protected by RequireAuth;
-// resolveEmailPath scopes access to the logged-in user's accounts only.
-func handleCIDResource(cfg Config) http.HandlerFunc {
+// deleteVectors removes the points of paths written in scope; points of
+// other users and accounts are left alone.
+func deleteVectors(ctx context.Context, cfg Config, scope vector.Scope, paths []string) error {
+	store, err := vector.NewStore(cfg.QdrantURL, cfg.OllamaURL, cfg.EmbedModel)
+	if err != nil {
+		return err
+	}
+	defer store.Close()
+	return store.In(scope).DeleteEmails(ctx, paths)
+}
+
+// handleVectorDiagnose embeds two sample texts with the configured model and
+// returns their cosine similarity, to tell a poor model from poor data when
+// similarity results look wrong. Only Ollama is needed, not Qdrant.
+func handleVectorDiagnose(cfg Config) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
-		full, ok := resolveEmailPath(cfg, r)
-		if !ok {
-			writeError(w, http.StatusBadRequest, "missing or invalid path")
+		if cfg.OllamaURL == "" {
+			writeError(w, http.StatusServiceUnavailable, codeNotConfigured, "embeddings not configured (set OLLAMA_URL)")
 			return
 		}
-		cid := strings.TrimSpace(r.URL.Query().Get("cid"))
-		if cid == "" {
-			writeError(w, http.StatusBadRequest, "missing cid parameter")
+		var req struct {
+			A string `json:"a"`
+			B string `json:"b"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			writeError(w, http.StatusBadRequest, codeInvalidBody, "invalid request body")
 			return
 		}
-		data, contentType, err := eml.ExtractPartByCID(full, cid)
-		if err != nil {
-			writeError(w, http.StatusNotFound, "resource not found")
+		if strings.TrimSpace(req.A) == "" || strings.TrimSpace(req.B) == "" {
+			writeError(w, http.StatusBadRequest, codeBadRequest, "a and b must both be non-empty")
 			return
 		}
-		if contentType != "" {
-			w.Header().Set("Content-Type", contentType)
+
+		embedder := vector.NewOllamaEmbedder(cfg.OllamaURL, cfg.EmbedModel)
+		embedder.SetLimits(vector.LimitsFromEnv())
+		res, err := vector.Compare(r.Context(), embedder, cfg.EmbedModel, req.A, req.B)
+		if err != nil {
+			writeError(w, http.StatusBadGateway, codeUpstream, err.Error())
+			return
 		}
-		w.Header().Set("Cache-Control", "private, max-age=3600")
-		w.Write(data)
+		writeJSON(w, http.StatusOK, res)
 	}
 }
 
-func handleSearchStats(cfg Config) http.HandlerFunc {
+// accountCompactResult is one entry in the /api/index/compact response.
+type accountCompactResult struct {
+	AccountID string `json:"account_id"`
+	Email     string `json:"email"`
+	index.CompactResult
+	Error string `json:"error,omitempty"`
+}
+
+// handleCompactIndex rebuilds and re-saves the parquet index of every account
+// (or only ?account_id=) and reports before/after row counts and file sizes.
+func handleCompactIndex(cfg Config) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		userID := auth.UserIDFromContext(r.Context())
-		accts, _ := cfg.Accounts.List(userID)
+		accountFilter := r.URL.Query().Get("account_id")
+		accts, err := cfg.Accounts.List(userID)
+		if err != nil {
+			writeError(w, http.StatusInternalServerError, codeInternal, err.Error())
+			return
+		}
 
-		out := map[string]any{
-			"total_emails":         0,
-			"accounts":             len(accts),
-			"similarity_available": cfg.QdrantURL != "" && cfg.OllamaURL != "",
+		results := make([]accountCompactResult, 0, len(accts))
+		for _, acct := range accts {
+			if accountFilter != "" && acct.ID != accountFilter {
+				continue
+			}
+			out := accountCompactResult{AccountID: acct.ID, Email: acct.Email}
+			emailDir := account.EmailDir(cfg.UsersDir, userID, acct)
+			indexPath := account.IndexPath(cfg.UsersDir, userID, acct)
+			idx, err := index.New(emailDir, indexPath, cfg.BlobStore, cfg.UsersDir)
+			if err != nil {
+				out.Error = err.Error()
+				results = append(results, out)
+				continue
+			}
+			idx.SetExcludeFolders(acct.ExcludeFolders)
+			out.CompactResult, err = idx.Compact()
+			idx.Close()
+			if err != nil {
+				out.Error = err.Error()
+			}
+			log.Printf("INFO: compacted %s: %d -> %d rows, %d -> %d bytes",
+				acct.Email, out.RowsBefore, out.RowsAfter, out.BytesBefore, out.BytesAfter)
+			results = append(results, out)
 		}
-		writeJSON(w, http.StatusOK, out)
+		if accountFilter != "" && len(results) == 0 {
+			writeError(w, http.StatusNotFound, codeNotFound, "account not found")
+			return
+		}
+
+		writeJSON(w, http.StatusOK, map[string]any{"accounts": results})
 	}
 }
 
-func handleReindex(cfg Config) http.HandlerFunc {
+// accountParseErrors is one entry in the /api/index/errors response.
+type accountParseErrors struct {
+	AccountID string `json:"account_id"`
+	Email     string `json:"email"`
+	index.ParseErrorReport
+	Error string `json:"error,omitempty"`
+}
+
+// handleIndexErrors lists the files the last index build of every account
+// (or only ?account_id=) skipped because they could not be read or parsed.
+func handleIndexErrors(cfg Config) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		userID := auth.UserIDFromContext(r.Context())
+		accountFilter := r.URL.Query().Get("account_id")
 		accts, err := cfg.Accounts.List(userID)
 		if err != nil {
-			writeError(w, http.StatusInternalServerError, err.Error())
+			writeError(w, http.StatusInternalServerError, codeInternal, err.Error())
 			return
 		}
 
-		go func() {
-			for _, acct := range accts {
-				emailDir := account.EmailDir(cfg.UsersDir, userID, acct)
-				indexPath := account.IndexPath(cfg.UsersDir, userID, acct)
-				idx, err := index.New(emailDir, indexPath, cfg.BlobStore, cfg.UsersDir)
-				if err != nil {
-					log.Printf("WARN: reindex %s: %v", acct.Email, err)
-					continue
-				}
-				idx.Build()
-				idx.Close()
-				log.Printf("INFO: reindexed %s", acct.Email)
+		results := make([]accountParseErrors, 0, len(accts))
+		for _, acct := range accts {
+			if accountFilter != "" && acct.ID != accountFilter {
+				continue
 			}
-		}()
+			out := accountParseErrors{AccountID: acct.ID, Email: acct.Email}
+			out.ParseErrorReport, err = index.LoadParseErrors(account.IndexPath(cfg.UsersDir, userID, acct))
+			if err != nil {
+				out.Error = err.Error()
+			}
+			if out.Errors == nil {
+				out.Errors = []index.ParseError{}
+			}
+			results = append(results, out)
+		}
+		if accountFilter != "" && len(results) == 0 {
+			writeError(w, http.StatusNotFound, codeNotFound, "account not found")
+			return
+		}
 
-		writeJSON(w, http.StatusAccepted, map[string]string{"status": "started"})
+		writeJSON(w, http.StatusOK, map[string]any{"accounts": results})
 	}
 }
 
@@ -695,6 +2305,30 @@ func handleHealth() http.HandlerFunc {
 
 // --- Helpers ---
 
+// searchLimit returns the page size for a search request: the limit
+// parameter, or cfg.DefaultSearchLimit when absent or below 1, capped at
+// cfg.MaxSearchLimit. A capped request gets an X-Limit-Clamped header with
+// the limit it asked for; the response's limit field holds the one applied.
+func searchLimit(cfg Config, w http.ResponseWriter, r *http.Request) int {
+	def, max := cfg.DefaultSearchLimit, cfg.MaxSearchLimit
+	if max < 1 {
+		max = 500
+	}
+	if def < 1 {
+		def = 50
+	}
+	def = min(def, max)
+	limit := queryInt(r, "limit", def)
+	if limit < 1 {
+		return def
+	}
+	if limit > max {
+		w.Header().Set("X-Limit-Clamped", strconv.Itoa(limit))
+		return max
+	}
+	return limit
+}
+
 func queryInt(r *http.Request, key string, fallback int) int {
 	s := r.URL.Query().Get(key)
 	if s == "" {
@@ -713,18 +2347,39 @@ func generateState() string {
 	return hex.EncodeToString(b)
 }
 
-// --- PST/OST Import ---
+// --- PST/OST and Maildir Import ---
 
-// importJob tracks a running PST/OST import.
+// importJob tracks a running PST/OST or Maildir import.
 type importJob struct {
 	ID        string `json:"id"`
 	UserID    string `json:"-"` // owner; not exposed in JSON responses
 	AccountID string `json:"account_id"`
 	Filename  string `json:"filename"`
-	Phase     string `json:"phase"`   // "uploading", "extracting", "indexing", "done", "error"
+	Phase     string `json:"phase"`   // "uploading", "unpacking", "extracting", "importing", "indexing", "embedding", "fixing-dates", "done", "error"
 	Current   int    `json:"current"` // bytes uploaded or messages extracted
 	Total     int    `json:"total"`   // total bytes or total messages
 	Error     string `json:"error,omitempty"`
+
+	// FixDates is set for fix-dates jobs and PST imports once they
+	// finish; PST imports run the same pass before indexing.
+	FixDates *eml.FixDatesResult `json:"fix_dates,omitempty"`
+
+	// Accounts is set for reindex jobs, one entry per account rebuilt or
+	// failing to open; Current and Total count them.
+	Accounts []accountProgress `json:"accounts,omitempty"`
+}
+
+// accountProgress is one account's part in a multi-account job.
+type accountProgress struct {
+	AccountID string `json:"account_id"`
+	Status    string `json:"status"`           // "pending", "indexing", "embedding", "done" or "error"
+	Emails    int    `json:"emails,omitempty"` // indexed, once done
+	Error     string `json:"error,omitempty"`
+
+	// Vectors counts the emails the similarity index holds for the
+	// account, as reindexVectors goes; VectorError is why it failed.
+	Vectors     int    `json:"vectors,omitempty"`
+	VectorError string `json:"vector_error,omitempty"`
 }
 
 var importJobRetention = 10 * time.Minute
@@ -732,12 +2387,36 @@ var importJobRetention = 10 * time.Minute
 var (
 	importJobsMu  gosync.Mutex
 	importJobsMap = make(map[string]*importJob)
+	// importJobsChanged is closed, and replaced, whenever a job is added,
+	// updated or removed, waking the event streams to look again.
+	importJobsChanged = make(chan struct{})
 )
 
+// importJobDone reports whether phase is one a job ends in.
+func importJobDone(phase string) bool {
+	return phase == "done" || phase == "error"
+}
+
+// notifyImportJobs wakes the event streams. importJobsMu must be held.
+func notifyImportJobs() {
+	close(importJobsChanged)
+	importJobsChanged = make(chan struct{})
+}
+
 func setImportJob(jobID string, job *importJob) {
 	importJobsMu.Lock()
 	defer importJobsMu.Unlock()
 	importJobsMap[jobID] = job
+	notifyImportJobs()
+}
+
+// updateImportJob applies fn to job under importJobsMu; progress is written
+// through it so event streams see each change.
+func updateImportJob(job *importJob, fn func(j *importJob)) {
+	importJobsMu.Lock()
+	defer importJobsMu.Unlock()
+	fn(job)
+	notifyImportJobs()
 }
 
 func getImportJob(jobID string) (*importJob, bool) {
@@ -751,27 +2430,77 @@ func deleteImportJob(jobID string) {
 	importJobsMu.Lock()
 	defer importJobsMu.Unlock()
 	delete(importJobsMap, jobID)
+	notifyImportJobs()
 }
 
 // scheduleImportJobCleanup removes a finished job from importJobsMap after
 // importJobRetention so completed/failed jobs don't accumulate forever.
 func scheduleImportJobCleanup(jobID string) {
-	time.AfterFunc(importJobRetention, func() {
-		importJobsMu.Lock()
-		delete(importJobsMap, jobID)
-		importJobsMu.Unlock()
-	})
+	time.AfterFunc(importJobRetention, func() { deleteImportJob(jobID) })
 }
 
+// handleImportPST imports an Outlook PST or OST file.
 func handleImportPST(cfg Config) http.HandlerFunc {
+	return handleImportUpload(cfg, model.AccountTypePST, "imported.pst",
+		func(userID, accountID, path string, onProgress func(string, int, int)) (sync.ImportResult, error) {
+			return cfg.Sync.ImportPST(userID, accountID, path, onProgress)
+		})
+}
+
+// handleImportMaildir imports a .zip, .tar or .tar.gz of a Maildir tree,
+// a Thunderbird profile's mail folder or an Apple Mail store.
+func handleImportMaildir(cfg Config) http.HandlerFunc {
+	return handleImportUpload(cfg, model.AccountTypeMaildir, "imported-maildir",
+		func(userID, accountID, path string, onProgress func(string, int, int)) (sync.ImportResult, error) {
+			dir, err := os.MkdirTemp("", "maildir-import-*")
+			if err != nil {
+				return sync.ImportResult{}, err
+			}
+			defer os.RemoveAll(dir)
+			// Unpack no more than the quota has room for, so that a zip
+			// bomb stops before it fills the temp disk.
+			var limits sync_maildir.Limits
+			if quota := cfg.Sync.Quota(); quota > 0 {
+				used, err := cfg.Sync.UserUsage(userID)
+				if err != nil {
+					return sync.ImportResult{}, err
+				}
+				limits.MaxBytes = max(min(quota-used, sync_maildir.DefaultMaxBytes), 1)
+			}
+			onProgress("unpacking", 0, 0)
+			srcDir, err := sync_maildir.Unpack(path, dir, limits)
+			if err != nil {
+				return sync.ImportResult{}, fmt.Errorf("unpack %s: %w", filepath.Base(path), err)
+			}
+			return cfg.Sync.ImportMaildir(userID, accountID, srcDir, onProgress)
+		})
+}
+
+// importRunner imports the uploaded file at path into a new account.
+type importRunner func(userID, accountID, path string, onProgress func(phase string, current, total int)) (sync.ImportResult, error)
+
+// handleImportUpload streams a multipart upload to a temp file, creates an
+// import-only account of acctType titled after it, and runs the import in
+// the background as an importJob.
+func handleImportUpload(cfg Config, acctType model.AccountType, defaultTitle string, run importRunner) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		userID := auth.UserIDFromContext(r.Context())
 
+		// Refuse before streaming a multi-gigabyte upload that cannot be kept.
+		if err := cfg.Sync.CheckQuota(userID); err != nil {
+			status, code := http.StatusInternalServerError, codeInternal
+			if errors.Is(err, sync.ErrQuotaExceeded) {
+				status, code = http.StatusInsufficientStorage, codeQuotaExceeded
+			}
+			writeError(w, status, code, err.Error())
+			return
+		}
+
 		// Use MultipartReader to stream the upload directly to a temp file
 		// without buffering the entire payload in memory or a temp file first.
 		mr, mrErr := r.MultipartReader()
 		if mrErr != nil {
-			writeError(w, http.StatusBadRequest, "invalid multipart form: "+mrErr.Error())
+			writeError(w, http.StatusBadRequest, codeInvalidBody, "invalid multipart form: "+mrErr.Error())
 			return
 		}
 
@@ -785,7 +2514,7 @@ func handleImportPST(cfg Config) http.HandlerFunc {
 				break
 			}
 			if partErr != nil {
-				writeError(w, http.StatusBadRequest, "multipart read error: "+partErr.Error())
+				writeError(w, http.StatusBadRequest, codeInvalidBody, "multipart read error: "+partErr.Error())
 				return
 			}
 			switch part.FormName() {
@@ -802,7 +2531,7 @@ func handleImportPST(cfg Config) http.HandlerFunc {
 		}
 
 		if filePart == nil {
-			writeError(w, http.StatusBadRequest, "file is required")
+			writeError(w, http.StatusBadRequest, codeMissingParameter, "file is required")
 			return
 		}
 
@@ -814,7 +2543,7 @@ func handleImportPST(cfg Config) http.HandlerFunc {
 		title = filepath.Base(title)
 		title = strings.ReplaceAll(title, "..", "")
 		if title == "" || title == "." {
-			title = "imported.pst"
+			title = defaultTitle
 		}
 
 		// Use Content-Length as an estimate for progress reporting.
@@ -830,33 +2559,26 @@ func handleImportPST(cfg Config) http.HandlerFunc {
 			Total:    int(fileSize),
 		}
 
-		importJobsMu.Lock()
-		importJobsMap[jobID] = job
-		importJobsMu.Unlock()
+		setImportJob(jobID, job)
 
 		onUploadProgress := func(phase string, current, total int) {
-			importJobsMu.Lock()
-			job.Phase = phase
-			job.Current = current
-			job.Total = total
-			importJobsMu.Unlock()
+			updateImportJob(job, func(j *importJob) {
+				j.Phase, j.Current, j.Total = phase, current, total
+			})
 		}
 
 		// Stream upload directly to temp file (single copy, no intermediate buffer).
 		tmpPath, uploadErr := sync_pst.StreamUpload(filePart, fileSize, onUploadProgress)
 		if uploadErr != nil {
-			importJobsMu.Lock()
-			job.Phase = "error"
-			job.Error = uploadErr.Error()
-			importJobsMu.Unlock()
+			updateImportJob(job, func(j *importJob) { j.Phase, j.Error = "error", uploadErr.Error() })
 			scheduleImportJobCleanup(jobID)
-			writeError(w, http.StatusInternalServerError, uploadErr.Error())
+			writeError(w, http.StatusInternalServerError, codeInternal, uploadErr.Error())
 			return
 		}
 
-		// Create PST account.
+		// Create the import-only account.
 		acct := model.EmailAccount{
-			Type:    model.AccountTypePST,
+			Type:    acctType,
 			Email:   title,
 			Folders: "all",
 			Sync:    model.SyncConfig{Interval: "0", Enabled: false},
@@ -864,11 +2586,13 @@ func handleImportPST(cfg Config) http.HandlerFunc {
 		created, err := cfg.Accounts.Create(userID, acct)
 		if err != nil {
 			os.Remove(tmpPath)
-			writeError(w, http.StatusInternalServerError, err.Error())
+			updateImportJob(job, func(j *importJob) { j.Phase, j.Error = "error", err.Error() })
+			scheduleImportJobCleanup(jobID)
+			writeError(w, http.StatusInternalServerError, codeInternal, err.Error())
 			return
 		}
 
-		job.AccountID = created.ID
+		updateImportJob(job, func(j *importJob) { j.AccountID = created.ID })
 
 		// Run import in background via sync service.
 		go func() {
@@ -876,30 +2600,31 @@ func handleImportPST(cfg Config) http.HandlerFunc {
 			defer scheduleImportJobCleanup(jobID)
 
 			onExtractProgress := func(phase string, current, total int) {
-				importJobsMu.Lock()
-				job.Phase = phase
-				job.Current = current
-				job.Total = total
-				importJobsMu.Unlock()
+				// Extractors report "done" when extraction ends, before
+				// dates are fixed and the index built; the job is done
+				// only once run returns.
+				if importJobDone(phase) {
+					return
+				}
+				updateImportJob(job, func(j *importJob) {
+					j.Phase, j.Current, j.Total = phase, current, total
+				})
 			}
 
-			extracted, errCount, importErr := cfg.Sync.ImportPST(userID, created.ID, tmpPath, onExtractProgress)
+			res, importErr := run(userID, created.ID, tmpPath, onExtractProgress)
 			if importErr != nil {
-				importJobsMu.Lock()
-				job.Phase = "error"
-				job.Error = importErr.Error()
-				importJobsMu.Unlock()
-				log.Printf("ERROR: PST import %s: %v", filename, importErr)
+				updateImportJob(job, func(j *importJob) { j.Phase, j.Error = "error", importErr.Error() })
+				log.Printf("ERROR: %s import %s: %v", acctType, filename, importErr)
 				return
 			}
 
-			log.Printf("INFO: PST import %s: %d extracted, %d errors", filename, extracted, errCount)
+			log.Printf("INFO: %s import %s: %d extracted, %d errors", acctType, filename, res.Imported, res.Errors)
 
-			importJobsMu.Lock()
-			job.Phase = "done"
-			job.Current = extracted
-			job.Total = extracted
-			importJobsMu.Unlock()
+			updateImportJob(job, func(j *importJob) {
+				j.Phase = "done"
+				j.Current, j.Total = res.Imported, res.Imported
+				j.FixDates = res.FixDates
+			})
 		}()
 
 		writeJSON(w, http.StatusAccepted, map[string]any{
@@ -910,24 +2635,93 @@ func handleImportPST(cfg Config) http.HandlerFunc {
 	}
 }
 
+// importJobSnapshot returns a copy of userID's job jobID, false if there
+// is none, and the channel closed on the next change to any job.
+func importJobSnapshot(userID, jobID string) (importJob, bool, <-chan struct{}) {
+	importJobsMu.Lock()
+	defer importJobsMu.Unlock()
+	job, ok := importJobsMap[jobID]
+	if !ok || job.UserID != userID {
+		return importJob{}, false, importJobsChanged
+	}
+	snapshot := *job
+	snapshot.Accounts = slices.Clone(job.Accounts)
+	return snapshot, true, importJobsChanged
+}
+
 func handleImportStatus() http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		userID := auth.UserIDFromContext(r.Context())
-		jobID := chi.URLParam(r, "id")
-
-		importJobsMu.Lock()
-		job, ok := importJobsMap[jobID]
-		var snapshot importJob
-		if ok {
-			snapshot = *job
+		snapshot, ok, _ := importJobSnapshot(userID, chi.URLParam(r, "id"))
+		if !ok {
+			writeError(w, http.StatusNotFound, codeNotFound, "import job not found")
+			return
 		}
-		importJobsMu.Unlock()
 
-		if !ok || snapshot.UserID != userID {
-			writeError(w, http.StatusNotFound, "import job not found")
+		writeJSON(w, http.StatusOK, snapshot)
+	}
+}
+
+// importEventsKeepAlive is how often an idle event stream sends a comment,
+// so proxies do not close it during a long extraction.
+var importEventsKeepAlive = 15 * time.Second
+
+// handleImportEvents streams a job as server-sent events: the job as
+// /api/import/status returns it, once on connect and again on each change,
+// until it is done or fails. Changes that land between two writes are sent
+// as one event.
+func handleImportEvents() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		userID := auth.UserIDFromContext(r.Context())
+		jobID := chi.URLParam(r, "id")
+		snapshot, ok, changed := importJobSnapshot(userID, jobID)
+		if !ok {
+			writeError(w, http.StatusNotFound, codeNotFound, "import job not found")
+			return
+		}
+		flusher, ok := w.(http.Flusher)
+		if !ok {
+			writeError(w, http.StatusInternalServerError, codeInternal, "streaming not supported")
 			return
 		}
 
-		writeJSON(w, http.StatusOK, snapshot)
+		w.Header().Set("Content-Type", "text/event-stream")
+		w.Header().Set("Cache-Control", "no-cache")
+		w.Header().Set("X-Accel-Buffering", "no") // nginx would buffer the stream
+		w.WriteHeader(http.StatusOK)
+
+		keepAlive := time.NewTicker(importEventsKeepAlive)
+		defer keepAlive.Stop()
+		var last string
+		for {
+			data, err := json.Marshal(snapshot)
+			if err != nil {
+				return
+			}
+			if string(data) != last {
+				if _, err := fmt.Fprintf(w, "data: %s\n\n", data); err != nil {
+					return
+				}
+				flusher.Flush()
+				last = string(data)
+			}
+			if importJobDone(snapshot.Phase) {
+				return
+			}
+
+			select {
+			case <-r.Context().Done():
+				return
+			case <-keepAlive.C:
+				if _, err := io.WriteString(w, ": keep-alive\n\n"); err != nil {
+					return
+				}
+				flusher.Flush()
+			case <-changed:
+			}
+			if snapshot, ok, changed = importJobSnapshot(userID, jobID); !ok {
+				return // purged
+			}
+		}
 	}
 }
@@ -0,0 +1,108 @@
+package web
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/eslider/mails/internal/account"
+	"github.com/eslider/mails/internal/auth"
+	"github.com/eslider/mails/internal/model"
+)
+
+// newAuthedTestRouter returns a router, a bearer token for a user, the user ID and the account store.
+func newAuthedTestRouter(t *testing.T) (http.Handler, string, string, *account.Store) {
+	t.Helper()
+	dir := t.TempDir()
+	sessions, err := auth.NewSessionStore(dir, nil)
+	if err != nil {
+		t.Fatalf("NewSessionStore: %v", err)
+	}
+	accounts := account.NewStore(dir, nil)
+	const userID = "user-1"
+	token, err := sessions.Create(userID)
+	if err != nil {
+		t.Fatalf("sessions.Create: %v", err)
+	}
+	handler := NewRouter(Config{Accounts: accounts, Sessions: sessions, UsersDir: dir})
+	return handler, token, userID, accounts
+}
+
+type bulkResponse struct {
+	Created int                 `json:"created"`
+	Total   int                 `json:"total"`
+	Results []bulkAccountResult `json:"results"`
+}
+
+func postBulk(t *testing.T, handler http.Handler, token, contentType, body string) bulkResponse {
+	t.Helper()
+	req := httptest.NewRequest(http.MethodPost, "/api/accounts/bulk", strings.NewReader(body))
+	req.Header.Set("Authorization", "Bearer "+token)
+	req.Header.Set("Content-Type", contentType)
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d, body = %s", rec.Code, rec.Body.String())
+	}
+	var out bulkResponse
+	if err := json.Unmarshal(rec.Body.Bytes(), &out); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	return out
+}
+
+func TestBulkCreateAccountsPartialFailure(t *testing.T) {
+	handler, token, userID, accounts := newAuthedTestRouter(t)
+	if _, err := accounts.Create(userID, model.EmailAccount{Type: model.AccountTypeIMAP, Email: "old@example.com", Host: "imap.example.com"}); err != nil {
+		t.Fatal(err)
+	}
+
+	body := `[
+		{"type": "IMAP", "email": "a@example.com", "host": "imap.example.com", "port": 993, "password": "secret"},
+		{"type": "IMAP", "email": "OLD@example.com", "host": "imap.example.com"},
+		{"type": "IMAP", "email": "no-host@example.com"},
+		{"type": "FAX", "email": "b@example.com", "host": "x"},
+		{"type": "POP3", "email": "a@example.com", "host": "imap.example.com"}
+	]`
+	out := postBulk(t, handler, token, "application/json", body)
+
+	want := []string{"created", "skipped", "error", "error", "skipped"}
+	if out.Total != 5 || out.Created != 1 || len(out.Results) != len(want) {
+		t.Fatalf("got %+v", out)
+	}
+	for i, status := range want {
+		if out.Results[i].Row != i+1 || out.Results[i].Status != status {
+			t.Errorf("row %d: got %+v, want status %s", i+1, out.Results[i], status)
+		}
+	}
+
+	list, _ := accounts.List(userID)
+	if len(list) != 2 {
+		t.Fatalf("accounts = %d, want 2", len(list))
+	}
+	if list[1].Password != "secret" {
+		t.Error("bulk import should store the row password")
+	}
+}
+
+func TestBulkCreateAccountsCSV(t *testing.T) {
+	handler, token, userID, accounts := newAuthedTestRouter(t)
+
+	body := "email,type,host,port,ssl,password\n" +
+		"c@example.com,imap,imap.example.com,993,true,pw\n" +
+		"d@example.com,pop3,,110,false,pw\n"
+	out := postBulk(t, handler, token, "text/csv", body)
+
+	if out.Created != 1 || out.Results[0].Status != "created" || out.Results[1].Status != "error" {
+		t.Fatalf("got %+v", out)
+	}
+	acct, err := accounts.Get(userID, out.Results[0].ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if acct.Type != model.AccountTypeIMAP || acct.Port != 993 || !acct.SSL {
+		t.Errorf("csv fields not applied: %+v", acct)
+	}
+}
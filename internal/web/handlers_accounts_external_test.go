@@ -0,0 +1,106 @@
+package web
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/eslider/mails/internal/account"
+	"github.com/eslider/mails/internal/auth"
+)
+
+func TestAccountWithEmailDirOverride(t *testing.T) {
+	dir := t.TempDir()
+	sessions, err := auth.NewSessionStore(dir, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	accounts := account.NewStore(dir, nil)
+	token, err := sessions.Create("user-1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	roots := t.TempDir()
+	archive := filepath.Join(roots, "user-1", "old-mail")
+	if err := os.MkdirAll(filepath.Join(archive, "inbox"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	msg := "From: a@b.com\r\nSubject: From the archive\r\nDate: Mon, 10 Feb 2020 09:00:00 +0000\r\n\r\nBody.\r\n"
+	if err := os.WriteFile(filepath.Join(archive, "inbox", "1.eml"), []byte(msg), 0444); err != nil {
+		t.Fatal(err)
+	}
+
+	handler := NewRouter(Config{Accounts: accounts, Sessions: sessions, UsersDir: dir, ExternalMailRoots: []string{roots}})
+	do := func(method, url, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, url, bytes.NewBufferString(body))
+		req.Header.Set("Authorization", "Bearer "+token)
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		return rec
+	}
+
+	if rec := do(http.MethodPost, "/api/accounts", `{"type":"MAILDIR","email":"old@example.com","email_dir_override":"`+t.TempDir()+`"}`); rec.Code != http.StatusBadRequest {
+		t.Errorf("override outside roots = %d %s, want 400", rec.Code, rec.Body)
+	}
+	// Other users' trees and archives are out of reach.
+	other := filepath.Join(roots, "user-2", "old-mail")
+	if err := os.MkdirAll(other, 0755); err != nil {
+		t.Fatal(err)
+	}
+	if rec := do(http.MethodPost, "/api/accounts", `{"type":"MAILDIR","email":"old@example.com","email_dir_override":"`+other+`"}`); rec.Code != http.StatusBadRequest {
+		t.Errorf("override in another user's root = %d %s, want 400", rec.Code, rec.Body)
+	}
+	victim := filepath.Join(dir, "user-2", "mail")
+	if err := os.MkdirAll(victim, 0755); err != nil {
+		t.Fatal(err)
+	}
+	exposed := NewRouter(Config{Accounts: accounts, Sessions: sessions, UsersDir: dir, ExternalMailRoots: []string{dir, filepath.Dir(dir)}})
+	req := httptest.NewRequest(http.MethodPost, "/api/accounts", bytes.NewBufferString(`{"type":"MAILDIR","email":"old@example.com","email_dir_override":"`+victim+`"}`))
+	req.Header.Set("Authorization", "Bearer "+token)
+	rec := httptest.NewRecorder()
+	exposed.ServeHTTP(rec, req)
+	if rec.Code != http.StatusBadRequest {
+		t.Errorf("override into another user's data dir = %d %s, want 400", rec.Code, rec.Body)
+	}
+
+	rec = do(http.MethodPost, "/api/accounts", `{"type":"MAILDIR","email":"old@example.com","email_dir_override":"`+archive+`"}`)
+	if rec.Code != http.StatusCreated {
+		t.Fatalf("create = %d %s", rec.Code, rec.Body)
+	}
+	var acct struct {
+		ID               string `json:"id"`
+		EmailDirOverride string `json:"email_dir_override"`
+	}
+	json.Unmarshal(rec.Body.Bytes(), &acct)
+	if acct.EmailDirOverride != archive {
+		t.Errorf("email_dir_override = %q, want %q", acct.EmailDirOverride, archive)
+	}
+
+	rec = do(http.MethodGet, "/api/search?account_id="+acct.ID+"&q=archive", "")
+	var out struct {
+		Hits []struct {
+			Subject string `json:"subject"`
+		} `json:"hits"`
+	}
+	json.Unmarshal(rec.Body.Bytes(), &out)
+	if len(out.Hits) != 1 || out.Hits[0].Subject != "From the archive" {
+		t.Fatalf("search = %s, want the archived email", rec.Body)
+	}
+	if _, err := os.Stat(filepath.Join(archive, "index.parquet")); !os.IsNotExist(err) {
+		t.Errorf("index written into the external tree: %v", err)
+	}
+
+	if rec := do(http.MethodPost, "/api/delete?account_id="+acct.ID+"&q=archive", ""); rec.Code != http.StatusForbidden {
+		t.Errorf("delete = %d %s, want 403", rec.Code, rec.Body)
+	}
+	if rec := do(http.MethodPost, "/api/accounts/"+acct.ID+"/fix-dates", ""); rec.Code != http.StatusForbidden {
+		t.Errorf("fix-dates = %d %s, want 403", rec.Code, rec.Body)
+	}
+	if _, err := os.Stat(filepath.Join(archive, "inbox", "1.eml")); err != nil {
+		t.Errorf("archived email: %v", err)
+	}
+}
@@ -0,0 +1,128 @@
+package web
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/eslider/mails/internal/account"
+	"github.com/eslider/mails/internal/auth"
+	"github.com/eslider/mails/internal/sync"
+	"github.com/eslider/mails/internal/user"
+)
+
+func TestAdminSyncsRequireAdmin(t *testing.T) {
+	dir := t.TempDir()
+	users, err := user.NewStore(dir, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sessions, err := auth.NewSessionStore(dir, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	token := func(email string) string {
+		t.Helper()
+		u, err := users.CreateWithPassword("", email, "x")
+		if err != nil {
+			t.Fatal(err)
+		}
+		tok, err := sessions.Create(u.ID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return tok
+	}
+	plain := token("user@example.com")
+	admin := token("ops@example.com")
+	if _, err := users.SetAdmin(users.FindByEmail("ops@example.com").ID, true); err != nil {
+		t.Fatal(err)
+	}
+	accounts := account.NewStore(dir, nil)
+	handler := NewRouter(Config{Users: users, Accounts: accounts, Sessions: sessions, Sync: sync.NewService(dir, accounts, nil), UsersDir: dir})
+	do := func(method, path, token string) *httptest.ResponseRecorder {
+		t.Helper()
+		req := httptest.NewRequest(method, path, nil)
+		req.Header.Set("Authorization", "Bearer "+token)
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		return rec
+	}
+
+	for _, tc := range []struct{ method, path string }{
+		{http.MethodGet, "/api/admin/syncs"},
+		{http.MethodPost, "/api/admin/syncs/acct-1/stop"},
+	} {
+		if rec := do(tc.method, tc.path, plain); rec.Code != http.StatusForbidden {
+			t.Errorf("%s %s as a user: status = %d, want 403", tc.method, tc.path, rec.Code)
+		}
+	}
+	if rec := do(http.MethodGet, "/api/admin/syncs", admin); rec.Code != http.StatusOK || strings.TrimSpace(rec.Body.String()) != "[]" {
+		t.Errorf("GET /api/admin/syncs as admin = %d %s, want 200 []", rec.Code, rec.Body)
+	}
+	if rec := do(http.MethodPost, "/api/admin/syncs/acct-1/stop", admin); rec.Code != http.StatusConflict {
+		t.Errorf("stopping an idle account = %d, want 409", rec.Code)
+	}
+}
+
+func TestAdminRoleFromAnotherProcess(t *testing.T) {
+	dir := t.TempDir()
+	users, err := user.NewStore(dir, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sessions, err := auth.NewSessionStore(dir, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	u, err := users.CreateWithPassword("", "ops@example.com", "x")
+	if err != nil {
+		t.Fatal(err)
+	}
+	token, err := sessions.Create(u.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	accounts := account.NewStore(dir, nil)
+	handler := NewRouter(Config{Users: users, Accounts: accounts, Sessions: sessions, Sync: sync.NewService(dir, accounts, nil), UsersDir: dir})
+	status := func() int {
+		t.Helper()
+		req := httptest.NewRequest(http.MethodGet, "/api/admin/syncs", nil)
+		req.Header.Set("Authorization", "Bearer "+token)
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		return rec.Code
+	}
+
+	// mails admin runs with its own store on the same files.
+	cli, err := user.NewStore(dir, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := cli.SetAdmin(u.ID, true); err != nil {
+		t.Fatal(err)
+	}
+	if code := status(); code != http.StatusOK {
+		t.Errorf("after a grant: status = %d, want 200", code)
+	}
+
+	// A server write must not drop the grant.
+	if _, err := users.SetDefaultAccount(u.ID, "acct-1"); err != nil {
+		t.Fatal(err)
+	}
+	reread, err := user.NewStore(dir, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := reread.Get(u.ID); got == nil || !got.Admin || got.DefaultAccountID != "acct-1" {
+		t.Errorf("stored user = %+v, want the admin role and the default account", got)
+	}
+
+	if _, err := cli.SetAdmin(u.ID, false); err != nil {
+		t.Fatal(err)
+	}
+	if code := status(); code != http.StatusForbidden {
+		t.Errorf("after a revoke: status = %d, want 403", code)
+	}
+}
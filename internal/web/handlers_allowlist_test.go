@@ -0,0 +1,111 @@
+package web
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/eslider/mails/internal/account"
+	"github.com/eslider/mails/internal/auth"
+	"github.com/eslider/mails/internal/model"
+	"github.com/eslider/mails/internal/user"
+)
+
+func TestTrustedSendersKeepRemoteImages(t *testing.T) {
+	dir := t.TempDir()
+	users, err := user.NewStore(dir, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	u, err := users.CreateWithPassword("Alice", "alice@example.com", "x")
+	if err != nil {
+		t.Fatal(err)
+	}
+	sessions, err := auth.NewSessionStore(dir, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	token, err := sessions.Create(u.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	accounts := account.NewStore(dir, nil)
+	acct, err := accounts.Create(u.ID, model.EmailAccount{Type: model.AccountTypeIMAP, Email: "me@example.com", Host: "imap.example.com"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	inbox := filepath.Join(account.EmailDir(dir, u.ID, *acct), "inbox")
+	if err := os.MkdirAll(inbox, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	msg := "From: Bank <alerts@mail.bank.example>\r\nSubject: Statement\r\nContent-Type: text/html\r\n\r\n" +
+		"<p style=\"background:url(https://cdn.bank.example/bg.png)\">Hi</p><img src=\"https://cdn.bank.example/logo.png\" alt=\"logo\">\r\n"
+	if err := os.WriteFile(filepath.Join(inbox, "m.eml"), []byte(msg), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	handler := NewRouter(Config{Accounts: accounts, Sessions: sessions, Users: users, UsersDir: dir})
+	do := func(method, path, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		req.Header.Set("Authorization", "Bearer "+token)
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		return rec
+	}
+	senders := func(rec *httptest.ResponseRecorder) []string {
+		t.Helper()
+		var out trustedSenders
+		if err := json.Unmarshal(rec.Body.Bytes(), &out); err != nil {
+			t.Fatalf("decode %q: %v", rec.Body.String(), err)
+		}
+		return out.TrustedSenders
+	}
+	render := func() (page, csp string) {
+		rec := do(http.MethodGet, "/api/email/print?path=inbox/m.eml", "")
+		if rec.Code != http.StatusOK {
+			t.Fatalf("print = %d %s", rec.Code, rec.Body)
+		}
+		return rec.Body.String(), rec.Header().Get("Content-Security-Policy")
+	}
+
+	if page, _ := render(); strings.Contains(page, "cdn.bank.example") {
+		t.Errorf("untrusted sender's remote images kept:\n%s", page)
+	}
+
+	for _, bad := range []string{`{"sender":""}`, `{"sender":"nodot"}`, `{"sender":"a b@bank.example"}`} {
+		if rec := do(http.MethodPost, "/api/allowlist", bad); rec.Code != http.StatusBadRequest {
+			t.Errorf("POST %s = %d, want 400", bad, rec.Code)
+		}
+	}
+	do(http.MethodPost, "/api/allowlist", `{"sender":"friend@other.example"}`)
+	rec := do(http.MethodPost, "/api/allowlist", `{"sender":"@Bank.Example"}`)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("POST = %d %s", rec.Code, rec.Body)
+	}
+	if got, want := senders(rec), []string{"bank.example", "friend@other.example"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("trusted senders = %v, want %v", got, want)
+	}
+	if got := senders(do(http.MethodGet, "/api/allowlist", "")); len(got) != 2 {
+		t.Errorf("GET = %v", got)
+	}
+
+	page, csp := render()
+	if !strings.Contains(page, `<img src="https://cdn.bank.example/logo.png" alt="logo">`) ||
+		!strings.Contains(page, "url(https://cdn.bank.example/bg.png)") {
+		t.Errorf("trusted sender's remote images removed:\n%s", page)
+	}
+	if !strings.Contains(csp, "img-src data: http: https:") {
+		t.Errorf("Content-Security-Policy = %q, want remote images allowed", csp)
+	}
+
+	if got := senders(do(http.MethodDelete, "/api/allowlist?sender=bank.example", "")); !reflect.DeepEqual(got, []string{"friend@other.example"}) {
+		t.Errorf("after DELETE = %v", got)
+	}
+	if page, csp := render(); strings.Contains(page, "cdn.bank.example") || strings.Contains(csp, "https:") {
+		t.Errorf("remote images kept after DELETE:\n%s\n%s", csp, page)
+	}
+}
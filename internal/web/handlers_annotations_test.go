@@ -0,0 +1,187 @@
+package web
+
+import (
+	"encoding/json"
+	"maps"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/eslider/mails/internal/account"
+	"github.com/eslider/mails/internal/auth"
+	"github.com/eslider/mails/internal/model"
+)
+
+func TestFlagEmailAndSearchFlagged(t *testing.T) {
+	dir := t.TempDir()
+	sessions, err := auth.NewSessionStore(dir, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	accounts := account.NewStore(dir, nil)
+	token, err := sessions.Create("user-1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	acct, err := accounts.Create("user-1", model.EmailAccount{Type: model.AccountTypeIMAP, Email: "me@example.com", Host: "imap.example.com"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	inbox := filepath.Join(account.EmailDir(dir, "user-1", *acct), "inbox")
+	if err := os.MkdirAll(inbox, 0755); err != nil {
+		t.Fatal(err)
+	}
+	for name, subject := range map[string]string{
+		"0123456789abcdef01234567-1.eml": "Keep this",
+		"fedcba9876543210fedcba98-2.eml": "Other",
+		"readpst-3.eml":                  "No checksum",
+	} {
+		msg := "From: a@b.com\r\nSubject: " + subject + "\r\nDate: Mon, 10 Feb 2020 09:00:00 +0000\r\n\r\nBody.\r\n"
+		if err := os.WriteFile(filepath.Join(inbox, name), []byte(msg), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	handler := NewRouter(Config{Accounts: accounts, Sessions: sessions, UsersDir: dir})
+	do := func(method, url string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, url, nil)
+		req.Header.Set("Authorization", "Bearer "+token)
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		return rec
+	}
+	search := func(q string) []map[string]any {
+		t.Helper()
+		rec := do(http.MethodGet, "/api/search?account_id="+acct.ID+"&q="+q)
+		var out struct {
+			Hits []map[string]any `json:"hits"`
+		}
+		if err := json.Unmarshal(rec.Body.Bytes(), &out); err != nil {
+			t.Fatalf("decode %q: %v", rec.Body.String(), err)
+		}
+		return out.Hits
+	}
+
+	if rec := do(http.MethodPost, "/api/email/flag?path=inbox/0123456789abcdef01234567-1.eml"); rec.Code != http.StatusOK || !json.Valid(rec.Body.Bytes()) {
+		t.Fatalf("flag = %d %s", rec.Code, rec.Body)
+	}
+	do(http.MethodPost, "/api/email/star?path=inbox/0123456789abcdef01234567-1.eml")
+	if rec := do(http.MethodPost, "/api/email/flag?path=inbox/readpst-3.eml"); rec.Code != http.StatusBadRequest {
+		t.Errorf("flag without checksum = %d, want 400", rec.Code)
+	}
+
+	hits := search("flagged:true")
+	if len(hits) != 1 || hits[0]["subject"] != "Keep this" || hits[0]["flagged"] != true || hits[0]["starred"] != true {
+		t.Fatalf("flagged:true = %v, want the flagged and starred email", hits)
+	}
+	if hits := search("flagged:false"); len(hits) != 2 {
+		t.Errorf("flagged:false = %d hits, want 2", len(hits))
+	}
+
+	rec := do(http.MethodGet, "/api/email?account_id="+acct.ID+"&path=inbox/0123456789abcdef01234567-1.eml")
+	var detail map[string]any
+	json.Unmarshal(rec.Body.Bytes(), &detail)
+	if detail["flagged"] != true {
+		t.Errorf("detail = %s, want flagged", rec.Body)
+	}
+
+	do(http.MethodPost, "/api/email/unflag?path=inbox/0123456789abcdef01234567-1.eml")
+	if hits := search("flagged:true"); len(hits) != 0 {
+		t.Errorf("after unflag flagged:true = %v", hits)
+	}
+	if hits := search("starred:true"); len(hits) != 1 {
+		t.Errorf("starred:true = %d hits, want the star kept", len(hits))
+	}
+}
+
+func TestMoveEmailsToVirtualFolder(t *testing.T) {
+	t.Cleanup(resetImportJobsForTest)
+	dir := t.TempDir()
+	sessions, err := auth.NewSessionStore(dir, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	accounts := account.NewStore(dir, nil)
+	token, err := sessions.Create("user-1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	acct, err := accounts.Create("user-1", model.EmailAccount{Type: model.AccountTypeIMAP, Email: "me@example.com", Host: "imap.example.com"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	emailDir := account.EmailDir(dir, "user-1", *acct)
+	for path, subject := range map[string]string{
+		"inbox/0123456789abcdef01234567-1.eml":    "Misfiled bill",
+		"inbox/fedcba9876543210fedcba98-2.eml":    "Newsletter",
+		"invoices/00112233445566778899aabb-3.eml": "Filed bill",
+	} {
+		full := filepath.Join(emailDir, path)
+		if err := os.MkdirAll(filepath.Dir(full), 0755); err != nil {
+			t.Fatal(err)
+		}
+		msg := "From: a@b.com\r\nSubject: " + subject + "\r\nDate: Mon, 10 Feb 2020 09:00:00 +0000\r\n\r\nBody.\r\n"
+		if err := os.WriteFile(full, []byte(msg), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	handler := NewRouter(Config{Accounts: accounts, Sessions: sessions, UsersDir: dir})
+	do := func(method, url, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, url, strings.NewReader(body))
+		req.Header.Set("Authorization", "Bearer "+token)
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		return rec
+	}
+	subjects := func(q string) map[string]string {
+		t.Helper()
+		rec := do(http.MethodGet, "/api/search?account_id="+acct.ID+"&q="+q, "")
+		var out struct {
+			Hits []map[string]any `json:"hits"`
+		}
+		if err := json.Unmarshal(rec.Body.Bytes(), &out); err != nil {
+			t.Fatalf("decode %q: %v", rec.Body.String(), err)
+		}
+		got := map[string]string{}
+		for _, h := range out.Hits {
+			vf, _ := h["vfolder"].(string)
+			got[h["subject"].(string)] = vf
+		}
+		return got
+	}
+
+	rec := do(http.MethodPost, "/api/email/move", `{"paths":["inbox/0123456789abcdef01234567-1.eml","inbox/readpst-4.eml"],"folder":" Invoices/ "}`)
+	var moved moveResult
+	if err := json.Unmarshal(rec.Body.Bytes(), &moved); err != nil || rec.Code != http.StatusOK {
+		t.Fatalf("move = %d %s", rec.Code, rec.Body)
+	}
+	if moved.Folder != "Invoices" || moved.Moved != 1 || len(moved.Skipped) != 1 {
+		t.Errorf("move = %+v, want one moved to Invoices and the file without checksum skipped", moved)
+	}
+	if rec := do(http.MethodPost, "/api/email/move", `{"folder":"x"}`); rec.Code != http.StatusBadRequest {
+		t.Errorf("move without paths = %d, want 400", rec.Code)
+	}
+
+	// Virtual membership joins the real invoices folder.
+	want := map[string]string{"Misfiled bill": "Invoices", "Filed bill": ""}
+	if got := subjects("vfolder:invoices"); !maps.Equal(got, want) {
+		t.Fatalf("vfolder:invoices = %v, want %v", got, want)
+	}
+
+	// A rebuilt index still finds it: the folder is kept beside it.
+	if err := os.Remove(account.IndexPath(dir, "user-1", *acct)); err != nil {
+		t.Fatal(err)
+	}
+	if got := subjects("vfolder:invoices"); !maps.Equal(got, want) {
+		t.Errorf("after reindex vfolder:invoices = %v, want %v", got, want)
+	}
+
+	do(http.MethodPost, "/api/email/move", `{"paths":["inbox/0123456789abcdef01234567-1.eml"],"folder":""}`)
+	if got := subjects("vfolder:invoices"); !maps.Equal(got, map[string]string{"Filed bill": ""}) {
+		t.Errorf("after moving back vfolder:invoices = %v", got)
+	}
+}
@@ -0,0 +1,199 @@
+package web
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/eslider/mails/internal/account"
+	"github.com/eslider/mails/internal/auth"
+	"github.com/eslider/mails/internal/model"
+)
+
+func postDelete(t *testing.T, handler http.Handler, token string, params url.Values) (int, map[string]any) {
+	t.Helper()
+	req := httptest.NewRequest(http.MethodPost, "/api/delete?"+params.Encode(), nil)
+	req.Header.Set("Authorization", "Bearer "+token)
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	var out map[string]any
+	if err := json.Unmarshal(rec.Body.Bytes(), &out); err != nil {
+		t.Fatalf("decode %q: %v", rec.Body.String(), err)
+	}
+	return rec.Code, out
+}
+
+func TestBulkDeleteRequiresConfirm(t *testing.T) {
+	dir := t.TempDir()
+	sessions, err := auth.NewSessionStore(dir, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	accounts := account.NewStore(dir, nil)
+	const userID = "user-1"
+	token, err := sessions.Create(userID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	handler := NewRouter(Config{Accounts: accounts, Sessions: sessions, UsersDir: dir})
+
+	acct, err := accounts.Create(userID, model.EmailAccount{Type: model.AccountTypeIMAP, Email: "me@example.com", Host: "imap.example.com"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	inbox := filepath.Join(account.EmailDir(dir, userID, *acct), "inbox")
+	if err := os.MkdirAll(inbox, 0755); err != nil {
+		t.Fatal(err)
+	}
+	for name, from := range map[string]string{"a.eml": "news@shop.com", "b.eml": "news@shop.com", "c.eml": "friend@home.org"} {
+		msg := "From: " + from + "\r\nSubject: Hello\r\nDate: Mon, 10 Feb 2020 09:00:00 +0000\r\n\r\nBody.\r\n"
+		if err := os.WriteFile(filepath.Join(inbox, name), []byte(msg), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	params := url.Values{"q": {"news@shop.com"}, "fields": {"from"}, "account_id": {acct.ID}}
+	code, out := postDelete(t, handler, token, params)
+	if code != http.StatusConflict || out["matched"] != float64(2) || out["confirm"] == "" {
+		t.Fatalf("without confirm: %d %v", code, out)
+	}
+	if e, _ := out["error"].(map[string]any); e["code"] != codeConfirmRequired {
+		t.Errorf("without confirm: error = %v, want code %q", out["error"], codeConfirmRequired)
+	}
+	if _, err := os.Stat(filepath.Join(inbox, "a.eml")); err != nil {
+		t.Fatal("nothing may be deleted without confirm")
+	}
+
+	// The token is bound to the query.
+	other := url.Values{"q": {"friend"}, "account_id": {acct.ID}, "confirm": {out["confirm"].(string)}}
+	if code, _ := postDelete(t, handler, token, other); code != http.StatusConflict {
+		t.Errorf("token reused for another query: status %d", code)
+	}
+
+	params.Set("confirm", out["confirm"].(string))
+	code, out = postDelete(t, handler, token, params)
+	if code != http.StatusOK || out["deleted"] != float64(2) || out["remaining"] != float64(0) {
+		t.Fatalf("confirmed: %d %v", code, out)
+	}
+	if _, err := os.Stat(filepath.Join(inbox, "a.eml")); !os.IsNotExist(err) {
+		t.Error("a.eml should be deleted")
+	}
+	if _, err := os.Stat(filepath.Join(inbox, "c.eml")); err != nil {
+		t.Error("c.eml should be kept")
+	}
+
+	if code, _ := postDelete(t, handler, token, url.Values{"q": {"x"}, "account_id": {"someone-else"}}); code != http.StatusNotFound {
+		t.Errorf("foreign account: status %d, want 404", code)
+	}
+	if code, _ := postDelete(t, handler, token, url.Values{"account_id": {acct.ID}}); code != http.StatusBadRequest {
+		t.Errorf("empty query: status %d, want 400", code)
+	}
+}
+
+func TestBulkDeleteKeepsFlaggedMail(t *testing.T) {
+	dir := t.TempDir()
+	sessions, err := auth.NewSessionStore(dir, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	accounts := account.NewStore(dir, nil)
+	const userID = "user-1"
+	token, err := sessions.Create(userID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	handler := NewRouter(Config{Accounts: accounts, Sessions: sessions, UsersDir: dir})
+
+	acct, err := accounts.Create(userID, model.EmailAccount{Type: model.AccountTypeIMAP, Email: "me@example.com", Host: "imap.example.com"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	inbox := filepath.Join(account.EmailDir(dir, userID, *acct), "inbox")
+	if err := os.MkdirAll(inbox, 0755); err != nil {
+		t.Fatal(err)
+	}
+	const flagged = "0123456789abcdef01234567-1.eml"
+	for _, name := range []string{flagged, "fedcba9876543210fedcba98-2.eml"} {
+		msg := "From: news@shop.com\r\nSubject: Sale\r\nDate: Mon, 10 Feb 2020 09:00:00 +0000\r\n\r\nBody.\r\n"
+		if err := os.WriteFile(filepath.Join(inbox, name), []byte(msg), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	req := httptest.NewRequest(http.MethodPost, "/api/email/flag?path=inbox/"+flagged, nil)
+	req.Header.Set("Authorization", "Bearer "+token)
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("flag = %d %s", rec.Code, rec.Body)
+	}
+
+	params := url.Values{"q": {"from:news@shop.com flagged:false"}, "account_id": {acct.ID}}
+	code, out := postDelete(t, handler, token, params)
+	if code != http.StatusConflict || out["matched"] != float64(1) {
+		t.Fatalf("preview: %d %v, want 1 match", code, out)
+	}
+	params.Set("confirm", out["confirm"].(string))
+	if code, out := postDelete(t, handler, token, params); code != http.StatusOK || out["deleted"] != float64(1) {
+		t.Fatalf("confirmed: %d %v", code, out)
+	}
+	if _, err := os.Stat(filepath.Join(inbox, flagged)); err != nil {
+		t.Error("the flagged email must survive flagged:false")
+	}
+}
+
+func TestBulkDeleteVirtualFolder(t *testing.T) {
+	t.Cleanup(resetImportJobsForTest)
+	dir := t.TempDir()
+	sessions, err := auth.NewSessionStore(dir, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	accounts := account.NewStore(dir, nil)
+	const userID = "user-1"
+	token, err := sessions.Create(userID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	handler := NewRouter(Config{Accounts: accounts, Sessions: sessions, UsersDir: dir})
+
+	acct, err := accounts.Create(userID, model.EmailAccount{Type: model.AccountTypeIMAP, Email: "me@example.com", Host: "imap.example.com"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	inbox := filepath.Join(account.EmailDir(dir, userID, *acct), "inbox")
+	if err := os.MkdirAll(inbox, 0755); err != nil {
+		t.Fatal(err)
+	}
+	const moved = "0123456789abcdef01234567-1.eml"
+	for _, name := range []string{moved, "fedcba9876543210fedcba98-2.eml"} {
+		msg := "From: a@b.com\r\nSubject: Bill\r\nDate: Mon, 10 Feb 2020 09:00:00 +0000\r\n\r\nBody.\r\n"
+		if err := os.WriteFile(filepath.Join(inbox, name), []byte(msg), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	req := httptest.NewRequest(http.MethodPost, "/api/email/move", strings.NewReader(`{"paths":["inbox/`+moved+`"],"folder":"Old bills"}`))
+	req.Header.Set("Authorization", "Bearer "+token)
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("move = %d %s", rec.Code, rec.Body)
+	}
+
+	params := url.Values{"q": {`vfolder:"old bills"`}, "account_id": {acct.ID}}
+	code, out := postDelete(t, handler, token, params)
+	if code != http.StatusConflict || out["matched"] != float64(1) {
+		t.Fatalf("preview: %d %v, want the moved email", code, out)
+	}
+	params.Set("confirm", out["confirm"].(string))
+	if code, out := postDelete(t, handler, token, params); code != http.StatusOK || out["deleted"] != float64(1) {
+		t.Fatalf("confirmed: %d %v", code, out)
+	}
+	if _, err := os.Stat(filepath.Join(inbox, moved)); !os.IsNotExist(err) {
+		t.Error("the email moved to the virtual folder should be deleted")
+	}
+}
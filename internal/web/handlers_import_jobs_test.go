@@ -1,8 +1,15 @@
 package web
 
 import (
+	"bufio"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
 	"testing"
 	"time"
+
+	"github.com/eslider/mails/internal/auth"
 )
 
 func TestDeleteImportJobRemovesEntryImmediately(t *testing.T) {
@@ -42,6 +49,78 @@ func TestScheduleImportJobCleanupRemovesEntryAfterRetention(t *testing.T) {
 	}
 }
 
+func TestImportEventsStreamsJobUntilDone(t *testing.T) {
+	t.Cleanup(resetImportJobsForTest)
+	dir := t.TempDir()
+	sessions, err := auth.NewSessionStore(dir, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	token, err := sessions.Create("user-1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv := httptest.NewServer(NewRouter(Config{Sessions: sessions, UsersDir: dir}))
+	defer srv.Close()
+	get := func(jobID string) *http.Response {
+		t.Helper()
+		req, _ := http.NewRequest(http.MethodGet, srv.URL+"/api/import/"+jobID+"/events", nil)
+		req.Header.Set("Authorization", "Bearer "+token)
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return resp
+	}
+
+	setImportJob("theirs", &importJob{ID: "theirs", UserID: "user-2", Phase: "uploading"})
+	if resp := get("theirs"); resp.StatusCode != http.StatusNotFound {
+		t.Errorf("another user's job: status = %d, want 404", resp.StatusCode)
+	}
+
+	job := &importJob{ID: "job-1", UserID: "user-1", Phase: "uploading", Total: 100}
+	setImportJob(job.ID, job)
+	resp := get(job.ID)
+	defer resp.Body.Close()
+	if ct := resp.Header.Get("Content-Type"); ct != "text/event-stream" {
+		t.Fatalf("Content-Type = %q", ct)
+	}
+	lines := bufio.NewScanner(resp.Body)
+	next := func() importJob {
+		t.Helper()
+		for lines.Scan() {
+			data, ok := strings.CutPrefix(lines.Text(), "data: ")
+			if !ok {
+				continue
+			}
+			var j importJob
+			if err := json.Unmarshal([]byte(data), &j); err != nil {
+				t.Fatalf("decode %q: %v", data, err)
+			}
+			return j
+		}
+		t.Fatalf("stream ended: %v", lines.Err())
+		return importJob{}
+	}
+
+	if j := next(); j.Phase != "uploading" || j.Total != 100 {
+		t.Errorf("first event = %+v, want the job as it stands", j)
+	}
+	updateImportJob(job, func(j *importJob) { j.Phase, j.Current, j.Total = "extracting", 5, 10 })
+	if j := next(); j.Phase != "extracting" || j.Current != 5 {
+		t.Errorf("event after update = %+v", j)
+	}
+	updateImportJob(job, func(j *importJob) { j.Phase, j.Current = "done", 10 })
+	if j := next(); j.Phase != "done" || j.Current != 10 {
+		t.Errorf("last event = %+v", j)
+	}
+	for lines.Scan() {
+		if strings.HasPrefix(lines.Text(), "data: ") {
+			t.Errorf("event after done: %s", lines.Text())
+		}
+	}
+}
+
 func resetImportJobsForTest() {
 	importJobsMu.Lock()
 	defer importJobsMu.Unlock()
@@ -0,0 +1,99 @@
+package web
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/eslider/mails/internal/account"
+	"github.com/eslider/mails/internal/auth"
+	"github.com/eslider/mails/internal/model"
+	"github.com/eslider/mails/internal/user"
+)
+
+func TestDefaultAccountPreference(t *testing.T) {
+	dir := t.TempDir()
+	users, err := user.NewStore(dir, nil)
+	if err != nil {
+		t.Fatalf("user.NewStore: %v", err)
+	}
+	u, err := users.CreateWithPassword("Alice", "alice@example.com", "x")
+	if err != nil {
+		t.Fatal(err)
+	}
+	sessions, err := auth.NewSessionStore(dir, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	token, err := sessions.Create(u.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	accounts := account.NewStore(dir, nil)
+	first, err := accounts.Create(u.ID, model.EmailAccount{Type: model.AccountTypeIMAP, Email: "first@example.com", Host: "imap.example.com"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	second, err := accounts.Create(u.ID, model.EmailAccount{Type: model.AccountTypeIMAP, Email: "second@example.com", Host: "imap.example.com"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, a := range []*model.EmailAccount{first, second} {
+		inbox := filepath.Join(account.EmailDir(dir, u.ID, *a), "inbox")
+		if err := os.MkdirAll(inbox, 0o755); err != nil {
+			t.Fatal(err)
+		}
+		msg := "From: x@example.com\r\nSubject: In " + a.Email + "\r\n\r\nbody\r\n"
+		if err := os.WriteFile(filepath.Join(inbox, "m.eml"), []byte(msg), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	handler := NewRouter(Config{Accounts: accounts, Sessions: sessions, Users: users, UsersDir: dir})
+
+	do := func(method, path, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		req.Header.Set("Authorization", "Bearer "+token)
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		return rec
+	}
+	subject := func() string {
+		rec := do(http.MethodGet, "/api/email?path=inbox/m.eml", "")
+		if rec.Code != http.StatusOK {
+			t.Fatalf("GET /api/email: %d %s", rec.Code, rec.Body.String())
+		}
+		var fe struct {
+			Subject string `json:"subject"`
+		}
+		json.Unmarshal(rec.Body.Bytes(), &fe)
+		return fe.Subject
+	}
+
+	if got := subject(); got != "In first@example.com" {
+		t.Errorf("without default: subject = %q, want first account", got)
+	}
+
+	if rec := do(http.MethodPut, "/api/me/preferences", `{"default_account_id":"nope"}`); rec.Code != http.StatusBadRequest {
+		t.Errorf("unknown account: status = %d, want 400", rec.Code)
+	}
+	rec := do(http.MethodPut, "/api/me/preferences", `{"default_account_id":"`+second.ID+`"}`)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("PUT preferences: %d %s", rec.Code, rec.Body.String())
+	}
+	if got := subject(); got != "In second@example.com" {
+		t.Errorf("with default: subject = %q, want second account", got)
+	}
+
+	// The preference survives a reload from disk.
+	reloaded, err := user.NewStore(dir, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := reloaded.Get(u.ID).DefaultAccountID; got != second.ID {
+		t.Errorf("persisted default = %q, want %q", got, second.ID)
+	}
+}
@@ -0,0 +1,98 @@
+package web
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/eslider/mails/internal/account"
+	"github.com/eslider/mails/internal/auth"
+	"github.com/eslider/mails/internal/model"
+)
+
+func TestEmailPrint(t *testing.T) {
+	dir := t.TempDir()
+	sessions, err := auth.NewSessionStore(dir, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	accounts := account.NewStore(dir, nil)
+	token, err := sessions.Create("user-1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	acct, err := accounts.Create("user-1", model.EmailAccount{Type: model.AccountTypeIMAP, Email: "me@example.com", Host: "imap.example.com"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	inbox := filepath.Join(account.EmailDir(dir, "user-1", *acct), "inbox")
+	if err := os.MkdirAll(inbox, 0755); err != nil {
+		t.Fatal(err)
+	}
+	msg := "From: Alice <alice@example.com>\r\n" +
+		"To: bob@example.com\r\n" +
+		"Subject: Q3 <report>\r\n" +
+		"Date: Mon, 10 Feb 2020 09:00:00 +0000\r\n" +
+		"MIME-Version: 1.0\r\n" +
+		"Content-Type: multipart/related; boundary=\"b1\"\r\n\r\n" +
+		"--b1\r\n" +
+		"Content-Type: text/html; charset=utf-8\r\n\r\n" +
+		"<html><head><title>x</title><script>alert(1)</script></head><body onload=\"steal()\">" +
+		"<p style=\"background:url(https://tracker.example/bg.png)\">Hello</p>" +
+		"<img src=\"cid:logo@x\" alt=\"logo\"><img src=\"https://tracker.example/pixel.gif\" alt=\"pixel\">" +
+		"<a href=\"javascript:steal()\">link</a></body></html>\r\n" +
+		"--b1\r\n" +
+		"Content-Type: image/png\r\n" +
+		"Content-ID: <logo@x>\r\n" +
+		"Content-Transfer-Encoding: base64\r\n\r\n" +
+		"iVBORw0KGgo=\r\n" +
+		"--b1--\r\n"
+	if err := os.WriteFile(filepath.Join(inbox, "m.eml"), []byte(msg), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	handler := NewRouter(Config{Accounts: accounts, Sessions: sessions, UsersDir: dir})
+	req := httptest.NewRequest(http.MethodGet, "/api/email/print?account_id="+acct.ID+"&path=inbox/m.eml", nil)
+	req.Header.Set("Authorization", "Bearer "+token)
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("print = %d %s", rec.Code, rec.Body)
+	}
+	if ct := rec.Header().Get("Content-Type"); !strings.HasPrefix(ct, "text/html") {
+		t.Errorf("Content-Type = %q", ct)
+	}
+	if csp := rec.Header().Get("Content-Security-Policy"); !strings.Contains(csp, "default-src 'none'") {
+		t.Errorf("Content-Security-Policy = %q", csp)
+	}
+	page := rec.Body.String()
+	for _, want := range []string{
+		"<h1>Q3 &lt;report&gt;</h1>",
+		"<tr><th>From</th><td>Alice &lt;alice@example.com&gt;</td></tr>",
+		"<tr><th>To</th><td>bob@example.com</td></tr>",
+		"<tr><th>Date</th><td>Mon, 10 Feb 2020 09:00:00 &#43;0000</td></tr>",
+		`<img src="data:image/png;base64,iVBORw0KGgo=" alt="logo">`,
+		`<img alt="pixel">`,
+		"Hello</p>",
+	} {
+		if !strings.Contains(page, want) {
+			t.Errorf("page lacks %q:\n%s", want, page)
+		}
+	}
+	for _, bad := range []string{"tracker.example", "<script", "alert(1)", "onload", "javascript:"} {
+		if strings.Contains(page, bad) {
+			t.Errorf("page holds %q:\n%s", bad, page)
+		}
+	}
+
+	req = httptest.NewRequest(http.MethodGet, "/api/email/print?account_id="+acct.ID+"&path=inbox/missing.eml", nil)
+	req.Header.Set("Authorization", "Bearer "+token)
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	if rec.Code != http.StatusNotFound {
+		t.Errorf("missing email = %d, want 404", rec.Code)
+	}
+}
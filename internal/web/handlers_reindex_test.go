@@ -0,0 +1,153 @@
+package web
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/eslider/mails/internal/account"
+	"github.com/eslider/mails/internal/auth"
+	"github.com/eslider/mails/internal/model"
+)
+
+func TestReindexBuildsAccountsConcurrently(t *testing.T) {
+	t.Cleanup(resetImportJobsForTest)
+	dir := t.TempDir()
+	sessions, err := auth.NewSessionStore(dir, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	accounts := account.NewStore(dir, nil)
+	token, err := sessions.Create("user-1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Four accounts holding 1 to 4 emails, built two at a time.
+	want := map[string]int{}
+	for n := 1; n <= 4; n++ {
+		acct, err := accounts.Create("user-1", model.EmailAccount{Type: model.AccountTypeIMAP, Email: fmt.Sprintf("me%d@example.com", n), Host: "imap.example.com"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		inbox := filepath.Join(account.EmailDir(dir, "user-1", *acct), "inbox")
+		if err := os.MkdirAll(inbox, 0755); err != nil {
+			t.Fatal(err)
+		}
+		for i := range n {
+			msg := fmt.Sprintf("From: a@b.com\r\nSubject: Mail %d\r\n\r\nBody.\r\n", i)
+			if err := os.WriteFile(filepath.Join(inbox, fmt.Sprintf("%d.eml", i)), []byte(msg), 0644); err != nil {
+				t.Fatal(err)
+			}
+		}
+		want[acct.ID] = n
+	}
+	handler := NewRouter(Config{Accounts: accounts, Sessions: sessions, UsersDir: dir, ReindexWorkers: 2})
+	do := func(method, path string, out any) int {
+		t.Helper()
+		req := httptest.NewRequest(method, path, nil)
+		req.Header.Set("Authorization", "Bearer "+token)
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		if err := json.Unmarshal(rec.Body.Bytes(), out); err != nil {
+			t.Fatalf("%s %s: decode %q: %v", method, path, rec.Body.String(), err)
+		}
+		return rec.Code
+	}
+
+	var started map[string]string
+	if code := do(http.MethodPost, "/api/reindex", &started); code != http.StatusAccepted || started["job_id"] == "" {
+		t.Fatalf("reindex = %d %v, want 202 with a job_id", code, started)
+	}
+	var job importJob
+	deadline := time.Now().Add(30 * time.Second)
+	for {
+		if code := do(http.MethodGet, "/api/import/status/"+started["job_id"], &job); code != http.StatusOK {
+			t.Fatalf("status = %d", code)
+		}
+		if job.Phase == "done" {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("reindex still running: %+v", job)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	if job.Current != 4 || job.Total != 4 || len(job.Accounts) != 4 {
+		t.Fatalf("job = %+v, want 4 of 4 accounts", job)
+	}
+	for _, a := range job.Accounts {
+		if a.Status != "done" || a.Emails != want[a.AccountID] {
+			t.Errorf("account %s = %+v, want done with %d emails", a.AccountID, a, want[a.AccountID])
+		}
+	}
+
+	var again map[string]string
+	if code := do(http.MethodPost, "/api/reindex", &again); code != http.StatusOK || again["status"] != "unchanged" {
+		t.Errorf("second reindex = %d %v, want unchanged", code, again)
+	}
+}
+
+func TestReindexRecordsVectorFailure(t *testing.T) {
+	t.Cleanup(resetImportJobsForTest)
+	dir := t.TempDir()
+	sessions, err := auth.NewSessionStore(dir, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	accounts := account.NewStore(dir, nil)
+	token, err := sessions.Create("user-1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	acct, err := accounts.Create("user-1", model.EmailAccount{Type: model.AccountTypeIMAP, Email: "me@example.com", Host: "imap.example.com"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	inbox := filepath.Join(account.EmailDir(dir, "user-1", *acct), "inbox")
+	if err := os.MkdirAll(inbox, 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(inbox, "1.eml"), []byte("From: a@b.com\r\nSubject: Hi\r\n\r\nBody.\r\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	// Nothing listens on port 1, so the similarity index cannot be reached.
+	handler := NewRouter(Config{Accounts: accounts, Sessions: sessions, UsersDir: dir,
+		ReindexVectors: true, QdrantURL: "http://127.0.0.1:1", OllamaURL: "http://127.0.0.1:1"})
+	do := func(method, path string, out any) int {
+		t.Helper()
+		req := httptest.NewRequest(method, path, nil)
+		req.Header.Set("Authorization", "Bearer "+token)
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		if err := json.Unmarshal(rec.Body.Bytes(), out); err != nil {
+			t.Fatalf("%s %s: decode %q: %v", method, path, rec.Body.String(), err)
+		}
+		return rec.Code
+	}
+
+	var started map[string]string
+	if code := do(http.MethodPost, "/api/reindex", &started); code != http.StatusAccepted {
+		t.Fatalf("reindex = %d %v, want 202", code, started)
+	}
+	var job importJob
+	deadline := time.Now().Add(30 * time.Second)
+	for job.Phase != "done" {
+		if time.Now().After(deadline) {
+			t.Fatalf("reindex still running: %+v", job)
+		}
+		time.Sleep(10 * time.Millisecond)
+		do(http.MethodGet, "/api/import/status/"+started["job_id"], &job)
+	}
+	if len(job.Accounts) != 1 {
+		t.Fatalf("job = %+v, want 1 account", job)
+	}
+	if a := job.Accounts[0]; a.Status != "done" || a.Emails != 1 || a.VectorError == "" {
+		t.Errorf("account = %+v, want keyword index done and a vector_error", a)
+	}
+}
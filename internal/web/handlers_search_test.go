@@ -0,0 +1,380 @@
+package web
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/eslider/mails/internal/account"
+	"github.com/eslider/mails/internal/auth"
+	"github.com/eslider/mails/internal/model"
+	"github.com/eslider/mails/internal/search/index"
+)
+
+func TestSearchLimit(t *testing.T) {
+	tests := []struct {
+		name        string
+		cfg         Config
+		query       string
+		want        int
+		wantClamped string
+	}{
+		{"built-in default", Config{}, "", 50, ""},
+		{"requested", Config{}, "limit=120", 120, ""},
+		{"built-in ceiling", Config{}, "limit=1000", 500, "1000"},
+		{"below one", Config{}, "limit=0", 50, ""},
+		{"configured default", Config{DefaultSearchLimit: 20}, "", 20, ""},
+		{"configured ceiling", Config{MaxSearchLimit: 2000}, "limit=1000", 1000, ""},
+		{"configured ceiling clamps", Config{MaxSearchLimit: 100}, "limit=250", 100, "250"},
+		{"default above ceiling", Config{DefaultSearchLimit: 200, MaxSearchLimit: 100}, "", 100, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			req := httptest.NewRequest("GET", "/api/search?"+tt.query, nil)
+			if got := searchLimit(tt.cfg, rec, req); got != tt.want {
+				t.Errorf("limit = %d, want %d", got, tt.want)
+			}
+			if got := rec.Header().Get("X-Limit-Clamped"); got != tt.wantClamped {
+				t.Errorf("X-Limit-Clamped = %q, want %q", got, tt.wantClamped)
+			}
+		})
+	}
+}
+
+func TestSearchReportsTook(t *testing.T) {
+	dir := t.TempDir()
+	sessions, err := auth.NewSessionStore(dir, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	accounts := account.NewStore(dir, nil)
+	token, err := sessions.Create("user-1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	acct, err := accounts.Create("user-1", model.EmailAccount{Type: model.AccountTypeIMAP, Email: "me@example.com", Host: "imap.example.com"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	inbox := filepath.Join(account.EmailDir(dir, "user-1", *acct), "inbox")
+	if err := os.MkdirAll(inbox, 0755); err != nil {
+		t.Fatal(err)
+	}
+	msg := "From: a@b.com\r\nSubject: Hello\r\nDate: Mon, 10 Feb 2020 09:00:00 +0000\r\n\r\nBody.\r\n"
+	if err := os.WriteFile(filepath.Join(inbox, "a.eml"), []byte(msg), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	handler := NewRouter(Config{Accounts: accounts, Sessions: sessions, UsersDir: dir})
+	req := httptest.NewRequest(http.MethodGet, "/api/search?q=hello&account_id="+acct.ID, nil)
+	req.Header.Set("Authorization", "Bearer "+token)
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	var out map[string]any
+	if err := json.Unmarshal(rec.Body.Bytes(), &out); err != nil {
+		t.Fatalf("decode %q: %v", rec.Body.String(), err)
+	}
+	if out["total"] != 1.0 {
+		t.Errorf("total = %v, want 1", out["total"])
+	}
+	if took, ok := out["took_ms"].(float64); !ok || took < 0 {
+		t.Errorf("took_ms = %v, want a duration in ms", out["took_ms"])
+	}
+}
+
+func TestSearchPagination(t *testing.T) {
+	dir := t.TempDir()
+	sessions, err := auth.NewSessionStore(dir, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	accounts := account.NewStore(dir, nil)
+	token, err := sessions.Create("user-1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	acct, err := accounts.Create("user-1", model.EmailAccount{Type: model.AccountTypeIMAP, Email: "me@example.com", Host: "imap.example.com"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	inbox := filepath.Join(account.EmailDir(dir, "user-1", *acct), "inbox")
+	if err := os.MkdirAll(inbox, 0755); err != nil {
+		t.Fatal(err)
+	}
+	for i := range 5 {
+		msg := fmt.Sprintf("From: a@b.com\r\nSubject: Report %d\r\nDate: Mon, %d Feb 2020 09:00:00 +0000\r\n\r\nBody.\r\n", i, 10+i)
+		if err := os.WriteFile(filepath.Join(inbox, fmt.Sprintf("%d.eml", i)), []byte(msg), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	handler := NewRouter(Config{Accounts: accounts, Sessions: sessions, UsersDir: dir})
+	search := func(query string) model.Pagination {
+		t.Helper()
+		req := httptest.NewRequest(http.MethodGet, "/api/search?"+query, nil)
+		req.Header.Set("Authorization", "Bearer "+token)
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		var out struct {
+			Pagination model.Pagination `json:"pagination"`
+		}
+		if err := json.Unmarshal(rec.Body.Bytes(), &out); err != nil {
+			t.Fatalf("decode %q: %v", rec.Body.String(), err)
+		}
+		return out.Pagination
+	}
+
+	p := search("q=report&limit=2&offset=2&account_id=" + acct.ID)
+	want := model.Pagination{Page: 2, TotalPages: 3, HasNext: true, HasPrev: true,
+		Next: "account_id=" + acct.ID + "&limit=2&offset=4&q=report",
+		Prev: "account_id=" + acct.ID + "&limit=2&offset=0&q=report"}
+	if p != want {
+		t.Errorf("middle page = %+v, want %+v", p, want)
+	}
+	// Following next reaches the last page.
+	if p = search(p.Next); p.Page != 3 || p.HasNext || p.Next != "" {
+		t.Errorf("last page = %+v", p)
+	}
+	if p = search("q=report&limit=2&offset=50"); p.HasNext || p.Prev != "limit=2&offset=4&q=report" {
+		t.Errorf("past the end = %+v, want prev to the last page", p)
+	}
+	if p = search("q=nothing-matches&limit=2"); p != (model.Pagination{Page: 1}) {
+		t.Errorf("no hits = %+v", p)
+	}
+	if p = search("q=report&limit=2&account_id=missing"); p != (model.Pagination{Page: 1}) {
+		t.Errorf("unknown account = %+v", p)
+	}
+}
+
+func TestSearchExplain(t *testing.T) {
+	dir := t.TempDir()
+	sessions, err := auth.NewSessionStore(dir, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	accounts := account.NewStore(dir, nil)
+	token, err := sessions.Create("user-1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	acct, err := accounts.Create("user-1", model.EmailAccount{Type: model.AccountTypeIMAP, Email: "me@example.com", Host: "imap.example.com"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	inbox := filepath.Join(account.EmailDir(dir, "user-1", *acct), "inbox")
+	if err := os.MkdirAll(inbox, 0755); err != nil {
+		t.Fatal(err)
+	}
+	msg := "From: a@b.com\r\nSubject: Quarterly report\r\nDate: Mon, 10 Feb 2020 09:00:00 +0000\r\n\r\nThe report is attached.\r\n"
+	if err := os.WriteFile(filepath.Join(inbox, "1.eml"), []byte(msg), 0644); err != nil {
+		t.Fatal(err)
+	}
+	handler := NewRouter(Config{Accounts: accounts, Sessions: sessions, UsersDir: dir})
+	search := func(query string) index.SearchResult {
+		t.Helper()
+		req := httptest.NewRequest(http.MethodGet, "/api/search?account_id="+acct.ID+"&"+query, nil)
+		req.Header.Set("Authorization", "Bearer "+token)
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		var out index.SearchResult
+		if err := json.Unmarshal(rec.Body.Bytes(), &out); err != nil {
+			t.Fatalf("decode %q: %v", rec.Body.String(), err)
+		}
+		return out
+	}
+
+	res := search("q=report+from:a@b&explain=1")
+	if len(res.Hits) != 1 || res.Hits[0].Explain == nil {
+		t.Fatalf("hits = %+v, want one explained hit", res.Hits)
+	}
+	want := []index.Match{{Field: "subject", Term: "report"}, {Field: "body", Term: "report"}, {Field: "from", Term: "a@b"}}
+	if got := res.Hits[0].Explain.Matches; !reflect.DeepEqual(got, want) {
+		t.Errorf("matches = %+v, want %+v", got, want)
+	}
+	if res = search("q=report&explain=1&group=thread"); len(res.Threads) != 1 || res.Threads[0].Latest.Explain == nil {
+		t.Errorf("threads = %+v, want the latest hit explained", res.Threads)
+	}
+	if res = search("q=report"); len(res.Hits) != 1 || res.Hits[0].Explain != nil {
+		t.Errorf("hits = %+v, want no explanation unless asked", res.Hits)
+	}
+}
+
+func TestSearchGroupThreadBounded(t *testing.T) {
+	defer func(n int) { maxThreadHits = n }(maxThreadHits)
+	maxThreadHits = 2
+	dir := t.TempDir()
+	sessions, err := auth.NewSessionStore(dir, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	accounts := account.NewStore(dir, nil)
+	token, err := sessions.Create("user-1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	acct, err := accounts.Create("user-1", model.EmailAccount{Type: model.AccountTypeIMAP, Email: "me@example.com", Host: "imap.example.com"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	inbox := filepath.Join(account.EmailDir(dir, "user-1", *acct), "inbox")
+	if err := os.MkdirAll(inbox, 0755); err != nil {
+		t.Fatal(err)
+	}
+	// Three reports, each a conversation of its own.
+	for i, date := range []string{"Mon, 10 Feb 2020", "Tue, 11 Feb 2020", "Wed, 12 Feb 2020"} {
+		msg := fmt.Sprintf("From: a@b.com\r\nSubject: Report %d\r\nMessage-ID: <r%d@b.com>\r\nDate: %s 09:00:00 +0000\r\n\r\nAttached.\r\n", i, i, date)
+		if err := os.WriteFile(filepath.Join(inbox, fmt.Sprintf("%d.eml", i)), []byte(msg), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	handler := NewRouter(Config{Accounts: accounts, Sessions: sessions, UsersDir: dir})
+	req := httptest.NewRequest(http.MethodGet, "/api/search?account_id="+acct.ID+"&q=report&group=thread", nil)
+	req.Header.Set("Authorization", "Bearer "+token)
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	var res index.SearchResult
+	if err := json.Unmarshal(rec.Body.Bytes(), &res); err != nil {
+		t.Fatalf("decode %q: %v", rec.Body.String(), err)
+	}
+	if res.Total != 2 || len(res.Threads) != 2 || res.Threads[0].Latest.Subject != "Report 2" || res.Threads[1].Latest.Subject != "Report 1" {
+		t.Errorf("threads = %d %+v, want the 2 newest conversations", res.Total, res.Threads)
+	}
+}
+
+func TestSearchPreview(t *testing.T) {
+	dir := t.TempDir()
+	sessions, err := auth.NewSessionStore(dir, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	accounts := account.NewStore(dir, nil)
+	token, err := sessions.Create("user-1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	acct, err := accounts.Create("user-1", model.EmailAccount{Type: model.AccountTypeIMAP, Email: "me@example.com", Host: "imap.example.com"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	inbox := filepath.Join(account.EmailDir(dir, "user-1", *acct), "inbox")
+	if err := os.MkdirAll(inbox, 0755); err != nil {
+		t.Fatal(err)
+	}
+	msg := "From: a@b.com\r\nSubject: Lunch\r\nDate: Mon, 10 Feb 2020 09:00:00 +0000\r\n\r\n\r\nAre you free\r\n  on Friday?\r\n"
+	if err := os.WriteFile(filepath.Join(inbox, "1.eml"), []byte(msg), 0644); err != nil {
+		t.Fatal(err)
+	}
+	handler := NewRouter(Config{Accounts: accounts, Sessions: sessions, UsersDir: dir})
+	search := func(query string) index.SearchResult {
+		t.Helper()
+		req := httptest.NewRequest(http.MethodGet, "/api/search?"+query, nil)
+		req.Header.Set("Authorization", "Bearer "+token)
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		var out index.SearchResult
+		if err := json.Unmarshal(rec.Body.Bytes(), &out); err != nil {
+			t.Fatalf("decode %q: %v", rec.Body.String(), err)
+		}
+		return out
+	}
+
+	// The single-account search builds the index the multi-account one reads.
+	for _, query := range []string{"account_id=" + acct.ID + "&q=&preview=1", "q=&preview=1"} {
+		if res := search(query); len(res.Hits) != 1 || res.Hits[0].Snippet != "Are you free on Friday?" {
+			t.Errorf("%s: hits = %+v, want the body as preview", query, res.Hits)
+		}
+	}
+	for _, query := range []string{"account_id=" + acct.ID + "&q=", "q="} {
+		if res := search(query); len(res.Hits) != 1 || res.Hits[0].Snippet != "" {
+			t.Errorf("%s: hits = %+v, want no preview unless asked", query, res.Hits)
+		}
+	}
+}
+
+func TestSearchColdBuildRunsInBackground(t *testing.T) {
+	dir := t.TempDir()
+	sessions, err := auth.NewSessionStore(dir, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	accounts := account.NewStore(dir, nil)
+	token, err := sessions.Create("user-1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	acct, err := accounts.Create("user-1", model.EmailAccount{Type: model.AccountTypeIMAP, Email: "me@example.com", Host: "imap.example.com"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	inbox := filepath.Join(account.EmailDir(dir, "user-1", *acct), "inbox")
+	if err := os.MkdirAll(inbox, 0755); err != nil {
+		t.Fatal(err)
+	}
+	msg := "From: a@b.com\r\nSubject: Hello\r\nDate: Mon, 10 Feb 2020 09:00:00 +0000\r\n\r\nBody.\r\n"
+	if err := os.WriteFile(filepath.Join(inbox, "a.eml"), []byte(msg), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	// A build that takes longer than the request may.
+	release := make(chan struct{})
+	var builds atomic.Int32
+	defer func(wait time.Duration, build func(*index.Index) (int, error)) {
+		coldBuildWait, buildColdIndex = wait, build
+	}(coldBuildWait, buildColdIndex)
+	coldBuildWait = 50 * time.Millisecond
+	buildColdIndex = func(idx *index.Index) (int, error) {
+		builds.Add(1)
+		<-release
+		return buildIndex(idx)
+	}
+
+	handler := NewRouter(Config{Accounts: accounts, Sessions: sessions, UsersDir: dir, RequestTimeout: time.Second})
+	search := func() *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, "/api/search?q=hello&account_id="+acct.ID, nil)
+		req.Header.Set("Authorization", "Bearer "+token)
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		return rec
+	}
+
+	for range 2 {
+		rec := search()
+		if rec.Code != http.StatusServiceUnavailable || rec.Header().Get("Retry-After") == "" {
+			t.Fatalf("status = %d, Retry-After %q; want 503 with Retry-After (%s)", rec.Code, rec.Header().Get("Retry-After"), rec.Body.String())
+		}
+		var out errorResponse
+		if err := json.Unmarshal(rec.Body.Bytes(), &out); err != nil || out.Error.Code != codeIndexBuilding {
+			t.Fatalf("body = %s, want code %s", rec.Body.String(), codeIndexBuilding)
+		}
+	}
+	if n := builds.Load(); n != 1 {
+		t.Errorf("%d builds started, want requests to share one", n)
+	}
+
+	close(release)
+	deadline := time.Now().Add(10 * time.Second)
+	for {
+		rec := search()
+		if rec.Code == http.StatusOK {
+			var out index.SearchResult
+			if err := json.Unmarshal(rec.Body.Bytes(), &out); err != nil {
+				t.Fatal(err)
+			}
+			if out.Total != 1 {
+				t.Errorf("total = %d after the build, want 1", out.Total)
+			}
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("search still answers %d after the build", rec.Code)
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+}
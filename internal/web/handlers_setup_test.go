@@ -0,0 +1,81 @@
+package web
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/eslider/mails/internal/account"
+	"github.com/eslider/mails/internal/auth"
+	"github.com/eslider/mails/internal/model"
+	"github.com/eslider/mails/internal/search/index"
+)
+
+func TestSetupStatusSteps(t *testing.T) {
+	dir := t.TempDir()
+	sessions, err := auth.NewSessionStore(dir, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	accounts := account.NewStore(dir, nil)
+	token, err := sessions.Create("user-1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	providers := auth.NewProviders("http://localhost", &auth.ProviderConfig{ClientID: "id", ClientSecret: "secret"}, &auth.ProviderConfig{ClientID: "id", ClientSecret: "secret"}, nil)
+	handler := NewRouter(Config{Accounts: accounts, Sessions: sessions, Auth: providers, UsersDir: dir})
+
+	status := func() setupStatus {
+		t.Helper()
+		req := httptest.NewRequest(http.MethodGet, "/api/setup-status", nil)
+		req.Header.Set("Authorization", "Bearer "+token)
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		if rec.Code != http.StatusOK {
+			t.Fatalf("status %d: %s", rec.Code, rec.Body.String())
+		}
+		var out setupStatus
+		if err := json.Unmarshal(rec.Body.Bytes(), &out); err != nil {
+			t.Fatal(err)
+		}
+		return out
+	}
+
+	got := status()
+	if got.NextStep != "add_account" || got.Accounts != 0 || fmt.Sprint(got.Providers) != "[github google]" {
+		t.Errorf("new user = %+v, want add_account with github and google", got)
+	}
+	if got.Similarity.Configured || got.Similarity.QdrantReachable {
+		t.Errorf("similarity = %+v, want not configured", got.Similarity)
+	}
+
+	acct, err := accounts.Create("user-1", model.EmailAccount{Type: model.AccountTypeIMAP, Email: "me@example.com", Host: "imap.example.com"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := status(); got.NextStep != "sync" || got.Accounts != 1 || got.IndexedEmails != 0 {
+		t.Errorf("before sync = %+v, want sync with 1 account", got)
+	}
+
+	emailDir := account.EmailDir(dir, "user-1", *acct)
+	if err := os.MkdirAll(filepath.Join(emailDir, "inbox"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	msg := "From: a@b.com\r\nSubject: Hello\r\nDate: Mon, 10 Feb 2020 09:00:00 +0000\r\n\r\nBody.\r\n"
+	if err := os.WriteFile(filepath.Join(emailDir, "inbox", "a.eml"), []byte(msg), 0644); err != nil {
+		t.Fatal(err)
+	}
+	idx, err := index.New(emailDir, account.IndexPath(dir, "user-1", *acct), nil, dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	idx.Build()
+	idx.Close()
+	if got := status(); got.NextStep != "search" || got.IndexedEmails != 1 {
+		t.Errorf("after sync = %+v, want search with 1 email", got)
+	}
+}
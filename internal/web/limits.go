@@ -0,0 +1,96 @@
+package web
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// defaultMaxBodyBytes and defaultRequestTimeout apply when Config leaves
+// MaxBodyBytes and RequestTimeout at 0.
+const (
+	defaultMaxBodyBytes   = 1 << 20
+	defaultRequestTimeout = time.Minute
+)
+
+// unlimitedPrefixes are the paths limitRequests leaves alone: uploads,
+// responses that are streamed or may be large (http.TimeoutHandler holds
+// the whole response in memory), and requests that do long work before
+// they answer.
+var unlimitedPrefixes = []string{
+	"/static/",
+	"/api/import/",
+	"/api/search/stream",
+	"/api/email/download",
+	"/api/email/pdf",
+	"/api/email/print",
+	"/api/email/attachment",
+	"/api/email/cid",
+	"/api/delete",
+	"/api/index/compact",
+}
+
+// unlimited reports whether path is exempt from limitRequests.
+func unlimited(path string) bool {
+	for _, p := range unlimitedPrefixes {
+		if strings.HasPrefix(path, p) {
+			return true
+		}
+	}
+	return false
+}
+
+// timeoutBody is the error body of a request that ran out of time.
+var timeoutBody = func() string {
+	data, _ := json.Marshal(errorResponse{Error: errorDetail{Code: codeTimeout, Message: "request timed out"}})
+	return string(data)
+}()
+
+// limitRequests caps request bodies at maxBytes and the time handlers
+// have to answer at timeout, so a client cannot send an endless body or
+// hold a handler open. Negative values turn either limit off. A body
+// announced larger than the cap is refused with 413; one that turns out
+// larger fails to read, which handlers report as an invalid body.
+func limitRequests(maxBytes int64, timeout time.Duration) func(http.Handler) http.Handler {
+	if maxBytes == 0 {
+		maxBytes = defaultMaxBodyBytes
+	}
+	if timeout == 0 {
+		timeout = defaultRequestTimeout
+	}
+	return func(next http.Handler) http.Handler {
+		timed := next
+		if timeout > 0 {
+			timed = http.TimeoutHandler(next, timeout, timeoutBody)
+		}
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if unlimited(r.URL.Path) {
+				next.ServeHTTP(w, r)
+				return
+			}
+			if maxBytes > 0 {
+				if r.ContentLength > maxBytes {
+					writeError(w, http.StatusRequestEntityTooLarge, codeTooLarge, fmt.Sprintf("request body is larger than %d bytes", maxBytes))
+					return
+				}
+				r.Body = http.MaxBytesReader(w, r.Body, maxBytes)
+			}
+			timed.ServeHTTP(timeoutWriter{w}, r)
+		})
+	}
+}
+
+// timeoutWriter gives the 503 that http.TimeoutHandler sends, without
+// headers, the JSON content type of every other API error.
+type timeoutWriter struct {
+	http.ResponseWriter
+}
+
+func (w timeoutWriter) WriteHeader(code int) {
+	if code == http.StatusServiceUnavailable && w.Header().Get("Content-Type") == "" {
+		w.Header().Set("Content-Type", "application/json")
+	}
+	w.ResponseWriter.WriteHeader(code)
+}
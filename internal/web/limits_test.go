@@ -0,0 +1,95 @@
+package web
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestLimitRequests(t *testing.T) {
+	release := make(chan struct{})
+	defer close(release)
+	handler := limitRequests(16, 50*time.Millisecond)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Has("slow") {
+			select {
+			case <-release:
+			case <-r.Context().Done():
+			}
+			return
+		}
+		data, err := io.ReadAll(r.Body)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, codeInvalidBody, err.Error())
+			return
+		}
+		writeJSON(w, http.StatusOK, map[string]int{"read": len(data)})
+	}))
+	do := func(target string, body io.Reader) (*httptest.ResponseRecorder, errorResponse) {
+		t.Helper()
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, target, body))
+		var out errorResponse
+		if rec.Code != http.StatusOK {
+			if ct := rec.Header().Get("Content-Type"); ct != "application/json" {
+				t.Errorf("%s: Content-Type = %q", target, ct)
+			}
+			if err := json.Unmarshal(rec.Body.Bytes(), &out); err != nil {
+				t.Errorf("%s: decode %q: %v", target, rec.Body, err)
+			}
+		}
+		return rec, out
+	}
+
+	if rec, _ := do("/api/accounts", strings.NewReader(`{"email":"a@b"}`)); rec.Code != http.StatusOK {
+		t.Errorf("small body = %d %s", rec.Code, rec.Body)
+	}
+	if rec, out := do("/api/accounts", strings.NewReader(strings.Repeat("x", 17))); rec.Code != http.StatusRequestEntityTooLarge || out.Error.Code != codeTooLarge {
+		t.Errorf("announced large body = %d %+v, want 413 %s", rec.Code, out, codeTooLarge)
+	}
+	// Without a Content-Length the cap shows while reading.
+	if rec, out := do("/api/accounts", io.MultiReader(strings.NewReader(strings.Repeat("x", 17)))); rec.Code != http.StatusBadRequest || out.Error.Code != codeInvalidBody {
+		t.Errorf("chunked large body = %d %+v, want 400", rec.Code, out)
+	}
+	if rec, out := do("/api/accounts?slow=1", nil); rec.Code != http.StatusServiceUnavailable || out.Error.Code != codeTimeout {
+		t.Errorf("slow handler = %d %+v, want 503 %s", rec.Code, out, codeTimeout)
+	}
+
+	// Uploads are neither capped nor timed.
+	if rec, _ := do("/api/import/pst", strings.NewReader(strings.Repeat("x", 100))); rec.Code != http.StatusOK {
+		t.Errorf("upload = %d %s", rec.Code, rec.Body)
+	}
+	go func() { time.Sleep(100 * time.Millisecond); release <- struct{}{} }()
+	if rec, _ := do("/api/import/pst?slow=1", nil); rec.Code != http.StatusOK {
+		t.Errorf("slow upload = %d, want it to finish", rec.Code)
+	}
+}
+
+func TestLimitRequestsExemptRoutes(t *testing.T) {
+	var got http.ResponseWriter
+	handler := limitRequests(16, time.Minute)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got = w
+		if _, err := io.ReadAll(r.Body); err != nil {
+			writeError(w, http.StatusBadRequest, codeInvalidBody, err.Error())
+		}
+	}))
+	for _, path := range append(unlimitedPrefixes, "/api/email/pdf", "/api/email/print") {
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, path, strings.NewReader(strings.Repeat("x", 100))))
+		if rec.Code != http.StatusOK {
+			t.Errorf("%s: large body = %d %s, want it read", path, rec.Code, rec.Body)
+		}
+		// http.TimeoutHandler would hand the handler a buffering writer.
+		if got != rec {
+			t.Errorf("%s: handler got %T, want the unwrapped response writer", path, got)
+		}
+	}
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/email", nil))
+	if got == rec {
+		t.Error("/api/email: handler got the unwrapped response writer, want the timeout's")
+	}
+}
@@ -0,0 +1,20 @@
+package web
+
+import (
+	_ "embed"
+	"net/http"
+)
+
+// openAPISpec is the hand-written OpenAPI 3 document for the JSON API.
+// openapi_test.go checks it against the response structs.
+//
+//go:embed openapi.json
+var openAPISpec []byte
+
+func handleOpenAPI() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Cache-Control", "public, max-age=3600")
+		w.Write(openAPISpec)
+	}
+}
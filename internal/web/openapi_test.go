@@ -0,0 +1,192 @@
+package web
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/eslider/mails/internal/model"
+	"github.com/eslider/mails/internal/search/eml"
+	"github.com/eslider/mails/internal/search/index"
+	"github.com/eslider/mails/internal/search/vector"
+	"github.com/eslider/mails/internal/sync"
+	sync_imap "github.com/eslider/mails/internal/sync/imap"
+)
+
+// fillExample sets every exported field of v (a pointer) to a non-zero value so
+// that omitempty fields show up when the struct is marshalled.
+func fillExample(v reflect.Value) {
+	fillValue(v, map[reflect.Type]bool{})
+}
+
+// fillValue does the work for fillExample. inProgress holds the struct types
+// being filled so self-referencing slices (FullEmail.Embedded) stop after one level.
+func fillValue(v reflect.Value, inProgress map[reflect.Type]bool) {
+	switch v.Kind() {
+	case reflect.Ptr:
+		if v.IsNil() {
+			v.Set(reflect.New(v.Type().Elem()))
+		}
+		fillValue(v.Elem(), inProgress)
+	case reflect.Struct:
+		if v.Type() == reflect.TypeOf(time.Time{}) {
+			v.Set(reflect.ValueOf(time.Date(2025, 2, 10, 9, 0, 0, 0, time.UTC)))
+			return
+		}
+		inProgress[v.Type()] = true
+		defer delete(inProgress, v.Type())
+		for i := 0; i < v.NumField(); i++ {
+			if v.Type().Field(i).IsExported() {
+				fillValue(v.Field(i), inProgress)
+			}
+		}
+	case reflect.Slice:
+		s := reflect.MakeSlice(v.Type(), 1, 1)
+		if inProgress[v.Type().Elem()] {
+			// One element is enough to emit the key; don't recurse into it.
+			v.Set(s)
+			return
+		}
+		fillValue(s.Index(0), inProgress)
+		v.Set(s)
+	case reflect.Map:
+		v.Set(reflect.MakeMap(v.Type()))
+	case reflect.String:
+		v.SetString("x")
+	case reflect.Bool:
+		v.SetBool(true)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		v.SetInt(1)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		v.SetUint(1)
+	case reflect.Float32, reflect.Float64:
+		v.SetFloat(1)
+	}
+}
+
+func exampleKeys(t *testing.T, sample any) []string {
+	t.Helper()
+	fillExample(reflect.ValueOf(sample))
+	data, err := json.Marshal(sample)
+	if err != nil {
+		t.Fatalf("marshal %T: %v", sample, err)
+	}
+	var m map[string]any
+	if err := json.Unmarshal(data, &m); err != nil {
+		t.Fatalf("unmarshal %T: %v", sample, err)
+	}
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func TestOpenAPISchemasMatchStructs(t *testing.T) {
+	var spec struct {
+		OpenAPI    string `json:"openapi"`
+		Components struct {
+			Schemas map[string]struct {
+				Properties map[string]any `json:"properties"`
+			} `json:"schemas"`
+		} `json:"components"`
+		Paths map[string]any `json:"paths"`
+	}
+	if err := json.Unmarshal(openAPISpec, &spec); err != nil {
+		t.Fatalf("openapi.json is not valid JSON: %v", err)
+	}
+	if spec.OpenAPI == "" {
+		t.Fatal("openapi version missing")
+	}
+
+	tests := []struct {
+		schema string
+		sample any
+	}{
+		{"SearchResult", &index.SearchResult{}},
+		{"Hit", &index.Hit{}},
+		{"AddressSuggestions", &index.AddressSuggestions{}},
+		{"Address", &index.Address{}},
+		{"Explanation", &index.Explanation{}},
+		{"Match", &index.Match{}},
+		{"ThreadHit", &index.ThreadHit{}},
+		{"Pagination", &model.Pagination{}},
+		{"Timeline", &index.Timeline{}},
+		{"FullEmail", &eml.FullEmail{}},
+		{"EmailMarks", &emailMarks{}},
+		{"MoveResult", &moveResult{}},
+		{"TrustedSenders", &trustedSenders{}},
+		{"Attachment", &eml.Attachment{}},
+		{"ReceivedHop", &eml.ReceivedHop{}},
+		{"Invite", &eml.Invite{}},
+		{"Attendee", &eml.Attendee{}},
+		{"EmailAccount", &model.EmailAccount{}},
+		{"SyncConfig", &model.SyncConfig{}},
+		{"User", &model.User{}},
+		{"RunningSync", &sync.RunningSync{}},
+		{"TLSOptions", &model.TLSOptions{}},
+		{"Folder", &sync_imap.Folder{}},
+		{"IndexErrors", &accountParseErrors{}},
+		{"LiveMessage", &sync_imap.Message{}},
+		{"ReplyDraft", &eml.ReplyDraft{}},
+		{"EmbeddingComparison", &vector.Comparison{}},
+		{"SetupStatus", &setupStatus{}},
+		{"SetupSimilarity", &similarityStatus{}},
+		{"ImportJob", &importJob{}},
+		{"AccountProgress", &accountProgress{}},
+		{"FixDatesResult", &eml.FixDatesResult{}},
+		{"Error", &errorResponse{}},
+		{"ErrorDetail", &errorDetail{}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.schema, func(t *testing.T) {
+			s, ok := spec.Components.Schemas[tt.schema]
+			if !ok {
+				t.Fatalf("schema %s missing from openapi.json", tt.schema)
+			}
+			keys := exampleKeys(t, tt.sample)
+			for _, k := range keys {
+				if _, ok := s.Properties[k]; !ok {
+					t.Errorf("%s: field %q is not documented", tt.schema, k)
+				}
+			}
+			for k := range s.Properties {
+				found := false
+				for _, have := range keys {
+					if have == k {
+						found = true
+						break
+					}
+				}
+				if !found {
+					t.Errorf("%s: documented property %q does not exist on %T", tt.schema, k, tt.sample)
+				}
+			}
+		})
+	}
+
+	for _, p := range []string{"/api/search", "/api/email", "/api/stats", "/api/reindex", "/api/accounts", "/api/sync", "/api/sync/status", "/api/import/{id}/events"} {
+		if _, ok := spec.Paths[p]; !ok {
+			t.Errorf("path %s missing from openapi.json", p)
+		}
+	}
+}
+
+func TestOpenAPIServedWithoutAuth(t *testing.T) {
+	handler := NewRouter(Config{})
+	req := httptest.NewRequest(http.MethodGet, "/api/openapi.json", nil)
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("GET /api/openapi.json: status = %d, want 200", rec.Code)
+	}
+	if ct := rec.Header().Get("Content-Type"); ct != "application/json" {
+		t.Errorf("Content-Type = %q, want application/json", ct)
+	}
+}
@@ -0,0 +1,141 @@
+package web
+
+import (
+	"fmt"
+	"html/template"
+	"regexp"
+	"strings"
+
+	"github.com/eslider/mails/internal/search/eml"
+)
+
+// printMessage is one email as the print template renders it: headers
+// formatted, the HTML body sanitized and any forwarded messages nested.
+type printMessage struct {
+	Subject, From, To, CC, ReplyTo string
+	Date                           string
+	Attachments                    []string
+	HTMLBody                       template.HTML
+	TextBody                       string
+	Encrypted                      bool
+	EncryptionType                 string
+	Embedded                       []printMessage
+}
+
+// newPrintMessage prepares fe for the print template. remoteImages keeps
+// the http(s) images of its HTML body, for trusted senders.
+func newPrintMessage(fe eml.FullEmail, remoteImages bool) printMessage {
+	m := printMessage{
+		Subject:        fe.Subject,
+		From:           fe.From,
+		To:             fe.To,
+		CC:             fe.CC,
+		ReplyTo:        fe.ReplyTo,
+		HTMLBody:       template.HTML(sanitizePrintHTML(fe.HTMLBody, remoteImages)),
+		TextBody:       fe.TextBody,
+		Encrypted:      fe.Encrypted,
+		EncryptionType: fe.EncryptionType,
+	}
+	if !fe.Date.IsZero() {
+		m.Date = fe.Date.Format("Mon, 2 Jan 2006 15:04:05 -0700")
+	}
+	for _, a := range fe.Attachments {
+		m.Attachments = append(m.Attachments, fmt.Sprintf("%s (%s)", a.Filename, formatPrintSize(int64(a.Size))))
+	}
+	for _, e := range fe.Embedded {
+		m.Embedded = append(m.Embedded, newPrintMessage(e, remoteImages))
+	}
+	return m
+}
+
+func formatPrintSize(n int64) string {
+	switch {
+	case n >= 1<<20:
+		return fmt.Sprintf("%.1f MB", float64(n)/(1<<20))
+	case n >= 1<<10:
+		return fmt.Sprintf("%.1f KB", float64(n)/(1<<10))
+	default:
+		return fmt.Sprintf("%d B", n)
+	}
+}
+
+// printCSP is the Content-Security-Policy of a print page: nothing is
+// loaded but the data: URIs of inline images and fonts, and no script runs.
+const printCSP = "default-src 'none'; img-src data:; font-src data:; style-src 'unsafe-inline'; base-uri 'none'; form-action 'none'"
+
+// printCSPRemoteImages is printCSP for trusted senders, whose remote
+// images load.
+const printCSPRemoteImages = "default-src 'none'; img-src data: http: https:; font-src data:; style-src 'unsafe-inline'; base-uri 'none'; form-action 'none'"
+
+var (
+	rePrintDropElements = regexp.MustCompile(`(?is)<!--.*?-->|<(script|noscript|title|iframe|frame|frameset|object|embed|applet|svg|math|template)\b[^>]*>.*?</(?:script|noscript|title|iframe|frame|frameset|object|embed|applet|svg|math|template)\s*>`)
+	rePrintDropTags     = regexp.MustCompile(`(?is)<!doctype[^>]*>|</?(?:html|head|body|meta|link|base|script|iframe|frame|object|embed)\b[^>]*>`)
+	rePrintTag          = regexp.MustCompile(`(?s)<([a-zA-Z][a-zA-Z0-9]*)\b([^>]*)>`)
+	rePrintAttr         = regexp.MustCompile(`(?is)\s([a-zA-Z_:][-a-zA-Z0-9_:.]*)(?:\s*=\s*(?:"([^"]*)"|'([^']*)'|([^\s"'>]+)))?`)
+	rePrintRemoteURL    = regexp.MustCompile(`(?i)url\(\s*['"]?\s*(?:[a-z][a-z0-9+.-]*:|//)[^)]*\)|@import[^;]*;?`)
+	rePrintDataURL      = regexp.MustCompile(`(?i)^url\(\s*['"]?\s*data:`)
+	rePrintHTTPURL      = regexp.MustCompile(`(?i)^url\(\s*['"]?\s*https?://`)
+)
+
+// printURLAttrs hold URLs the browser would fetch; only data: URIs, as
+// ParseFileFull leaves cid: images, are kept, and with remote images the
+// http(s) URLs of printImageAttrs.
+var printURLAttrs = map[string]bool{
+	"src": true, "srcset": true, "background": true, "poster": true,
+	"lowsrc": true, "dynsrc": true, "action": true, "formaction": true,
+}
+
+// printImageAttrs are the printURLAttrs that load images.
+var printImageAttrs = map[string]bool{"src": true, "srcset": true, "background": true}
+
+// sanitizePrintHTML makes an email's HTML body safe to inline in a print
+// page: document wrappers, scripts, frames and embedded objects are
+// dropped, as are event handler attributes and javascript: links, and
+// remote images and stylesheet URLs are removed so opening the page
+// never contacts a sender's server. The page's CSP (printCSP) backs this up.
+// remoteImages keeps http(s) image sources and CSS url()s, for senders the
+// user trusts; stylesheet imports are dropped either way.
+func sanitizePrintHTML(body string, remoteImages bool) string {
+	if body == "" {
+		return ""
+	}
+	body = rePrintDropElements.ReplaceAllString(body, "")
+	body = rePrintDropTags.ReplaceAllString(body, "")
+	body = rePrintRemoteURL.ReplaceAllStringFunc(body, func(s string) string {
+		switch {
+		case rePrintDataURL.MatchString(s), remoteImages && rePrintHTTPURL.MatchString(s):
+			return s
+		case strings.HasPrefix(strings.ToLower(s), "@import"):
+			return ""
+		}
+		return "none"
+	})
+	return rePrintTag.ReplaceAllStringFunc(body, func(tag string) string {
+		m := rePrintTag.FindStringSubmatch(tag)
+		var b strings.Builder
+		b.WriteString("<" + m[1])
+		for _, a := range rePrintAttr.FindAllStringSubmatch(m[2], -1) {
+			name := strings.ToLower(a[1])
+			value := a[2] + a[3] + a[4]
+			lower := strings.ToLower(strings.TrimSpace(value))
+			switch {
+			case strings.HasPrefix(name, "on"):
+				continue
+			case printURLAttrs[name] && !strings.HasPrefix(lower, "data:") &&
+				!(remoteImages && printImageAttrs[name] && (strings.HasPrefix(lower, "https://") || strings.HasPrefix(lower, "http://"))):
+				continue
+			case (name == "href" || name == "xlink:href") && (strings.HasPrefix(lower, "javascript:") || strings.HasPrefix(lower, "vbscript:") || strings.HasPrefix(lower, "data:")):
+				continue
+			}
+			b.WriteString(" " + a[1])
+			if a[2] != "" || a[3] != "" || a[4] != "" || strings.Contains(a[0], "=") {
+				b.WriteString(`="` + strings.ReplaceAll(value, `"`, "&quot;") + `"`)
+			}
+		}
+		if strings.HasSuffix(strings.TrimSpace(m[2]), "/") {
+			b.WriteString(" /")
+		}
+		b.WriteString(">")
+		return b.String()
+	})
+}
@@ -5,11 +5,13 @@ import (
 	"encoding/json"
 	"net/http"
 	"path/filepath"
+	"time"
 
 	"github.com/go-chi/chi/v5"
 	"github.com/go-chi/chi/v5/middleware"
 
 	"github.com/eslider/mails/internal/account"
+	"github.com/eslider/mails/internal/annotation"
 	"github.com/eslider/mails/internal/auth"
 	"github.com/eslider/mails/internal/storage"
 	"github.com/eslider/mails/internal/sync"
@@ -36,6 +38,42 @@ type Config struct {
 	UsersDir  string
 	BlobStore storage.BlobStore
 
+	// Annotations holds users' flags, stars and virtual folders; nil means a store under
+	// UsersDir.
+	Annotations *annotation.Store
+
+	// MaxAttachmentBytes cuts attachment downloads at this many bytes and
+	// marks larger attachments as truncated in email details. 0 means no limit.
+	MaxAttachmentBytes int64
+
+	// DefaultSearchLimit is the /api/search page size when no limit is
+	// given; MaxSearchLimit caps requested limits. 0 means 50 and 500.
+	DefaultSearchLimit int
+	MaxSearchLimit     int
+
+	// ReindexWorkers is how many accounts POST /api/reindex builds at
+	// once. 0 means 2.
+	ReindexWorkers int
+
+	// ReindexVectors makes POST /api/reindex update the similarity index
+	// of the accounts it rebuilt, and POST /api/email/reparse the point of
+	// the email it re-parsed, when QdrantURL and OllamaURL are set.
+	// Points are scoped to the user and account (see vector.Scope). Off
+	// by default: the server does not serve similarity search yet.
+	ReindexVectors bool
+
+	// ExternalMailRoots are the directories whose <user ID> subdirectories
+	// hold the trees each user's accounts may read mail from in place
+	// (model.EmailAccount.EmailDirOverride). Empty refuses overrides.
+	ExternalMailRoots []string
+
+	// MaxBodyBytes caps request bodies and RequestTimeout the time a
+	// handler has to answer, except for uploads, downloads and streams
+	// (see limitRequests). 0 means 1 MiB and one minute; negative means
+	// no limit.
+	MaxBodyBytes   int64
+	RequestTimeout time.Duration
+
 	// Search (optional — per-user indices are loaded on demand).
 	QdrantURL  string
 	OllamaURL  string
@@ -44,6 +82,9 @@ type Config struct {
 
 // NewRouter creates the Chi router with all routes.
 func NewRouter(cfg Config) http.Handler {
+	if cfg.Annotations == nil {
+		cfg.Annotations = annotation.NewStore(cfg.UsersDir, cfg.BlobStore)
+	}
 	r := chi.NewRouter()
 
 	// Middleware.
@@ -51,6 +92,9 @@ func NewRouter(cfg Config) http.Handler {
 	r.Use(middleware.Recoverer)
 	r.Use(middleware.Compress(5))
 	r.Use(corsMiddleware)
+	r.Use(limitRequests(cfg.MaxBodyBytes, cfg.RequestTimeout))
+	r.NotFound(apiNotFound)
+	r.MethodNotAllowed(apiMethodNotAllowed)
 
 	// Static assets (Vue.js, CSS, JS).
 	if StaticDir != "" {
@@ -87,6 +131,7 @@ func NewRouter(cfg Config) http.Handler {
 		r.Get("/auth/{provider}/callback", handleOAuthCallback(cfg.Auth, cfg.Sessions, cfg.Users))
 
 		r.Get("/health", handleHealth())
+		r.Get("/api/openapi.json", handleOpenAPI())
 	})
 
 	// Protected routes (require authentication).
@@ -99,35 +144,89 @@ func NewRouter(cfg Config) http.Handler {
 
 		// User API.
 		r.Get("/api/me", handleMe(cfg.Users))
+		r.Put("/api/me/preferences", handleUpdatePreferences(cfg.Users, cfg.Accounts))
+		r.Get("/api/allowlist", handleListTrustedSenders(cfg.Users))
+		r.Post("/api/allowlist", handleSetTrustedSender(cfg.Users, true))
+		r.Delete("/api/allowlist", handleSetTrustedSender(cfg.Users, false))
 
 		// Account API.
 		r.Get("/api/accounts", handleListAccounts(cfg.Accounts))
-		r.Post("/api/accounts", handleCreateAccount(cfg.Accounts))
-		r.Put("/api/accounts/{id}", handleUpdateAccount(cfg.Accounts))
+		r.Post("/api/accounts", handleCreateAccount(cfg))
+		r.Post("/api/accounts/bulk", handleBulkCreateAccounts(cfg))
+		r.Put("/api/accounts/{id}", handleUpdateAccount(cfg))
 		r.Delete("/api/accounts/{id}", handleDeleteAccount(cfg.Accounts))
+		r.Post("/api/accounts/{id}/clone", handleCloneAccount(cfg.Accounts))
+		r.Post("/api/accounts/{id}/pause", handleSetSyncEnabled(cfg.Accounts, false))
+		r.Post("/api/accounts/{id}/resume", handleSetSyncEnabled(cfg.Accounts, true))
+		r.Post("/api/accounts/{id}/seen", handleAccountSeen(cfg.Sync, cfg.Accounts))
+		r.Get("/api/accounts/{id}/folders", handleAccountFolders(cfg.Sync, cfg.Accounts))
+		r.Post("/api/accounts/{id}/fix-dates", handleAccountFixDates(cfg))
 
 		// Sync API.
 		r.Post("/api/sync", handleSyncTrigger(cfg.Sync, cfg.Accounts))
 		r.Post("/api/sync/stop", handleSyncStop(cfg.Sync, cfg.Accounts))
 		r.Get("/api/sync/status", handleSyncStatus(cfg.Sync, cfg.Accounts))
 
-		// Import API (PST/OST).
+		// Admin API: every user's syncs.
+		r.Group(func(r chi.Router) {
+			r.Use(requireAdmin(cfg.Users))
+			r.Get("/api/admin/syncs", handleAdminSyncs(cfg.Sync))
+			r.Post("/api/admin/syncs/{accountID}/stop", handleAdminStopSync(cfg.Sync))
+		})
+
+		// Import API (PST/OST, Maildir).
 		r.Post("/api/import/pst", handleImportPST(cfg))
+		r.Post("/api/import/maildir", handleImportMaildir(cfg))
 		r.Get("/api/import/status/{id}", handleImportStatus())
+		r.Get("/api/import/{id}/events", handleImportEvents())
 
 		// Search API.
 		r.Get("/api/search", handleSearch(cfg))
+		r.Get("/api/live-search", handleLiveSearch(cfg))
+		r.Get("/api/search/stream", handleSearchStream(cfg))
+		r.Get("/api/timeline", handleTimeline(cfg))
+		r.Get("/api/suggest", handleSuggest(cfg))
+		r.Get("/api/addresses", handleAddresses(cfg))
 		r.Get("/api/email", handleEmailDetail(cfg))
+		r.Post("/api/email/flag", handleAnnotate(cfg, func(a *annotation.Annotation) { a.Flagged = true }))
+		r.Post("/api/email/unflag", handleAnnotate(cfg, func(a *annotation.Annotation) { a.Flagged = false }))
+		r.Post("/api/email/star", handleAnnotate(cfg, func(a *annotation.Annotation) { a.Starred = true }))
+		r.Post("/api/email/unstar", handleAnnotate(cfg, func(a *annotation.Annotation) { a.Starred = false }))
+		r.Post("/api/email/move", handleMoveEmails(cfg))
 		r.Get("/api/email/download", handleEmailDownload(cfg))
+		r.Get("/api/email/pdf", handleEmailPDF(cfg))
+		r.Get("/api/email/print", handleEmailPrint(cfg))
+		r.Get("/api/email/reply-draft", handleReplyDraft(cfg))
 		r.Get("/api/email/attachment", handleAttachmentDownload(cfg))
 		r.Get("/api/email/cid", handleCIDResource(cfg))
+		r.Post("/api/email/reparse", handleReparseEmail(cfg))
+		r.Post("/api/delete", handleBulkDelete(cfg))
 		r.Get("/api/stats", handleSearchStats(cfg))
+		r.Get("/api/setup-status", handleSetupStatus(cfg))
 		r.Post("/api/reindex", handleReindex(cfg))
+		r.Post("/api/index/compact", handleCompactIndex(cfg))
+		r.Get("/api/index/errors", handleIndexErrors(cfg))
+		r.Post("/api/vector/diagnose", handleVectorDiagnose(cfg))
 	})
 
 	return r
 }
 
+// requireAdmin passes only requests of users with the admin role (see
+// model.User.Admin), read from storage on each request so that mails admin
+// takes effect without a restart; it runs after auth.RequireAuth.
+func requireAdmin(users *user.Store) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if users == nil || !users.IsAdmin(auth.UserIDFromContext(r.Context())) {
+				writeError(w, http.StatusForbidden, codeForbidden, "admin role required")
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
 func corsMiddleware(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		w.Header().Set("Access-Control-Allow-Origin", "*")
@@ -148,7 +247,3 @@ func writeJSON(w http.ResponseWriter, status int, v any) {
 	enc.SetIndent("", "  ")
 	enc.Encode(v)
 }
-
-func writeError(w http.ResponseWriter, status int, msg string) {
-	writeJSON(w, status, map[string]string{"error": msg})
-}
@@ -20,6 +20,7 @@ var (
 	loginTmpl     *template.Template
 	registerTmpl  *template.Template
 	dashboardTmpl *template.Template
+	printTmpl     *template.Template
 )
 
 func init() {
@@ -38,6 +39,9 @@ func loadEmbeddedTemplates() {
 
 	dashboardData, _ := templatesFS.ReadFile("templates/dashboard.tmpl")
 	dashboardTmpl = template.Must(template.Must(base.Clone()).Parse(string(dashboardData)))
+
+	printData, _ := templatesFS.ReadFile("templates/email/print.tmpl")
+	printTmpl = template.Must(template.New("").Parse(string(printData)))
 }
 
 // renderLogin executes the login template with the given error (empty string for no error).
@@ -73,6 +77,17 @@ func renderDashboard(w io.Writer) error {
 	return t.Execute(w, nil)
 }
 
+// renderPrint writes the standalone print page of an email.
+func renderPrint(w io.Writer, m printMessage) error {
+	templatesMu.RLock()
+	t := printTmpl
+	templatesMu.RUnlock()
+	if t == nil {
+		return nil
+	}
+	return t.ExecuteTemplate(w, "print", m)
+}
+
 // ReloadTemplates loads templates from TemplateDir if set, otherwise keeps embedded.
 // Call after changing TemplateDir (e.g. in tests or dev mode).
 func ReloadTemplates() {
@@ -88,6 +103,8 @@ func ReloadTemplates() {
 		loginTmpl = template.Must(template.Must(base.Clone()).Parse(string(loginData)))
 		registerTmpl = template.Must(template.Must(base.Clone()).Parse(string(registerData)))
 		dashboardTmpl = template.Must(template.Must(base.Clone()).Parse(string(dashboardData)))
+		printData, _ := templatesFS.ReadFile("templates/email/print.tmpl")
+		printTmpl = template.Must(template.New("").Parse(string(printData)))
 		return
 	}
 
@@ -95,6 +112,7 @@ func ReloadTemplates() {
 	loginPath := filepath.Join(TemplateDir, "auth", "login.tmpl")
 	registerPath := filepath.Join(TemplateDir, "auth", "register.tmpl")
 	dashboardPath := filepath.Join(TemplateDir, "dashboard.tmpl")
+	printPath := filepath.Join(TemplateDir, "email", "print.tmpl")
 
 	if pwaData, err := os.ReadFile(pwaPath); err == nil {
 		base := template.Must(template.New("").Parse(string(pwaData)))
@@ -108,4 +126,7 @@ func ReloadTemplates() {
 			dashboardTmpl = template.Must(template.Must(base.Clone()).Parse(string(d)))
 		}
 	}
+	if d, err := os.ReadFile(printPath); err == nil {
+		printTmpl = template.Must(template.New("").Parse(string(d)))
+	}
 }
@@ -9,6 +9,7 @@
 package e2e
 
 import (
+	"context"
 	"fmt"
 	"net"
 	"net/smtp"
@@ -197,6 +198,143 @@ func TestIMAPSync(t *testing.T) {
 	t.Log("IMAP idempotency check passed: 0 new messages on re-sync")
 }
 
+func TestIMAPSyncSince(t *testing.T) {
+	seedMessages(t)
+
+	stateDB, err := sync_state.OpenStateDB(newTempDir(t, "state-since"), "test-user")
+	if err != nil {
+		t.Fatalf("open state db: %v", err)
+	}
+	defer stateDB.Close()
+
+	acct := model.EmailAccount{
+		ID:       "imap-since-001",
+		Type:     model.AccountTypeIMAP,
+		Email:    testUser,
+		Host:     imapHost,
+		Port:     imapPort,
+		Password: testPass,
+		Folders:  "INBOX",
+	}
+
+	// GreenMail dates messages on delivery, so nothing is from tomorrow.
+	acct.SyncSince = time.Now().AddDate(0, 0, 1)
+	emailDir := newTempDir(t, "emails-since")
+	if n, err := sync_imap.Sync(acct, emailDir, stateDB); err != nil || n != 0 {
+		t.Fatalf("sync since tomorrow = %d, %v; want 0", n, err)
+	}
+	if files := countEmlFiles(t, emailDir); files != 0 {
+		t.Errorf("sync since tomorrow wrote %d files, want 0", files)
+	}
+
+	// Moving the date back fetches what was skipped.
+	acct.SyncSince = time.Now().AddDate(0, 0, -1)
+	if n, err := sync_imap.Sync(acct, emailDir, stateDB); err != nil || n < len(testMessages) {
+		t.Fatalf("sync since yesterday = %d, %v; want at least %d", n, err, len(testMessages))
+	}
+}
+
+func TestIMAPAppend(t *testing.T) {
+	seedMessages(t)
+
+	acct := model.EmailAccount{
+		ID:       "imap-append-001",
+		Type:     model.AccountTypeIMAP,
+		Email:    testUser,
+		Host:     imapHost,
+		Port:     imapPort,
+		Password: testPass,
+		SSL:      false,
+		Folders:  "INBOX",
+	}
+
+	// Bare LF line endings: Append must convert them to CRLF for the literal.
+	subject := fmt.Sprintf("Appended reply %d", time.Now().UnixNano())
+	raw := fmt.Sprintf("From: %s\nTo: friend@example.com\nSubject: %s\nDate: %s\nMessage-ID: <append-%d@e2e.local>\n\nSaved by APPEND.\n",
+		testUser, subject, time.Now().UTC().Format(time.RFC1123Z), time.Now().UnixNano())
+	if err := sync_imap.Append(context.Background(), acct, "INBOX", []string{`\Seen`}, []byte(raw)); err != nil {
+		t.Fatalf("append: %v", err)
+	}
+
+	emailDir := newTempDir(t, "emails-append")
+	stateDB, err := sync_state.OpenStateDB(newTempDir(t, "state-append"), "test-user")
+	if err != nil {
+		t.Fatalf("open state db: %v", err)
+	}
+	defer stateDB.Close()
+	if _, err := sync_imap.Sync(acct, emailDir, stateDB); err != nil {
+		t.Fatalf("IMAP sync failed: %v", err)
+	}
+
+	found := false
+	filepath.WalkDir(emailDir, func(path string, d os.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return nil
+		}
+		if data, readErr := os.ReadFile(path); readErr == nil && strings.Contains(string(data), subject) {
+			found = true
+		}
+		return nil
+	})
+	if !found {
+		t.Errorf("appended message %q not retrieved by sync", subject)
+	}
+
+	// A missing folder is rejected before the literal is sent.
+	if err := sync_imap.Append(context.Background(), acct, "No Such Folder", nil, []byte(raw)); err == nil {
+		t.Error("expected error appending to a missing folder")
+	}
+}
+
+func TestIMAPLiveSearch(t *testing.T) {
+	seedMessages(t)
+
+	acct := model.EmailAccount{
+		ID:       "imap-live-001",
+		Type:     model.AccountTypeIMAP,
+		Email:    testUser,
+		Host:     imapHost,
+		Port:     imapPort,
+		Password: testPass,
+		SSL:      false,
+		Folders:  "INBOX",
+	}
+	ctx := context.Background()
+
+	msgs, total, err := sync_imap.Search(ctx, acct, "INBOX", sync_imap.SearchCriteria{Subject: "Invoice #2024-001"}, 10)
+	if err != nil {
+		t.Fatalf("search by subject: %v", err)
+	}
+	if total == 0 || len(msgs) == 0 {
+		t.Fatal("expected the seeded invoice to match")
+	}
+	for _, m := range msgs {
+		if m.Subject != "Invoice #2024-001" || !strings.Contains(m.From, "billing@acme.com") || m.Size == 0 || m.UID == 0 {
+			t.Errorf("unexpected match %+v", m)
+		}
+	}
+
+	if _, total, err := sync_imap.Search(ctx, acct, "INBOX", sync_imap.SearchCriteria{From: "manager@company.org", Body: "Conference Room B"}, 10); err != nil || total == 0 {
+		t.Errorf("search by from+body: total=%d err=%v", total, err)
+	}
+	if _, total, err := sync_imap.Search(ctx, acct, "INBOX", sync_imap.SearchCriteria{Subject: "no such subject anywhere"}, 10); err != nil || total != 0 {
+		t.Errorf("search for a missing subject: total=%d err=%v", total, err)
+	}
+
+	// The limit keeps the newest matches but still reports the total.
+	all, total, err := sync_imap.Search(ctx, acct, "INBOX", sync_imap.SearchCriteria{}, 2)
+	if err != nil {
+		t.Fatalf("search all: %v", err)
+	}
+	if len(all) != 2 || total < len(testMessages) || all[0].UID < all[1].UID {
+		t.Errorf("limited search = %d messages of %d, want the 2 newest", len(all), total)
+	}
+
+	if _, _, err := sync_imap.Search(ctx, acct, "No Such Folder", sync_imap.SearchCriteria{}, 10); err == nil {
+		t.Error("expected error searching a missing folder")
+	}
+}
+
 // --- POP3 Tests ---
 
 func TestPOP3Sync(t *testing.T) {
@@ -259,6 +397,53 @@ func TestPOP3Sync(t *testing.T) {
 	t.Log("POP3 idempotency check passed: 0 new messages on re-sync")
 }
 
+// TestPOP3SyncUIDLAcrossSessions checks that a fresh state DB handle (as
+// after a restart) still skips every message by UIDL.
+func TestPOP3SyncUIDLAcrossSessions(t *testing.T) {
+	seedMessages(t)
+
+	emailDir := newTempDir(t, "emails-pop3-uidl")
+	stateDir := newTempDir(t, "state-pop3-uidl")
+	acct := model.EmailAccount{
+		ID:       "pop3-uidl-001",
+		Type:     model.AccountTypePOP3,
+		Email:    testUser,
+		Host:     pop3Host,
+		Port:     pop3Port,
+		Password: testPass,
+	}
+
+	stateDB, err := sync_state.OpenStateDB(stateDir, "test-user")
+	if err != nil {
+		t.Fatalf("open state db: %v", err)
+	}
+	newMsgs, err := sync_pop3.Sync(acct, emailDir, stateDB)
+	if err != nil {
+		t.Fatalf("POP3 sync failed: %v", err)
+	}
+	uidls, err := stateDB.SyncedUIDs(acct.ID, "uidl")
+	if err != nil {
+		t.Fatalf("get synced UIDLs: %v", err)
+	}
+	stateDB.Close()
+	if len(uidls) < newMsgs || len(uidls) < 5 {
+		t.Errorf("recorded %d UIDLs for %d new messages", len(uidls), newMsgs)
+	}
+
+	stateDB, err = sync_state.OpenStateDB(stateDir, "test-user")
+	if err != nil {
+		t.Fatalf("reopen state db: %v", err)
+	}
+	defer stateDB.Close()
+	newMsgs2, err := sync_pop3.Sync(acct, emailDir, stateDB)
+	if err != nil {
+		t.Fatalf("POP3 second sync failed: %v", err)
+	}
+	if newMsgs2 != 0 {
+		t.Errorf("expected 0 new messages after reconnect, got %d", newMsgs2)
+	}
+}
+
 // --- Index + Search Tests ---
 
 func TestIMAPSyncThenIndexAndSearch(t *testing.T) {
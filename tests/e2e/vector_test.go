@@ -115,13 +115,6 @@ func vectorTestEmails() []eml.Email {
 	}
 }
 
-// mockWalkFn returns a WalkEmailsFn that returns the given emails.
-func mockWalkFn(emails []eml.Email) vector.WalkEmailsFn {
-	return func(emailDir string) ([]eml.Email, int) {
-		return emails, 0
-	}
-}
-
 func TestVector_EmbedderDimension(t *testing.T) {
 	// Case: Embedder produces consistent non-zero vectors.
 	skipIfNoVectorServices(t)
@@ -180,7 +173,7 @@ func TestVector_RecreateCollectionClearsData(t *testing.T) {
 	ctx := context.Background()
 
 	emails := vectorTestEmails()[:2]
-	indexed, _, err := store.IndexEmails(ctx, "", mockWalkFn(emails), nil)
+	indexed, _, err := store.IndexEmails(ctx, "", vector.SliceSource(emails), vector.IndexOptions{Rebuild: true}, nil)
 	if err != nil {
 		t.Fatalf("index before recreate: %v", err)
 	}
@@ -214,7 +207,7 @@ func TestVector_IndexAndSearch(t *testing.T) {
 	ctx := context.Background()
 
 	emails := vectorTestEmails()
-	indexed, errCount, err := store.IndexEmails(ctx, "", mockWalkFn(emails), nil)
+	indexed, errCount, err := store.IndexEmails(ctx, "", vector.SliceSource(emails), vector.IndexOptions{Rebuild: true}, nil)
 	if err != nil {
 		t.Fatalf("index emails: %v", err)
 	}
@@ -273,7 +266,7 @@ func TestVector_SemanticMatch(t *testing.T) {
 	ctx := context.Background()
 
 	emails := vectorTestEmails()
-	store.IndexEmails(ctx, "", mockWalkFn(emails), nil)
+	store.IndexEmails(ctx, "", vector.SliceSource(emails), vector.IndexOptions{Rebuild: true}, nil)
 
 	results, _, err := store.Search(ctx, "money owed to us for services", 5, 0)
 	if err != nil {
@@ -289,6 +282,12 @@ func TestVector_SemanticMatch(t *testing.T) {
 	if !contains(topSubject, "Invoice") && !contains(topSubject, "invoice") {
 		t.Logf("NOTE: top result is %q, not the invoice — semantic ranking may vary by model", topSubject)
 	}
+	// Results carry a body preview from the payload.
+	for _, r := range results {
+		if r.Snippet == "" {
+			t.Errorf("result %q has empty snippet", r.Subject)
+		}
+	}
 }
 
 func TestVector_EmptyQuery(t *testing.T) {
@@ -317,7 +316,7 @@ func TestVector_SearchPagination(t *testing.T) {
 	ctx := context.Background()
 
 	emails := vectorTestEmails()
-	store.IndexEmails(ctx, "", mockWalkFn(emails), nil)
+	store.IndexEmails(ctx, "", vector.SliceSource(emails), vector.IndexOptions{Rebuild: true}, nil)
 
 	// Get first 2 results.
 	page1, _, err := store.Search(ctx, "email communication", 2, 0)
@@ -356,7 +355,7 @@ func TestVector_ProgressCallback(t *testing.T) {
 	emails := vectorTestEmails()
 	var progressCalls []string
 
-	_, _, err := store.IndexEmails(ctx, "", mockWalkFn(emails), func(indexed, total int) {
+	_, _, err := store.IndexEmails(ctx, "", vector.SliceSource(emails), vector.IndexOptions{Rebuild: true}, func(indexed, total int) {
 		progressCalls = append(progressCalls, fmt.Sprintf("%d/%d", indexed, total))
 	})
 	if err != nil {
@@ -418,7 +417,7 @@ func TestVector_FullPipeline_SyncIndexSearch(t *testing.T) {
 	// Step 3: Build vector index (Qdrant).
 	store := newVectorStore(t)
 	ctx := context.Background()
-	vecTotal, _, err := store.IndexEmails(ctx, emailDir, index.WalkEmails, nil)
+	vecTotal, _, err := store.IndexEmails(ctx, emailDir, index.StreamEmails, vector.IndexOptions{Rebuild: true}, nil)
 	if err != nil {
 		t.Fatalf("vector index: %v", err)
 	}
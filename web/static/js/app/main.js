@@ -12,6 +12,10 @@
   const MAX_SPACER_HEIGHT = 50000;
   const VIRTUAL_WINDOW_BUFFER = 5;
 
+  // apiError returns the message of an API error body
+  // ({"error": {"code", "message"}}), or fallback when there is none.
+  const apiError = (data, fallback = '') => (data && data.error && data.error.message) || fallback;
+
   const templateResponse = await fetch('/static/js/app/main.template.vue');
   const templateHTML = await templateResponse.text();
 
@@ -23,6 +27,7 @@
         view: 'search',   // 'search' | 'accounts' | 'sync' | 'detail'
         user: null,
         accounts: [],
+        setupStatus: null,
         searchQuery: '',
         searchResults: null,
         searchMode: 'keyword',
@@ -32,6 +37,7 @@
         selectedEmail: null,
         detailAccountId: null,
         loading: false,
+        reparsing: false,
         syncStatuses: [],
         syncStatusMap: {},
         accountPollTimer: null,
@@ -45,10 +51,15 @@
           password: '',
           ssl: true,
           folders: 'all',
+          tls: {},
           sync: { interval: '5m', enabled: true }
         },
+        serverFolders: null,
+        loadingFolders: false,
         toasts: [],
         debounceTimer: null,
+        suggestTimer: null,
+        suggestions: null,
         importTitle: '',
         importFile: null,
         importRunning: false,
@@ -67,9 +78,19 @@
     },
 
     computed: {
+      // The date input edits sync_since, an RFC 3339 time in the API.
+      syncSinceDate: {
+        get() {
+          return (this.newAccount.sync_since || '').slice(0, 10);
+        },
+        set(v) {
+          this.newAccount.sync_since = v ? `${v}T00:00:00Z` : undefined;
+        }
+      },
+
       totalPages() {
         if (!this.searchResults) return 0;
-        return Math.ceil(this.searchResults.total / this.pageSize);
+        return this.searchResults.pagination?.total_pages ?? Math.ceil(this.searchResults.total / this.pageSize);
       },
 
       searchLoadProgress() {
@@ -157,7 +178,11 @@
         if (!this.importJob) return '';
         const labels = {
           uploading: 'Uploading...',
+          counting: 'Counting messages...',
           extracting: 'Extracting messages...',
+          unpacking: 'Unpacking archive...',
+          importing: 'Importing messages...',
+          'fixing-dates': 'Setting file dates...',
           indexing: 'Building search index...',
           done: 'Import complete',
           error: 'Import failed'
@@ -171,7 +196,8 @@
         let detail;
         switch (phase) {
           case 'uploading': detail = total > 0 ? `${current} / ${total} MB` : ''; break;
-          case 'extracting': detail = `${current} messages`; break;
+          case 'extracting': detail = total > 0 ? `${current} / ${total} messages` : `${current} messages`; break;
+          case 'fixing-dates': detail = total > 0 ? `${current} / ${total} files` : ''; break;
           case 'done': detail = `${current} messages imported`; break;
           default: detail = '';
         }
@@ -186,7 +212,8 @@
           case 'done': pct = 100; break;
           case 'error': pct = 0; break;
           case 'uploading': pct = total > 0 ? Math.min(99, Math.round(current / total * 100)) : 0; break;
-          case 'extracting': pct = current > 0 ? 50 : 0; break;
+          case 'extracting': pct = total > 0 ? Math.min(89, Math.round(current / total * 89)) : (current > 0 ? 50 : 0); break;
+          case 'fixing-dates': pct = 89; break;
           case 'indexing': pct = 90; break;
           default: pct = 0;
         }
@@ -224,6 +251,7 @@
       this.isMobile = typeof window !== 'undefined' && window.innerWidth < 768;
       this.loadUser();
       this.loadAccounts();
+      this.loadSetupStatus();
       this.doSearch('', 0);
       this.startSyncPoll();
 
@@ -313,6 +341,18 @@
         } catch {
           this.accounts = [];
         }
+        if (this.setupStatus && this.setupStatus.next_step !== 'search') this.loadSetupStatus();
+      },
+
+      // loadSetupStatus fetches what a new user still has to set up; the
+      // search view shows the remaining steps until mail is indexed.
+      async loadSetupStatus() {
+        try {
+          const r = await fetch('/api/setup-status');
+          this.setupStatus = r.ok ? await r.json() : null;
+        } catch {
+          this.setupStatus = null;
+        }
       },
 
       openAddAccount() {
@@ -325,17 +365,72 @@
           password: '',
           ssl: true,
           folders: 'all',
+          exclude_folders: 'Spam,Junk,Trash,Bin,Deleted*',
+          tls: {},
           sync: { interval: '5m', enabled: true }
         };
+        this.serverFolders = null;
         this.showAddAccount = true;
       },
 
       openEditAccount(acct) {
         this.editingAccount = acct.id;
         this.newAccount = JSON.parse(JSON.stringify(acct));
+        this.newAccount.tls ??= {};
+        this.serverFolders = null;
         this.showAddAccount = true;
       },
 
+      // Clone: the add-account form prefilled with another account's
+      // server settings; the email and password are left to fill in.
+      async openCloneAccount(acct) {
+        try {
+          const r = await fetch(`/api/accounts/${acct.id}/clone`, { method: 'POST' });
+          const data = await r.json().catch(() => ({}));
+          if (!r.ok) throw new Error(apiError(data));
+          this.editingAccount = null;
+          this.newAccount = { ...data, password: '', tls: data.tls || {} };
+          this.serverFolders = null;
+          this.showAddAccount = true;
+        } catch (e) {
+          this.showToast(e.message ? `Failed to clone account: ${e.message}` : 'Failed to clone account', 'error');
+        }
+      },
+
+      // Folder picker: lists the saved account's server folders so the
+      // Folders field can be set to a subset instead of typed blind.
+      async loadServerFolders(refresh) {
+        this.loadingFolders = true;
+        try {
+          const r = await fetch(`/api/accounts/${this.editingAccount}/folders${refresh ? '?refresh=true' : ''}`);
+          const data = await r.json().catch(() => ({}));
+          if (!r.ok) throw new Error(apiError(data));
+          this.serverFolders = data.folders || [];
+        } catch (e) {
+          this.showToast(e.message ? `Failed to list folders: ${e.message}` : 'Failed to list folders', 'error');
+        } finally {
+          this.loadingFolders = false;
+        }
+      },
+
+      selectedFolders() {
+        const v = (this.newAccount.folders || '').trim();
+        if (!v || v === 'all') return [];
+        return v.split(',').map(f => f.trim()).filter(Boolean);
+      },
+
+      isFolderSelected(name) {
+        return this.selectedFolders().includes(name);
+      },
+
+      // Toggling keeps server order; unticking everything means "all".
+      toggleFolder(name) {
+        const picked = new Set(this.selectedFolders());
+        if (picked.has(name)) picked.delete(name); else picked.add(name);
+        const ordered = this.serverFolders.map(f => f.name).filter(n => picked.has(n));
+        this.newAccount.folders = ordered.length ? ordered.join(',') : 'all';
+      },
+
       async saveAccount() {
         const url = this.editingAccount ? `/api/accounts/${this.editingAccount}` : '/api/accounts';
         const method = this.editingAccount ? 'PUT' : 'POST';
@@ -345,12 +440,16 @@
             headers: { 'Content-Type': 'application/json' },
             body: JSON.stringify(this.newAccount)
           });
-          if (!r.ok) throw new Error();
+          if (!r.ok) {
+            const data = await r.json().catch(() => ({}));
+            throw new Error(apiError(data));
+          }
           this.showAddAccount = false;
           this.loadAccounts();
           this.showToast(this.editingAccount ? 'Account updated' : 'Account added', 'success');
-        } catch {
-          this.showToast(this.editingAccount ? 'Failed to update account' : 'Failed to add account', 'error');
+        } catch (e) {
+          const msg = this.editingAccount ? 'Failed to update account' : 'Failed to add account';
+          this.showToast(e.message ? `${msg}: ${e.message}` : msg, 'error');
         }
       },
 
@@ -366,6 +465,27 @@
         }
       },
 
+      // Default account: used for email links that carry no account_id.
+      isDefaultAccount(acct) {
+        const id = this.user && this.user.default_account_id;
+        return id ? id === acct.id : this.accounts.length > 0 && this.accounts[0].id === acct.id;
+      },
+
+      async setDefaultAccount(acct) {
+        try {
+          const r = await fetch('/api/me/preferences', {
+            method: 'PUT',
+            headers: { 'Content-Type': 'application/json' },
+            body: JSON.stringify({ default_account_id: acct.id })
+          });
+          if (!r.ok) throw new Error();
+          this.user = await r.json();
+          this.showToast(`${acct.email} is now the default account`, 'success');
+        } catch {
+          this.showToast('Failed to set default account', 'error');
+        }
+      },
+
       updatePortForType() {
         const defaults = { IMAP: 993, POP3: 995, GMAIL_API: 0 };
         this.newAccount.port = defaults[this.newAccount.type] || 993;
@@ -385,6 +505,52 @@
         clearTimeout(this.debounceTimer);
         this.currentPage = 0;
         this.debounceTimer = setTimeout(() => this.doSearch(this.searchQuery, 0), 200);
+        clearTimeout(this.suggestTimer);
+        this.suggestTimer = setTimeout(() => this.fetchSuggestions(this.searchQuery), 300);
+      },
+
+      async fetchSuggestions(query) {
+        const q = (query || '').trim();
+        if (q.length < 2) {
+          this.suggestions = null;
+          return;
+        }
+        // A trailing from: or to: term completes from the address book.
+        const term = q.match(/^(.*?)\b(from|to):(\S*)$/i);
+        let url = term
+          ? `/api/addresses?q=${encodeURIComponent(term[3])}`
+          : `/api/suggest?q=${encodeURIComponent(q)}`;
+        const ids = this.enabledSearchAccountIds();
+        if (ids.length > 0 && ids.length < this.accounts.length) url += `&account_ids=${encodeURIComponent(ids.join(','))}`;
+        try {
+          const r = await fetch(url);
+          // Drop stale responses if the user kept typing.
+          if (!r.ok || q !== (this.searchQuery || '').trim()) return;
+          const data = await r.json();
+          if (term) {
+            const prefix = term[1] + term[2].toLowerCase() + ':';
+            this.suggestions = {
+              subjects: [], senders: [],
+              addresses: data.addresses.map(a => ({ ...a, value: prefix + a.address })),
+            };
+          } else {
+            this.suggestions = data;
+          }
+        } catch {
+          this.suggestions = null;
+        }
+      },
+
+      applySuggestion(value) {
+        this.searchQuery = value;
+        this.suggestions = null;
+        clearTimeout(this.suggestTimer);
+        this.currentPage = 0;
+        this.doSearch(value, 0);
+      },
+
+      hideSuggestions() {
+        setTimeout(() => { this.suggestions = null; }, 150);
       },
 
       async doSearch(query, offset, append = false) {
@@ -393,6 +559,7 @@
         const ids = this.enabledSearchAccountIds();
         if (ids.length > 0 && ids.length < this.accounts.length) url += `&account_ids=${encodeURIComponent(ids.join(','))}`;
         if (this.searchMode === 'similarity') url += '&mode=similarity';
+        else if (!query) url += '&preview=1';
 
         if (append) {
           this.loadingMore = true;
@@ -412,6 +579,7 @@
             this.currentPage = Math.floor(off / this.pageSize);
             if (!append) this._loadMoreObserverSetup = false;
           }
+          if (!append && data.warnings?.length) this.showToast(`Partial results: ${data.warnings.join('; ')}`, 'warning');
         } catch {
           if (!append) this.searchResults = { total: 0, hits: [], query };
         } finally {
@@ -426,7 +594,8 @@
       loadMore() {
         if (this.loadingMore || !this.searchResults) return;
         if (this.searchResults.hits?.length === 0) return;
-        if (this.currentPage >= this.totalPages - 1) return;
+        const paging = this.searchResults.pagination;
+        if (paging ? !paging.has_next : this.currentPage >= this.totalPages - 1) return;
         this.doSearch(this.searchQuery, (this.currentPage + 1) * this.pageSize, true);
       },
 
@@ -603,9 +772,13 @@
       },
 
       highlightText(text, query) {
+        // Search operators (has:attachment, attachments:>2, before:2023-01-01) are filters, not text.
+        query = (query || '').replace(/(^|\s)(has|attachments|before|after|header|from|to|subject):(?:"[^"]*"|\S*)/gi, ' ').trim();
         if (!query || !text) return this.escapeHtml(text || '');
         const escaped = query.replace(/[.*+?^${}()|[\]\\]/g, '\\$&');
-        const re = new RegExp(`(${escaped})`, 'gi');
+        // Take trailing combining marks and emoji modifiers along, so a
+        // <mark> never splits a letter from its accent.
+        const re = new RegExp(`(${escaped}[\\p{M}\\u200d\\u{1F3FB}-\\u{1F3FF}]*)`, 'giu');
         return this.escapeHtml(text).replace(re, '<mark>$1</mark>');
       },
 
@@ -615,6 +788,59 @@
         return `${d.toLocaleDateString('en-US', { year: 'numeric', month: 'short', day: 'numeric' })} ${d.toLocaleTimeString('en-US', { hour: '2-digit', minute: '2-digit' })}`;
       },
 
+      // --- Calendar invites ---
+      inviteHeading(inv) {
+        const labels = { REQUEST: 'Meeting invitation', CANCEL: 'Meeting cancelled', REPLY: 'Invitation reply', COUNTER: 'New time proposed' };
+        return labels[inv.method] || 'Calendar event';
+      },
+
+      inviteWhen(inv) {
+        if (inv.all_day) {
+          const opts = { timeZone: 'UTC', year: 'numeric', month: 'short', day: 'numeric' };
+          return new Date(inv.start).toLocaleDateString('en-US', opts) + ' (all day)';
+        }
+        let s = this.formatDate(inv.start);
+        if (inv.end) s += ' – ' + new Date(inv.end).toLocaleTimeString('en-US', { hour: '2-digit', minute: '2-digit' });
+        return s;
+      },
+
+      // icsStamp formats a date as an iCalendar UTC DATE-TIME, or DATE for all-day events.
+      icsStamp(dateStr, allDay) {
+        const iso = new Date(dateStr).toISOString().replace(/[-:]/g, '');
+        return allDay ? iso.slice(0, 8) : iso.slice(0, 15) + 'Z';
+      },
+
+      inviteGoogleUrl(inv) {
+        const start = this.icsStamp(inv.start, inv.all_day);
+        const end = this.icsStamp(inv.end || inv.start, inv.all_day);
+        const params = new URLSearchParams({ action: 'TEMPLATE', text: inv.summary || '', dates: `${start}/${end}` });
+        if (inv.location) params.set('location', inv.location);
+        if (inv.description) params.set('details', inv.description);
+        return 'https://calendar.google.com/calendar/render?' + params.toString();
+      },
+
+      downloadInviteIcs(inv) {
+        const esc = (s) => (s || '').replace(/\\/g, '\\\\').replace(/([,;])/g, '\\$1').replace(/\n/g, '\\n');
+        const date = (s) => (inv.all_day ? ';VALUE=DATE:' : ':') + this.icsStamp(s, inv.all_day);
+        const lines = [
+          'BEGIN:VCALENDAR', 'VERSION:2.0', 'PRODID:-//mail-archive//EN', 'BEGIN:VEVENT',
+          'UID:' + (inv.uid || crypto.randomUUID()),
+          'DTSTAMP:' + this.icsStamp(new Date().toISOString(), false),
+          'DTSTART' + date(inv.start),
+        ];
+        if (inv.end) lines.push('DTEND' + date(inv.end));
+        lines.push('SUMMARY:' + esc(inv.summary));
+        if (inv.location) lines.push('LOCATION:' + esc(inv.location));
+        if (inv.description) lines.push('DESCRIPTION:' + esc(inv.description));
+        lines.push('END:VEVENT', 'END:VCALENDAR');
+        const url = URL.createObjectURL(new Blob([lines.join('\r\n') + '\r\n'], { type: 'text/calendar' }));
+        const a = document.createElement('a');
+        a.href = url;
+        a.download = (inv.summary || 'invite').replace(/[^\w.-]+/g, '_') + '.ics';
+        a.click();
+        URL.revokeObjectURL(url);
+      },
+
       // --- Email Detail ---
       async showEmailDetail(path, accountId) {
         this.view = 'detail';
@@ -677,6 +903,87 @@
         return url;
       },
 
+      emailPdfUrl() {
+        if (!this.selectedEmail?.path) return '#';
+        let url = `/api/email/pdf?path=${encodeURIComponent(this.selectedEmail.path)}`;
+        if (this.detailAccountId) url += `&account_id=${encodeURIComponent(this.detailAccountId)}`;
+        return url;
+      },
+
+      emailPrintUrl() {
+        if (!this.selectedEmail?.path) return '#';
+        let url = `/api/email/print?path=${encodeURIComponent(this.selectedEmail.path)}`;
+        if (this.detailAccountId) url += `&account_id=${encodeURIComponent(this.detailAccountId)}`;
+        return url;
+      },
+
+      async reparseEmail() {
+        if (!this.selectedEmail?.path || this.reparsing) return;
+        const path = this.selectedEmail.path;
+        let url = `/api/email/reparse?path=${encodeURIComponent(path)}`;
+        if (this.detailAccountId) url += `&account_id=${encodeURIComponent(this.detailAccountId)}`;
+        this.reparsing = true;
+        try {
+          const r = await fetch(url, { method: 'POST' });
+          const data = await r.json().catch(() => ({}));
+          if (!r.ok) throw new Error(apiError(data, 'Reparse failed'));
+          await this.showEmailDetail(path, this.detailAccountId);
+          this.showToast(data.vector_error ? `Reindexed; similarity not updated: ${data.vector_error}` : 'Email reparsed', data.vector_error ? 'warning' : 'success');
+        } catch (e) {
+          this.showToast(e.message, 'error');
+        } finally {
+          this.reparsing = false;
+        }
+      },
+
+      // toggleMark flags or stars the open email, or undoes it. Marks are
+      // kept by checksum, so every listed copy of the message follows.
+      async toggleMark(mark) {
+        const email = this.selectedEmail;
+        if (!email?.path) return;
+        const on = mark === 'flag' ? email.flagged : email.starred;
+        const action = (on ? 'un' : '') + mark;
+        try {
+          const r = await fetch(`/api/email/${action}?path=${encodeURIComponent(email.path)}`, { method: 'POST' });
+          const data = await r.json().catch(() => ({}));
+          if (!r.ok) throw new Error(apiError(data, 'Could not save the mark'));
+          email.flagged = data.flagged;
+          email.starred = data.starred;
+          const markKey = (path) => path.split('/').pop().split('-')[0].slice(0, 16);
+          const key = markKey(email.path);
+          for (const h of this.searchResults?.hits || []) {
+            if (markKey(h.path) === key) {
+              h.flagged = data.flagged;
+              h.starred = data.starred;
+            }
+          }
+        } catch (e) {
+          this.showToast(e.message, 'error');
+        }
+      },
+
+      // Virtual folder: files stay put; vfolder:name searches find them.
+      async moveEmail() {
+        const email = this.selectedEmail;
+        if (!email?.path) return;
+        const folder = prompt('Move to virtual folder (empty to remove):', email.vfolder || '');
+        if (folder === null) return;
+        try {
+          const r = await fetch('/api/email/move', {
+            method: 'POST',
+            headers: { 'Content-Type': 'application/json' },
+            body: JSON.stringify({ paths: [email.path], folder })
+          });
+          const data = await r.json().catch(() => ({}));
+          if (!r.ok) throw new Error(apiError(data, 'Could not move the email'));
+          if (data.skipped?.length) throw new Error('This file has no checksum to file it by; run mails migrate-filenames');
+          email.vfolder = data.folder;
+          this.showToast(data.folder ? `Moved to ${data.folder}` : 'Removed from its virtual folder', 'success');
+        } catch (e) {
+          this.showToast(e.message, 'error');
+        }
+      },
+
       attachmentDownloadUrl(index) {
         if (!this.selectedEmail?.path) return '#';
         let url = `/api/email/attachment?path=${encodeURIComponent(this.selectedEmail.path)}&index=${index}`;
@@ -720,6 +1027,7 @@
             body: JSON.stringify(accountID ? { account_id: accountID } : {})
           });
           switch (r.status) {
+            case 400: this.showToast('This account is import-only', 'warning'); break;
             case 409: this.showToast('Sync already running', 'warning'); break;
             case 200:
             case 201:
@@ -746,10 +1054,66 @@
         }
       },
 
+      async markAccountSeen(accountID) {
+        try {
+          const r = await fetch(`/api/accounts/${accountID}/seen`, { method: 'POST' });
+          if (!r.ok) throw new Error();
+          const status = await r.json();
+          this.syncStatusMap = { ...this.syncStatusMap, [accountID]: status };
+        } catch {
+          this.showToast('Failed to update account', 'error');
+        }
+      },
+
+      async fixAccountDates(acct) {
+        let jobID;
+        try {
+          const r = await fetch(`/api/accounts/${acct.id}/fix-dates`, { method: 'POST' });
+          const data = await r.json();
+          if (!r.ok) throw new Error(apiError(data));
+          jobID = data.job_id;
+        } catch (e) {
+          this.showToast(`Fix dates failed: ${e.message || 'request failed'}`, 'error');
+          return;
+        }
+        this.showToast(`Fixing dates for ${acct.email}...`, 'info');
+        const timer = setInterval(async () => {
+          try {
+            const r = await fetch(`/api/import/status/${jobID}`);
+            if (!r.ok) return;
+            const job = await r.json();
+            if (job.phase === 'done') {
+              clearInterval(timer);
+              const res = job.fix_dates;
+              this.showToast(`Dates fixed: ${res.fixed} updated, ${res.skipped} skipped, ${res.errors} errors`, 'success');
+            } else if (job.phase === 'error') {
+              clearInterval(timer);
+              this.showToast(`Fix dates failed: ${job.error}`, 'error');
+            }
+          } catch {
+            // ignore poll errors
+          }
+        }, 1500);
+      },
+
       accountSyncStatus(accountID) {
         return this.syncStatusMap[accountID] ?? {};
       },
 
+      // Import-only accounts (PST) have no Sync button or sync state.
+      isSyncable(acct) {
+        return this.accountSyncStatus(acct.id).syncable ?? acct.type !== 'PST';
+      },
+
+      // Overall IMAP sync percent: finished folders plus the fraction of the
+      // current one. Null when the server reports no folder counts.
+      accountSyncPercent(accountID) {
+        const st = this.accountSyncStatus(accountID);
+        if (!st.folders_total) return null;
+        const inFolder = st.messages_total > 0 ? st.messages_done / st.messages_total : 0;
+        return Math.min(100, Math.round((st.folders_done + inFolder) / st.folders_total * 100));
+      },
+
       startSyncPoll() {
         this.refreshSyncStatus();
         this.accountPollTimer = setInterval(() => this.refreshSyncStatus(), 3000);
@@ -798,11 +1162,11 @@
         return `${value} ${unit}`;
       },
 
-      // --- PST/OST Import ---
+      // --- PST/OST and Maildir Import ---
       onPSTFileSelected(e) {
         this.importFile = e.target.files[0] ?? null;
         if (this.importFile && !this.importTitle) {
-          this.importTitle = this.importFile.name.replace(/\.(pst|ost)$/i, '');
+          this.importTitle = this.importFile.name.replace(/\.(pst|ost|zip|tar|tgz|tar\.gz)$/i, '');
         }
       },
 
@@ -829,12 +1193,12 @@
           if (xhr.status >= 200 && xhr.status < 300) {
             const data = JSON.parse(xhr.responseText);
             this.importJob = { id: data.job_id, phase: 'extracting', current: 0, total: 0 };
-            this.pollImportStatus(data.job_id);
+            this.watchImport(data.job_id);
             this.showToast('Upload complete, extracting messages...', 'success');
           } else {
             this.importRunning = false;
             let msg = 'Upload failed';
-            try { msg = JSON.parse(xhr.responseText).error; } catch (e) {}
+            try { msg = apiError(JSON.parse(xhr.responseText), msg); } catch (e) {}
             this.importJob = { phase: 'error', error: msg };
             this.showToast(msg, 'error');
           }
@@ -844,10 +1208,34 @@
           this.importJob = { phase: 'error', error: 'Upload failed' };
           this.showToast('Upload failed', 'error');
         });
-        xhr.open('POST', '/api/import/pst');
+        // Archives hold a Maildir, Thunderbird or Apple Mail tree.
+        const endpoint = /\.(pst|ost)$/i.test(this.importFile.name) ? '/api/import/pst' : '/api/import/maildir';
+        xhr.open('POST', endpoint);
         xhr.send(formData);
       },
 
+      // watchImport follows an import job over server-sent events, falling
+      // back to polling when the stream cannot be opened or drops.
+      watchImport(jobID) {
+        if (!window.EventSource) {
+          this.pollImportStatus(jobID);
+          return;
+        }
+        const events = new EventSource(`/api/import/${jobID}/events`);
+        events.onmessage = (e) => {
+          const data = JSON.parse(e.data);
+          this.importJob = data;
+          if (data.phase === 'done' || data.phase === 'error') {
+            events.close();
+            this.importFinished(data);
+          }
+        };
+        events.onerror = () => {
+          events.close();
+          this.pollImportStatus(jobID);
+        };
+      },
+
       pollImportStatus(jobID) {
         if (this.importPollTimer) clearInterval(this.importPollTimer);
         this.importPollTimer = setInterval(async () => {
@@ -856,15 +1244,10 @@
             if (!r.ok) return;
             const data = await r.json();
             this.importJob = data;
-            const finish = () => {
+            if (data.phase === 'done' || data.phase === 'error') {
               clearInterval(this.importPollTimer);
               this.importPollTimer = null;
-              this.importRunning = false;
-              this.importHistory.unshift(data);
-            };
-            switch (data.phase) {
-              case 'done': finish(); this.loadAccounts(); this.showToast(`Import complete: ${data.current} messages`, 'success'); break;
-              case 'error': finish(); this.showToast(`Import failed: ${data.error}`, 'error'); break;
+              this.importFinished(data);
             }
           } catch {
             // ignore poll errors
@@ -872,6 +1255,18 @@
         }, 1500);
       },
 
+      importFinished(data) {
+        this.importRunning = false;
+        this.importHistory.unshift(data);
+        if (data.phase === 'error') {
+          this.showToast(`Import failed: ${data.error}`, 'error');
+          return;
+        }
+        this.loadAccounts();
+        const dated = data.fix_dates?.fixed ? `, ${data.fix_dates.fixed} file dates set from headers` : '';
+        this.showToast(`Import complete: ${data.current} messages${dated}`, 'success');
+      },
+
     }
   };
 